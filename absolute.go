@@ -0,0 +1,56 @@
+package archiver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AbsolutePathPolicy is what to do with entries being
+// extracted whose paths are absolute, such as "/etc/passwd"
+// or `C:\Windows\win.ini`, which archives from untrusted
+// sources may use to overwrite files of the system.
+type AbsolutePathPolicy int
+
+const (
+	// AbsolutePathStrip removes the leading slashes and
+	// drive letter of the path, so the entry is extracted
+	// inside of the destination, and logs a warning.
+	AbsolutePathStrip AbsolutePathPolicy = iota
+
+	// AbsolutePathReject fails with an error
+	// which is ErrIllegalPath.
+	AbsolutePathReject
+)
+
+// WarningAbsolutePath is the kind of warnings for
+// absolute paths of entries which are stripped.
+const WarningAbsolutePath WarningKind = "absolute path"
+
+// stripAbsolute returns name without a leading drive
+// letter and slashes, which are removed whatever the
+// system, since archives may be made on any of them.
+func stripAbsolute(name string) string {
+	if len(name) >= 2 && name[1] == ':' &&
+		('a' <= name[0] && name[0] <= 'z' || 'A' <= name[0] && name[0] <= 'Z') {
+		name = name[2:]
+	}
+	return strings.TrimLeft(name, `/\`)
+}
+
+// relativePath returns name made relative as policy
+// says, logging a warning to logger if it is stripped.
+func relativePath(name string, policy AbsolutePathPolicy, logger Logger) (string, error) {
+	rel := stripAbsolute(name)
+	if rel == name {
+		return name, nil
+	}
+	if policy == AbsolutePathReject {
+		return "", pathErrorf(ErrIllegalPath, name, "%s: path is absolute", name)
+	}
+	logWarning(logger, Warning{
+		Path:   name,
+		Kind:   WarningAbsolutePath,
+		Detail: fmt.Sprintf("extracted as %s", rel),
+	})
+	return rel, nil
+}
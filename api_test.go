@@ -0,0 +1,60 @@
+package archiver
+
+import "io"
+
+// The method sets of the interfaces of the stable API,
+// which must not change; see the package documentation.
+// Each interface is checked both ways, so methods can
+// be neither added nor removed.
+type (
+	stableArchiver interface {
+		Archive(sources []string, destination string) error
+	}
+	stableUnarchiver interface {
+		Unarchive(source, destination string) error
+	}
+	stableWalker interface {
+		Walk(archive string, walkFn WalkFunc) error
+	}
+	stableExtractor interface {
+		Extract(source, target, destination string) error
+	}
+	stableReader interface {
+		Open(in io.Reader, size int64) error
+		Read() (File, error)
+		Close() error
+	}
+	stableWriter interface {
+		Create(out io.Writer) error
+		Write(f File) error
+		Close() error
+	}
+	stableCompressor interface {
+		Compress(in io.Reader, out io.Writer) error
+		CheckExt(filename string) error
+	}
+	stableDecompressor interface {
+		Decompress(in io.Reader, out io.Writer) error
+	}
+)
+
+var (
+	_ stableArchiver     = Archiver(nil)
+	_ Archiver           = stableArchiver(nil)
+	_ stableUnarchiver   = Unarchiver(nil)
+	_ Unarchiver         = stableUnarchiver(nil)
+	_ stableWalker       = Walker(nil)
+	_ Walker             = stableWalker(nil)
+	_ stableExtractor    = Extractor(nil)
+	_ Extractor          = stableExtractor(nil)
+	_ stableReader       = Reader(nil)
+	_ Reader             = stableReader(nil)
+	_ stableWriter       = Writer(nil)
+	_ Writer             = stableWriter(nil)
+	_ stableCompressor   = Compressor(nil)
+	_ Compressor         = stableCompressor(nil)
+	_ stableDecompressor = Decompressor(nil)
+	_ Decompressor       = stableDecompressor(nil)
+
+	_ func(File) error = WalkFunc(nil)
+)
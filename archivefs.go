@@ -0,0 +1,496 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ArchiveFS is a read-only view of the files in an archive
+// as an fs.FS, so that archives can be used by anything
+// which takes one, such as http.FS or template.ParseFS,
+// without extracting them. Folders which contain files
+// in the archive but are not in it themselves are made
+// up, and symbolic and hard links are followed within
+// the archive.
+//
+// Files in zip archives are read directly from the
+// archive. Files in other archives are read into memory
+// when they are opened, by walking the archive up to
+// them, so opening them is much slower.
+//
+// An ArchiveFS is safe for concurrent use. It must
+// be closed when it is no longer needed.
+type ArchiveFS struct {
+	archive string
+	format  Walker
+	entries map[string]*archiveFSEntry
+	zr      *zip.ReadCloser // for zip archives
+
+	mu sync.Mutex // for walking with format
+}
+
+// archiveFSEntry is a file or folder in an ArchiveFS.
+type archiveFSEntry struct {
+	info     os.FileInfo
+	index    int       // position in the archive
+	zf       *zip.File // for zip archives
+	link     string    // target of symbolic links
+	hardlink string    // target of hard links
+	children []string  // names of the files in folders
+}
+
+// NewArchiveFS returns an ArchiveFS of the files in the
+// archive file named archive, which is of the given
+// format; if format is nil, it is chosen by the extension
+// of the file name as by ByExtension. The archive is
+// walked once to list its files.
+func NewArchiveFS(archive string, format Walker) (*ArchiveFS, error) {
+	if format == nil {
+		f, err := ByExtension(archive)
+		if err != nil {
+			return nil, err
+		}
+		w, ok := f.(Walker)
+		if !ok {
+			return nil, pathErrorf(ErrUnsupportedType, archive, "format %s cannot be walked", f)
+		}
+		format = w
+	}
+
+	a := &ArchiveFS{
+		archive: archive,
+		format:  format,
+		entries: map[string]*archiveFSEntry{
+			".": {info: implicitDirInfo(".")},
+		},
+	}
+	var err error
+	if _, ok := format.(*Zip); ok {
+		err = a.indexZip()
+	} else {
+		err = a.index()
+	}
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+	a.resolveHardLinks()
+	a.linkChildren()
+
+	return a, nil
+}
+
+// index lists the files in the archive by walking it.
+func (a *ArchiveFS) index() error {
+	var i int
+	err := a.format.Walk(a.archive, func(f File) error {
+		e := &archiveFSEntry{info: f.FileInfo, index: i}
+		i++
+		if hdr, ok := f.Header.(*tar.Header); ok {
+			switch hdr.Typeflag {
+			case tar.TypeSymlink:
+				e.link = hdr.Linkname
+			case tar.TypeLink:
+				e.hardlink = cleanEntryPath(hdr.Linkname)
+			}
+		}
+		a.add(entryPath(f), e)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walking %s: %w", a.archive, err)
+	}
+	return nil
+}
+
+// indexZip lists the files in the zip archive from its
+// central directory, and keeps the archive open so that
+// the files can be read directly.
+func (a *ArchiveFS) indexZip() error {
+	zr, err := zip.OpenReader(a.archive)
+	if err != nil {
+		return fmt.Errorf("opening zip reader: %w", err)
+	}
+	a.zr = zr
+
+	for i, zf := range zr.File {
+		e := &archiveFSEntry{info: zf.FileInfo(), index: i, zf: zf}
+		if zf.Mode()&os.ModeSymlink != 0 {
+			// the contents of symbolic links
+			// in zip archives are their targets
+			target, err := readZipFile(zf)
+			if err != nil {
+				return fmt.Errorf("reading link %s: %w", zf.Name, err)
+			}
+			e.link = string(target)
+		}
+		a.add(entryPath(File{FileInfo: e.info, Header: zf.FileHeader}), e)
+	}
+	return nil
+}
+
+// add adds e to a as name, along with the folders
+// containing it which have not been added yet. Files
+// with the same name as earlier ones replace them.
+func (a *ArchiveFS) add(name string, e *archiveFSEntry) {
+	if name == "" {
+		return // the root folder itself, such as "./"
+	}
+	e.info = FileInfo{FileInfo: e.info, CustomName: path.Base(name)}
+	a.entries[name] = e
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if _, ok := a.entries[dir]; ok {
+			break
+		}
+		a.entries[dir] = &archiveFSEntry{info: implicitDirInfo(dir)}
+	}
+}
+
+// resolveHardLinks gives hard links the information
+// about the files they link to, which are described
+// only once in archives.
+func (a *ArchiveFS) resolveHardLinks() {
+	for name, e := range a.entries {
+		if e.hardlink == "" {
+			continue
+		}
+		if target, err := a.lookup(name); err == nil {
+			e.info = FileInfo{FileInfo: target.info, CustomName: path.Base(name)}
+		}
+	}
+}
+
+// linkChildren lists the files in each
+// folder, in order by name.
+func (a *ArchiveFS) linkChildren() {
+	for name := range a.entries {
+		if name == "." {
+			continue
+		}
+		parent := a.entries[path.Dir(name)]
+		parent.children = append(parent.children, name)
+	}
+	for _, e := range a.entries {
+		sort.Strings(e.children)
+	}
+}
+
+// Open opens the file named name, which
+// is a slash-separated path in the archive.
+func (a *ArchiveFS) Open(name string) (fs.File, error) {
+	e, err := a.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info := FileInfo{FileInfo: e.info, CustomName: path.Base(name)}
+
+	if e.info.IsDir() {
+		return &archiveFSDir{info: info, entries: a.dirEntries(e)}, nil
+	}
+	if e.zf != nil {
+		f := &archiveFSZipFile{info: info, zf: e.zf}
+		if err := f.reopen(); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return f, nil
+	}
+	data, err := a.readFile(e)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &archiveFSFile{info: info, Reader: bytes.NewReader(data)}, nil
+}
+
+// ReadDir returns the files in the folder named
+// name, in order by name.
+func (a *ArchiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := a.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if !e.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	return a.dirEntries(e), nil
+}
+
+// Stat returns information about the file named name.
+func (a *ArchiveFS) Stat(name string) (fs.FileInfo, error) {
+	e, err := a.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return FileInfo{FileInfo: e.info, CustomName: path.Base(name)}, nil
+}
+
+// Close closes the archive, if it was kept open.
+func (a *ArchiveFS) Close() error {
+	if a.zr != nil {
+		return a.zr.Close()
+	}
+	return nil
+}
+
+// lookup returns the entry named name, following links
+// in name and the folders containing it. Links to files
+// outside the archive are treated as if they do not exist.
+func (a *ArchiveFS) lookup(name string) (*archiveFSEntry, error) {
+	name, err := resolvePath(name, func(name string) (string, bool, error) {
+		e, ok := a.entries[name]
+		switch {
+		case !ok:
+			return "", false, fs.ErrNotExist
+		case e.hardlink != "":
+			return e.hardlink, false, nil
+		case e.link != "":
+			return symlinkTarget(name, e.link)
+		}
+		return "", e.info.IsDir(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.entries[name], nil
+}
+
+// resolvePath returns the path that the slash-separated
+// path name resolves to once the links in it and the
+// folders containing it are followed. For each file along
+// the way, stat returns the path of its target if it is a
+// link, and otherwise "" and whether it is a folder.
+func resolvePath(name string, stat func(name string) (target string, isDir bool, err error)) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", fs.ErrInvalid
+	}
+	var links int
+	cur, rest := ".", name
+	if rest == "." {
+		rest = ""
+	}
+	for rest != "" {
+		elem := rest
+		rest = ""
+		if i := strings.IndexByte(elem, '/'); i >= 0 {
+			elem, rest = elem[:i], elem[i+1:]
+		}
+		next := path.Join(cur, elem)
+		target, isDir, err := stat(next)
+		if err != nil {
+			return "", err
+		}
+		if target != "" {
+			links++
+			if links > maxArchiveFSLinks {
+				return "", fmt.Errorf("too many links")
+			}
+			if !fs.ValidPath(target) {
+				return "", fs.ErrNotExist
+			}
+			// start over from the target
+			cur, rest = ".", path.Join(target, rest)
+			if rest == "." {
+				rest = ""
+			}
+			continue
+		}
+
+		if rest != "" && !isDir {
+			return "", fs.ErrNotExist
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+// symlinkTarget returns the path of the target of the
+// symbolic link named name, which links to link, for
+// resolvePath. Absolute links are treated as if their
+// targets do not exist.
+func symlinkTarget(name, link string) (string, bool, error) {
+	if path.IsAbs(link) {
+		return "", false, fs.ErrNotExist
+	}
+	return path.Join(path.Dir(name), link), false, nil
+}
+
+// dirEntries returns the entries of the files in
+// the folder e.
+func (a *ArchiveFS) dirEntries(e *archiveFSEntry) []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(e.children))
+	for _, name := range e.children {
+		entries = append(entries, fs.FileInfoToDirEntry(a.entries[name].info))
+	}
+	return entries
+}
+
+// readFile reads the contents of e by walking the
+// archive up to it.
+func (a *ArchiveFS) readFile(e *archiveFSEntry) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var data []byte
+	var found bool
+	i := -1
+	err := a.format.Walk(a.archive, func(f File) error {
+		i++
+		if i != e.index {
+			return nil
+		}
+		found = true
+		var err error
+		data, err = ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		return ErrStopWalk
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking %s: %w", a.archive, err)
+	}
+	if !found {
+		return nil, fmt.Errorf("file is no longer in %s", a.archive)
+	}
+	return data, nil
+}
+
+// maxArchiveFSLinks is how many links are followed
+// to find a file, like the limit of most systems.
+const maxArchiveFSLinks = 40
+
+// implicitDirInfo returns information about a folder
+// which is not in the archive itself.
+func implicitDirInfo(name string) os.FileInfo {
+	return virtualFileInfo{e: VirtualEntry{Name: name, Mode: os.ModeDir | 0755}}
+}
+
+// readZipFile returns the contents of zf.
+func readZipFile(zf *zip.File) ([]byte, error) {
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// archiveFSFile is a file in an ArchiveFS (or
+// a MemFileSystem) whose contents are in memory.
+type archiveFSFile struct {
+	info os.FileInfo
+	*bytes.Reader
+}
+
+func (f *archiveFSFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *archiveFSFile) Close() error               { return nil }
+
+// archiveFSZipFile is a file in an ArchiveFS which is
+// read directly from a zip archive. Since the contents
+// are compressed, seeking backwards opens the file again
+// and seeking forwards reads the contents in between.
+type archiveFSZipFile struct {
+	info os.FileInfo
+	zf   *zip.File
+	rc   io.ReadCloser
+	off  int64
+}
+
+func (f *archiveFSZipFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *archiveFSZipFile) Read(p []byte) (int, error) {
+	n, err := f.rc.Read(p)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *archiveFSZipFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.info.Size()
+	default:
+		return f.off, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return f.off, fmt.Errorf("negative position: %d", offset)
+	}
+	if offset < f.off {
+		if err := f.reopen(); err != nil {
+			return f.off, err
+		}
+	}
+	_, err := io.CopyN(ioutil.Discard, f, offset-f.off)
+	if err == io.EOF {
+		// past the end, where reads return io.EOF
+		f.off, err = offset, nil
+	}
+	return f.off, err
+}
+
+func (f *archiveFSZipFile) Close() error { return f.rc.Close() }
+
+// reopen opens the contents of f from the beginning.
+func (f *archiveFSZipFile) reopen() error {
+	rc, err := f.zf.Open()
+	if err != nil {
+		return err
+	}
+	if f.rc != nil {
+		f.rc.Close()
+	}
+	f.rc, f.off = rc, 0
+	return nil
+}
+
+// archiveFSDir is a folder in an ArchiveFS
+// (or a MemFileSystem).
+type archiveFSDir struct {
+	info    os.FileInfo
+	entries []fs.DirEntry
+	off     int
+}
+
+func (d *archiveFSDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *archiveFSDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fmt.Errorf("is a directory")}
+}
+
+func (d *archiveFSDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.off:]
+	if n <= 0 {
+		d.off = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.off += n
+	return rest[:n], nil
+}
+
+func (d *archiveFSDir) Close() error { return nil }
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = fs.ReadDirFS((*ArchiveFS)(nil))
+	_ = fs.StatFS((*ArchiveFS)(nil))
+	_ = io.Seeker((*archiveFSFile)(nil))
+	_ = io.Seeker((*archiveFSZipFile)(nil))
+	_ = fs.ReadDirFile((*archiveFSDir)(nil))
+)
@@ -0,0 +1,146 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestArchiveFS(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	expected, err := ioutil.ReadFile("testdata/proverbs/extra/proverb3.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"test.tar", "test.tar.gz", "test.zip"} {
+		archive := filepath.Join(tmp, name)
+		format, err := ByExtension(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = format.(Archiver).Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatalf("[%s] archiving: %v", name, err)
+		}
+
+		fsys, err := NewArchiveFS(archive, nil)
+		if err != nil {
+			t.Fatalf("[%s] opening: %v", name, err)
+		}
+		err = fstest.TestFS(fsys,
+			"testdata/quote1.txt",
+			"testdata/already-compressed.jpg",
+			"testdata/proverbs/proverb1.txt",
+			"testdata/proverbs/extra/proverb3.txt")
+		if err != nil {
+			t.Errorf("[%s] %v", name, err)
+		}
+		contents, err := fs.ReadFile(fsys, "testdata/proverbs/extra/proverb3.txt")
+		if err != nil {
+			t.Errorf("[%s] reading file: %v", name, err)
+		} else if !bytes.Equal(contents, expected) {
+			t.Errorf("[%s] expected %q but got %q", name, expected, contents)
+		}
+		fsys.Close()
+	}
+}
+
+func TestArchiveFSLinks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// only file.txt has contents; the folder
+	// containing it is not in the archive
+	archive := filepath.Join(tmp, "links.tar")
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "dir/file.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 5},
+		{Name: "symlink", Typeflag: tar.TypeSymlink, Linkname: "dir/file.txt"},
+		{Name: "dirlink", Typeflag: tar.TypeSymlink, Linkname: "dir"},
+		{Name: "dir/hardlink", Typeflag: tar.TypeLink, Linkname: "dir/file.txt"},
+		{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: "../outside"},
+		{Name: "loop", Typeflag: tar.TypeSymlink, Linkname: "loop"},
+	} {
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			tw.Write([]byte("hello"))
+		}
+	}
+	tw.Close()
+	err = ioutil.WriteFile(archive, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, err := NewArchiveFS(archive, &Tar{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+
+	for i, tc := range []struct {
+		name      string
+		shouldErr bool
+	}{
+		{name: "dir/file.txt"},
+		{name: "symlink"},
+		{name: "dirlink/file.txt"},
+		{name: "dirlink/hardlink"},
+		{name: "escape", shouldErr: true},
+		{name: "loop", shouldErr: true},
+		{name: "dir/missing", shouldErr: true},
+		{name: "../links.tar", shouldErr: true},
+	} {
+		contents, err := fs.ReadFile(fsys, tc.name)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error reading %s, but got none", i, tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: reading %s: %v", i, tc.name, err)
+			continue
+		}
+		if string(contents) != "hello" {
+			t.Errorf("Test %d: expected %s to contain %q, got %q", i, tc.name, "hello", contents)
+		}
+	}
+
+	info, err := fs.Stat(fsys, "dir/hardlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 5 || info.Name() != "hardlink" {
+		t.Errorf("expected hard link to be described as its target, got size %d and name %s", info.Size(), info.Name())
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if len(names) != 5 || names[0] != "dir" {
+		t.Errorf("expected made-up folder and links in root folder, got %v", names)
+	}
+}
@@ -1,6 +1,8 @@
 package archiver
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"fmt"
 	"io"
 	"os"
@@ -8,6 +10,8 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+
+	"github.com/nwaples/rardecode"
 )
 
 // Archiver is a type that can create an archive file
@@ -16,12 +20,31 @@ type Archiver interface {
 	Archive(sources []string, destination string) error
 }
 
+// Appender is a type that can add files to
+// an existing archive file.
+type Appender interface {
+	Append(archive string, sources []string) error
+}
+
+// WriterArchiver is a type that can write archives of
+// files to a stream, such as the body of an HTTP response.
+type WriterArchiver interface {
+	ArchiveWriter(sources []string, w io.Writer) error
+}
+
 // Unarchiver is a type that can extract archive files
 // into a folder.
 type Unarchiver interface {
 	Unarchive(source, destination string) error
 }
 
+// ReaderUnarchiver is a type that can extract archives
+// read from a stream, such as standard input or the
+// body of an HTTP response, into a folder.
+type ReaderUnarchiver interface {
+	UnarchiveReader(in io.Reader, destination string) error
+}
+
 // Writer can write discrete byte streams of files to
 // an output stream.
 type Writer interface {
@@ -38,6 +61,15 @@ type Reader interface {
 	Close() error
 }
 
+// ReaderAtOpener is a Reader which can open archives
+// for random access, such as zip archives in memory,
+// in object storage or within other files, without
+// copying them to a temporary file first.
+type ReaderAtOpener interface {
+	Reader
+	OpenReaderAt(ra io.ReaderAt, size int64) error
+}
+
 // Extractor can extract a specific file from a source
 // archive to a specific destination folder on disk.
 type Extractor interface {
@@ -46,6 +78,15 @@ type Extractor interface {
 
 // File provides methods for accessing information about
 // or contents of a file within an archive.
+//
+// The contents of a File returned by a Reader must be
+// closed when finished reading from them, even if they
+// were not read at all, since they may hold on to a
+// decompressor or other resources. Walkers close the
+// Files they pass to the walk function after it returns,
+// so walk functions must not close them or keep them
+// for later. See SetLeakDetection for finding Files
+// which are not closed.
 type File struct {
 	os.FileInfo
 
@@ -85,6 +126,11 @@ type ReadFakeCloser struct {
 // Close implements io.Closer.
 func (rfc ReadFakeCloser) Close() error { return nil }
 
+// eofReader is an io.Reader with no contents.
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
+
 // Walker can walk an archive file and return information
 // about each item in the archive.
 type Walker interface {
@@ -94,13 +140,125 @@ type Walker interface {
 // WalkFunc is called at each item visited by Walk.
 // If an error is returned, the walk may continue
 // if the Walker is configured to continue on error.
-// The sole exception is the error value ErrStopWalk,
-// which stops the walk without an actual error.
+// The exceptions are the error value ErrStopWalk,
+// which stops the walk without an actual error, and
+// ErrSkipDir, which skips the entries of a directory.
 type WalkFunc func(f File) error
 
+// RefWalker can walk an archive file like a Walker, but
+// it passes each item by reference instead of by value.
+// This allows implementations to reuse allocations from
+// one item to the next, which reduces garbage collection
+// pressure when scanning archives with many entries.
+type RefWalker interface {
+	WalkRef(archive string, walkFn WalkRefFunc) error
+}
+
+// WalkRefFunc is called at each item visited by WalkRef.
+// The File it is given, as well as its FileInfo, Header,
+// and contents, are only valid until walkFn returns; the
+// same values are reused for the next item, so they must
+// not be retained (copy any needed information instead).
+// Errors are handled the same way as for WalkFunc.
+type WalkRefFunc func(f *File) error
+
+// BatchWalker can walk an archive file like a Walker, but
+// it passes items to the callback in batches, which helps
+// amortize per-item overhead in downstream systems such
+// as bulk indexers.
+type BatchWalker interface {
+	WalkBatches(archive string, batchSize int, fn WalkBatchFunc) error
+}
+
+// WalkBatchFunc is called with each batch of items visited
+// by WalkBatches; every batch except the last one has the
+// requested number of items. The contents of the files may
+// be read, in any order, until fn returns, after which they
+// are closed. Errors are handled the same way as for
+// WalkFunc, except that when continuing on error, the walk
+// continues with the next batch.
+type WalkBatchFunc func(files []File) error
+
+// walkBatch calls fn with batch, then closes
+// the files in the batch.
+func walkBatch(batch []File, fn WalkBatchFunc) error {
+	defer func() {
+		for _, f := range batch {
+			f.Close()
+		}
+	}()
+	return fn(batch)
+}
+
+// entryPath returns the slash-separated path of f within
+// its archive which, unlike f.Name(), includes the folders
+// containing f. Leading slashes and dots are removed.
+func entryPath(f File) string {
+	name := f.Name()
+	switch hdr := f.Header.(type) {
+	case *tar.Header:
+		name = hdr.Name
+	case zip.FileHeader:
+		name = hdr.Name
+	case *zip.FileHeader:
+		name = hdr.Name
+	case *rardecode.FileHeader:
+		name = filepath.ToSlash(hdr.Name)
+	case *CpioHeader:
+		name = hdr.Name
+	case *CabHeader:
+		name = hdr.Name
+	case *WarcHeader:
+		name = warcRecordName(hdr)
+	}
+	return cleanEntryPath(name)
+}
+
+// cleanEntryPath returns the slash-separated path name
+// of an entry in an archive, or of a hard link target,
+// without leading slashes and dots.
+func cleanEntryPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
 // ErrStopWalk signals Walk to break without error.
 var ErrStopWalk = fmt.Errorf("walk stopped")
 
+// ErrSkipDir signals Walk to skip the entries under a
+// directory, when returned for the directory; returned
+// for any other entry, it skips the remaining entries
+// in the same directory as that entry, as filepath.WalkDir
+// does. Since entries can be in any order in archives,
+// only the entries after the one it was returned for are
+// skipped. It is the same value as fs.SkipDir and
+// filepath.SkipDir, so any of them can be returned.
+var ErrSkipDir = filepath.SkipDir
+
+// skipDirs returns walkFn, wrapped to skip the
+// entries of the directories skipped by returning
+// ErrSkipDir, as described for ErrSkipDir.
+func skipDirs(walkFn WalkFunc) WalkFunc {
+	var skipped []string
+	return func(f File) error {
+		name := entryPath(f)
+		for _, dir := range skipped {
+			if dir == "." || name == dir || strings.HasPrefix(name, dir+"/") {
+				return nil
+			}
+		}
+		err := walkFn(f)
+		if err != ErrSkipDir {
+			return err
+		}
+		if f.IsDir() {
+			skipped = append(skipped, name)
+		} else {
+			skipped = append(skipped, path.Dir(name))
+		}
+		return nil
+	}
+}
+
 // Compressor compresses to out what it reads from in.
 // It also ensures a compatible or matching file extension.
 type Compressor interface {
@@ -122,65 +280,114 @@ type Matcher interface {
 }
 
 func fileExists(name string) bool {
-	_, err := os.Stat(name)
+	return fileExistsIn(OSFileSystem{}, name)
+}
+
+// fileExistsIn is like fileExists, for a file in fsys.
+func fileExistsIn(fsys FileSystem, name string) bool {
+	_, err := fsys.Stat(name)
 	return !os.IsNotExist(err)
 }
 
 func mkdir(dirPath string) error {
-	err := os.MkdirAll(dirPath, 0755)
+	return mkdirIn(OSFileSystem{}, dirPath)
+}
+
+// mkdirIn is like mkdir, for a directory in fsys.
+func mkdirIn(fsys FileSystem, dirPath string) error {
+	err := fsys.MkdirAll(dirPath, 0755)
 	if err != nil {
-		return fmt.Errorf("%s: making directory: %v", dirPath, err)
+		return fmt.Errorf("%s: making directory: %w", dirPath, err)
 	}
 	return nil
 }
 
+// extractMode returns mode, the mode of a file being
+// extracted, without its setuid, setgid and sticky bits
+// unless keepSetuid is true.
+func extractMode(mode os.FileMode, keepSetuid bool) os.FileMode {
+	if keepSetuid {
+		return mode
+	}
+	return mode &^ (os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
 func writeNewFile(fpath string, in io.Reader, fm os.FileMode) error {
-	err := os.MkdirAll(filepath.Dir(fpath), 0755)
+	return writeNewFileIn(OSFileSystem{}, fpath, in, fm)
+}
+
+// writeNewFileIn is like writeNewFile, for a file in fsys.
+func writeNewFileIn(fsys FileSystem, fpath string, in io.Reader, fm os.FileMode) error {
+	return writeNewFileWith(fsys, fpath, in, fm, io.Copy)
+}
+
+// writeNewSparseFileIn is like writeNewFileIn, but leaves
+// holes in the file for the blocks of zeros in its
+// contents, as copySparse does.
+func writeNewSparseFileIn(fsys FileSystem, fpath string, in io.Reader, fm os.FileMode) error {
+	return writeNewFileWith(fsys, fpath, in, fm, copySparse)
+}
+
+// writeNewFileWith is like writeNewFileIn, copying
+// the contents of the file with copyContents.
+func writeNewFileWith(fsys FileSystem, fpath string, in io.Reader, fm os.FileMode, copyContents func(io.Writer, io.Reader) (int64, error)) error {
+	err := fsys.MkdirAll(filepath.Dir(fpath), 0755)
 	if err != nil {
-		return fmt.Errorf("%s: making directory for file: %v", fpath, err)
+		return fmt.Errorf("%s: making directory for file: %w", fpath, err)
 	}
 
-	out, err := os.Create(fpath)
+	out, err := fsys.Create(fpath)
 	if err != nil {
-		return fmt.Errorf("%s: creating new file: %v", fpath, err)
+		return fmt.Errorf("%s: creating new file: %w", fpath, err)
 	}
 	defer out.Close()
 
-	err = out.Chmod(fm)
+	err = fsys.Chmod(fpath, fm)
 	if err != nil && runtime.GOOS != "windows" {
-		return fmt.Errorf("%s: changing file mode: %v", fpath, err)
+		return &partialFileError{fpath, fmt.Errorf("%s: changing file mode: %w", fpath, err)}
 	}
 
-	_, err = io.Copy(out, in)
+	_, err = copyContents(out, in)
 	if err != nil {
-		return fmt.Errorf("%s: writing file: %v", fpath, err)
+		return &partialFileError{fpath, fmt.Errorf("%s: writing file: %w", fpath, err)}
 	}
 	return nil
 }
 
 func writeNewSymbolicLink(fpath string, target string) error {
-	err := os.MkdirAll(filepath.Dir(fpath), 0755)
+	return writeNewSymbolicLinkIn(OSFileSystem{}, fpath, target)
+}
+
+// writeNewSymbolicLinkIn is like writeNewSymbolicLink,
+// for a link in fsys.
+func writeNewSymbolicLinkIn(fsys FileSystem, fpath string, target string) error {
+	err := fsys.MkdirAll(filepath.Dir(fpath), 0755)
 	if err != nil {
-		return fmt.Errorf("%s: making directory for file: %v", fpath, err)
+		return fmt.Errorf("%s: making directory for file: %w", fpath, err)
 	}
 
-	err = os.Symlink(target, fpath)
+	err = fsys.Symlink(target, fpath)
+	if symlinkNotPermitted(err) {
+		return errSymlinkNotPermitted
+	}
 	if err != nil {
-		return fmt.Errorf("%s: making symbolic link for: %v", fpath, err)
+		return fmt.Errorf("%s: making symbolic link for: %w", fpath, err)
 	}
 
 	return nil
 }
 
-func writeNewHardLink(fpath string, target string) error {
-	err := os.MkdirAll(filepath.Dir(fpath), 0755)
+// writeNewHardLinkIn makes a hard link
+// to target at fpath in fsys.
+func writeNewHardLinkIn(fsys FileSystem, fpath string, target string) error {
+	err := fsys.MkdirAll(filepath.Dir(fpath), 0755)
 	if err != nil {
-		return fmt.Errorf("%s: making directory for file: %v", fpath, err)
+		return fmt.Errorf("%s: making directory for file: %w", fpath, err)
 	}
 
-	err = os.Link(target, fpath)
+	err = fsys.Link(target, fpath)
 	if err != nil {
-		return fmt.Errorf("%s: making hard link for: %v", fpath, err)
+		return fmt.Errorf("%s: making hard link for: %w", fpath, err)
 	}
 
 	return nil
@@ -192,7 +399,26 @@ func within(parent, sub string) bool {
 	if err != nil {
 		return false
 	}
-	return !strings.Contains(rel, "..")
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// extractPath returns the path to which the entry named
+// name is extracted in destination. An absolute name is
+// made relative to destination or rejected, as absolute
+// says, with warnings logged to logger. Unless
+// allowTraversal is true, it is an error which is
+// ErrIllegalPath for the path to be outside of
+// destination, such as because of ".." elements in name.
+func extractPath(destination, name string, allowTraversal bool, absolute AbsolutePathPolicy, logger Logger) (string, error) {
+	rel, err := relativePath(name, absolute, logger)
+	if err != nil {
+		return "", err
+	}
+	to := filepath.Join(destination, rel)
+	if !allowTraversal && !within(destination, to) {
+		return "", pathErrorf(ErrIllegalPath, name, "%s: path is outside of destination", name)
+	}
+	return to, nil
 }
 
 // multipleTopLevels returns true if the paths do not
@@ -264,3 +490,27 @@ func makeNameInArchive(sourceInfo os.FileInfo, source, baseDir, fpath string) (s
 	}
 	return path.Join(baseDir, filepath.ToSlash(name)), nil
 }
+
+// NameMapper changes the name of a file in an archive
+// which is being made, such as to add a prefix to it, to
+// flatten folders or to replace characters which other
+// systems do not allow in file names. It is given the path
+// of the file on disk, and the slash-separated name it
+// would have in the archive otherwise, and returns the
+// name to use instead; if the name is empty, the file is
+// left out of the archive (but not the contents of
+// folders, which are mapped one by one).
+type NameMapper func(srcPath, defaultName string) (string, error)
+
+// mapName returns the name in an archive of the
+// file at fpath, which would otherwise be name.
+func (m NameMapper) mapName(fpath, name string) (string, error) {
+	if m == nil {
+		return name, nil
+	}
+	mapped, err := m(fpath, name)
+	if err != nil {
+		return "", fmt.Errorf("%s: mapping name in archive: %w", fpath, err)
+	}
+	return mapped, nil
+}
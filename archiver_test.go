@@ -1,12 +1,17 @@
 package archiver
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -66,6 +71,11 @@ func TestWithin(t *testing.T) {
 			path2:  "/foo/bar/daa",
 			expect: true,
 		},
+		{
+			path1:  "/foo",
+			path2:  "/foo/..bar",
+			expect: true,
+		},
 	} {
 		actual := within(tc.path1, tc.path2)
 		if actual != tc.expect {
@@ -74,6 +84,203 @@ func TestWithin(t *testing.T) {
 	}
 }
 
+func TestPathTraversal(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// archives with an entry which goes outside of
+	// the destination, after one which does not
+	names := []string{"ok.txt", "../../escaped.txt"}
+	tarball := new(bytes.Buffer)
+	tw := tar.NewWriter(tarball)
+	for _, name := range names {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 2, Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte("hi"))
+	}
+	tw.Close()
+	zipped := new(bytes.Buffer)
+	zw := zip.NewWriter(zipped)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("hi"))
+	}
+	zw.Close()
+
+	for i, tc := range []struct {
+		ext     string
+		data    []byte
+		allow   bool
+		extract bool // extract only the entry which escapes
+		escapes bool // whether the entry escapes
+	}{
+		{ext: "tar", data: tarball.Bytes()},
+		{ext: "zip", data: zipped.Bytes()},
+		{ext: "tar", data: tarball.Bytes(), allow: true, escapes: true},
+		{ext: "zip", data: zipped.Bytes(), allow: true, escapes: true},
+		{ext: "tar", data: tarball.Bytes(), extract: true},
+		{ext: "zip", data: zipped.Bytes(), extract: true},
+		{ext: "tar", data: tarball.Bytes(), extract: true, allow: true, escapes: true},
+		{ext: "zip", data: zipped.Bytes(), extract: true, allow: true, escapes: true},
+	} {
+		archive := filepath.Join(tmp, fmt.Sprintf("test%d.%s", i, tc.ext))
+		err := ioutil.WriteFile(archive, tc.data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest := filepath.Join(tmp, fmt.Sprint(i), "a", "b")
+		escaped := filepath.Join(tmp, fmt.Sprint(i), "escaped.txt")
+
+		var u interface {
+			Unarchiver
+			Extractor
+		}
+		switch tc.ext {
+		case "tar":
+			u = &Tar{MkdirAll: true, AllowPathTraversal: tc.allow}
+		case "zip":
+			u = &Zip{MkdirAll: true, AllowPathTraversal: tc.allow}
+		}
+		if tc.extract {
+			err = u.Extract(archive, names[1], dest)
+		} else {
+			err = u.Unarchive(archive, dest)
+		}
+		if tc.allow && err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		if !tc.allow && !errors.Is(err, ErrIllegalPath) {
+			t.Errorf("Test %d: expected error for path outside of destination, got %v", i, err)
+		}
+		if !tc.extract && !fileExists(filepath.Join(dest, "ok.txt")) {
+			t.Errorf("Test %d: expected file inside destination to be extracted", i)
+		}
+		if fileExists(escaped) != tc.escapes {
+			t.Errorf("Test %d: expected file outside of destination to exist: %t", i, tc.escapes)
+		}
+	}
+}
+
+func TestAbsolutePaths(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	names := []string{"/abs.txt", "C:/win/drive.txt", "//double.txt"}
+	tarball := new(bytes.Buffer)
+	tw := tar.NewWriter(tarball)
+	for _, name := range names {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 2, Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte("hi"))
+	}
+	tw.Close()
+	zipped := new(bytes.Buffer)
+	zw := zip.NewWriter(zipped)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("hi"))
+	}
+	zw.Close()
+
+	for i, tc := range []struct {
+		ext    string
+		data   []byte
+		policy AbsolutePathPolicy
+	}{
+		{ext: "tar", data: tarball.Bytes()},
+		{ext: "zip", data: zipped.Bytes()},
+		{ext: "tar", data: tarball.Bytes(), policy: AbsolutePathReject},
+		{ext: "zip", data: zipped.Bytes(), policy: AbsolutePathReject},
+	} {
+		archive := filepath.Join(tmp, fmt.Sprintf("test%d.%s", i, tc.ext))
+		err := ioutil.WriteFile(archive, tc.data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest := filepath.Join(tmp, fmt.Sprint(i))
+
+		var u Unarchiver
+		switch tc.ext {
+		case "tar":
+			u = &Tar{MkdirAll: true, AbsolutePathPolicy: tc.policy}
+		case "zip":
+			u = &Zip{MkdirAll: true, AbsolutePathPolicy: tc.policy}
+		}
+		err = u.Unarchive(archive, dest)
+		if tc.policy == AbsolutePathReject {
+			if !errors.Is(err, ErrIllegalPath) {
+				t.Errorf("Test %d: expected error for absolute path, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		for _, name := range []string{"abs.txt", "win/drive.txt", "double.txt"} {
+			if !fileExists(filepath.Join(dest, filepath.FromSlash(name))) {
+				t.Errorf("Test %d: expected %s to be extracted inside of destination", i, name)
+			}
+		}
+	}
+}
+
+func TestSetuidBits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not kept on Windows")
+	}
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	err = tw.WriteHeader(&tar.Header{Name: "prog", Mode: 04755 | 01000, Size: 2, Typeflag: tar.TypeReg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte("hi"))
+	tw.Close()
+
+	for i, keep := range []bool{false, true} {
+		dest := filepath.Join(tmp, fmt.Sprint(i))
+		err := (&Tar{MkdirAll: true, KeepSetuid: keep}).UnarchiveReader(bytes.NewReader(buf.Bytes()), dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(filepath.Join(dest, "prog"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if setuid := info.Mode()&os.ModeSetuid != 0; setuid != keep {
+			t.Errorf("Test %d: expected setuid bit to be kept: %t, got mode %v", i, keep, info.Mode())
+		}
+		if !keep && info.Mode()&os.ModeSticky != 0 {
+			t.Errorf("Test %d: expected sticky bit to be cleared, got mode %v", i, info.Mode())
+		}
+		if info.Mode().Perm() != 0755 {
+			t.Errorf("Test %d: expected permissions to be kept, got mode %v", i, info.Mode())
+		}
+	}
+}
+
 func TestMultipleTopLevels(t *testing.T) {
 	for i, tc := range []struct {
 		set    []string
@@ -227,6 +434,130 @@ func TestMakeNameInArchive(t *testing.T) {
 	}
 }
 
+func TestNameInArchive(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// flatten the folders into one, leaving out the
+	// folders themselves and the JPEG file
+	mapName := func(srcPath, defaultName string) (string, error) {
+		info, err := os.Stat(srcPath)
+		if err != nil {
+			return "", err
+		}
+		if info.IsDir() || filepath.Ext(srcPath) == ".jpg" {
+			return "", nil
+		}
+		return "flat/" + filepath.Base(defaultName), nil
+	}
+	expected := []string{
+		"flat/proverb3.txt",
+		"flat/proverb1.txt",
+		"flat/proverb2.txt",
+		"flat/quote1.txt",
+	}
+
+	for _, format := range []interface {
+		Archiver
+		Lister
+	}{
+		&Tar{NameInArchive: mapName},
+		&Zip{NameInArchive: mapName},
+	} {
+		archive := filepath.Join(tmp, "test."+format.(fmt.Stringer).String())
+		err := format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := format.List(archive)
+		if err != nil {
+			t.Fatalf("[%s] listing: %v", archive, err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("[%s] expected entries %v, got %v", archive, expected, names)
+		}
+	}
+
+	failing := func(srcPath, defaultName string) (string, error) {
+		return "", fmt.Errorf("no name for %s", defaultName)
+	}
+	err = (&Zip{NameInArchive: failing}).Archive([]string{"testdata"}, filepath.Join(tmp, "failing.zip"))
+	if err == nil {
+		t.Error("expected an error from the name mapper")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	filter := func(path string, info os.FileInfo) bool {
+		return info.Name() != "extra" && filepath.Ext(path) != ".jpg"
+	}
+	expected := []string{
+		"testdata",
+		"testdata/proverbs",
+		"testdata/proverbs/proverb1.txt",
+		"testdata/proverbs/proverb2.txt",
+		"testdata/quote1.txt",
+	}
+
+	for _, format := range []interface {
+		Archiver
+		Lister
+	}{
+		&Tar{Filter: filter},
+		&Zip{Filter: filter},
+	} {
+		archive := filepath.Join(tmp, "test."+format.(fmt.Stringer).String())
+		err := format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := format.List(archive)
+		if err != nil {
+			t.Fatalf("[%s] listing: %v", archive, err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("[%s] expected entries %v, got %v", archive, expected, names)
+		}
+	}
+}
+
+func TestHasZipExt(t *testing.T) {
+	for i, tc := range []struct {
+		filename string
+		expect   bool
+	}{
+		{filename: "foo.zip", expect: true},
+		{filename: "foo.ZIP", expect: true},
+		{filename: "foo.jar", expect: true},
+		{filename: "report.docx", expect: true},
+		{filename: "book.epub", expect: true},
+		{filename: "foo.tar", expect: false},
+		{filename: "zip", expect: false},
+	} {
+		actual := hasZipExt(tc.filename)
+		if actual != tc.expect {
+			t.Errorf("Test %d: %s: Expected %t but got %t", i, tc.filename, tc.expect, actual)
+		}
+	}
+}
+
 func TestArchiveUnarchive(t *testing.T) {
 	for _, af := range archiveFormats {
 		au, ok := af.(archiverUnarchiver)
@@ -269,6 +600,181 @@ func testArchiveUnarchive(t *testing.T, au archiverUnarchiver) {
 	symmetricTest(t, auStr, dest)
 }
 
+func TestUnarchiveReader(t *testing.T) {
+	// the default tar formats share a Tar, so use new ones
+	newTar := func() *Tar { return &Tar{MkdirAll: true} }
+	for _, ru := range []interface {
+		Archiver
+		ReaderUnarchiver
+	}{
+		newTar(),
+		&TarBz2{Tar: newTar()},
+		&TarGz{Tar: newTar()},
+		&TarLz4{Tar: newTar()},
+		&TarLzma{Tar: newTar()},
+		&TarSz{Tar: newTar()},
+		&TarXz{Tar: newTar()},
+		&TarZst{Tar: newTar()},
+	} {
+		auStr := fmt.Sprintf("%s", ru)
+
+		tmp, err := ioutil.TempDir("", "archiver_test")
+		if err != nil {
+			t.Fatalf("[%s] %v", auStr, err)
+		}
+		defer os.RemoveAll(tmp)
+
+		outfile := filepath.Join(tmp, "archiver_test."+auStr)
+		err = ru.Archive([]string{"testdata"}, outfile)
+		if err != nil {
+			t.Fatalf("[%s] making archive: didn't expect an error, but got: %v", auStr, err)
+		}
+
+		// extract from a pipe, which can only be read once
+		file, err := os.Open(outfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := io.Copy(pw, file)
+			pw.CloseWithError(err)
+		}()
+		dest := filepath.Join(tmp, "extraction_test_"+auStr)
+		os.Mkdir(dest, 0755)
+		err = ru.UnarchiveReader(pr, dest)
+		pr.Close()
+		file.Close()
+		if err != nil {
+			t.Fatalf("[%s] extracting archive from stream: didn't expect an error, but got: %v", auStr, err)
+		}
+
+		symmetricTest(t, auStr, dest)
+	}
+}
+
+func TestArchiveWriter(t *testing.T) {
+	// the default tar formats share a Tar, so use new ones
+	newTar := func() *Tar { return &Tar{MkdirAll: true} }
+	for _, wa := range []interface {
+		Unarchiver
+		WriterArchiver
+	}{
+		&Zip{MkdirAll: true},
+		newTar(),
+		&TarBz2{Tar: newTar()},
+		&TarGz{Tar: newTar()},
+		&TarLz4{Tar: newTar()},
+		&TarLzma{Tar: newTar()},
+		&TarSz{Tar: newTar()},
+		&TarXz{Tar: newTar()},
+		&TarZst{Tar: newTar()},
+	} {
+		auStr := fmt.Sprintf("%s", wa)
+
+		tmp, err := ioutil.TempDir("", "archiver_test")
+		if err != nil {
+			t.Fatalf("[%s] %v", auStr, err)
+		}
+		defer os.RemoveAll(tmp)
+
+		// write to a buffer, which has no file name
+		buf := new(bytes.Buffer)
+		err = wa.ArchiveWriter([]string{"testdata"}, buf)
+		if err != nil {
+			t.Fatalf("[%s] writing archive to stream: didn't expect an error, but got: %v", auStr, err)
+		}
+		outfile := filepath.Join(tmp, "archiver_test."+auStr)
+		err = ioutil.WriteFile(outfile, buf.Bytes(), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dest := filepath.Join(tmp, "extraction_test_"+auStr)
+		os.Mkdir(dest, 0755)
+		err = wa.Unarchive(outfile, dest)
+		if err != nil {
+			t.Fatalf("[%s] extracting archive [%s -> %s]: didn't expect an error, but got: %v", auStr, outfile, dest, err)
+		}
+
+		symmetricTest(t, auStr, dest)
+	}
+
+	err := (&Tar{ImplicitTopLevelFolder: true}).ArchiveWriter([]string{"testdata"}, ioutil.Discard)
+	if err == nil {
+		t.Error("expected an error making an implicit top-level folder when archiving to a stream")
+	}
+}
+
+func TestWalkSkipDir(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, tc := range []struct {
+		skip     string
+		expected []string
+	}{
+		{
+			// skipping a directory skips what is under it
+			skip: "testdata/proverbs",
+			expected: []string{
+				"testdata",
+				"testdata/already-compressed.jpg",
+				"testdata/proverbs",
+				"testdata/quote1.txt",
+			},
+		},
+		{
+			// skipping a file skips the rest of its directory
+			skip: "testdata/proverbs/proverb1.txt",
+			expected: []string{
+				"testdata",
+				"testdata/already-compressed.jpg",
+				"testdata/proverbs",
+				"testdata/proverbs/extra",
+				"testdata/proverbs/extra/proverb3.txt",
+				"testdata/proverbs/proverb1.txt",
+				"testdata/quote1.txt",
+			},
+		},
+	} {
+		for _, w := range []interface {
+			Archiver
+			Walker
+		}{
+			&Tar{},
+			&Zip{},
+		} {
+			archive := filepath.Join(tmp, "test."+fmt.Sprintf("%s", w))
+			if _, err := os.Stat(archive); os.IsNotExist(err) {
+				err := w.Archive([]string{"testdata"}, archive)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var visited []string
+			err := w.Walk(archive, func(f File) error {
+				name := entryPath(f)
+				visited = append(visited, name)
+				if name == tc.skip {
+					return ErrSkipDir
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("[%s] walking: %v", w, err)
+			}
+			if !reflect.DeepEqual(visited, tc.expected) {
+				t.Errorf("[%s] skipping %s: expected to visit %v, got %v", w, tc.skip, tc.expected, visited)
+			}
+		}
+	}
+}
+
 // testMatching tests that au can match the format of archiveFile.
 func testMatching(t *testing.T, au archiverUnarchiver, archiveFile string) {
 	m, ok := au.(Matcher)
@@ -369,8 +875,10 @@ var archiveFormats = []interface{}{
 	DefaultTarBz2,
 	DefaultTarGz,
 	DefaultTarLz4,
+	DefaultTarLzma,
 	DefaultTarSz,
 	DefaultTarXz,
+	DefaultTarZst,
 }
 
 type archiverUnarchiver interface {
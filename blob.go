@@ -0,0 +1,203 @@
+package archiver
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BlobBucket is a bucket in a blob (object) storage
+// service, such as Amazon S3 or Google Cloud Storage.
+type BlobBucket interface {
+	// PutObject writes an object named key with the
+	// contents read from r, which are size bytes long,
+	// and the given metadata.
+	PutObject(key string, r io.Reader, size int64, metadata map[string]string) error
+
+	// Close releases any resources used by the bucket.
+	Close() error
+}
+
+// BlobOpener opens the bucket identified by a URL.
+type BlobOpener func(bucketURL *url.URL) (BlobBucket, error)
+
+var (
+	blobOpeners   = map[string]BlobOpener{"file": openFileBucket}
+	blobOpenersMu sync.RWMutex
+)
+
+// RegisterBlobScheme registers opener to open buckets with
+// URLs of the given scheme, for example "s3" or "gs". The
+// "file" scheme, which writes objects as files in a local
+// directory, is always available. It panics if the scheme
+// is already registered.
+func RegisterBlobScheme(scheme string, opener BlobOpener) {
+	blobOpenersMu.Lock()
+	defer blobOpenersMu.Unlock()
+	if _, ok := blobOpeners[scheme]; ok {
+		panic("blob scheme already registered: " + scheme)
+	}
+	blobOpeners[scheme] = opener
+}
+
+// OpenBlobBucket opens the bucket at bucketURL using the
+// opener registered for the scheme of the URL.
+func OpenBlobBucket(bucketURL string) (BlobBucket, error) {
+	u, err := url.Parse(bucketURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing bucket URL: %w", err)
+	}
+	blobOpenersMu.RLock()
+	opener, ok := blobOpeners[u.Scheme]
+	blobOpenersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no blob opener registered for scheme %q", u.Scheme)
+	}
+	return opener(u)
+}
+
+// BlobUnarchiver extracts archives into a blob storage
+// bucket instead of the local filesystem. Each regular
+// file becomes an object whose key is the path of the file
+// in the archive, and whose metadata has the file's mode
+// ("mode", in octal) and modification time ("mtime", in
+// RFC 3339 format), as well as its owner ("uid", "gid",
+// "uname" and "gname") if the archive records it. Links
+// become empty objects with the link target in "linkname".
+// Directories are not written, since buckets have none.
+type BlobUnarchiver struct {
+	// The format of the archives to extract,
+	// for example &TarGz{Tar: &Tar{}}.
+	Format Walker
+
+	// A prefix to prepend to every key,
+	// for example "releases/v1/".
+	KeyPrefix string
+
+	// If true, errors encountered while writing a
+	// single object will be logged and the operation
+	// will continue on remaining files.
+	ContinueOnError bool
+
+	// If set, errors skipped because of ContinueOnError
+	// are logged to this logger instead of the logger of
+	// the error log policy.
+	Logger Logger
+}
+
+// UnarchiveToBlob extracts the archive at source into
+// the bucket at bucketURL, which is opened with
+// OpenBlobBucket.
+func (bu *BlobUnarchiver) UnarchiveToBlob(source, bucketURL string) error {
+	if bu.Format == nil {
+		return fmt.Errorf("no format specified")
+	}
+
+	bucket, err := OpenBlobBucket(bucketURL)
+	if err != nil {
+		return err
+	}
+	defer bucket.Close()
+
+	err = bu.Format.Walk(source, func(f File) error {
+		err := bu.putObject(bucket, f)
+		if err != nil && bu.ContinueOnError {
+			logError(bu.Logger, "%v", err)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return bucket.Close()
+}
+
+// putObject writes f to bucket, if it is
+// a regular file or a link.
+func (bu *BlobUnarchiver) putObject(bucket BlobBucket, f File) error {
+	key := bu.KeyPrefix + entryPath(f)
+	metadata := map[string]string{
+		"mode":  strconv.FormatUint(uint64(f.Mode().Perm()), 8),
+		"mtime": f.ModTime().UTC().Format(time.RFC3339),
+	}
+
+	contents, size := io.Reader(f), f.Size()
+	if hdr, ok := f.Header.(*tar.Header); ok {
+		metadata["uid"] = strconv.Itoa(hdr.Uid)
+		metadata["gid"] = strconv.Itoa(hdr.Gid)
+		if hdr.Uname != "" {
+			metadata["uname"] = hdr.Uname
+		}
+		if hdr.Gname != "" {
+			metadata["gname"] = hdr.Gname
+		}
+		if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+			metadata["linkname"] = hdr.Linkname
+			contents, size = eofReader{}, 0
+		}
+	}
+	if _, ok := metadata["linkname"]; !ok && !f.Mode().IsRegular() {
+		return nil
+	}
+
+	err := bucket.PutObject(key, contents, size, metadata)
+	if err != nil {
+		return fmt.Errorf("%s: writing object: %w", key, err)
+	}
+	return nil
+}
+
+// fileBucket is a "bucket" which is a local directory;
+// the mode and modification time of objects are applied
+// to the files, but other metadata is discarded.
+type fileBucket struct {
+	root string
+}
+
+// openFileBucket opens a bucket URL such as
+// "file:///tmp/bucket" as a fileBucket.
+func openFileBucket(u *url.URL) (BlobBucket, error) {
+	root := path.Join(u.Host, u.Path)
+	if runtime.GOOS == "windows" && len(root) > 2 && root[0] == '/' && root[2] == ':' {
+		root = root[1:] // "file:///C:/bucket"
+	}
+	root = filepath.FromSlash(root)
+	err := mkdir(root)
+	if err != nil {
+		return nil, fmt.Errorf("preparing bucket directory: %w", err)
+	}
+	return fileBucket{root: root}, nil
+}
+
+func (fb fileBucket) PutObject(key string, r io.Reader, size int64, metadata map[string]string) error {
+	mode := os.FileMode(0644)
+	if m, err := strconv.ParseUint(metadata["mode"], 8, 32); err == nil {
+		mode = os.FileMode(m)
+	}
+
+	to := filepath.Join(fb.root, filepath.FromSlash(path.Clean("/"+key)))
+	err := writeNewFile(to, r, mode)
+	if err != nil {
+		return err
+	}
+
+	if mtime, err := time.Parse(time.RFC3339, metadata["mtime"]); err == nil {
+		return os.Chtimes(to, mtime, mtime)
+	}
+	return nil
+}
+
+func (fb fileBucket) Close() error { return nil }
+
+// Compile-time checks to ensure type implements desired interfaces.
+var _ = BlobBucket(fileBucket{})
@@ -0,0 +1,103 @@
+package archiver
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestUnarchiveToBlob(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	source := filepath.Join(tmp, "source.tar")
+	err = (&Tar{}).Archive([]string{"testdata"}, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := make(testBucket)
+	RegisterBlobScheme("testmem", func(*url.URL) (BlobBucket, error) {
+		return bucket, nil
+	})
+
+	bu := &BlobUnarchiver{Format: &Tar{}, KeyPrefix: "v1/"}
+	err = bu.UnarchiveToBlob(source, "testmem://bucket")
+	if err != nil {
+		t.Fatalf("unarchiving to blob: %v", err)
+	}
+
+	var expected []string
+	err = (&Tar{}).Walk(source, func(f File) error {
+		if f.Mode().IsRegular() {
+			expected = append(expected, "v1/"+f.Header.(*tar.Header).Name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for key := range bucket {
+		keys = append(keys, key)
+	}
+	sort.Strings(expected)
+	sort.Strings(keys)
+	if fmt.Sprint(keys) != fmt.Sprint(expected) {
+		t.Errorf("expected keys %v but got %v", expected, keys)
+	}
+
+	obj := bucket["v1/testdata/quote1.txt"]
+	original, err := ioutil.ReadFile("testdata/quote1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(obj.contents) != string(original) {
+		t.Errorf("object contents do not match file")
+	}
+	if obj.metadata["mode"] == "" || obj.metadata["mtime"] == "" {
+		t.Errorf("expected mode and mtime metadata, got %v", obj.metadata)
+	}
+
+	// the file scheme writes to a local directory
+	dir := filepath.Join(tmp, "bucket")
+	err = bu.UnarchiveToBlob(source, "file:///"+strings.TrimPrefix(filepath.ToSlash(dir), "/"))
+	if err != nil {
+		t.Fatalf("unarchiving to file bucket: %v", err)
+	}
+	if !fileExists(filepath.Join(dir, "v1", "testdata", "quote1.txt")) {
+		t.Errorf("expected object to be written to bucket directory")
+	}
+}
+
+type testObject struct {
+	contents []byte
+	metadata map[string]string
+}
+
+// testBucket is an in-memory BlobBucket.
+type testBucket map[string]testObject
+
+func (tb testBucket) PutObject(key string, r io.Reader, size int64, metadata map[string]string) error {
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if int64(len(contents)) != size {
+		return fmt.Errorf("%s: expected %d bytes but read %d", key, size, len(contents))
+	}
+	tb[key] = testObject{contents: contents, metadata: metadata}
+	return nil
+}
+
+func (tb testBucket) Close() error { return nil }
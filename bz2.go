@@ -1,7 +1,6 @@
 package archiver
 
 import (
-	"fmt"
 	"io"
 	"path/filepath"
 
@@ -40,7 +39,7 @@ func (bz *Bz2) Decompress(in io.Reader, out io.Writer) error {
 // CheckExt ensures the file extension matches the format.
 func (bz *Bz2) CheckExt(filename string) error {
 	if filepath.Ext(filename) != ".bz2" {
-		return fmt.Errorf("filename must have a .bz2 extension")
+		return pathErrorf(ErrFormatMismatch, filename, "filename must have a .bz2 extension")
 	}
 	return nil
 }
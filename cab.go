@@ -0,0 +1,633 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cab provides facilities for reading Microsoft cabinet
+// (.cab) files. Folders which are stored uncompressed or
+// compressed with MSZIP can be read; Quantum and LZX
+// compression, as well as files spanning multiple
+// cabinets, are not supported.
+// See https://docs.microsoft.com/en-us/previous-versions/bb417343(v=msdn.10).
+type Cab struct {
+	// Whether to overwrite existing files; if false,
+	// an error is returned if the file exists.
+	OverwriteExisting bool
+
+	// Whether to extract entries whose paths go outside
+	// of the destination, such as "../../etc/cron.d/x";
+	// if false, an error which is ErrIllegalPath is
+	// returned for them. Only set this for trusted
+	// archives.
+	AllowPathTraversal bool
+
+	// What to do with entries whose paths are absolute,
+	// such as "/etc/passwd"; the zero value,
+	// AbsolutePathStrip, extracts them inside of the
+	// destination with a warning.
+	AbsolutePathPolicy AbsolutePathPolicy
+
+	// The most bytes of contents of any one file to
+	// extract; 0 means no limit. Since contents are
+	// counted as they are decompressed, files which
+	// decompress to much more than they say cannot fill
+	// the disk; extracting them fails with an error which
+	// is ErrLimitExceeded instead.
+	MaxEntrySize int64
+
+	// The most bytes of contents of all files to extract
+	// in one operation, counted like for MaxEntrySize;
+	// 0 means no limit.
+	MaxTotalSize int64
+
+	// Whether to make all the directories necessary
+	// to extract the cabinet in the desired path.
+	MkdirAll bool
+
+	// If true, errors encountered during reading
+	// a single file will be logged and the
+	// operation will continue on remaining files.
+	ContinueOnError bool
+
+	// If set, errors skipped because of ContinueOnError
+	// are logged to this logger instead of the logger of
+	// the error log policy.
+	Logger Logger
+}
+
+// Unarchive unpacks the .cab file at source to destination.
+// Destination will be treated as a folder name.
+func (c *Cab) Unarchive(source, destination string) error {
+	if !fileExists(destination) && c.MkdirAll {
+		err := mkdir(destination)
+		if err != nil {
+			return fmt.Errorf("preparing destination: %w", err)
+		}
+	}
+
+	var extracted int64 // for MaxTotalSize
+	return c.Walk(source, func(f File) error {
+		to, err := extractPath(destination, f.Header.(*CabHeader).Name, c.AllowPathTraversal, c.AbsolutePathPolicy, c.Logger)
+		if err != nil {
+			return err
+		}
+		return c.extractFile(f, to, &extracted)
+	})
+}
+
+// extractFile extracts f to the file to, adding
+// the bytes of contents extracted to extracted.
+func (c *Cab) extractFile(f File, to string, extracted *int64) error {
+	// do not overwrite existing files, if configured
+	if !c.OverwriteExisting && fileExists(to) {
+		return &PathError{Path: to, Err: ErrDestinationExists}
+	}
+	hdr, ok := f.Header.(*CabHeader)
+	if !ok {
+		return fmt.Errorf("expected header to be *CabHeader but was %T", f.Header)
+	}
+	limits := c.limits(extracted)
+	err := limits.check(hdr.Name, hdr.Size)
+	if err != nil {
+		return err
+	}
+	return writeNewFile(to, limits.reader(hdr.Name, f), f.Mode())
+}
+
+// limits returns the limits on the files being
+// extracted, of which extracted bytes are so far.
+func (c *Cab) limits(extracted *int64) extractLimits {
+	return extractLimits{
+		maxEntry: c.MaxEntrySize,
+		maxTotal: c.MaxTotalSize,
+		total:    extracted,
+	}
+}
+
+// Walk calls walkFn for each file in the cabinet. Files
+// are visited in the order their contents are stored.
+func (c *Cab) Walk(archive string, walkFn WalkFunc) error {
+	walkFn = skipDirs(walkFn)
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("opening archive file: %w", err)
+	}
+	defer file.Close()
+
+	cab, err := readCabDirectory(file)
+	if err != nil {
+		return fmt.Errorf("reading cabinet directory: %w", err)
+	}
+
+	// group the files by the folder containing their data
+	filesByFolder := make([][]*CabHeader, len(cab.folders))
+	for _, hdr := range cab.files {
+		if hdr.Folder >= len(cab.folders) {
+			err := fmt.Errorf("%s: spanned cabinets are not supported", hdr.Name)
+			if c.ContinueOnError {
+				logError(c.Logger, "%v", err)
+				continue
+			}
+			return err
+		}
+		filesByFolder[hdr.Folder] = append(filesByFolder[hdr.Folder], hdr)
+	}
+
+	for i, folder := range cab.folders {
+		err := c.walkFolder(file, cab, folder, filesByFolder[i], walkFn)
+		if err == ErrStopWalk {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading folder %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (c *Cab) List(archive string) ([]EntryInfo, error) {
+	return listWalk(c, archive)
+}
+
+// Validate checks the integrity of archive by
+// reading the contents of every entry.
+func (c *Cab) Validate(archive string) error {
+	return validateWalk(c, archive)
+}
+
+// walkFolder calls walkFn for each of the files whose
+// contents are in folder.
+func (c *Cab) walkFolder(file io.ReaderAt, cab *cabDirectory, folder cabFolder, files []*CabHeader, walkFn WalkFunc) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	if folder.compression != cabCompressNone && folder.compression != cabCompressMSZIP {
+		err := fmt.Errorf("unsupported compression type %d", folder.compression)
+		if !c.ContinueOnError {
+			return err
+		}
+		for _, hdr := range files {
+			logError(c.Logger, "Reading %s: %v", hdr.Name, err)
+		}
+		return nil
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].offset < files[j].offset
+	})
+
+	fr := &cabFolderReader{
+		r:          bufio.NewReader(io.NewSectionReader(file, folder.dataOffset, 1<<63-1-folder.dataOffset)),
+		mszip:      folder.compression == cabCompressMSZIP,
+		blocksLeft: folder.blocks,
+		reserved:   cab.dataReserved,
+	}
+
+	var pos int64
+	for _, hdr := range files {
+		if hdr.offset < pos {
+			return fmt.Errorf("%s: contents overlap those of the previous file", hdr.Name)
+		}
+		_, err := io.CopyN(ioutil.Discard, fr, hdr.offset-pos)
+		if err != nil {
+			return fmt.Errorf("seeking to %s: %w", hdr.Name, err)
+		}
+
+		contents := io.LimitReader(fr, hdr.Size)
+		err = walkFn(File{
+			FileInfo:   cabFileInfo{hdr},
+			Header:     hdr,
+			ReadCloser: ReadFakeCloser{contents},
+		})
+		if err != nil {
+			if err == ErrStopWalk {
+				return err
+			}
+			if !c.ContinueOnError {
+				return fmt.Errorf("walking %s: %w", hdr.Name, err)
+			}
+			logError(c.Logger, "Walking %s: %v", hdr.Name, err)
+		}
+
+		// skip whatever walkFn did not read
+		_, err = io.Copy(ioutil.Discard, contents)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		pos = hdr.offset + hdr.Size
+	}
+
+	return nil
+}
+
+// Extract extracts a single file from the cabinet. If the
+// target is a directory, all the files within it will be
+// extracted into destination.
+func (c *Cab) Extract(source, target, destination string) error {
+	// target refers to a path inside the archive, which should be clean also
+	target = path.Clean(target)
+
+	var found bool
+	var extracted int64 // for MaxTotalSize
+	err := c.Walk(source, func(f File) error {
+		name := f.Header.(*CabHeader).Name
+		if !within(target, name) {
+			return nil
+		}
+		found = true
+
+		// build the filename we will extract to
+		end, err := filepath.Rel(path.Dir(target), name)
+		if err != nil {
+			return fmt.Errorf("relativizing paths: %w", err)
+		}
+		joined, err := extractPath(destination, filepath.ToSlash(end), c.AllowPathTraversal, c.AbsolutePathPolicy, c.Logger)
+		if err != nil {
+			return err
+		}
+
+		err = c.extractFile(f, joined, &extracted)
+		if err != nil {
+			return fmt.Errorf("extracting file %s: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s: not found in archive", target)
+	}
+	return nil
+}
+
+// Match returns true if the format of file matches this
+// type's format. It should not affect reader position.
+func (*Cab) Match(file *os.File) (bool, error) {
+	currentPos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		return false, err
+	}
+	defer file.Seek(currentPos, io.SeekStart)
+
+	buf := make([]byte, len(cabMagic))
+	if _, err := io.ReadFull(file, buf); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(buf, []byte(cabMagic)), nil
+}
+
+func (c *Cab) String() string { return "cab" }
+
+// CabHeader describes a file in a cabinet.
+type CabHeader struct {
+	Name       string // slash-separated path of the file
+	Size       int64
+	ModTime    time.Time
+	Attributes uint16 // DOS attributes, plus 0x40 if executable
+	Folder     int    // index of the folder with the contents
+
+	offset int64 // offset of the contents within the folder
+}
+
+// cabDirectory is the parsed list of folders
+// and files at the start of a cabinet.
+type cabDirectory struct {
+	folders      []cabFolder
+	files        []*CabHeader
+	dataReserved int // size of the reserved area in each data block
+}
+
+type cabFolder struct {
+	dataOffset  int64 // offset of the first data block
+	blocks      int
+	compression uint16
+}
+
+// readCabDirectory reads the header of the cabinet
+// in r, along with its folder and file entries.
+func readCabDirectory(r io.ReaderAt) (*cabDirectory, error) {
+	br := bufio.NewReader(io.NewSectionReader(r, 0, 1<<63-1))
+
+	var hdr struct {
+		Signature    [4]byte
+		_            uint32
+		CabinetSize  uint32
+		_            uint32
+		FilesOffset  uint32
+		_            uint32
+		VersionMinor uint8
+		VersionMajor uint8
+		Folders      uint16
+		Files        uint16
+		Flags        uint16
+		SetID        uint16
+		Index        uint16
+	}
+	err := binary.Read(br, binary.LittleEndian, &hdr)
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if string(hdr.Signature[:]) != cabMagic[:4] {
+		return nil, fmt.Errorf("invalid cabinet signature: %q", hdr.Signature)
+	}
+
+	cab := new(cabDirectory)
+	var folderReserved int
+	if hdr.Flags&cabFlagReservePresent != 0 {
+		var reserve struct {
+			Header uint16
+			Folder uint8
+			Data   uint8
+		}
+		err := binary.Read(br, binary.LittleEndian, &reserve)
+		if err != nil {
+			return nil, fmt.Errorf("reading reserved sizes: %w", err)
+		}
+		folderReserved = int(reserve.Folder)
+		cab.dataReserved = int(reserve.Data)
+		_, err = br.Discard(int(reserve.Header))
+		if err != nil {
+			return nil, fmt.Errorf("skipping reserved area: %w", err)
+		}
+	}
+
+	// skip the names of the previous and next cabinets and disks
+	var names int
+	if hdr.Flags&cabFlagPrevCabinet != 0 {
+		names += 2
+	}
+	if hdr.Flags&cabFlagNextCabinet != 0 {
+		names += 2
+	}
+	for i := 0; i < names; i++ {
+		_, err := br.ReadBytes(0)
+		if err != nil {
+			return nil, fmt.Errorf("reading cabinet set names: %w", err)
+		}
+	}
+
+	for i := 0; i < int(hdr.Folders); i++ {
+		var entry struct {
+			DataOffset  uint32
+			Blocks      uint16
+			Compression uint16
+		}
+		err := binary.Read(br, binary.LittleEndian, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("reading folder entry: %w", err)
+		}
+		_, err = br.Discard(folderReserved)
+		if err != nil {
+			return nil, fmt.Errorf("reading folder entry: %w", err)
+		}
+		cab.folders = append(cab.folders, cabFolder{
+			dataOffset:  int64(entry.DataOffset),
+			blocks:      int(entry.Blocks),
+			compression: entry.Compression & cabCompressMask,
+		})
+	}
+
+	br = bufio.NewReader(io.NewSectionReader(r, int64(hdr.FilesOffset), 1<<63-1-int64(hdr.FilesOffset)))
+	for i := 0; i < int(hdr.Files); i++ {
+		var entry struct {
+			Size       uint32
+			Offset     uint32
+			Folder     uint16
+			Date       uint16
+			Time       uint16
+			Attributes uint16
+		}
+		err := binary.Read(br, binary.LittleEndian, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("reading file entry: %w", err)
+		}
+		name, err := br.ReadString(0)
+		if err != nil {
+			return nil, fmt.Errorf("reading file name: %w", err)
+		}
+		name = strings.Replace(strings.TrimSuffix(name, "\x00"), `\`, "/", -1)
+
+		cab.files = append(cab.files, &CabHeader{
+			Name:       path.Clean(strings.TrimPrefix(name, "/")),
+			Size:       int64(entry.Size),
+			ModTime:    dosDateTime(entry.Date, entry.Time),
+			Attributes: entry.Attributes,
+			Folder:     int(entry.Folder),
+			offset:     int64(entry.Offset),
+		})
+	}
+
+	return cab, nil
+}
+
+// cabFolderReader reads the uncompressed
+// contents of a folder, block by block.
+type cabFolderReader struct {
+	r          *bufio.Reader
+	mszip      bool
+	blocksLeft int
+	reserved   int
+
+	buf     []byte // remaining contents of the current block
+	history []byte // last uncompressed bytes, for MSZIP
+	fr      io.ReadCloser
+}
+
+func (cfr *cabFolderReader) Read(p []byte) (int, error) {
+	for len(cfr.buf) == 0 {
+		if cfr.blocksLeft == 0 {
+			return 0, io.EOF
+		}
+		err := cfr.nextBlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, cfr.buf)
+	cfr.buf = cfr.buf[n:]
+	return n, nil
+}
+
+// nextBlock reads and decompresses the next data block.
+func (cfr *cabFolderReader) nextBlock() error {
+	var hdr struct {
+		Checksum         uint32
+		CompressedSize   uint16
+		UncompressedSize uint16
+	}
+	err := binary.Read(cfr.r, binary.LittleEndian, &hdr)
+	if err != nil {
+		return fmt.Errorf("reading data block header: %w", noEOF(err))
+	}
+	_, err = cfr.r.Discard(cfr.reserved)
+	if err != nil {
+		return fmt.Errorf("reading data block header: %w", noEOF(err))
+	}
+	data := make([]byte, hdr.CompressedSize)
+	_, err = io.ReadFull(cfr.r, data)
+	if err != nil {
+		return fmt.Errorf("reading data block: %w", noEOF(err))
+	}
+	cfr.blocksLeft--
+
+	if hdr.Checksum != 0 {
+		sizes := make([]byte, 4)
+		binary.LittleEndian.PutUint16(sizes, hdr.CompressedSize)
+		binary.LittleEndian.PutUint16(sizes[2:], hdr.UncompressedSize)
+		if sum := cabChecksum(sizes, cabChecksum(data, 0)); sum != hdr.Checksum {
+			return fmt.Errorf("data block checksum mismatch: expected %08x, got %08x", hdr.Checksum, sum)
+		}
+	}
+	if hdr.UncompressedSize == 0 {
+		return fmt.Errorf("spanned cabinets are not supported")
+	}
+
+	if !cfr.mszip {
+		cfr.buf = data
+		return nil
+	}
+
+	// each MSZIP block is a deflate stream preceded by
+	// a signature, which uses the uncompressed contents
+	// of the previous blocks as its dictionary
+	if len(data) < 2 || data[0] != 'C' || data[1] != 'K' {
+		return fmt.Errorf("invalid MSZIP block signature")
+	}
+	if cfr.fr == nil {
+		cfr.fr = flate.NewReaderDict(bytes.NewReader(data[2:]), cfr.history)
+	} else {
+		err = cfr.fr.(flate.Resetter).Reset(bytes.NewReader(data[2:]), cfr.history)
+		if err != nil {
+			return err
+		}
+	}
+	out := make([]byte, hdr.UncompressedSize)
+	_, err = io.ReadFull(cfr.fr, out)
+	if err != nil {
+		return fmt.Errorf("decompressing MSZIP block: %w", noEOF(err))
+	}
+	cfr.buf = out
+
+	cfr.history = append(cfr.history, out...)
+	if len(cfr.history) > cabMSZIPWindow {
+		cfr.history = cfr.history[len(cfr.history)-cabMSZIPWindow:]
+	}
+
+	return nil
+}
+
+// cabChecksum computes the checksum of a data
+// block, starting from seed.
+func cabChecksum(data []byte, seed uint32) uint32 {
+	sum := seed
+	for len(data) >= 4 {
+		sum ^= binary.LittleEndian.Uint32(data)
+		data = data[4:]
+	}
+	var tail uint32
+	for _, b := range data {
+		tail = tail<<8 | uint32(b)
+	}
+	return sum ^ tail
+}
+
+// dosDateTime converts an MS-DOS date and time
+// (in local time) to a time.Time.
+func dosDateTime(dosDate, dosTime uint16) time.Time {
+	return time.Date(
+		int(dosDate>>9)+1980,
+		time.Month(dosDate>>5&0xf),
+		int(dosDate&0x1f),
+		int(dosTime>>11),
+		int(dosTime>>5&0x3f),
+		int(dosTime&0x1f)*2,
+		0,
+		time.Local,
+	)
+}
+
+// noEOF returns io.ErrUnexpectedEOF in place of io.EOF,
+// for when the end of input is reached prematurely.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+type cabFileInfo struct {
+	hdr *CabHeader
+}
+
+func (cfi cabFileInfo) Name() string       { return path.Base(cfi.hdr.Name) }
+func (cfi cabFileInfo) Size() int64        { return cfi.hdr.Size }
+func (cfi cabFileInfo) ModTime() time.Time { return cfi.hdr.ModTime }
+func (cfi cabFileInfo) IsDir() bool        { return false }
+func (cfi cabFileInfo) Sys() interface{}   { return cfi.hdr }
+
+func (cfi cabFileInfo) Mode() os.FileMode {
+	switch {
+	case cfi.hdr.Attributes&cabAttribExecute != 0:
+		return 0755
+	case cfi.hdr.Attributes&cabAttribReadOnly != 0:
+		return 0444
+	default:
+		return 0644
+	}
+}
+
+const (
+	cabMagic = "MSCF\x00\x00\x00\x00"
+
+	cabFlagPrevCabinet    = 0x0001
+	cabFlagNextCabinet    = 0x0002
+	cabFlagReservePresent = 0x0004
+
+	cabCompressMask  = 0x000f
+	cabCompressNone  = 0
+	cabCompressMSZIP = 1
+
+	cabAttribReadOnly = 0x01
+	cabAttribExecute  = 0x40
+
+	cabMSZIPWindow = 32 * 1024
+)
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = Unarchiver(new(Cab))
+	_ = Walker(new(Cab))
+	_ = Lister(new(Cab))
+	_ = Validator(new(Cab))
+	_ = Extractor(new(Cab))
+	_ = Matcher(new(Cab))
+	_ = os.FileInfo(cabFileInfo{})
+)
+
+// DefaultCab is a convenient archiver ready to use.
+var DefaultCab = &Cab{
+	MkdirAll: true,
+}
@@ -0,0 +1,251 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCabUnarchive(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// big enough to span multiple MSZIP blocks
+	big := strings.Repeat("driver data ", 8000)
+
+	source := filepath.Join(tmp, "driver.cab")
+	err = ioutil.WriteFile(source, makeTestCab(t, []testCabFolder{
+		{mszip: true, files: []testCabFile{
+			{name: "setup.inf", body: "[Version]\r\n"},
+			{name: `x64\driver.sys`, body: big},
+		}},
+		{files: []testCabFile{
+			{name: "readme.txt", body: "hello cab"},
+		}},
+	}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	err = DefaultCab.Walk(source, func(f File) error {
+		names = append(names, f.Header.(*CabHeader).Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking cab: %v", err)
+	}
+	if strings.Join(names, ",") != "setup.inf,x64/driver.sys,readme.txt" {
+		t.Errorf("unexpected entries: %v", names)
+	}
+
+	dest := filepath.Join(tmp, "out")
+	err = DefaultCab.Unarchive(source, dest)
+	if err != nil {
+		t.Fatalf("unarchiving cab: %v", err)
+	}
+	for name, expected := range map[string]string{
+		"setup.inf":                        "[Version]\r\n",
+		filepath.Join("x64", "driver.sys"): big,
+		"readme.txt":                       "hello cab",
+	} {
+		contents, err := ioutil.ReadFile(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatalf("reading extracted file: %v", err)
+		}
+		if string(contents) != expected {
+			t.Errorf("%s: unexpected contents (%d bytes)", name, len(contents))
+		}
+	}
+
+	dest = filepath.Join(tmp, "single")
+	err = DefaultCab.Extract(source, "x64/driver.sys", dest)
+	if err != nil {
+		t.Fatalf("extracting file: %v", err)
+	}
+	if !fileExists(filepath.Join(dest, "driver.sys")) {
+		t.Errorf("extracted file does not exist")
+	}
+}
+
+func TestCabLimits(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	source := filepath.Join(tmp, "test.cab")
+	err = ioutil.WriteFile(source, makeTestCab(t, []testCabFolder{
+		{mszip: true, files: []testCabFile{
+			{name: "a.txt", body: strings.Repeat("a", 600)},
+			{name: "b.txt", body: strings.Repeat("b", 600)},
+		}},
+	}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range []struct {
+		maxEntry, maxTotal int64
+		expectErr          bool
+	}{
+		{},
+		{maxEntry: 500, expectErr: true},
+		{maxEntry: 1000},
+		{maxTotal: 1000, expectErr: true},
+		{maxTotal: 1200},
+	} {
+		c := &Cab{MkdirAll: true, MaxEntrySize: tc.maxEntry, MaxTotalSize: tc.maxTotal}
+		err := c.Unarchive(source, filepath.Join(tmp, fmt.Sprint(i)))
+		if tc.expectErr && !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("Test %d: expected error for exceeded limit, got %v", i, err)
+		}
+		if !tc.expectErr && err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+func TestCabExtractTraversal(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	source := filepath.Join(tmp, "test.cab")
+	err = ioutil.WriteFile(source, makeTestCab(t, []testCabFolder{
+		{files: []testCabFile{{name: `..\..\escaped.txt`, body: "escaped"}}},
+	}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the entry is one level above the folder of the target
+	dest := filepath.Join(tmp, "a", "dest")
+	err = (&Cab{MkdirAll: true}).Extract(source, "../..", dest)
+	if !errors.Is(err, ErrIllegalPath) {
+		t.Errorf("expected error for path outside of destination, got %v", err)
+	}
+	if fileExists(filepath.Join(tmp, "a", "escaped.txt")) {
+		t.Error("expected file not to be extracted outside of destination")
+	}
+}
+
+type testCabFolder struct {
+	mszip bool
+	files []testCabFile
+}
+
+type testCabFile struct {
+	name, body string
+}
+
+// makeTestCab builds a cabinet containing the given
+// folders, whose data blocks are checksummed.
+func makeTestCab(t *testing.T, folders []testCabFolder) []byte {
+	var numFiles int
+	for _, folder := range folders {
+		numFiles += len(folder.files)
+	}
+
+	// encode the data blocks of each folder
+	var blocks [][]byte
+	var numBlocks []int
+	for _, folder := range folders {
+		var contents []byte
+		for _, f := range folder.files {
+			contents = append(contents, f.body...)
+		}
+		var history []byte
+		var n int
+		for len(contents) > 0 {
+			chunk := contents
+			if len(chunk) > cabMSZIPWindow {
+				chunk = chunk[:cabMSZIPWindow]
+			}
+			contents = contents[len(chunk):]
+
+			data := chunk
+			if folder.mszip {
+				buf := bytes.NewBufferString("CK")
+				fw, err := flate.NewWriterDict(buf, flate.DefaultCompression, history)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fw.Write(chunk)
+				fw.Close()
+				data = buf.Bytes()
+				history = chunk
+			}
+
+			block := new(bytes.Buffer)
+			sizes := make([]byte, 4)
+			binary.LittleEndian.PutUint16(sizes, uint16(len(data)))
+			binary.LittleEndian.PutUint16(sizes[2:], uint16(len(chunk)))
+			binary.Write(block, binary.LittleEndian, cabChecksum(sizes, cabChecksum(data, 0)))
+			block.Write(sizes)
+			block.Write(data)
+			blocks = append(blocks, block.Bytes())
+			n++
+		}
+		numBlocks = append(numBlocks, n)
+	}
+
+	// file entries
+	entries := new(bytes.Buffer)
+	for i, folder := range folders {
+		var offset int
+		for _, f := range folder.files {
+			binary.Write(entries, binary.LittleEndian, uint32(len(f.body)))
+			binary.Write(entries, binary.LittleEndian, uint32(offset))
+			binary.Write(entries, binary.LittleEndian, uint16(i))
+			binary.Write(entries, binary.LittleEndian, uint16(49<<9|1<<5|2)) // 2029-01-02
+			binary.Write(entries, binary.LittleEndian, uint16(12<<11))       // 12:00:00
+			binary.Write(entries, binary.LittleEndian, uint16(0x20))
+			entries.WriteString(f.name + "\x00")
+			offset += len(f.body)
+		}
+	}
+
+	filesOffset := 36 + 8*len(folders)
+	dataOffset := filesOffset + entries.Len()
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(cabMagic)
+	binary.Write(buf, binary.LittleEndian, []uint32{0, 0, uint32(filesOffset), 0})
+	buf.Write([]byte{3, 1})
+	binary.Write(buf, binary.LittleEndian, []uint16{uint16(len(folders)), uint16(numFiles), 0, 0, 0})
+
+	var block int
+	for i, folder := range folders {
+		var compression uint16
+		if folder.mszip {
+			compression = cabCompressMSZIP
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(dataOffset))
+		binary.Write(buf, binary.LittleEndian, uint16(numBlocks[i]))
+		binary.Write(buf, binary.LittleEndian, compression)
+		for j := 0; j < numBlocks[i]; j++ {
+			dataOffset += len(blocks[block+j])
+		}
+		block += numBlocks[i]
+	}
+	buf.Write(entries.Bytes())
+	for _, b := range blocks {
+		buf.Write(b)
+	}
+
+	return buf.Bytes()
+}
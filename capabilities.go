@@ -0,0 +1,127 @@
+package archiver
+
+import "archive/tar"
+
+// FormatCapabilities describes what can be stored in
+// archives of a format, as supported by this package.
+// Information which a format cannot store is silently
+// dropped when archiving files in that format.
+type FormatCapabilities struct {
+	Read  bool // archives can be read
+	Write bool // archives can be created
+
+	Symlinks     bool // symbolic links
+	HardLinks    bool // hard links
+	Ownership    bool // owner user and group of files
+	Xattrs       bool // extended attributes
+	Encryption   bool // encrypted contents
+	LargeFiles   bool // files of 4 GiB or more
+	UnicodeNames bool // file names which are not ASCII
+}
+
+// Capabilities returns the capabilities of format, which
+// must be one of the archive types of this package, such
+// as *Zip or *TarGz. For tar formats, the capabilities
+// depend on the header format that is chosen.
+func Capabilities(format interface{}) (FormatCapabilities, error) {
+	switch f := format.(type) {
+	case *Tar:
+		return tarCapabilities(f), nil
+	case *TarBz2:
+		return tarCapabilities(f.Tar), nil
+	case *TarGz:
+		return tarCapabilities(f.Tar), nil
+	case *TarLz4:
+		return tarCapabilities(f.Tar), nil
+	case *TarLzma:
+		return tarCapabilities(f.Tar), nil
+	case *TarSz:
+		return tarCapabilities(f.Tar), nil
+	case *TarXz:
+		return tarCapabilities(f.Tar), nil
+	case *TarZst:
+		return tarCapabilities(f.Tar), nil
+	case *TarEncrypted:
+		caps := tarCapabilities(f.Tar)
+		caps.Encryption = true
+		return caps, nil
+	case *Zip:
+		return FormatCapabilities{
+			Read:         true,
+			Write:        true,
+			Symlinks:     true,
+			Encryption:   true,
+			LargeFiles:   true,
+			UnicodeNames: true,
+		}, nil
+	case *Rar:
+		return FormatCapabilities{
+			Read:         true,
+			Symlinks:     true,
+			Encryption:   true,
+			LargeFiles:   true,
+			UnicodeNames: true,
+		}, nil
+	case *Deb:
+		caps := tarCapabilities(nil)
+		caps.Write = false
+		return caps, nil
+	case *Rpm:
+		// cpio (newc) sizes are 32 bits
+		return FormatCapabilities{
+			Read:         true,
+			Symlinks:     true,
+			HardLinks:    true,
+			Ownership:    true,
+			UnicodeNames: true,
+		}, nil
+	case *Cab:
+		// sizes are 32 bits
+		return FormatCapabilities{
+			Read:         true,
+			UnicodeNames: true,
+		}, nil
+	case *Warc:
+		return FormatCapabilities{
+			Read:         true,
+			LargeFiles:   true,
+			UnicodeNames: true,
+		}, nil
+	case *Wim:
+		return FormatCapabilities{
+			Read:         true,
+			LargeFiles:   true,
+			UnicodeNames: true,
+		}, nil
+	default:
+		return FormatCapabilities{}, pathErrorf(ErrUnsupportedType, "", "unknown archive format: %T", format)
+	}
+}
+
+// tarCapabilities returns the capabilities
+// of t, which may be nil for the defaults.
+func tarCapabilities(t *Tar) FormatCapabilities {
+	caps := FormatCapabilities{
+		Read:         true,
+		Write:        true,
+		Symlinks:     true,
+		HardLinks:    true,
+		Ownership:    true,
+		Xattrs:       true,
+		LargeFiles:   true,
+		UnicodeNames: true,
+	}
+	if t == nil {
+		return caps
+	}
+	switch t.Format {
+	case tar.FormatUSTAR:
+		// sizes are limited to 8 GiB, and
+		// names to 256 ASCII characters
+		caps.Xattrs = false
+		caps.UnicodeNames = false
+	case tar.FormatGNU:
+		caps.Xattrs = false
+	}
+	return caps
+}
@@ -0,0 +1,51 @@
+package archiver
+
+import (
+	"archive/tar"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+	for i, tc := range []struct {
+		format    interface{}
+		expect    FormatCapabilities
+		shouldErr bool
+	}{
+		{
+			format: &TarGz{Tar: &Tar{}},
+			expect: FormatCapabilities{Read: true, Write: true, Symlinks: true, HardLinks: true,
+				Ownership: true, Xattrs: true, LargeFiles: true, UnicodeNames: true},
+		},
+		{
+			format: &Tar{Format: tar.FormatUSTAR},
+			expect: FormatCapabilities{Read: true, Write: true, Symlinks: true, HardLinks: true,
+				Ownership: true, LargeFiles: true},
+		},
+		{
+			format: DefaultZip,
+			expect: FormatCapabilities{Read: true, Write: true, Symlinks: true, Encryption: true, LargeFiles: true, UnicodeNames: true},
+		},
+		{
+			format: DefaultCab,
+			expect: FormatCapabilities{Read: true, UnicodeNames: true},
+		},
+		{
+			format:    &Gz{},
+			shouldErr: true,
+		},
+	} {
+		actual, err := Capabilities(tc.format)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		if actual != tc.expect {
+			t.Errorf("Test %d: expected %+v but got %+v", i, tc.expect, actual)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package archiver
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time. It is used wherever the current
+// time matters, such as for the modification times of
+// virtual entries and for time limits, so that tests
+// can control the passing of time instead of sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock of the system.
+type SystemClock struct{}
+
+// Now returns time.Now().
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// FakeClock is a Clock whose time only passes when it
+// is told to, for use in tests. It is safe for
+// concurrent use.
+type FakeClock struct {
+	// If not zero, the clock advances by this much
+	// every time Now is called, which simulates work
+	// taking time. It must be set before the clock
+	// is used.
+	Step time.Duration
+
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the time of the clock, and
+// then advances the clock by c.Step.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.Step)
+	return now
+}
+
+// Set sets the time of the clock to now.
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	c.now = now
+	c.mu.Unlock()
+}
+
+// Advance advances the time of the clock by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// clockOrSystem returns c, or the
+// system clock if c is nil.
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock{}
+	}
+	return c
+}
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = Clock(SystemClock{})
+	_ = Clock((*FakeClock)(nil))
+)
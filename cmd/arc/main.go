@@ -3,12 +3,14 @@ package main
 import (
 	"archive/tar"
 	"archive/zip"
+	"bufio"
 	"bytes"
 	"compress/flate"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/mholt/archiver"
@@ -18,19 +20,79 @@ import (
 var (
 	compressionLevel       int
 	overwriteExisting      bool
+	existing               string
+	symlinks               string
+	absolute               string
+	special                string
+	sanitize               string
+	uidMap                 string
+	gidMap                 string
+	preserveOwner          bool
+	numericOwner           bool
+	chown                  string
+	maxEntrySize           int64
+	maxTotalSize           int64
+	checkDiskSpace         bool
 	mkdirAll               bool
 	selectiveCompression   bool
 	implicitTopLevelFolder bool
 	continueOnError        bool
+	maxErrorsLogged        int
+	strictMetadata         bool
+	sortByDirectory        bool
+	prepassWorkers         int
+	padTo                  int
+	omitTrailer            bool
+	onError                string
+	showProgress           bool
+	exclude                string
+	ignoreFileName         string
+	followSymlinks         bool
+	signKey                string
+	verifyKey              string
+	recursiveDepth         int
+	touch                  bool
+	xattrs                 bool
+	sparse                 bool
 )
 
 func init() {
 	flag.IntVar(&compressionLevel, "level", flate.DefaultCompression, "Compression level")
 	flag.BoolVar(&overwriteExisting, "overwrite", false, "Overwrite existing files")
+	flag.StringVar(&existing, "existing", "", "What to do when a file being extracted exists: error, skip, overwrite, older or rename (zip and tar only; default per -overwrite)")
+	flag.StringVar(&symlinks, "symlinks", "", "What to do with symbolic links which point outside of the destination: reject, skip, reroot or allow (tar, deb and rpm only; default reject, or reroot for packages)")
+	flag.StringVar(&absolute, "absolute", "", "What to do with absolute paths of files being extracted: strip or reject (default strip)")
+	flag.StringVar(&special, "special", "", "What to do with devices and named pipes being extracted: skip, error or create (tar and deb only; default skip)")
+	flag.StringVar(&sanitize, "sanitize", "", "Comma-separated sanitizations of the names of files being extracted: control (strip control characters), reserved (reject names Windows reserves), unicode (normalize to NFC) or all (zip and tar only)")
+	flag.StringVar(&uidMap, "uidmap", "", "Restore the owners of files being extracted, with user IDs mapped by ranges of archive ID:host ID:size, such as 0:100000:65536 (tar only)")
+	flag.StringVar(&gidMap, "gidmap", "", "Restore the groups of files being extracted, with group IDs mapped like -uidmap (tar only)")
+	flag.BoolVar(&preserveOwner, "preserve-owner", false, "Restore the owners of files being extracted, as tar does as root (tar only)")
+	flag.BoolVar(&numericOwner, "numeric-owner", false, "With -preserve-owner, use the user and group IDs in the archive instead of looking up their names (tar only)")
+	flag.StringVar(&chown, "chown", "", "Give files being extracted this owner, as uid:gid, whatever their owners in the archive (tar only)")
+	flag.Int64Var(&maxEntrySize, "max-file-size", 0, "Fail when a file being extracted is larger than this many bytes (0 for no limit)")
+	flag.BoolVar(&checkDiskSpace, "check-space", false, "Fail before the disk fills up when there is not space for the files being extracted (zip and tar only)")
+	flag.Int64Var(&maxTotalSize, "max-total-size", 0, "Fail when the files being extracted are larger than this many bytes in total (0 for no limit)")
+	flag.IntVar(&recursiveDepth, "recursive", 0, "Also extract the archives within archives being extracted, in place, up to this many levels deep (0 to not)")
+	flag.BoolVar(&xattrs, "xattrs", false, "Archive and restore the extended attributes of files (tar only; Linux and macOS)")
+	flag.BoolVar(&sparse, "sparse", false, "Archive only the data of files with holes, such as disk images, as GNU tar --sparse does (tar only; Linux, macOS and FreeBSD)")
+	flag.BoolVar(&touch, "touch", false, "Give files being extracted the current time instead of their times in the archive, like tar -m (zip and tar only)")
 	flag.BoolVar(&mkdirAll, "mkdirs", false, "Make all necessary directories")
 	flag.BoolVar(&selectiveCompression, "smart", true, "Only compress files which are not already compressed (zip only)")
 	flag.BoolVar(&implicitTopLevelFolder, "folder-safe", true, "If an archive does not have a single top-level folder, create one implicitly")
 	flag.BoolVar(&continueOnError, "allow-errors", true, "Log errors and continue processing")
+	flag.IntVar(&maxErrorsLogged, "max-errors-logged", 10, "Maximum number of errors of each kind to log with -allow-errors (0 for no limit)")
+	flag.BoolVar(&strictMetadata, "strict", false, "Fail instead of warning when file metadata cannot be preserved")
+	flag.BoolVar(&sortByDirectory, "sort-dirs", false, "Extract files grouped by directory, which is faster for huge archives (zip only)")
+	flag.IntVar(&prepassWorkers, "prepass", 0, "Make directories and check for existing files with this many workers before extracting (zip only)")
+	flag.IntVar(&padTo, "pad-to", 0, "Pad tar archives with zeros to a multiple of this many bytes (tar only)")
+	flag.StringVar(&onError, "on-error", "", "What to do when a file fails to extract: skip, abort, retry:N or ask (zip and tar only; default per -allow-errors)")
+	flag.BoolVar(&omitTrailer, "no-trailer", false, "Leave out the end-of-archive marker so tar archives can be concatenated (tar only)")
+	flag.BoolVar(&showProgress, "progress", false, "Show each file as it is archived or extracted (zip and tar only)")
+	flag.BoolVar(&followSymlinks, "follow-links", false, "Archive the files and folders symbolic links point to instead of the links (zip and tar only)")
+	flag.StringVar(&ignoreFileName, "ignore-file", "", "Leave out files matching the patterns of ignore files of this name, such as .gitignore, when archiving (zip and tar only)")
+	flag.StringVar(&signKey, "sign", "", "Sign archives made with the minisign secret key in this file, next to them in .minisig files (zip and tar only)")
+	flag.StringVar(&verifyKey, "verify", "", "Check the .minisig signature of archives with this minisign public key before extracting them")
+	flag.StringVar(&exclude, "exclude", "", "Comma-separated .gitignore-style patterns of files to leave out when archiving or extracting (zip and tar only)")
 }
 
 func main() {
@@ -44,6 +106,8 @@ func main() {
 	}
 	flag.Parse()
 
+	archiver.SetErrorLogPolicy(archiver.ErrorLogPolicy{MaxPerClass: maxErrorsLogged})
+
 	subcommand := flag.Arg(0)
 
 	// get the format we're working with
@@ -52,6 +116,15 @@ func main() {
 		fatal(err)
 	}
 
+	// archives whose signatures do not match
+	// are not extracted at all
+	if verifyKey != "" && (subcommand == "unarchive" || subcommand == "extract") {
+		err = archiver.VerifySignature(flag.Arg(1), "", verifyKey)
+		if err != nil {
+			fatal(archiver.FormatError(err))
+		}
+	}
+
 	// run the desired command
 	switch subcommand {
 	case "archive":
@@ -59,13 +132,26 @@ func main() {
 		if !ok {
 			fatalf("the archive command does not support the %s format", iface)
 		}
+		if caps, err := archiver.Capabilities(iface); err == nil {
+			warnUnsupported(caps, flag.Args()[2:], iface)
+		}
 		err = a.Archive(flag.Args()[2:], flag.Arg(1))
 
+	case "append":
+		a, ok := iface.(archiver.Appender)
+		if !ok {
+			fatalf("the append command does not support the %s format", iface)
+		}
+		err = a.Append(flag.Arg(1), flag.Args()[2:])
+
 	case "unarchive":
 		a, ok := iface.(archiver.Unarchiver)
 		if !ok {
 			fatalf("the unarchive command does not support the %s format", iface)
 		}
+		if recursiveDepth > 0 {
+			a = archiver.RecursiveUnarchiver{Unarchiver: a, MaxDepth: recursiveDepth, MaxTotalSize: maxTotalSize}
+		}
 		err = a.Unarchive(flag.Arg(1), flag.Arg(2))
 
 	case "extract":
@@ -75,6 +161,16 @@ func main() {
 		}
 		err = e.Extract(flag.Arg(1), flag.Arg(2), flag.Arg(3))
 
+	case "test":
+		v, ok := iface.(archiver.Validator)
+		if !ok {
+			fatalf("the test command does not support the %s format", iface)
+		}
+		err = v.Validate(flag.Arg(1))
+		if err == nil {
+			fmt.Printf("%s: OK\n", flag.Arg(1))
+		}
+
 	case "ls":
 		w, ok := iface.(archiver.Walker)
 		if !ok {
@@ -103,6 +199,32 @@ func main() {
 					h.Name,
 				)
 
+			case *archiver.CpioHeader:
+				fmt.Printf("%s\t%d\t%d\t%d\t%s\t%s\n",
+					f.Mode(),
+					h.UID,
+					h.GID,
+					f.Size(),
+					f.ModTime(),
+					h.Name,
+				)
+
+			case *archiver.WarcHeader:
+				fmt.Printf("%s\t%d\t%s\t%s\n",
+					h.Type,
+					f.Size(),
+					f.ModTime(),
+					f.Name(),
+				)
+
+			case *archiver.CabHeader:
+				fmt.Printf("%s\t%d\t%s\t%s\n",
+					f.Mode(),
+					f.Size(),
+					f.ModTime(),
+					h.Name,
+				)
+
 			case *rardecode.FileHeader:
 				fmt.Printf("%s\t%d\t%d\t%s\t%s\n",
 					f.Mode(),
@@ -170,8 +292,14 @@ func main() {
 	default:
 		fatalf("unrecognized command: %s", flag.Arg(0))
 	}
+	archiver.LogErrorSummary()
+	if wc, ok := iface.(archiver.WarningCollector); ok {
+		for _, w := range wc.Warnings() {
+			fmt.Fprintf(os.Stderr, "[WARNING] %s\n", archiver.FormatError(w))
+		}
+	}
 	if err != nil {
-		fatal(err)
+		fatal(archiver.FormatError(err))
 	}
 }
 
@@ -197,25 +325,179 @@ func getFormat(subcommand string) (interface{}, error) {
 		}
 	}
 
+	// some formats are other formats by another name
+	if alias, ok := formatAliases[strings.ToLower(filepath.Ext(archiveName))]; ok && ext == "" {
+		ext = alias
+	}
+
+	// if the name does not tell, look at the
+	// contents of the archive, if it exists
+	if ext == "" && subcommand != "archive" && subcommand != "compress" {
+		ext = detectFormat(archiveName)
+	}
+
+	errorHandler, err := newErrorHandler(onError)
+	if err != nil {
+		return nil, err
+	}
+	overwritePolicy, err := parseOverwritePolicy(existing)
+	if err != nil {
+		return nil, err
+	}
+	symlinkPolicy, err := parseSymlinkPolicy(symlinks, archiver.SymlinkReject)
+	if err != nil {
+		return nil, err
+	}
+	absolutePathPolicy, err := parseAbsolutePathPolicy(absolute)
+	if err != nil {
+		return nil, err
+	}
+	specialFilePolicy, err := parseSpecialFilePolicy(special)
+	if err != nil {
+		return nil, err
+	}
+	sanitizeNames, err := parseNameSanitization(sanitize)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := parseOwner(chown)
+	if err != nil {
+		return nil, err
+	}
+	var userMap, groupMap archiver.IDMap
+	if uidMap != "" {
+		userMap, err = archiver.ParseIDMap(uidMap)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -uidmap: %w", err)
+		}
+	}
+	if gidMap != "" {
+		groupMap, err = archiver.ParseIDMap(gidMap)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -gidmap: %w", err)
+		}
+	}
+	// packages often have absolute links, such as to /etc/alternatives
+	packageSymlinkPolicy, _ := parseSymlinkPolicy(symlinks, archiver.SymlinkReroot)
+	var progress archiver.ProgressFunc
+	if showProgress {
+		progress = newProgressPrinter()
+	}
+	var excludePatterns []string
+	if exclude != "" {
+		excludePatterns = strings.Split(exclude, ",")
+	}
+	var signingKey *archiver.SigningKey
+	if signKey != "" {
+		signingKey, err = readSigningKey(signKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// configure an archiver
 	var iface interface{}
 	mytar := &archiver.Tar{
 		OverwriteExisting:      overwriteExisting,
+		OverwritePolicy:        overwritePolicy,
+		AbsolutePathPolicy:     absolutePathPolicy,
+		SanitizeNames:          sanitizeNames,
+		SymlinkPolicy:          symlinkPolicy,
+		MaxEntrySize:           maxEntrySize,
+		MaxTotalSize:           maxTotalSize,
+		CheckDiskSpace:         checkDiskSpace,
+		DiscardTimes:           touch,
+		SpecialFilePolicy:      specialFilePolicy,
+		PreserveOwnership:      preserveOwner,
+		NumericOwner:           numericOwner,
+		Xattrs:                 xattrs,
+		Sparse:                 sparse,
+		UserMap:                userMap,
+		GroupMap:               groupMap,
+		Chown:                  owner,
 		MkdirAll:               mkdirAll,
 		ImplicitTopLevelFolder: implicitTopLevelFolder,
 		ContinueOnError:        continueOnError,
+		StrictMetadata:         strictMetadata,
+		PadTo:                  padTo,
+		OmitTrailer:            omitTrailer,
+		OnError:                errorHandler,
+		Progress:               progress,
+		ExcludePatterns:        excludePatterns,
+		IgnoreFileName:         ignoreFileName,
+		FollowSymlinks:         followSymlinks,
+		SigningKey:             signingKey,
 	}
 
 	switch ext {
 	case ".rar":
 		iface = &archiver.Rar{
 			OverwriteExisting:      overwriteExisting,
+			AbsolutePathPolicy:     absolutePathPolicy,
 			MkdirAll:               mkdirAll,
+			MaxEntrySize:           maxEntrySize,
+			MaxTotalSize:           maxTotalSize,
 			ImplicitTopLevelFolder: implicitTopLevelFolder,
 			ContinueOnError:        continueOnError,
 			Password:               os.Getenv("ARCHIVE_PASSWORD"),
 		}
 
+	case ".deb":
+		iface = &archiver.Deb{
+			OverwriteExisting:  overwriteExisting,
+			AbsolutePathPolicy: absolutePathPolicy,
+			SymlinkPolicy:      packageSymlinkPolicy,
+			SpecialFilePolicy:  specialFilePolicy,
+			MaxEntrySize:       maxEntrySize,
+			MaxTotalSize:       maxTotalSize,
+			MkdirAll:           mkdirAll,
+			ContinueOnError:    continueOnError,
+		}
+
+	case ".rpm":
+		iface = &archiver.Rpm{
+			OverwriteExisting:      overwriteExisting,
+			AbsolutePathPolicy:     absolutePathPolicy,
+			SymlinkPolicy:          packageSymlinkPolicy,
+			MaxEntrySize:           maxEntrySize,
+			MaxTotalSize:           maxTotalSize,
+			MkdirAll:               mkdirAll,
+			ImplicitTopLevelFolder: implicitTopLevelFolder,
+			ContinueOnError:        continueOnError,
+		}
+
+	case ".warc.gz":
+		fallthrough
+	case ".warc":
+		iface = &archiver.Warc{
+			OverwriteExisting:  overwriteExisting,
+			AbsolutePathPolicy: absolutePathPolicy,
+			MaxEntrySize:       maxEntrySize,
+			MaxTotalSize:       maxTotalSize,
+			MkdirAll:           mkdirAll,
+			ContinueOnError:    continueOnError,
+		}
+
+	case ".cab":
+		iface = &archiver.Cab{
+			OverwriteExisting:  overwriteExisting,
+			AbsolutePathPolicy: absolutePathPolicy,
+			MaxEntrySize:       maxEntrySize,
+			MaxTotalSize:       maxTotalSize,
+			MkdirAll:           mkdirAll,
+			ContinueOnError:    continueOnError,
+		}
+
+	case ".wim":
+		iface = &archiver.Wim{
+			OverwriteExisting:  overwriteExisting,
+			AbsolutePathPolicy: absolutePathPolicy,
+			MaxEntrySize:       maxEntrySize,
+			MaxTotalSize:       maxTotalSize,
+			MkdirAll:           mkdirAll,
+			ContinueOnError:    continueOnError,
+		}
+
 	case ".tar":
 		iface = mytar
 
@@ -242,6 +524,13 @@ func getFormat(subcommand string) (interface{}, error) {
 			CompressionLevel: compressionLevel,
 		}
 
+	case ".tlz":
+		fallthrough
+	case ".tar.lzma":
+		iface = &archiver.TarLzma{
+			Tar: mytar,
+		}
+
 	case ".tsz":
 		fallthrough
 	case ".tar.sz":
@@ -256,14 +545,38 @@ func getFormat(subcommand string) (interface{}, error) {
 			Tar: mytar,
 		}
 
+	case ".tzst":
+		fallthrough
+	case ".tar.zst":
+		iface = &archiver.TarZst{
+			Tar: mytar,
+		}
+
 	case ".zip":
 		iface = &archiver.Zip{
 			CompressionLevel:       compressionLevel,
 			OverwriteExisting:      overwriteExisting,
+			OverwritePolicy:        overwritePolicy,
+			AbsolutePathPolicy:     absolutePathPolicy,
+			SanitizeNames:          sanitizeNames,
+			MaxEntrySize:           maxEntrySize,
+			MaxTotalSize:           maxTotalSize,
+			CheckDiskSpace:         checkDiskSpace,
+			DiscardTimes:           touch,
 			MkdirAll:               mkdirAll,
 			SelectiveCompression:   selectiveCompression,
 			ImplicitTopLevelFolder: implicitTopLevelFolder,
 			ContinueOnError:        continueOnError,
+			StrictMetadata:         strictMetadata,
+			SortByDirectory:        sortByDirectory,
+			PrepassWorkers:         prepassWorkers,
+			OnError:                errorHandler,
+			Progress:               progress,
+			ExcludePatterns:        excludePatterns,
+			IgnoreFileName:         ignoreFileName,
+			FollowSymlinks:         followSymlinks,
+			Password:               os.Getenv("ARCHIVE_PASSWORD"),
+			SigningKey:             signingKey,
 		}
 
 	case ".gz":
@@ -287,6 +600,9 @@ func getFormat(subcommand string) (interface{}, error) {
 	case ".xz":
 		iface = &archiver.Xz{}
 
+	case ".zst":
+		iface = &archiver.Zstd{}
+
 	default:
 		archiveExt := filepath.Ext(archiveName)
 		if archiveExt == "" {
@@ -298,6 +614,270 @@ func getFormat(subcommand string) (interface{}, error) {
 	return iface, nil
 }
 
+// warnUnsupported prints a warning for each kind of
+// file in sources which cannot be stored in format,
+// according to caps, and will be dropped or mangled.
+func warnUnsupported(caps archiver.FormatCapabilities, sources []string, format interface{}) {
+	warned := make(map[string]bool)
+	warn := func(kind, example string) {
+		if !warned[kind] {
+			warned[kind] = true
+			fmt.Fprintf(os.Stderr, "Warning: %s cannot be stored in %s archives (for example, %s)\n", kind, format, example)
+		}
+	}
+	for _, source := range sources {
+		filepath.Walk(source, func(fpath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil // reported when archiving
+			}
+			if !caps.Symlinks && info.Mode()&os.ModeSymlink != 0 {
+				warn("symbolic links", fpath)
+			}
+			if !caps.LargeFiles && info.Size() >= 1<<32 {
+				warn("files of 4 GiB or more", fpath)
+			}
+			if !caps.UnicodeNames && !isASCII(info.Name()) {
+				warn("non-ASCII file names", fpath)
+			}
+			return nil
+		})
+	}
+}
+
+// detectFormat returns the extension of the format of
+// the file named name, as identified by its contents,
+// or "" if it cannot be identified.
+func detectFormat(name string) string {
+	file, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	format, _, err := archiver.DetectFormat(file)
+	if err != nil {
+		return ""
+	}
+	return "." + format
+}
+
+// newProgressPrinter returns a progress function
+// which prints each entry as it is done, with how
+// many of the entries are done.
+func newProgressPrinter() archiver.ProgressFunc {
+	var printed int
+	return func(entry string, bytesDone, bytesTotal int64, entriesDone, entriesTotal int) {
+		if entriesDone == printed {
+			return // entry not done yet
+		}
+		printed = entriesDone
+		if entriesTotal < 0 {
+			fmt.Fprintf(os.Stderr, "[%d] %s\n", entriesDone, entry)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", entriesDone, entriesTotal, entry)
+	}
+}
+
+// parseOverwritePolicy returns the policy named by the
+// -existing flag, or OverwriteError if it is not set.
+func parseOverwritePolicy(name string) (archiver.OverwritePolicy, error) {
+	switch name {
+	case "", "error":
+		return archiver.OverwriteError, nil
+	case "skip":
+		return archiver.OverwriteSkip, nil
+	case "overwrite":
+		return archiver.OverwriteAlways, nil
+	case "older":
+		return archiver.OverwriteOlder, nil
+	case "rename":
+		return archiver.OverwriteRenameNew, nil
+	default:
+		return 0, fmt.Errorf("invalid -existing policy: %s (must be error, skip, overwrite, older or rename)", name)
+	}
+}
+
+// parseSymlinkPolicy returns the policy named by the
+// -symlinks flag, or def if it is not set.
+func parseSymlinkPolicy(name string, def archiver.SymlinkPolicy) (archiver.SymlinkPolicy, error) {
+	switch name {
+	case "":
+		return def, nil
+	case "reject":
+		return archiver.SymlinkReject, nil
+	case "skip":
+		return archiver.SymlinkSkip, nil
+	case "reroot":
+		return archiver.SymlinkReroot, nil
+	case "allow":
+		return archiver.SymlinkAllow, nil
+	default:
+		return 0, fmt.Errorf("invalid -symlinks policy: %s (must be reject, skip, reroot or allow)", name)
+	}
+}
+
+// parseAbsolutePathPolicy returns the
+// policy named by the -absolute flag.
+func parseAbsolutePathPolicy(name string) (archiver.AbsolutePathPolicy, error) {
+	switch name {
+	case "", "strip":
+		return archiver.AbsolutePathStrip, nil
+	case "reject":
+		return archiver.AbsolutePathReject, nil
+	default:
+		return 0, fmt.Errorf("invalid -absolute policy: %s (must be strip or reject)", name)
+	}
+}
+
+// parseSpecialFilePolicy returns the policy
+// named by the -special flag.
+func parseSpecialFilePolicy(name string) (archiver.SpecialFilePolicy, error) {
+	switch name {
+	case "", "skip":
+		return archiver.SpecialFileSkip, nil
+	case "error":
+		return archiver.SpecialFileError, nil
+	case "create":
+		return archiver.SpecialFileCreate, nil
+	default:
+		return 0, fmt.Errorf("invalid -special policy: %s (must be skip, error or create)", name)
+	}
+}
+
+// parseNameSanitization returns the sanitization
+// named by the -sanitize flag.
+func parseNameSanitization(names string) (archiver.NameSanitization, error) {
+	var s archiver.NameSanitization
+	if names == "" {
+		return s, nil
+	}
+	for _, name := range strings.Split(names, ",") {
+		switch name {
+		case "control":
+			s.StripControl = true
+		case "reserved":
+			s.RejectReserved = true
+		case "unicode":
+			s.NormalizeUnicode = true
+		case "all":
+			s = archiver.NameSanitization{StripControl: true, RejectReserved: true, NormalizeUnicode: true}
+		default:
+			return s, fmt.Errorf("invalid -sanitize option: %s (must be control, reserved, unicode or all)", name)
+		}
+	}
+	return s, nil
+}
+
+// parseOwner returns the owner given by the -chown
+// flag, or nil if it is not set.
+func parseOwner(s string) (*archiver.Owner, error) {
+	if s == "" {
+		return nil, nil
+	}
+	ids := strings.Split(s, ":")
+	if len(ids) != 2 {
+		return nil, fmt.Errorf("invalid -chown owner: %s (must be uid:gid)", s)
+	}
+	uid, err := strconv.Atoi(ids[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid -chown user ID: %s", ids[0])
+	}
+	gid, err := strconv.Atoi(ids[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid -chown group ID: %s", ids[1])
+	}
+	return &archiver.Owner{UID: uid, GID: gid}, nil
+}
+
+// readSigningKey reads the minisign secret key in the
+// file named name, decrypting it with the password in
+// the ARCHIVE_SIGNING_PASSWORD environment variable.
+func readSigningKey(name string) (*archiver.SigningKey, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("opening signing key: %w", err)
+	}
+	defer file.Close()
+	key, err := archiver.ReadSigningKey(file, os.Getenv("ARCHIVE_SIGNING_PASSWORD"))
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key %s: %w", name, err)
+	}
+	return key, nil
+}
+
+// newErrorHandler returns the handler of errors with
+// files described by policy, which is the value of the
+// -on-error flag, or nil if policy is empty.
+func newErrorHandler(policy string) (archiver.ErrorHandler, error) {
+	// once out of retries, do as -allow-errors says
+	giveUp := archiver.ErrorAbort
+	if continueOnError {
+		giveUp = archiver.ErrorSkip
+	}
+	logSkip := func(name string, err error) {
+		fmt.Fprintf(os.Stderr, "[ERROR] Skipping %s: %s\n", name, archiver.FormatError(err))
+	}
+
+	switch {
+	case policy == "":
+		return nil, nil
+	case policy == "skip":
+		return func(name string, err error, failures int) archiver.ErrorAction {
+			logSkip(name, err)
+			return archiver.ErrorSkip
+		}, nil
+	case policy == "abort":
+		return func(string, error, int) archiver.ErrorAction {
+			return archiver.ErrorAbort
+		}, nil
+	case strings.HasPrefix(policy, "retry:"):
+		retries, err := strconv.Atoi(strings.TrimPrefix(policy, "retry:"))
+		if err != nil || retries < 0 {
+			return nil, fmt.Errorf("invalid number of retries: %s", policy)
+		}
+		return func(name string, err error, failures int) archiver.ErrorAction {
+			if failures <= retries {
+				fmt.Fprintf(os.Stderr, "[ERROR] Retrying %s (%d of %d): %s\n", name, failures, retries, archiver.FormatError(err))
+				return archiver.ErrorRetry
+			}
+			if giveUp == archiver.ErrorSkip {
+				logSkip(name, err)
+			}
+			return giveUp
+		}, nil
+	case policy == "ask":
+		stdin := bufio.NewReader(os.Stdin)
+		return func(name string, err error, failures int) archiver.ErrorAction {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, archiver.FormatError(err))
+			for {
+				fmt.Fprint(os.Stderr, "[r]etry, [s]kip or [a]bort? ")
+				answer, readErr := stdin.ReadString('\n')
+				switch strings.ToLower(strings.TrimSpace(answer)) {
+				case "r", "retry":
+					return archiver.ErrorRetry
+				case "s", "skip":
+					return archiver.ErrorSkip
+				case "a", "abort":
+					return archiver.ErrorAbort
+				}
+				if readErr != nil {
+					return archiver.ErrorAbort // no more answers
+				}
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid -on-error policy: %s (must be skip, abort, retry:N or ask)", policy)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
 func fatal(v ...interface{}) {
 	fmt.Fprintln(os.Stderr, v...)
 	os.Exit(1)
@@ -324,22 +904,49 @@ var supportedFormats = []string{
 	".tar.bz2",
 	".tar.gz",
 	".tar.lz4",
+	".tar.lzma",
 	".tar.sz",
 	".tar.xz",
+	".tar.zst",
+	".warc.gz",
 	".rar",
+	".cab",
+	".deb",
+	".rpm",
 	".tar",
+	".warc",
+	".wim",
 	".zip",
 	".gz",
 	".bz2",
 	".lz4",
 	".sz",
 	".xz",
+	".zst",
 }
 
-const usage = `Usage: arc {archive|unarchive|extract|ls|compress|decompress|help} [arguments...]
+// formatAliases maps the extensions of formats which
+// are really another format under the hood to the
+// extension of that format.
+var formatAliases = map[string]string{
+	".apk":  ".zip",
+	".docx": ".zip",
+	".epub": ".zip",
+	".jar":  ".zip",
+	".odt":  ".zip",
+	".pptx": ".zip",
+	".war":  ".zip",
+	".xlsx": ".zip",
+}
+
+const usage = `Usage: arc {archive|append|unarchive|extract|test|ls|compress|decompress|help} [arguments...]
   archive
     Create a new archive file. List the files/folders
     to include in the archive; at least one required.
+  append
+    Add files to an existing archive file (uncompressed
+    tar only). List the files/folders to add after the
+    archive; at least one required.
   unarchive
     Extract an archive file. Provide the archive to
     open and the destination folder to extract into.
@@ -348,6 +955,10 @@ const usage = `Usage: arc {archive|unarchive|extract|ls|compress|decompress|help
     an archive. First argument is the source archive,
     second is the file to extract (exact path within the
     archive is required), and third is destination.
+  test
+    Check the integrity of an archive file by reading
+    all of it, verifying checksums where the format
+    has them.
   ls
     List the contents of the archive.
   compress
@@ -370,14 +981,31 @@ const usage = `Usage: arc {archive|unarchive|extract|ls|compress|decompress|help
       .txz
       .tar.lz4
       .tlz4
+      .tar.lzma
+      .tlz
       .tar.sz
       .tsz
+      .tar.zst
+      .tzst
       .rar (open only)
+      .cab (open only)
+      .deb (open only)
+      .rpm (open only)
+      .warc or .warc.gz (open only)
+      .wim (open only; Linux and Windows)
       .bz2
       .gz
       .lz4
       .sz
       .xz
+      .zst
+
+    Zip-based formats (.jar, .war, .apk, .docx, .xlsx,
+    .pptx, .odt, .epub) are treated as .zip archives.
+
+    When opening an existing file whose extension is
+    not one of these, the format is identified by the
+    contents of the file instead.
 
   (DE)COMPRESSING SINGLE FILES
     Some formats are compression-only, and can be used
@@ -390,9 +1018,22 @@ const usage = `Usage: arc {archive|unarchive|extract|ls|compress|decompress|help
     second argument. To replace a file when decompressing,
     specify only the source file and no destination.
 
-  PASSWORD-PROTECTED RAR FILES
+  PASSWORD-PROTECTED RAR AND ZIP FILES
     Export the ARCHIVE_PASSWORD environment variable
-    to be able to open password-protected rar archives.
+    to be able to open password-protected rar archives,
+    and zip archives encrypted with AES. Zip archives
+    made while it is set are encrypted with AES-256.
+
+  SIGNED ARCHIVES
+    With -sign, zip and tar archives are signed as they
+    are made with a secret key of minisign, whose
+    password is read from the ARCHIVE_SIGNING_PASSWORD
+    environment variable. The signature is written next
+    to the archive, with .minisig appended to its name.
+    With -verify and a public key (as printed by
+    minisign), the signatures of archives are checked
+    before they are extracted, and archives whose
+    signatures do not match are not extracted.
 
   GLOBAL FLAG REFERENCE
     The following global flags may be used before the
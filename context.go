@@ -0,0 +1,193 @@
+package archiver
+
+import (
+	"context"
+	"io"
+)
+
+// ArchiveContext is like a.Archive, but stops as soon as
+// possible once ctx is done, in which case it returns
+// ctx.Err(). For Tar (including compressed tarballs) and
+// Zip, the context is checked between files and while
+// contents are copied; for other formats, it is only
+// checked before starting.
+func ArchiveContext(ctx context.Context, a Archiver, sources []string, destination string) error {
+	return withContext(ctx, a, func(format interface{}) error {
+		return format.(Archiver).Archive(sources, destination)
+	})
+}
+
+// UnarchiveContext is like u.Unarchive, but stops as soon
+// as possible once ctx is done, in which case it returns
+// ctx.Err(). The context is checked as described for
+// ArchiveContext.
+func UnarchiveContext(ctx context.Context, u Unarchiver, source, destination string) error {
+	return withContext(ctx, u, func(format interface{}) error {
+		return format.(Unarchiver).Unarchive(source, destination)
+	})
+}
+
+// ExtractContext is like e.Extract, but stops as soon as
+// possible once ctx is done, in which case it returns
+// ctx.Err(). The context is checked as described for
+// ArchiveContext.
+func ExtractContext(ctx context.Context, e Extractor, source, target, destination string) error {
+	return withContext(ctx, e, func(format interface{}) error {
+		return format.(Extractor).Extract(source, target, destination)
+	})
+}
+
+// WalkContext is like w.Walk, but stops as soon as possible
+// once ctx is done, in which case it returns ctx.Err(). For
+// all formats, the context is checked before walkFn is
+// called and while walkFn reads the contents of files; for
+// Tar (including compressed tarballs) and Zip, it is also
+// checked while reading the archive.
+func WalkContext(ctx context.Context, w Walker, archive string, walkFn WalkFunc) error {
+	return withContext(ctx, w, func(format interface{}) error {
+		return format.(Walker).Walk(archive, func(f File) error {
+			if ctx.Err() != nil {
+				return ErrStopWalk
+			}
+			if f.ReadCloser != nil {
+				f.ReadCloser = newContextReadCloser(ctx, f.ReadCloser)
+			}
+			return walkFn(f)
+		})
+	})
+}
+
+// contextChecker is implemented by formats which can
+// check a context while they work.
+type contextChecker interface {
+	// withContext returns a copy of the format, of the
+	// same type, which checks ctx; the results of its
+	// operations are saved to the format.
+	withContext(ctx context.Context) interface{}
+}
+
+// withContext calls fn, which does work with format, so
+// that the work stops once ctx is done: fn is given a
+// copy of format which checks ctx, if format can. If ctx
+// is done before or during the work, ctx.Err() is
+// returned.
+func withContext(ctx context.Context, format interface{}, fn func(format interface{}) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if cc, ok := format.(contextChecker); ok {
+		format = cc.withContext(ctx)
+	}
+	err := fn(format)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// contextErr returns the error of ctx,
+// which may be nil, if it is done.
+func contextErr(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// contextReader reads from r until ctx is done. Since
+// the context is checked before every read, a copy
+// from it stops soon after ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// contextReadSeeker is a contextReader which
+// can seek, for readers which can seek.
+type contextReadSeeker struct {
+	contextReader
+	io.Seeker
+}
+
+// contextReaderAt reads from r until ctx is done.
+type contextReaderAt struct {
+	ctx context.Context
+	r   io.ReaderAt
+}
+
+func (cr contextReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.ReadAt(p, off)
+}
+
+// contextReadCloser is a contextReader
+// which closes the original reader.
+type contextReadCloser struct {
+	io.ReadCloser
+	r contextReader
+}
+
+func (crc contextReadCloser) Read(p []byte) (int, error) { return crc.r.Read(p) }
+
+// contextWriter writes to w until ctx is done.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
+
+// newContextReader returns r, wrapped to stop reading once
+// ctx is done if ctx is not nil. The returned reader can
+// seek if r can.
+func newContextReader(ctx context.Context, r io.Reader) io.Reader {
+	if ctx == nil {
+		return r
+	}
+	cr := contextReader{ctx: ctx, r: r}
+	if s, ok := r.(io.Seeker); ok {
+		return contextReadSeeker{contextReader: cr, Seeker: s}
+	}
+	return cr
+}
+
+// newContextReadCloser is like newContextReader,
+// for a reader which must be closed.
+func newContextReadCloser(ctx context.Context, rc io.ReadCloser) io.ReadCloser {
+	if ctx == nil {
+		return rc
+	}
+	return contextReadCloser{ReadCloser: rc, r: contextReader{ctx: ctx, r: rc}}
+}
+
+// newContextWriter returns w, wrapped to stop writing
+// once ctx is done if ctx is not nil.
+func newContextWriter(ctx context.Context, w io.Writer) io.Writer {
+	if ctx == nil {
+		return w
+	}
+	return contextWriter{ctx: ctx, w: w}
+}
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = contextChecker(&Tar{})
+	_ = contextChecker(&Zip{})
+	_ = contextChecker(&TarGz{})
+	_ = io.ReadSeeker(contextReadSeeker{})
+	_ = io.ReaderAt(contextReaderAt{})
+)
@@ -0,0 +1,119 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, format := range []interface {
+		Archiver
+		Unarchiver
+		Walker
+		Extractor
+	}{
+		&Tar{ContinueOnError: true},
+		&TarGz{Tar: &Tar{ContinueOnError: true}},
+		&Zip{ContinueOnError: true},
+	} {
+		archive := filepath.Join(tmp, "context."+fmt.Sprint(format))
+
+		// nothing is done with a context which is already done
+		err := ArchiveContext(canceled, format, []string{"testdata"}, archive)
+		if err != context.Canceled {
+			t.Errorf("[%s] expected %v archiving, got %v", format, context.Canceled, err)
+		}
+		if fileExists(archive) {
+			t.Errorf("[%s] expected no archive to be made", format)
+		}
+
+		err = ArchiveContext(context.Background(), format, []string{"testdata"}, archive)
+		if err != nil {
+			t.Fatalf("[%s] archiving: %v", format, err)
+		}
+
+		dest := filepath.Join(tmp, "unarchived-"+fmt.Sprint(format))
+		err = UnarchiveContext(canceled, format, archive, dest)
+		if err != context.Canceled {
+			t.Errorf("[%s] expected %v unarchiving, got %v", format, context.Canceled, err)
+		}
+		if fileExists(dest) {
+			t.Errorf("[%s] expected nothing to be extracted", format)
+		}
+		err = ExtractContext(canceled, format, archive, "testdata", dest)
+		if err != context.Canceled {
+			t.Errorf("[%s] expected %v extracting, got %v", format, context.Canceled, err)
+		}
+
+		// canceling during a walk stops it, and reads of
+		// the current file fail, even though errors are
+		// otherwise logged and skipped
+		ctx, cancel := context.WithCancel(context.Background())
+		var count int
+		err = WalkContext(ctx, format, archive, func(f File) error {
+			count++
+			cancel()
+			_, err := io.Copy(ioutil.Discard, f)
+			if err != context.Canceled {
+				t.Errorf("[%s] expected %v reading after cancellation, got %v", format, context.Canceled, err)
+			}
+			return err
+		})
+		if err != context.Canceled {
+			t.Errorf("[%s] expected %v walking, got %v", format, context.Canceled, err)
+		}
+		if count != 1 {
+			t.Errorf("[%s] expected walk to stop after 1 file, but walked %d", format, count)
+		}
+
+		// canceling while archiving stops before the
+		// remaining files are added
+		ctx, cancel = context.WithCancel(context.Background())
+		entries := []VirtualEntry{
+			{
+				Name: "cancel",
+				Size: -1,
+				Open: func() (io.ReadCloser, error) {
+					cancel()
+					return ioutil.NopCloser(strings.NewReader("canceled")), nil
+				},
+			},
+		}
+		switch f := format.(type) {
+		case *Tar:
+			f.VirtualEntries = entries
+			f.OverwriteExisting = true
+		case *TarGz:
+			f.VirtualEntries = entries
+			f.OverwriteExisting = true
+		case *Zip:
+			f.VirtualEntries = entries
+			f.OverwriteExisting = true
+		}
+		err = ArchiveContext(ctx, format, []string{"testdata"}, archive)
+		if err != context.Canceled {
+			t.Errorf("[%s] expected %v archiving, got %v", format, context.Canceled, err)
+		}
+
+		// the context is forgotten afterwards
+		err = format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Errorf("[%s] expected context to be forgotten, got %v", format, err)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/ulikunitz/xz/lzma"
+	fastxz "github.com/xi2/xz"
+)
+
+// Deb provides facilities for extracting Debian binary
+// packages. A .deb file is an ar archive containing a
+// control tarball (package metadata and maintainer
+// scripts) and a data tarball (the installed files).
+// Like `dpkg-deb --raw-extract`, Unarchive writes the
+// contents of the data tarball into the destination and
+// the contents of the control tarball into a "DEBIAN"
+// folder within it.
+// See https://manpages.debian.org/deb.5.
+type Deb struct {
+	// Whether to overwrite existing files; if false,
+	// an error is returned if the file exists.
+	OverwriteExisting bool
+
+	// Whether to extract entries whose paths go outside
+	// of the destination, such as "../../etc/cron.d/x";
+	// if false, an error which is ErrIllegalPath is
+	// returned for them. Only set this for trusted
+	// archives.
+	AllowPathTraversal bool
+
+	// What to do with entries whose paths are absolute,
+	// such as "/etc/passwd"; the zero value,
+	// AbsolutePathStrip, extracts them inside of the
+	// destination with a warning.
+	AbsolutePathPolicy AbsolutePathPolicy
+
+	// What to do with symbolic links being extracted
+	// which point outside of the destination; the zero
+	// value, SymlinkReject, returns an error for them.
+	// Packages often have absolute links, such as to
+	// /etc/alternatives, which SymlinkReroot keeps
+	// inside of the destination, as DefaultDeb does.
+	SymlinkPolicy SymlinkPolicy
+
+	// The most bytes of contents of any one file to
+	// extract; 0 means no limit. Since contents are
+	// counted as they are decompressed, files which
+	// decompress to much more than they say cannot fill
+	// the disk; extracting them fails with an error which
+	// is ErrLimitExceeded instead.
+	MaxEntrySize int64
+
+	// The most bytes of contents of all files to extract
+	// in one operation, counted like for MaxEntrySize;
+	// 0 means no limit.
+	MaxTotalSize int64
+
+	// The most elements of the path of a file to extract,
+	// such as 3 for "a/b/c.txt"; 0 means no limit. Files
+	// with deeper paths are not extracted, and an error
+	// which is ErrLimitExceeded is returned for them.
+	MaxPathDepth int
+
+	// The most bytes of the path of a file to extract,
+	// like PATH_MAX, checked like MaxPathDepth; 0 means
+	// no limit.
+	MaxPathLength int
+
+	// The most bytes of each element of the path of a file
+	// to extract, like NAME_MAX, checked like MaxPathDepth;
+	// 0 means no limit.
+	MaxNameLength int
+
+	// Whether to keep the setuid, setgid and sticky bits
+	// of the modes of files extracted; by default they are
+	// cleared, so that archives from untrusted sources
+	// cannot make setuid programs.
+	KeepSetuid bool
+
+	// What to do with character and block devices and
+	// named pipes being extracted; the zero value,
+	// SpecialFileSkip, leaves them out with a warning.
+	SpecialFilePolicy SpecialFilePolicy
+
+	// Whether to make all the directories necessary
+	// to extract the package in the desired path.
+	MkdirAll bool
+
+	// If true, only the control tarball is extracted.
+	ControlOnly bool
+
+	// If true, only the data tarball is extracted.
+	DataOnly bool
+
+	// If true, errors encountered during reading
+	// a single file will be logged and the
+	// operation will continue on remaining files.
+	ContinueOnError bool
+
+	// If set, errors skipped because of ContinueOnError
+	// are logged to this logger instead of the logger of
+	// the error log policy.
+	Logger Logger
+}
+
+// Unarchive unpacks the .deb file at source to destination.
+// Destination will be treated as a folder name.
+func (d *Deb) Unarchive(source, destination string) error {
+	if d.ControlOnly && d.DataOnly {
+		return fmt.Errorf("cannot extract only control and only data at the same time")
+	}
+	if !fileExists(destination) && d.MkdirAll {
+		err := mkdir(destination)
+		if err != nil {
+			return fmt.Errorf("preparing destination: %w", err)
+		}
+	}
+
+	file, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("opening source package: %w", err)
+	}
+	defer file.Close()
+
+	ar, err := newArReader(file)
+	if err != nil {
+		return fmt.Errorf("opening deb package for reading: %w", err)
+	}
+
+	var sawControl, sawData bool
+	var extracted int64 // for MaxTotalSize
+	for {
+		name, err := ar.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading ar member: %w", err)
+		}
+
+		var to string
+		switch {
+		case strings.HasPrefix(name, "control.tar"):
+			sawControl = true
+			if d.DataOnly {
+				continue
+			}
+			to = filepath.Join(destination, "DEBIAN")
+		case strings.HasPrefix(name, "data.tar"):
+			sawData = true
+			if d.ControlOnly {
+				continue
+			}
+			to = destination
+		default:
+			continue // debian-binary, signatures, etc.
+		}
+
+		err = d.untarMember(name, ar, to, &extracted)
+		if err != nil {
+			return fmt.Errorf("extracting %s: %w", name, err)
+		}
+	}
+
+	if !sawControl || !sawData {
+		return fmt.Errorf("not a valid deb package: missing control or data member")
+	}
+
+	return nil
+}
+
+// untarMember extracts the (possibly compressed)
+// tarball named name, read from r, into to, adding
+// the bytes of contents extracted to extracted.
+func (d *Deb) untarMember(name string, r io.Reader, to string, extracted *int64) error {
+	tr, cleanup, err := debMemberReader(name, r)
+	if err != nil {
+		return err
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+
+	t := &Tar{
+		OverwriteExisting:  d.OverwriteExisting,
+		AllowPathTraversal: d.AllowPathTraversal,
+		AbsolutePathPolicy: d.AbsolutePathPolicy,
+		SymlinkPolicy:      d.SymlinkPolicy,
+		MaxEntrySize:       d.MaxEntrySize,
+		MaxTotalSize:       d.MaxTotalSize,
+		MaxPathDepth:       d.MaxPathDepth,
+		MaxPathLength:      d.MaxPathLength,
+		MaxNameLength:      d.MaxNameLength,
+		KeepSetuid:         d.KeepSetuid,
+		SpecialFilePolicy:  d.SpecialFilePolicy,
+		MkdirAll:           true,
+		ContinueOnError:    d.ContinueOnError,
+		Logger:             d.Logger,
+	}
+	err = t.Open(tr, 0)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	t.extracted = *extracted
+	defer func() { *extracted = t.extracted }()
+	return t.untarAll(to)
+}
+
+// Match returns true if the format of file matches this
+// type's format. It should not affect reader position.
+func (*Deb) Match(file *os.File) (bool, error) {
+	currentPos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		return false, err
+	}
+	defer file.Seek(currentPos, io.SeekStart)
+
+	buf := make([]byte, len(arMagic)+len("debian-binary"))
+	if _, err := io.ReadFull(file, buf); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(buf, []byte(arMagic+"debian-binary")), nil
+}
+
+func (d *Deb) String() string { return "deb" }
+
+// debMemberReader returns a reader of the uncompressed
+// tarball named name, read from r, along with a function
+// to release it. The compression is chosen by extension.
+func debMemberReader(name string, r io.Reader) (io.Reader, func(), error) {
+	switch filepath.Ext(name) {
+	case ".tar":
+		return r, nil, nil
+	case ".gz":
+		gzr, err := getGzipReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gzr, func() { putGzipReader(gzr) }, nil
+	case ".bz2":
+		bz2r, err := bzip2.NewReader(r, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bz2r, func() { bz2r.Close() }, nil
+	case ".xz":
+		xzr, err := fastxz.NewReader(r, 0)
+		return xzr, nil, err
+	case ".lzma":
+		lr, err := lzma.NewReader(r)
+		return lr, nil, err
+	case ".zst":
+		zr, err := getZstdDecoder(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, func() { putZstdDecoder(zr) }, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported compression: %s", name)
+	}
+}
+
+// arReader reads the members of an ar archive
+// in the common (System V/GNU) format.
+type arReader struct {
+	r   io.Reader
+	cur io.Reader // contents of the current member
+	pad int64     // padding after the current member
+}
+
+func newArReader(r io.Reader) (*arReader, error) {
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != arMagic {
+		return nil, fmt.Errorf("invalid ar magic: %q", magic)
+	}
+	return &arReader{r: r}, nil
+}
+
+// Next advances to the next member, skipping the
+// remainder of the current one, and returns its name.
+func (ar *arReader) Next() (string, error) {
+	if ar.cur != nil {
+		if _, err := io.Copy(ioutil.Discard, ar.cur); err != nil {
+			return "", err
+		}
+		if _, err := io.CopyN(ioutil.Discard, ar.r, ar.pad); err != nil {
+			return "", err
+		}
+		ar.cur = nil
+	}
+
+	hdr := make([]byte, arHeaderSize)
+	if _, err := io.ReadFull(ar.r, hdr); err != nil {
+		return "", err // preserve io.EOF
+	}
+	if string(hdr[58:60]) != "`\n" {
+		return "", fmt.Errorf("invalid member header")
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("parsing member size: %w", err)
+	}
+	ar.cur = io.LimitReader(ar.r, size)
+	ar.pad = size % 2
+
+	// GNU ar terminates names with a slash
+	name := strings.TrimSpace(string(hdr[0:16]))
+	return strings.TrimSuffix(name, "/"), nil
+}
+
+// Read reads the contents of the current member.
+func (ar *arReader) Read(p []byte) (int, error) {
+	if ar.cur == nil {
+		return 0, io.EOF
+	}
+	return ar.cur.Read(p)
+}
+
+const (
+	arMagic      = "!<arch>\n"
+	arHeaderSize = 60
+)
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = Unarchiver(new(Deb))
+	_ = Matcher(new(Deb))
+)
+
+// DefaultDeb is a convenient archiver ready to use.
+var DefaultDeb = &Deb{
+	MkdirAll:      true,
+	SymlinkPolicy: SymlinkReroot,
+}
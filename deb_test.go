@@ -0,0 +1,86 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDebUnarchive(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	source := filepath.Join(tmp, "test.deb")
+	err = ioutil.WriteFile(source, makeTestDeb(t), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(tmp, "full")
+	err = DefaultDeb.Unarchive(source, dest)
+	if err != nil {
+		t.Fatalf("unarchiving deb: %v", err)
+	}
+	for _, name := range []string{
+		filepath.Join("DEBIAN", "control"),
+		filepath.Join("usr", "bin", "hello"),
+	} {
+		if !fileExists(filepath.Join(dest, name)) {
+			t.Errorf("expected %s to be extracted", name)
+		}
+	}
+
+	dest = filepath.Join(tmp, "data")
+	err = (&Deb{MkdirAll: true, DataOnly: true}).Unarchive(source, dest)
+	if err != nil {
+		t.Fatalf("unarchiving deb data: %v", err)
+	}
+	if fileExists(filepath.Join(dest, "DEBIAN")) {
+		t.Errorf("expected control files to be skipped")
+	}
+	if !fileExists(filepath.Join(dest, "usr", "bin", "hello")) {
+		t.Errorf("expected data files to be extracted")
+	}
+}
+
+// makeTestDeb builds a minimal deb package with a
+// gzipped control tarball and an uncompressed data one.
+func makeTestDeb(t *testing.T) []byte {
+	makeTar := func(name, body string) []byte {
+		buf := new(bytes.Buffer)
+		tw := tar.NewWriter(buf)
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(body))
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	control := new(bytes.Buffer)
+	gzw := gzip.NewWriter(control)
+	gzw.Write(makeTar("./control", "Package: hello\n"))
+	gzw.Close()
+
+	buf := bytes.NewBufferString(arMagic)
+	writeMember := func(name string, body []byte) {
+		fmt.Fprintf(buf, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, 0, 0, 0, 0644, len(body))
+		buf.Write(body)
+		if len(body)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	writeMember("debian-binary", []byte("2.0\n"))
+	writeMember("control.tar.gz", control.Bytes())
+	writeMember("data.tar", makeTar("./usr/bin/hello", "#!/bin/sh\necho hello\n"))
+
+	return buf.Bytes()
+}
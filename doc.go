@@ -0,0 +1,47 @@
+// Package archiver makes and extracts archives of files,
+// such as zip archives and tarballs (including compressed
+// ones), and compresses and decompresses single files.
+//
+// # API stability
+//
+// The core API of this package is stable: it will not
+// change in backward-incompatible ways within a major
+// version. The core API is:
+//
+//   - the interfaces Archiver, Unarchiver, Walker,
+//     Extractor, Reader, Writer, Compressor and
+//     Decompressor, and the File and FileInfo types;
+//   - the format types (such as Zip, Tar and TarGz)
+//     and their exported fields, which are the options
+//     of the formats; new options may be added, and
+//     the zero value of a new option keeps the
+//     behavior from before it was added, except as
+//     below;
+//   - the Default variables of the formats, and
+//     ByExtension.
+//
+// Other exported identifiers are stable too, unless
+// their documentation says otherwise, but they may be
+// deprecated in favor of better ways to do the same
+// thing; deprecated identifiers are kept until the
+// next major version.
+//
+// The exception is extracting archives safely: a new
+// option may make the zero value safer than the old
+// behavior, such as refusing entries whose paths go
+// outside of the destination (AllowPathTraversal),
+// rejecting symbolic links which point outside of it
+// (SymlinkPolicy), clearing setuid bits (KeepSetuid)
+// or skipping device files (SpecialFilePolicy), so
+// that programs which do not know of the option are
+// safe from untrusted archives. The old behavior is
+// then kept by setting the option. Likewise, the
+// metadata of files, such as their modification
+// times, may be restored by default where it was
+// not before.
+//
+// New features are added to this package, following
+// the same policy; a feature whose API is not settled
+// yet says so in its documentation, and may change in
+// a minor release until it is.
+package archiver
@@ -0,0 +1,93 @@
+package archiver
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+)
+
+// Warning describes information about a file which was
+// lost because it cannot be represented in the archive
+// format being written, or on the system an archive is
+// being extracted on. By default, such losses do not
+// stop an operation; they are collected and can be
+// retrieved afterwards from types which implement
+// WarningCollector. In strict mode, they are errors.
+type Warning struct {
+	Path   string      // the name of the file
+	Kind   WarningKind // what was lost
+	Detail string      // why it was lost
+}
+
+// Error returns a description of the warning, which
+// is returned as an error in strict mode.
+func (w Warning) Error() string {
+	return fmt.Sprintf(warningFormat, w.Path, w.Kind, w.Detail)
+}
+
+// warningFormat is the format of the descriptions of
+// warnings, with their path, kind and detail.
+const warningFormat = "%s: %s not preserved: %s"
+
+// WarningKind is the kind of information
+// described by a Warning.
+type WarningKind string
+
+// Kinds of information which may be lost.
+const (
+	WarningOwnership WarningKind = "ownership"
+	WarningSymlink   WarningKind = "symbolic link"
+)
+
+// WarningCollector is a type which collects warnings
+// during an operation instead of failing it.
+type WarningCollector interface {
+	// Warnings returns the warnings of the last
+	// operation, or nil if there were none.
+	Warnings() []Warning
+}
+
+// addWarning appends w to warnings, and logs it to
+// logger, unless strict is true, in which case w is
+// returned as an error.
+func addWarning(logger Logger, warnings *[]Warning, strict bool, w Warning) error {
+	if strict {
+		return w
+	}
+	*warnings = append(*warnings, w)
+	logWarning(logger, w)
+	return nil
+}
+
+// ownershipWarning returns a warning if the file described
+// by info is owned by a user or group other than those of
+// the current process, since that ownership is lost when
+// archiving it in a format which cannot store ownership.
+// Files owned by the current user lose nothing, since
+// extracted files are owned by the extracting user anyway.
+func ownershipWarning(name string, info os.FileInfo) (Warning, bool) {
+	var uid, gid int
+	switch sys := info.Sys().(type) {
+	case *tar.Header:
+		uid, gid = sys.Uid, sys.Gid
+	default:
+		var ok bool
+		uid, gid, ok = fileOwner(sys)
+		if !ok {
+			return Warning{}, false
+		}
+	}
+	if uid == os.Getuid() && gid == os.Getgid() {
+		return Warning{}, false
+	}
+	return Warning{
+		Path:   name,
+		Kind:   WarningOwnership,
+		Detail: fmt.Sprintf("format cannot store owner %d:%d", uid, gid),
+	}, true
+}
+
+// errSymlinkNotPermitted is returned by writeNewSymbolicLink
+// if the process is not allowed to create symbolic links,
+// as is the case on Windows without the privilege to do so.
+var errSymlinkNotPermitted = fmt.Errorf("not permitted to create symbolic links")
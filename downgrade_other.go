@@ -0,0 +1,10 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package archiver
+
+func fileOwner(sys interface{}) (uid, gid int, ok bool) { return 0, 0, false }
+
+func fileIdentity(sys interface{}) (id fileID, ok bool) { return fileID{}, false }
+
+func symlinkNotPermitted(err error) bool { return false }
@@ -0,0 +1,79 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZipOwnershipWarning(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		z := &Zip{StrictMetadata: strict}
+		err := z.Create(new(bytes.Buffer))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		write := func(name string, uid int) error {
+			hdr := &tar.Header{
+				Name:     name,
+				Mode:     0644,
+				Uid:      uid,
+				Gid:      os.Getgid(),
+				ModTime:  time.Now(),
+				Typeflag: tar.TypeReg,
+			}
+			return z.Write(File{
+				FileInfo:   hdr.FileInfo(),
+				ReadCloser: ioutil.NopCloser(strings.NewReader("")),
+			})
+		}
+
+		// files owned by the current user lose nothing
+		err = write("mine.txt", os.Getuid())
+		if err != nil {
+			t.Fatalf("strict=%t: writing own file: %v", strict, err)
+		}
+
+		err = write("theirs.txt", os.Getuid()+1)
+		if strict {
+			w, ok := err.(Warning)
+			if !ok {
+				t.Fatalf("expected Warning as error in strict mode, got %v", err)
+			}
+			if w.Kind != WarningOwnership || w.Path != "theirs.txt" {
+				t.Errorf("unexpected warning: %+v", w)
+			}
+		} else if err != nil {
+			t.Fatalf("writing file of other user: %v", err)
+		}
+		z.Close()
+
+		warnings := z.Warnings()
+		if strict && len(warnings) != 0 {
+			t.Errorf("expected no collected warnings in strict mode, got %v", warnings)
+		}
+		if !strict {
+			if len(warnings) != 1 {
+				t.Fatalf("expected 1 warning, got %v", warnings)
+			}
+			if warnings[0].Kind != WarningOwnership || warnings[0].Path != "theirs.txt" {
+				t.Errorf("unexpected warning: %+v", warnings[0])
+			}
+		}
+
+		// warnings are reset by the next operation
+		err = z.Create(new(bytes.Buffer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		z.Close()
+		if len(z.Warnings()) != 0 {
+			t.Errorf("expected warnings to be reset, got %v", z.Warnings())
+		}
+	}
+}
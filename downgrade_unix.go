@@ -0,0 +1,29 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package archiver
+
+import "syscall"
+
+// fileOwner returns the owner user and group
+// from sys, the result of os.FileInfo.Sys.
+func fileOwner(sys interface{}) (uid, gid int, ok bool) {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+// fileIdentity returns the identity of the file whose
+// info has sys, the result of os.FileInfo.Sys, if it has
+// more than one hard link.
+func fileIdentity(sys interface{}) (id fileID, ok bool) {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+func symlinkNotPermitted(err error) bool { return false }
@@ -0,0 +1,26 @@
+package archiver
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns false, since files on Windows
+// do not have owners in the Unix sense.
+func fileOwner(sys interface{}) (uid, gid int, ok bool) { return 0, 0, false }
+
+// fileIdentity returns false, since the info of files
+// on Windows does not identify them; hard links are
+// archived as copies of the files.
+func fileIdentity(sys interface{}) (id fileID, ok bool) { return fileID{}, false }
+
+// symlinkNotPermitted returns true if err, from
+// os.Symlink, means that the process does not have
+// the privilege to create symbolic links.
+func symlinkNotPermitted(err error) bool {
+	const errorPrivilegeNotHeld = syscall.Errno(1314)
+	if le, ok := err.(*os.LinkError); ok {
+		return le.Err == errorPrivilegeNotHeld
+	}
+	return false
+}
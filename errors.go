@@ -0,0 +1,108 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+)
+
+// Errors which errors.Is can check for in the errors
+// returned by this package, instead of their messages.
+var (
+	// ErrDestinationExists means that a file would have
+	// been overwritten, such as the archive being created
+	// or a file being extracted.
+	ErrDestinationExists = fmt.Errorf("file already exists")
+
+	// ErrUnsupportedType means that a format, or the type
+	// of an entry in an archive, is not recognized or
+	// cannot be used as requested.
+	ErrUnsupportedType = fmt.Errorf("unsupported type")
+
+	// ErrFormatMismatch means that a file name does not
+	// have the extension of the format being used.
+	ErrFormatMismatch = fmt.Errorf("file name does not match format")
+
+	// ErrIllegalPath means that a path is not allowed,
+	// such as one which goes outside of its folder.
+	ErrIllegalPath = fmt.Errorf("illegal path")
+
+	// ErrLimitExceeded means that an archive is beyond a
+	// limit set to protect against malicious archives,
+	// such as the size of the files extracted from it.
+	ErrLimitExceeded = fmt.Errorf("limit exceeded")
+
+	// ErrWrongPassword means that encrypted contents
+	// cannot be read because the password is wrong, or
+	// because no password was given.
+	ErrWrongPassword = fmt.Errorf("wrong password")
+
+	// ErrSignatureMismatch means that the signature of an
+	// archive is not that of the archive by the key which
+	// checked it, so the archive cannot be trusted.
+	ErrSignatureMismatch = fmt.Errorf("signature does not match")
+
+	// ErrManifestMismatch means that files extracted from
+	// an archive do not match the manifest in it, or are
+	// not listed in it, or that it has no manifest.
+	ErrManifestMismatch = fmt.Errorf("files do not match manifest")
+
+	// ErrInsufficientSpace means that there is not enough
+	// space where files are being extracted for them.
+	ErrInsufficientSpace = fmt.Errorf("insufficient disk space")
+)
+
+// PathError is an error about the file, entry or archive
+// at Path, which is one of the errors above (Err), so
+// errors.Is can check for that error and errors.As can
+// get the path.
+type PathError struct {
+	Path string
+	Err  error
+
+	msg string
+}
+
+// pathErrorf returns a *PathError about path, which is
+// err, with the message formatted from format and v.
+func pathErrorf(err error, path, format string, v ...interface{}) error {
+	return &PathError{Path: path, Err: err, msg: fmt.Sprintf(format, v...)}
+}
+
+// Error returns the message of e, or if it has none,
+// the message of its Err followed by its Path.
+func (e *PathError) Error() string {
+	if e.msg != "" {
+		return e.msg
+	}
+	return fmt.Sprintf("%v: %s", e.Err, e.Path)
+}
+
+// Unwrap returns e.Err.
+func (e *PathError) Unwrap() error { return e.Err }
+
+// Is reports whether e is target, besides its Err:
+// ErrDestinationExists is also os.ErrExist.
+func (e *PathError) Is(target error) bool {
+	return target == os.ErrExist && e.Err == ErrDestinationExists
+}
+
+// EntryError is an error about the entry named Name in
+// an archive, such as one being written or extracted.
+type EntryError struct {
+	Name string
+	Err  error
+}
+
+// entryErrorf returns an *EntryError about the entry
+// named name, wrapping the error formatted from format
+// and v.
+func entryErrorf(name, format string, v ...interface{}) error {
+	return &EntryError{Name: name, Err: fmt.Errorf(format, v...)}
+}
+
+// Error returns the name of the entry followed
+// by the message of e.Err.
+func (e *EntryError) Error() string { return fmt.Sprintf("%s: %v", e.Name, e.Err) }
+
+// Unwrap returns e.Err.
+func (e *EntryError) Unwrap() error { return e.Err }
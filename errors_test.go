@@ -0,0 +1,141 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestErrors(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	existing := filepath.Join(tmp, "existing.tar")
+	err = ioutil.WriteFile(existing, []byte("existing"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range []struct {
+		err      error
+		expected error
+		path     string
+	}{
+		{
+			err:      (&Tar{}).Archive([]string{"testdata"}, existing),
+			expected: ErrDestinationExists,
+			path:     existing,
+		},
+		{
+			err:      (&TarGz{Tar: &Tar{}}).Archive([]string{"testdata"}, filepath.Join(tmp, "test.zip")),
+			expected: ErrFormatMismatch,
+			path:     filepath.Join(tmp, "test.zip"),
+		},
+		{
+			err:      (&Gz{}).CheckExt("test.xz"),
+			expected: ErrFormatMismatch,
+			path:     "test.xz",
+		},
+		{
+			err: func() error {
+				_, err := ByExtension("test.unknown")
+				return err
+			}(),
+			expected: ErrUnsupportedType,
+			path:     "test.unknown",
+		},
+		{
+			err:      ArchiveFromFS(context.Background(), fstest.MapFS{}, "../outside", filepath.Join(tmp, "test.tar")),
+			expected: ErrIllegalPath,
+			path:     "../outside",
+		},
+	} {
+		if !errors.Is(tc.err, tc.expected) {
+			t.Errorf("test %d: expected error to be %v, got %v", i, tc.expected, tc.err)
+			continue
+		}
+		var pathErr *PathError
+		if !errors.As(tc.err, &pathErr) {
+			t.Errorf("test %d: expected a *PathError, got %T", i, tc.err)
+			continue
+		}
+		if pathErr.Path != tc.path {
+			t.Errorf("test %d: expected path %s, got %s", i, tc.path, pathErr.Path)
+		}
+	}
+
+	// the messages are the same as they were
+	err = (&Tar{}).Archive([]string{"testdata"}, existing)
+	if expected := "file already exists: " + existing; err.Error() != expected {
+		t.Errorf("expected message %q, got %q", expected, err.Error())
+	}
+}
+
+func TestErrorWrapping(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	archive := filepath.Join(tmp, "test.tar.gz")
+	err = (&TarGz{Tar: &Tar{}}).Archive([]string{"testdata/proverbs/proverb1.txt"}, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// archiving to an existing file
+	err = (&TarGz{Tar: &Tar{}}).Archive([]string{"testdata"}, archive)
+	if !errors.Is(err, os.ErrExist) {
+		t.Errorf("archiving to existing file: expected os.ErrExist, got %v", err)
+	}
+
+	// extracting over an existing file
+	dest := filepath.Join(tmp, "dest")
+	err = (&TarGz{Tar: &Tar{}}).Unarchive(archive, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&TarGz{Tar: &Tar{}}).Unarchive(archive, dest)
+	if !errors.Is(err, os.ErrExist) || !errors.Is(err, ErrDestinationExists) {
+		t.Errorf("extracting over existing file: expected os.ErrExist, got %v", err)
+	}
+	var entryErr *EntryError
+	if !errors.As(err, &entryErr) {
+		t.Errorf("extracting over existing file: expected an *EntryError, got %v", err)
+	} else if entryErr.Name != "testdata/proverbs/proverb1.txt" {
+		t.Errorf("extracting over existing file: expected entry name testdata/proverbs/proverb1.txt, got %s", entryErr.Name)
+	}
+
+	// extracting empty and truncated archives
+	empty := filepath.Join(tmp, "empty.tar.gz")
+	err = ioutil.WriteFile(empty, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&TarGz{Tar: &Tar{}}).Unarchive(empty, filepath.Join(tmp, "empty"))
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("extracting empty archive: expected io.EOF, got %v", err)
+	}
+	contents, err := ioutil.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(tmp, "truncated.tar.gz")
+	err = ioutil.WriteFile(truncated, contents[:len(contents)/2], 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&TarGz{Tar: &Tar{}}).Unarchive(truncated, filepath.Join(tmp, "truncated"))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("extracting truncated archive: expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -0,0 +1,410 @@
+package archiver
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileSystem is the set of filesystem operations used to
+// extract files from archives. Extracting to a FileSystem
+// other than the disk allows, for example, testing what
+// an archive would extract to without touching the disk.
+// Paths are in the form used by the os package.
+type FileSystem interface {
+	// Stat returns information about the file named
+	// name. Errors for which os.IsNotExist returns
+	// true must be returned for missing files.
+	Stat(name string) (os.FileInfo, error)
+
+	// MkdirAll makes the directory named path,
+	// along with any missing parents, like os.MkdirAll.
+	MkdirAll(path string, perm os.FileMode) error
+
+	// Create creates (or truncates) the file named
+	// name, and returns a writer of its contents.
+	Create(name string) (io.WriteCloser, error)
+
+	// Chmod changes the mode of the file named name.
+	Chmod(name string, mode os.FileMode) error
+
+	// Chtimes changes the access and modification
+	// times of the file named name.
+	Chtimes(name string, atime, mtime time.Time) error
+
+	// Symlink makes newname a symbolic link to oldname.
+	Symlink(oldname, newname string) error
+
+	// Link makes newname a hard link to oldname.
+	Link(oldname, newname string) error
+}
+
+// OSFileSystem is the FileSystem of the disk,
+// using the functions of the os package.
+type OSFileSystem struct{}
+
+// Stat calls os.Stat.
+func (OSFileSystem) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+// MkdirAll calls os.MkdirAll.
+func (OSFileSystem) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+
+// Create calls os.Create.
+func (OSFileSystem) Create(name string) (io.WriteCloser, error) { return os.Create(name) }
+
+// Chmod calls os.Chmod.
+func (OSFileSystem) Chmod(name string, mode os.FileMode) error { return os.Chmod(name, mode) }
+
+// Chtimes calls os.Chtimes.
+func (OSFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+// Symlink calls os.Symlink.
+func (OSFileSystem) Symlink(oldname, newname string) error { return os.Symlink(oldname, newname) }
+
+// Link calls os.Link.
+func (OSFileSystem) Link(oldname, newname string) error { return os.Link(oldname, newname) }
+
+// EvalSymlinks calls filepath.EvalSymlinks. FileSystems
+// which follow symbolic links when files are written
+// through them should have this method too, so that
+// links made while extracting can be checked not to
+// lead outside of the destination.
+func (OSFileSystem) EvalSymlinks(path string) (string, error) { return filepath.EvalSymlinks(path) }
+
+// MemFileSystem is a FileSystem kept in memory, for use in
+// tests. Symbolic links are recorded but never followed,
+// except by its FS, and hard links share their contents
+// and metadata. It is safe for concurrent use.
+type MemFileSystem struct {
+	clock Clock
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+// NewMemFileSystem returns an empty MemFileSystem whose
+// files get their modification times from clock, which
+// may be nil to use the system clock.
+func NewMemFileSystem(clock Clock) *MemFileSystem {
+	return &MemFileSystem{
+		clock: clockOrSystem(clock),
+		files: make(map[string]*memFile),
+	}
+}
+
+type memFile struct {
+	mode    os.FileMode
+	modTime time.Time
+	data    []byte
+	link    string // target, for symbolic links
+}
+
+// Stat returns information about the file named name.
+// For symbolic links, the link itself is described.
+func (m *MemFileSystem) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	f, ok := m.files[name]
+	if !ok {
+		if m.isRoot(name) {
+			return memFileInfo{name: name, file: memFile{mode: os.ModeDir | 0755}}, nil
+		}
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return memFileInfo{name: filepath.Base(name), file: *f}, nil
+}
+
+// MkdirAll makes the directory named path, along
+// with any missing parents.
+func (m *MemFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdirAll(filepath.Clean(path), perm)
+}
+
+func (m *MemFileSystem) mkdirAll(path string, perm os.FileMode) error {
+	if m.isRoot(path) {
+		return nil
+	}
+	if f, ok := m.files[path]; ok {
+		if f.mode.IsDir() {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: path, Err: os.ErrExist}
+	}
+	err := m.mkdirAll(filepath.Dir(path), perm)
+	if err != nil {
+		return err
+	}
+	m.files[path] = &memFile{mode: os.ModeDir | perm.Perm(), modTime: m.clock.Now()}
+	return nil
+}
+
+// Create creates (or truncates) the regular file
+// named name, whose directory must exist.
+func (m *MemFileSystem) Create(name string) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if err := m.checkParent("open", name); err != nil {
+		return nil, err
+	}
+	f, ok := m.files[name]
+	if ok && !f.mode.IsRegular() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	}
+	if !ok {
+		f = &memFile{mode: 0666}
+		m.files[name] = f
+	}
+	f.data = nil
+	f.modTime = m.clock.Now()
+	return &memFileWriter{fs: m, file: f}, nil
+}
+
+// Chmod changes the permission bits of
+// the file named name.
+func (m *MemFileSystem) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.lookup("chmod", name)
+	if err != nil {
+		return err
+	}
+	f.mode = f.mode&^os.ModePerm | mode.Perm()
+	return nil
+}
+
+// Chtimes changes the modification time of the file
+// named name. Access times are not recorded.
+func (m *MemFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.lookup("chtimes", name)
+	if err != nil {
+		return err
+	}
+	f.modTime = mtime
+	return nil
+}
+
+// Symlink makes newname a symbolic link to oldname.
+func (m *MemFileSystem) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	newname = filepath.Clean(newname)
+	if err := m.checkLinkable("symlink", oldname, newname); err != nil {
+		return err
+	}
+	m.files[newname] = &memFile{mode: os.ModeSymlink | 0777, modTime: m.clock.Now(), link: oldname}
+	return nil
+}
+
+// Link makes newname a hard link to the
+// (non-directory) file named oldname.
+func (m *MemFileSystem) Link(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	newname = filepath.Clean(newname)
+	if err := m.checkLinkable("link", oldname, newname); err != nil {
+		return err
+	}
+	f, ok := m.files[filepath.Clean(oldname)]
+	if !ok || f.mode.IsDir() {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	m.files[newname] = f
+	return nil
+}
+
+// ReadFile returns the contents of the file named name.
+func (m *MemFileSystem) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.lookup("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if f.mode.IsDir() {
+		return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrInvalid}
+	}
+	return append([]byte(nil), f.data...), nil
+}
+
+// Readlink returns the target of the
+// symbolic link named name.
+func (m *MemFileSystem) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.lookup("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	if f.mode&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrInvalid}
+	}
+	return f.link, nil
+}
+
+// Names returns the names of all the files,
+// directories and links, in lexical order.
+func (m *MemFileSystem) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FS returns a read-only fs.FS of the files in m relative
+// to the working directory ("."), in which symbolic links
+// are followed, except to files outside of it.
+func (m *MemFileSystem) FS() fs.FS { return memFS{m} }
+
+// memFS is the fs.FS of a MemFileSystem.
+type memFS struct{ m *MemFileSystem }
+
+// Open opens the file named name, which is
+// a slash-separated path, for reading.
+func (mfs memFS) Open(name string) (fs.File, error) {
+	m := mfs.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	resolved, err := resolvePath(name, func(name string) (string, bool, error) {
+		f, ok := m.files[filepath.FromSlash(name)]
+		switch {
+		case !ok:
+			return "", false, fs.ErrNotExist
+		case f.mode&os.ModeSymlink != 0:
+			return symlinkTarget(name, filepath.ToSlash(f.link))
+		}
+		return "", f.mode.IsDir(), nil
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	if resolved == "." {
+		info := memFileInfo{name: ".", file: memFile{mode: os.ModeDir | 0755}}
+		return &archiveFSDir{info: info, entries: m.dirEntries(".")}, nil
+	}
+	f := m.files[filepath.FromSlash(resolved)]
+	info := memFileInfo{name: path.Base(name), file: *f}
+	if f.mode.IsDir() {
+		return &archiveFSDir{info: info, entries: m.dirEntries(filepath.FromSlash(resolved))}, nil
+	}
+	return &archiveFSFile{info: info, Reader: bytes.NewReader(f.data)}, nil
+}
+
+// dirEntries returns the entries of the files in the
+// directory named dir, in order by name. m.mu must
+// be held.
+func (m *MemFileSystem) dirEntries(dir string) []fs.DirEntry {
+	var entries []fs.DirEntry
+	for name, f := range m.files {
+		if filepath.Dir(name) == dir {
+			entries = append(entries, fs.FileInfoToDirEntry(memFileInfo{name: filepath.Base(name), file: *f}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+// lookup returns the file named name, or an error
+// from op if it does not exist. m.mu must be held.
+func (m *MemFileSystem) lookup(op, name string) (*memFile, error) {
+	f, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return f, nil
+}
+
+// checkParent returns an error from op if the directory
+// of the file named name does not exist. m.mu must be held.
+func (m *MemFileSystem) checkParent(op, name string) error {
+	dir := filepath.Dir(name)
+	if m.isRoot(dir) {
+		return nil
+	}
+	if parent, ok := m.files[dir]; !ok || !parent.mode.IsDir() {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+// checkLinkable returns an error from op if newname
+// cannot be made as a link. m.mu must be held.
+func (m *MemFileSystem) checkLinkable(op, oldname, newname string) error {
+	if err := m.checkParent(op, newname); err != nil {
+		return &os.LinkError{Op: op, Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	if _, ok := m.files[newname]; ok {
+		return &os.LinkError{Op: op, Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	return nil
+}
+
+// isRoot returns true if name, which is
+// clean, is a root or working directory,
+// which always exist.
+func (m *MemFileSystem) isRoot(name string) bool {
+	return name == "." || filepath.Dir(name) == name
+}
+
+// memFileWriter writes the contents of a file
+// in a MemFileSystem.
+type memFileWriter struct {
+	fs   *MemFileSystem
+	file *memFile
+}
+
+func (w *memFileWriter) Write(p []byte) (int, error) {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+	w.file.data = append(w.file.data, p...)
+	return len(p), nil
+}
+
+func (w *memFileWriter) Close() error { return nil }
+
+// memFileInfo describes a file in a MemFileSystem.
+type memFileInfo struct {
+	name string
+	file memFile
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return int64(len(fi.file.data)) }
+func (fi memFileInfo) Mode() os.FileMode  { return fi.file.mode }
+func (fi memFileInfo) ModTime() time.Time { return fi.file.modTime }
+func (fi memFileInfo) IsDir() bool        { return fi.file.mode.IsDir() }
+func (fi memFileInfo) Sys() interface{}   { return nil }
+
+// fileSystemOrOS returns fsys, or the
+// disk if fsys is nil.
+func fileSystemOrOS(fsys FileSystem) FileSystem {
+	if fsys == nil {
+		return OSFileSystem{}
+	}
+	return fsys
+}
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = FileSystem(OSFileSystem{})
+	_ = FileSystem((*MemFileSystem)(nil))
+	_ = fs.FS(memFS{})
+	_ = os.FileInfo(memFileInfo{})
+)
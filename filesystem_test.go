@@ -0,0 +1,172 @@
+package archiver
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnarchiveToMemFileSystem(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	entries := []VirtualEntry{
+		{
+			Name: "virtual.txt",
+			Size: 5,
+			Open: func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader("hello")), nil
+			},
+		},
+	}
+
+	for _, format := range []interface {
+		Archiver
+		Walker
+	}{
+		&Tar{VirtualEntries: entries, Clock: NewFakeClock(now)},
+		&Zip{VirtualEntries: entries, Clock: NewFakeClock(now)},
+	} {
+		archive := filepath.Join(tmp, "fs."+fmt.Sprint(format))
+		err := format.Archive([]string{"testdata/quote1.txt"}, archive)
+		if err != nil {
+			t.Fatalf("[%s] archiving: %v", format, err)
+		}
+
+		err = format.Walk(archive, func(f File) error {
+			if f.Name() == "virtual.txt" && !f.ModTime().Equal(now) {
+				t.Errorf("[%s] expected virtual entry modified at %v, got %v", format, now, f.ModTime())
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("[%s] walking: %v", format, err)
+		}
+
+		fsys := NewMemFileSystem(NewFakeClock(now))
+		var unarchiver Unarchiver
+		switch v := format.(type) {
+		case *Tar:
+			unarchiver = &Tar{FileSystem: fsys, MkdirAll: true}
+		case *Zip:
+			unarchiver = &Zip{FileSystem: fsys, MkdirAll: true}
+		default:
+			t.Fatalf("unexpected format %T", v)
+		}
+		dest := filepath.Join(tmp, "not-on-disk")
+		err = unarchiver.Unarchive(archive, dest)
+		if err != nil {
+			t.Fatalf("[%s] unarchiving: %v", format, err)
+		}
+		if fileExists(dest) {
+			t.Errorf("[%s] expected nothing extracted to disk", format)
+		}
+
+		expected, err := ioutil.ReadFile("testdata/quote1.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, contents := range map[string]string{
+			"testdata/quote1.txt": string(expected),
+			"virtual.txt":         "hello",
+		} {
+			got, err := fsys.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+			if err != nil {
+				t.Errorf("[%s] reading %s: %v (files: %v)", format, name, err, fsys.Names())
+				continue
+			}
+			if string(got) != contents {
+				t.Errorf("[%s] expected %s to contain %q, got %q", format, name, contents, got)
+			}
+		}
+
+		// files are not overwritten unless asked to
+		err = unarchiver.Unarchive(archive, dest)
+		if err == nil {
+			t.Errorf("[%s] expected error extracting over existing files", format)
+		}
+	}
+}
+
+func TestMemFileSystem(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1e9, 0))
+	fsys := NewMemFileSystem(clock)
+
+	err := fsys.MkdirAll(filepath.Join("a", "b"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := fsys.Stat("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || info.Mode().Perm() != 0700 {
+		t.Errorf("expected directory with mode 0700, got %v", info.Mode())
+	}
+
+	_, err = fsys.Create(filepath.Join("missing", "file"))
+	if !os.IsNotExist(err) {
+		t.Errorf("expected not-exist error creating file in missing directory, got %v", err)
+	}
+
+	name := filepath.Join("a", "b", "file")
+	clock.Advance(time.Hour)
+	err = writeNewFileIn(fsys, name, strings.NewReader("contents"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = fsys.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 8 || info.Mode() != 0600 || !info.ModTime().Equal(time.Unix(1e9, 0).Add(time.Hour)) {
+		t.Errorf("unexpected file info: size=%d mode=%v modtime=%v", info.Size(), info.Mode(), info.ModTime())
+	}
+
+	err = fsys.Link(name, filepath.Join("a", "hard"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fsys.Chtimes(filepath.Join("a", "hard"), time.Time{}, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = fsys.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(time.Unix(0, 0)) {
+		t.Errorf("expected hard links to share modification time, got %v", info.ModTime())
+	}
+
+	err = fsys.Symlink("b/file", filepath.Join("a", "soft"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fsys.Symlink("b/file", filepath.Join("a", "soft"))
+	if !os.IsExist(err) {
+		t.Errorf("expected exist error making link over existing file, got %v", err)
+	}
+	target, err := fsys.Readlink(filepath.Join("a", "soft"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "b/file" {
+		t.Errorf("expected link target b/file, got %s", target)
+	}
+
+	expected := []string{"a", filepath.Join("a", "b"), name, filepath.Join("a", "hard"), filepath.Join("a", "soft")}
+	got := fsys.Names()
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected names %v, got %v", expected, got)
+	}
+}
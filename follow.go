@@ -0,0 +1,77 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// walkFiles walks the files at root as filepath.Walk does,
+// unless followSymlinks is true, in which case symbolic
+// links are followed: walkFn is called for the files they
+// link to, with the info of those files but the paths of
+// the links, and folders they link to are walked as if
+// they were in place of the links. Broken links are
+// walked as links, and links which would be walked
+// again within themselves are an error.
+func walkFiles(root string, followSymlinks bool, walkFn filepath.WalkFunc) error {
+	if !followSymlinks {
+		return filepath.Walk(root, walkFn)
+	}
+	return walkFollowing(root, root, nil, walkFn)
+}
+
+// walkFollowing walks the files at real, following
+// symbolic links, calling walkFn with their paths under
+// path instead. The real paths of the folders being
+// walked through links, which cannot be walked again,
+// are in linked.
+func walkFollowing(path, real string, linked map[string]bool, walkFn filepath.WalkFunc) error {
+	return filepath.Walk(real, func(fpath string, info os.FileInfo, err error) error {
+		if real != path {
+			rel, relErr := filepath.Rel(real, fpath)
+			if relErr != nil {
+				return relErr
+			}
+			fpath = filepath.Join(path, rel)
+		}
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return walkFn(fpath, info, err)
+		}
+
+		target, statErr := os.Stat(fpath)
+		if statErr != nil {
+			return walkFn(fpath, info, nil) // broken link
+		}
+		if !target.IsDir() {
+			return walkFn(fpath, target, nil)
+		}
+
+		targetReal, err := realPath(fpath)
+		if err != nil {
+			return walkFn(fpath, info, err)
+		}
+		dirReal, err := realPath(filepath.Dir(fpath))
+		if err != nil {
+			return walkFn(fpath, info, err)
+		}
+		if linked[targetReal] || within(targetReal, dirReal) {
+			return walkFn(fpath, info, fmt.Errorf("symbolic link loop"))
+		}
+		nowLinked := map[string]bool{targetReal: true}
+		for l := range linked {
+			nowLinked[l] = true
+		}
+		return walkFollowing(fpath, targetReal, nowLinked, walkFn)
+	})
+}
+
+// realPath returns the absolute path
+// of fpath, with no symbolic links.
+func realPath(fpath string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(fpath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
+}
@@ -0,0 +1,81 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFollowSymlinks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	err = os.MkdirAll(filepath.Join(src, "real"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "real", "file.txt"), []byte("contents"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("real", filepath.Join(src, "dirlink"))
+	if err != nil {
+		t.Skipf("cannot make symbolic links: %v", err)
+	}
+	err = os.Symlink(filepath.Join("real", "file.txt"), filepath.Join(src, "filelink"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []EntryInfo{
+		{Name: "src", Type: EntryDir},
+		{Name: "src/dirlink", Type: EntryDir},
+		{Name: "src/dirlink/file.txt", Type: EntryFile, Size: 8},
+		{Name: "src/filelink", Type: EntryFile, Size: 8},
+		{Name: "src/real", Type: EntryDir},
+		{Name: "src/real/file.txt", Type: EntryFile, Size: 8},
+	}
+	for _, format := range []interface {
+		Archiver
+		Lister
+	}{
+		&Tar{FollowSymlinks: true},
+		&Zip{FollowSymlinks: true},
+	} {
+		archive := filepath.Join(tmp, "test."+format.(interface{ String() string }).String())
+		err := format.Archive([]string{src}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := format.List(archive)
+		if err != nil {
+			t.Fatalf("[%s] listing: %v", archive, err)
+		}
+		var actual []EntryInfo
+		for _, e := range entries {
+			actual = append(actual, EntryInfo{Name: e.Name, Type: e.Type, Size: e.Size})
+			if e.Type == EntryDir {
+				actual[len(actual)-1].Size = 0
+			}
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("[%s] expected entries %v, got %v", archive, expected, actual)
+		}
+	}
+
+	// a link to a folder it is in is a loop
+	err = os.Symlink("..", filepath.Join(src, "real", "loop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&Tar{FollowSymlinks: true}).Archive([]string{src}, filepath.Join(tmp, "loop.tar"))
+	if err == nil {
+		t.Error("expected an error archiving a symbolic link loop")
+	}
+}
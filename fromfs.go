@@ -0,0 +1,139 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveFromFS creates an archive file at destination
+// containing the files in the folder named root in fsys,
+// such as an embed.FS or fstest.MapFS, without the files
+// having to be on disk. The format of the archive is
+// chosen by the extension of destination as by
+// ByExtension, and must be one which can be written, such
+// as zip or a (compressed) tarball. Like with Archive, the
+// files are put in a folder named after root unless root
+// is ".". Symbolic links are archived as the files they
+// link to, except for links to folders, which are left out.
+//
+// Archiving stops as soon as possible once ctx is
+// done, in which case ctx.Err() is returned.
+func ArchiveFromFS(ctx context.Context, fsys fs.FS, root, destination string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !fs.ValidPath(root) {
+		return pathErrorf(ErrIllegalPath, root, "invalid root folder: %s", root)
+	}
+	return createArchiveFile(ctx, destination, func(w Writer) error {
+		return writeFS(ctx, w, fsys, root)
+	})
+}
+
+// createArchiveFile creates an archive file at destination,
+// in the format chosen by its extension as by ByExtension,
+// whose files are written by write, which is given the
+// Writer of the format after it is created.
+func createArchiveFile(ctx context.Context, destination string, write func(w Writer) error) error {
+	format, err := ByExtension(destination)
+	if err != nil {
+		return err
+	}
+	w, ok := format.(Writer)
+	if !ok {
+		return pathErrorf(ErrUnsupportedType, destination, "format %s cannot be written", format)
+	}
+	if fileExists(destination) {
+		return &PathError{Path: destination, Err: ErrDestinationExists}
+	}
+
+	// make the folder to contain the resulting archive
+	// if it does not already exist
+	destDir := filepath.Dir(destination)
+	if !fileExists(destDir) {
+		err := mkdir(destDir)
+		if err != nil {
+			return fmt.Errorf("making folder for destination: %w", err)
+		}
+	}
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", destination, err)
+	}
+	defer out.Close()
+
+	return withContext(ctx, w, func(f interface{}) error {
+		w := f.(Writer)
+		err := w.Create(out)
+		if err != nil {
+			return fmt.Errorf("creating %s: %w", format, err)
+		}
+		err = write(w)
+		if err != nil {
+			w.Close()
+			return err
+		}
+		err = w.Close()
+		if err != nil {
+			return fmt.Errorf("closing %s: %w", format, err)
+		}
+		return nil
+	})
+}
+
+// writeFS writes the files in the folder named root in
+// fsys to w, named by their paths in the folder which
+// contains root.
+func writeFS(ctx context.Context, w Writer, fsys fs.FS, root string) error {
+	base := path.Dir(root)
+	return fs.WalkDir(fsys, root, func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := fpath
+		if base != "." {
+			name = strings.TrimPrefix(fpath, base+"/")
+		}
+		if name == "." {
+			return nil
+		}
+
+		if d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return fmt.Errorf("%s: getting info: %w", fpath, err)
+			}
+			return w.Write(File{
+				FileInfo:   FileInfo{FileInfo: info, CustomName: name},
+				ReadCloser: ReadFakeCloser{eofReader{}},
+			})
+		}
+
+		// opening the file follows symbolic links
+		file, err := fsys.Open(fpath)
+		if err != nil {
+			return fmt.Errorf("%s: opening: %w", fpath, err)
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("%s: getting info: %w", fpath, err)
+		}
+		if info.IsDir() {
+			return nil // link to a folder
+		}
+		return w.Write(File{
+			FileInfo:   FileInfo{FileInfo: info, CustomName: name},
+			ReadCloser: file,
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package archiver
+
+import (
+	"context"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestArchiveFromFS(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	fsys := fstest.MapFS{
+		"static/index.html":     {Data: []byte("<h1>hello</h1>"), Mode: 0644},
+		"static/css/style.css":  {Data: []byte("h1 { color: red; }"), Mode: 0644},
+		"static/empty":          {Mode: fs.ModeDir | 0755},
+		"templates/page.tmpl":   {Data: []byte("{{.}}"), Mode: 0644},
+		"templates/README.text": {Data: []byte("not archived"), Mode: 0644},
+	}
+
+	for i, tc := range []struct {
+		root, archive string
+		expect        []string
+		missing       string // path which must not be archived
+	}{
+		{
+			root:    "static",
+			archive: "static.zip",
+			expect:  []string{"static/index.html", "static/css/style.css", "static/empty"},
+			missing: "templates",
+		},
+		{
+			root:    "static/css",
+			archive: "css.tar.gz",
+			expect:  []string{"css/style.css"},
+			missing: "static",
+		},
+		{
+			root:    ".",
+			archive: "all.tar",
+			expect:  []string{"static/index.html", "templates/page.tmpl"},
+		},
+	} {
+		archive := filepath.Join(tmp, tc.archive)
+		err := ArchiveFromFS(context.Background(), fsys, tc.root, archive)
+		if err != nil {
+			t.Fatalf("Test %d: archiving: %v", i, err)
+		}
+
+		afs, err := NewArchiveFS(archive, nil)
+		if err != nil {
+			t.Fatalf("Test %d: opening archive: %v", i, err)
+		}
+		err = fstest.TestFS(afs, tc.expect...)
+		if err != nil {
+			t.Errorf("Test %d: %v", i, err)
+		}
+		if _, err := fs.Stat(afs, tc.missing); tc.missing != "" && err == nil {
+			t.Errorf("Test %d: expected %s not to be archived", i, tc.missing)
+		}
+		afs.Close()
+	}
+
+	// the destination cannot be overwritten, nor be
+	// a format which cannot be written
+	err = ArchiveFromFS(context.Background(), fsys, "static", filepath.Join(tmp, "static.zip"))
+	if err == nil {
+		t.Error("expected error overwriting archive, but got none")
+	}
+	err = ArchiveFromFS(context.Background(), fsys, "static", filepath.Join(tmp, "static.rar"))
+	if err == nil {
+		t.Error("expected error archiving as rar, but got none")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = ArchiveFromFS(ctx, fsys, "static", filepath.Join(tmp, "canceled.zip"))
+	if err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,135 @@
+package archiver
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// GlobExtractor can extract the entries of an archive
+// file whose names match a pattern.
+type GlobExtractor interface {
+	ExtractGlob(source, pattern, destination string) error
+}
+
+// globPattern is a pattern which matches the
+// slash-separated paths of entries in archives,
+// split into its path elements.
+type globPattern []string
+
+// newGlobPattern parses pattern, which is like the
+// patterns of path.Match, except that an element of
+// "**" matches any number of path elements, including
+// none; "**/*.proto" matches "a.proto" and "a/b/c.proto".
+// Leading slashes and dots are ignored, as for the
+// paths of entries.
+func newGlobPattern(pattern string) (globPattern, error) {
+	elems := strings.Split(cleanEntryPath(pattern), "/")
+	for _, elem := range elems {
+		if _, err := path.Match(elem, ""); err != nil {
+			return nil, fmt.Errorf("%s: %w", pattern, err)
+		}
+	}
+	return globPattern(elems), nil
+}
+
+// match returns true if the path of
+// the entry named name matches gp.
+func (gp globPattern) match(name string) bool {
+	return matchGlobElems(gp, strings.Split(cleanEntryPath(name), "/"))
+}
+
+// matchGlobElems returns true if the path
+// elements of name match those of pattern.
+func matchGlobElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// excludePatterns are gitignore-style patterns of
+// the paths of files to leave out of archives, or
+// of entries of archives not to extract.
+type excludePatterns []excludePattern
+
+type excludePattern struct {
+	glob    globPattern
+	dirOnly bool
+}
+
+// newExcludePatterns parses patterns, which are like
+// the patterns of .gitignore files: a pattern with no
+// slash other than at its end, such as "*.o", matches
+// files of that name in any folder; other patterns are
+// relative to the root of the archive, in which "**"
+// matches any number of path elements. A pattern which
+// ends with a slash only matches folders. The contents
+// of folders which match are matched too.
+func newExcludePatterns(patterns []string) (excludePatterns, error) {
+	var ep excludePatterns
+	for _, pattern := range patterns {
+		p, err := newExcludePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		ep = append(ep, p)
+	}
+	return ep, nil
+}
+
+// newExcludePattern parses pattern, which is
+// one of the patterns of newExcludePatterns.
+func newExcludePattern(pattern string) (excludePattern, error) {
+	trimmed := strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(trimmed, "/") {
+		trimmed = "**/" + trimmed
+	}
+	glob, err := newGlobPattern(trimmed)
+	if err != nil {
+		return excludePattern{}, fmt.Errorf("bad exclude pattern %w", err)
+	}
+	return excludePattern{
+		glob:    glob,
+		dirOnly: strings.HasSuffix(pattern, "/"),
+	}, nil
+}
+
+// match returns true if the file named name, which is
+// a folder if isDir is true, or any folder it is in,
+// matches any of ep.
+func (ep excludePatterns) match(name string, isDir bool) bool {
+	if len(ep) == 0 {
+		return false
+	}
+	elems := strings.Split(cleanEntryPath(name), "/")
+	for i := range elems {
+		dir := isDir || i < len(elems)-1
+		for _, p := range ep {
+			if p.match(elems[:i+1], dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// match returns true if the path elements of a file,
+// which is a folder if isDir is true, match p.
+func (p excludePattern) match(elems []string, isDir bool) bool {
+	return (isDir || !p.dirOnly) && matchGlobElems(p.glob, elems)
+}
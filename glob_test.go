@@ -0,0 +1,172 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestGlobPattern(t *testing.T) {
+	for i, tc := range []struct {
+		pattern, name string
+		expect        bool
+	}{
+		{"**/*.proto", "a.proto", true},
+		{"**/*.proto", "a/b/c.proto", true},
+		{"**/*.proto", "a/b/c.go", false},
+		{"a/**", "a", true},
+		{"a/**", "a/b/c", true},
+		{"a/**", "b/c", false},
+		{"a/**/c", "a/c", true},
+		{"a/**/c", "a/b/b/c", true},
+		{"a/**/c", "a/b/d", false},
+		{"a/*", "a/b", true},
+		{"a/*", "a/b/c", false},
+		{"/a/?.txt", "a/b.txt", true},
+		{"a/[bc].txt", "./a/c.txt", true},
+		{"a/[bc].txt", "a/d.txt", false},
+		{"a/b/", "a/b/", true},
+	} {
+		gp, err := newGlobPattern(tc.pattern)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if actual := gp.match(tc.name); actual != tc.expect {
+			t.Errorf("test %d: expected %s matching %s to be %t, got %t", i, tc.pattern, tc.name, tc.expect, actual)
+		}
+	}
+
+	_, err := newGlobPattern("a/[b")
+	if err == nil {
+		t.Error("expected an error for a bad pattern")
+	}
+}
+
+func TestExtractGlob(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, format := range []interface {
+		Archiver
+		GlobExtractor
+	}{
+		&Tar{},
+		&TarGz{Tar: &Tar{}},
+		&Zip{},
+	} {
+		archive := filepath.Join(tmp, "test."+format.(interface{ String() string }).String())
+		err := format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dest := filepath.Join(tmp, "out")
+		err = format.ExtractGlob(archive, "**/proverb[12].txt", dest)
+		if err != nil {
+			t.Fatalf("[%s] extracting: %v", archive, err)
+		}
+
+		var extracted []string
+		filepath.Walk(dest, func(fpath string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				rel, _ := filepath.Rel(dest, fpath)
+				extracted = append(extracted, filepath.ToSlash(rel))
+			}
+			return err
+		})
+		sort.Strings(extracted)
+		expected := []string{"testdata/proverbs/proverb1.txt", "testdata/proverbs/proverb2.txt"}
+		if !reflect.DeepEqual(extracted, expected) {
+			t.Errorf("[%s] expected to extract %v, got %v", archive, expected, extracted)
+		}
+		os.RemoveAll(dest)
+	}
+}
+
+func TestExcludePatterns(t *testing.T) {
+	for i, tc := range []struct {
+		pattern, name string
+		isDir         bool
+		expect        bool
+	}{
+		{"*.o", "main.o", false, true},
+		{"*.o", "a/b/main.o", false, true},
+		{"*.o", "a/main.go", false, false},
+		{"node_modules", "node_modules", true, true},
+		{"node_modules", "a/node_modules/b/c.js", false, true},
+		{".git/", ".git", true, true},
+		{".git/", ".git/config", false, true},
+		{".git/", "a/.git", false, false},
+		{"/build", "build/out", false, true},
+		{"/build", "a/build/out", false, false},
+		{"src/**/testdata", "src/a/b/testdata/x.txt", false, true},
+		{"src/**/testdata", "lib/testdata/x.txt", false, false},
+	} {
+		ep, err := newExcludePatterns([]string{tc.pattern})
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if actual := ep.match(tc.name, tc.isDir); actual != tc.expect {
+			t.Errorf("test %d: expected %s matching %s to be %t, got %t", i, tc.pattern, tc.name, tc.expect, actual)
+		}
+	}
+}
+
+func TestExclude(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	extracted := func(dest string) []string {
+		var files []string
+		filepath.Walk(dest, func(fpath string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				rel, _ := filepath.Rel(dest, fpath)
+				files = append(files, filepath.ToSlash(rel))
+			}
+			return err
+		})
+		sort.Strings(files)
+		return files
+	}
+
+	for _, tc := range []struct {
+		archiving, extracting interface {
+			Archiver
+			Unarchiver
+		}
+		name string
+	}{
+		{&Tar{ExcludePatterns: []string{"*.jpg", "extra/"}}, &Tar{}, "archiving.tar"},
+		{&Zip{ExcludePatterns: []string{"*.jpg", "extra/"}}, &Zip{}, "archiving.zip"},
+		{&Tar{}, &Tar{ExcludePatterns: []string{"*.jpg", "extra/"}}, "extracting.tar"},
+		{&Zip{}, &Zip{ExcludePatterns: []string{"*.jpg", "extra/"}}, "extracting.zip"},
+	} {
+		archive := filepath.Join(tmp, tc.name)
+		err := tc.archiving.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest := filepath.Join(tmp, "out-"+tc.name)
+		err = tc.extracting.Unarchive(archive, dest)
+		if err != nil {
+			t.Fatalf("[%s] extracting: %v", tc.name, err)
+		}
+		expected := []string{
+			"testdata/proverbs/proverb1.txt",
+			"testdata/proverbs/proverb2.txt",
+			"testdata/quote1.txt",
+		}
+		if actual := extracted(dest); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("[%s] expected to extract %v, got %v", tc.name, expected, actual)
+		}
+	}
+}
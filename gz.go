@@ -1,35 +1,38 @@
 package archiver
 
 import (
-	"compress/gzip"
-	"fmt"
 	"io"
 	"path/filepath"
 )
 
-// Gz facilitates gzip compression.
+// Gz facilitates gzip compression. Decompress
+// reads all the members of multistream files.
 type Gz struct {
 	CompressionLevel int
 }
 
 // Compress reads in, compresses it, and writes it to out.
 func (gz *Gz) Compress(in io.Reader, out io.Writer) error {
-	w, err := gzip.NewWriterLevel(out, gz.CompressionLevel)
+	w, err := getGzipWriter(out, gz.CompressionLevel)
 	if err != nil {
 		return err
 	}
-	defer w.Close()
+	defer putGzipWriter(w, gz.CompressionLevel)
 	_, err = io.Copy(w, in)
-	return err
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
 }
 
 // Decompress reads in, decompresses it, and writes it to out.
 func (gz *Gz) Decompress(in io.Reader, out io.Writer) error {
-	r, err := gzip.NewReader(in)
+	r, err := getGzipReader(in)
 	if err != nil {
 		return err
 	}
-	defer r.Close()
+	defer putGzipReader(r)
 	_, err = io.Copy(out, r)
 	return err
 }
@@ -37,7 +40,7 @@ func (gz *Gz) Decompress(in io.Reader, out io.Writer) error {
 // CheckExt ensures the file extension matches the format.
 func (gz *Gz) CheckExt(filename string) error {
 	if filepath.Ext(filename) != ".gz" {
-		return fmt.Errorf("filename must have a .gz extension")
+		return pathErrorf(ErrFormatMismatch, filename, "filename must have a .gz extension")
 	}
 	return nil
 }
@@ -0,0 +1,83 @@
+package archiver
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"sync"
+)
+
+// HashAlgorithm names an algorithm used to compute the
+// digests of archives and the files in them.
+type HashAlgorithm string
+
+// Hash algorithms.
+const (
+	SHA256 HashAlgorithm = "sha256"
+	CRC32  HashAlgorithm = "crc32"  // IEEE, as used by zip and gzip
+	CRC32C HashAlgorithm = "crc32c" // Castagnoli
+)
+
+// RegisterHash sets the function which makes the hashes
+// of algorithm to newHash, so that an implementation
+// other than the default one can be plugged in, such as
+// one which uses SIMD instructions on platforms where the
+// standard library does not. The hashes which newHash
+// makes must compute the same sums as the default ones.
+// If newHash is nil, the default implementation is used
+// again.
+//
+// By default, the implementations of the standard library
+// are used; they use the instructions made for these
+// algorithms where available, such as SHA-NI and SSE 4.2
+// on amd64 and the SHA2 and CRC32 extensions on arm64.
+func RegisterHash(algorithm HashAlgorithm, newHash func() hash.Hash) {
+	hashes.Lock()
+	defer hashes.Unlock()
+	if newHash == nil {
+		delete(hashes.m, algorithm)
+		return
+	}
+	hashes.m[algorithm] = newHash
+}
+
+// NewHash returns a new hash of algorithm, using
+// the implementation registered with RegisterHash
+// if there is one.
+func NewHash(algorithm HashAlgorithm) (hash.Hash, error) {
+	hashes.RLock()
+	newHash, ok := hashes.m[algorithm]
+	hashes.RUnlock()
+	if ok {
+		return newHash(), nil
+	}
+	switch algorithm {
+	case SHA256:
+		return sha256.New(), nil
+	case CRC32:
+		return crc32.NewIEEE(), nil
+	case CRC32C:
+		return crc32.New(crc32cTable), nil
+	}
+	return nil, fmt.Errorf("unknown hash algorithm: %s", algorithm)
+}
+
+// newHash is like NewHash, for algorithms
+// which are known to exist.
+func newHash(algorithm HashAlgorithm) hash.Hash {
+	h, err := NewHash(algorithm)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// hashes are the implementations registered
+// with RegisterHash.
+var hashes = struct {
+	sync.RWMutex
+	m map[HashAlgorithm]func() hash.Hash
+}{m: make(map[HashAlgorithm]func() hash.Hash)}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
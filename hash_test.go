@@ -0,0 +1,78 @@
+package archiver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNewHash(t *testing.T) {
+	for i, tc := range []struct {
+		algorithm HashAlgorithm
+		expect    string
+		shouldErr bool
+	}{
+		{algorithm: SHA256, expect: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{algorithm: CRC32, expect: "3610a686"},
+		{algorithm: CRC32C, expect: "9a71bb4c"},
+		{algorithm: "md4", shouldErr: true},
+	} {
+		h, err := NewHash(tc.algorithm)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error for %s, but got none", i, tc.algorithm)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		h.Write([]byte("hello"))
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != tc.expect {
+			t.Errorf("Test %d: expected %s sum %s, got %s", i, tc.algorithm, tc.expect, sum)
+		}
+	}
+}
+
+func TestRegisterHash(t *testing.T) {
+	var made int
+	RegisterHash(SHA256, func() hash.Hash {
+		made++
+		return sha256.New()
+	})
+	defer RegisterHash(SHA256, nil)
+
+	// uncompressed layers have a single digest
+	l := &OCILayer{Uncompressed: true}
+	_, err := l.Build("testdata", ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if made != 1 {
+		t.Errorf("expected registered hash to be used once, but it was used %d times", made)
+	}
+
+	RegisterHash(SHA256, nil)
+	_, err = l.Build("testdata", ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if made != 1 {
+		t.Errorf("expected default hash to be used once unregistered, but registered one was used")
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	data := make([]byte, 1<<20)
+	for _, algorithm := range []HashAlgorithm{SHA256, CRC32, CRC32C} {
+		b.Run(string(algorithm), func(b *testing.B) {
+			h := newHash(algorithm)
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				h.Write(data)
+			}
+		})
+	}
+}
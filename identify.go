@@ -0,0 +1,271 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DetectFormat identifies the format of the archive or
+// compressed stream read from in by the signature (magic
+// bytes) at its beginning, rather than by a file name
+// extension. For compressed streams, the beginning of the
+// decompressed data is checked too, so that compressed
+// tarballs are told apart from other compressed files.
+// The name of the format is returned as given by the
+// String method of its type, such as "zip", "tar.gz" or
+// "gz", along with a reader which reads in from the
+// beginning, including what was read to identify it.
+// Formats which are recognized but not supported by this
+// package, such as "7z", are also named.
+func DetectFormat(in io.Reader) (string, io.Reader, error) {
+	br := bufio.NewReaderSize(in, detectSize)
+	head, err := br.Peek(detectSize)
+	if err != nil && err != io.EOF {
+		return "", br, fmt.Errorf("reading beginning of stream: %w", err)
+	}
+
+	for _, sig := range archiveSignatures {
+		if bytes.HasPrefix(head, sig.magic) {
+			return sig.format, br, nil
+		}
+	}
+
+	for _, sig := range compressionSignatures {
+		if !bytes.HasPrefix(head, sig.magic) {
+			continue
+		}
+		// errors are expected, since only the beginning
+		// of the stream is decompressed
+		inner := &headWriter{buf: make([]byte, 0, tarBlockSize)}
+		sig.decompressor.Decompress(bytes.NewReader(head), inner)
+		switch {
+		case isTarHeader(inner.buf):
+			return "tar." + sig.format, br, nil
+		case sig.format == "gz" && bytes.HasPrefix(inner.buf, []byte(warcMagic)):
+			return "warc", br, nil
+		}
+		return sig.format, br, nil
+	}
+
+	if isTarHeader(head) {
+		return "tar", br, nil
+	}
+	return "", br, pathErrorf(ErrUnsupportedType, "", "format not recognized")
+}
+
+// Identify is like DetectFormat, but returns a value of the
+// type of the format, such as *TarGz or *Gz, with the same
+// settings as the default value of the type (for example,
+// DefaultTarGz). Archive formats implement Unarchiver and
+// Walker; most also implement Reader, whose Open method
+// can read the returned stream (but note that Zip needs
+// an io.ReaderAt, and is a ReaderAtOpener). Compression
+// formats implement Decompressor.
+func Identify(in io.Reader) (interface{}, io.Reader, error) {
+	name, r, err := DetectFormat(in)
+	if err != nil {
+		return nil, r, err
+	}
+	format := newFormat(name)
+	if format == nil {
+		return nil, r, pathErrorf(ErrUnsupportedType, name, "%s: format not supported", name)
+	}
+	return format, r, nil
+}
+
+// ByExtension returns a new value of the type of the format
+// indicated by the extension of filename, such as *TarGz
+// for "backup.tar.gz" or "backup.tgz", with the same
+// settings as the default value of the type (for example,
+// DefaultTarGz). Extensions are not case-sensitive, and
+// formats based on zip, such as .jar and .docx, are Zip.
+// Archive formats implement Unarchiver and Walker, and
+// those which can be written implement Archiver too;
+// compression formats implement Compressor and
+// Decompressor.
+func ByExtension(filename string) (interface{}, error) {
+	lower := strings.ToLower(filename)
+	for _, fe := range formatExtensions {
+		if strings.HasSuffix(lower, fe.ext) {
+			return newFormat(fe.format), nil
+		}
+	}
+	return nil, pathErrorf(ErrUnsupportedType, filename, "%s: format not recognized by extension", filename)
+}
+
+// formatExtensions are the file extensions of formats,
+// in order such that extensions which end with others
+// (such as .tar.gz and .gz) come first.
+var formatExtensions = []struct {
+	ext, format string
+}{
+	{".tar.bz2", "tar.bz2"},
+	{".tbz2", "tar.bz2"},
+	{".tar.gz", "tar.gz"},
+	{".tgz", "tar.gz"},
+	{".tar.lz4", "tar.lz4"},
+	{".tlz4", "tar.lz4"},
+	{".tar.lzma", "tar.lzma"},
+	{".tlz", "tar.lzma"},
+	{".tar.sz", "tar.sz"},
+	{".tsz", "tar.sz"},
+	{".tar.xz", "tar.xz"},
+	{".txz", "tar.xz"},
+	{".tar.zst", "tar.zst"},
+	{".tzst", "tar.zst"},
+	{".warc.gz", "warc"},
+	{".tar", "tar"},
+	{".zip", "zip"},
+	{".apk", "zip"},
+	{".docx", "zip"},
+	{".epub", "zip"},
+	{".jar", "zip"},
+	{".odt", "zip"},
+	{".pptx", "zip"},
+	{".war", "zip"},
+	{".xlsx", "zip"},
+	{".rar", "rar"},
+	{".cab", "cab"},
+	{".deb", "deb"},
+	{".rpm", "rpm"},
+	{".warc", "warc"},
+	{".wim", "wim"},
+	{".bz2", "bz2"},
+	{".gz", "gz"},
+	{".lz4", "lz4"},
+	{".sz", "sz"},
+	{".xz", "xz"},
+	{".zst", "zst"},
+}
+
+// newFormat returns a new value of the type of
+// the format named name, or nil if it is not
+// supported.
+func newFormat(name string) interface{} {
+	newTar := func() *Tar { return &Tar{MkdirAll: true} }
+	switch name {
+	case "tar":
+		return newTar()
+	case "tar.bz2":
+		return &TarBz2{CompressionLevel: bzip2.DefaultCompression, Tar: newTar()}
+	case "tar.gz":
+		return &TarGz{CompressionLevel: gzip.DefaultCompression, Tar: newTar()}
+	case "tar.lz4":
+		return &TarLz4{CompressionLevel: DefaultTarLz4.CompressionLevel, Tar: newTar()}
+	case "tar.lzma":
+		return &TarLzma{Tar: newTar()}
+	case "tar.sz":
+		return &TarSz{Tar: newTar()}
+	case "tar.xz":
+		return &TarXz{Tar: newTar()}
+	case "tar.zst":
+		return &TarZst{EncoderLevel: zstd.SpeedDefault, Tar: newTar()}
+	case "zip":
+		return &Zip{CompressionLevel: flate.DefaultCompression, MkdirAll: true, SelectiveCompression: true}
+	case "rar":
+		return &Rar{MkdirAll: true}
+	case "cab":
+		return &Cab{MkdirAll: true}
+	case "deb":
+		return &Deb{MkdirAll: true, SymlinkPolicy: SymlinkReroot}
+	case "rpm":
+		return &Rpm{MkdirAll: true, SymlinkPolicy: SymlinkReroot}
+	case "warc":
+		return &Warc{MkdirAll: true}
+	case "wim":
+		return &Wim{MkdirAll: true}
+	case "bz2":
+		return &Bz2{CompressionLevel: bzip2.DefaultCompression}
+	case "gz":
+		return &Gz{CompressionLevel: gzip.DefaultCompression}
+	case "lz4":
+		return &Lz4{CompressionLevel: DefaultTarLz4.CompressionLevel}
+	case "sz":
+		return &Snappy{}
+	case "xz":
+		return &Xz{}
+	case "zst":
+		return &Zstd{EncoderLevel: zstd.SpeedDefault}
+	}
+	return nil
+}
+
+// isTarHeader returns true if buf begins with a
+// tar header, including those of V7 tarballs.
+func isTarHeader(buf []byte) bool {
+	if len(buf) < tarBlockSize {
+		return false
+	}
+	header := append([]byte(nil), buf[:tarBlockSize]...)
+	if isV7Header(header) && len(bytes.Trim(header[148:156], " \x00")) > 0 {
+		fixV7Checksum(header)
+	}
+	return hasTarHeader(header)
+}
+
+// headWriter keeps the first cap(buf) bytes written
+// to it, and fails once it has them.
+type headWriter struct {
+	buf []byte
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	room := cap(w.buf) - len(w.buf)
+	if len(p) > room {
+		w.buf = append(w.buf, p[:room]...)
+		return room, io.ErrShortWrite
+	}
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+type formatSignature struct {
+	format string
+	magic  []byte
+}
+
+// archiveSignatures are the signatures of archive
+// formats, which are checked first. Tarballs, which
+// have no signature in the first bytes, are identified
+// by the checksum of their first header instead.
+var archiveSignatures = []formatSignature{
+	{"zip", []byte("PK\x03\x04")},
+	{"zip", []byte("PK\x05\x06")}, // empty archive
+	{"rar", []byte("Rar!\x1a\x07\x00")},
+	{"rar", []byte("Rar!\x1a\x07\x01\x00")},
+	{"7z", []byte("7z\xbc\xaf\x27\x1c")},
+	{"cab", []byte(cabMagic)},
+	{"deb", []byte(arMagic + "debian-binary")},
+	{"rpm", rpmLeadMagic},
+	{"warc", []byte(warcMagic)},
+	{"wim", []byte(wimMagic)},
+}
+
+// compressionSignatures are the signatures of
+// compression formats, along with decompressors
+// used to check what they contain.
+var compressionSignatures = []struct {
+	formatSignature
+	decompressor Decompressor
+}{
+	{formatSignature{"gz", []byte{0x1f, 0x8b}}, &Gz{}},
+	{formatSignature{"bz2", []byte("BZh")}, &Bz2{}},
+	{formatSignature{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}}, &Xz{}},
+	{formatSignature{"zst", []byte{0x28, 0xb5, 0x2f, 0xfd}}, &Zstd{}},
+	{formatSignature{"lz4", []byte{0x04, 0x22, 0x4d, 0x18}}, &Lz4{}},
+	{formatSignature{"sz", []byte("\xff\x06\x00\x00sNaPpY")}, &Snappy{}},
+}
+
+// detectSize is how much of a stream is read to identify
+// its format; it is enough for a compressed stream to
+// hold the beginning of the data (a bzip2 block can
+// be as big as 900 KB).
+const detectSize = 1 << 20
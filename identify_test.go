@@ -0,0 +1,163 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// the default formats share a Tar, which keeps the
+	// compression of the last format used, so new values
+	// are used
+	for _, format := range []archiverUnarchiver{
+		&Zip{},
+		&Tar{},
+		&TarBz2{Tar: &Tar{}},
+		&TarGz{Tar: &Tar{}},
+		&TarLz4{Tar: &Tar{}},
+		&TarLzma{Tar: &Tar{}},
+		&TarSz{Tar: &Tar{}},
+		&TarXz{Tar: &Tar{}},
+		&TarZst{Tar: &Tar{}},
+	} {
+		name := fmt.Sprint(format)
+		archive := filepath.Join(tmp, "detect."+name)
+		err := format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatalf("[%s] archiving: %v", name, err)
+		}
+
+		// lzma streams have no signature
+		expected := name
+		if name == "tar.lzma" {
+			expected = ""
+		}
+		checkDetectFormat(t, archive, expected)
+	}
+
+	// compressed files which are not tarballs
+	input, err := ioutil.ReadFile("testdata/quote1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []interface {
+		Compressor
+		fmt.Stringer
+	}{&Bz2{}, &Gz{}, &Lz4{}, &Snappy{}, &Xz{}, &Zstd{}} {
+		compressed := filepath.Join(tmp, "quote1.txt."+c.String())
+		out := new(bytes.Buffer)
+		err := c.Compress(bytes.NewReader(input), out)
+		if err != nil {
+			t.Fatalf("[%s] compressing: %v", c, err)
+		}
+		err = ioutil.WriteFile(compressed, out.Bytes(), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkDetectFormat(t, compressed, c.String())
+	}
+
+	checkDetectFormat(t, "testdata/quote1.txt", "")
+
+	_, _, err = Identify(strings.NewReader("7z\xbc\xaf\x27\x1c\x00\x04"))
+	if err == nil {
+		t.Errorf("expected error identifying unsupported format")
+	}
+}
+
+// checkDetectFormat checks that the format of file is
+// detected as expected, which is "" for no format, and
+// that the whole file can be read afterwards.
+func checkDetectFormat(t *testing.T, file, expected string) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, r, err := DetectFormat(bytes.NewReader(contents))
+	if expected == "" {
+		if err == nil {
+			t.Errorf("%s: expected error, but detected %s", file, name)
+		}
+	} else if err != nil {
+		t.Errorf("%s: detecting format: %v", file, err)
+	} else if name != expected {
+		t.Errorf("%s: expected format %s, got %s", file, expected, name)
+	}
+
+	reread, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s: reading after detection: %v", file, err)
+	}
+	if !bytes.Equal(reread, contents) {
+		t.Errorf("%s: expected to read %d bytes after detection, got %d", file, len(contents), len(reread))
+	}
+
+	if expected == "" {
+		return
+	}
+	format, _, err := Identify(bytes.NewReader(contents))
+	if err != nil {
+		t.Fatalf("%s: identifying format: %v", file, err)
+	}
+	if fmt.Sprint(format) != expected {
+		t.Errorf("%s: expected format %s, got %s (%T)", file, expected, format, format)
+	}
+}
+
+func TestByExtension(t *testing.T) {
+	for _, test := range []struct {
+		filename string
+		expected string // String of the format, or "" for error
+	}{
+		{"a.tar", "tar"},
+		{"a.tar.gz", "tar.gz"},
+		{"a.TGZ", "tar.gz"},
+		{"dir/a.tar.bz2", "tar.bz2"},
+		{"a.tbz2", "tar.bz2"},
+		{"a.tlz4", "tar.lz4"},
+		{"a.tlz", "tar.lzma"},
+		{"a.tar.zst", "tar.zst"},
+		{"a.zip", "zip"},
+		{"a.docx", "zip"},
+		{"a.warc.gz", "warc"},
+		{"a.gz", "gz"},
+		{"a.zst", "zst"},
+		{"a.rar", "rar"},
+		{"a.txt", ""},
+		{"tar", ""},
+	} {
+		format, err := ByExtension(test.filename)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("%s: expected error, got %v", test.filename, format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.filename, err)
+			continue
+		}
+		if got := fmt.Sprint(format); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.filename, test.expected, got)
+		}
+	}
+
+	// every call returns a new value
+	a, _ := ByExtension("a.tar.gz")
+	b, _ := ByExtension("b.tar.gz")
+	if a.(*TarGz).Tar == b.(*TarGz).Tar {
+		t.Errorf("expected formats not to share a Tar")
+	}
+}
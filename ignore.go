@@ -0,0 +1,107 @@
+package archiver
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFiles are the patterns of the ignore files, such
+// as .gitignore files, in the folders being archived.
+type ignoreFiles struct {
+	name string
+	dirs map[string][]ignorePattern // folder -> patterns of its ignore file
+}
+
+// ignorePattern is a pattern of an ignore file, which
+// includes files again if negated.
+type ignorePattern struct {
+	excludePattern
+	negate bool
+}
+
+// newIgnoreFiles returns ignoreFiles for ignore
+// files named name, or nil if name is empty.
+func newIgnoreFiles(name string) *ignoreFiles {
+	if name == "" {
+		return nil
+	}
+	return &ignoreFiles{name: name, dirs: make(map[string][]ignorePattern)}
+}
+
+// load reads the ignore file in the folder dir,
+// if there is one.
+func (ig *ignoreFiles) load(dir string) error {
+	file, err := os.Open(filepath.Join(dir, ig.name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening ignore file: %w", err)
+	}
+	defer file.Close()
+
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var p ignorePattern
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+		p.excludePattern, err = newExcludePattern(line)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		patterns = append(patterns, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", file.Name(), err)
+	}
+	if len(patterns) > 0 {
+		ig.dirs[filepath.Clean(dir)] = patterns
+	}
+	return nil
+}
+
+// match returns true if the file at fpath, which is a
+// folder if isDir is true, is ignored by the ignore files
+// loaded in the folders it is in. As in git, the patterns
+// of deeper folders, and later patterns in the same file,
+// take precedence. The folders it is in must not have been
+// ignored themselves, since their contents cannot be
+// included again.
+func (ig *ignoreFiles) match(fpath string, isDir bool) bool {
+	var dirs []string
+	for dir := filepath.Dir(fpath); ; dir = filepath.Dir(dir) {
+		if _, ok := ig.dirs[dir]; ok {
+			dirs = append(dirs, dir)
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+
+	var ignored bool
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(dirs[i], fpath)
+		if err != nil {
+			continue
+		}
+		elems := strings.Split(filepath.ToSlash(rel), "/")
+		for _, p := range ig.dirs[dirs[i]] {
+			if p.match(elems, isDir) {
+				ignored = !p.negate
+			}
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,74 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIgnoreFileName(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, f := range []struct{ path, contents string }{
+		{"src/.gitignore", "# build output\n*.log\nbuild/\n!keep.log\n"},
+		{"src/a.txt", "a"},
+		{"src/b.log", "b"},
+		{"src/keep.log", "keep"},
+		{"src/build/out.bin", "out"},
+		{"src/sub/.gitignore", "secret.txt\n/local.txt\n"},
+		{"src/sub/c.log", "c"},
+		{"src/sub/secret.txt", "secret"},
+		{"src/sub/local.txt", "local"},
+		{"src/sub/x/local.txt", "not local"},
+	} {
+		fpath := filepath.Join(tmp, filepath.FromSlash(f.path))
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(fpath, []byte(f.contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{
+		"src/.gitignore",
+		"src/a.txt",
+		"src/keep.log",
+		"src/sub/.gitignore",
+		"src/sub/x/local.txt",
+	}
+
+	for _, format := range []interface {
+		Archiver
+		Lister
+	}{
+		&Tar{IgnoreFileName: ".gitignore"},
+		&Zip{IgnoreFileName: ".gitignore"},
+	} {
+		archive := filepath.Join(tmp, "test."+format.(interface{ String() string }).String())
+		err := format.Archive([]string{filepath.Join(tmp, "src")}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := format.List(archive)
+		if err != nil {
+			t.Fatalf("[%s] listing: %v", archive, err)
+		}
+		var files []string
+		for _, e := range entries {
+			if e.Type == EntryFile {
+				files = append(files, e.Name)
+			}
+		}
+		if !reflect.DeepEqual(files, expected) {
+			t.Errorf("[%s] expected files %v, got %v", archive, expected, files)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package archiver
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sort"
+	"sync"
+)
+
+// LeakKind is the kind of resource described by a Leak.
+type LeakKind string
+
+// Kinds of resources which are tracked.
+const (
+	LeakFileBody LeakKind = "file body"
+	LeakTempFile LeakKind = "temporary file"
+)
+
+// Leak is a resource which was not
+// closed (or removed) when it was
+// reported by Leaks.
+type Leak struct {
+	Kind  LeakKind
+	Name  string // name of the File or temporary file
+	Stack string // stack trace of where it was made
+}
+
+func (l Leak) String() string {
+	return fmt.Sprintf("%s %s not closed; made at:\n%s", l.Kind, l.Name, l.Stack)
+}
+
+// SetLeakDetection enables or disables leak detection,
+// which helps to find Files which are never closed. While
+// it is enabled, the contents of every File returned by
+// a Reader, and every temporary file made by this
+// package, are tracked along with the stack trace of
+// where they were made until they are closed (or, for
+// temporary files, removed); Leaks returns those which
+// are still open. Since recording stack traces is slow,
+// leak detection is meant for debugging and tests only.
+// Disabling it forgets about any resources which are
+// being tracked.
+func SetLeakDetection(enabled bool) {
+	leaks.mu.Lock()
+	defer leaks.mu.Unlock()
+	leaks.enabled = enabled
+	leaks.open = nil
+	if enabled {
+		leaks.open = make(map[uint64]Leak)
+	}
+}
+
+// Leaks returns the tracked resources which have not
+// been closed (or removed) yet, in the order they were
+// made. It returns nil if leak detection is disabled.
+func Leaks() []Leak {
+	leaks.mu.Lock()
+	defer leaks.mu.Unlock()
+	ids := make([]uint64, 0, len(leaks.open))
+	for id := range leaks.open {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var list []Leak
+	for _, id := range ids {
+		list = append(list, leaks.open[id])
+	}
+	return list
+}
+
+// leaks holds the state of leak detection.
+var leaks struct {
+	mu      sync.Mutex
+	enabled bool
+	nextID  uint64
+	open    map[uint64]Leak
+}
+
+// trackResource starts tracking a resource, if leak
+// detection is enabled, and returns a function which
+// stops tracking it. The function is never nil.
+func trackResource(kind LeakKind, name string) func() {
+	leaks.mu.Lock()
+	defer leaks.mu.Unlock()
+	if !leaks.enabled {
+		return func() {}
+	}
+	leaks.nextID++
+	id := leaks.nextID
+	leaks.open[id] = Leak{Kind: kind, Name: name, Stack: string(debug.Stack())}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			leaks.mu.Lock()
+			defer leaks.mu.Unlock()
+			if leaks.open != nil {
+				delete(leaks.open, id)
+			}
+		})
+	}
+}
+
+// trackBody returns rc, the contents of the File named
+// name, wrapped so that it is tracked until it is closed
+// if leak detection is enabled.
+func trackBody(name string, rc io.ReadCloser) io.ReadCloser {
+	leaks.mu.Lock()
+	enabled := leaks.enabled
+	leaks.mu.Unlock()
+	if !enabled {
+		return rc
+	}
+	return &trackedBody{ReadCloser: rc, untrack: trackResource(LeakFileBody, name)}
+}
+
+// trackedBody is the contents of a File
+// which is tracked until it is closed.
+type trackedBody struct {
+	io.ReadCloser
+	untrack func()
+}
+
+func (tb *trackedBody) Close() error {
+	tb.untrack()
+	return tb.ReadCloser.Close()
+}
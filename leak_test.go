@@ -0,0 +1,86 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLeakDetection(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	SetLeakDetection(true)
+	defer SetLeakDetection(false)
+
+	for _, af := range []interface{}{
+		&Zip{CompressionLevel: flate.DefaultCompression},
+		&Tar{},
+	} {
+		archive := filepath.Join(tmp, "leak_test."+af.(interface{ String() string }).String())
+		err := af.(Archiver).Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatalf("[%s] making archive: %v", af, err)
+		}
+
+		// walkers close the files they visit
+		err = af.(Walker).Walk(archive, func(f File) error {
+			_, err := ioutil.ReadAll(f)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("[%s] walking: %v", af, err)
+		}
+		if leaks := Leaks(); len(leaks) != 0 {
+			t.Fatalf("[%s] expected no leaks after walking, got %v", af, leaks)
+		}
+
+		// files read with a Reader must be closed
+		data, err := ioutil.ReadFile(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := af.(Reader)
+		err = r.Open(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("[%s] opening: %v", af, err)
+		}
+		f, err := r.Read()
+		if err != nil {
+			t.Fatalf("[%s] reading: %v", af, err)
+		}
+		leaks := Leaks()
+		if len(leaks) != 1 {
+			t.Fatalf("[%s] expected 1 leak, got %v", af, leaks)
+		}
+		if leaks[0].Kind != LeakFileBody || !strings.Contains(leaks[0].Stack, "TestLeakDetection") {
+			t.Errorf("[%s] unexpected leak: %v", af, leaks[0])
+		}
+		f.Close()
+		r.Close()
+		if leaks := Leaks(); len(leaks) != 0 {
+			t.Errorf("[%s] expected no leaks after closing, got %v", af, leaks)
+		}
+	}
+
+	// temporary files are tracked until removed
+	rc, _, err := spool(bytes.NewReader(make([]byte, spoolMemoryLimit+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaks := Leaks()
+	if len(leaks) != 1 || leaks[0].Kind != LeakTempFile {
+		t.Fatalf("expected temporary file leak, got %v", leaks)
+	}
+	rc.Close()
+	if leaks := Leaks(); len(leaks) != 0 {
+		t.Errorf("expected no leaks after removing temporary file, got %v", leaks)
+	}
+}
@@ -0,0 +1,122 @@
+package archiver
+
+import (
+	"io"
+	"strings"
+)
+
+// extractLimits are the limits on the files extracted
+// from an archive: on the sizes of their contents, which
+// are counted as they are read, so that archives which
+// decompress to much more than they say, like
+// decompression bombs, cannot fill the disk; and on their
+// paths, for filesystems which cannot have long paths;
+// and, if checkSpace, on the space available where they
+// are extracted. A limit of 0 means no limit.
+type extractLimits struct {
+	maxEntry int64 // of each file
+	maxTotal int64 // of all files
+	total    *int64
+
+	checkSpace bool
+	space      int64 // bytes available for all files
+
+	maxPathDepth  int // elements of a path
+	maxPathLength int // bytes of a path
+	maxNameLength int // bytes of an element of a path
+}
+
+// checkPath returns an error which is ErrLimitExceeded
+// if the path of the entry named name is deeper or longer
+// than allowed, or has an element which is too long.
+func (l extractLimits) checkPath(name string) error {
+	if l.maxPathLength > 0 && len(name) > l.maxPathLength {
+		return pathErrorf(ErrLimitExceeded, name, "%s: path is longer than the limit of %d bytes", name, l.maxPathLength)
+	}
+	if l.maxPathDepth <= 0 && l.maxNameLength <= 0 {
+		return nil
+	}
+	elems := strings.Split(name, "/")
+	if l.maxPathDepth > 0 && len(elems) > l.maxPathDepth {
+		return pathErrorf(ErrLimitExceeded, name, "%s: path is deeper than the limit of %d", name, l.maxPathDepth)
+	}
+	for _, elem := range elems {
+		if l.maxNameLength > 0 && len(elem) > l.maxNameLength {
+			return pathErrorf(ErrLimitExceeded, name, "%s: name %s is longer than the limit of %d bytes", name, elem, l.maxNameLength)
+		}
+	}
+	return nil
+}
+
+// check returns an error which is ErrLimitExceeded if the
+// file named name is declared to be larger than allowed,
+// or ErrInsufficientSpace if there is not space for it,
+// so that it can be rejected before it is extracted.
+func (l extractLimits) check(name string, size int64) error {
+	if l.maxEntry > 0 && size > l.maxEntry {
+		return pathErrorf(ErrLimitExceeded, name, "%s: size of %d bytes is more than the limit of %d", name, size, l.maxEntry)
+	}
+	if l.maxTotal > 0 && *l.total+size > l.maxTotal {
+		return pathErrorf(ErrLimitExceeded, name, "%s: extracting %d more bytes would be more than the total limit of %d", name, size, l.maxTotal)
+	}
+	if l.checkSpace && *l.total+size > l.space {
+		return pathErrorf(ErrInsufficientSpace, name, "%s: extracting %d more bytes would be more than the %d bytes available", name, size, l.space-*l.total)
+	}
+	return nil
+}
+
+// reader returns a reader of r, the contents of the file
+// named name, which fails with an error which is
+// ErrLimitExceeded (or ErrInsufficientSpace) instead of
+// reading past a limit.
+func (l extractLimits) reader(name string, r io.Reader) io.Reader {
+	if l.maxEntry <= 0 && l.maxTotal <= 0 && !l.checkSpace {
+		return r
+	}
+	return &limitedReader{l: l, name: name, r: r}
+}
+
+// limitedReader reads the contents of a file
+// up to its extractLimits.
+type limitedReader struct {
+	l    extractLimits
+	name string
+	r    io.Reader
+	n    int64 // bytes read
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	// read up to one byte past the nearest
+	// limit, to know whether it is exceeded
+	remaining := int64(-1)
+	if lr.l.maxEntry > 0 {
+		remaining = lr.l.maxEntry - lr.n
+	}
+	if lr.l.maxTotal > 0 && (remaining < 0 || lr.l.maxTotal-*lr.l.total < remaining) {
+		remaining = lr.l.maxTotal - *lr.l.total
+	}
+	if lr.l.checkSpace && (remaining < 0 || lr.l.space-*lr.l.total < remaining) {
+		remaining = lr.l.space - *lr.l.total
+	}
+	if int64(len(p)) > remaining+1 {
+		p = p[:remaining+1]
+	}
+
+	n, err := lr.r.Read(p)
+	over := int64(n) > remaining
+	if over {
+		n = int(remaining)
+	}
+	lr.n += int64(n)
+	*lr.l.total += int64(n)
+	if !over {
+		return n, err
+	}
+	if lr.l.maxEntry > 0 && lr.n >= lr.l.maxEntry {
+		return n, pathErrorf(ErrLimitExceeded, lr.name, "%s: contents are larger than the limit of %d bytes", lr.name, lr.l.maxEntry)
+	}
+	if lr.l.maxTotal > 0 && *lr.l.total >= lr.l.maxTotal {
+		return n, pathErrorf(ErrLimitExceeded, lr.name, "%s: files extracted are larger than the total limit of %d bytes", lr.name, lr.l.maxTotal)
+	}
+	return n, pathErrorf(ErrInsufficientSpace, lr.name, "%s: files extracted are larger than the %d bytes available", lr.name, lr.l.space)
+}
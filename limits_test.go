@@ -0,0 +1,208 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtractLimits(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// zeros compress to next to nothing
+	zeros := make([]byte, 1<<20)
+	entries := []VirtualEntry{
+		BytesEntry("a.bin", 0, time.Time{}, zeros[:600]),
+		BytesEntry("b.bin", 0, time.Time{}, zeros[:600]),
+		BytesEntry("bomb.bin", 0, time.Time{}, zeros),
+	}
+
+	for _, ext := range []string{"zip", "tar.gz"} {
+		for i, tc := range []struct {
+			entries            []VirtualEntry
+			maxEntry, maxTotal int64
+			expectErr          bool
+		}{
+			{entries: entries},
+			{entries: entries, maxEntry: 1000, expectErr: true},
+			{entries: entries[:2], maxEntry: 1000},
+			{entries: entries[:2], maxTotal: 1000, expectErr: true},
+			{entries: entries[:2], maxTotal: 1200},
+		} {
+			archive := filepath.Join(tmp, fmt.Sprintf("test%d.%s", i, ext))
+			err := ArchiveEntries(context.Background(), tc.entries, archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			format, err := ByExtension(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch f := format.(type) {
+			case *Zip:
+				f.MaxEntrySize, f.MaxTotalSize = tc.maxEntry, tc.maxTotal
+			case *TarGz:
+				f.MaxEntrySize, f.MaxTotalSize = tc.maxEntry, tc.maxTotal
+			}
+			err = format.(Unarchiver).Unarchive(archive, filepath.Join(tmp, fmt.Sprintf("out%d.%s", i, ext)))
+			if tc.expectErr && !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("[%s] test %d: expected error for exceeded limit, got %v", ext, i, err)
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("[%s] test %d: unexpected error: %v", ext, i, err)
+			}
+		}
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	// the contents are larger than the size
+	// declared, which is not checked here
+	for i, tc := range []struct {
+		maxEntry, maxTotal, total int64
+		space                     int64
+		expectRead                int
+		expectErr                 error
+	}{
+		{maxEntry: 5, expectRead: 5, expectErr: ErrLimitExceeded},
+		{maxTotal: 8, total: 5, expectRead: 3, expectErr: ErrLimitExceeded},
+		{maxEntry: 5, maxTotal: 8, total: 5, expectRead: 3, expectErr: ErrLimitExceeded},
+		{maxEntry: 20, maxTotal: 100, expectRead: 10},
+		{space: 7, total: 2, expectRead: 5, expectErr: ErrInsufficientSpace},
+		{maxTotal: 7, space: 9, expectRead: 7, expectErr: ErrLimitExceeded},
+		{space: 10, expectRead: 10},
+	} {
+		total := tc.total
+		limits := extractLimits{maxEntry: tc.maxEntry, maxTotal: tc.maxTotal, total: &total, checkSpace: tc.space > 0, space: tc.space}
+		out := new(bytes.Buffer)
+		_, err := out.ReadFrom(limits.reader("f", strings.NewReader("0123456789")))
+		if out.Len() != tc.expectRead {
+			t.Errorf("Test %d: expected %d bytes read, got %d", i, tc.expectRead, out.Len())
+		}
+		if tc.expectErr != nil && !errors.Is(err, tc.expectErr) {
+			t.Errorf("Test %d: expected error %v, got %v", i, tc.expectErr, err)
+		}
+		if total != tc.total+int64(out.Len()) {
+			t.Errorf("Test %d: expected total of %d, got %d", i, tc.total+int64(out.Len()), total)
+		}
+	}
+}
+
+func TestPathLimits(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, ext := range []string{"zip", "tar"} {
+		for i, tc := range []struct {
+			name                   string
+			depth, length, nameLen int
+			expectErr              bool
+		}{
+			{name: "a/b/c/d.txt", depth: 4},
+			{name: "a/b/c/d.txt", depth: 3, expectErr: true},
+			{name: "a/b/c/d.txt", length: 11},
+			{name: "a/b/c/d.txt", length: 10, expectErr: true},
+			{name: "a/" + strings.Repeat("x", 20) + "/d.txt", nameLen: 20},
+			{name: "a/" + strings.Repeat("x", 20) + "/d.txt", nameLen: 19, expectErr: true},
+		} {
+			archive := filepath.Join(tmp, fmt.Sprintf("test%d.%s", i, ext))
+			entries := []VirtualEntry{BytesEntry(tc.name, 0, time.Time{}, []byte("hi"))}
+			err := ArchiveEntries(context.Background(), entries, archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var u Unarchiver
+			switch ext {
+			case "zip":
+				u = &Zip{MaxPathDepth: tc.depth, MaxPathLength: tc.length, MaxNameLength: tc.nameLen}
+			case "tar":
+				u = &Tar{MaxPathDepth: tc.depth, MaxPathLength: tc.length, MaxNameLength: tc.nameLen}
+			}
+			dest := filepath.Join(tmp, fmt.Sprintf("out%d.%s", i, ext))
+			err = u.Unarchive(archive, dest)
+			if tc.expectErr && !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("[%s] test %d: expected error for exceeded limit, got %v", ext, i, err)
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("[%s] test %d: unexpected error: %v", ext, i, err)
+			}
+			if exists := fileExists(filepath.Join(dest, filepath.FromSlash(tc.name))); exists == tc.expectErr {
+				t.Errorf("[%s] test %d: expected file to be extracted: %t", ext, i, !tc.expectErr)
+			}
+		}
+	}
+}
+
+// fullFileSystem is a MemFileSystem
+// with little space available.
+type fullFileSystem struct {
+	*MemFileSystem
+	space int64
+}
+
+func (f fullFileSystem) AvailableSpace(path string) (int64, error) { return f.space, nil }
+
+func TestCheckDiskSpace(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	entries := []VirtualEntry{
+		BytesEntry("a.bin", 0, time.Time{}, make([]byte, 600)),
+		BytesEntry("b.bin", 0, time.Time{}, make([]byte, 600)),
+	}
+	for _, ext := range []string{"zip", "tar"} {
+		archive := filepath.Join(tmp, "test."+ext)
+		err := ArchiveEntries(context.Background(), entries, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, tc := range []struct {
+			space     int64
+			check     bool
+			expectErr bool
+		}{
+			{space: 1000},
+			{space: 1000, check: true, expectErr: true},
+			{space: 1200, check: true},
+		} {
+			fsys := fullFileSystem{MemFileSystem: NewMemFileSystem(nil), space: tc.space}
+			var u Unarchiver
+			switch ext {
+			case "zip":
+				u = &Zip{FileSystem: fsys, MkdirAll: true, CheckDiskSpace: tc.check}
+			case "tar":
+				u = &Tar{FileSystem: fsys, MkdirAll: true, CheckDiskSpace: tc.check}
+			}
+			err := u.Unarchive(archive, "out")
+			if tc.expectErr && !errors.Is(err, ErrInsufficientSpace) {
+				t.Errorf("[%s] test %d: expected error for insufficient space, got %v", ext, i, err)
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("[%s] test %d: unexpected error: %v", ext, i, err)
+			}
+			// zip archives say how large all their files are,
+			// so none are extracted if there is not space
+			_, err = fsys.Stat(filepath.Join("out", "a.bin"))
+			if extracted := err == nil; extracted != (!tc.expectErr || ext == "tar") {
+				t.Errorf("[%s] test %d: expected first file to be extracted: %t", ext, i, !extracted)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package archiver
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Lister can list the entries of an archive file.
+type Lister interface {
+	List(archive string) ([]EntryInfo, error)
+}
+
+// EntryInfo describes an entry in an archive,
+// as listed by a Lister.
+type EntryInfo struct {
+	// The slash-separated path of the entry
+	// within the archive.
+	Name string
+
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	Type    EntryType
+
+	// The target of links, if known: the path of
+	// the linked file within the archive for hard
+	// links, and the target as written for symbolic
+	// links.
+	LinkTarget string
+}
+
+// EntryType is the type of an entry in an archive.
+type EntryType string
+
+// Types of entries.
+const (
+	EntryFile     EntryType = "file"
+	EntryDir      EntryType = "dir"
+	EntrySymlink  EntryType = "symlink"
+	EntryHardLink EntryType = "hardlink"
+	EntryOther    EntryType = "other" // devices, pipes and so on
+)
+
+// listWalk lists the entries of archive by walking it
+// with w, in the order they are in the archive.
+func listWalk(w Walker, archive string) ([]EntryInfo, error) {
+	var entries []EntryInfo
+	err := w.Walk(archive, func(f File) error {
+		entry, err := newEntryInfo(f)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// newEntryInfo describes f, which is being walked;
+// the targets of symbolic links whose contents are
+// their targets (as in zip archives) are read.
+func newEntryInfo(f File) (EntryInfo, error) {
+	entry := EntryInfo{
+		Name:    entryPath(f),
+		Size:    f.Size(),
+		Mode:    f.Mode(),
+		ModTime: f.ModTime(),
+		Type:    entryType(f),
+	}
+
+	switch hdr := f.Header.(type) {
+	case *tar.Header:
+		switch hdr.Typeflag {
+		case tar.TypeLink:
+			entry.LinkTarget = cleanEntryPath(hdr.Linkname)
+		case tar.TypeSymlink:
+			entry.LinkTarget = hdr.Linkname
+		}
+	case *CpioHeader:
+		entry.LinkTarget = hdr.Linkname
+	default:
+		if entry.Type == EntrySymlink && f.ReadCloser != nil {
+			// link targets are limited in size by
+			// systems, so there is no need to read
+			// more than that
+			target, err := ioutil.ReadAll(io.LimitReader(f, maxLinkTargetSize))
+			if err != nil {
+				return entry, err
+			}
+			entry.LinkTarget = string(target)
+		}
+	}
+
+	return entry, nil
+}
+
+// entryType returns the type of the entry f.
+func entryType(f File) EntryType {
+	if hdr, ok := f.Header.(*tar.Header); ok && hdr.Typeflag == tar.TypeLink {
+		return EntryHardLink
+	}
+	mode := f.Mode()
+	switch {
+	case mode.IsDir():
+		return EntryDir
+	case mode&os.ModeSymlink != 0:
+		return EntrySymlink
+	case mode.IsRegular():
+		return EntryFile
+	}
+	return EntryOther
+}
+
+// maxLinkTargetSize is the most of a symbolic
+// link's target which is read, as PATH_MAX.
+const maxLinkTargetSize = 4096
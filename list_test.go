@@ -0,0 +1,119 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestList(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	modTime := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	expected := []EntryInfo{
+		{Name: "dir", Mode: os.ModeDir | 0755, Type: EntryDir},
+		{Name: "dir/file.txt", Size: 5, Mode: 0644, Type: EntryFile},
+		{Name: "dir/symlink", Mode: os.ModeSymlink | 0777, Type: EntrySymlink, LinkTarget: "file.txt"},
+	}
+	for i := range expected {
+		expected[i].ModTime = modTime
+	}
+
+	// tarballs can also have hard links and special files
+	tarball := filepath.Join(tmp, "test.tar")
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "dir/file.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 5},
+		{Name: "dir/symlink", Typeflag: tar.TypeSymlink, Mode: 0777, Linkname: "file.txt"},
+		{Name: "./dir/hardlink", Typeflag: tar.TypeLink, Mode: 0644, Linkname: "./dir/file.txt"},
+		{Name: "dir/fifo", Typeflag: tar.TypeFifo, Mode: 0644},
+	} {
+		hdr.ModTime = modTime
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			tw.Write([]byte("hello"))
+		}
+	}
+	tw.Close()
+	err = ioutil.WriteFile(tarball, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := (&Tar{}).List(tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTar := append(expected,
+		EntryInfo{Name: "dir/hardlink", Mode: 0644, ModTime: modTime, Type: EntryHardLink, LinkTarget: "dir/file.txt"},
+		EntryInfo{Name: "dir/fifo", Mode: os.ModeNamedPipe | 0644, ModTime: modTime, Type: EntryOther},
+	)
+	checkEntries(t, "tar", entries, expectedTar)
+
+	// zip archives hold the targets of symbolic
+	// links as their contents
+	zipball := filepath.Join(tmp, "test.zip")
+	buf = new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, e := range expected {
+		hdr := &zip.FileHeader{Name: e.Name, Method: zip.Store, Modified: modTime}
+		hdr.SetMode(e.Mode)
+		if e.Type == EntryDir {
+			hdr.Name += "/"
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch e.Type {
+		case EntryFile:
+			w.Write([]byte("hello"))
+		case EntrySymlink:
+			w.Write([]byte(e.LinkTarget))
+		}
+	}
+	zw.Close()
+	err = ioutil.WriteFile(zipball, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = (&Zip{}).List(zipball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedZip := append([]EntryInfo(nil), expected...)
+	expectedZip[2].Size = int64(len("file.txt"))
+	checkEntries(t, "zip", entries, expectedZip)
+}
+
+func checkEntries(t *testing.T, format string, entries, expected []EntryInfo) {
+	if len(entries) != len(expected) {
+		t.Fatalf("[%s] expected %d entries, got %d: %+v", format, len(expected), len(entries), entries)
+	}
+	for i := range entries {
+		// compare times separately, for time zones
+		if !entries[i].ModTime.Equal(expected[i].ModTime) {
+			t.Errorf("[%s] entry %d: expected modification time %v, got %v", format, i, expected[i].ModTime, entries[i].ModTime)
+		}
+		entries[i].ModTime = expected[i].ModTime
+		if !reflect.DeepEqual(entries[i], expected[i]) {
+			t.Errorf("[%s] entry %d: expected %+v, got %+v", format, i, expected[i], entries[i])
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package archiver
+
+import (
+	"log"
+	"strings"
+	"sync"
+)
+
+// ErrorLogPolicy configures how errors are logged when they
+// are skipped because ContinueOnError is enabled. When many
+// files fail for the same reason (such as a lack of permission),
+// logging every error can flood the log, so the number of
+// messages for each class of error can be limited; errors
+// beyond the limit are only counted, and the counts are
+// reported by LogErrorSummary.
+type ErrorLogPolicy struct {
+	// The most messages to log for each class of error,
+	// where the class is the final cause described by the
+	// error (for example, "permission denied"). If 0,
+	// every error is logged.
+	MaxPerClass int
+
+	// The logger to write to; if nil,
+	// the standard logger is used.
+	Logger *log.Logger
+}
+
+// Logger logs the errors which are skipped because of
+// ContinueOnError, and the warnings of formats as they
+// happen. A *slog.Logger can be used as a Logger, as
+// can any type with its Warn and Error methods; args
+// are pairs of keys and values, as for slog.
+type Logger interface {
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// errorLog is the state of error logging.
+var errorLog struct {
+	sync.Mutex
+	policy     ErrorLogPolicy
+	counts     map[string]int
+	suppressed []string // classes with suppressed errors, in order
+}
+
+// SetErrorLogPolicy sets the policy for logging errors
+// which are skipped, and resets the counts of errors.
+func SetErrorLogPolicy(policy ErrorLogPolicy) {
+	errorLog.Lock()
+	defer errorLog.Unlock()
+	errorLog.policy = policy
+	errorLog.counts = nil
+	errorLog.suppressed = nil
+}
+
+// LogErrorSummary logs how many errors of each class were
+// not logged because of the limit set by the error log
+// policy, then resets the counts of errors.
+func LogErrorSummary() {
+	errorLog.Lock()
+	defer errorLog.Unlock()
+	for _, class := range errorLog.suppressed {
+		n := errorLog.counts[class] - errorLog.policy.MaxPerClass
+		logOutput("[ERROR] " + sprintMessage("%d more errors not logged: %s", n, class))
+	}
+	errorLog.counts = nil
+	errorLog.suppressed = nil
+}
+
+// logError logs an error which is skipped, subject
+// to the error log policy, to logger if it is not nil.
+// The message is formatted like log.Printf, and it is
+// translated as described for MessageCatalog; unless
+// it is logged to logger, it is prefixed with "[ERROR] ".
+func logError(logger Logger, format string, v ...interface{}) {
+	msg := sprintMessage(format, v...)
+
+	errorLog.Lock()
+	defer errorLog.Unlock()
+	if max := errorLog.policy.MaxPerClass; max > 0 {
+		class := errorClass(msg)
+		if errorLog.counts == nil {
+			errorLog.counts = make(map[string]int)
+		}
+		errorLog.counts[class]++
+		switch n := errorLog.counts[class]; {
+		case n == max+1:
+			errorLog.suppressed = append(errorLog.suppressed, class)
+			msg = sprintMessage("Further errors will not be logged: %s", class)
+		case n > max:
+			return
+		}
+	}
+	if logger != nil {
+		logger.Error(msg)
+		return
+	}
+	logOutput("[ERROR] " + msg)
+}
+
+// logWarning logs w to logger, if it is not nil.
+func logWarning(logger Logger, w Warning) {
+	if logger != nil {
+		logger.Warn(w.Error(), "path", w.Path)
+	}
+}
+
+// errorClass returns the class of the error described
+// by msg: its final cause, which is usually after the
+// last colon, as in "open /foo: permission denied".
+func errorClass(msg string) string {
+	if i := strings.LastIndex(msg, ": "); i >= 0 {
+		return msg[i+2:]
+	}
+	return msg
+}
+
+// logOutput writes msg to the logger of the
+// error log policy. errorLog must be locked.
+func logOutput(msg string) {
+	if errorLog.policy.Logger != nil {
+		errorLog.policy.Logger.Output(3, msg)
+		return
+	}
+	log.Output(3, msg)
+}
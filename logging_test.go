@@ -0,0 +1,94 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogErrorThrottling(t *testing.T) {
+	buf := new(bytes.Buffer)
+	SetErrorLogPolicy(ErrorLogPolicy{
+		MaxPerClass: 2,
+		Logger:      log.New(buf, "", 0),
+	})
+	defer SetErrorLogPolicy(ErrorLogPolicy{})
+
+	for i := 0; i < 5; i++ {
+		logError(nil, "Walking /data/%d: open /data/%d: permission denied", i, i)
+	}
+	logError(nil, "Walking /data/x: unexpected EOF")
+	LogErrorSummary()
+
+	expected := []string{
+		"[ERROR] Walking /data/0: open /data/0: permission denied",
+		"[ERROR] Walking /data/1: open /data/1: permission denied",
+		"[ERROR] Further errors will not be logged: permission denied",
+		"[ERROR] Walking /data/x: unexpected EOF",
+		"[ERROR] 3 more errors not logged: permission denied",
+	}
+	actual := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected log:\n%s\n\nbut got:\n%s", strings.Join(expected, "\n"), buf.String())
+	}
+
+	// counts are reset by the summary
+	buf.Reset()
+	logError(nil, "Walking /data/y: open /data/y: permission denied")
+	if !strings.Contains(buf.String(), "/data/y") {
+		t.Errorf("expected error to be logged after summary, but got: %s", buf.String())
+	}
+}
+
+// recordingLogger is a Logger which records
+// the messages logged to it.
+type recordingLogger struct {
+	warnings, errors []string
+}
+
+func (l *recordingLogger) Warn(msg string, args ...interface{}) {
+	l.warnings = append(l.warnings, msg)
+}
+
+func (l *recordingLogger) Error(msg string, args ...interface{}) {
+	l.errors = append(l.errors, msg)
+}
+
+func TestLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	SetErrorLogPolicy(ErrorLogPolicy{Logger: log.New(buf, "", 0)})
+	defer SetErrorLogPolicy(ErrorLogPolicy{})
+
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	logger := new(recordingLogger)
+	tr := &Tar{
+		ContinueOnError: true,
+		Logger:          logger,
+		VirtualEntries: []VirtualEntry{{
+			Name: "bad.txt",
+			Size: 1,
+			Open: func() (io.ReadCloser, error) { return nil, fmt.Errorf("cannot open") },
+		}},
+	}
+	err = tr.Archive([]string{"testdata/proverbs/proverb1.txt"}, filepath.Join(tmp, "test.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logger.errors) != 1 || !strings.Contains(logger.errors[0], "bad.txt") {
+		t.Errorf("expected error about bad.txt to be logged, got %q", logger.errors)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("expected nothing logged to the logger of the policy, got %q", buf.String())
+	}
+}
@@ -1,7 +1,6 @@
 package archiver
 
 import (
-	"fmt"
 	"io"
 	"path/filepath"
 
@@ -32,7 +31,7 @@ func (lz *Lz4) Decompress(in io.Reader, out io.Writer) error {
 // CheckExt ensures the file extension matches the format.
 func (lz *Lz4) CheckExt(filename string) error {
 	if filepath.Ext(filename) != ".lz4" {
-		return fmt.Errorf("filename must have a .lz4 extension")
+		return pathErrorf(ErrFormatMismatch, filename, "filename must have a .lz4 extension")
 	}
 	return nil
 }
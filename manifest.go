@@ -0,0 +1,276 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Manifest lists the digests of the contents of the files
+// in an archive, as the SHA256SUMS files which accompany
+// releases do.
+type Manifest struct {
+	Algorithm HashAlgorithm
+	Entries   []ManifestEntry // in the order of the archive
+}
+
+// ManifestEntry is the digest of the contents of
+// the file named Name in an archive.
+type ManifestEntry struct {
+	Name   string
+	Digest []byte
+}
+
+// WriteTo writes m to w in the format of sha256sum and
+// similar tools: a line for each file, of the digest in
+// hexadecimal, two spaces and the name of the file, so
+// that extracted files can be checked with them.
+func (m Manifest) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for _, e := range m.Entries {
+		n, err := fmt.Fprintf(w, "%x  %s\n", e.Digest, e.Name)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadManifest reads a manifest from r in the format
+// which WriteTo writes, and sha256sum and similar tools
+// too, whose digests were computed with algorithm. Names
+// marked as read in binary mode, with an asterisk before
+// them instead of a space, are read too.
+func ReadManifest(r io.Reader, algorithm HashAlgorithm) (Manifest, error) {
+	m := Manifest{Algorithm: algorithm}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSuffix(sc.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		i := strings.Index(text, " ")
+		if i < 0 || i+2 > len(text) || (text[i+1] != ' ' && text[i+1] != '*') {
+			return m, fmt.Errorf("line %d: malformed manifest entry", line)
+		}
+		digest, err := hex.DecodeString(text[:i])
+		if err != nil {
+			return m, fmt.Errorf("line %d: malformed digest: %w", line, err)
+		}
+		m.Entries = append(m.Entries, ManifestEntry{Name: text[i+2:], Digest: digest})
+	}
+	return m, sc.Err()
+}
+
+// ManifestReporter is a type which can make a manifest
+// of the files it archives.
+type ManifestReporter interface {
+	Manifest() Manifest
+}
+
+// WalkManifest walks archive with w and returns a manifest
+// of the digests of the contents of its regular files,
+// computed with algorithm.
+func WalkManifest(w Walker, archive string, algorithm HashAlgorithm) (Manifest, error) {
+	m := Manifest{Algorithm: algorithm}
+	if _, err := NewHash(algorithm); err != nil {
+		return m, err
+	}
+	err := w.Walk(archive, func(f File) error {
+		if entryType(f) != EntryFile {
+			return nil
+		}
+		h := newHash(algorithm)
+		_, err := io.Copy(h, f)
+		if err != nil {
+			return fmt.Errorf("%s: reading contents: %w", entryPath(f), err)
+		}
+		m.Entries = append(m.Entries, ManifestEntry{Name: entryPath(f), Digest: h.Sum(nil)})
+		return nil
+	})
+	return m, err
+}
+
+// manifestTracker makes the manifest of the
+// files written to an archive, if asked to.
+type manifestTracker struct {
+	manifest Manifest
+	making   bool
+}
+
+// reset starts a new manifest, made with algorithm;
+// if algorithm is empty, no manifest is made.
+func (mt *manifestTracker) reset(algorithm HashAlgorithm) error {
+	*mt = manifestTracker{manifest: Manifest{Algorithm: algorithm}}
+	if algorithm == "" {
+		return nil
+	}
+	if _, err := NewHash(algorithm); err != nil {
+		return err
+	}
+	mt.making = true
+	return nil
+}
+
+// hash returns a new hash for the contents of a
+// file, or nil if no manifest is being made.
+func (mt *manifestTracker) hash() hash.Hash {
+	if !mt.making {
+		return nil
+	}
+	return newHash(mt.manifest.Algorithm)
+}
+
+// add adds the file named name, whose contents were
+// written to h, to the manifest, unless h is nil.
+func (mt *manifestTracker) add(name string, h hash.Hash) {
+	if h != nil {
+		mt.manifest.Entries = append(mt.manifest.Entries, ManifestEntry{Name: name, Digest: h.Sum(nil)})
+	}
+}
+
+// get returns a copy of the manifest.
+func (mt *manifestTracker) get() Manifest {
+	m := mt.manifest
+	m.Entries = append([]ManifestEntry(nil), m.Entries...)
+	return m
+}
+
+// embed writes the manifest to w as the file named name,
+// if a manifest is being made and name is not empty. The
+// manifest does not list itself.
+func (mt *manifestTracker) embed(w Writer, name string, clock Clock) error {
+	if !mt.making || name == "" {
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	mt.manifest.WriteTo(buf)
+	mt.making = false
+	return writeVirtualEntry(w, VirtualEntry{
+		Name: name,
+		Size: int64(buf.Len()),
+		Open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(buf), nil
+		},
+	}, clock, false)
+}
+
+// WarningIntegrity is the kind of warnings for files
+// extracted whose contents do not match the manifest
+// of the archive.
+const WarningIntegrity WarningKind = "integrity"
+
+// manifestVerifier checks the files extracted from an
+// archive against the manifest entry in it, if asked to.
+type manifestVerifier struct {
+	name      string // of the manifest entry
+	algorithm HashAlgorithm
+	report    bool              // mismatches are warnings, not errors
+	digests   map[string][]byte // of the files extracted, by name
+	manifest  *bytes.Buffer     // contents of the entry, once read
+}
+
+// newManifestVerifier returns a verifier of the files
+// extracted against the manifest entry named name, whose
+// digests are of algorithm (SHA256 if it is empty). If
+// name is empty, it returns nil, which verifies nothing.
+func newManifestVerifier(name string, algorithm HashAlgorithm, report bool) (*manifestVerifier, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if algorithm == "" {
+		algorithm = SHA256
+	}
+	if _, err := NewHash(algorithm); err != nil {
+		return nil, err
+	}
+	return &manifestVerifier{
+		name:      cleanEntryPath(name),
+		algorithm: algorithm,
+		report:    report,
+		digests:   make(map[string][]byte),
+	}, nil
+}
+
+// track returns a reader of r, which reads the contents
+// of the regular file named name being extracted, and a
+// function to call once they are all read, which records
+// their digest (or, for the manifest, the manifest).
+func (mv *manifestVerifier) track(name string, r io.Reader) (io.Reader, func()) {
+	if mv == nil {
+		return r, func() {}
+	}
+	name = cleanEntryPath(name)
+	if name == mv.name {
+		buf := new(bytes.Buffer)
+		return io.TeeReader(r, buf), func() { mv.manifest = buf }
+	}
+	h := newHash(mv.algorithm)
+	return io.TeeReader(r, h), func() { mv.digests[name] = h.Sum(nil) }
+}
+
+// verify checks the digests of the files extracted
+// against the manifest. Mismatches are added to warnings
+// if they are to be reported; otherwise the error is
+// about the first of them, and is ErrManifestMismatch.
+func (mv *manifestVerifier) verify(logger Logger, warnings *[]Warning) error {
+	if mv == nil {
+		return nil
+	}
+	if mv.manifest == nil {
+		if mv.report {
+			return addWarning(logger, warnings, false, Warning{
+				Path:   mv.name,
+				Kind:   WarningIntegrity,
+				Detail: "no manifest to verify files with",
+			})
+		}
+		return pathErrorf(ErrManifestMismatch, mv.name, "%s: manifest not found in archive", mv.name)
+	}
+	m, err := ReadManifest(mv.manifest, mv.algorithm)
+	if err != nil {
+		return fmt.Errorf("%s: reading manifest: %w", mv.name, err)
+	}
+	expected := make(map[string][]byte, len(m.Entries))
+	for _, e := range m.Entries {
+		expected[cleanEntryPath(e.Name)] = e.Digest
+	}
+
+	names := make([]string, 0, len(mv.digests))
+	for name := range mv.digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var mismatches []Warning
+	for _, name := range names {
+		digest, ok := expected[name]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, Warning{Path: name, Kind: WarningIntegrity, Detail: "not listed in manifest"})
+		case !bytes.Equal(digest, mv.digests[name]):
+			mismatches = append(mismatches, Warning{Path: name, Kind: WarningIntegrity,
+				Detail: fmt.Sprintf("%s digest %x does not match manifest (%x)", mv.algorithm, mv.digests[name], digest)})
+		}
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	if !mv.report {
+		first := mismatches[0]
+		if len(mismatches) > 1 {
+			return pathErrorf(ErrManifestMismatch, first.Path, "%s: %s (and %d more files)", first.Path, first.Detail, len(mismatches)-1)
+		}
+		return pathErrorf(ErrManifestMismatch, first.Path, "%s: %s", first.Path, first.Detail)
+	}
+	for _, w := range mismatches {
+		addWarning(logger, warnings, false, w)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var expected []ManifestEntry
+	err = filepath.Walk("testdata", func(fpath string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		contents, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(contents)
+		expected = append(expected, ManifestEntry{Name: filepath.ToSlash(fpath), Digest: sum[:]})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []interface {
+		Archiver
+		Walker
+		ManifestReporter
+	}{
+		&TarGz{Tar: &Tar{ManifestAlgorithm: SHA256, ManifestName: "SHA256SUMS"}},
+		&Zip{ManifestAlgorithm: SHA256, ManifestName: "SHA256SUMS"},
+	} {
+		archive := filepath.Join(tmp, "test."+format.(interface{ String() string }).String())
+		err := format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		manifest := format.Manifest()
+		if manifest.Algorithm != SHA256 {
+			t.Errorf("[%s] expected algorithm %s, got %s", archive, SHA256, manifest.Algorithm)
+		}
+		if !reflect.DeepEqual(manifest.Entries, expected) {
+			t.Errorf("[%s] expected manifest entries %v, got %v", archive, expected, manifest.Entries)
+		}
+
+		// the manifest is the last entry, and does not list itself
+		var last string
+		walked, err := WalkManifest(format, archive, SHA256)
+		if err != nil {
+			t.Fatalf("[%s] walking manifest: %v", archive, err)
+		}
+		for _, e := range walked.Entries {
+			last = e.Name
+		}
+		if last != "SHA256SUMS" {
+			t.Errorf("[%s] expected manifest as last entry, got %s", archive, last)
+		}
+		if !reflect.DeepEqual(walked.Entries[:len(walked.Entries)-1], expected) {
+			t.Errorf("[%s] expected walked manifest entries %v, got %v", archive, expected, walked.Entries)
+		}
+
+		rc, err := OpenFile(archive, "SHA256SUMS")
+		if err != nil {
+			t.Fatalf("[%s] opening manifest: %v", archive, err)
+		}
+		embedded, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		manifest.WriteTo(buf)
+		if !bytes.Equal(embedded, buf.Bytes()) {
+			t.Errorf("[%s] expected embedded manifest %q, got %q", archive, buf.Bytes(), embedded)
+		}
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// archives with manifests made as they are
+	// written have no mismatches
+	for i, format := range []interface {
+		Archiver
+		Unarchiver
+	}{
+		&TarGz{Tar: &Tar{ManifestAlgorithm: SHA256, ManifestName: "SHA256SUMS", VerifyManifest: "SHA256SUMS"}},
+		&Zip{ManifestAlgorithm: SHA256, ManifestName: "SHA256SUMS", VerifyManifest: "SHA256SUMS"},
+	} {
+		archive := filepath.Join(tmp, "test."+format.(interface{ String() string }).String())
+		err := format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = format.Unarchive(archive, filepath.Join(tmp, fmt.Sprint(i)))
+		if err != nil {
+			t.Errorf("[%s] expected files to match manifest: %v", archive, err)
+		}
+	}
+
+	// one file matches, one does not, and one is not listed
+	sum := sha256.Sum256([]byte("good"))
+	manifest := fmt.Sprintf("%x  good.txt\n%x  bad.txt\n", sum, sum)
+	entries := []struct{ name, contents string }{
+		{"good.txt", "good"},
+		{"bad.txt", "bad"},
+		{"unlisted.txt", "unlisted"},
+		{"SHA256SUMS", manifest},
+	}
+	tarBuf := new(bytes.Buffer)
+	tw := tar.NewWriter(tarBuf)
+	zipBuf := new(bytes.Buffer)
+	zw := zip.NewWriter(zipBuf)
+	for _, e := range entries {
+		err := tw.WriteHeader(&tar.Header{Name: e.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(e.contents))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.contents))
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.contents))
+	}
+	tw.Close()
+	zw.Close()
+	tarFile := filepath.Join(tmp, "mismatch.tar")
+	zipFile := filepath.Join(tmp, "mismatch.zip")
+	if err := ioutil.WriteFile(tarFile, tarBuf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(zipFile, zipBuf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range []struct {
+		format interface {
+			Unarchiver
+			WarningCollector
+		}
+		archive          string
+		expectErr        error
+		expectedWarnings int
+	}{
+		{format: &Tar{VerifyManifest: "SHA256SUMS"}, archive: tarFile, expectErr: ErrManifestMismatch},
+		{format: &Zip{VerifyManifest: "SHA256SUMS"}, archive: zipFile, expectErr: ErrManifestMismatch},
+		{format: &Tar{VerifyManifest: "SHA256SUMS", ReportManifestMismatches: true}, archive: tarFile, expectedWarnings: 2},
+		{format: &Zip{VerifyManifest: "SHA256SUMS", ReportManifestMismatches: true}, archive: zipFile, expectedWarnings: 2},
+		{format: &Tar{VerifyManifest: "MISSING"}, archive: tarFile, expectErr: ErrManifestMismatch},
+	} {
+		dest := filepath.Join(tmp, fmt.Sprintf("mismatch%d", i))
+		err := tc.format.Unarchive(tc.archive, dest)
+		if !errors.Is(err, tc.expectErr) {
+			t.Errorf("Test %d: expected error %v, got %v", i, tc.expectErr, err)
+		}
+		if len(tc.format.Warnings()) != tc.expectedWarnings {
+			t.Errorf("Test %d: expected %d warnings, got %v", i, tc.expectedWarnings, tc.format.Warnings())
+		}
+		// the files are extracted before they are verified
+		if !fileExists(filepath.Join(dest, "bad.txt")) {
+			t.Errorf("Test %d: expected files to be extracted", i)
+		}
+	}
+}
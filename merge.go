@@ -0,0 +1,227 @@
+package archiver
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ConflictPolicy is what to do about files with the
+// same name in more than one of the archives merged.
+type ConflictPolicy int
+
+const (
+	// ConflictError fails the merge with an error.
+	ConflictError ConflictPolicy = iota
+
+	// ConflictKeepFirst keeps the file from the first
+	// archive it is in, in the order given.
+	ConflictKeepFirst
+
+	// ConflictKeepLast keeps the file from the last
+	// archive it is in, in the order given. It takes
+	// an extra pass over the archives, to find which
+	// files are in which archives first.
+	ConflictKeepLast
+
+	// ConflictKeepAll keeps every file, so the merged
+	// archive has more than one entry with the name,
+	// as tar and zip archives can.
+	ConflictKeepAll
+)
+
+// Merger merges the contents of archive files into one.
+type Merger struct {
+	// What to do about files with the same name in more
+	// than one of the archives (or more than once in one
+	// archive). Folders are never in conflict: each is
+	// written once, where it is first.
+	OnConflict ConflictPolicy
+}
+
+// Merge writes an archive file at destination containing
+// the entries of the archive files at sources, in order,
+// as Merger{}.Merge does: files with the same name are
+// an error.
+func Merge(destination string, sources ...string) error {
+	return Merger{}.Merge(destination, sources...)
+}
+
+// Merge writes an archive file at destination containing
+// the entries of the archive files at sources, in order.
+// The format of the destination is chosen by its extension,
+// and must be one which can be written; the formats of the
+// sources are chosen by their extensions, or else by their
+// contents, and can be any which can be walked, so that
+// archives of different formats can be merged. Files with
+// the same name are handled as m.OnConflict says. The
+// destination must not exist; if merging fails, it is
+// removed.
+func (m Merger) Merge(destination string, sources ...string) error {
+	format, err := ByExtension(destination)
+	if err != nil {
+		return err
+	}
+	w, ok := format.(Writer)
+	if !ok {
+		return pathErrorf(ErrUnsupportedType, destination, "format %s cannot be written", format)
+	}
+	walkers := make([]Walker, len(sources))
+	for i, source := range sources {
+		walkers[i], err = sourceWalker(source)
+		if err != nil {
+			return err
+		}
+	}
+	if fileExists(destination) {
+		return &PathError{Path: destination, Err: ErrDestinationExists}
+	}
+
+	// to keep the last of files with the same name,
+	// find which is last before writing any of them
+	var last map[string]int
+	if m.OnConflict == ConflictKeepLast {
+		last = make(map[string]int)
+		var n int
+		for i, walker := range walkers {
+			err := walker.Walk(sources[i], func(f File) error {
+				last[entryPath(f)] = n
+				n++
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("walking %s: %w", sources[i], err)
+			}
+		}
+	}
+
+	// make the folder to contain the resulting archive
+	// if it does not already exist
+	destDir := filepath.Dir(destination)
+	if !fileExists(destDir) {
+		err := mkdir(destDir)
+		if err != nil {
+			return fmt.Errorf("making folder for destination: %w", err)
+		}
+	}
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", destination, err)
+	}
+	err = m.merge(w, out, walkers, sources, last)
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("closing %s: %w", destination, closeErr)
+	}
+	if err != nil {
+		os.Remove(destination)
+		return err
+	}
+	return nil
+}
+
+// Convert writes an archive file at destination containing
+// the entries of the archive file at source, as they are,
+// so that the archive is converted to the format of the
+// destination, chosen by its extension, without extracting
+// it to disk. Metadata is kept where both formats support
+// it, such as the owners of the entries when converting
+// one tarball to another. The destination must not exist.
+func Convert(source, destination string) error {
+	return Merger{OnConflict: ConflictKeepAll}.Merge(destination, source)
+}
+
+// merge writes the entries of the archives at sources,
+// walked by walkers, to out with w. If last is set, it
+// maps the names of files to the indexes of the entries
+// to keep, counting the entries of all the archives.
+func (m Merger) merge(w Writer, out *os.File, walkers []Walker, sources []string, last map[string]int) error {
+	err := w.Create(out)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", w, err)
+	}
+
+	written := make(map[string]string) // entry name -> source
+	var n int
+	for i, walker := range walkers {
+		source := sources[i]
+		err = walker.Walk(source, func(f File) error {
+			name := entryPath(f)
+			index := n
+			n++
+			if from, ok := written[name]; ok {
+				if f.IsDir() || m.OnConflict == ConflictKeepFirst {
+					return nil
+				}
+				if m.OnConflict == ConflictError {
+					return fmt.Errorf("%s: in both %s and %s", name, from, source)
+				}
+			}
+			if last != nil && !f.IsDir() && last[name] != index {
+				return nil
+			}
+			written[name] = source
+			return writeMerged(w, name, f)
+		})
+		if err != nil {
+			err = fmt.Errorf("merging %s: %w", source, err)
+			break
+		}
+	}
+
+	closeErr := w.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return fmt.Errorf("closing %s: %w", w, closeErr)
+	}
+	return nil
+}
+
+// sourceWalker returns a Walker for the archive at source,
+// of the format indicated by its extension, or else by
+// its contents.
+func sourceWalker(source string) (Walker, error) {
+	format, err := ByExtension(source)
+	if err != nil {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		format, _, err = Identify(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+	}
+	walker, ok := format.(Walker)
+	if !ok {
+		return nil, pathErrorf(ErrUnsupportedType, source, "%s: format %s cannot be walked", source, format)
+	}
+	return walker, nil
+}
+
+// writeMerged writes f, an entry of another archive, with
+// w as name. The targets of symbolic links are carried in
+// a tar header, which is how Tar.Write takes them, whatever
+// the format of the archive they are from.
+func writeMerged(w Writer, name string, f File) error {
+	if _, ok := f.Header.(*tar.Header); !ok && entryType(f) == EntrySymlink {
+		entry, err := newEntryInfo(f)
+		if err != nil {
+			return fmt.Errorf("%s: reading link target: %w", name, err)
+		}
+		f.Header = &tar.Header{Linkname: entry.LinkTarget}
+		f.ReadCloser = ReadFakeCloser{eofReader{}}
+	}
+	return w.Write(File{
+		FileInfo: FileInfo{
+			FileInfo:   f.FileInfo,
+			CustomName: name,
+		},
+		Header:     f.Header,
+		ReadCloser: f.ReadCloser,
+	})
+}
@@ -0,0 +1,134 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// two archives of different formats, each with a
+	// folder of the same name, and one file in both
+	for _, f := range []struct{ path, contents string }{
+		{"a/files/both.txt", "from tar"},
+		{"a/files/tar.txt", "only in tar"},
+		{"b/files/both.txt", "from zip"},
+		{"b/files/zip.txt", "only in zip"},
+	} {
+		fpath := filepath.Join(tmp, filepath.FromSlash(f.path))
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(fpath, []byte(f.contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sources := []string{filepath.Join(tmp, "a.tar"), filepath.Join(tmp, "b.zip")}
+	err = (&Tar{}).Archive([]string{filepath.Join(tmp, "a", "files")}, sources[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&Zip{}).Archive([]string{filepath.Join(tmp, "b", "files")}, sources[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range []struct {
+		policy   ConflictPolicy
+		expected map[string]string
+	}{
+		{
+			policy: ConflictKeepFirst,
+			expected: map[string]string{
+				"files":          "",
+				"files/both.txt": "from tar",
+				"files/tar.txt":  "only in tar",
+				"files/zip.txt":  "only in zip",
+			},
+		},
+		{
+			policy: ConflictKeepLast,
+			expected: map[string]string{
+				"files":          "",
+				"files/both.txt": "from zip",
+				"files/tar.txt":  "only in tar",
+				"files/zip.txt":  "only in zip",
+			},
+		},
+	} {
+		destination := filepath.Join(tmp, "out", "merged"+string(rune('0'+i))+".tar.gz")
+		err := Merger{OnConflict: tc.policy}.Merge(destination, sources...)
+		if err != nil {
+			t.Fatalf("[%d] merging: %v", i, err)
+		}
+
+		actual := make(map[string]string)
+		err = (&TarGz{Tar: &Tar{}}).Walk(destination, func(f File) error {
+			contents, err := ioutil.ReadAll(f)
+			actual[entryPath(f)] = string(contents)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("[%d] walking: %v", i, err)
+		}
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("[%d] expected entries %v, got %v", i, tc.expected, actual)
+		}
+	}
+
+	destination := filepath.Join(tmp, "conflict.tar")
+	err = Merge(destination, sources...)
+	if err == nil {
+		t.Fatal("expected an error merging archives with a file in both")
+	}
+	if fileExists(destination) {
+		t.Error("expected the destination to be removed after the error")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	source := filepath.Join(tmp, "test.zip")
+	err = (&Zip{}).Archive([]string{"testdata"}, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	destination := filepath.Join(tmp, "test.tar.zst")
+	err = Convert(source, destination)
+	if err != nil {
+		t.Fatalf("converting: %v", err)
+	}
+
+	contents := func(w Walker, archive string) map[string]string {
+		entries := make(map[string]string)
+		err := w.Walk(archive, func(f File) error {
+			contents, err := ioutil.ReadAll(f)
+			entries[entryPath(f)] = f.Mode().String() + " " + string(contents)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("walking %s: %v", archive, err)
+		}
+		return entries
+	}
+	expected := contents(&Zip{}, source)
+	actual := contents(&TarZst{Tar: &Tar{}}, destination)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected entries %v, got %v", expected, actual)
+	}
+}
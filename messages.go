@@ -0,0 +1,94 @@
+package archiver
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MessageCatalog translates the messages which are
+// presented to users: the messages logged for errors
+// which are skipped, and the descriptions of warnings.
+// As with gettext, messages are looked up by their
+// English format strings, as passed to fmt.Sprintf
+// (for example, "Walking %s: %v"); the translations
+// are format strings with the same verbs, which can
+// use explicit argument indexes to reorder them. The
+// kinds of warnings (for example, "symbolic link")
+// are looked up by themselves. Messages which are
+// not in the catalog are presented in English.
+type MessageCatalog map[string]string
+
+// Messages configures how messages and errors
+// are presented to users, for localization.
+type Messages struct {
+	// The translations of messages; if nil,
+	// messages are presented in English.
+	Catalog MessageCatalog
+
+	// If set, formats errors for presentation, such
+	// as in log messages, instead of FormatError. It
+	// can return "" to format an error the default
+	// way. The errors themselves are not changed, so
+	// they can still be inspected by programs.
+	FormatError func(err error) string
+}
+
+// messages is the configuration of messages.
+var messages struct {
+	sync.RWMutex
+	Messages
+}
+
+// SetMessages sets how messages and errors are
+// presented to users.
+func SetMessages(m Messages) {
+	messages.Lock()
+	defer messages.Unlock()
+	messages.Messages = m
+}
+
+// FormatError formats err for presentation to users,
+// using the hook and catalog set by SetMessages.
+// Warnings are described in the language of the
+// catalog; other errors are formatted by their
+// Error methods.
+func FormatError(err error) string {
+	messages.RLock()
+	formatError := messages.FormatError
+	messages.RUnlock()
+	if formatError != nil {
+		if msg := formatError(err); msg != "" {
+			return msg
+		}
+	}
+	if w, ok := err.(Warning); ok {
+		return sprintMessage(warningFormat, w.Path, translate(string(w.Kind)), w.Detail)
+	}
+	return err.Error()
+}
+
+// sprintMessage formats a message like fmt.Sprintf, in
+// the language of the catalog. Errors in v are formatted
+// by FormatError.
+func sprintMessage(format string, v ...interface{}) string {
+	args := make([]interface{}, len(v))
+	for i, arg := range v {
+		if err, ok := arg.(error); ok && err != nil {
+			arg = FormatError(err)
+		}
+		args[i] = arg
+	}
+	return fmt.Sprintf(translate(format), args...)
+}
+
+// translate returns the translation of
+// msg in the catalog, or msg if there
+// is none.
+func translate(msg string) string {
+	messages.RLock()
+	defer messages.RUnlock()
+	if t, ok := messages.Catalog[msg]; ok {
+		return t
+	}
+	return msg
+}
@@ -0,0 +1,70 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestMessages(t *testing.T) {
+	SetMessages(Messages{
+		Catalog: MessageCatalog{
+			"Walking %s: %v":                "Durchlaufen von %s: %v",
+			"%s: %s not preserved: %s":      "%[2]s von %[1]s nicht erhalten: %[3]s",
+			"symbolic link":                 "Symbolischer Link",
+			"%d more errors not logged: %s": "%[2]s: %[1]d weitere Fehler nicht protokolliert",
+		},
+	})
+	defer SetMessages(Messages{})
+
+	w := Warning{Path: "a/link", Kind: WarningSymlink, Detail: "not permitted"}
+	if expected, actual := "Symbolischer Link von a/link nicht erhalten: not permitted", FormatError(w); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if expected, actual := "a/link: symbolic link not preserved: not permitted", w.Error(); actual != expected {
+		t.Errorf("expected the error itself to be unchanged, %q, but got %q", expected, actual)
+	}
+
+	buf := new(bytes.Buffer)
+	SetErrorLogPolicy(ErrorLogPolicy{MaxPerClass: 1, Logger: log.New(buf, "", 0)})
+	defer SetErrorLogPolicy(ErrorLogPolicy{})
+	logError(nil, "Walking %s: %v", "a", w)
+	logError(nil, "Walking %s: %v", "b", fmt.Errorf("permission denied"))
+	logError(nil, "Walking %s: %v", "c", fmt.Errorf("permission denied"))
+	logError(nil, "Opening next file: %v", fmt.Errorf("unexpected EOF"))
+	LogErrorSummary()
+
+	expected := []string{
+		"[ERROR] Durchlaufen von a: Symbolischer Link von a/link nicht erhalten: not permitted",
+		"[ERROR] Durchlaufen von b: permission denied",
+		"[ERROR] Further errors will not be logged: permission denied",
+		"[ERROR] Opening next file: unexpected EOF",
+		"[ERROR] permission denied: 1 weitere Fehler nicht protokolliert",
+	}
+	actual := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected log:\n%s\n\nbut got:\n%s", strings.Join(expected, "\n"), buf.String())
+	}
+}
+
+func TestFormatErrorHook(t *testing.T) {
+	errSpecial := fmt.Errorf("special")
+	SetMessages(Messages{
+		FormatError: func(err error) string {
+			if err == errSpecial {
+				return "something special happened"
+			}
+			return ""
+		},
+	})
+	defer SetMessages(Messages{})
+
+	if expected, actual := "something special happened", FormatError(errSpecial); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if expected, actual := "other", FormatError(fmt.Errorf("other")); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,293 @@
+package archiver
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OCILayer builds image layers, as used by OCI and Docker
+// container images, from the contents of a directory. A
+// layer is a tarball of the files relative to the root of
+// the directory, whose headers are normalized so that
+// building a layer from the same files always results in
+// the same bytes (and thus the same digest): files are
+// added in lexical order, owned by root (uid and gid 0,
+// no user or group names), and carry no access or change
+// times. Files deleted relative to the layers below are
+// recorded as whiteout files.
+// See https://github.com/opencontainers/image-spec/blob/main/layer.md.
+type OCILayer struct {
+	// The gzip compression level to use, as described
+	// in the compress/flate package. If Uncompressed
+	// is true, the layer is not compressed.
+	CompressionLevel int
+	Uncompressed     bool
+
+	// If not zero, the modification time of every file
+	// in the layer; otherwise, the modification times
+	// of the files are kept, truncated to the second.
+	ModTime time.Time
+
+	// Paths, relative to the root of the layer and
+	// slash-separated, of files and directories which
+	// are deleted by this layer; a whiteout file is
+	// added for each.
+	Whiteouts []string
+
+	// Paths, relative to the root of the layer and
+	// slash-separated, of directories whose contents
+	// in lower layers are hidden by this layer; an
+	// opaque whiteout is added to each.
+	OpaqueDirs []string
+
+	// Whether to overwrite existing files when using
+	// BuildFile; if false, an error is returned if
+	// the file exists.
+	OverwriteExisting bool
+}
+
+// OCILayerDescriptor describes a layer built by OCILayer,
+// with the information needed to refer to it from an
+// image manifest and configuration.
+type OCILayerDescriptor struct {
+	// The media type of the layer, such as
+	// "application/vnd.oci.image.layer.v1.tar+gzip".
+	MediaType string
+
+	// The digest ("sha256:" followed by hex) and size
+	// in bytes of the layer as written, which are used
+	// in the image manifest.
+	Digest string
+	Size   int64
+
+	// The digest of the uncompressed tarball, which is
+	// the diff ID used in the image configuration. It
+	// is the same as Digest if the layer is uncompressed.
+	DiffID string
+}
+
+// Media types of layers.
+const (
+	OCILayerMediaType     = "application/vnd.oci.image.layer.v1.tar"
+	OCILayerGzipMediaType = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+// Build writes a layer with the contents of the directory
+// dir to out, and returns the descriptor of the layer.
+func (l *OCILayer) Build(dir string, out io.Writer) (OCILayerDescriptor, error) {
+	var desc OCILayerDescriptor
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return desc, fmt.Errorf("%s: stat: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return desc, fmt.Errorf("%s: not a directory", dir)
+	}
+
+	// the digest and size of the layer are of the
+	// bytes as written; the diff ID is of the tarball
+	layerHash := newHash(SHA256)
+	counter := &countingWriter{w: io.MultiWriter(out, layerHash)}
+	diffHash := layerHash
+	tarOut := io.Writer(counter)
+	var gzw *gzip.Writer
+	if l.Uncompressed {
+		desc.MediaType = OCILayerMediaType
+	} else {
+		desc.MediaType = OCILayerGzipMediaType
+		gzw, err = getGzipWriter(counter, l.CompressionLevel)
+		if err != nil {
+			return desc, fmt.Errorf("creating gzip writer: %w", err)
+		}
+		defer putGzipWriter(gzw, l.CompressionLevel)
+		diffHash = newHash(SHA256)
+		tarOut = io.MultiWriter(gzw, diffHash)
+	}
+
+	tw := tar.NewWriter(tarOut)
+	err = l.writeWhiteouts(tw)
+	if err != nil {
+		return desc, err
+	}
+	err = filepath.Walk(dir, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("traversing %s: %w", fpath, err)
+		}
+		if fpath == dir {
+			return nil
+		}
+		name, err := filepath.Rel(dir, fpath)
+		if err != nil {
+			return fmt.Errorf("%s: relativizing path: %w", fpath, err)
+		}
+		return l.writeFile(tw, fpath, filepath.ToSlash(name), info)
+	})
+	if err != nil {
+		return desc, err
+	}
+	err = tw.Close()
+	if err != nil {
+		return desc, fmt.Errorf("closing tarball: %w", err)
+	}
+	if gzw != nil {
+		err = gzw.Close()
+		if err != nil {
+			return desc, fmt.Errorf("closing gzip writer: %w", err)
+		}
+	}
+
+	desc.Digest = sha256Digest(layerHash)
+	desc.DiffID = sha256Digest(diffHash)
+	desc.Size = counter.n
+	return desc, nil
+}
+
+// BuildFile writes a layer with the contents of the
+// directory dir to the file at destination, and
+// returns the descriptor of the layer.
+func (l *OCILayer) BuildFile(dir, destination string) (OCILayerDescriptor, error) {
+	if !l.OverwriteExisting && fileExists(destination) {
+		return OCILayerDescriptor{}, &PathError{Path: destination, Err: ErrDestinationExists}
+	}
+	out, err := os.Create(destination)
+	if err != nil {
+		return OCILayerDescriptor{}, fmt.Errorf("creating %s: %w", destination, err)
+	}
+	defer out.Close()
+
+	desc, err := l.Build(dir, out)
+	if err != nil {
+		return desc, err
+	}
+	return desc, out.Close()
+}
+
+// writeWhiteouts writes the whiteout files of l,
+// in lexical order, to tw.
+func (l *OCILayer) writeWhiteouts(tw *tar.Writer) error {
+	var names []string
+	for _, p := range l.Whiteouts {
+		p = path.Clean(strings.TrimPrefix(p, "/"))
+		if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+			return pathErrorf(ErrIllegalPath, p, "invalid whiteout path: %s", p)
+		}
+		names = append(names, path.Join(path.Dir(p), ociWhiteoutPrefix+path.Base(p)))
+	}
+	for _, p := range l.OpaqueDirs {
+		p = path.Clean(strings.TrimPrefix(p, "/"))
+		if p == ".." || strings.HasPrefix(p, "../") {
+			return pathErrorf(ErrIllegalPath, p, "invalid opaque directory path: %s", p)
+		}
+		names = append(names, path.Join(p, ociOpaqueWhiteout))
+	}
+	sort.Strings(names)
+
+	modTime := l.ModTime
+	if modTime.IsZero() {
+		modTime = time.Unix(0, 0)
+	}
+	for _, name := range names {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0644,
+			ModTime:  modTime,
+		}
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			return fmt.Errorf("%s: writing whiteout: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// writeFile writes the file at fpath, which
+// has the given info, to tw as name.
+func (l *OCILayer) writeFile(tw *tar.Writer, fpath, name string, info os.FileInfo) error {
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		link, err = os.Readlink(fpath)
+		if err != nil {
+			return fmt.Errorf("%s: reading symbolic link: %w", fpath, err)
+		}
+	}
+	if info.Mode()&os.ModeSocket != 0 {
+		return nil // sockets cannot be stored in tarballs
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return fmt.Errorf("%s: making header: %w", fpath, err)
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	hdr.Uid, hdr.Gid = 0, 0
+	hdr.Uname, hdr.Gname = "", ""
+	hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+	if l.ModTime.IsZero() {
+		hdr.ModTime = hdr.ModTime.Truncate(time.Second)
+	} else {
+		hdr.ModTime = l.ModTime
+	}
+
+	err = tw.WriteHeader(hdr)
+	if err != nil {
+		return fmt.Errorf("%s: writing header: %w", name, err)
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil
+	}
+
+	file, err := os.Open(fpath)
+	if err != nil {
+		return fmt.Errorf("%s: opening: %w", fpath, err)
+	}
+	defer file.Close()
+	_, err = io.Copy(tw, file)
+	if err != nil {
+		return fmt.Errorf("%s: copying contents: %w", fpath, err)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// sha256Digest returns the digest of h in the
+// "algorithm:hex" form used by OCI images.
+func sha256Digest(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+const (
+	ociWhiteoutPrefix = ".wh."
+	ociOpaqueWhiteout = ".wh..wh..opq"
+)
+
+// DefaultOCILayer is a convenient layer builder ready to use.
+var DefaultOCILayer = &OCILayer{
+	CompressionLevel: gzip.DefaultCompression,
+}
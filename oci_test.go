@@ -0,0 +1,111 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestOCILayer(t *testing.T) {
+	l := &OCILayer{
+		CompressionLevel: gzip.DefaultCompression,
+		ModTime:          time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Whiteouts:        []string{"etc/removed.conf", "/old"},
+		OpaqueDirs:       []string{"var/cache"},
+	}
+
+	buf := new(bytes.Buffer)
+	desc, err := l.Build("testdata", buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.MediaType != OCILayerGzipMediaType {
+		t.Errorf("expected media type %s, got %s", OCILayerGzipMediaType, desc.MediaType)
+	}
+	if desc.Size != int64(buf.Len()) {
+		t.Errorf("expected size %d, got %d", buf.Len(), desc.Size)
+	}
+	if expected := testDigest(buf.Bytes()); desc.Digest != expected {
+		t.Errorf("expected digest %s, got %s", expected, desc.Digest)
+	}
+
+	gzr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarBytes, err := ioutil.ReadAll(gzr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := testDigest(tarBytes); desc.DiffID != expected {
+		t.Errorf("expected diff ID %s, got %s", expected, desc.DiffID)
+	}
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(tarBytes))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		if hdr.Uid != 0 || hdr.Gid != 0 || hdr.Uname != "" || hdr.Gname != "" {
+			t.Errorf("%s: expected root ownership, got %d:%d (%s:%s)",
+				hdr.Name, hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname)
+		}
+		if !hdr.ModTime.Equal(l.ModTime) {
+			t.Errorf("%s: expected modification time %s, got %s", hdr.Name, l.ModTime, hdr.ModTime)
+		}
+		if hdr.Name[0] == '/' || hdr.Name[0] == '.' && hdr.Name[1] == '/' {
+			t.Errorf("%s: expected name relative to layer root", hdr.Name)
+		}
+	}
+
+	expectedFirst := []string{
+		".wh.old",
+		"etc/.wh.removed.conf",
+		"var/cache/.wh..wh..opq",
+	}
+	if len(names) <= len(expectedFirst) {
+		t.Fatalf("expected whiteouts and files in layer, got %v", names)
+	}
+	for i, name := range expectedFirst {
+		if names[i] != name {
+			t.Errorf("expected entry %d to be %s, got %s", i, name, names[i])
+		}
+	}
+
+	// the same files must make the same layer
+	buf2 := new(bytes.Buffer)
+	desc2, err := l.Build("testdata", buf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc2 != desc {
+		t.Errorf("expected identical descriptors for identical layers, got %+v and %+v", desc, desc2)
+	}
+
+	// uncompressed layers have the same digest and diff ID
+	l.Uncompressed = true
+	desc, err = l.Build("testdata", ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.MediaType != OCILayerMediaType || desc.Digest != desc.DiffID {
+		t.Errorf("unexpected descriptor of uncompressed layer: %+v", desc)
+	}
+}
+
+func testDigest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
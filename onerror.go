@@ -0,0 +1,93 @@
+package archiver
+
+import (
+	"fmt"
+	"io"
+)
+
+// ErrorAction is what to do about a file in an
+// archive which failed to be extracted.
+type ErrorAction int
+
+const (
+	// ErrorAbort stops extracting with the error.
+	ErrorAbort ErrorAction = iota
+
+	// ErrorSkip skips the file and continues
+	// with the next one.
+	ErrorSkip
+
+	// ErrorRetry tries to extract the file again. An
+	// incomplete file left behind by the failed attempt
+	// is overwritten. Files in tarballs whose contents
+	// were read by the failed attempt cannot be tried
+	// again, since tarballs are read as streams; trying
+	// them again fails with an error saying so.
+	ErrorRetry
+)
+
+// ErrorHandler decides what to do when extracting the
+// file named name, as named in the archive, fails with
+// err; failures is the number of times the file has
+// failed, starting at 1. If the handler of a format is
+// set, it is used instead of ContinueOnError for errors
+// with files. Errors reading the archive itself, rather
+// than a file in it, always stop extracting.
+type ErrorHandler func(name string, err error, failures int) ErrorAction
+
+// retryFile asks onError what to do about err, which
+// happened extracting the file named name, and tries
+// to extract it again by calling retry for as long as
+// onError says to. The retry function is given the
+// path of the incomplete file left behind by earlier
+// attempts, if any, which it may overwrite. If the
+// file is skipped, skipped is true.
+func retryFile(onError ErrorHandler, name string, err error, retry func(overwrite string) error) (skipped bool, _ error) {
+	var overwrite string
+	for failures := 1; ; failures++ {
+		switch onError(name, err, failures) {
+		case ErrorSkip:
+			return true, nil
+		case ErrorRetry:
+			if pfe, ok := err.(*partialFileError); ok {
+				overwrite = pfe.path
+			}
+			err = retry(overwrite)
+			if err == nil {
+				return false, nil
+			}
+		default:
+			return false, err
+		}
+	}
+}
+
+// partialFileError is an error writing a file which
+// was created, so that the file is incomplete.
+type partialFileError struct {
+	path string
+	err  error
+}
+
+func (e *partialFileError) Error() string { return e.err.Error() }
+
+func (e *partialFileError) Unwrap() error { return e.err }
+
+// readTracker records whether anything
+// was read from the reader r.
+type readTracker struct {
+	r    io.Reader
+	read bool
+}
+
+func (rt *readTracker) Read(p []byte) (int, error) {
+	n, err := rt.r.Read(p)
+	if n > 0 {
+		rt.read = true
+	}
+	return n, err
+}
+
+// errCannotReread is the error of trying a file again
+// whose contents were read and cannot be read again.
+var errCannotReread = fmt.Errorf("contents were already read and cannot be read again")
@@ -0,0 +1,146 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// flakyFileSystem is a MemFileSystem in which creating
+// or writing files fails a given number of times.
+type flakyFileSystem struct {
+	*MemFileSystem
+	failCreate map[string]int
+	failWrite  map[string]int
+}
+
+func (f *flakyFileSystem) Create(name string) (io.WriteCloser, error) {
+	if f.failCreate[name] > 0 {
+		f.failCreate[name]--
+		return nil, fmt.Errorf("no space left on device")
+	}
+	w, err := f.MemFileSystem.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if f.failWrite[name] > 0 {
+		f.failWrite[name]--
+		return failingWriter{w}, nil
+	}
+	return w, nil
+}
+
+// failingWriter writes part of what is written
+// to it, then fails.
+type failingWriter struct {
+	io.WriteCloser
+}
+
+func (w failingWriter) Write(p []byte) (int, error) {
+	n, _ := w.WriteCloser.Write(p[:len(p)/2])
+	return n, fmt.Errorf("no space left on device")
+}
+
+func TestOnError(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	expected, err := ioutil.ReadFile("testdata/already-compressed.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// files are extracted in order, so the first
+	// file fails and another one comes after it
+	failing := filepath.Join("out", "testdata", "already-compressed.jpg")
+	other := filepath.Join("out", "testdata", "quote1.txt")
+
+	for _, name := range []string{"test.tar", "test.zip"} {
+		archive := filepath.Join(tmp, name)
+		format, err := ByExtension(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = format.(Archiver).Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, tc := range []struct {
+			failCreate, failWrite int
+			retries               int // how many times to retry before skipping
+			abort                 bool
+			expectFailures        int
+			expectExtracted       bool
+		}{
+			{failCreate: 100, expectFailures: 1},
+			{failCreate: 100, abort: true, expectFailures: 1},
+			{failCreate: 2, retries: 5, expectFailures: 2, expectExtracted: true},
+			{failCreate: 100, retries: 2, expectFailures: 3},
+			{failWrite: 1, retries: 1, expectFailures: 1, expectExtracted: true},
+		} {
+			fsys := &flakyFileSystem{
+				MemFileSystem: NewMemFileSystem(nil),
+				failCreate:    map[string]int{failing: tc.failCreate},
+				failWrite:     map[string]int{failing: tc.failWrite},
+			}
+			var failures int
+			var lastErr error
+			onError := func(name string, err error, n int) ErrorAction {
+				if filepath.Join("out", name) != failing {
+					t.Errorf("Test %d: expected failure of %s, got %s: %v", i, failing, name, err)
+				}
+				failures, lastErr = n, err
+				switch {
+				case tc.abort:
+					return ErrorAbort
+				case n <= tc.retries:
+					return ErrorRetry
+				}
+				return ErrorSkip
+			}
+
+			var u Unarchiver
+			if name == "test.tar" {
+				u = &Tar{MkdirAll: true, ContinueOnError: true, FileSystem: fsys, OnError: onError}
+			} else {
+				u = &Zip{MkdirAll: true, ContinueOnError: true, FileSystem: fsys, OnError: onError}
+			}
+			err := u.Unarchive(archive, "out")
+			if tc.abort {
+				if err == nil {
+					t.Errorf("[%s] Test %d: expected error when aborting, but got none", name, i)
+				}
+			} else if err != nil {
+				t.Errorf("[%s] Test %d: unarchiving: %v", name, i, err)
+			}
+
+			// partly written files in tarballs cannot be tried again
+			expectFailures, expectExtracted := tc.expectFailures, tc.expectExtracted
+			if name == "test.tar" && tc.failWrite > 0 {
+				expectFailures, expectExtracted = 2, false
+				if lastErr == nil || !strings.Contains(lastErr.Error(), errCannotReread.Error()) {
+					t.Errorf("[%s] Test %d: expected error that contents cannot be read again, got %v", name, i, lastErr)
+				}
+			}
+			if failures != expectFailures {
+				t.Errorf("[%s] Test %d: expected %d failures, got %d", name, i, expectFailures, failures)
+			}
+			contents, err := fsys.ReadFile(failing)
+			extracted := err == nil && bytes.Equal(contents, expected)
+			if extracted != expectExtracted {
+				t.Errorf("[%s] Test %d: expected extracted to be %t, but was %t", name, i, expectExtracted, extracted)
+			}
+			if _, err := fsys.Stat(other); (err == nil) == tc.abort {
+				t.Errorf("[%s] Test %d: expected other files to be extracted unless aborted (stat: %v)", name, i, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package archiver
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// OpenFile returns the contents of the file named name in
+// the archive file named archive, of the format indicated
+// by its extension, as ByExtension, without extracting it.
+// The archive is read up to the file, which can be read
+// from the returned ReadCloser as it is read from the
+// archive, so there is no need to hold the file in memory
+// or on disk, even if the archive is a compressed tarball.
+// The ReadCloser must be closed when finished reading,
+// which closes the archive.
+//
+// Names are compared as by Update, so a leading slash or
+// a trailing slash makes no difference. Folders cannot
+// be opened.
+func OpenFile(archive, name string) (io.ReadCloser, error) {
+	format, err := ByExtension(archive)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := format.(Reader)
+	if !ok {
+		return nil, pathErrorf(ErrUnsupportedType, archive, "format %s cannot be read", format)
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, fmt.Errorf("opening archive: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("statting archive: %w", err)
+	}
+	err = r.Open(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("opening %s: %w", format, err)
+	}
+
+	rc, err := readFileNamed(r, cleanEntryPath(name))
+	if err != nil {
+		r.Close()
+		file.Close()
+		return nil, err
+	}
+	return &openedFile{ReadCloser: rc, r: r, file: file}, nil
+}
+
+// readFileNamed reads r up to the file named name,
+// and returns its contents.
+func readFileNamed(r Reader, name string) (io.ReadCloser, error) {
+	for {
+		f, err := r.Read()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s: not found in archive", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading archive: %w", err)
+		}
+		if entryPath(f) != name {
+			f.Close()
+			continue
+		}
+		if f.IsDir() {
+			f.Close()
+			return nil, fmt.Errorf("%s: is a folder", name)
+		}
+		return f.ReadCloser, nil
+	}
+}
+
+// openedFile is the contents of a file opened by
+// OpenFile, and the archive they are read from.
+type openedFile struct {
+	io.ReadCloser
+	r    Reader
+	file *os.File
+}
+
+func (f *openedFile) Close() error {
+	f.ReadCloser.Close()
+	f.r.Close()
+	return f.file.Close()
+}
@@ -0,0 +1,57 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	expected, err := ioutil.ReadFile("testdata/proverbs/proverb2.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []Archiver{
+		&TarGz{Tar: &Tar{}},
+		&Zip{},
+	} {
+		archive := filepath.Join(tmp, "test."+format.(interface{ String() string }).String())
+		err := format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rc, err := OpenFile(archive, "/testdata/proverbs/proverb2.txt")
+		if err != nil {
+			t.Fatalf("[%s] opening file: %v", archive, err)
+		}
+		actual, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("[%s] reading file: %v", archive, err)
+		}
+		err = rc.Close()
+		if err != nil {
+			t.Errorf("[%s] closing file: %v", archive, err)
+		}
+		if string(actual) != string(expected) {
+			t.Errorf("[%s] expected contents %q, got %q", archive, expected, actual)
+		}
+
+		_, err = OpenFile(archive, "testdata/proverbs")
+		if err == nil {
+			t.Errorf("[%s] expected an error opening a folder", archive)
+		}
+		_, err = OpenFile(archive, "testdata/missing.txt")
+		if err == nil {
+			t.Errorf("[%s] expected an error opening a missing file", archive)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// OpenPGP encrypts and decrypts streams as OpenPGP
+// messages (RFC 4880), like those of gpg, either with a
+// passphrase or with public and secret keys. Its Encrypt
+// and Decrypt methods are meant for TarEncrypted, to read
+// and write files such as ".tar.gz.gpg" and ".tgz.gpg":
+//
+//	pgp := archiver.OpenPGP{Keys: keys}
+//	tgzgpg := &archiver.TarEncrypted{
+//		Tar:     archiver.DefaultTar.Clone(),
+//		Gzip:    true,
+//		Encrypt: pgp.Encrypt,
+//		Decrypt: pgp.Decrypt,
+//	}
+//
+// Messages read may be armored (".asc"), and may be
+// compressed inside, as gpg does by default. Signatures
+// of messages are not checked.
+type OpenPGP struct {
+	// The public keys to encrypt messages to, and the
+	// secret keys to decrypt messages with, such as read
+	// by ReadOpenPGPKeys. If there are none, messages are
+	// encrypted with Passphrase.
+	Keys openpgp.EntityList
+
+	// The passphrase to encrypt messages with when there
+	// are no Keys, and to decrypt messages encrypted with
+	// a passphrase; it also unlocks secret keys which are
+	// protected with a passphrase.
+	Passphrase string
+}
+
+// Encrypt returns a writer which encrypts what is written
+// to it to o.Keys, or with o.Passphrase, and writes the
+// message to w. The message is complete once the writer
+// is closed, which does not close w.
+func (o OpenPGP) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	hints := &openpgp.FileHints{IsBinary: true}
+	config := &packet.Config{DefaultCipher: packet.CipherAES256}
+	if len(o.Keys) > 0 {
+		return openpgp.Encrypt(w, o.Keys, nil, hints, config)
+	}
+	if o.Passphrase == "" {
+		return nil, fmt.Errorf("no keys or passphrase to encrypt with")
+	}
+	return openpgp.SymmetricallyEncrypt(w, []byte(o.Passphrase), hints, config)
+}
+
+// Decrypt returns a reader of the contents of the message
+// read from r, decrypted with o.Keys or o.Passphrase. The
+// integrity of the contents is checked as they are read,
+// and reading them fails at the end if they were changed.
+// If neither can decrypt the message, the error is
+// ErrWrongPassword.
+func (o OpenPGP) Decrypt(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	start, _ := br.Peek(len(openPGPArmorStart))
+	r = br
+	if bytes.Equal(start, openPGPArmorStart) {
+		block, err := armor.Decode(br)
+		if err != nil {
+			return nil, fmt.Errorf("decoding armor: %w", err)
+		}
+		r = block.Body
+	}
+
+	prompted := false
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		// it is called again for as long as what it
+		// returns does not decrypt the message
+		if prompted || o.Passphrase == "" {
+			return nil, ErrWrongPassword
+		}
+		prompted = true
+		for _, k := range keys {
+			// keys which it cannot unlock are not used
+			k.PrivateKey.Decrypt([]byte(o.Passphrase))
+		}
+		return []byte(o.Passphrase), nil
+	}
+	md, err := openpgp.ReadMessage(r, o.Keys, prompt, nil)
+	if errors.Is(err, pgperrors.ErrKeyIncorrect) {
+		return nil, fmt.Errorf("%v: %w", err, ErrWrongPassword)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return md.UnverifiedBody, nil
+}
+
+// openPGPArmorStart is the start
+// of armored OpenPGP messages.
+var openPGPArmorStart = []byte("-----BEGIN PGP")
+
+// ReadOpenPGPKeys reads OpenPGP public or secret keys from
+// r, such as those exported by `gpg --export` (public) or
+// `gpg --export-secret-keys` (secret), armored or not.
+func ReadOpenPGPKeys(r io.Reader) (openpgp.EntityList, error) {
+	br := bufio.NewReader(r)
+	start, _ := br.Peek(len(openPGPArmorStart))
+	if bytes.Equal(start, openPGPArmorStart) {
+		return openpgp.ReadArmoredKeyRing(br)
+	}
+	return openpgp.ReadKeyRing(br)
+}
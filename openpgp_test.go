@@ -0,0 +1,83 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestOpenPGP(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := openpgp.NewEntity("Archiver Test", "", "test@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the secret key is read back as it
+	// would be from a file, armored
+	exported := new(bytes.Buffer)
+	aw, err := armor.Encode(exported, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = entity.SerializePrivate(aw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw.Close()
+	keys, err := ReadOpenPGPKeys(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := ioutil.ReadFile("testdata/quote1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tc := range []struct {
+		write, read OpenPGP
+		expectErr   error
+	}{
+		{write: OpenPGP{Passphrase: "secret"}, read: OpenPGP{Passphrase: "secret"}},
+		{write: OpenPGP{Passphrase: "secret"}, read: OpenPGP{Passphrase: "wrong"}, expectErr: ErrWrongPassword},
+		{write: OpenPGP{Passphrase: "secret"}, read: OpenPGP{}, expectErr: ErrWrongPassword},
+		{write: OpenPGP{Keys: keys}, read: OpenPGP{Keys: keys}},
+		{write: OpenPGP{Keys: keys}, read: OpenPGP{Passphrase: "secret"}, expectErr: ErrWrongPassword},
+	} {
+		archive := filepath.Join(tmp, fmt.Sprintf("test%d.tar.gz.gpg", i))
+		te := &TarEncrypted{Tar: new(Tar), Gzip: true, Encrypt: tc.write.Encrypt, Decrypt: tc.read.Decrypt}
+		err := te.Archive([]string{"testdata/quote1.txt"}, archive)
+		if err != nil {
+			t.Fatalf("Test %d: archiving: %v", i, err)
+		}
+
+		dest := filepath.Join(tmp, fmt.Sprint(i))
+		err = te.Unarchive(archive, dest)
+		if tc.expectErr != nil {
+			if !errors.Is(err, tc.expectErr) {
+				t.Errorf("Test %d: expected error %v, got %v", i, tc.expectErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: extracting: %v", i, err)
+		}
+		actual, err := ioutil.ReadFile(filepath.Join(dest, "testdata", "quote1.txt"))
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("Test %d: expected contents to be kept, got %q (%v)", i, actual, err)
+		}
+	}
+}
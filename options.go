@@ -0,0 +1,102 @@
+package archiver
+
+import "github.com/klauspost/compress/zstd"
+
+// Option configures a format made by one of the New
+// functions, such as NewTar or NewTarGz. Options which
+// do not apply to a format, such as a compression level
+// for Tar, are ignored, so the same options can be
+// given for any format.
+type Option func(format interface{})
+
+// applyOptions applies opts to each of formats in turn,
+// such as to a compressed tar format and its Tar.
+func applyOptions(opts []Option, formats ...interface{}) {
+	for _, opt := range opts {
+		for _, format := range formats {
+			opt(format)
+		}
+	}
+}
+
+// WithOverwrite returns an Option to overwrite
+// existing files when archiving and extracting.
+func WithOverwrite() Option {
+	return func(format interface{}) {
+		switch f := format.(type) {
+		case *Tar:
+			f.OverwriteExisting = true
+		case *Zip:
+			f.OverwriteExisting = true
+		}
+	}
+}
+
+// WithOverwritePolicy returns an Option to do as
+// policy says when a file being extracted exists.
+func WithOverwritePolicy(policy OverwritePolicy) Option {
+	return func(format interface{}) {
+		switch f := format.(type) {
+		case *Tar:
+			f.OverwritePolicy = policy
+		case *Zip:
+			f.OverwritePolicy = policy
+		}
+	}
+}
+
+// WithMkdirAll returns an Option to make the folders
+// which are needed, such as the one an archive is
+// written to or the ones files are extracted to.
+func WithMkdirAll() Option {
+	return func(format interface{}) {
+		switch f := format.(type) {
+		case *Tar:
+			f.MkdirAll = true
+		case *Zip:
+			f.MkdirAll = true
+		}
+	}
+}
+
+// WithCompressionLevel returns an Option to compress
+// at level, which means what it does for the format's
+// compression algorithm; for TarZst, it is converted
+// with zstd.EncoderLevelFromZstd.
+func WithCompressionLevel(level int) Option {
+	return func(format interface{}) {
+		switch f := format.(type) {
+		case *TarBz2:
+			f.CompressionLevel = level
+		case *TarGz:
+			f.CompressionLevel = level
+		case *TarLz4:
+			f.CompressionLevel = level
+		case *TarZst:
+			f.EncoderLevel = zstd.EncoderLevelFromZstd(level)
+		case *Zip:
+			f.CompressionLevel = level
+		}
+	}
+}
+
+// WithPreserveOwnership returns an Option to restore
+// the ownership of the files extracted from tarballs.
+func WithPreserveOwnership() Option {
+	return func(format interface{}) {
+		if t, ok := format.(*Tar); ok {
+			t.PreserveOwnership = true
+		}
+	}
+}
+
+// WithChown returns an Option to give the files
+// extracted from tarballs the owner user uid and
+// group gid, whatever the owners in their headers.
+func WithChown(uid, gid int) Option {
+	return func(format interface{}) {
+		if t, ok := format.(*Tar); ok {
+			t.Chown = &Owner{UID: uid, GID: gid}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package archiver
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestOptions(t *testing.T) {
+	tgz := NewTarGz(WithOverwrite(), WithMkdirAll(), WithCompressionLevel(gzip.BestSpeed))
+	if !tgz.OverwriteExisting || !tgz.MkdirAll || tgz.CompressionLevel != gzip.BestSpeed {
+		t.Errorf("expected options to be set, got %+v and %+v", tgz, tgz.Tar)
+	}
+	if tgz.Tar == DefaultTar {
+		t.Error("expected a new Tar, not DefaultTar")
+	}
+	if tgz := NewTarGz(); tgz.CompressionLevel != gzip.DefaultCompression || tgz.OverwriteExisting || tgz.MkdirAll {
+		t.Errorf("expected default settings, got %+v and %+v", tgz, tgz.Tar)
+	}
+	if tzst := NewTarZst(WithCompressionLevel(19)); tzst.EncoderLevel != zstd.SpeedBestCompression {
+		t.Errorf("expected encoder level %v, got %v", zstd.SpeedBestCompression, tzst.EncoderLevel)
+	}
+	if z := NewZip(WithOverwrite()); !z.OverwriteExisting || !z.SelectiveCompression {
+		t.Errorf("expected options to be set, got %+v", z)
+	}
+
+	// options which do not apply are ignored
+	if tr := NewTar(WithCompressionLevel(1), WithMkdirAll()); !tr.MkdirAll {
+		t.Errorf("expected MkdirAll to be set, got %+v", tr)
+	}
+
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	archive := filepath.Join(tmp, "new", "folder", "test.tar.gz")
+	for i := 0; i < 2; i++ {
+		err := tgz.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatalf("archiving %d: %v", i, err)
+		}
+	}
+}
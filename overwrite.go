@@ -0,0 +1,123 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OverwritePolicy is what to do when a file being
+// extracted already exists. Folders which exist are
+// always used as they are.
+type OverwritePolicy int
+
+const (
+	// OverwriteError fails with an error which is
+	// ErrDestinationExists; but if OverwriteExisting is
+	// true, OverwriteAlways is used instead.
+	OverwriteError OverwritePolicy = iota
+
+	// OverwriteSkip keeps the existing file, and skips
+	// the file being extracted.
+	OverwriteSkip
+
+	// OverwriteAlways replaces the existing file. If
+	// it is a symbolic link, the link is replaced, not
+	// the file it links to.
+	OverwriteAlways
+
+	// OverwriteOlder replaces the existing file, as
+	// OverwriteAlways does, if it was modified before
+	// the file being extracted, and otherwise skips the
+	// file being extracted.
+	OverwriteOlder
+
+	// OverwriteRenameNew keeps the existing file, and
+	// extracts the file to a new name made by adding
+	// " (1)", " (2)" and so on before its extension,
+	// such as "notes (1).txt".
+	OverwriteRenameNew
+)
+
+// overwritePolicy returns the policy in effect
+// given policy and OverwriteExisting.
+func overwritePolicy(policy OverwritePolicy, overwriteExisting bool) OverwritePolicy {
+	if policy == OverwriteError && overwriteExisting {
+		return OverwriteAlways
+	}
+	return policy
+}
+
+// symlinkRemover is a FileSystem which can remove
+// symbolic links, so that files replacing them are
+// not written to the files they link to.
+type symlinkRemover interface {
+	RemoveSymlink(name string) error
+}
+
+// RemoveSymlink removes the file named name if it
+// is a symbolic link, and otherwise does nothing.
+func (OSFileSystem) RemoveSymlink(name string) error {
+	info, err := os.Lstat(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	return os.Remove(name)
+}
+
+// replaceExisting gets to ready to be replaced, by
+// removing it if it is a symbolic link.
+func replaceExisting(fsys FileSystem, to string) (string, error) {
+	remover, ok := fsys.(symlinkRemover)
+	if !ok {
+		return to, nil
+	}
+	err := remover.RemoveSymlink(to)
+	if err != nil {
+		return "", fmt.Errorf("%s: removing symbolic link: %w", to, err)
+	}
+	return to, nil
+}
+
+// resolveExisting returns the path to extract f to, which
+// is to unless it exists (as reported by exists) and the
+// policy renames it, or "" if f is to be skipped.
+func resolveExisting(fsys FileSystem, policy OverwritePolicy, f File, to string, exists func(name string) bool) (string, error) {
+	if policy == OverwriteAlways {
+		return replaceExisting(fsys, to)
+	}
+	if !exists(to) {
+		return to, nil
+	}
+	switch policy {
+	case OverwriteSkip:
+		return "", nil
+	case OverwriteOlder:
+		info, err := fsys.Stat(to)
+		if err != nil {
+			return "", fmt.Errorf("%s: stat: %w", to, err)
+		}
+		if info.ModTime().Before(f.ModTime()) {
+			return replaceExisting(fsys, to)
+		}
+		return "", nil
+	case OverwriteRenameNew:
+		ext := filepath.Ext(to)
+		base := strings.TrimSuffix(to, ext)
+		for i := 1; ; i++ {
+			name := fmt.Sprintf("%s (%d)%s", base, i, ext)
+			if !exists(name) {
+				return name, nil
+			}
+		}
+	default:
+		return "", &PathError{Path: to, Err: ErrDestinationExists}
+	}
+}
@@ -0,0 +1,186 @@
+package archiver
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestOverwritePolicy(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src", "a.txt")
+	err = os.MkdirAll(filepath.Dir(src), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(src, []byte("archived"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = os.Chtimes(src, archived, archived)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []interface {
+		Archiver
+		Unarchiver
+		ResultReporter
+	}{
+		&Tar{},
+		&Zip{},
+	} {
+		ext := format.(interface{ String() string }).String()
+		archive := filepath.Join(tmp, "test."+ext)
+		err := format.Archive([]string{filepath.Dir(src)}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest := filepath.Join(tmp, ext)
+		existing := filepath.Join(dest, "src", "a.txt")
+
+		for i, tc := range []struct {
+			policy   OverwritePolicy
+			modTime  time.Time // of the existing file
+			expected string    // contents of the existing file afterward
+			renamed  string    // file the archived file is extracted to instead
+			skipped  bool
+		}{
+			{policy: OverwriteError, expected: "existing"},
+			{policy: OverwriteSkip, expected: "existing", skipped: true},
+			{policy: OverwriteAlways, expected: "archived"},
+			{policy: OverwriteOlder, modTime: archived.AddDate(-1, 0, 0), expected: "archived"},
+			{policy: OverwriteOlder, modTime: archived.AddDate(1, 0, 0), expected: "existing", skipped: true},
+			{policy: OverwriteRenameNew, expected: "existing", renamed: "src/a (1).txt"},
+		} {
+			os.RemoveAll(dest)
+			err := os.MkdirAll(filepath.Dir(existing), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ioutil.WriteFile(existing, []byte("existing"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.modTime.IsZero() {
+				err = os.Chtimes(existing, tc.modTime, tc.modTime)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			switch f := format.(type) {
+			case *Tar:
+				f.OverwritePolicy = tc.policy
+			case *Zip:
+				f.OverwritePolicy = tc.policy
+			}
+			err = format.Unarchive(archive, dest)
+			if tc.policy == OverwriteError {
+				if !errors.Is(err, ErrDestinationExists) {
+					t.Errorf("[%s] test %d: expected error for existing file, got %v", ext, i, err)
+				}
+			} else if err != nil {
+				t.Errorf("[%s] test %d: unexpected error: %v", ext, i, err)
+				continue
+			}
+
+			contents, err := ioutil.ReadFile(existing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(contents) != tc.expected {
+				t.Errorf("[%s] test %d: expected existing file to contain %q, got %q", ext, i, tc.expected, contents)
+			}
+			if tc.renamed != "" {
+				contents, err := ioutil.ReadFile(filepath.Join(dest, filepath.FromSlash(tc.renamed)))
+				if err != nil || string(contents) != "archived" {
+					t.Errorf("[%s] test %d: expected file extracted to %s, got %q (%v)", ext, i, tc.renamed, contents, err)
+				}
+			}
+			if skipped := format.Result().Skipped == 1; tc.policy != OverwriteError && skipped != tc.skipped {
+				t.Errorf("[%s] test %d: expected skipped to be %t, got result %+v", ext, i, tc.skipped, format.Result())
+			}
+		}
+	}
+}
+
+func TestOverwriteSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("making symbolic links may not be permitted on Windows")
+	}
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src", "a.txt")
+	err = os.MkdirAll(filepath.Dir(src), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(src, []byte("archived"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(tmp, "outside.txt")
+
+	for i, format := range []interface {
+		Archiver
+		Unarchiver
+	}{
+		&Tar{OverwritePolicy: OverwriteAlways},
+		&Zip{OverwritePolicy: OverwriteAlways},
+	} {
+		ext := format.(interface{ String() string }).String()
+		archive := filepath.Join(tmp, "test."+ext)
+		err := format.Archive([]string{filepath.Dir(src)}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(outside, []byte("outside"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dest := filepath.Join(tmp, ext)
+		existing := filepath.Join(dest, "src", "a.txt")
+		err = os.MkdirAll(filepath.Dir(existing), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Symlink(outside, existing)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = format.Unarchive(archive, dest)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		contents, err := ioutil.ReadFile(outside)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != "outside" {
+			t.Errorf("Test %d: expected target of symbolic link to be kept, got %q", i, contents)
+		}
+		info, err := os.Lstat(existing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.Mode().IsRegular() {
+			t.Errorf("Test %d: expected symbolic link to be replaced by a file, got mode %v", i, info.Mode())
+		}
+	}
+}
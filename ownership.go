@@ -0,0 +1,199 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// IDMap maps the user or group IDs of the files in an
+// archive to the IDs they are owned by when extracted,
+// as the ID maps of Linux user namespaces do, such as to
+// extract the root filesystem of a container into a user
+// namespace whose IDs are shifted. IDs which no range
+// maps are not mapped at all. To shift all IDs by an
+// offset, use a single range from 0 of every ID:
+//
+//	archiver.IDMap{{ArchiveID: 0, HostID: 100000, Size: 65536}}
+type IDMap []IDMapRange
+
+// IDMapRange maps Size IDs of an archive, from ArchiveID,
+// to as many IDs from HostID.
+type IDMapRange struct {
+	ArchiveID int
+	HostID    int
+	Size      int
+}
+
+// Map returns the ID which id in an archive is mapped
+// to, and false if no range of m maps it.
+func (m IDMap) Map(id int) (int, bool) {
+	for _, r := range m {
+		if id >= r.ArchiveID && id-r.ArchiveID < r.Size {
+			return r.HostID + id - r.ArchiveID, true
+		}
+	}
+	return 0, false
+}
+
+// ParseIDMap parses an ID map written as ranges separated
+// by commas, each of which is the first ID in the archive,
+// the first ID it is mapped to and the number of IDs,
+// separated by colons, as for the --uidmap option of
+// podman; for example, "0:100000:65536".
+func ParseIDMap(s string) (IDMap, error) {
+	var m IDMap
+	for _, field := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(field), ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid ID map range %q: must be archive ID:host ID:size", field)
+		}
+		var ids [3]int
+		for i, part := range parts {
+			id, err := strconv.Atoi(part)
+			if err != nil || id < 0 {
+				return nil, fmt.Errorf("invalid ID map range %q: %q is not an ID", field, part)
+			}
+			ids[i] = id
+		}
+		m = append(m, IDMapRange{ArchiveID: ids[0], HostID: ids[1], Size: ids[2]})
+	}
+	return m, nil
+}
+
+// Owner is the user and group
+// which own a file, by ID.
+type Owner struct {
+	UID int
+	GID int
+}
+
+// chowner is a FileSystem which can change
+// the ownership of files.
+type chowner interface {
+	Lchown(name string, uid, gid int) error
+}
+
+// Lchown changes the owner user and group of the file
+// named name, like os.Lchown; for symbolic links, it
+// changes the ownership of the link.
+func (OSFileSystem) Lchown(name string, uid, gid int) error { return os.Lchown(name, uid, gid) }
+
+// restoreOwnerIn gives the file at fpath in fsys the
+// owner user uid and group gid, mapped by users and
+// groups (unless they are nil), and returns a non-empty
+// reason if it cannot, to be warned about.
+func restoreOwnerIn(fsys FileSystem, fpath string, uid, gid int, users, groups IDMap) string {
+	ownerFS, ok := fsys.(chowner)
+	if !ok {
+		return "file system cannot change ownership"
+	}
+	if users != nil {
+		mapped, ok := users.Map(uid)
+		if !ok {
+			return fmt.Sprintf("user ID %d is not mapped", uid)
+		}
+		uid = mapped
+	}
+	if groups != nil {
+		mapped, ok := groups.Map(gid)
+		if !ok {
+			return fmt.Sprintf("group ID %d is not mapped", gid)
+		}
+		gid = mapped
+	}
+	err := ownerFS.Lchown(fpath, uid, gid)
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// ownerNames looks up users and groups on the host by ID
+// and by name, remembering what it finds, since tarballs
+// have the names of the owners of files as well as their
+// IDs, and most files have the same few owners.
+type ownerNames struct {
+	userNames  map[int]string // "" if not found
+	groupNames map[int]string
+	userIDs    map[string]int // -1 if not found
+	groupIDs   map[string]int
+}
+
+// userName returns the name of the user uid,
+// or "" if it is not found.
+func (o *ownerNames) userName(uid int) string {
+	if o.userNames == nil {
+		o.userNames = make(map[int]string)
+	}
+	name, ok := o.userNames[uid]
+	if !ok {
+		if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+			name = u.Username
+		}
+		o.userNames[uid] = name
+	}
+	return name
+}
+
+// groupName returns the name of the group gid,
+// or "" if it is not found.
+func (o *ownerNames) groupName(gid int) string {
+	if o.groupNames == nil {
+		o.groupNames = make(map[int]string)
+	}
+	name, ok := o.groupNames[gid]
+	if !ok {
+		if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+			name = g.Name
+		}
+		o.groupNames[gid] = name
+	}
+	return name
+}
+
+// userID returns the ID of the user named name, and
+// false if it is not found or its ID is not a number.
+func (o *ownerNames) userID(name string) (int, bool) {
+	if name == "" {
+		return 0, false
+	}
+	if o.userIDs == nil {
+		o.userIDs = make(map[string]int)
+	}
+	id, ok := o.userIDs[name]
+	if !ok {
+		id = -1
+		if u, err := user.Lookup(name); err == nil {
+			if n, err := strconv.Atoi(u.Uid); err == nil {
+				id = n
+			}
+		}
+		o.userIDs[name] = id
+	}
+	return id, id >= 0
+}
+
+// groupID returns the ID of the group named name, and
+// false if it is not found or its ID is not a number.
+func (o *ownerNames) groupID(name string) (int, bool) {
+	if name == "" {
+		return 0, false
+	}
+	if o.groupIDs == nil {
+		o.groupIDs = make(map[string]int)
+	}
+	id, ok := o.groupIDs[name]
+	if !ok {
+		id = -1
+		if g, err := user.LookupGroup(name); err == nil {
+			if n, err := strconv.Atoi(g.Gid); err == nil {
+				id = n
+			}
+		}
+		o.groupIDs[name] = id
+	}
+	return id, id >= 0
+}
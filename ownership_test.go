@@ -0,0 +1,277 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestIDMap(t *testing.T) {
+	m, err := ParseIDMap("0:100000:1000, 1000:1000:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := IDMap{{ArchiveID: 0, HostID: 100000, Size: 1000}, {ArchiveID: 1000, HostID: 1000, Size: 1}}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+
+	for i, tc := range []struct {
+		id       int
+		expect   int
+		expectOK bool
+	}{
+		{id: 0, expect: 100000, expectOK: true},
+		{id: 999, expect: 100999, expectOK: true},
+		{id: 1000, expect: 1000, expectOK: true},
+		{id: 1001},
+	} {
+		got, ok := m.Map(tc.id)
+		if ok != tc.expectOK || got != tc.expect {
+			t.Errorf("Test %d: expected %d to map to %d (%t), got %d (%t)", i, tc.id, tc.expect, tc.expectOK, got, ok)
+		}
+	}
+
+	for _, s := range []string{"", "0:1", "0:1:x", "-1:0:1"} {
+		if _, err := ParseIDMap(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
+
+func TestUserMap(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755, Uid: 5, Gid: 7},
+		{Name: "dir/file.txt", Typeflag: tar.TypeReg, Mode: 0644, Uid: 5, Gid: 7},
+		{Name: "unmapped.txt", Typeflag: tar.TypeReg, Mode: 0644, Uid: 500, Gid: 7},
+	} {
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+
+	tr := &Tar{
+		MkdirAll: true,
+		UserMap:  IDMap{{ArchiveID: 0, HostID: 1000, Size: 100}},
+		GroupMap: IDMap{{ArchiveID: 0, HostID: 2000, Size: 100}},
+	}
+	err = tr.UnarchiveReader(bytes.NewReader(buf.Bytes()), tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only root can give files to other users
+	expectWarnings := 1
+	if os.Geteuid() != 0 || runtime.GOOS == "windows" {
+		expectWarnings = 3
+	}
+	if len(tr.Warnings()) != expectWarnings {
+		t.Errorf("expected %d warnings, got %v", expectWarnings, tr.Warnings())
+	}
+	if expectWarnings > 1 {
+		return
+	}
+	for _, name := range []string{"dir", "dir/file.txt"} {
+		info, err := os.Stat(filepath.Join(tmp, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uid, gid, ok := fileOwner(info.Sys())
+		if ok && (uid != 1005 || gid != 2007) {
+			t.Errorf("%s: expected owner 1005:2007, got %d:%d", name, uid, gid)
+		}
+	}
+}
+
+func TestPreserveOwnershipAndChown(t *testing.T) {
+	if os.Geteuid() != 0 || runtime.GOOS == "windows" {
+		t.Skip("changing ownership requires root")
+	}
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	err = tw.WriteHeader(&tar.Header{Name: "file.txt", Typeflag: tar.TypeReg, Mode: 0644, Uid: 5, Gid: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+
+	for i, tc := range []struct {
+		tar       *Tar
+		expectUID int
+		expectGID int
+	}{
+		{tar: NewTar(WithPreserveOwnership()), expectUID: 5, expectGID: 7},
+		{tar: NewTar(WithChown(1234, 5678)), expectUID: 1234, expectGID: 5678},
+		{tar: NewTar(WithPreserveOwnership(), WithChown(1234, 5678)), expectUID: 1234, expectGID: 5678},
+		{tar: &Tar{Chown: &Owner{UID: 1234, GID: 5678}, UserMap: IDMap{{ArchiveID: 0, HostID: 1000, Size: 10000}}}, expectUID: 1234, expectGID: 5678},
+	} {
+		dest := filepath.Join(tmp, fmt.Sprint(i))
+		tc.tar.MkdirAll = true
+		err := tc.tar.UnarchiveReader(bytes.NewReader(buf.Bytes()), dest)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		if len(tc.tar.Warnings()) > 0 {
+			t.Errorf("Test %d: expected no warnings, got %v", i, tc.tar.Warnings())
+		}
+		info, err := os.Stat(filepath.Join(dest, "file.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uid, gid, ok := fileOwner(info.Sys())
+		if ok && (uid != tc.expectUID || gid != tc.expectGID) {
+			t.Errorf("Test %d: expected owner %d:%d, got %d:%d", i, tc.expectUID, tc.expectGID, uid, gid)
+		}
+	}
+}
+
+func TestKeepSetuidWithOwnership(t *testing.T) {
+	if os.Geteuid() != 0 || runtime.GOOS == "windows" {
+		t.Skip("changing ownership requires root")
+	}
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	err = tw.WriteHeader(&tar.Header{Name: "prog", Typeflag: tar.TypeReg, Mode: 06755, Size: 2, Uid: 5, Gid: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte("hi"))
+	tw.Close()
+
+	for i, tc := range []*Tar{
+		{KeepSetuid: true, PreserveOwnership: true, NumericOwner: true},
+		{KeepSetuid: true, Chown: &Owner{UID: 1234, GID: 5678}},
+	} {
+		dest := filepath.Join(tmp, fmt.Sprint(i))
+		tc.MkdirAll = true
+		err := tc.UnarchiveReader(bytes.NewReader(buf.Bytes()), dest)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		info, err := os.Stat(filepath.Join(dest, "prog"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := os.ModeSetuid | os.ModeSetgid; info.Mode()&expect != expect {
+			t.Errorf("Test %d: expected setuid and setgid bits to be kept, got mode %v", i, info.Mode())
+		}
+		if info.Mode().Perm() != 0755 {
+			t.Errorf("Test %d: expected permissions to be kept, got mode %v", i, info.Mode())
+		}
+	}
+}
+
+func TestRecordOwner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("files have no owner IDs on Windows")
+	}
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	archive := filepath.Join(tmp, "test.tar")
+	tr := &Tar{}
+	err = tr.Archive([]string{"testdata/quote1.txt"}, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.Walk(archive, func(f File) error {
+		hdr := f.Header.(*tar.Header)
+		if hdr.Uid != os.Getuid() || hdr.Gid != os.Getgid() {
+			t.Errorf("expected owner %d:%d, got %d:%d", os.Getuid(), os.Getgid(), hdr.Uid, hdr.Gid)
+		}
+		if u, err := user.LookupId(strconv.Itoa(hdr.Uid)); err == nil && hdr.Uname != u.Username {
+			t.Errorf("expected user name %q, got %q", u.Username, hdr.Uname)
+		}
+		if g, err := user.LookupGroupId(strconv.Itoa(hdr.Gid)); err == nil && hdr.Gname != g.Name {
+			t.Errorf("expected group name %q, got %q", g.Name, hdr.Gname)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNumericOwner(t *testing.T) {
+	if os.Geteuid() != 0 || runtime.GOOS == "windows" {
+		t.Skip("changing ownership requires root")
+	}
+	root, err := user.LookupId("0")
+	if err != nil {
+		t.Skip("user of ID 0 cannot be looked up")
+	}
+	rootGroup, err := user.LookupGroupId("0")
+	if err != nil {
+		t.Skip("group of ID 0 cannot be looked up")
+	}
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	err = tw.WriteHeader(&tar.Header{Name: "file.txt", Typeflag: tar.TypeReg, Mode: 0644, Uid: 5, Gid: 7, Uname: root.Username, Gname: rootGroup.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+
+	for i, tc := range []struct {
+		numeric   bool
+		expectUID int
+		expectGID int
+	}{
+		{numeric: false, expectUID: 0, expectGID: 0},
+		{numeric: true, expectUID: 5, expectGID: 7},
+	} {
+		dest := filepath.Join(tmp, fmt.Sprint(i))
+		tr := &Tar{MkdirAll: true, PreserveOwnership: true, NumericOwner: tc.numeric}
+		err := tr.UnarchiveReader(bytes.NewReader(buf.Bytes()), dest)
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		info, err := os.Stat(filepath.Join(dest, "file.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		uid, gid, ok := fileOwner(info.Sys())
+		if ok && (uid != tc.expectUID || gid != tc.expectGID) {
+			t.Errorf("Test %d: expected owner %d:%d, got %d:%d", i, tc.expectUID, tc.expectGID, uid, gid)
+		}
+	}
+}
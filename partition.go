@@ -0,0 +1,276 @@
+package archiver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Partitioner creates multiple archives from a list of
+// sources, splitting the files among them by size and/or
+// by a logical group, which is useful when the archives
+// are uploaded to targets that limit object sizes.
+type Partitioner struct {
+	// The format to write each part in, for example
+	// &Tar{} or &TarGz{Tar: &Tar{}}. The same Writer
+	// is used to create every part, one at a time.
+	Format Writer
+
+	// The maximum total size, in bytes, of the file
+	// contents in each part; 0 means no limit. The size
+	// of archive headers and the effect of compression
+	// are not taken into account. A file which is bigger
+	// than this on its own gets a part to itself.
+	MaxSize int64
+
+	// If set, GroupBy is called with the name of each
+	// file in the archive (slash-separated) and returns
+	// the name of the group the file belongs to. Files
+	// in different groups are never put in the same part.
+	GroupBy func(path string) string
+
+	// Whether to overwrite existing files; if false,
+	// an error is returned if a part already exists.
+	OverwriteExisting bool
+
+	// If set, the manifest is also written as JSON
+	// to the file with this name.
+	ManifestFile string
+
+	// If true, errors encountered while reading or
+	// writing a single file will be logged and the
+	// operation will continue on remaining files.
+	ContinueOnError bool
+
+	// If set, errors skipped because of ContinueOnError
+	// are logged to this logger instead of the logger of
+	// the error log policy.
+	Logger Logger
+}
+
+// PartitionManifest describes the parts made by
+// Partition and which files went into which part.
+type PartitionManifest struct {
+	Parts []PartitionPart `json:"parts"`
+}
+
+// PartitionPart is a single archive made by Partition.
+type PartitionPart struct {
+	Filename string   `json:"filename"`
+	Group    string   `json:"group,omitempty"`
+	Size     int64    `json:"size"`
+	Entries  []string `json:"entries"`
+}
+
+// Part returns the part which contains the
+// file with the given name in the archive.
+func (m PartitionManifest) Part(name string) (PartitionPart, bool) {
+	for _, part := range m.Parts {
+		for _, entry := range part.Entries {
+			if entry == name {
+				return part, true
+			}
+		}
+	}
+	return PartitionPart{}, false
+}
+
+// Partition archives the files listed in sources into
+// as many parts as needed. The name of each part is
+// derived from destination by inserting the group name
+// (if any) and part number before the extension; for
+// example, "backup.tar.gz" may become the parts named
+// "backup-docs-001.tar.gz" and "backup-docs-002.tar.gz".
+func (p *Partitioner) Partition(sources []string, destination string) (PartitionManifest, error) {
+	var manifest PartitionManifest
+	if p.Format == nil {
+		return manifest, fmt.Errorf("no format specified")
+	}
+
+	var groups []string
+	entries := make(map[string][]partitionEntry)
+	for _, source := range sources {
+		err := p.collect(source, func(e partitionEntry) {
+			var group string
+			if p.GroupBy != nil {
+				group = p.GroupBy(e.name)
+			}
+			if _, ok := entries[group]; !ok {
+				groups = append(groups, group)
+			}
+			entries[group] = append(entries[group], e)
+		})
+		if err != nil {
+			return manifest, fmt.Errorf("walking %s: %w", source, err)
+		}
+	}
+
+	// assign the files of each group, in order, to
+	// parts; a new part is started whenever the next
+	// file would make the current one too big
+	var parts [][]partitionEntry
+	for _, group := range groups {
+		var current []partitionEntry
+		var size int64
+		for _, e := range entries[group] {
+			if p.MaxSize > 0 && len(current) > 0 && size+e.size() > p.MaxSize {
+				parts = append(parts, current)
+				manifest.Parts = append(manifest.Parts, PartitionPart{Group: group, Size: size})
+				current, size = nil, 0
+			}
+			current = append(current, e)
+			size += e.size()
+		}
+		if len(current) > 0 {
+			parts = append(parts, current)
+			manifest.Parts = append(manifest.Parts, PartitionPart{Group: group, Size: size})
+		}
+	}
+
+	// number the parts within each group and write them
+	counts := make(map[string]int)
+	for i, part := range parts {
+		mp := &manifest.Parts[i]
+		counts[mp.Group]++
+		mp.Filename = partitionFilename(destination, mp.Group, counts[mp.Group])
+		for _, e := range part {
+			mp.Entries = append(mp.Entries, e.name)
+		}
+		err := p.writePart(mp.Filename, part)
+		if err != nil {
+			return manifest, fmt.Errorf("writing part %s: %w", mp.Filename, err)
+		}
+	}
+
+	if p.ManifestFile != "" {
+		data, err := json.MarshalIndent(manifest, "", "\t")
+		if err != nil {
+			return manifest, fmt.Errorf("encoding manifest: %w", err)
+		}
+		err = ioutil.WriteFile(p.ManifestFile, data, 0644)
+		if err != nil {
+			return manifest, fmt.Errorf("writing manifest: %w", err)
+		}
+	}
+
+	return manifest, nil
+}
+
+// collect walks source and calls add for each file
+// found, along with the name it should have in the
+// archive.
+func (p *Partitioner) collect(source string, add func(partitionEntry)) error {
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("%s: stat: %w", source, err)
+	}
+	baseDir := makeBaseDir("", sourceInfo)
+
+	return filepath.Walk(source, func(fpath string, info os.FileInfo, err error) error {
+		handleErr := func(err error) error {
+			if p.ContinueOnError {
+				logError(p.Logger, "Walking %s: %v", fpath, err)
+				return nil
+			}
+			return err
+		}
+		if err != nil {
+			return handleErr(fmt.Errorf("traversing %s: %w", fpath, err))
+		}
+		if info == nil {
+			return handleErr(fmt.Errorf("%s: no file info", fpath))
+		}
+
+		nameInArchive, err := makeNameInArchive(sourceInfo, source, baseDir, fpath)
+		if err != nil {
+			return handleErr(err)
+		}
+		add(partitionEntry{path: fpath, name: nameInArchive, info: info})
+		return nil
+	})
+}
+
+// writePart writes the archive named filename
+// containing the given entries.
+func (p *Partitioner) writePart(filename string, entries []partitionEntry) error {
+	if !p.OverwriteExisting && fileExists(filename) {
+		return &PathError{Path: filename, Err: ErrDestinationExists}
+	}
+
+	out, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", filename, err)
+	}
+	defer out.Close()
+
+	err = p.Format.Create(out)
+	if err != nil {
+		return fmt.Errorf("creating archive: %w", err)
+	}
+	defer p.Format.Close()
+
+	for _, e := range entries {
+		err := p.writeEntry(e)
+		if err != nil {
+			if p.ContinueOnError {
+				logError(p.Logger, "Writing %s: %v", e.path, err)
+				continue
+			}
+			return err
+		}
+	}
+
+	return p.Format.Close()
+}
+
+func (p *Partitioner) writeEntry(e partitionEntry) error {
+	file, err := os.Open(e.path)
+	if err != nil {
+		return fmt.Errorf("%s: opening: %w", e.path, err)
+	}
+	defer file.Close()
+
+	err = p.Format.Write(File{
+		FileInfo: FileInfo{
+			FileInfo:   e.info,
+			CustomName: e.name,
+		},
+		ReadCloser: file,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: writing: %w", e.path, err)
+	}
+	return nil
+}
+
+// partitionEntry is a file to be put in a part.
+type partitionEntry struct {
+	path string // path on disk
+	name string // name in the archive
+	info os.FileInfo
+}
+
+func (e partitionEntry) size() int64 {
+	if e.info.Mode().IsRegular() {
+		return e.info.Size()
+	}
+	return 0
+}
+
+// partitionFilename returns the name of the n-th part
+// of group, based on the filename of destination.
+func partitionFilename(destination, group string, n int) string {
+	dir, base := filepath.Split(destination)
+	stem, ext := base, ""
+	if firstDot := strings.Index(base, "."); firstDot > 0 {
+		stem, ext = base[:firstDot], base[firstDot:]
+	}
+	if group != "" {
+		group = strings.NewReplacer("/", "_", `\`, "_", ":", "_").Replace(group)
+		stem += "-" + group
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s-%03d%s", stem, n, ext))
+}
@@ -0,0 +1,79 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPartition(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	p := &Partitioner{
+		Format:  &Tar{},
+		MaxSize: 1, // forces one file per part
+		GroupBy: func(name string) string {
+			// group by second-level folder, i.e. testdata/<group>
+			parts := strings.SplitN(name, "/", 3)
+			if len(parts) < 3 {
+				return ""
+			}
+			return parts[1]
+		},
+		ManifestFile: filepath.Join(tmp, "manifest.json"),
+	}
+	manifest, err := p.Partition([]string{"testdata"}, filepath.Join(tmp, "backup.tar"))
+	if err != nil {
+		t.Fatalf("partitioning: %v", err)
+	}
+
+	var entryCount int
+	for _, part := range manifest.Parts {
+		if !fileExists(part.Filename) {
+			t.Errorf("part %s was not written", part.Filename)
+		}
+		var regular int
+		err := (&Tar{}).Walk(part.Filename, func(f File) error {
+			if f.Mode().IsRegular() {
+				regular++
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("walking part %s: %v", part.Filename, err)
+		}
+		if regular > 1 {
+			t.Errorf("part %s: expected at most 1 file but got %d", part.Filename, regular)
+		}
+		entryCount += len(part.Entries)
+	}
+
+	var expectedCount int
+	filepath.Walk("testdata", func(string, os.FileInfo, error) error {
+		expectedCount++
+		return nil
+	})
+	if entryCount != expectedCount {
+		t.Errorf("expected %d entries in manifest but got %d", expectedCount, entryCount)
+	}
+
+	part, ok := manifest.Part("testdata/proverbs/proverb1.txt")
+	if !ok {
+		t.Fatalf("expected proverb1.txt to be in the manifest")
+	}
+	if part.Group != "proverbs" {
+		t.Errorf("expected proverb1.txt to be in group 'proverbs' but got '%s'", part.Group)
+	}
+	if !strings.HasPrefix(filepath.Base(part.Filename), "backup-proverbs-") {
+		t.Errorf("unexpected part filename: %s", part.Filename)
+	}
+	if !fileExists(p.ManifestFile) {
+		t.Errorf("expected manifest to be written")
+	}
+}
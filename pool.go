@@ -0,0 +1,171 @@
+package archiver
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressors and decompressors can be costly to set up
+// (zstd encoders in particular allocate large tables and
+// windows), so instances are pooled and reset for reuse
+// across operations instead of being created every time.
+var (
+	gzipWriterPools [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+	gzipReaderPool  sync.Pool
+
+	zstdEncoderPools [zstd.SpeedBestCompression + 1]sync.Pool
+	zstdDecoderPool  sync.Pool
+)
+
+// getGzipWriter returns a gzip writer at the given
+// compression level which writes to w. It should be
+// returned with putGzipWriter after it is closed.
+func getGzipWriter(w io.Writer, level int) (*gzip.Writer, error) {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return gzip.NewWriterLevel(w, level) // for the error
+	}
+	if gzw, ok := gzipWriterPools[level-gzip.HuffmanOnly].Get().(*gzip.Writer); ok {
+		gzw.Reset(w)
+		return gzw, nil
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+// putGzipWriter returns gzw, which was obtained
+// with the given level, to its pool.
+func putGzipWriter(gzw *gzip.Writer, level int) {
+	gzw.Reset(nil)
+	gzipWriterPools[level-gzip.HuffmanOnly].Put(gzw)
+}
+
+// getGzipReader returns a gzip reader which reads from
+// r. It should be returned with putGzipReader when done.
+// The reader is in multistream mode, so concatenated gzip
+// members (as written by pigz and bgzip, for example) are
+// read as one stream, as required by RFC 1952.
+func getGzipReader(r io.Reader) (*gzip.Reader, error) {
+	if gzr, ok := gzipReaderPool.Get().(*gzip.Reader); ok {
+		err := gzr.Reset(r)
+		if err != nil {
+			gzipReaderPool.Put(gzr)
+			return nil, err
+		}
+		gzr.Multistream(true)
+		return gzr, nil
+	}
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	gzr.Multistream(true)
+	return gzr, nil
+}
+
+// putGzipReader returns gzr to its pool.
+func putGzipReader(gzr *gzip.Reader) {
+	gzr.Close()
+	gzipReaderPool.Put(gzr)
+}
+
+// getZstdEncoder returns a zstd encoder at the given
+// level which writes to w. It should be returned with
+// putZstdEncoder after it is closed.
+func getZstdEncoder(w io.Writer, level zstd.EncoderLevel) (*zstd.Encoder, error) {
+	if level < zstd.SpeedFastest || level > zstd.SpeedBestCompression {
+		level = zstd.SpeedDefault
+	}
+	if enc, ok := zstdEncoderPools[level].Get().(*zstd.Encoder); ok {
+		enc.Reset(w)
+		return enc, nil
+	}
+	// pooled encoders are not closed until they are
+	// garbage collected, so they must not spawn goroutines
+	return zstd.NewWriter(w,
+		zstd.WithEncoderLevel(level),
+		zstd.WithEncoderConcurrency(1))
+}
+
+// putZstdEncoder returns enc, which was obtained
+// with the given level, to its pool.
+func putZstdEncoder(enc *zstd.Encoder, level zstd.EncoderLevel) {
+	if level < zstd.SpeedFastest || level > zstd.SpeedBestCompression {
+		level = zstd.SpeedDefault
+	}
+	enc.Reset(nil)
+	zstdEncoderPools[level].Put(enc)
+}
+
+// getZstdDictEncoder is like getZstdEncoder, but the
+// encoder uses dict, if not empty, as its dictionary.
+// Since the dictionary of an encoder cannot be changed,
+// encoders with a dictionary are not pooled. It should
+// be returned with putZstdDictEncoder after it is closed.
+func getZstdDictEncoder(w io.Writer, level zstd.EncoderLevel, dict []byte) (*zstd.Encoder, error) {
+	if len(dict) == 0 {
+		return getZstdEncoder(w, level)
+	}
+	if level < zstd.SpeedFastest || level > zstd.SpeedBestCompression {
+		level = zstd.SpeedDefault
+	}
+	return zstd.NewWriter(w,
+		zstd.WithEncoderLevel(level),
+		zstd.WithEncoderConcurrency(1),
+		zstd.WithEncoderDict(dict))
+}
+
+// putZstdDictEncoder releases enc, which was obtained
+// with getZstdDictEncoder with the same level and dict.
+func putZstdDictEncoder(enc *zstd.Encoder, level zstd.EncoderLevel, dict []byte) {
+	if len(dict) == 0 {
+		putZstdEncoder(enc, level)
+	}
+}
+
+// getZstdDecoder returns a zstd decoder which reads from
+// r. It should be returned with putZstdDecoder when done.
+func getZstdDecoder(r io.Reader) (*zstd.Decoder, error) {
+	if dec, ok := zstdDecoderPool.Get().(*zstd.Decoder); ok {
+		err := dec.Reset(r)
+		if err != nil {
+			putZstdDecoder(dec)
+			return nil, err
+		}
+		return dec, nil
+	}
+	// as with encoders, pooled decoders must not
+	// spawn goroutines since they are never closed
+	return zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+}
+
+// putZstdDecoder returns dec to its pool.
+func putZstdDecoder(dec *zstd.Decoder) {
+	dec.Reset(nil)
+	zstdDecoderPool.Put(dec)
+}
+
+// getZstdDictDecoder is like getZstdDecoder, but the
+// decoder can also read frames compressed with dict,
+// if not empty. As with encoders, decoders with a
+// dictionary are not pooled. It should be released
+// with putZstdDictDecoder when done.
+func getZstdDictDecoder(r io.Reader, dict []byte) (*zstd.Decoder, error) {
+	if len(dict) == 0 {
+		return getZstdDecoder(r)
+	}
+	return zstd.NewReader(r,
+		zstd.WithDecoderConcurrency(1),
+		zstd.WithDecoderDicts(dict))
+}
+
+// putZstdDictDecoder releases dec, which was obtained
+// with getZstdDictDecoder with the same dict.
+func putZstdDictDecoder(dec *zstd.Decoder, dict []byte) {
+	if len(dict) == 0 {
+		putZstdDecoder(dec)
+		return
+	}
+	dec.Close()
+}
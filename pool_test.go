@@ -0,0 +1,41 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestPooledCompressorsReuse(t *testing.T) {
+	data := bytes.Repeat([]byte("pooled compressors are reset between uses\n"), 100)
+
+	for _, c := range []interface {
+		Compressor
+		Decompressor
+	}{
+		&Gz{CompressionLevel: gzip.BestSpeed},
+		&Gz{CompressionLevel: gzip.DefaultCompression},
+		&Zstd{},
+		&Zstd{EncoderLevel: zstd.SpeedBestCompression},
+	} {
+		// do it several times so that pooled
+		// instances are actually reused
+		for i := 0; i < 3; i++ {
+			compressed := new(bytes.Buffer)
+			err := c.Compress(bytes.NewReader(data), compressed)
+			if err != nil {
+				t.Fatalf("%s: compressing: %v", c, err)
+			}
+			decompressed := new(bytes.Buffer)
+			err = c.Decompress(compressed, decompressed)
+			if err != nil {
+				t.Fatalf("%s: decompressing: %v", c, err)
+			}
+			if !bytes.Equal(decompressed.Bytes(), data) {
+				t.Fatalf("%s: round trip %d produced different data", c, i)
+			}
+		}
+	}
+}
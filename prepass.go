@@ -0,0 +1,132 @@
+package archiver
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// destinationPrepass is the state of the destination of
+// an extraction, prepared ahead of time by a pre-pass
+// which makes the directories and stats the files of
+// the archive in parallel, so that the serial loop which
+// decompresses and writes the files does not have to
+// wait for those operations. A nil *destinationPrepass
+// is valid, and looks everything up when asked.
+type destinationPrepass struct {
+	mu       sync.Mutex
+	dirs     map[string]bool // directories which were made
+	existing map[string]bool // whether destination files existed
+}
+
+// prepareDestination makes the directories dirs and stats
+// the files named files in fsys, using up to workers
+// goroutines. Errors are ignored, since the extraction
+// which follows runs into them again and deals with them.
+func prepareDestination(fsys FileSystem, dirs, files []string, workers int) *destinationPrepass {
+	p := &destinationPrepass{
+		dirs:     make(map[string]bool),
+		existing: make(map[string]bool),
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	// directories are made first, since
+	// files cannot exist without them
+	forEachParallel(dirs, workers, func(dir string) {
+		if fsys.MkdirAll(dir, 0755) == nil {
+			p.mu.Lock()
+			p.dirs[dir] = true
+			p.mu.Unlock()
+		}
+	})
+	forEachParallel(files, workers, func(name string) {
+		exists := fileExistsIn(fsys, name)
+		p.mu.Lock()
+		p.existing[name] = exists
+		p.mu.Unlock()
+	})
+
+	return p
+}
+
+// madeDir returns true if the pre-pass made
+// the directory dir.
+func (p *destinationPrepass) madeDir(dir string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dirs[dir]
+}
+
+// exists returns true if the file named name exists in
+// fsys, as found by the pre-pass if it looked for it.
+func (p *destinationPrepass) exists(fsys FileSystem, name string) bool {
+	if p != nil {
+		p.mu.Lock()
+		exists, ok := p.existing[name]
+		p.mu.Unlock()
+		if ok {
+			return exists
+		}
+	}
+	return fileExistsIn(fsys, name)
+}
+
+// created records that the file named name was created
+// since the pre-pass, for archives which have more than
+// one file with the same name.
+func (p *destinationPrepass) created(name string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.existing[name] = true
+	p.mu.Unlock()
+}
+
+// forEachParallel calls fn for each of items,
+// using up to workers goroutines at once.
+func forEachParallel(items []string, workers int, fn func(string)) {
+	if workers > len(items) {
+		workers = len(items)
+	}
+	next := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range next {
+				fn(item)
+			}
+		}()
+	}
+	for _, item := range items {
+		next <- item
+	}
+	close(next)
+	wg.Wait()
+}
+
+// uniqueDirs returns the directories in which the
+// files named names are, along with the names which
+// are directories themselves as reported by isDir,
+// without repeats.
+func uniqueDirs(names []string, isDir func(i int) bool) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	for i, name := range names {
+		dir := name
+		if !isDir(i) {
+			dir = filepath.Dir(name)
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
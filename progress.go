@@ -0,0 +1,104 @@
+package archiver
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ProgressFunc is called to report the progress of
+// archiving or extracting files. The entry is the name
+// of the entry in the archive which is being archived
+// or extracted, of which bytesDone of bytesTotal bytes
+// of contents are done; entriesDone of entriesTotal
+// entries are done, including entries which failed.
+// A total is -1 if it is not known, such as the number
+// of entries of a tarball being extracted, which can
+// only be known by reading all of it.
+//
+// It is called when an entry is started, as its contents
+// are copied, and when it is done, at which point
+// entriesDone includes it.
+type ProgressFunc func(entry string, bytesDone, bytesTotal int64, entriesDone, entriesTotal int)
+
+// progressTracker tracks the progress of
+// an operation and reports it to fn.
+type progressTracker struct {
+	fn           ProgressFunc
+	entriesDone  int
+	entriesTotal int
+
+	entry      string // the entry in progress
+	bytesDone  int64
+	bytesTotal int64
+}
+
+// reset starts tracking a new operation, whose
+// progress is reported to fn, which may be nil.
+func (p *progressTracker) reset(fn ProgressFunc) {
+	*p = progressTracker{fn: fn, entriesTotal: -1}
+}
+
+// start reports that entry, which has
+// total bytes of contents, is started.
+func (p *progressTracker) start(entry string, total int64) {
+	p.entry, p.bytesDone, p.bytesTotal = entry, 0, total
+	p.report()
+}
+
+// reader returns r, from which the contents of the entry
+// in progress are read, wrapped to report the bytes read.
+// The bytes done start over from 0, so the contents can
+// be read again if the entry is tried again.
+func (p *progressTracker) reader(r io.Reader) io.Reader {
+	p.bytesDone = 0
+	if p.fn == nil {
+		return r
+	}
+	return progressReader{r: r, p: p}
+}
+
+// finish reports that the entry in progress is done.
+func (p *progressTracker) finish() {
+	p.entriesDone++
+	p.report()
+}
+
+func (p *progressTracker) report() {
+	if p.fn != nil {
+		p.fn(p.entry, p.bytesDone, p.bytesTotal, p.entriesDone, p.entriesTotal)
+	}
+}
+
+// progressReader reports the bytes read
+// through it as the progress of p.
+type progressReader struct {
+	r io.Reader
+	p *progressTracker
+}
+
+func (pr progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	if n > 0 {
+		pr.p.bytesDone += int64(n)
+		pr.p.report()
+	}
+	return n, err
+}
+
+// countSourceEntries returns the number of entries
+// which archiving the files listed in sources is
+// expected to make. Files which cannot be walked are
+// not counted.
+func countSourceEntries(sources []string) int {
+	var n int
+	for _, source := range sources {
+		filepath.Walk(source, func(fpath string, info os.FileInfo, err error) error {
+			if err == nil {
+				n++
+			}
+			return nil
+		})
+	}
+	return n
+}
@@ -0,0 +1,86 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	expectedEntries := countSourceEntries([]string{"testdata"})
+	info, err := os.Stat(filepath.Join("testdata", "already-compressed.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type call struct {
+		entry                     string
+		bytesDone, bytesTotal     int64
+		entriesDone, entriesTotal int
+	}
+	var calls []call
+	progress := func(entry string, bytesDone, bytesTotal int64, entriesDone, entriesTotal int) {
+		calls = append(calls, call{entry, bytesDone, bytesTotal, entriesDone, entriesTotal})
+	}
+
+	for _, tc := range []struct {
+		name   string
+		format interface {
+			Archiver
+			Unarchiver
+		}
+		unarchiveEntriesTotal int
+	}{
+		{"test.tar", &Tar{MkdirAll: true, Progress: progress}, -1},
+		{"test.zip", &Zip{MkdirAll: true, Progress: progress}, expectedEntries},
+	} {
+		for _, op := range []string{"archive", "unarchive"} {
+			calls = nil
+			expectedTotal := expectedEntries
+			var err error
+			if op == "archive" {
+				err = tc.format.Archive([]string{"testdata"}, filepath.Join(tmp, tc.name))
+			} else {
+				expectedTotal = tc.unarchiveEntriesTotal
+				err = tc.format.Unarchive(filepath.Join(tmp, tc.name), filepath.Join(tmp, tc.name+"-out"))
+			}
+			if err != nil {
+				t.Fatalf("[%s %s] %v", tc.name, op, err)
+			}
+			if len(calls) == 0 {
+				t.Fatalf("[%s %s] expected progress to be reported", tc.name, op)
+			}
+
+			// entries are counted as they are done, and the
+			// bytes of each entry add up to its size
+			var sawJPEG bool
+			for i, c := range calls {
+				if c.entriesTotal != expectedTotal {
+					t.Errorf("[%s %s] call %d: expected %d entries in total, got %d", tc.name, op, i, expectedTotal, c.entriesTotal)
+				}
+				if c.bytesDone > c.bytesTotal {
+					t.Errorf("[%s %s] call %d: %d of %d bytes done", tc.name, op, i, c.bytesDone, c.bytesTotal)
+				}
+				if c.entry == "testdata/already-compressed.jpg" {
+					sawJPEG = true
+					if c.bytesTotal != info.Size() {
+						t.Errorf("[%s %s] call %d: expected %d bytes in total, got %d", tc.name, op, i, info.Size(), c.bytesTotal)
+					}
+				}
+			}
+			if !sawJPEG {
+				t.Errorf("[%s %s] expected progress of testdata/already-compressed.jpg", tc.name, op)
+			}
+			if last := calls[len(calls)-1]; last.entriesDone != expectedEntries {
+				t.Errorf("[%s %s] expected %d entries done at the end, got %d", tc.name, op, expectedEntries, last.entriesDone)
+			}
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path"
 	"path/filepath"
@@ -20,6 +19,38 @@ type Rar struct {
 	// an error is returned if the file exists.
 	OverwriteExisting bool
 
+	// Whether to extract entries whose paths go outside
+	// of the destination, such as "../../etc/cron.d/x";
+	// if false, an error which is ErrIllegalPath is
+	// returned for them. Only set this for trusted
+	// archives.
+	AllowPathTraversal bool
+
+	// What to do with entries whose paths are absolute,
+	// such as "/etc/passwd"; the zero value,
+	// AbsolutePathStrip, extracts them inside of the
+	// destination with a warning.
+	AbsolutePathPolicy AbsolutePathPolicy
+
+	// Whether to keep the setuid, setgid and sticky bits
+	// of the modes of files extracted; by default they are
+	// cleared, so that archives from untrusted sources
+	// cannot make setuid programs.
+	KeepSetuid bool
+
+	// The most bytes of contents of any one file to
+	// extract; 0 means no limit. Since contents are
+	// counted as they are decompressed, files which
+	// decompress to much more than they say cannot fill
+	// the disk; extracting them fails with an error which
+	// is ErrLimitExceeded instead.
+	MaxEntrySize int64
+
+	// The most bytes of contents of all files to extract
+	// in one operation, counted like for MaxEntrySize;
+	// 0 means no limit.
+	MaxTotalSize int64
+
 	// Whether to make all the directories necessary
 	// to create a rar archive in the desired path.
 	MkdirAll bool
@@ -44,21 +75,29 @@ type Rar struct {
 	// the operation will continue on remaining files.
 	ContinueOnError bool
 
+	// If set, errors skipped because of ContinueOnError
+	// are logged to this logger instead of the logger of
+	// the error log policy.
+	Logger Logger
+
 	// The password to open archives (optional).
 	Password string
 
-	rr *rardecode.Reader     // underlying stream reader
-	rc *rardecode.ReadCloser // supports multi-volume archives (files only)
+	rr        *rardecode.Reader     // underlying stream reader
+	rc        *rardecode.ReadCloser // supports multi-volume archives (files only)
+	extracted int64                 // bytes of contents extracted, for MaxTotalSize
 }
 
 // Unarchive unpacks the .rar file at source to destination.
 // Destination will be treated as a folder name. It supports
 // multi-volume archives.
 func (r *Rar) Unarchive(source, destination string) error {
+	r = r.session()
+
 	if !fileExists(destination) && r.MkdirAll {
 		err := mkdir(destination)
 		if err != nil {
-			return fmt.Errorf("preparing destination: %v", err)
+			return fmt.Errorf("preparing destination: %w", err)
 		}
 	}
 
@@ -69,13 +108,13 @@ func (r *Rar) Unarchive(source, destination string) error {
 		var err error
 		destination, err = r.addTopLevelFolder(source, destination)
 		if err != nil {
-			return fmt.Errorf("scanning source archive: %v", err)
+			return fmt.Errorf("scanning source archive: %w", err)
 		}
 	}
 
 	err := r.OpenFile(source)
 	if err != nil {
-		return fmt.Errorf("opening rar archive for reading: %v", err)
+		return fmt.Errorf("opening rar archive for reading: %w", err)
 	}
 	defer r.Close()
 
@@ -86,10 +125,10 @@ func (r *Rar) Unarchive(source, destination string) error {
 		}
 		if err != nil {
 			if r.ContinueOnError {
-				log.Printf("[ERROR] Reading file in rar archive: %v", err)
+				logError(r.Logger, "Reading file in rar archive: %v", err)
 				continue
 			}
-			return fmt.Errorf("reading file in rar archive: %v", err)
+			return fmt.Errorf("reading file in rar archive: %w", err)
 		}
 	}
 
@@ -103,13 +142,13 @@ func (r *Rar) Unarchive(source, destination string) error {
 func (r *Rar) addTopLevelFolder(sourceArchive, destination string) (string, error) {
 	file, err := os.Open(sourceArchive)
 	if err != nil {
-		return "", fmt.Errorf("opening source archive: %v", err)
+		return "", fmt.Errorf("opening source archive: %w", err)
 	}
 	defer file.Close()
 
 	rc, err := rardecode.NewReader(file, r.Password)
 	if err != nil {
-		return "", fmt.Errorf("creating archive reader: %v", err)
+		return "", fmt.Errorf("creating archive reader: %w", err)
 	}
 
 	var files []string
@@ -119,7 +158,7 @@ func (r *Rar) addTopLevelFolder(sourceArchive, destination string) (string, erro
 			break
 		}
 		if err != nil {
-			return "", fmt.Errorf("scanning tarball's file listing: %v", err)
+			return "", fmt.Errorf("scanning tarball's file listing: %w", err)
 		}
 		files = append(files, hdr.Name)
 	}
@@ -136,17 +175,22 @@ func (r *Rar) unrarNext(to string) error {
 	if err != nil {
 		return err // don't wrap error; calling loop must break on io.EOF
 	}
+	defer f.Close()
 	header, ok := f.Header.(*rardecode.FileHeader)
 	if !ok {
 		return fmt.Errorf("expected header to be *rardecode.FileHeader but was %T", f.Header)
 	}
-	return r.unrarFile(f, filepath.Join(to, header.Name))
+	to, err = extractPath(to, header.Name, r.AllowPathTraversal, r.AbsolutePathPolicy, r.Logger)
+	if err != nil {
+		return err
+	}
+	return r.unrarFile(f, to)
 }
 
 func (r *Rar) unrarFile(f File, to string) error {
 	// do not overwrite existing files, if configured
 	if !f.IsDir() && !r.OverwriteExisting && fileExists(to) {
-		return fmt.Errorf("file already exists: %s", to)
+		return &PathError{Path: to, Err: ErrDestinationExists}
 	}
 
 	hdr, ok := f.Header.(*rardecode.FileHeader)
@@ -158,10 +202,27 @@ func (r *Rar) unrarFile(f File, to string) error {
 	// create their folders before writing the file
 	err := mkdir(filepath.Dir(to))
 	if err != nil {
-		return fmt.Errorf("making parent directories: %v", err)
+		return fmt.Errorf("making parent directories: %w", err)
 	}
 
-	return writeNewFile(to, r.rr, hdr.Mode())
+	limits := r.limits()
+	if !hdr.UnKnownSize {
+		err = limits.check(hdr.Name, hdr.UnPackedSize)
+		if err != nil {
+			return err
+		}
+	}
+	return writeNewFile(to, limits.reader(hdr.Name, r.rr), extractMode(hdr.Mode(), r.KeepSetuid))
+}
+
+// limits returns the limits on the files
+// being extracted.
+func (r *Rar) limits() extractLimits {
+	return extractLimits{
+		maxEntry: r.MaxEntrySize,
+		maxTotal: r.MaxTotalSize,
+		total:    &r.extracted,
+	}
 }
 
 // OpenFile opens filename for reading. This method supports
@@ -208,7 +269,7 @@ func (r *Rar) Read() (File, error) {
 	file := File{
 		FileInfo:   rarFileInfo{hdr},
 		Header:     hdr,
-		ReadCloser: ReadFakeCloser{r.rr},
+		ReadCloser: trackBody(hdr.Name, ReadFakeCloser{r.rr}),
 	}
 
 	return file, nil
@@ -230,15 +291,19 @@ func (r *Rar) Close() error {
 
 // Walk calls walkFn for each visited item in archive.
 func (r *Rar) Walk(archive string, walkFn WalkFunc) error {
+	r = r.session()
+
+	walkFn = skipDirs(walkFn)
+
 	file, err := os.Open(archive)
 	if err != nil {
-		return fmt.Errorf("opening archive file: %v", err)
+		return fmt.Errorf("opening archive file: %w", err)
 	}
 	defer file.Close()
 
 	err = r.Open(file, 0)
 	if err != nil {
-		return fmt.Errorf("opening archive: %v", err)
+		return fmt.Errorf("opening archive: %w", err)
 	}
 	defer r.Close()
 
@@ -249,31 +314,46 @@ func (r *Rar) Walk(archive string, walkFn WalkFunc) error {
 		}
 		if err != nil {
 			if r.ContinueOnError {
-				log.Printf("[ERROR] Opening next file: %v", err)
+				logError(r.Logger, "Opening next file: %v", err)
 				continue
 			}
-			return fmt.Errorf("opening next file: %v", err)
+			return fmt.Errorf("opening next file: %w", err)
 		}
 		err = walkFn(f)
+		f.Close()
 		if err != nil {
 			if err == ErrStopWalk {
 				break
 			}
 			if r.ContinueOnError {
-				log.Printf("[ERROR] Walking %s: %v", f.Name(), err)
+				logError(r.Logger, "Walking %s: %v", f.Name(), err)
 				continue
 			}
-			return fmt.Errorf("walking %s: %v", f.Name(), err)
+			return fmt.Errorf("walking %s: %w", f.Name(), err)
 		}
 	}
 
 	return nil
 }
 
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (r *Rar) List(archive string) ([]EntryInfo, error) {
+	return listWalk(r, archive)
+}
+
+// Validate checks the integrity of archive by
+// reading the contents of every entry.
+func (r *Rar) Validate(archive string) error {
+	return validateWalk(r, archive)
+}
+
 // Extract extracts a single file from the rar archive.
 // If the target is a directory, the entire folder will
 // be extracted into destination.
 func (r *Rar) Extract(source, target, destination string) error {
+	r = r.session()
+
 	// target refers to a path inside the archive, which should be clean also
 	target = path.Clean(target)
 
@@ -302,13 +382,16 @@ func (r *Rar) Extract(source, target, destination string) error {
 			// build the filename we will extract to
 			end, err := filepath.Rel(targetDirPath, th.Name)
 			if err != nil {
-				return fmt.Errorf("relativizing paths: %v", err)
+				return fmt.Errorf("relativizing paths: %w", err)
+			}
+			joined, err := extractPath(destination, filepath.ToSlash(end), r.AllowPathTraversal, r.AbsolutePathPolicy, r.Logger)
+			if err != nil {
+				return err
 			}
-			joined := filepath.Join(destination, end)
 
 			err = r.unrarFile(f, joined)
 			if err != nil {
-				return fmt.Errorf("extracting file %s: %v", th.Name, err)
+				return fmt.Errorf("extracting file %s: %w", th.Name, err)
 			}
 
 			// if our target was not a directory, stop walk
@@ -346,6 +429,14 @@ func (*Rar) Match(file *os.File) (bool, error) {
 	return hasTarHeader, nil
 }
 
+// session returns a copy of r with its own state,
+// so that operations can be done concurrently.
+func (r *Rar) session() *Rar {
+	s := *r
+	s.rr, s.rc, s.extracted = nil, nil, 0
+	return &s
+}
+
 func (r *Rar) String() string { return "rar" }
 
 type rarFileInfo struct {
@@ -364,6 +455,8 @@ var (
 	_ = Reader(new(Rar))
 	_ = Unarchiver(new(Rar))
 	_ = Walker(new(Rar))
+	_ = Lister(new(Rar))
+	_ = Validator(new(Rar))
 	_ = Extractor(new(Rar))
 	_ = Matcher(new(Rar))
 	_ = os.FileInfo(rarFileInfo{})
@@ -0,0 +1,102 @@
+package archiver
+
+import (
+	"io"
+)
+
+// readAheadReader reads from an underlying reader in its
+// own goroutine, filling a pair of buffers ahead of the
+// consumer (double-buffering), so that the producer and
+// the consumer of a stream can make progress concurrently.
+type readAheadReader struct {
+	src  io.Reader
+	full chan readAheadChunk
+	free chan []byte
+	done chan struct{}
+	exit chan struct{}
+
+	cur readAheadChunk
+	err error
+}
+
+type readAheadChunk struct {
+	buf []byte // original buffer, to be recycled
+	p   []byte // unread portion of buf
+	err error
+}
+
+// newReadAheadReader returns a reader that reads from src
+// asynchronously using two buffers of the given size. It
+// must be closed to release the background goroutine.
+func newReadAheadReader(src io.Reader, size int) *readAheadReader {
+	ra := &readAheadReader{
+		src:  src,
+		full: make(chan readAheadChunk, 2),
+		free: make(chan []byte, 2),
+		done: make(chan struct{}),
+		exit: make(chan struct{}),
+	}
+	ra.free <- make([]byte, size)
+	ra.free <- make([]byte, size)
+	go ra.fill()
+	return ra
+}
+
+// fill reads from src into free buffers and hands
+// them to the consumer until src is exhausted or
+// the reader is closed.
+func (ra *readAheadReader) fill() {
+	defer close(ra.exit)
+	for {
+		var buf []byte
+		select {
+		case buf = <-ra.free:
+		case <-ra.done:
+			return
+		}
+
+		n, err := io.ReadFull(ra.src, buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+
+		select {
+		case ra.full <- readAheadChunk{buf: buf, p: buf[:n], err: err}:
+		case <-ra.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read reads data which was read ahead from the source.
+func (ra *readAheadReader) Read(p []byte) (int, error) {
+	for len(ra.cur.p) == 0 {
+		if ra.err != nil {
+			return 0, ra.err
+		}
+		if ra.cur.buf != nil {
+			ra.free <- ra.cur.buf
+		}
+		ra.cur = <-ra.full
+		ra.err = ra.cur.err
+	}
+	n := copy(p, ra.cur.p)
+	ra.cur.p = ra.cur.p[n:]
+	return n, nil
+}
+
+// Close stops reading ahead and waits for the background
+// goroutine to finish any read in progress. It does not
+// close the underlying reader.
+func (ra *readAheadReader) Close() error {
+	select {
+	case <-ra.done:
+	default:
+		close(ra.done)
+	}
+	<-ra.exit
+	return nil
+}
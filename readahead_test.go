@@ -0,0 +1,38 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+)
+
+func TestReadAheadReader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	for _, size := range []int{1, 7, 512, len(data), len(data) * 2} {
+		ra := newReadAheadReader(bytes.NewReader(data), size)
+		actual, err := ioutil.ReadAll(ra)
+		if err != nil {
+			t.Errorf("size %d: unexpected error: %v", size, err)
+		}
+		if !bytes.Equal(actual, data) {
+			t.Errorf("size %d: data read ahead differs from source", size)
+		}
+		ra.Close()
+	}
+
+	// closing before reading everything must not block
+	ra := newReadAheadReader(bytes.NewReader(data), 16)
+	ra.Read(make([]byte, 4))
+	ra.Close()
+}
+
+func TestTarGzReadAhead(t *testing.T) {
+	testArchiveUnarchive(t, &TarGz{
+		Tar: &Tar{
+			MkdirAll:      true,
+			ReadAheadSize: 4096,
+		},
+		CompressionLevel: gzip.DefaultCompression,
+	})
+}
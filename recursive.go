@@ -0,0 +1,292 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultRecursionDepth is the most levels of archives
+// within archives which a RecursiveUnarchiver extracts
+// if its MaxDepth is 0.
+const DefaultRecursionDepth = 4
+
+// RecursiveUnarchiver extracts an archive, and the archives
+// within it, in place: each file extracted which is an
+// archive, as told by its extension or else by its
+// contents, is extracted to a folder next to it named
+// after it (such as "logs" for "logs.tar.gz"), then
+// removed, and so on for the archives within that one.
+// Compressed files which are not archives, such as
+// "notes.txt.gz", are left as they are, and so are files
+// of formats based on zip, such as .docx, .jar and .epub,
+// which are documents and packages in their own right.
+//
+// Since archives can contain themselves (quines), or
+// chains of archives which each expand to much more than
+// they seem (zip bombs), the depth of the archives which
+// are extracted and the size of all the files extracted
+// are limited.
+//
+// The files extracted are known from the Result of the
+// format of each archive; for formats which do not report
+// results, such as Rar, the files in the destination which
+// were not there before the archive was extracted are
+// taken to be extracted from it, so that archives which
+// were already there are neither extracted nor removed.
+type RecursiveUnarchiver struct {
+	// The format of the outermost archive; if nil, it is
+	// chosen like the formats of the archives within it,
+	// and limited like them. Its own limits, such as
+	// MaxTotalSize, are used as they are.
+	Unarchiver Unarchiver
+
+	// The most levels of archives within the outermost
+	// archive to extract, such as 1 to only extract the
+	// archives directly in it; 0 means
+	// DefaultRecursionDepth. If archives are nested
+	// deeper, an error which is ErrLimitExceeded is
+	// returned.
+	MaxDepth int
+
+	// The most bytes of contents of all the files
+	// extracted, from the archives at all levels; 0 means
+	// no limit. The formats of the archives within the
+	// outermost archive count contents as they extract
+	// them if they can, like for Tar.MaxTotalSize, and
+	// otherwise the files are counted once extracted; if
+	// there are more, an error which is ErrLimitExceeded
+	// is returned.
+	MaxTotalSize int64
+
+	// If true, the archives within the outermost archive
+	// are kept after they are extracted; by default, they
+	// are removed.
+	KeepArchives bool
+
+	// The options for the formats of the archives within
+	// the outermost archive, such as WithOverwrite.
+	Options []Option
+}
+
+// RecursiveUnarchive extracts the archive at source to
+// destination, and the archives within it in place, as
+// RecursiveUnarchiver{}.Unarchive does.
+func RecursiveUnarchive(source, destination string) error {
+	return RecursiveUnarchiver{}.Unarchive(source, destination)
+}
+
+// Unarchive extracts the archive at source to destination,
+// and the archives within it in place.
+func (r RecursiveUnarchiver) Unarchive(source, destination string) error {
+	u := r.Unarchiver
+	if u == nil {
+		u = r.archiveFormat(source)
+		if u == nil {
+			return pathErrorf(ErrUnsupportedType, source, "%s: not an archive which can be extracted", source)
+		}
+		if r.MaxTotalSize > 0 {
+			limitTotalSize(u, r.MaxTotalSize)
+		}
+	}
+	var total int64
+	return r.unarchive(u, source, destination, 0, &total)
+}
+
+// unarchive extracts the archive at source, which is
+// depth levels deep, to destination with u, and the
+// archives within it, counting the bytes extracted
+// in total.
+func (r RecursiveUnarchiver) unarchive(u Unarchiver, source, destination string, depth int, total *int64) error {
+	var existing map[string]bool
+	if _, ok := u.(ResultReporter); !ok {
+		var err error
+		existing, err = filesIn(destination)
+		if err != nil {
+			return err
+		}
+	}
+	err := u.Unarchive(source, destination)
+	if err != nil {
+		return err
+	}
+	files, size, err := extractedFiles(u, destination, existing)
+	if err != nil {
+		return err
+	}
+	*total += size
+	if r.MaxTotalSize > 0 && *total > r.MaxTotalSize {
+		return pathErrorf(ErrLimitExceeded, source, "%s: files extracted are larger than the total limit of %d bytes", source, r.MaxTotalSize)
+	}
+
+	maxDepth := r.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultRecursionDepth
+	}
+	for _, fpath := range files {
+		if zipBased(fpath) {
+			continue
+		}
+		nested := r.archiveFormat(fpath)
+		if nested == nil {
+			continue
+		}
+		if depth >= maxDepth {
+			return pathErrorf(ErrLimitExceeded, fpath, "%s: archive is nested deeper than the limit of %d", fpath, maxDepth)
+		}
+		if r.MaxTotalSize > 0 {
+			if *total >= r.MaxTotalSize {
+				return pathErrorf(ErrLimitExceeded, fpath, "%s: files extracted are larger than the total limit of %d bytes", fpath, r.MaxTotalSize)
+			}
+			limitTotalSize(nested, r.MaxTotalSize-*total)
+		}
+		name := folderNameFromFileName(fpath)
+		if name == "" {
+			name = filepath.Base(fpath)
+		}
+		to, err := resolveExisting(OSFileSystem{}, OverwriteRenameNew, File{}, filepath.Join(filepath.Dir(fpath), name), fileExists)
+		if err != nil {
+			return err
+		}
+		err = r.unarchive(nested, fpath, to, depth+1, total)
+		if err != nil {
+			return fmt.Errorf("extracting nested archive %s: %w", fpath, err)
+		}
+		if !r.KeepArchives {
+			err = os.Remove(fpath)
+			if err != nil {
+				return fmt.Errorf("removing nested archive: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// archiveFormat returns a new value of the format of the
+// archive at fpath, chosen by its extension or else by its
+// contents, with r.Options applied; or nil if it is not an
+// archive which can be extracted.
+func (r RecursiveUnarchiver) archiveFormat(fpath string) Unarchiver {
+	format, err := ByExtension(fpath)
+	if _, ok := format.(Unarchiver); err != nil || !ok {
+		f, err := os.Open(fpath)
+		if err != nil {
+			return nil
+		}
+		format, _, err = Identify(f)
+		f.Close()
+		if err != nil {
+			return nil
+		}
+	}
+	u, ok := format.(Unarchiver)
+	if !ok {
+		return nil
+	}
+	applyOptions(r.Options, format)
+	if t := tarOf(format); t != nil && t != format {
+		applyOptions(r.Options, t)
+	}
+	return u
+}
+
+// zipBased returns true if fpath has the extension of
+// a format based on zip, such as .docx or .jar, other
+// than .zip itself.
+func zipBased(fpath string) bool {
+	return hasZipExt(fpath) && strings.ToLower(filepath.Ext(fpath)) != ".zip"
+}
+
+// filesIn returns the paths of the files in destination,
+// which need not exist.
+func filesIn(destination string) (map[string]bool, error) {
+	files := make(map[string]bool)
+	err := filepath.Walk(destination, func(fpath string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && fpath == destination {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		files[fpath] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking destination: %w", err)
+	}
+	return files, nil
+}
+
+// extractedFiles returns the paths of the regular files
+// which u extracted to destination, in order, and the
+// bytes of their contents. If u does not report its
+// results, the files in destination which are not in
+// existing are taken to be those it extracted.
+func extractedFiles(u Unarchiver, destination string, existing map[string]bool) ([]string, int64, error) {
+	var paths []string
+	if rr, ok := u.(ResultReporter); ok {
+		for _, fpath := range rr.Result().Paths {
+			paths = append(paths, fpath)
+		}
+	} else {
+		err := filepath.Walk(destination, func(fpath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !existing[fpath] {
+				paths = append(paths, fpath)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("walking files extracted: %w", err)
+		}
+	}
+	sort.Strings(paths)
+
+	var files []string
+	var size int64
+	for _, fpath := range paths {
+		info, err := os.Lstat(fpath)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: stat: %w", fpath, err)
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, fpath)
+			size += info.Size()
+		}
+	}
+	return files, size, nil
+}
+
+// limitTotalSize limits the bytes of contents which
+// format extracts to max, if it can count them as it
+// extracts them and does not have a lower limit.
+func limitTotalSize(format interface{}, max int64) {
+	limit := func(total *int64) {
+		if *total <= 0 || *total > max {
+			*total = max
+		}
+	}
+	if t := tarOf(format); t != nil {
+		limit(&t.MaxTotalSize)
+	}
+	switch f := format.(type) {
+	case *Zip:
+		limit(&f.MaxTotalSize)
+	case *Deb:
+		limit(&f.MaxTotalSize)
+	case *Rar:
+		limit(&f.MaxTotalSize)
+	case *Rpm:
+		limit(&f.MaxTotalSize)
+	case *Cab:
+		limit(&f.MaxTotalSize)
+	case *Wim:
+		limit(&f.MaxTotalSize)
+	case *Warc:
+		limit(&f.MaxTotalSize)
+	}
+}
@@ -0,0 +1,148 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecursiveUnarchive(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// outer.tar has middle.zip, which has inner.tar.gz, a
+	// zip archive with a name that does not say so, and a
+	// document which is a zip archive too
+	archive := func(name string, entries ...VirtualEntry) VirtualEntry {
+		fpath := filepath.Join(tmp, name)
+		err := ArchiveEntries(context.Background(), entries, fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return BytesEntry(filepath.Base(name), 0644, time.Time{}, contents)
+	}
+	inner := archive("inner.tar.gz", BytesEntry("deep.txt", 0644, time.Time{}, []byte("deep")))
+	data := archive("data.zip", BytesEntry("data.txt", 0644, time.Time{}, []byte("data")))
+	data.Name = "data.bin"
+	report := archive("report.zip", BytesEntry("word/document.xml", 0644, time.Time{}, []byte("<w:document/>")))
+	report.Name = "report.docx"
+	middle := archive("middle.zip", inner, data, report, BytesEntry("middle.txt", 0644, time.Time{}, []byte("middle")))
+	outer := filepath.Join(tmp, "outer.tar")
+	err = ArchiveEntries(context.Background(), []VirtualEntry{middle}, outer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range []struct {
+		unarchiver RecursiveUnarchiver
+		expect     []string
+		expectErr  bool
+	}{
+		{
+			expect: []string{"middle/inner/deep.txt", "middle/data/data.txt", "middle/middle.txt", "middle/report.docx"},
+		},
+		{
+			unarchiver: RecursiveUnarchiver{KeepArchives: true},
+			expect:     []string{"middle.zip", "middle/inner.tar.gz", "middle/data.bin", "middle/inner/deep.txt"},
+		},
+		{
+			unarchiver: RecursiveUnarchiver{MaxDepth: 1},
+			expectErr:  true,
+		},
+		{
+			unarchiver: RecursiveUnarchiver{MaxTotalSize: middle.Size + 10},
+			expectErr:  true,
+		},
+	} {
+		dest := filepath.Join(tmp, fmt.Sprintf("out%d", i))
+		err := tc.unarchiver.Unarchive(outer, dest)
+		if tc.expectErr {
+			if !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("Test %d: expected error for exceeded limit, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		for _, name := range tc.expect {
+			if !fileExists(filepath.Join(dest, filepath.FromSlash(name))) {
+				t.Errorf("Test %d: expected %s to be extracted", i, name)
+			}
+		}
+		if !tc.unarchiver.KeepArchives && fileExists(filepath.Join(dest, "middle", "inner.tar.gz")) {
+			t.Errorf("Test %d: expected nested archive to be removed", i)
+		}
+		if fileExists(filepath.Join(dest, "middle", "report")) {
+			t.Errorf("Test %d: expected document not to be extracted", i)
+		}
+	}
+}
+
+// nopUnarchiver is an Unarchiver which extracts nothing
+// and does not report its results.
+type nopUnarchiver struct{}
+
+func (nopUnarchiver) Unarchive(source, destination string) error { return nil }
+
+func TestRecursiveUnarchiveExistingFiles(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// an archive of the user's which was already there
+	backup := filepath.Join(tmp, "my-backup.zip")
+	err = ArchiveEntries(context.Background(), []VirtualEntry{BytesEntry("notes.txt", 0644, time.Time{}, []byte("notes"))}, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = RecursiveUnarchiver{Unarchiver: nopUnarchiver{}}.Unarchive(filepath.Join(tmp, "pkg.rpm"), tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(backup) {
+		t.Errorf("expected existing archive to be kept")
+	}
+	if fileExists(filepath.Join(tmp, "my-backup")) {
+		t.Errorf("expected existing archive not to be extracted")
+	}
+}
+
+func TestRecursiveUnarchiveOutermostLimit(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// zeros compress to next to nothing
+	outer := filepath.Join(tmp, "outer.tar.gz")
+	err = ArchiveEntries(context.Background(), []VirtualEntry{BytesEntry("bomb.bin", 0644, time.Time{}, make([]byte, 1<<20))}, outer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(tmp, "out")
+	err = RecursiveUnarchiver{MaxTotalSize: 1000}.Unarchive(outer, dest)
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected error for exceeded limit, got %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dest, "bomb.bin")); err == nil && info.Size() > 1000 {
+		t.Errorf("expected extraction to stop at the limit, got %d bytes", info.Size())
+	}
+}
@@ -0,0 +1,118 @@
+package archiver
+
+import (
+	"io"
+	"time"
+)
+
+// ResultReporter is a type which reports the result
+// of its last operation.
+type ResultReporter interface {
+	// Result returns the result of the last Archive or
+	// Unarchive operation, or of the last archive written
+	// with Create, Write and Close or read with Open, Read
+	// and Close. The result is complete once the operation
+	// is done, or the archive is closed.
+	Result() OperationResult
+}
+
+// OperationResult summarizes an operation
+// which wrote or extracted an archive.
+type OperationResult struct {
+	// The numbers of entries archived or extracted, by
+	// type; Files includes special files such as devices.
+	Files     int
+	Dirs      int
+	Symlinks  int
+	HardLinks int
+
+	// The number of entries which were not archived or
+	// extracted although nothing failed, such as symbolic
+	// links which cannot be made on the system.
+	Skipped int
+
+	// The number of files which failed, but whose errors
+	// were skipped because of ContinueOnError or OnError.
+	Failed int
+
+	// The bytes read and written: when archiving, the
+	// contents of the files archived and the size of the
+	// archive; when extracting, the size of the archive
+	// and the contents of the files extracted. The sizes
+	// of archives are as read or written, so they are
+	// compressed for compressed tarballs. Zip archives are
+	// read in parts, so their whole size is counted.
+	BytesIn, BytesOut int64
+
+	// How long the operation took.
+	Duration time.Duration
+
+	// The information lost during the operation;
+	// see WarningCollector.
+	Warnings []Warning
+
+	// The slash-separated paths of the entries in the
+	// archive which were archived from or extracted to
+	// the disk (or FileSystem), mapped to the paths of
+	// the files there.
+	Paths map[string]string
+}
+
+// addEntry counts f, which was archived or extracted.
+func (r *OperationResult) addEntry(f File) {
+	switch entryType(f) {
+	case EntryDir:
+		r.Dirs++
+	case EntrySymlink:
+		r.Symlinks++
+	case EntryHardLink:
+		r.HardLinks++
+	default:
+		r.Files++
+	}
+}
+
+// addPath records that the entry named name in the
+// archive was archived from or extracted to fpath.
+func (r *OperationResult) addPath(name, fpath string) {
+	if r.Paths == nil {
+		r.Paths = make(map[string]string)
+	}
+	r.Paths[name] = fpath
+}
+
+// operationTimer times an operation,
+// using the clock of a format.
+type operationTimer struct {
+	clock   Clock
+	started time.Time
+}
+
+// start starts timing an operation.
+func (ot *operationTimer) start(clock Clock) {
+	ot.clock = clockOrSystem(clock)
+	ot.started = ot.clock.Now()
+}
+
+// stop returns how long the operation has taken
+// since it started, or 0 if it was not started.
+func (ot *operationTimer) stop() time.Duration {
+	if ot.started.IsZero() {
+		return 0
+	}
+	d := ot.clock.Now().Sub(ot.started)
+	ot.started = time.Time{}
+	return d
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
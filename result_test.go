@@ -0,0 +1,141 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResult(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var contentSize int64
+	err = filepath.Walk("testdata", func(fpath string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			contentSize += info.Size()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type resultFormat interface {
+		Archiver
+		Unarchiver
+		ResultReporter
+	}
+	for _, tc := range []struct {
+		name   string
+		format func(Clock) resultFormat
+	}{
+		{"test.tar", func(c Clock) resultFormat { return &Tar{Clock: c, MkdirAll: true} }},
+		{"test.tar.gz", func(c Clock) resultFormat { return &TarGz{Tar: &Tar{Clock: c, MkdirAll: true}} }},
+		{"test.zip", func(c Clock) resultFormat { return &Zip{Clock: c, MkdirAll: true} }},
+	} {
+		clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		clock.Step = time.Second
+		format := tc.format(clock)
+
+		archive := filepath.Join(tmp, tc.name)
+		err := format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatalf("[%s] archiving: %v", tc.name, err)
+		}
+		info, err := os.Stat(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := format.Result()
+		checkResult(t, tc.name+" archive", result, 5, 3)
+		if result.BytesIn != contentSize {
+			t.Errorf("[%s archive] expected %d bytes in, got %d", tc.name, contentSize, result.BytesIn)
+		}
+		if result.BytesOut != info.Size() {
+			t.Errorf("[%s archive] expected %d bytes out, got %d", tc.name, info.Size(), result.BytesOut)
+		}
+		expectedPath := filepath.Join("testdata", "quote1.txt")
+		if p := result.Paths["testdata/quote1.txt"]; p != expectedPath {
+			t.Errorf("[%s archive] expected path %s, got %s", tc.name, expectedPath, p)
+		}
+
+		dest := filepath.Join(tmp, tc.name+"-out")
+		err = format.Unarchive(archive, dest)
+		if err != nil {
+			t.Fatalf("[%s] extracting: %v", tc.name, err)
+		}
+		result = format.Result()
+		checkResult(t, tc.name+" unarchive", result, 5, 3)
+		if result.BytesIn == 0 || result.BytesIn > info.Size() {
+			t.Errorf("[%s unarchive] expected up to %d bytes in, got %d", tc.name, info.Size(), result.BytesIn)
+		}
+		if result.BytesOut != contentSize {
+			t.Errorf("[%s unarchive] expected %d bytes out, got %d", tc.name, contentSize, result.BytesOut)
+		}
+		expectedPath = filepath.Join(dest, "testdata", "quote1.txt")
+		if p := result.Paths["testdata/quote1.txt"]; p != expectedPath {
+			t.Errorf("[%s unarchive] expected path %s, got %s", tc.name, expectedPath, p)
+		}
+	}
+}
+
+func TestResultFailed(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, format := range []interface {
+		Archiver
+		Unarchiver
+		ResultReporter
+	}{
+		&Tar{MkdirAll: true, ContinueOnError: true},
+		&Zip{MkdirAll: true, ContinueOnError: true},
+	} {
+		archive := filepath.Join(tmp, "test."+format.(interface{ String() string }).String())
+		err := format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the second time, the files already exist
+		dest := filepath.Join(tmp, "out")
+		for i := 0; i < 2; i++ {
+			err = format.Unarchive(archive, dest)
+			if err != nil {
+				t.Fatalf("[%s] extracting: %v", archive, err)
+			}
+		}
+		result := format.Result()
+		if result.Failed != 5 {
+			t.Errorf("[%s] expected 5 failed files, got %d", archive, result.Failed)
+		}
+		if result.Files != 0 || result.Dirs != 3 {
+			t.Errorf("[%s] expected 0 files and 3 directories, got %d and %d", archive, result.Files, result.Dirs)
+		}
+		os.RemoveAll(dest)
+	}
+}
+
+func checkResult(t *testing.T, name string, result OperationResult, files, dirs int) {
+	if result.Files != files || result.Dirs != dirs {
+		t.Errorf("[%s] expected %d files and %d directories, got %d and %d", name, files, dirs, result.Files, result.Dirs)
+	}
+	if result.Symlinks != 0 || result.HardLinks != 0 || result.Skipped != 0 || result.Failed != 0 {
+		t.Errorf("[%s] expected no links, skipped or failed files, got %+v", name, result)
+	}
+	if len(result.Paths) != files+dirs {
+		t.Errorf("[%s] expected %d paths, got %d: %v", name, files+dirs, len(result.Paths), result.Paths)
+	}
+	if result.Duration <= 0 {
+		t.Errorf("[%s] expected a duration, got %v", name, result.Duration)
+	}
+}
@@ -0,0 +1,740 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/ulikunitz/xz/lzma"
+	fastxz "github.com/xi2/xz"
+)
+
+// Rpm provides facilities for extracting the contents
+// of RPM packages. The lead and headers of the package
+// are skipped and the compressed cpio payload is read.
+// Supported payload compressions are gzip, bzip2, xz,
+// lzma and zstd.
+// See http://ftp.rpm.org/max-rpm/s1-rpm-file-format-rpm-file-format.html.
+type Rpm struct {
+	// Whether to overwrite existing files; if false,
+	// an error is returned if the file exists.
+	OverwriteExisting bool
+
+	// Whether to extract entries whose paths go outside
+	// of the destination, such as "../../etc/cron.d/x";
+	// if false, an error which is ErrIllegalPath is
+	// returned for them. Only set this for trusted
+	// archives.
+	AllowPathTraversal bool
+
+	// What to do with entries whose paths are absolute,
+	// such as "/etc/passwd"; the zero value,
+	// AbsolutePathStrip, extracts them inside of the
+	// destination with a warning.
+	AbsolutePathPolicy AbsolutePathPolicy
+
+	// What to do with symbolic links being extracted
+	// which point outside of the destination; the zero
+	// value, SymlinkReject, returns an error for them.
+	// Packages often have absolute links, such as to
+	// /etc/alternatives, which SymlinkReroot keeps
+	// inside of the destination, as DefaultRpm does.
+	SymlinkPolicy SymlinkPolicy
+
+	// Whether to keep the setuid, setgid and sticky bits
+	// of the modes of files extracted; by default they are
+	// cleared, so that archives from untrusted sources
+	// cannot make setuid programs.
+	KeepSetuid bool
+
+	// The most bytes of contents of any one file to
+	// extract; 0 means no limit. Since contents are
+	// counted as the payload is decompressed, files which
+	// decompress to much more than they say cannot fill
+	// the disk; extracting them fails with an error which
+	// is ErrLimitExceeded instead.
+	MaxEntrySize int64
+
+	// The most bytes of contents of all files to extract
+	// in one operation, counted like for MaxEntrySize;
+	// 0 means no limit.
+	MaxTotalSize int64
+
+	// Whether to make all the directories necessary
+	// to extract the package in the desired path.
+	MkdirAll bool
+
+	// A single top-level folder can be implicitly
+	// created by the Unarchive method if the files
+	// to be extracted from the package do not all
+	// have a common root. This roughly mimics the
+	// behavior of archival tools integrated into OS
+	// file browsers which create a subfolder to
+	// avoid unexpectedly littering the destination
+	// folder with potentially many files, causing a
+	// problematic cleanup/organization situation.
+	ImplicitTopLevelFolder bool
+
+	// If true, errors encountered during reading
+	// a single file will be logged and the
+	// operation will continue on remaining files.
+	ContinueOnError bool
+
+	// If set, errors skipped because of ContinueOnError
+	// are logged to this logger instead of the logger of
+	// the error log policy.
+	Logger Logger
+
+	cr        *cpioReader
+	cleanup   func()
+	symlinks  *symlinkGuard // links made while extracting
+	extracted int64         // bytes of contents extracted, for MaxTotalSize
+}
+
+// Unarchive unpacks the payload of the .rpm file at
+// source to destination. Destination will be treated
+// as a folder name.
+func (r *Rpm) Unarchive(source, destination string) error {
+	r = r.session()
+
+	if !fileExists(destination) && r.MkdirAll {
+		err := mkdir(destination)
+		if err != nil {
+			return fmt.Errorf("preparing destination: %w", err)
+		}
+	}
+
+	// if the files in the package do not all share a common
+	// root, then make sure we extract to a single subfolder
+	// rather than potentially littering the destination...
+	if r.ImplicitTopLevelFolder {
+		var err error
+		destination, err = r.addTopLevelFolder(source, destination)
+		if err != nil {
+			return fmt.Errorf("scanning source package: %w", err)
+		}
+	}
+
+	file, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("opening source package: %w", err)
+	}
+	defer file.Close()
+
+	err = r.Open(file, 0)
+	if err != nil {
+		return fmt.Errorf("opening rpm package for reading: %w", err)
+	}
+	defer r.Close()
+
+	r.symlinks = newSymlinkGuard(r.SymlinkPolicy, destination)
+	for {
+		err := r.unrpmNext(destination)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if r.ContinueOnError {
+				logError(r.Logger, "Reading file in rpm payload: %v", err)
+				continue
+			}
+			return fmt.Errorf("reading file in rpm payload: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// addTopLevelFolder scans the files contained inside
+// the package named sourceArchive and returns a modified
+// destination if all the files do not share the same
+// top-level folder.
+func (r *Rpm) addTopLevelFolder(sourceArchive, destination string) (string, error) {
+	var files []string
+	err := (&Rpm{}).Walk(sourceArchive, func(f File) error {
+		files = append(files, f.Header.(*CpioHeader).Name)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("scanning package's file listing: %w", err)
+	}
+
+	if multipleTopLevels(files) {
+		destination = filepath.Join(destination, folderNameFromFileName(sourceArchive))
+	}
+
+	return destination, nil
+}
+
+func (r *Rpm) unrpmNext(to string) error {
+	f, err := r.Read()
+	if err != nil {
+		return err // don't wrap error; calling loop must break on io.EOF
+	}
+	defer f.Close()
+	header, ok := f.Header.(*CpioHeader)
+	if !ok {
+		return fmt.Errorf("expected header to be *CpioHeader but was %T", f.Header)
+	}
+	to, err = extractPath(to, header.Name, r.AllowPathTraversal, r.AbsolutePathPolicy, r.Logger)
+	if err != nil {
+		return err
+	}
+	return r.unrpmFile(f, to)
+}
+
+func (r *Rpm) unrpmFile(f File, to string) error {
+	// do not overwrite existing files, if configured
+	if !f.IsDir() && !r.OverwriteExisting && fileExists(to) {
+		return &PathError{Path: to, Err: ErrDestinationExists}
+	}
+
+	hdr, ok := f.Header.(*CpioHeader)
+	if !ok {
+		return fmt.Errorf("expected header to be *CpioHeader but was %T", f.Header)
+	}
+	err := r.symlinks.check(OSFileSystem{}, to)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case f.IsDir():
+		return mkdir(to)
+	case f.Mode()&os.ModeSymlink != 0:
+		target, err := r.symlinks.target(OSFileSystem{}, to, hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			logWarning(r.Logger, Warning{
+				Path:   hdr.Name,
+				Kind:   WarningSymlink,
+				Detail: fmt.Sprintf("target %s is outside of destination", hdr.Linkname),
+			})
+			return nil
+		}
+		err = writeNewSymbolicLink(to, target)
+		if err == nil {
+			r.symlinks.made(OSFileSystem{}, to)
+		}
+		return err
+	case f.Mode().IsRegular():
+		limits := r.limits()
+		err := limits.check(hdr.Name, f.Size())
+		if err != nil {
+			return err
+		}
+		return writeNewFile(to, limits.reader(hdr.Name, f), extractMode(f.Mode(), r.KeepSetuid))
+	default:
+		return fmt.Errorf("%s: unsupported file mode: %v", hdr.Name, f.Mode())
+	}
+}
+
+// Open opens r for reading the payload of a package
+// from in. The size parameter is not used.
+func (r *Rpm) Open(in io.Reader, size int64) error {
+	if r.cr != nil {
+		return fmt.Errorf("rpm package is already open for reading")
+	}
+
+	br := bufio.NewReader(in)
+	err := skipRpmHeaders(br)
+	if err != nil {
+		return err
+	}
+
+	payload, cleanup, err := rpmPayloadReader(br)
+	if err != nil {
+		return fmt.Errorf("opening payload: %w", err)
+	}
+	r.cr = &cpioReader{r: payload}
+	r.cleanup = cleanup
+
+	return nil
+}
+
+// Read reads the next file from r, which must have
+// already been opened for reading. If there are no
+// more files, the error is io.EOF. The File must
+// be closed when finished reading from it.
+func (r *Rpm) Read() (File, error) {
+	if r.cr == nil {
+		return File{}, fmt.Errorf("rpm package is not open")
+	}
+
+	hdr, err := r.cr.Next()
+	if err != nil {
+		return File{}, err // don't wrap error; preserve io.EOF
+	}
+
+	file := File{
+		FileInfo:   cpioFileInfo{hdr},
+		Header:     hdr,
+		ReadCloser: trackBody(hdr.Name, ReadFakeCloser{r.cr}),
+	}
+
+	return file, nil
+}
+
+// Close closes the rpm package opened by Open.
+func (r *Rpm) Close() error {
+	if r.cr != nil {
+		r.cr = nil
+	}
+	if r.cleanup != nil {
+		r.cleanup()
+		r.cleanup = nil
+	}
+	return nil
+}
+
+// Walk calls walkFn for each visited item in archive.
+func (r *Rpm) Walk(archive string, walkFn WalkFunc) error {
+	r = r.session()
+
+	walkFn = skipDirs(walkFn)
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("opening archive file: %w", err)
+	}
+	defer file.Close()
+
+	err = r.Open(file, 0)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer r.Close()
+
+	for {
+		f, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if r.ContinueOnError {
+				logError(r.Logger, "Opening next file: %v", err)
+				continue
+			}
+			return fmt.Errorf("opening next file: %w", err)
+		}
+		err = walkFn(f)
+		f.Close()
+		if err != nil {
+			if err == ErrStopWalk {
+				break
+			}
+			if r.ContinueOnError {
+				logError(r.Logger, "Walking %s: %v", f.Name(), err)
+				continue
+			}
+			return fmt.Errorf("walking %s: %w", f.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (r *Rpm) List(archive string) ([]EntryInfo, error) {
+	return listWalk(r, archive)
+}
+
+// Validate checks the integrity of archive by
+// reading the contents of every entry.
+func (r *Rpm) Validate(archive string) error {
+	return validateWalk(r, archive)
+}
+
+// Extract extracts a single file from the rpm package.
+// If the target is a directory, the entire folder will
+// be extracted into destination.
+func (r *Rpm) Extract(source, target, destination string) error {
+	r = r.session()
+
+	// target refers to a path inside the archive, which should be clean also
+	target = path.Clean(target)
+
+	// if the target ends up being a directory, then
+	// we will continue walking and extracting files
+	// until we are no longer within that directory
+	var targetDirPath string
+
+	r.symlinks = newSymlinkGuard(r.SymlinkPolicy, destination)
+	return r.Walk(source, func(f File) error {
+		ch, ok := f.Header.(*CpioHeader)
+		if !ok {
+			return fmt.Errorf("expected header to be *CpioHeader but was %T", f.Header)
+		}
+
+		// payload entries are usually prefixed with "./",
+		// which cleaning the path removes
+		name := path.Clean(ch.Name)
+		if f.IsDir() && target == name {
+			targetDirPath = path.Dir(name)
+		}
+
+		if within(target, name) {
+			// either this is the exact file we want, or is
+			// in the directory we want to extract
+
+			// build the filename we will extract to
+			end, err := filepath.Rel(targetDirPath, name)
+			if err != nil {
+				return fmt.Errorf("relativizing paths: %w", err)
+			}
+			joined, err := extractPath(destination, filepath.ToSlash(end), r.AllowPathTraversal, r.AbsolutePathPolicy, r.Logger)
+			if err != nil {
+				return err
+			}
+
+			err = r.unrpmFile(f, joined)
+			if err != nil {
+				return fmt.Errorf("extracting file %s: %w", ch.Name, err)
+			}
+
+			// if our target was not a directory, stop walk
+			if targetDirPath == "" {
+				return ErrStopWalk
+			}
+		} else if targetDirPath != "" {
+			// finished walking the entire directory
+			return ErrStopWalk
+		}
+
+		return nil
+	})
+}
+
+// Match returns true if the format of file matches this
+// type's format. It should not affect reader position.
+func (*Rpm) Match(file *os.File) (bool, error) {
+	currentPos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		return false, err
+	}
+	defer file.Seek(currentPos, io.SeekStart)
+
+	buf := make([]byte, len(rpmLeadMagic))
+	if n, err := file.Read(buf); err != nil || n < len(buf) {
+		return false, nil
+	}
+	return bytes.Equal(buf, rpmLeadMagic), nil
+}
+
+// session returns a copy of r with its own state,
+// so that operations can be done concurrently.
+func (r *Rpm) session() *Rpm {
+	s := *r
+	s.cr, s.cleanup, s.symlinks, s.extracted = nil, nil, nil, 0
+	return &s
+}
+
+// limits returns the limits on the files
+// being extracted.
+func (r *Rpm) limits() extractLimits {
+	return extractLimits{
+		maxEntry: r.MaxEntrySize,
+		maxTotal: r.MaxTotalSize,
+		total:    &r.extracted,
+	}
+}
+
+func (r *Rpm) String() string { return "rpm" }
+
+// skipRpmHeaders advances br past the lead, the signature
+// header and the main header of an RPM package, leaving
+// it positioned at the start of the payload.
+func skipRpmHeaders(br *bufio.Reader) error {
+	lead := make([]byte, rpmLeadSize)
+	if _, err := io.ReadFull(br, lead); err != nil {
+		return fmt.Errorf("reading lead: %w", err)
+	}
+	if !bytes.Equal(lead[:len(rpmLeadMagic)], rpmLeadMagic) {
+		return fmt.Errorf("not an rpm package: invalid lead magic")
+	}
+
+	// the signature header is padded to an 8-byte boundary
+	n, err := skipRpmHeader(br)
+	if err != nil {
+		return fmt.Errorf("reading signature header: %w", err)
+	}
+	if pad := (8 - n%8) % 8; pad > 0 {
+		if _, err := br.Discard(int(pad)); err != nil {
+			return fmt.Errorf("skipping signature padding: %w", err)
+		}
+	}
+
+	if _, err := skipRpmHeader(br); err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+
+	return nil
+}
+
+// skipRpmHeader skips a single header structure and
+// returns how many bytes it occupied.
+func skipRpmHeader(br *bufio.Reader) (int64, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(br, intro); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(intro[:3], rpmHeaderMagic) {
+		return 0, fmt.Errorf("invalid header magic")
+	}
+	nindex := int64(binary.BigEndian.Uint32(intro[8:12]))
+	hsize := int64(binary.BigEndian.Uint32(intro[12:16]))
+	length := nindex*16 + hsize
+	if _, err := io.CopyN(ioutil.Discard, br, length); err != nil {
+		return 0, err
+	}
+	return int64(len(intro)) + length, nil
+}
+
+// rpmPayloadReader sniffs the compression of the payload
+// in br and returns a reader of the uncompressed cpio
+// stream, along with a function to release it.
+func rpmPayloadReader(br *bufio.Reader) (io.Reader, func(), error) {
+	magic, err := br.Peek(6)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gzr, err := getGzipReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gzr, func() { putGzipReader(gzr) }, nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		bz2r, err := bzip2.NewReader(br, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bz2r, func() { bz2r.Close() }, nil
+	case bytes.HasPrefix(magic, []byte("\xfd7zXZ\x00")):
+		xzr, err := fastxz.NewReader(br, 0)
+		return xzr, nil, err
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := getZstdDecoder(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, func() { putZstdDecoder(zr) }, nil
+	case bytes.HasPrefix(magic, []byte(cpioNewcMagic)),
+		bytes.HasPrefix(magic, []byte(cpioCrcMagic)):
+		return br, nil, nil // uncompressed payload
+	case len(magic) > 0 && magic[0] == 0x5d:
+		// raw lzma has no real magic; its properties byte is
+		// almost always 0x5d for the defaults used by rpmbuild
+		lr, err := lzma.NewReader(br)
+		return lr, nil, err
+	default:
+		return nil, nil, fmt.Errorf("unrecognized payload compression")
+	}
+}
+
+// CpioHeader is the header of an entry in a cpio
+// archive in the "new" (SVR4) ASCII format, which
+// is used for the payload of RPM packages.
+type CpioHeader struct {
+	Name     string
+	Linkname string // target of symbolic links
+	Mode     int64  // permission and type bits, as in st_mode
+	UID      int
+	GID      int
+	Nlink    int
+	ModTime  time.Time
+	Size     int64
+	Inode    int64
+	Devmajor int64
+	Devminor int64
+}
+
+// cpioReader reads the entries of an uncompressed
+// cpio stream in the "new" ASCII format.
+type cpioReader struct {
+	r   io.Reader
+	cur io.Reader // contents of the current entry
+	pad int64     // padding after the current entry's contents
+}
+
+// Next advances to the next entry in the stream,
+// skipping the remainder of the current one. It
+// returns io.EOF when the trailer is reached.
+func (cr *cpioReader) Next() (*CpioHeader, error) {
+	if cr.cur != nil {
+		if _, err := io.Copy(ioutil.Discard, cr.cur); err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(ioutil.Discard, cr.r, cr.pad); err != nil {
+			return nil, err
+		}
+		cr.cur = nil
+	}
+
+	raw := make([]byte, cpioHeaderSize)
+	if _, err := io.ReadFull(cr.r, raw); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF // the trailer is required
+		}
+		return nil, err
+	}
+	magic := string(raw[:6])
+	if magic != cpioNewcMagic && magic != cpioCrcMagic {
+		return nil, fmt.Errorf("unsupported cpio header magic: %q", magic)
+	}
+
+	var fields [13]int64
+	for i := range fields {
+		field := raw[6+i*8 : 6+(i+1)*8]
+		v, err := strconv.ParseInt(string(field), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing cpio header field %d: %w", i, err)
+		}
+		fields[i] = v
+	}
+
+	hdr := &CpioHeader{
+		Inode:    fields[0],
+		Mode:     fields[1],
+		UID:      int(fields[2]),
+		GID:      int(fields[3]),
+		Nlink:    int(fields[4]),
+		ModTime:  time.Unix(fields[5], 0),
+		Size:     fields[6],
+		Devmajor: fields[7],
+		Devminor: fields[8],
+	}
+
+	// the name is NUL-terminated and padded so that
+	// header and name together align to 4 bytes
+	namesize := fields[11]
+	name := make([]byte, namesize+cpioPadding(cpioHeaderSize+namesize))
+	if _, err := io.ReadFull(cr.r, name); err != nil {
+		return nil, fmt.Errorf("reading name: %w", err)
+	}
+	hdr.Name = string(bytes.TrimRight(name[:namesize], "\x00"))
+	if hdr.Name == cpioTrailer {
+		return nil, io.EOF
+	}
+
+	cr.cur = io.LimitReader(cr.r, hdr.Size)
+	cr.pad = cpioPadding(hdr.Size)
+
+	// the contents of a symbolic link are its target
+	if hdr.Mode&cpioTypeMask == cpioTypeSymlink {
+		target, err := ioutil.ReadAll(cr.cur)
+		if err != nil {
+			return nil, fmt.Errorf("reading link target: %w", err)
+		}
+		hdr.Linkname = string(target)
+	}
+
+	return hdr, nil
+}
+
+// Read reads the contents of the current entry.
+func (cr *cpioReader) Read(p []byte) (int, error) {
+	if cr.cur == nil {
+		return 0, io.EOF
+	}
+	return cr.cur.Read(p)
+}
+
+func cpioPadding(n int64) int64 { return (4 - n%4) % 4 }
+
+type cpioFileInfo struct {
+	hdr *CpioHeader
+}
+
+func (cfi cpioFileInfo) Name() string       { return path.Base(cfi.hdr.Name) }
+func (cfi cpioFileInfo) Size() int64        { return cfi.hdr.Size }
+func (cfi cpioFileInfo) ModTime() time.Time { return cfi.hdr.ModTime }
+func (cfi cpioFileInfo) IsDir() bool        { return cfi.Mode().IsDir() }
+func (cfi cpioFileInfo) Sys() interface{}   { return cfi.hdr }
+
+func (cfi cpioFileInfo) Mode() os.FileMode {
+	mode := os.FileMode(cfi.hdr.Mode & 0777)
+	switch cfi.hdr.Mode & cpioTypeMask {
+	case cpioTypeDir:
+		mode |= os.ModeDir
+	case cpioTypeSymlink:
+		mode |= os.ModeSymlink
+	case cpioTypeFifo:
+		mode |= os.ModeNamedPipe
+	case cpioTypeSocket:
+		mode |= os.ModeSocket
+	case cpioTypeChar:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case cpioTypeBlock:
+		mode |= os.ModeDevice
+	}
+	if cfi.hdr.Mode&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if cfi.hdr.Mode&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if cfi.hdr.Mode&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+const (
+	rpmLeadSize = 96
+
+	cpioHeaderSize = 110
+	cpioNewcMagic  = "070701"
+	cpioCrcMagic   = "070702"
+	cpioTrailer    = "TRAILER!!!"
+
+	cpioTypeMask    = 0170000
+	cpioTypeSocket  = 0140000
+	cpioTypeSymlink = 0120000
+	cpioTypeReg     = 0100000
+	cpioTypeBlock   = 0060000
+	cpioTypeDir     = 0040000
+	cpioTypeChar    = 0020000
+	cpioTypeFifo    = 0010000
+)
+
+var (
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8}
+)
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = Reader(new(Rpm))
+	_ = Unarchiver(new(Rpm))
+	_ = Walker(new(Rpm))
+	_ = Lister(new(Rpm))
+	_ = Validator(new(Rpm))
+	_ = Extractor(new(Rpm))
+	_ = Matcher(new(Rpm))
+	_ = os.FileInfo(cpioFileInfo{})
+)
+
+// DefaultRpm is a convenient archiver ready to use.
+var DefaultRpm = &Rpm{
+	MkdirAll:      true,
+	SymlinkPolicy: SymlinkReroot,
+}
@@ -0,0 +1,162 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRpmUnarchive(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	source := filepath.Join(tmp, "test.rpm")
+	err = ioutil.WriteFile(source, makeTestRpm(t, map[string]string{
+		"./usr/share/doc/test/README": "hello rpm",
+		"./etc/test.conf":             "key=value\n",
+	}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	err = DefaultRpm.Walk(source, func(f File) error {
+		names = append(names, f.Header.(*CpioHeader).Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking rpm: %v", err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected 2 entries, got %d: %v", len(names), names)
+	}
+
+	dest := filepath.Join(tmp, "out")
+	err = DefaultRpm.Unarchive(source, dest)
+	if err != nil {
+		t.Fatalf("unarchiving rpm: %v", err)
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(dest, "usr", "share", "doc", "test", "README"))
+	if err != nil {
+		t.Fatalf("reading extracted file: %v", err)
+	}
+	if string(contents) != "hello rpm" {
+		t.Errorf("expected 'hello rpm' but got '%s'", contents)
+	}
+}
+
+func TestRpmLimits(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	source := filepath.Join(tmp, "test.rpm")
+	err = ioutil.WriteFile(source, makeTestRpm(t, map[string]string{
+		"./a.txt": strings.Repeat("a", 600),
+		"./b.txt": strings.Repeat("b", 600),
+	}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range []struct {
+		maxEntry, maxTotal int64
+		expectErr          bool
+	}{
+		{},
+		{maxEntry: 500, expectErr: true},
+		{maxEntry: 1000},
+		{maxTotal: 1000, expectErr: true},
+		{maxTotal: 1200},
+	} {
+		r := &Rpm{MkdirAll: true, MaxEntrySize: tc.maxEntry, MaxTotalSize: tc.maxTotal}
+		err := r.Unarchive(source, filepath.Join(tmp, fmt.Sprint(i)))
+		if tc.expectErr && !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("Test %d: expected error for exceeded limit, got %v", i, err)
+		}
+		if !tc.expectErr && err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+func TestRpmExtractTraversal(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	source := filepath.Join(tmp, "test.rpm")
+	err = ioutil.WriteFile(source, makeTestRpm(t, map[string]string{
+		"../../escaped.txt": "escaped",
+	}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(tmp, "a", "b", "dest")
+	err = (&Rpm{MkdirAll: true}).Extract(source, "../../escaped.txt", dest)
+	if !errors.Is(err, ErrIllegalPath) {
+		t.Errorf("expected error for path outside of destination, got %v", err)
+	}
+	if fileExists(filepath.Join(tmp, "a", "escaped.txt")) {
+		t.Error("expected file not to be extracted outside of destination")
+	}
+}
+
+// makeTestRpm builds a minimal RPM package with empty
+// headers and a gzipped cpio payload of files.
+func makeTestRpm(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmLeadMagic)
+	buf.Write(lead)
+
+	// signature header with no entries and 4 bytes of data,
+	// so that padding to 8 bytes is required
+	buf.Write(rpmHeaderMagic)
+	buf.Write([]byte{1, 0, 0, 0, 0})
+	binary.Write(buf, binary.BigEndian, uint32(0))
+	binary.Write(buf, binary.BigEndian, uint32(4))
+	buf.Write(make([]byte, 4+4))
+
+	// main header with no entries
+	buf.Write(rpmHeaderMagic)
+	buf.Write([]byte{1, 0, 0, 0, 0})
+	binary.Write(buf, binary.BigEndian, uint32(0))
+	binary.Write(buf, binary.BigEndian, uint32(0))
+
+	gzw := gzip.NewWriter(buf)
+	writeEntry := func(name string, mode int64, body string) {
+		namesize := int64(len(name) + 1)
+		fmt.Fprintf(gzw, "%s%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+			cpioNewcMagic, 0, mode, 0, 0, 1, 0, len(body), 0, 0, 0, 0, namesize, 0)
+		gzw.Write([]byte(name + "\x00"))
+		gzw.Write(make([]byte, cpioPadding(cpioHeaderSize+namesize)))
+		gzw.Write([]byte(body))
+		gzw.Write(make([]byte, cpioPadding(int64(len(body)))))
+	}
+	for name, body := range files {
+		writeEntry(name, cpioTypeReg|0644, body)
+	}
+	writeEntry(cpioTrailer, 0, "")
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,84 @@
+package archiver
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// Sampler can read the headers of a random sample of
+// the items in an archive, which allows estimating the
+// composition of a huge archive without reading all
+// of its contents.
+type Sampler interface {
+	Sample(archive string, n int) (ArchiveSample, error)
+}
+
+// ArchiveSample is a random sample of the
+// items in an archive, made by a Sampler.
+type ArchiveSample struct {
+	// The number of items in the archive.
+	Total int
+
+	// The sampled items, in archive order. There
+	// are fewer than requested only if the archive
+	// has fewer items than that.
+	Entries []SampledEntry
+}
+
+// SampledEntry describes an item of an archive which
+// was sampled. The contents of the item are not read.
+type SampledEntry struct {
+	os.FileInfo
+
+	// The slash-separated path of the item in the archive.
+	Path string
+
+	// The original header of the item; depends
+	// on the type of archive.
+	Header interface{}
+}
+
+// SampleStats are statistics about the sampled items
+// of one kind, along with estimates of the same for
+// the whole archive.
+type SampleStats struct {
+	Count int   // number of sampled items
+	Size  int64 // total size of sampled items
+
+	EstimatedCount int   // estimated number of items in the archive
+	EstimatedSize  int64 // estimated total size of items in the archive
+}
+
+// Composition groups the sampled regular files by their
+// (lower-cased) file extension, which is "" for files
+// with no extension, and returns statistics for each.
+func (s ArchiveSample) Composition() map[string]SampleStats {
+	stats := make(map[string]SampleStats)
+	for _, e := range s.Entries {
+		if !e.Mode().IsRegular() {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(e.Path))
+		st := stats[ext]
+		st.Count++
+		st.Size += e.Size()
+		stats[ext] = st
+	}
+
+	// every sampled item stands for the
+	// same number of items in the archive
+	if len(s.Entries) > 0 {
+		scale := float64(s.Total) / float64(len(s.Entries))
+		for ext, st := range stats {
+			st.EstimatedCount = int(float64(st.Count)*scale + 0.5)
+			st.EstimatedSize = int64(float64(st.Size)*scale + 0.5)
+			stats[ext] = st
+		}
+	}
+
+	return stats
+}
+
+// Compile-time checks to ensure type implements desired interfaces.
+var _ = os.FileInfo(SampledEntry{})
@@ -0,0 +1,95 @@
+package archiver
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSample(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, af := range []interface{}{
+		&Zip{CompressionLevel: flate.DefaultCompression},
+		&Tar{},
+		&TarGz{Tar: &Tar{}, CompressionLevel: gzip.DefaultCompression},
+	} {
+		archive := filepath.Join(tmp, "sample_test."+af.(interface{ String() string }).String())
+		err := af.(Archiver).Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatalf("[%s] making archive: %v", af, err)
+		}
+
+		var all []string
+		err = af.(Walker).Walk(archive, func(f File) error {
+			all = append(all, entryPath(f))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("[%s] walking: %v", af, err)
+		}
+		position := make(map[string]int)
+		for i, p := range all {
+			position[p] = i
+		}
+
+		s := af.(Sampler)
+		for _, n := range []int{1, 3, len(all), len(all) + 10} {
+			sample, err := s.Sample(archive, n)
+			if err != nil {
+				t.Fatalf("[%s] sampling %d: %v", af, n, err)
+			}
+			if sample.Total != len(all) {
+				t.Errorf("[%s] expected total of %d, got %d", af, len(all), sample.Total)
+			}
+			expected := n
+			if expected > len(all) {
+				expected = len(all)
+			}
+			if len(sample.Entries) != expected {
+				t.Fatalf("[%s] expected %d sampled entries, got %d", af, expected, len(sample.Entries))
+			}
+
+			// entries must be distinct items of the
+			// archive, in archive order
+			last := -1
+			for _, e := range sample.Entries {
+				pos, ok := position[e.Path]
+				if !ok {
+					t.Fatalf("[%s] sampled entry %s not in archive", af, e.Path)
+				}
+				if pos <= last {
+					t.Errorf("[%s] sampled entries out of order or repeated: %s", af, e.Path)
+				}
+				last = pos
+			}
+
+			// a full sample estimates the archive exactly
+			if n >= len(all) {
+				var files int
+				for _, e := range sample.Entries {
+					if e.Mode().IsRegular() {
+						files++
+					}
+				}
+				var estimated int
+				for _, st := range sample.Composition() {
+					if st.EstimatedCount != st.Count {
+						t.Errorf("[%s] expected estimate %d to equal count %d for full sample", af, st.EstimatedCount, st.Count)
+					}
+					estimated += st.EstimatedCount
+				}
+				if estimated != files {
+					t.Errorf("[%s] expected composition of %d files, got %d", af, files, estimated)
+				}
+			}
+		}
+	}
+}
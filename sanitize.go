@@ -0,0 +1,103 @@
+package archiver
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NameSanitization is how the names of entries being
+// extracted are cleaned up, so that archives made on other
+// systems, or made to trick whoever extracts them, are
+// extracted to names which are valid and harmless. Names
+// which are rewritten are reported as warnings, and the
+// names they were extracted to are in the Paths of the
+// result. The zero value leaves names as they are.
+type NameSanitization struct {
+	// If true, control characters, such as newlines and
+	// the escape sequences of terminals, are removed.
+	StripControl bool
+
+	// If true, names which Windows reserves for devices,
+	// such as CON, NUL, COM1 and LPT1 (with extensions or
+	// not), and names which end with a dot or a space,
+	// which Windows cannot make, are rejected with an
+	// error which is ErrIllegalPath, wherever they are
+	// in the path of an entry.
+	RejectReserved bool
+
+	// If true, names are normalized to Unicode NFC, so
+	// that names written in NFD, as macOS does, are not
+	// extracted as files other than those of the same
+	// names in NFC, which most systems use.
+	NormalizeUnicode bool
+}
+
+// WarningName is the kind of warnings for the
+// names of entries which are rewritten.
+const WarningName WarningKind = "file name"
+
+// sanitize returns name sanitized as s says.
+func (s NameSanitization) sanitize(name string) (string, error) {
+	clean := name
+	if s.StripControl {
+		clean = strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, clean)
+		if clean == "" {
+			return "", pathErrorf(ErrIllegalPath, name, "%q: name has only control characters", name)
+		}
+	}
+	if s.NormalizeUnicode {
+		clean = norm.NFC.String(clean)
+	}
+	if s.RejectReserved {
+		for _, elem := range strings.FieldsFunc(clean, func(r rune) bool { return r == '/' || r == '\\' }) {
+			if elem == "." || elem == ".." {
+				continue
+			}
+			if strings.HasSuffix(elem, ".") || strings.HasSuffix(elem, " ") {
+				return "", pathErrorf(ErrIllegalPath, name, "%s: name %q ends with a dot or space", name, elem)
+			}
+			if windowsReserved(elem) {
+				return "", pathErrorf(ErrIllegalPath, name, "%s: name %q is reserved on Windows", name, elem)
+			}
+		}
+	}
+	return clean, nil
+}
+
+// windowsReserved returns true if Windows reserves
+// name for a device, whatever its extension.
+func windowsReserved(name string) bool {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.ToUpper(strings.TrimRight(name, " "))
+	switch name {
+	case "CON", "PRN", "AUX", "NUL", "CONIN$", "CONOUT$":
+		return true
+	}
+	return len(name) == 4 && (strings.HasPrefix(name, "COM") || strings.HasPrefix(name, "LPT")) &&
+		'0' <= name[3] && name[3] <= '9'
+}
+
+// sanitizeName returns name sanitized as s says, adding
+// a warning to warnings and logging it to logger if it is
+// rewritten; warnings may be nil to only sanitize it.
+func sanitizeName(s NameSanitization, name string, logger Logger, warnings *[]Warning) (string, error) {
+	clean, err := s.sanitize(name)
+	if err != nil || clean == name || warnings == nil {
+		return clean, err
+	}
+	return clean, addWarning(logger, warnings, false, Warning{
+		Path:   name,
+		Kind:   WarningName,
+		Detail: fmt.Sprintf("extracted as %q", clean),
+	})
+}
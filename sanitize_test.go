@@ -0,0 +1,87 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNameSanitization(t *testing.T) {
+	all := NameSanitization{StripControl: true, RejectReserved: true, NormalizeUnicode: true}
+	for i, tc := range []struct {
+		sanitize  NameSanitization
+		name      string
+		expect    string
+		expectErr bool
+	}{
+		{sanitize: all, name: "dir/file.txt", expect: "dir/file.txt"},
+		{sanitize: all, name: "evil\x1b[2J\n.txt", expect: "evil[2J.txt"},
+		{sanitize: NameSanitization{}, name: "evil\n.txt", expect: "evil\n.txt"},
+		{sanitize: all, name: "\n\t", expectErr: true},
+		{sanitize: all, name: "dir/CON", expectErr: true},
+		{sanitize: all, name: "nul.txt", expectErr: true},
+		{sanitize: all, name: "Com1.log", expectErr: true},
+		{sanitize: all, name: "lpt9", expectErr: true},
+		{sanitize: all, name: "CONSOLE.txt", expect: "CONSOLE.txt"},
+		{sanitize: all, name: "COM10", expect: "COM10"},
+		{sanitize: all, name: "dir./file", expectErr: true},
+		{sanitize: all, name: "file ", expectErr: true},
+		{sanitize: all, name: "../file", expect: "../file"}, // left to extractPath
+		{sanitize: NameSanitization{StripControl: true}, name: "CON", expect: "CON"},
+		{sanitize: all, name: "cafe\u0301.txt", expect: "caf\u00e9.txt"},
+		{sanitize: NameSanitization{StripControl: true}, name: "cafe\u0301.txt", expect: "cafe\u0301.txt"},
+	} {
+		got, err := tc.sanitize.sanitize(tc.name)
+		if tc.expectErr {
+			if !errors.Is(err, ErrIllegalPath) {
+				t.Errorf("Test %d: expected illegal path error for %q, got %q (%v)", i, tc.name, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error for %q: %v", i, tc.name, err)
+			continue
+		}
+		if got != tc.expect {
+			t.Errorf("Test %d: expected %q to be sanitized to %q, got %q", i, tc.name, tc.expect, got)
+		}
+	}
+}
+
+func TestSanitizeNamesUnarchive(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, name := range []string{"plain.txt", "bell\a.txt"} {
+		err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+
+	tr := &Tar{MkdirAll: true, SanitizeNames: NameSanitization{StripControl: true}}
+	err = tr.UnarchiveReader(bytes.NewReader(buf.Bytes()), tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(filepath.Join(tmp, "bell.txt")) {
+		t.Errorf("expected file to be extracted with control character removed")
+	}
+	warnings := tr.Warnings()
+	if len(warnings) != 1 || warnings[0].Kind != WarningName || warnings[0].Path != "bell\a.txt" {
+		t.Errorf("expected a warning for the name which was rewritten, got %v", warnings)
+	}
+	if p := tr.Result().Paths["bell\a.txt"]; p != filepath.Join(tmp, "bell.txt") {
+		t.Errorf("expected result to map name to the path extracted to, got %q", p)
+	}
+}
@@ -0,0 +1,9 @@
+package archiver
+
+import "sync"
+
+// sessionMu guards the results of operations which
+// sessions of formats save to the formats they were
+// made from, so that formats can do operations
+// concurrently.
+var sessionMu sync.Mutex
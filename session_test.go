@@ -0,0 +1,130 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentOperations(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	tr := &Tar{MkdirAll: true}
+	for _, format := range []interface {
+		Archiver
+		Unarchiver
+		Walker
+		ResultReporter
+	}{
+		&TarGz{Tar: tr},
+		&TarZst{Tar: tr},
+		&Zip{MkdirAll: true},
+	} {
+		ext := format.(interface{ String() string }).String()
+		var wg sync.WaitGroup
+		errs := make(chan error, 16)
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				archive := filepath.Join(tmp, fmt.Sprintf("test%d.%s", i, ext))
+				err := ArchiveContext(context.Background(), format, []string{"testdata"}, archive)
+				if err != nil {
+					errs <- fmt.Errorf("archiving %s: %v", archive, err)
+					return
+				}
+				var files int
+				err = format.Walk(archive, func(f File) error {
+					if !f.IsDir() {
+						files++
+					}
+					return nil
+				})
+				if err != nil {
+					errs <- fmt.Errorf("walking %s: %v", archive, err)
+					return
+				}
+				err = format.Unarchive(archive, filepath.Join(tmp, fmt.Sprintf("%s%d", ext, i)))
+				if err != nil {
+					errs <- fmt.Errorf("extracting %s: %v", archive, err)
+					return
+				}
+				if files == 0 {
+					errs <- fmt.Errorf("walking %s: no files", archive)
+				}
+				format.Result()
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Error(err)
+		}
+		if format.Result().Files == 0 {
+			t.Errorf("[%s] expected result of last operation, got %+v", ext, format.Result())
+		}
+	}
+
+	// the Tar shared by the compressed formats
+	// still writes uncompressed tarballs
+	archive := filepath.Join(tmp, "test.tar")
+	err = tr.Archive([]string{"testdata"}, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	name, _, err := DetectFormat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "tar" {
+		t.Errorf("expected shared Tar to write a tarball, got %s", name)
+	}
+}
+
+func TestClone(t *testing.T) {
+	for _, tr := range []*Tar{
+		DefaultTarBz2.Tar,
+		DefaultTarGz.Tar,
+		DefaultTarLz4.Tar,
+		DefaultTarLzma.Tar,
+		DefaultTarSz.Tar,
+		DefaultTarXz.Tar,
+		DefaultTarZst.Tar,
+	} {
+		if tr == DefaultTar {
+			t.Error("expected default compressed tar formats to have their own Tar")
+		}
+		if !tr.MkdirAll {
+			t.Errorf("expected settings of DefaultTar, got %+v", tr)
+		}
+	}
+
+	tgz := &TarGz{Tar: &Tar{ExcludePatterns: []string{"*.txt"}}}
+	c := tgz.Clone()
+	c.OverwriteExisting = true
+	c.ExcludePatterns[0] = "*.log"
+	c.CompressionLevel = 1
+	if tgz.OverwriteExisting || tgz.ExcludePatterns[0] != "*.txt" || tgz.CompressionLevel != 0 {
+		t.Errorf("expected clone to be changed without changing original, got %+v and %+v", tgz, tgz.Tar)
+	}
+
+	z := &Zip{ExcludePatterns: []string{"*.txt"}}
+	zc := z.Clone()
+	zc.ExcludePatterns[0] = "*.log"
+	if z.ExcludePatterns[0] != "*.txt" {
+		t.Errorf("expected clone to be changed without changing original, got %v", z.ExcludePatterns)
+	}
+}
@@ -0,0 +1,321 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/scrypt"
+)
+
+// SigningKey is an Ed25519 key which signs archives as
+// they are written, with detached signatures in the format
+// of minisign (https://jedisct1.github.io/minisign/), so
+// that they can be checked with VerifySignature or with
+// `minisign -V`.
+type SigningKey struct {
+	// The number of the key, which
+	// signatures name it by.
+	ID [8]byte
+
+	PrivateKey ed25519.PrivateKey
+}
+
+// GenerateSigningKey returns a new signing key,
+// with a random ID.
+func GenerateSigningKey() (*SigningKey, error) {
+	k := new(SigningKey)
+	_, err := rand.Read(k.ID[:])
+	if err != nil {
+		return nil, err
+	}
+	_, k.PrivateKey, err = ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// PublicKey returns the public key of k, which checks
+// its signatures, as minisign prints it.
+func (k *SigningKey) PublicKey() string {
+	b := append([]byte(minisignAlgorithm), k.ID[:]...)
+	b = append(b, k.PrivateKey.Public().(ed25519.PublicKey)...)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// The algorithms named in minisign keys and signatures:
+// signatures of minisignAlgorithm are of the contents,
+// and of minisignHashedAlgorithm of their BLAKE2b-512
+// hash, which can be computed as they are written.
+const (
+	minisignAlgorithm       = "Ed"
+	minisignHashedAlgorithm = "ED"
+)
+
+// ReadSigningKey reads the secret key of minisign from r,
+// as written by `minisign -G`, decrypting it with password
+// if it is encrypted. If password is wrong, the error is
+// ErrWrongPassword.
+func ReadSigningKey(r io.Reader, password string) (*SigningKey, error) {
+	b, err := readMinisignLine(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading secret key: %w", err)
+	}
+	// algorithms, salt and limits of the KDF, then the
+	// key number, secret key and checksum (encrypted)
+	if len(b) != 158 || string(b[:2]) != minisignAlgorithm || string(b[4:6]) != "B2" {
+		return nil, fmt.Errorf("not a minisign secret key")
+	}
+	keyNumSK := b[54:]
+	encrypted := string(b[2:4]) == "Sc"
+	if encrypted {
+		if password == "" {
+			return nil, fmt.Errorf("secret key is encrypted: %w", ErrWrongPassword)
+		}
+		stream, err := minisignKDF(password, b[6:38], binary.LittleEndian.Uint64(b[38:]), binary.LittleEndian.Uint64(b[46:]), len(keyNumSK))
+		if err != nil {
+			return nil, fmt.Errorf("deriving key: %w", err)
+		}
+		for i := range keyNumSK {
+			keyNumSK[i] ^= stream[i]
+		}
+	} else if b[2] != 0 || b[3] != 0 {
+		return nil, fmt.Errorf("unknown key derivation algorithm: %q", b[2:4])
+	}
+
+	k := &SigningKey{PrivateKey: ed25519.PrivateKey(keyNumSK[8:72])}
+	copy(k.ID[:], keyNumSK[:8])
+	if subtle.ConstantTimeCompare(k.checksum(), keyNumSK[72:]) != 1 {
+		if encrypted {
+			return nil, ErrWrongPassword
+		}
+		return nil, fmt.Errorf("checksum of secret key does not match")
+	}
+	return k, nil
+}
+
+// checksum returns the checksum which
+// minisign stores with the secret key.
+func (k *SigningKey) checksum() []byte {
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte(minisignAlgorithm))
+	h.Write(k.ID[:])
+	h.Write(k.PrivateKey)
+	return h.Sum(nil)
+}
+
+// minisignKDF derives n bytes from password and salt with
+// scrypt, whose parameters it chooses from the limits of
+// operations and memory as libsodium does.
+func minisignKDF(password string, salt []byte, opsLimit, memLimit uint64, n int) ([]byte, error) {
+	if opsLimit < 32768 {
+		opsLimit = 32768
+	}
+	r := uint64(8)
+	p := uint64(1)
+	maxN := memLimit / (r * 128)
+	if opsLimit < memLimit/32 {
+		maxN = opsLimit / (r * 4)
+	}
+	logN := uint(1)
+	for ; logN < 63; logN++ {
+		if 1<<logN > maxN/2 {
+			break
+		}
+	}
+	if opsLimit >= memLimit/32 {
+		maxRP := (opsLimit / 4) / (1 << logN)
+		if maxRP > 0x3fffffff {
+			maxRP = 0x3fffffff
+		}
+		p = maxRP / r
+	}
+	return scrypt.Key([]byte(password), salt, 1<<logN, int(r), int(p), n)
+}
+
+// readMinisignLine reads the first line of a minisign
+// key or signature from r which is not a comment, and
+// decodes it.
+func readMinisignLine(r io.Reader) ([]byte, error) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		return base64.StdEncoding.DecodeString(line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// SignatureReporter is a type which can sign
+// the archives it writes.
+type SignatureReporter interface {
+	Signature() []byte
+}
+
+// signatureTracker signs the archive being
+// written, if asked to.
+type signatureTracker struct {
+	key       *SigningKey
+	hash      hash.Hash // of the archive written so far
+	signature []byte
+}
+
+// reset starts a new signature with key of the archive
+// written to w, and returns the writer to write the
+// archive to instead; if key is nil, nothing is signed.
+func (st *signatureTracker) reset(key *SigningKey, w io.Writer) io.Writer {
+	st.key = key
+	st.signature = nil
+	st.hash = nil
+	if key == nil {
+		return w
+	}
+	st.hash, _ = blake2b.New512(nil)
+	return io.MultiWriter(w, st.hash)
+}
+
+// prefix hashes what is read from r as the start of
+// the archive, which is already written, such as
+// the tarball being appended to.
+func (st *signatureTracker) prefix(r io.Reader) error {
+	if st.hash == nil {
+		return nil
+	}
+	_, err := io.Copy(st.hash, r)
+	return err
+}
+
+// sign signs the archive once it is all written,
+// saying in the trusted comment that it was at now.
+func (st *signatureTracker) sign(now time.Time) {
+	if st.hash == nil {
+		return
+	}
+	sig := ed25519.Sign(st.key.PrivateKey, st.hash.Sum(nil))
+	comment := fmt.Sprintf("timestamp:%d\thashed", now.Unix())
+	global := ed25519.Sign(st.key.PrivateKey, append(sig, comment...))
+
+	b := append([]byte(minisignHashedAlgorithm), st.key.ID[:]...)
+	b = append(b, sig...)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "untrusted comment: signature from secret key %016X\n", binary.LittleEndian.Uint64(st.key.ID[:]))
+	fmt.Fprintf(&buf, "%s\n", base64.StdEncoding.EncodeToString(b))
+	fmt.Fprintf(&buf, "trusted comment: %s\n", comment)
+	fmt.Fprintf(&buf, "%s\n", base64.StdEncoding.EncodeToString(global))
+	st.signature = buf.Bytes()
+	st.hash = nil
+}
+
+// get returns the signature made, if any.
+func (st *signatureTracker) get() []byte {
+	return st.signature
+}
+
+// writeFile writes the signature made, if any, next to
+// archive, in a file named like it with ".minisig"
+// appended, as minisign names signatures.
+func (st *signatureTracker) writeFile(archive string) error {
+	if st.signature == nil {
+		return nil
+	}
+	err := ioutil.WriteFile(archive+".minisig", st.signature, 0644)
+	if err != nil {
+		return fmt.Errorf("writing signature: %w", err)
+	}
+	return nil
+}
+
+// VerifySignature checks that the file named signature
+// (if empty, the file named like archive with ".minisig"
+// appended) is a signature of the archive at archive by
+// the key publicKey, as minisign prints public keys or
+// as the contents of their files. It is meant to be
+// called before archives are extracted, so that only
+// archives signed by a trusted key are. Signatures are
+// those written by Archive with a SigningKey, or by
+// minisign. If the archive, or the trusted comment of
+// the signature, is not what was signed by the key, the
+// error is ErrSignatureMismatch.
+func VerifySignature(archive, signature, publicKey string) error {
+	pk, err := readMinisignLine(strings.NewReader(publicKey))
+	if err != nil {
+		return fmt.Errorf("reading public key: %w", err)
+	}
+	if len(pk) != 42 || string(pk[:2]) != minisignAlgorithm {
+		return fmt.Errorf("not a minisign public key")
+	}
+	publicKeyID, key := pk[2:10], ed25519.PublicKey(pk[10:])
+
+	if signature == "" {
+		signature = archive + ".minisig"
+	}
+	sigFile, err := ioutil.ReadFile(signature)
+	if err != nil {
+		return fmt.Errorf("reading signature: %w", err)
+	}
+	lines := strings.Split(strings.TrimRight(string(sigFile), "\r\n"), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return pathErrorf(ErrSignatureMismatch, signature, "%s: not a minisign signature", signature)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 74 {
+		return pathErrorf(ErrSignatureMismatch, signature, "%s: malformed signature", signature)
+	}
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return pathErrorf(ErrSignatureMismatch, signature, "%s: malformed trusted comment signature", signature)
+	}
+	if !bytes.Equal(sig[2:10], publicKeyID) {
+		return pathErrorf(ErrSignatureMismatch, signature, "%s: signed by key %016X, not by key %016X",
+			signature, binary.LittleEndian.Uint64(sig[2:10]), binary.LittleEndian.Uint64(publicKeyID))
+	}
+	comment := strings.TrimSuffix(strings.TrimPrefix(lines[2], "trusted comment: "), "\r")
+	if !ed25519.Verify(key, append(sig[10:74:74], comment...), global) {
+		return pathErrorf(ErrSignatureMismatch, signature, "%s: trusted comment does not match signature", signature)
+	}
+
+	var message []byte
+	switch string(sig[:2]) {
+	case minisignHashedAlgorithm:
+		file, err := os.Open(archive)
+		if err != nil {
+			return fmt.Errorf("opening archive: %w", err)
+		}
+		defer file.Close()
+		h, _ := blake2b.New512(nil)
+		_, err = io.Copy(h, file)
+		if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+		message = h.Sum(nil)
+	case minisignAlgorithm:
+		message, err = ioutil.ReadFile(archive)
+		if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+	default:
+		return pathErrorf(ErrUnsupportedType, signature, "%s: unknown signature algorithm %q", signature, sig[:2])
+	}
+	if !ed25519.Verify(key, message, sig[10:74]) {
+		return pathErrorf(ErrSignatureMismatch, archive, "%s: signature does not match archive", archive)
+	}
+	return nil
+}
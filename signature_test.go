@@ -0,0 +1,147 @@
+package archiver
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignature(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []interface {
+		Archiver
+		SignatureReporter
+	}{
+		&Tar{SigningKey: key},
+		&TarGz{Tar: &Tar{SigningKey: key}},
+		&Zip{SigningKey: key},
+	} {
+		archive := filepath.Join(tmp, "test."+format.(interface{ String() string }).String())
+		err := format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := ioutil.ReadFile(archive + ".minisig")
+		if err != nil {
+			t.Fatalf("[%s] expected signature file: %v", archive, err)
+		}
+		if !bytes.Equal(sig, format.Signature()) {
+			t.Errorf("[%s] expected signature file to be the signature, got %q and %q", archive, sig, format.Signature())
+		}
+
+		err = VerifySignature(archive, "", key.PublicKey())
+		if err != nil {
+			t.Errorf("[%s] expected signature to match: %v", archive, err)
+		}
+		err = VerifySignature(archive, "", otherKey.PublicKey())
+		if !errors.Is(err, ErrSignatureMismatch) {
+			t.Errorf("[%s] expected mismatch with other key, got %v", archive, err)
+		}
+
+		// a changed archive does not match
+		f, err := os.OpenFile(archive, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte{0})
+		f.Close()
+		err = VerifySignature(archive, "", key.PublicKey())
+		if !errors.Is(err, ErrSignatureMismatch) {
+			t.Errorf("[%s] expected mismatch with changed archive, got %v", archive, err)
+		}
+	}
+
+	// appending signs the whole tarball
+	archive := filepath.Join(tmp, "append.tar")
+	tr := &Tar{SigningKey: key}
+	err = tr.Archive([]string{"testdata/quote1.txt"}, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.Append(archive, []string{"testdata/proverbs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifySignature(archive, "", key.PublicKey())
+	if err != nil {
+		t.Errorf("expected signature of appended tarball to match: %v", err)
+	}
+
+	// a trusted comment which was changed does not match
+	sig := bytes.Replace(tr.Signature(), []byte("\thashed"), []byte("\thashed "), 1)
+	err = ioutil.WriteFile(archive+".minisig", sig, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifySignature(archive, "", key.PublicKey())
+	if !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("expected mismatch with changed trusted comment, got %v", err)
+	}
+}
+
+func TestReadSigningKey(t *testing.T) {
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a secret key encrypted as minisign does, with
+	// limits so low that scrypt is quick
+	b := []byte("EdScB2")
+	salt := make([]byte, 32)
+	rand.Read(salt)
+	b = append(b, salt...)
+	limits := make([]byte, 16)
+	binary.LittleEndian.PutUint64(limits, 32768)
+	binary.LittleEndian.PutUint64(limits[8:], 1<<24)
+	b = append(b, limits...)
+	keyNumSK := append(append(key.ID[:], key.PrivateKey...), key.checksum()...)
+	stream, err := minisignKDF("password", salt, 32768, 1<<24, len(keyNumSK))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range keyNumSK {
+		keyNumSK[i] ^= stream[i]
+	}
+	b = append(b, keyNumSK...)
+	file := "untrusted comment: minisign encrypted secret key\n" + base64.StdEncoding.EncodeToString(b) + "\n"
+
+	got, err := ReadSigningKey(bytes.NewBufferString(file), "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != key.ID || !ed25519.PrivateKey.Equal(got.PrivateKey, key.PrivateKey) {
+		t.Errorf("expected key %x, got %x", key.ID, got.ID)
+	}
+	if got.PublicKey() != key.PublicKey() {
+		t.Errorf("expected public key %s, got %s", key.PublicKey(), got.PublicKey())
+	}
+
+	for _, password := range []string{"wrong", ""} {
+		_, err = ReadSigningKey(bytes.NewBufferString(file), password)
+		if !errors.Is(err, ErrWrongPassword) {
+			t.Errorf("expected wrong password error for %q, got %v", password, err)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SnapshotProvider creates point-in-time snapshots of the
+// filesystems containing files to be archived, so that an
+// archive can be made of a consistent view of them even
+// while they are being modified.
+type SnapshotProvider interface {
+	// Snapshot takes a snapshot of the filesystem(s)
+	// containing paths, which are absolute.
+	Snapshot(paths []string) (Snapshot, error)
+}
+
+// Snapshot is a snapshot made by a SnapshotProvider.
+type Snapshot interface {
+	// Path translates the absolute, logical path of a
+	// file to the path of that file in the snapshot.
+	Path(logical string) (string, error)
+
+	// Release unmounts and deletes the snapshot.
+	Release() error
+}
+
+// SnapshotArchiver archives files from a snapshot of the
+// filesystem instead of from the live filesystem. The files
+// are read through the snapshot, but are named in the archive
+// as if they had been read from their original (logical)
+// location.
+type SnapshotArchiver struct {
+	// The format to write the archive in,
+	// for example &TarGz{Tar: &Tar{}}.
+	Format Writer
+
+	// The provider used to take the snapshot.
+	Provider SnapshotProvider
+
+	// If set, PreSnapshot is called with the (absolute)
+	// sources right before the snapshot is taken, which
+	// is useful to quiesce applications, for example by
+	// flushing and locking databases. If it returns an
+	// error, no snapshot is taken.
+	PreSnapshot func(sources []string) error
+
+	// If set, PostSnapshot is called with the sources
+	// right after the snapshot was taken, or failed to be
+	// taken, so that applications can resume. It is always
+	// called if PreSnapshot succeeded.
+	PostSnapshot func(sources []string) error
+
+	// Whether to overwrite existing files; if false,
+	// an error is returned if the file exists.
+	OverwriteExisting bool
+
+	// If true, errors encountered during reading
+	// or writing a single file will be logged and
+	// the operation will continue on remaining files.
+	ContinueOnError bool
+
+	// If set, errors skipped because of ContinueOnError
+	// are logged to this logger instead of the logger of
+	// the error log policy.
+	Logger Logger
+}
+
+// Archive takes a snapshot containing sources and writes
+// an archive of them, read from the snapshot, to
+// destination. The snapshot is released afterward.
+func (sa *SnapshotArchiver) Archive(sources []string, destination string) error {
+	if sa.Format == nil {
+		return fmt.Errorf("no format specified")
+	}
+	if sa.Provider == nil {
+		return fmt.Errorf("no snapshot provider specified")
+	}
+	if !sa.OverwriteExisting && fileExists(destination) {
+		return &PathError{Path: destination, Err: ErrDestinationExists}
+	}
+
+	absSources := make([]string, len(sources))
+	for i, source := range sources {
+		abs, err := filepath.Abs(source)
+		if err != nil {
+			return fmt.Errorf("%s: getting absolute path: %w", source, err)
+		}
+		absSources[i] = abs
+	}
+
+	snap, err := sa.snapshot(absSources)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := snap.Release(); err != nil {
+			logError(sa.Logger, "Releasing snapshot: %v", err)
+		}
+	}()
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", destination, err)
+	}
+	defer out.Close()
+
+	err = sa.Format.Create(out)
+	if err != nil {
+		return fmt.Errorf("creating archive: %w", err)
+	}
+	defer sa.Format.Close()
+
+	for i, source := range sources {
+		snapPath, err := snap.Path(absSources[i])
+		if err != nil {
+			return fmt.Errorf("%s: translating to snapshot path: %w", source, err)
+		}
+		err = sa.writeWalk(source, snapPath)
+		if err != nil {
+			return fmt.Errorf("walking %s: %w", source, err)
+		}
+	}
+
+	return sa.Format.Close()
+}
+
+// snapshot runs the hooks around taking a
+// snapshot of the filesystems containing sources.
+func (sa *SnapshotArchiver) snapshot(sources []string) (Snapshot, error) {
+	if sa.PreSnapshot != nil {
+		err := sa.PreSnapshot(sources)
+		if err != nil {
+			return nil, fmt.Errorf("running pre-snapshot hook: %w", err)
+		}
+	}
+
+	snap, err := sa.Provider.Snapshot(sources)
+	if err != nil {
+		err = fmt.Errorf("taking snapshot: %w", err)
+	}
+
+	if sa.PostSnapshot != nil {
+		postErr := sa.PostSnapshot(sources)
+		if postErr != nil && err == nil {
+			err = fmt.Errorf("running post-snapshot hook: %w", postErr)
+			if relErr := snap.Release(); relErr != nil {
+				logError(sa.Logger, "Releasing snapshot: %v", relErr)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+// writeWalk writes the files in snapPath, which is the
+// location of source in the snapshot, to the archive,
+// named as if they were read from source.
+func (sa *SnapshotArchiver) writeWalk(source, snapPath string) error {
+	sourceInfo, err := os.Stat(snapPath)
+	if err != nil {
+		return fmt.Errorf("%s: stat: %w", snapPath, err)
+	}
+	baseDir := makeBaseDir("", sourceInfo)
+
+	return filepath.Walk(snapPath, func(fpath string, info os.FileInfo, err error) error {
+		handleErr := func(err error) error {
+			if sa.ContinueOnError {
+				logError(sa.Logger, "Walking %s: %v", fpath, err)
+				return nil
+			}
+			return err
+		}
+		if err != nil {
+			return handleErr(fmt.Errorf("traversing %s: %w", fpath, err))
+		}
+		if info == nil {
+			return handleErr(fmt.Errorf("%s: no file info", fpath))
+		}
+
+		// name the file after its logical path
+		rel, err := filepath.Rel(snapPath, fpath)
+		if err != nil {
+			return handleErr(fmt.Errorf("%s: relativizing path: %w", fpath, err))
+		}
+		logicalPath := filepath.Join(source, rel)
+		nameInArchive, err := makeNameInArchive(sourceInfo, source, baseDir, logicalPath)
+		if err != nil {
+			return handleErr(err)
+		}
+
+		file, err := os.Open(fpath)
+		if err != nil {
+			return handleErr(fmt.Errorf("%s: opening: %w", fpath, err))
+		}
+		defer file.Close()
+
+		err = sa.Format.Write(File{
+			FileInfo: FileInfo{
+				FileInfo:   info,
+				CustomName: nameInArchive,
+			},
+			ReadCloser: file,
+		})
+		if err != nil {
+			return handleErr(fmt.Errorf("%s: writing: %w", fpath, err))
+		}
+
+		return nil
+	})
+}
+
+// SnapshotMount maps a logical directory to the
+// directory where its snapshot is mounted.
+type SnapshotMount struct {
+	Logical  string
+	Snapshot string
+}
+
+// MountedSnapshot is a Snapshot whose contents are
+// accessible at one or more mount points. It is useful
+// for implementing SnapshotProviders.
+type MountedSnapshot struct {
+	Mounts []SnapshotMount
+
+	// Called by Release to unmount and
+	// delete the snapshot, if set.
+	ReleaseFunc func() error
+}
+
+// Path returns the path of the file at the logical path
+// in the snapshot, using the mount with the longest
+// logical directory which contains it.
+func (ms *MountedSnapshot) Path(logical string) (string, error) {
+	mounts := make([]SnapshotMount, len(ms.Mounts))
+	copy(mounts, ms.Mounts)
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return len(mounts[i].Logical) > len(mounts[j].Logical)
+	})
+	logical = filepath.Clean(logical)
+	for _, m := range mounts {
+		rel, err := filepath.Rel(filepath.Clean(m.Logical), logical)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return filepath.Join(m.Snapshot, rel), nil
+	}
+	return "", fmt.Errorf("%s: not within any snapshot", logical)
+}
+
+// Release calls ms.ReleaseFunc, if set.
+func (ms *MountedSnapshot) Release() error {
+	if ms.ReleaseFunc != nil {
+		return ms.ReleaseFunc()
+	}
+	return nil
+}
+
+// runCommand runs the named program with the given
+// arguments and returns its standard output. If the
+// program fails, its standard error is in the error.
+func runCommand(name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = Archiver(new(SnapshotArchiver))
+	_ = Snapshot(new(MountedSnapshot))
+)
@@ -0,0 +1,140 @@
+package archiver
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestSnapshotArchiver(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	logical, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	sa := &SnapshotArchiver{
+		Format:   &Tar{},
+		Provider: testSnapshotProvider{dir: filepath.Join(tmp, "snap"), events: &events},
+		PreSnapshot: func(sources []string) error {
+			events = append(events, "pre")
+			return nil
+		},
+		PostSnapshot: func(sources []string) error {
+			events = append(events, "post")
+			return nil
+		},
+	}
+	err = sa.Archive([]string{"testdata"}, filepath.Join(tmp, "snap.tar"))
+	if err != nil {
+		t.Fatalf("archiving from snapshot: %v", err)
+	}
+	if fmt.Sprint(events) != "[pre snapshot post release]" {
+		t.Errorf("unexpected sequence of events: %v", events)
+	}
+
+	// the archive should look like one made directly
+	err = (&Tar{}).Archive([]string{logical}, filepath.Join(tmp, "live.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapNames := tarNames(t, filepath.Join(tmp, "snap.tar"))
+	liveNames := tarNames(t, filepath.Join(tmp, "live.tar"))
+	if fmt.Sprint(snapNames) != fmt.Sprint(liveNames) {
+		t.Errorf("expected names %v but got %v", liveNames, snapNames)
+	}
+}
+
+func TestMountedSnapshotPath(t *testing.T) {
+	ms := &MountedSnapshot{
+		Mounts: []SnapshotMount{
+			{Logical: filepath.FromSlash("/"), Snapshot: filepath.FromSlash("/snap/root")},
+			{Logical: filepath.FromSlash("/home"), Snapshot: filepath.FromSlash("/snap/home")},
+		},
+	}
+	for i, tc := range []struct {
+		logical, expect string
+	}{
+		{logical: "/home/user/docs", expect: "/snap/home/user/docs"},
+		{logical: "/home", expect: "/snap/home"},
+		{logical: "/homework", expect: "/snap/root/homework"},
+		{logical: "/etc/hosts", expect: "/snap/root/etc/hosts"},
+	} {
+		actual, err := ms.Path(filepath.FromSlash(tc.logical))
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		if actual != filepath.FromSlash(tc.expect) {
+			t.Errorf("Test %d: expected '%s' but got '%s'", i, tc.expect, actual)
+		}
+	}
+}
+
+// testSnapshotProvider "snapshots" by copying
+// the files to a directory.
+type testSnapshotProvider struct {
+	dir    string
+	events *[]string
+}
+
+func (p testSnapshotProvider) Snapshot(paths []string) (Snapshot, error) {
+	*p.events = append(*p.events, "snapshot")
+	ms := &MountedSnapshot{
+		ReleaseFunc: func() error {
+			*p.events = append(*p.events, "release")
+			return os.RemoveAll(p.dir)
+		},
+	}
+	for i, root := range paths {
+		snapRoot := filepath.Join(p.dir, fmt.Sprint(i), filepath.Base(root))
+		err := filepath.Walk(root, func(fpath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, fpath)
+			if err != nil {
+				return err
+			}
+			to := filepath.Join(snapRoot, rel)
+			if info.IsDir() {
+				return os.MkdirAll(to, info.Mode())
+			}
+			in, err := os.Open(fpath)
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			return writeNewFile(to, in, info.Mode())
+		})
+		if err != nil {
+			return nil, err
+		}
+		ms.Mounts = append(ms.Mounts, SnapshotMount{Logical: root, Snapshot: snapRoot})
+	}
+	return ms, nil
+}
+
+func tarNames(t *testing.T, filename string) []string {
+	var names []string
+	err := (&Tar{}).Walk(filename, func(f File) error {
+		names = append(names, f.Header.(*tar.Header).Name)
+		_, err := io.Copy(ioutil.Discard, f)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("walking %s: %v", filename, err)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,45 @@
+package archiver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VSSSnapshots takes Volume Shadow Copy Service
+// snapshots of a volume on Windows. It requires
+// PowerShell and administrator privileges.
+type VSSSnapshots struct {
+	// The volume to snapshot, for example `C:\`.
+	Volume string
+}
+
+// Snapshot creates a shadow copy of the volume.
+func (v VSSSnapshots) Snapshot(paths []string) (Snapshot, error) {
+	volume := strings.TrimSuffix(v.Volume, `\`) + `\`
+	script := fmt.Sprintf(`$r = (Get-WmiObject -List Win32_ShadowCopy).Create('%s', 'ClientAccessible')
+if ($r.ReturnValue -ne 0) { throw "creating shadow copy: error $($r.ReturnValue)" }
+$s = Get-WmiObject Win32_ShadowCopy | Where-Object { $_.ID -eq $r.ShadowID }
+Write-Output $s.ID
+Write-Output $s.DeviceObject`, strings.Replace(volume, "'", "''", -1))
+
+	out, err := runCommand("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("unexpected output creating shadow copy: %q", out)
+	}
+	id, device := fields[0], fields[1]
+
+	return &MountedSnapshot{
+		Mounts: []SnapshotMount{{Logical: volume, Snapshot: device + `\`}},
+		ReleaseFunc: func() error {
+			_, err := runCommand("vssadmin", "delete", "shadows", "/shadow="+id, "/quiet")
+			return err
+		},
+	}, nil
+}
+
+// Compile-time checks to ensure type implements desired interfaces.
+var _ = SnapshotProvider(VSSSnapshots{})
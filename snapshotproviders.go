@@ -0,0 +1,155 @@
+package archiver
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BtrfsSnapshots takes read-only snapshots
+// of a Btrfs subvolume. It requires the
+// btrfs program and sufficient privileges.
+type BtrfsSnapshots struct {
+	// The path at which the subvolume is mounted.
+	Subvolume string
+
+	// The directory, on the same filesystem, in
+	// which to create snapshots; if empty, they
+	// are created in the subvolume itself.
+	SnapshotDir string
+}
+
+// Snapshot takes a snapshot of the subvolume.
+func (b BtrfsSnapshots) Snapshot(paths []string) (Snapshot, error) {
+	dir := b.SnapshotDir
+	if dir == "" {
+		dir = b.Subvolume
+	}
+	snapPath := filepath.Join(dir, snapshotName())
+	_, err := runCommand("btrfs", "subvolume", "snapshot", "-r", b.Subvolume, snapPath)
+	if err != nil {
+		return nil, err
+	}
+	return &MountedSnapshot{
+		Mounts: []SnapshotMount{{Logical: b.Subvolume, Snapshot: snapPath}},
+		ReleaseFunc: func() error {
+			_, err := runCommand("btrfs", "subvolume", "delete", snapPath)
+			return err
+		},
+	}, nil
+}
+
+// ZFSSnapshots takes snapshots of a ZFS dataset,
+// which are accessed through the .zfs directory
+// of the dataset. It requires the zfs program
+// and sufficient privileges.
+type ZFSSnapshots struct {
+	// The name of the dataset, for example "tank/home".
+	Dataset string
+
+	// The path at which the dataset is mounted;
+	// if empty, it is looked up.
+	Mountpoint string
+}
+
+// Snapshot takes a snapshot of the dataset.
+func (z ZFSSnapshots) Snapshot(paths []string) (Snapshot, error) {
+	mountpoint := z.Mountpoint
+	if mountpoint == "" {
+		out, err := runCommand("zfs", "get", "-H", "-o", "value", "mountpoint", z.Dataset)
+		if err != nil {
+			return nil, err
+		}
+		mountpoint = strings.TrimSpace(out)
+	}
+
+	name := snapshotName()
+	fullName := z.Dataset + "@" + name
+	_, err := runCommand("zfs", "snapshot", fullName)
+	if err != nil {
+		return nil, err
+	}
+	return &MountedSnapshot{
+		Mounts: []SnapshotMount{{
+			Logical:  mountpoint,
+			Snapshot: filepath.Join(mountpoint, ".zfs", "snapshot", name),
+		}},
+		ReleaseFunc: func() error {
+			_, err := runCommand("zfs", "destroy", fullName)
+			return err
+		},
+	}, nil
+}
+
+// LVMSnapshots takes snapshots of an LVM logical
+// volume and mounts them read-only. It requires the
+// LVM tools, mount and umount, and root privileges.
+type LVMSnapshots struct {
+	// The volume group and name of the origin
+	// volume, for example "vg0" and "home".
+	VolumeGroup   string
+	LogicalVolume string
+
+	// The path at which the origin volume is mounted.
+	Mountpoint string
+
+	// The space to allocate for changes to the
+	// origin while the snapshot exists, in a form
+	// accepted by lvcreate, for example "1G".
+	Size string
+
+	// The (existing) directory on which to
+	// mount the snapshot.
+	MountDir string
+}
+
+// Snapshot takes a snapshot of the logical volume
+// and mounts it.
+func (l LVMSnapshots) Snapshot(paths []string) (Snapshot, error) {
+	if l.Size == "" {
+		return nil, fmt.Errorf("no snapshot size specified")
+	}
+	name := snapshotName()
+	volume := l.VolumeGroup + "/" + name
+	_, err := runCommand("lvcreate", "--snapshot", "--size", l.Size,
+		"--name", name, l.VolumeGroup+"/"+l.LogicalVolume)
+	if err != nil {
+		return nil, err
+	}
+	removeVolume := func() error {
+		_, err := runCommand("lvremove", "--force", volume)
+		return err
+	}
+
+	_, err = runCommand("mount", "-o", "ro", "/dev/"+volume, l.MountDir)
+	if err != nil {
+		if rmErr := removeVolume(); rmErr != nil {
+			return nil, fmt.Errorf("%w (removing snapshot volume: %v)", err, rmErr)
+		}
+		return nil, err
+	}
+
+	return &MountedSnapshot{
+		Mounts: []SnapshotMount{{Logical: l.Mountpoint, Snapshot: l.MountDir}},
+		ReleaseFunc: func() error {
+			_, err := runCommand("umount", l.MountDir)
+			if err != nil {
+				return err
+			}
+			return removeVolume()
+		},
+	}, nil
+}
+
+// snapshotName returns a name for a new snapshot.
+func snapshotName() string {
+	return "archiver-" + time.Now().UTC().Format("20060102T150405Z")
+}
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = SnapshotProvider(BtrfsSnapshots{})
+	_ = SnapshotProvider(ZFSSnapshots{})
+	_ = SnapshotProvider(LVMSnapshots{})
+)
@@ -0,0 +1,62 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// spaceReporter is a FileSystem which can tell
+// how much space is available in it.
+type spaceReporter interface {
+	AvailableSpace(path string) (int64, error)
+}
+
+// errSpaceUnsupported is returned by availableSpace on
+// systems where the space available cannot be known.
+var errSpaceUnsupported = fmt.Errorf("available space cannot be known on this system")
+
+// AvailableSpace returns the number of bytes which the
+// user can write to the filesystem of the file or folder
+// at path, which must exist.
+func (OSFileSystem) AvailableSpace(path string) (int64, error) { return availableSpace(path) }
+
+// spaceAvailableIn returns the number of bytes available
+// for the files extracted to destination in fsys, which
+// may not exist yet, and false if it cannot be known.
+func spaceAvailableIn(fsys FileSystem, destination string) (int64, bool) {
+	sr, ok := fsys.(spaceReporter)
+	if !ok {
+		return 0, false
+	}
+	// the destination is made when files are
+	// extracted, on the filesystem of its parent
+	dir := destination
+	for {
+		_, err := fsys.Stat(dir)
+		if err == nil || !os.IsNotExist(err) {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	space, err := sr.AvailableSpace(dir)
+	if err != nil {
+		return 0, false
+	}
+	return space, true
+}
+
+// checkSpace returns an error which is ErrInsufficientSpace
+// if required bytes of files cannot be extracted to
+// destination, which has space bytes available.
+func checkSpace(destination string, required, space int64) error {
+	if required <= space {
+		return nil
+	}
+	return pathErrorf(ErrInsufficientSpace, destination,
+		"%s: files to extract need %d bytes, but only %d are available", destination, required, space)
+}
@@ -0,0 +1,6 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!windows
+
+package archiver
+
+func availableSpace(path string) (int64, error) { return 0, errSpaceUnsupported }
@@ -0,0 +1,21 @@
+//go:build darwin || dragonfly || freebsd || linux
+// +build darwin dragonfly freebsd linux
+
+package archiver
+
+import (
+	"os"
+	"syscall"
+)
+
+// availableSpace returns the number of bytes which
+// unprivileged users can write to the filesystem of
+// the file at path.
+func availableSpace(path string) (int64, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return 0, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
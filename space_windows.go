@@ -0,0 +1,24 @@
+package archiver
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// availableSpace returns the number of bytes which the
+// user can write to the volume of the file at path.
+func availableSpace(path string) (int64, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available uint64
+	r, _, err := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&available)), 0, 0)
+	if r == 0 {
+		return 0, &os.PathError{Op: "GetDiskFreeSpaceEx", Path: path, Err: err}
+	}
+	return int64(available), nil
+}
@@ -0,0 +1,183 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// paxSparsePrefix is the prefix of the PAX records of
+// sparse files, as GNU tar writes them, which are
+// written with paxSparsePlaceholder in their place.
+const (
+	paxSparsePrefix      = "GNU.sparse."
+	paxSparsePlaceholder = "GNU_sparse."
+)
+
+// holeBlockSize is the size of the blocks of zeros
+// which are left as holes in sparse files extracted.
+const holeBlockSize = 4096
+
+// zeroBlock is a block of zeros, to compare with.
+var zeroBlock [holeBlockSize]byte
+
+// sparseEntry is a region of a file with data,
+// beyond which the file has holes.
+type sparseEntry struct {
+	offset, length int64
+}
+
+// isSparse returns true if hdr is the header of a sparse
+// file, in any of the formats GNU tar writes them in.
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, paxSparsePrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sparseLength returns the bytes of data in data.
+func sparseLength(data []sparseEntry) int64 {
+	var n int64
+	for _, d := range data {
+		n += d.length
+	}
+	return n
+}
+
+// sparseHeader returns the headers of a sparse file in
+// the PAX format 1.0 of GNU tar, for the regular file
+// whose header is hdr and whose regions with data are
+// data, along with the sparse map which starts its
+// contents, before the data.
+func sparseHeader(hdr *tar.Header, data []sparseEntry) (headers, sparseMap []byte, err error) {
+	var end int64
+	if len(data) > 0 {
+		last := data[len(data)-1]
+		end = last.offset + last.length
+	}
+	if end < hdr.Size {
+		// GNU tar marks a hole at the end with an empty region
+		data = append(data, sparseEntry{offset: hdr.Size})
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%d\n", len(data))
+	for _, d := range data {
+		fmt.Fprintf(buf, "%d\n%d\n", d.offset, d.length)
+	}
+	if pad := buf.Len() % tarBlockSize; pad > 0 {
+		buf.Write(make([]byte, tarBlockSize-pad))
+	}
+	sparseMap = buf.Bytes()
+
+	// archive/tar can read sparse files, but leaves out the
+	// PAX records of sparse files it is given to write, so
+	// they are given to it under keys of the same length,
+	// which are then renamed in the headers it writes
+	sh := *hdr
+	sh.PAXRecords = make(map[string]string, len(hdr.PAXRecords)+4)
+	for key, value := range hdr.PAXRecords {
+		sh.PAXRecords[key] = value
+	}
+	sh.PAXRecords[paxSparsePlaceholder+"major"] = "1"
+	sh.PAXRecords[paxSparsePlaceholder+"minor"] = "0"
+	sh.PAXRecords[paxSparsePlaceholder+"name"] = hdr.Name
+	sh.PAXRecords[paxSparsePlaceholder+"realsize"] = strconv.FormatInt(hdr.Size, 10)
+	sh.Name = path.Join(path.Dir(hdr.Name), "GNUSparseFile.0", path.Base(hdr.Name))
+	sh.Size = int64(len(sparseMap)) + sparseLength(data)
+	sh.Format = tar.FormatPAX
+	buf = new(bytes.Buffer)
+	err = tar.NewWriter(buf).WriteHeader(&sh)
+	if err != nil {
+		return nil, nil, err
+	}
+	headers = bytes.Replace(buf.Bytes(), []byte(paxSparsePlaceholder), []byte(paxSparsePrefix), -1)
+	return headers, sparseMap, nil
+}
+
+// sparseFile is a file which holes can be left in,
+// by seeking past blocks of zeros instead of writing
+// them, such as an *os.File.
+type sparseFile interface {
+	io.WriteSeeker
+	Truncate(size int64) error
+}
+
+// copySparse copies in to out like io.Copy, but if out
+// is a sparseFile, blocks of zeros are skipped, leaving
+// holes in the file on file systems which support them.
+func copySparse(out io.Writer, in io.Reader) (int64, error) {
+	f, ok := out.(sparseFile)
+	if !ok {
+		return io.Copy(out, in)
+	}
+	buf := make([]byte, 16*holeBlockSize)
+	var written int64
+	for {
+		n, readErr := io.ReadFull(in, buf)
+		chunk := buf[:n]
+		for len(chunk) > 0 {
+			// the run of blocks which are all zeros or all not
+			zero := isZeroBlock(chunk)
+			end := blockEnd(chunk, 0)
+			for end < len(chunk) && isZeroBlock(chunk[end:]) == zero {
+				end = blockEnd(chunk, end)
+			}
+			var err error
+			if zero {
+				_, err = f.Seek(int64(end), io.SeekCurrent)
+			} else {
+				_, err = f.Write(chunk[:end])
+			}
+			if err != nil {
+				return written, err
+			}
+			written += int64(end)
+			chunk = chunk[end:]
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+	}
+	// the file is extended to its size, in case it ends in a hole
+	return written, f.Truncate(written)
+}
+
+// isZeroBlock returns true if the first block of b,
+// or all of b if it is shorter, is all zeros.
+func isZeroBlock(b []byte) bool {
+	b = b[:blockEnd(b, 0)]
+	return bytes.Equal(b, zeroBlock[:len(b)])
+}
+
+// blockEnd returns the end of the block of b
+// which starts at start.
+func blockEnd(b []byte, start int) int {
+	if len(b)-start < holeBlockSize {
+		return len(b)
+	}
+	return start + holeBlockSize
+}
+
+// zeroReader is an io.Reader of endless zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -0,0 +1,216 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestEmptyAndHoleFiles checks that files which are empty
+// or consist of holes keep their exact size and contents
+// when archived and extracted, and that when archived as
+// sparse files, only their data is archived.
+func TestEmptyAndHoleFiles(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	const holeSize = 1 << 20
+	source := filepath.Join(tmp, "source")
+	expected := map[string][]byte{
+		"empty":         {},
+		"holes":         make([]byte, holeSize),
+		"trailing-hole": append([]byte("data"), make([]byte, holeSize-4)...),
+		"leading-hole":  append(make([]byte, holeSize-4), []byte("data")...),
+	}
+	dataSize := make(map[string]int64) // bytes of data, if holes are found
+	for name, contents := range expected {
+		// holes are made by extending files with Truncate
+		fpath := filepath.Join(source, name)
+		err := os.MkdirAll(source, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Create(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch name {
+		case "trailing-hole":
+			_, err = f.Write([]byte("data"))
+		case "leading-hole":
+			_, err = f.WriteAt([]byte("data"), holeSize-4)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = f.Truncate(int64(len(contents)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, ok := dataRegions(f, int64(len(contents))); ok {
+			dataSize[name] = sparseLength(data)
+		}
+		f.Close()
+	}
+
+	for i, format := range []interface {
+		Archiver
+		Unarchiver
+		Walker
+	}{
+		&Tar{},
+		&TarGz{Tar: &Tar{}},
+		&Zip{},
+		&Tar{Sparse: true},
+		&TarGz{Tar: &Tar{Sparse: true}},
+	} {
+		archive := filepath.Join(tmp, fmt.Sprintf("holes%d.%s", i, format))
+		err := format.Archive([]string{source}, archive)
+		if err != nil {
+			t.Fatalf("Test %d: archiving: %v", i, err)
+		}
+
+		err = format.Walk(archive, func(f File) error {
+			if f.IsDir() {
+				return nil
+			}
+			contents, ok := expected[f.Name()]
+			if !ok {
+				return fmt.Errorf("unexpected file %s", f.Name())
+			}
+			if f.Size() != int64(len(contents)) {
+				t.Errorf("Test %d: %s: expected size %d in archive, got %d", i, f.Name(), len(contents), f.Size())
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Test %d: walking: %v", i, err)
+		}
+
+		dest := filepath.Join(tmp, fmt.Sprint("extracted", i))
+		err = format.Unarchive(archive, dest)
+		if err != nil {
+			t.Fatalf("Test %d: unarchiving: %v", i, err)
+		}
+		for name, contents := range expected {
+			got, err := ioutil.ReadFile(filepath.Join(dest, "source", name))
+			if err != nil {
+				t.Errorf("Test %d: %s: %v", i, name, err)
+				continue
+			}
+			if !bytes.Equal(got, contents) {
+				t.Errorf("Test %d: %s: expected %d bytes as archived, got %d different bytes",
+					i, name, len(contents), len(got))
+			}
+		}
+	}
+
+	// each file archived as a sparse file takes its headers
+	// (with the PAX records and the sparse map) and its data
+	if len(dataSize) != len(expected) || dataSize["holes"] != 0 {
+		t.Skip("file system does not report holes")
+	}
+	for name := range expected {
+		archive := filepath.Join(tmp, name+".tar")
+		err := (&Tar{Sparse: true}).Archive([]string{filepath.Join(source, name)}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		max := roundUpToBlock(dataSize[name]) + 6*tarBlockSize
+		if info.Size() > max {
+			t.Errorf("%s: expected archive of at most %d bytes, got %d", name, max, info.Size())
+		}
+	}
+}
+
+func TestSparseFiles(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// data between holes, and a hole at the end
+	const size = 4 << 20
+	source := filepath.Join(tmp, "disk.img")
+	f, err := os.Create(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteAt([]byte("boot"), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Truncate(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, ok := dataRegions(f, size)
+	f.Close()
+	if !ok || sparseLength(data) == size {
+		t.Skip("file system does not report holes")
+	}
+
+	archive := filepath.Join(tmp, "test.tar")
+	tr := &Tar{Sparse: true}
+	err = tr.Archive([]string{source}, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() >= size {
+		t.Errorf("expected only the data of the file to be archived, got archive of %d bytes", info.Size())
+	}
+	err = tr.Walk(archive, func(f File) error {
+		if f.Name() != "disk.img" || f.Size() != size {
+			t.Errorf("expected disk.img of %d bytes in archive, got %s of %d bytes", size, f.Name(), f.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(tmp, "out")
+	err = tr.Unarchive(archive, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var extracted string
+	for _, fpath := range tr.Result().Paths {
+		if filepath.Base(fpath) == "disk.img" {
+			extracted = fpath
+		}
+	}
+	got, err := ioutil.ReadFile(extracted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := make([]byte, size)
+	copy(expected[1<<20:], "boot")
+	if !bytes.Equal(got, expected) {
+		t.Errorf("expected %d bytes as archived, got %d different bytes", size, len(got))
+	}
+	f, err = os.Open(extracted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, _ = dataRegions(f, size)
+	if sparseLength(data) == size {
+		t.Errorf("expected holes in the file extracted, got data regions %v", data)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package archiver
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dataRegions returns the regions of f, a file of size
+// bytes, which have data, as found with SEEK_DATA and
+// SEEK_HOLE, or false if they cannot be found. Either
+// way, f is left at its start.
+func dataRegions(f *os.File, size int64) ([]sparseEntry, bool) {
+	defer f.Seek(0, io.SeekStart)
+	var data []sparseEntry
+	for offset := int64(0); offset < size; {
+		start, err := f.Seek(offset, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			break // only a hole is left
+		}
+		if err != nil {
+			return nil, false
+		}
+		end, err := f.Seek(start, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, false
+		}
+		if end > size {
+			end = size
+		}
+		if end > start {
+			data = append(data, sparseEntry{offset: start, length: end - start})
+		}
+		offset = end
+	}
+	return data, true
+}
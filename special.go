@@ -0,0 +1,92 @@
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SpecialFilePolicy is what to do with special files being
+// extracted, which are character and block devices and
+// named pipes (FIFOs); they have no contents, so writing
+// them as regular files would only make bogus empty files.
+type SpecialFilePolicy int
+
+const (
+	// SpecialFileSkip leaves special files out, with a
+	// warning.
+	SpecialFileSkip SpecialFilePolicy = iota
+
+	// SpecialFileError fails with an error which is
+	// ErrUnsupportedType.
+	SpecialFileError
+
+	// SpecialFileCreate makes the special files, if the
+	// FileSystem can: named pipes always, and devices only
+	// when running as root, since only root can make them.
+	// Files which cannot be made are left out, with a
+	// warning.
+	SpecialFileCreate
+)
+
+// WarningSpecialFile is the kind of warnings
+// for special files which are not extracted.
+const WarningSpecialFile WarningKind = "special file"
+
+// nodeMaker is a FileSystem which can make special files.
+type nodeMaker interface {
+	Mknod(name string, mode os.FileMode, major, minor int64) error
+}
+
+// errMknodUnsupported is returned by mknod on
+// systems where special files cannot be made.
+var errMknodUnsupported = fmt.Errorf("special files cannot be made on this system")
+
+// Mknod makes the special file named name, which is a
+// named pipe or device as mode says, with the major and
+// minor numbers of a device. Like Create, it replaces
+// a file which exists.
+func (OSFileSystem) Mknod(name string, mode os.FileMode, major, minor int64) error {
+	err := mknod(name, mode, major, minor)
+	if os.IsExist(err) {
+		err = os.Remove(name)
+		if err != nil {
+			return err
+		}
+		err = mknod(name, mode, major, minor)
+	}
+	return err
+}
+
+// writeSpecialFileIn makes the special file at fpath in
+// fsys as policy says, and returns a non-empty reason if
+// it is not made, to be warned about.
+func writeSpecialFileIn(fsys FileSystem, policy SpecialFilePolicy, fpath string, mode os.FileMode, major, minor int64) (string, error) {
+	switch policy {
+	case SpecialFileError:
+		return "", pathErrorf(ErrUnsupportedType, fpath, "%s: special file of mode %v", fpath, mode)
+	case SpecialFileCreate:
+	default:
+		return "special files are skipped", nil
+	}
+	maker, ok := fsys.(nodeMaker)
+	if !ok {
+		return "file system cannot make special files", nil
+	}
+	if mode&os.ModeDevice != 0 && os.Geteuid() != 0 {
+		return "making devices requires root", nil
+	}
+
+	err := fsys.MkdirAll(filepath.Dir(fpath), 0755)
+	if err != nil {
+		return "", fmt.Errorf("%s: making directory for file: %w", fpath, err)
+	}
+	err = maker.Mknod(fpath, mode, major, minor)
+	if err == errMknodUnsupported {
+		return err.Error(), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: making special file: %w", fpath, err)
+	}
+	return "", nil
+}
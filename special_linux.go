@@ -0,0 +1,39 @@
+package archiver
+
+import (
+	"os"
+	"syscall"
+)
+
+// mknod makes the special file named name with
+// the type and permissions of mode.
+func mknod(name string, mode os.FileMode, major, minor int64) error {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= syscall.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= syscall.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= syscall.S_ISVTX
+	}
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		m |= syscall.S_IFIFO
+	case mode&os.ModeCharDevice != 0:
+		m |= syscall.S_IFCHR
+	case mode&os.ModeDevice != 0:
+		m |= syscall.S_IFBLK
+	default:
+		return &os.PathError{Op: "mknod", Path: name, Err: syscall.EINVAL}
+	}
+	// the encoding of device numbers of glibc's makedev
+	dev := uint64(minor&0xff) | uint64(major&0xfff)<<8 |
+		uint64(minor&^0xff)<<12 | uint64(major&^0xfff)<<32
+	err := syscall.Mknod(name, m, int(dev))
+	if err != nil {
+		return &os.PathError{Op: "mknod", Path: name, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package archiver
+
+import "os"
+
+func mknod(name string, mode os.FileMode, major, minor int64) error { return errMknodUnsupported }
@@ -0,0 +1,82 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSpecialFilePolicy(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "fifo", Typeflag: tar.TypeFifo, Mode: 0644},
+		{Name: "null", Typeflag: tar.TypeChar, Mode: 0666, Devmajor: 1, Devminor: 3},
+		{Name: "file.txt", Typeflag: tar.TypeReg, Mode: 0644},
+	} {
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+
+	for i, tc := range []struct {
+		policy    SpecialFilePolicy
+		expectErr bool
+		makeFifo  bool
+	}{
+		{policy: SpecialFileSkip},
+		{policy: SpecialFileError, expectErr: true},
+		{policy: SpecialFileCreate, makeFifo: runtime.GOOS == "linux"},
+	} {
+		dest := filepath.Join(tmp, fmt.Sprint(i))
+		tr := &Tar{MkdirAll: true, SpecialFilePolicy: tc.policy}
+		err := tr.UnarchiveReader(bytes.NewReader(buf.Bytes()), dest)
+		if tc.expectErr {
+			if !errors.Is(err, ErrUnsupportedType) {
+				t.Errorf("Test %d: expected error for special file, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !fileExists(filepath.Join(dest, "file.txt")) {
+			t.Errorf("Test %d: expected regular file to be extracted", i)
+		}
+
+		info, err := os.Lstat(filepath.Join(dest, "fifo"))
+		if tc.makeFifo && (err != nil || info.Mode()&os.ModeNamedPipe == 0) {
+			t.Errorf("Test %d: expected named pipe to be made, got %v (%v)", i, info, err)
+		}
+		if !tc.makeFifo && err == nil {
+			t.Errorf("Test %d: expected named pipe to be skipped, got mode %v", i, info.Mode())
+		}
+
+		// only root can make the device
+		expectWarnings := 2
+		if tc.makeFifo {
+			expectWarnings = 1
+			if os.Geteuid() == 0 {
+				expectWarnings = 0
+			}
+		}
+		if len(tr.Warnings()) != expectWarnings {
+			t.Errorf("Test %d: expected %d warnings, got %v", i, expectWarnings, tr.Warnings())
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package archiver
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// SymlinkPolicy is what to do with a symbolic link being
+// extracted whose target is outside of the destination,
+// because it is absolute or because of ".." elements.
+//
+// Unless the policy is SymlinkAllow, files are also never
+// extracted through links made by the same extraction
+// which lead outside of the destination once resolved,
+// such as through a chain of links which each point
+// inside of it; so a link "a" to "/etc" can never be
+// followed by an entry "a/cron.d/x" which writes there.
+// Links made through other links are judged by where they
+// really are, not by their paths in the archive.
+type SymlinkPolicy int
+
+const (
+	// SymlinkReject fails with an error
+	// which is ErrIllegalPath.
+	SymlinkReject SymlinkPolicy = iota
+
+	// SymlinkSkip leaves the link out, with a warning.
+	SymlinkSkip
+
+	// SymlinkReroot makes the link point into the
+	// destination instead: an absolute target is taken
+	// to be relative to the destination, and ".."
+	// elements which would go above the destination are
+	// dropped, like for the root of a filesystem. The
+	// link is made relative.
+	SymlinkReroot
+
+	// SymlinkAllow makes the link as it is. Only use
+	// this for trusted archives.
+	SymlinkAllow
+)
+
+// symlinkResolver is a FileSystem which can resolve
+// symbolic links, as the disk does when files are
+// written through them.
+type symlinkResolver interface {
+	EvalSymlinks(path string) (string, error)
+}
+
+// symlinkGuard keeps the symbolic links made while
+// extracting an archive to root from leading outside
+// of it, as its policy says.
+type symlinkGuard struct {
+	policy SymlinkPolicy
+	root   string
+	links  map[string]bool // links made, by real path
+
+	realRoot string // root with links resolved
+}
+
+func newSymlinkGuard(policy SymlinkPolicy, root string) *symlinkGuard {
+	return &symlinkGuard{policy: policy, root: filepath.Clean(root), links: make(map[string]bool)}
+}
+
+// target returns the target for the symbolic link at to
+// in fsys, whose target in the archive is target, or ""
+// if the link is to be skipped.
+func (g *symlinkGuard) target(fsys FileSystem, to, target string) (string, error) {
+	if g.policy == SymlinkAllow || g.inside(fsys, to, target) {
+		return target, nil
+	}
+	switch g.policy {
+	case SymlinkSkip:
+		return "", nil
+	case SymlinkReroot:
+		return g.reroot(to, target)
+	default:
+		return "", pathErrorf(ErrIllegalPath, to, "%s: symbolic link to %s is outside of destination", to, target)
+	}
+}
+
+// inside returns true if the target of the symbolic
+// link at to in fsys is inside of the root, not counting
+// links which the target itself goes through. The folder
+// of the link is judged where it really is, in case it
+// is reached through other links.
+func (g *symlinkGuard) inside(fsys FileSystem, to, target string) bool {
+	target = filepath.FromSlash(target)
+	if filepath.IsAbs(target) || filepath.VolumeName(target) != "" || path.IsAbs(filepath.ToSlash(target)) {
+		return false
+	}
+	dir, root := filepath.Dir(to), g.root
+	if resolver, ok := fsys.(symlinkResolver); ok {
+		realDir, err := resolveExistingPath(resolver, dir)
+		if err != nil {
+			return false
+		}
+		realRoot, err := g.resolveRoot(resolver)
+		if err != nil {
+			return false
+		}
+		dir, root = realDir, realRoot
+	}
+	return within(root, filepath.Join(dir, target))
+}
+
+// reroot returns target changed to be inside of the root,
+// relative to the folder of the symbolic link at to.
+func (g *symlinkGuard) reroot(to, target string) (string, error) {
+	target = filepath.FromSlash(target)
+	target = filepath.ToSlash(target[len(filepath.VolumeName(target)):])
+	if !path.IsAbs(target) {
+		dir, err := filepath.Rel(g.root, filepath.Dir(to))
+		if err != nil {
+			return "", err
+		}
+		target = path.Join(filepath.ToSlash(dir), target)
+	}
+	inRoot := filepath.Join(g.root, filepath.FromSlash(cleanEntryPath(target)))
+	return filepath.Rel(filepath.Dir(to), inRoot)
+}
+
+// made records that a symbolic link was made at to in fsys.
+func (g *symlinkGuard) made(fsys FileSystem, to string) {
+	g.links[g.location(fsys, to)] = true
+}
+
+// location returns the real path of the file at to in
+// fsys: that of its folder with links resolved, joined
+// with its name, so that a link is known by where it
+// is, whichever links it was reached through.
+func (g *symlinkGuard) location(fsys FileSystem, to string) string {
+	to = filepath.Clean(to)
+	resolver, ok := fsys.(symlinkResolver)
+	if !ok {
+		return to
+	}
+	dir, err := resolveExistingPath(resolver, filepath.Dir(to))
+	if err != nil {
+		return to
+	}
+	return filepath.Join(dir, filepath.Base(to))
+}
+
+// resolveRoot returns the root with links resolved.
+func (g *symlinkGuard) resolveRoot(resolver symlinkResolver) (string, error) {
+	if g.realRoot == "" {
+		realRoot, err := resolveExistingPath(resolver, g.root)
+		if err != nil {
+			return "", err
+		}
+		g.realRoot = realRoot
+	}
+	return g.realRoot, nil
+}
+
+// check returns an error which is ErrIllegalPath if
+// writing the file at to in fsys would go through a link
+// made by the extraction which leads outside of the root.
+// Only FileSystems which can resolve links, like the disk,
+// follow them when writing.
+func (g *symlinkGuard) check(fsys FileSystem, to string) error {
+	if g.policy == SymlinkAllow || len(g.links) == 0 {
+		return nil
+	}
+	resolver, ok := fsys.(symlinkResolver)
+	if !ok {
+		return nil
+	}
+	for p := filepath.Clean(to); p != g.root && within(g.root, p); p = filepath.Dir(p) {
+		if !g.links[g.location(fsys, p)] {
+			continue
+		}
+		realRoot, err := g.resolveRoot(resolver)
+		if err != nil {
+			return err
+		}
+		// a link which cannot be resolved may lead to a
+		// file outside of the root which does not exist yet
+		real, err := resolver.EvalSymlinks(p)
+		if err != nil || !within(realRoot, real) {
+			return pathErrorf(ErrIllegalPath, to, "%s: would be written through symbolic link %s which leads outside of destination", to, p)
+		}
+	}
+	return nil
+}
+
+// resolveExistingPath returns p with links resolved by resolver,
+// as far as it exists; the rest of it is joined as it is.
+func resolveExistingPath(resolver symlinkResolver, p string) (string, error) {
+	var rest string
+	for {
+		real, err := resolver.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		parent := filepath.Dir(p)
+		if !os.IsNotExist(err) || parent == p {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = parent
+	}
+}
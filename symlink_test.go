@@ -0,0 +1,141 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSymlinkPolicy(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for i, tc := range []struct {
+		policy   SymlinkPolicy
+		link     string // in the archive
+		target   string
+		expected string // target of the link made, if any
+		illegal  bool
+	}{
+		{policy: SymlinkReject, link: "a/inside", target: "../b", expected: "../b"},
+		{policy: SymlinkReject, link: "a/abs", target: "/etc", illegal: true},
+		{policy: SymlinkReject, link: "a/up", target: "../../x", illegal: true},
+		{policy: SymlinkSkip, link: "a/abs", target: "/etc"},
+		{policy: SymlinkReroot, link: "a/abs", target: "/etc/passwd", expected: filepath.Join("..", "etc", "passwd")},
+		{policy: SymlinkReroot, link: "a/up", target: "../../../x", expected: filepath.Join("..", "x")},
+		{policy: SymlinkAllow, link: "a/abs", target: "/etc", expected: "/etc"},
+	} {
+		buf := new(bytes.Buffer)
+		tw := tar.NewWriter(buf)
+		err := tw.WriteHeader(&tar.Header{Name: tc.link, Linkname: tc.target, Typeflag: tar.TypeSymlink, Mode: 0777})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw.Close()
+
+		dest := filepath.Join(tmp, fmt.Sprint(i))
+		tr := &Tar{MkdirAll: true, SymlinkPolicy: tc.policy}
+		err = tr.UnarchiveReader(buf, dest)
+		if tc.illegal {
+			if !errors.Is(err, ErrIllegalPath) {
+				t.Errorf("Test %d: expected error for link outside of destination, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(dest, filepath.FromSlash(tc.link)))
+		if tc.expected == "" {
+			if err == nil {
+				t.Errorf("Test %d: expected link to be skipped, got link to %s", i, target)
+			}
+			if len(tr.Warnings()) != 1 {
+				t.Errorf("Test %d: expected a warning, got %v", i, tr.Warnings())
+			}
+			continue
+		}
+		if target != tc.expected {
+			t.Errorf("Test %d: expected link to %s, got %s (%v)", i, tc.expected, target, err)
+		}
+	}
+}
+
+func TestSymlinkWriteThrough(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// each link points inside of the destination when
+	// it is made, but together they lead outside of it
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "self", Linkname: ".", Typeflag: tar.TypeSymlink, Mode: 0777},
+		{Name: "parent", Linkname: "self/..", Typeflag: tar.TypeSymlink, Mode: 0777},
+		{Name: "parent/escaped.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 2},
+	} {
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(make([]byte, hdr.Size))
+	}
+	tw.Close()
+
+	dest := filepath.Join(tmp, "dest")
+	err = (&Tar{MkdirAll: true}).UnarchiveReader(buf, dest)
+	if !errors.Is(err, ErrIllegalPath) {
+		t.Errorf("expected error for file written through links, got %v", err)
+	}
+	if fileExists(filepath.Join(tmp, "escaped.txt")) {
+		t.Error("expected file not to be written outside of destination")
+	}
+}
+
+func TestSymlinkThroughLink(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// the second link is inside of the destination by its
+	// path in the archive, but is made through the first,
+	// where its target is outside
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "a/b/c/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "a/b/c/l", Linkname: "../../..", Typeflag: tar.TypeSymlink, Mode: 0777},
+		{Name: "a/b/c/l/x", Linkname: "../..", Typeflag: tar.TypeSymlink, Mode: 0777},
+		{Name: "x/pwned.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 2},
+	} {
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(make([]byte, hdr.Size))
+	}
+	tw.Close()
+
+	dest := filepath.Join(tmp, "1", "2", "dest")
+	err = (&Tar{MkdirAll: true}).UnarchiveReader(buf, dest)
+	if !errors.Is(err, ErrIllegalPath) {
+		t.Errorf("expected error for link made through a link, got %v", err)
+	}
+	if fileExists(filepath.Join(tmp, "1", "pwned.txt")) {
+		t.Error("expected file not to be written outside of destination")
+	}
+}
@@ -1,7 +1,6 @@
 package archiver
 
 import (
-	"fmt"
 	"io"
 	"path/filepath"
 
@@ -29,7 +28,7 @@ func (s *Snappy) Decompress(in io.Reader, out io.Writer) error {
 // CheckExt ensures the file extension matches the format.
 func (s *Snappy) CheckExt(filename string) error {
 	if filepath.Ext(filename) != ".sz" {
-		return fmt.Errorf("filename must have a .sz extension")
+		return pathErrorf(ErrFormatMismatch, filename, "filename must have a .sz extension")
 	}
 	return nil
 }
@@ -3,23 +3,176 @@ package archiver
 import (
 	"archive/tar"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
+	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Tar provides facilities for operating TAR archives.
+// Methods which do a whole operation, such as Archive,
+// Unarchive, Walk and Extract, work with their own copy
+// of the Tar, so they can be called concurrently; but
+// Create, Open, Read, Write and Close use the state of
+// the Tar itself, so a Tar can only read or write one
+// archive that way at a time.
 // See http://www.gnu.org/software/tar/manual/html_node/Standard.html.
 type Tar struct {
 	// Whether to overwrite existing files; if false,
 	// an error is returned if the file exists.
 	OverwriteExisting bool
 
+	// What to do when a file being extracted already
+	// exists; with the zero value, OverwriteError,
+	// OverwriteExisting decides.
+	OverwritePolicy OverwritePolicy
+
+	// Whether to extract entries whose paths go outside
+	// of the destination, such as "../../etc/cron.d/x";
+	// if false, an error which is ErrIllegalPath is
+	// returned for them. Only set this for trusted
+	// archives.
+	AllowPathTraversal bool
+
+	// What to do with entries whose paths are absolute,
+	// such as "/etc/passwd"; the zero value,
+	// AbsolutePathStrip, extracts them inside of the
+	// destination with a warning.
+	AbsolutePathPolicy AbsolutePathPolicy
+
+	// How the names of entries are sanitized when they
+	// are extracted by Unarchive, such as to remove
+	// control characters; names are not changed by
+	// default.
+	SanitizeNames NameSanitization
+
+	// What to do with symbolic links being extracted
+	// which point outside of the destination; the zero
+	// value, SymlinkReject, returns an error for them.
+	SymlinkPolicy SymlinkPolicy
+
+	// The most bytes of contents of any one file to
+	// extract; 0 means no limit. Since contents are
+	// counted as they are decompressed, files which
+	// decompress to much more than they say cannot fill
+	// the disk; extracting them fails with an error which
+	// is ErrLimitExceeded instead.
+	MaxEntrySize int64
+
+	// The most bytes of contents of all files to extract
+	// in one operation, counted like for MaxEntrySize;
+	// 0 means no limit.
+	MaxTotalSize int64
+
+	// If true, Unarchive checks that there is space for
+	// the files it extracts on the filesystem of the
+	// destination (as long as its FileSystem can tell how
+	// much there is), before the disk fills up; if there
+	// is not, it fails with an error which is
+	// ErrInsufficientSpace. Since the sizes of the files
+	// in a tarball are only known as it is read, each file
+	// is checked before it is extracted, and contents are
+	// counted as they are extracted, like for MaxTotalSize.
+	CheckDiskSpace bool
+
+	// The most elements of the path of a file to extract,
+	// such as 3 for "a/b/c.txt"; 0 means no limit. Files
+	// with deeper paths are not extracted, and an error
+	// which is ErrLimitExceeded is returned for them.
+	MaxPathDepth int
+
+	// The most bytes of the path of a file to extract,
+	// like PATH_MAX, checked like MaxPathDepth; 0 means
+	// no limit.
+	MaxPathLength int
+
+	// The most bytes of each element of the path of a file
+	// to extract, like NAME_MAX, checked like MaxPathDepth;
+	// 0 means no limit.
+	MaxNameLength int
+
+	// Whether to keep the setuid, setgid and sticky bits
+	// of the modes of files extracted; by default they are
+	// cleared, so that archives from untrusted sources
+	// cannot make setuid programs. The same goes for the
+	// file capabilities restored with Xattrs.
+	KeepSetuid bool
+
+	// If true, the extended attributes of files, such as
+	// user.* attributes and SELinux labels, are archived
+	// as PAX records (SCHILY.xattr, as GNU tar writes
+	// them) on Linux and macOS, and restored when they
+	// are extracted. Attributes which cannot be archived
+	// or restored, such as those in the security namespace
+	// when not running as root, are left out with a
+	// warning. File capabilities (security.capability)
+	// and trusted.* attributes are only restored if
+	// KeepSetuid is true, since like the setuid bit they
+	// grant privileges.
+	Xattrs bool
+
+	// If true, files with holes, such as disk images, are
+	// archived as sparse files in the PAX format of GNU
+	// tar, like with tar --sparse, so that only the data
+	// in them is archived; holes are found with SEEK_HOLE
+	// on Linux, macOS and FreeBSD. Sparse files are written whole if
+	// Format is USTAR or GNU, which archive/tar cannot
+	// write them in. Sparse files extracted, whether or not
+	// this is set, have holes for their blocks of zeros.
+	Sparse bool
+
+	// If true, the files extracted have the times at which
+	// they are extracted, like with tar -m; by default,
+	// their modification times (and access times, for
+	// tarballs which have them) are restored from their
+	// headers, those of directories once the files in
+	// them are extracted. The times of symbolic links are
+	// not restored.
+	DiscardTimes bool
+
+	// If true, the ownership of the files extracted is
+	// restored from their headers, as tar does when run
+	// as root. Files whose owner cannot be changed (which
+	// usually requires root) are left owned by the user
+	// extracting them, with a warning.
+	PreserveOwnership bool
+
+	// If true, PreserveOwnership gives the files extracted
+	// the owners by the IDs in their headers, like tar
+	// --numeric-owner; by default, the users and groups
+	// named in the headers are looked up on the host, as
+	// tar does, and the IDs are only used for those which
+	// are not found.
+	NumericOwner bool
+
+	// If set, the ownership of the files extracted is
+	// restored as with PreserveOwnership, with the user and
+	// group IDs mapped by these maps, such as to extract
+	// the root filesystem of a container into a user
+	// namespace whose IDs are shifted; a nil map leaves
+	// its IDs as they are. Files whose IDs are not mapped
+	// are left owned by the user extracting them, with a
+	// warning.
+	UserMap  IDMap
+	GroupMap IDMap
+
+	// If set, the files extracted are all given this owner
+	// (which usually requires root), whatever the owners
+	// in their headers; UserMap and GroupMap are not used.
+	Chown *Owner
+
+	// What to do with character and block devices and
+	// named pipes being extracted; the zero value,
+	// SpecialFileSkip, leaves them out with a warning.
+	SpecialFilePolicy SpecialFilePolicy
+
 	// Whether to make all the directories necessary
 	// to create a tar archive in the desired path.
 	MkdirAll bool
@@ -45,12 +198,209 @@ type Tar struct {
 	// the operation will continue on remaining files.
 	ContinueOnError bool
 
-	tw *tar.Writer
-	tr *tar.Reader
+	// If set, errors skipped because of ContinueOnError
+	// are logged to this logger instead of the logger of
+	// the error log policy, and warnings about metadata
+	// which is not preserved are logged to it as well.
+	Logger Logger
+
+	// Files which do not exist on disk, to be added
+	// by Archive after the files listed in sources.
+	VirtualEntries []VirtualEntry
+
+	// If true, reading continues past the end-of-archive
+	// marker (the blocks of zeros at the end of a tarball)
+	// with the next archive, if any. This allows reading
+	// concatenated tarballs, such as those made with
+	// `cat a.tar b.tar` or `tar -A`, like the --ignore-zeros
+	// option of GNU tar.
+	IgnoreZeros bool
+
+	// If greater than zero, tarballs which are written are
+	// padded with zeros after the end-of-archive marker to a
+	// multiple of this many bytes, which must be a multiple
+	// of 512: for example, 10240 for the record size of GNU
+	// tar, or 4096 to align tarballs which are embedded in
+	// other files. It is the tar stream which is padded,
+	// before any compression.
+	PadTo int
+
+	// If true, the end-of-archive marker (two blocks of
+	// zeros) is not written when a tarball is closed, so that
+	// tarballs can be concatenated and read as one without
+	// IgnoreZeros, or appended to later. It cannot be used
+	// with PadTo, whose zeros would be read as the marker.
+	OmitTrailer bool
+
+	// The format of the headers to write, for example
+	// tar.FormatUSTAR for compatibility with old tar
+	// implementations. If not set, the format is chosen
+	// for each header as needed to represent it: names
+	// and link targets too long for a USTAR header are
+	// written as GNU LongName and LongLink entries, unless
+	// the header needs PAX records anyway. Set it to
+	// tar.FormatPAX to write long names as PAX records
+	// instead. Writing a file fails if its header cannot
+	// be represented in the chosen format (such as a long
+	// name in USTAR).
+	Format tar.Format
+
+	// If greater than zero, archives are read ahead
+	// asynchronously using buffers of this many bytes,
+	// so that reading the source, decompressing it
+	// and parsing the tar stream can overlap instead
+	// of happening strictly in turn.
+	ReadAheadSize int
+
+	// If true, information which is lost because it cannot
+	// be represented, such as symbolic links when extracting
+	// on Windows without the privilege to create them, is an
+	// error rather than a warning. See Warnings.
+	StrictMetadata bool
+
+	// The filesystem to which Unarchive extracts files;
+	// if nil, files are extracted to the disk.
+	FileSystem FileSystem
+
+	// The clock which tells the current time, such as
+	// for virtual entries with no modification time;
+	// if nil, the system clock is used.
+	Clock Clock
+
+	// If set, decides what to do when a file fails to be
+	// extracted by Unarchive, instead of ContinueOnError.
+	OnError ErrorHandler
+
+	// If set, is called to report the progress of
+	// archiving and extracting files.
+	Progress ProgressFunc
+
+	// If set, is called with the header of each entry
+	// before it is written, so it can be changed, such as
+	// to set the owner, the mode or PAX records. The path
+	// of the file on disk is given, if the entry is from
+	// disk; it is empty otherwise, such as for virtual
+	// entries. The size and type of files with contents
+	// must not be changed.
+	ModifyHeader func(hdr *tar.Header, srcPath string) error
+
+	// If true, files with more than one hard link are
+	// archived as many times as they are linked, instead
+	// of as hard links to the first of them which is
+	// archived. Hard links are only found on systems
+	// whose file info identifies files, such as Unix.
+	DereferenceHardLinks bool
+
+	// If true, symbolic links are followed when archiving:
+	// files they link to are archived in their place, as
+	// regular files, and so are folders they link to, with
+	// their contents, so the archive has no links (which
+	// cannot always be extracted on Windows). Links which
+	// are broken are archived as links; links in loops
+	// are an error.
+	FollowSymlinks bool
+
+	// Patterns of the paths of files to leave out when
+	// archiving, and of entries not to extract, like the
+	// patterns of .gitignore files, such as "*.o", ".git/"
+	// or "src/**/testdata". Paths are matched as they are
+	// named in archives; see also Filter.
+	ExcludePatterns []string
+
+	// If set, such as to ".gitignore", files in the folders
+	// being archived are left out if they match the patterns
+	// of the files of this name in their folders, or in the
+	// folders they are in, as git ignores them; patterns in
+	// ignore files above the folders being archived are
+	// not used.
+	IgnoreFileName string
+
+	// If set, decides which files are archived by Archive,
+	// ArchiveWriter and Append: files for which it returns
+	// false are left out, and so are the contents of
+	// folders for which it returns false.
+	Filter func(path string, info os.FileInfo) bool
+
+	// If set, changes the names of files in the archives
+	// made by Archive, ArchiveWriter and Append.
+	NameInArchive NameMapper
+
+	// If set, a manifest of the digests of the contents
+	// of the files archived is made with this algorithm,
+	// which Manifest returns.
+	ManifestAlgorithm HashAlgorithm
+
+	// If set along with ManifestAlgorithm, the manifest
+	// is added to the archive as its last entry, with
+	// this name (such as "SHA256SUMS").
+	ManifestName string
+
+	// If set, tarballs are signed with this key as they are
+	// written, and Signature returns the signature after
+	// Close; Archive, Append, Update and Remove write it
+	// next to the tarball, in a file named like it with
+	// ".minisig" appended.
+	SigningKey *SigningKey
+
+	// If set, such as to "SHA256SUMS", Unarchive verifies
+	// the files it extracts against the manifest entry of
+	// this name in the archive, such as made with
+	// ManifestName, whose digests are of ManifestAlgorithm
+	// (SHA256 if it is not set). Files whose contents do
+	// not match their digests, or which are not listed,
+	// are mismatches; once all the files are extracted,
+	// Unarchive fails with an error which is
+	// ErrManifestMismatch if there are any, or if there
+	// is no manifest.
+	VerifyManifest string
+
+	// If true, the mismatches found with VerifyManifest
+	// are reported as warnings instead of failing Unarchive.
+	ReportManifestMismatches bool
+
+	tarState
+
+	origin *Tar            // see session
+	ctx    context.Context // see withContext
 
 	readerWrapFn  func(io.Reader) (io.Reader, error)
 	writerWrapFn  func(io.Writer) (io.Writer, error)
 	cleanupWrapFn func()
+	closeWrapFn   func() error // like cleanupWrapFn, for writers whose errors matter
+}
+
+// tarState is the state of a Tar while it reads or
+// writes an archive, and the results of doing so.
+type tarState struct {
+	tw    *tar.Writer
+	twOut *countingWriter // tar stream under tw, for PadTo
+	tr    tarReader
+	trIn  io.Reader // tarball stream under tr, for Validate
+
+	readAheads []*readAheadReader
+	warnings   []Warning
+
+	result    OperationResult
+	progress  progressTracker
+	timer     operationTimer
+	manifest  manifestTracker
+	signature signatureTracker
+	verifier  *manifestVerifier // of the files extracted, see VerifyManifest
+	countIn   *countingReader   // archive read by Open
+	countOut  *countingWriter   // archive written by Create
+
+	retryOverwrite string            // see retryFile
+	exclude        excludePatterns   // see untarAll
+	symlinks       *symlinkGuard     // links made while extracting
+	root           string            // destination being extracted to
+	extractedTo    map[string]string // paths files were extracted to, by clean name, for hard links
+	dirTimes       dirTimes          // of the directories extracted, see DiscardTimes
+	owners         ownerNames        // of the files archived and extracted
+	extracted      int64             // bytes of contents extracted, for MaxTotalSize
+	space          int64             // bytes available at the destination, for CheckDiskSpace
+	spaceKnown     bool              // whether space is known
+	hardLinks      map[fileID]string // names of files archived, by identity
+	writingPath    string            // file on disk being written, for ModifyHeader
 }
 
 // Archive creates a tarball file at destination containing
@@ -58,11 +408,14 @@ type Tar struct {
 // ".tar". File paths can be those of regular files or
 // directories; directories will be recursively added.
 func (t *Tar) Archive(sources []string, destination string) error {
+	t = t.session()
+	defer t.endSession()
+
 	if t.writerWrapFn == nil && !strings.HasSuffix(destination, ".tar") {
-		return fmt.Errorf("output filename must have .tar extension")
+		return pathErrorf(ErrFormatMismatch, destination, "output filename must have .tar extension")
 	}
 	if !t.OverwriteExisting && fileExists(destination) {
-		return fmt.Errorf("file already exists: %s", destination)
+		return &PathError{Path: destination, Err: ErrDestinationExists}
 	}
 
 	// make the folder to contain the resulting archive
@@ -71,44 +424,386 @@ func (t *Tar) Archive(sources []string, destination string) error {
 	if t.MkdirAll && !fileExists(destDir) {
 		err := mkdir(destDir)
 		if err != nil {
-			return fmt.Errorf("making folder for destination: %v", err)
+			return fmt.Errorf("making folder for destination: %w", err)
 		}
 	}
 
 	out, err := os.Create(destination)
 	if err != nil {
-		return fmt.Errorf("creating %s: %v", destination, err)
+		return fmt.Errorf("creating %s: %w", destination, err)
 	}
 	defer out.Close()
 
-	err = t.Create(out)
-	if err != nil {
-		return fmt.Errorf("creating tar: %v", err)
-	}
-	defer t.Close()
-
 	var topLevelFolder string
 	if t.ImplicitTopLevelFolder && multipleTopLevels(sources) {
 		topLevelFolder = folderNameFromFileName(destination)
 	}
 
+	err = t.archiveTo(out, sources, topLevelFolder, destination)
+	if err != nil {
+		return err
+	}
+	return t.signature.writeFile(destination)
+}
+
+// ArchiveWriter writes an archive containing the files
+// listed in sources to w, which can be a stream such as
+// the body of an HTTP response. File paths can be those
+// of regular files or directories; directories will be
+// recursively added. Since there is no archive file to
+// name it after, a top-level folder cannot be made for
+// the files: ImplicitTopLevelFolder must not be set.
+func (t *Tar) ArchiveWriter(sources []string, w io.Writer) error {
+	t = t.session()
+	defer t.endSession()
+
+	if t.ImplicitTopLevelFolder {
+		return fmt.Errorf("implicit top-level folder is not supported when archiving to a stream")
+	}
+	return t.archiveTo(w, sources, "", "")
+}
+
+// archiveTo writes an archive containing the files listed in
+// sources to out, under topLevelFolder if it is set. The
+// archive file at destination, if any, is not archived.
+func (t *Tar) archiveTo(out io.Writer, sources []string, topLevelFolder, destination string) error {
+	err := t.Create(out)
+	if err != nil {
+		return fmt.Errorf("creating tar: %w", err)
+	}
+	if t.Progress != nil {
+		t.progress.entriesTotal = countSourceEntries(sources) + len(t.VirtualEntries)
+	}
+
+	err = t.writeSources(sources, topLevelFolder, destination)
+	closeErr := t.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return fmt.Errorf("closing tar: %w", closeErr)
+	}
+	return nil
+}
+
+// Append adds the files listed in sources to the existing
+// tarball at archive, as tar -r does: the new entries are
+// written over the end-of-archive marker, after the entries
+// already in the tarball, which are not rewritten. File
+// paths can be those of regular files or directories;
+// directories will be recursively added. The tarball
+// must not be compressed, since compressed tarballs
+// cannot be added to in place.
+func (t *Tar) Append(archive string, sources []string) error {
+	t = t.session()
+	defer t.endSession()
+
+	if t.writerWrapFn != nil {
+		return fmt.Errorf("cannot append to compressed tar archive")
+	}
+
+	file, err := os.OpenFile(archive, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer file.Close()
+
+	// anything after the last entry, such as the
+	// end-of-archive marker, is written over
+	end, err := tarEnd(file)
+	if err != nil {
+		return fmt.Errorf("finding end of archive: %w", err)
+	}
+	err = file.Truncate(end)
+	if err != nil {
+		return fmt.Errorf("truncating archive: %w", err)
+	}
+	_, err = file.Seek(end, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("seeking to end of archive: %w", err)
+	}
+
+	err = t.Create(file)
+	if err != nil {
+		return fmt.Errorf("creating tar: %w", err)
+	}
+	t.twOut.n = end // so that PadTo pads the whole tarball
+	// and so that the whole tarball is signed
+	err = t.signature.prefix(io.NewSectionReader(file, 0, end))
+	if err != nil {
+		t.Close()
+		return fmt.Errorf("reading archive to sign: %w", err)
+	}
+	for _, source := range sources {
+		if err = contextErr(t.ctx); err != nil {
+			break
+		}
+		err = t.writeWalk(source, "", archive)
+		if err != nil {
+			err = fmt.Errorf("walking %s: %w", source, err)
+			break
+		}
+	}
+	closeErr := t.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return fmt.Errorf("closing tar: %w", closeErr)
+	}
+	return t.signature.writeFile(archive)
+}
+
+// Update rewrites the tarball at archive with the entries
+// named by the keys of replacements replaced by the files
+// at the paths they map to on disk, which are added if
+// there are no such entries. The other entries are copied
+// byte for byte. A replaced entry is written where it was
+// (where it first was, if it was in the tarball more than
+// once); added entries are written at the end, in order of
+// their names. The tarball is written to a temporary file
+// next to it, which then replaces it.
+func (t *Tar) Update(archive string, replacements map[string]string) error {
+	return t.update(archive, newArchiveEdits(replacements, nil), nil, nil)
+}
+
+// Remove rewrites the tarball at archive without the entries
+// named in names, and the entries under those which are
+// directories. The other entries are copied byte for byte.
+// If any of the names are not in the tarball, it is not
+// changed, and an error is returned. The tarball is written
+// to a temporary file next to it, which then replaces it.
+func (t *Tar) Remove(archive string, names []string) error {
+	return t.update(archive, newArchiveEdits(nil, names), nil, nil)
+}
+
+// update rewrites the tarball at archive with edits, which
+// implements Update and Remove. The wrapReader and wrapWriter
+// functions, if set, wrap the readers and writers of t; they
+// are called by update, since the wrapped reader has to be
+// made before the writer is wrapped, as they share a cleanup
+// function.
+func (t *Tar) update(archive string, edits *archiveEdits, wrapReader, wrapWriter func(*Tar) *Tar) error {
+	t = t.session()
+	defer t.endSession()
+
+	err := updateFile(archive, func(out *os.File) error {
+		file, err := os.Open(archive)
+		if err != nil {
+			return fmt.Errorf("opening archive: %w", err)
+		}
+		defer file.Close()
+
+		t.readerWrapFn, t.writerWrapFn, t.cleanupWrapFn, t.closeWrapFn = nil, nil, nil, nil
+		var in io.Reader = file
+		if wrapReader != nil {
+			wrapReader(t)
+			in, err = t.readerWrapFn(in)
+			if err != nil {
+				return fmt.Errorf("wrapping file reader: %w", err)
+			}
+			if cleanup := t.cleanupWrapFn; cleanup != nil {
+				t.cleanupWrapFn = nil
+				defer cleanup()
+			}
+		}
+		if wrapWriter != nil {
+			wrapWriter(t)
+		}
+
+		err = t.Create(out)
+		if err != nil {
+			return fmt.Errorf("creating tar: %w", err)
+		}
+		err = t.copyEdited(in, edits)
+		closeErr := t.Close()
+		if err != nil {
+			return err
+		}
+		if closeErr != nil {
+			return fmt.Errorf("closing tar: %w", closeErr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return t.signature.writeFile(archive)
+}
+
+// copyEdited writes the entries of the tarball read
+// from in to t, which must have been opened for writing
+// first, with edits made to them.
+func (t *Tar) copyEdited(in io.Reader, edits *archiveEdits) error {
+	rec := &tarRecorder{r: in}
+	tr := tar.NewReader(rec)
+	for {
+		if err := contextErr(t.ctx); err != nil {
+			return err
+		}
+		rec.start()
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar archive: %w", err)
+		}
+
+		fpath, write, skip := edits.edit(hdr.Name)
+		if !skip {
+			err := rec.copyEntry(t.twOut, tr)
+			if err != nil {
+				return fmt.Errorf("copying %s: %w", hdr.Name, err)
+			}
+			continue
+		}
+
+		rec.w = ioutil.Discard
+		_, err = io.Copy(ioutil.Discard, tr)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		if write {
+			err = t.writeReplacement(cleanEntryPath(hdr.Name), fpath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range edits.additions() {
+		err := t.writeReplacement(name, edits.replacements[name])
+		if err != nil {
+			return err
+		}
+	}
+	return edits.check()
+}
+
+// writeReplacement writes the file at fpath to t as the entry
+// named name, padding it so that entries can be copied after it.
+func (t *Tar) writeReplacement(name, fpath string) error {
+	err := writeReplacement(t, name, fpath)
+	if err != nil {
+		return err
+	}
+	return t.tw.Flush()
+}
+
+// tarRecorder records the bytes of a tarball read
+// through it, so that its entries can be copied
+// without being written again.
+type tarRecorder struct {
+	r io.Reader
+	n int64 // bytes read
+
+	// the bytes read since start, unless w is set,
+	// in which case bytes read are written to w
+	buf     bytes.Buffer
+	w       io.Writer
+	started int64 // n at start
+}
+
+func (rec *tarRecorder) Read(p []byte) (int, error) {
+	n, err := rec.r.Read(p)
+	rec.n += int64(n)
+	if rec.w == nil {
+		rec.buf.Write(p[:n])
+	} else if _, werr := rec.w.Write(p[:n]); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+// start starts recording the next entry.
+func (rec *tarRecorder) start() {
+	rec.buf.Reset()
+	rec.w = nil
+	rec.started = rec.n
+}
+
+// copyEntry writes the entry being read by tr, whose
+// headers were recorded since start, to w as it is.
+func (rec *tarRecorder) copyEntry(w io.Writer, tr *tar.Reader) error {
+	// the padding of the previous entry
+	// was read before the headers
+	pad := roundUpToBlock(rec.started) - rec.started
+	_, err := w.Write(rec.buf.Bytes()[pad:])
+	if err != nil {
+		return err
+	}
+	rec.w = w
+	start := rec.n
+	_, err = io.Copy(ioutil.Discard, tr)
+	if err != nil {
+		return err
+	}
+	size := rec.n - start
+	_, err = w.Write(make([]byte, roundUpToBlock(size)-size))
+	return err
+}
+
+// roundUpToBlock rounds n up to a
+// whole number of tar blocks.
+func roundUpToBlock(n int64) int64 {
+	return (n + tarBlockSize - 1) / tarBlockSize * tarBlockSize
+}
+
+// tarEnd returns the offset of the end of the
+// last entry in the tarball read from r, which
+// is where the end-of-archive marker starts.
+func tarEnd(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+	var end int64
+	for {
+		_, err := tr.Next()
+		if err == io.EOF {
+			return end, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		// the reader does not read past the entry,
+		// except to pad it to a whole block
+		_, err = io.Copy(ioutil.Discard, tr)
+		if err != nil {
+			return 0, err
+		}
+		end = roundUpToBlock(cr.n)
+	}
+}
+
+// writeSources writes the files listed in sources, and
+// the virtual entries, to t, which must have been
+// opened for writing first.
+func (t *Tar) writeSources(sources []string, topLevelFolder, destination string) error {
 	for _, source := range sources {
+		if err := contextErr(t.ctx); err != nil {
+			return err
+		}
 		err := t.writeWalk(source, topLevelFolder, destination)
 		if err != nil {
-			return fmt.Errorf("walking %s: %v", source, err)
+			return fmt.Errorf("walking %s: %w", source, err)
 		}
 	}
 
-	return nil
+	return writeVirtualEntries(t, t.VirtualEntries, clockOrSystem(t.Clock), true, t.ContinueOnError, t.Logger)
 }
 
 // Unarchive unpacks the .tar file at source to destination.
 // Destination will be treated as a folder name.
 func (t *Tar) Unarchive(source, destination string) error {
-	if !fileExists(destination) && t.MkdirAll {
-		err := mkdir(destination)
+	t = t.session()
+	defer t.endSession()
+
+	fsys := fileSystemOrOS(t.FileSystem)
+	if !fileExistsIn(fsys, destination) && t.MkdirAll {
+		err := mkdirIn(fsys, destination)
 		if err != nil {
-			return fmt.Errorf("preparing destination: %v", err)
+			return fmt.Errorf("preparing destination: %w", err)
 		}
 	}
 
@@ -119,37 +814,99 @@ func (t *Tar) Unarchive(source, destination string) error {
 		var err error
 		destination, err = t.addTopLevelFolder(source, destination)
 		if err != nil {
-			return fmt.Errorf("scanning source archive: %v", err)
+			return fmt.Errorf("scanning source archive: %w", err)
 		}
 	}
 
 	file, err := os.Open(source)
 	if err != nil {
-		return fmt.Errorf("opening source archive: %v", err)
+		return fmt.Errorf("opening source archive: %w", err)
 	}
 	defer file.Close()
 
-	err = t.Open(file, 0)
+	return t.untarFrom(file, destination)
+}
+
+// UnarchiveReader unpacks the tarball read from in to
+// destination, in a single pass, so in can be a stream.
+// Destination will be treated as a folder name. Since
+// the archive cannot be scanned first, a top-level
+// folder cannot be made for it: ImplicitTopLevelFolder
+// must not be set.
+func (t *Tar) UnarchiveReader(in io.Reader, destination string) error {
+	t = t.session()
+	defer t.endSession()
+
+	if t.ImplicitTopLevelFolder {
+		return fmt.Errorf("implicit top-level folder is not supported when extracting from a stream")
+	}
+	fsys := fileSystemOrOS(t.FileSystem)
+	if !fileExistsIn(fsys, destination) && t.MkdirAll {
+		err := mkdirIn(fsys, destination)
+		if err != nil {
+			return fmt.Errorf("preparing destination: %w", err)
+		}
+	}
+	return t.untarFrom(in, destination)
+}
+
+// untarFrom opens t for reading the tarball read
+// from in, and extracts all of it to destination.
+func (t *Tar) untarFrom(in io.Reader, destination string) error {
+	err := t.Open(in, 0)
 	if err != nil {
-		return fmt.Errorf("opening tar archive for reading: %v", err)
+		return fmt.Errorf("opening tar archive for reading: %w", err)
 	}
 	defer t.Close()
 
+	return t.untarAll(destination)
+}
+
+// untarAll extracts all remaining files from t,
+// which must already be opened for reading, to
+// the destination folder to.
+func (t *Tar) untarAll(to string) error {
+	var err error
+	t.exclude, err = newExcludePatterns(t.ExcludePatterns)
+	if err != nil {
+		return err
+	}
+	defer func() { t.exclude = nil }()
+	t.symlinks = newSymlinkGuard(t.SymlinkPolicy, to)
+	defer func() { t.symlinks = nil }()
+	t.root = filepath.Clean(to)
+	t.verifier, err = newManifestVerifier(t.VerifyManifest, t.ManifestAlgorithm, t.ReportManifestMismatches)
+	if err != nil {
+		return err
+	}
+	defer func() { t.verifier = nil }()
+	if t.CheckDiskSpace {
+		t.space, t.spaceKnown = spaceAvailableIn(fileSystemOrOS(t.FileSystem), to)
+	}
+
 	for {
-		err := t.untarNext(destination)
+		if err := contextErr(t.ctx); err != nil {
+			return err
+		}
+		err := t.untarNext(to)
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			if t.ContinueOnError {
-				log.Printf("[ERROR] Reading file in tar archive: %v", err)
+			if t.ContinueOnError && t.OnError == nil {
+				logError(t.Logger, "Reading file in tar archive: %v", err)
+				t.result.Failed++
 				continue
 			}
-			return fmt.Errorf("reading file in tar archive: %v", err)
+			return fmt.Errorf("reading file in tar archive: %w", err)
 		}
 	}
 
-	return nil
+	err = t.dirTimes.restore(fileSystemOrOS(t.FileSystem), t.Logger, &t.warnings, t.StrictMetadata)
+	if err != nil {
+		return err
+	}
+	return t.verifier.verify(t.Logger, &t.warnings)
 }
 
 // addTopLevelFolder scans the files contained inside
@@ -159,7 +916,7 @@ func (t *Tar) Unarchive(source, destination string) error {
 func (t *Tar) addTopLevelFolder(sourceArchive, destination string) (string, error) {
 	file, err := os.Open(sourceArchive)
 	if err != nil {
-		return "", fmt.Errorf("opening source archive: %v", err)
+		return "", fmt.Errorf("opening source archive: %w", err)
 	}
 	defer file.Close()
 
@@ -169,14 +926,14 @@ func (t *Tar) addTopLevelFolder(sourceArchive, destination string) (string, erro
 	if t.readerWrapFn != nil {
 		reader, err = t.readerWrapFn(reader)
 		if err != nil {
-			return "", fmt.Errorf("wrapping reader: %v", err)
+			return "", fmt.Errorf("wrapping reader: %w", err)
 		}
 	}
 	if t.cleanupWrapFn != nil {
 		defer t.cleanupWrapFn()
 	}
 
-	tr := tar.NewReader(reader)
+	tr := t.newTarReader(reader)
 
 	var files []string
 	for {
@@ -185,7 +942,7 @@ func (t *Tar) addTopLevelFolder(sourceArchive, destination string) (string, erro
 			break
 		}
 		if err != nil {
-			return "", fmt.Errorf("scanning tarball's file listing: %v", err)
+			return "", fmt.Errorf("scanning tarball's file listing: %w", err)
 		}
 		files = append(files, hdr.Name)
 	}
@@ -202,65 +959,377 @@ func (t *Tar) untarNext(to string) error {
 	if err != nil {
 		return err // don't wrap error; calling loop must break on io.EOF
 	}
+	defer f.Close()
 	header, ok := f.Header.(*tar.Header)
 	if !ok {
 		return fmt.Errorf("expected header to be *tar.Header but was %T", f.Header)
 	}
-	return t.untarFile(f, filepath.Join(to, header.Name))
+	if t.exclude.match(header.Name, f.IsDir()) {
+		return nil
+	}
+	t.progress.start(header.Name, header.Size)
+	defer t.progress.finish()
+	f.ReadCloser = ReadFakeCloser{t.progress.reader(f.ReadCloser)}
+	name, err := sanitizeName(t.SanitizeNames, header.Name, t.Logger, &t.warnings)
+	if err != nil {
+		return &EntryError{Name: header.Name, Err: err}
+	}
+	to, err = extractPath(to, name, t.AllowPathTraversal, t.AbsolutePathPolicy, t.Logger)
+	if err != nil {
+		return &EntryError{Name: header.Name, Err: err}
+	}
+	if t.OnError == nil {
+		err = t.untarFile(f, to)
+		if err != nil {
+			return &EntryError{Name: header.Name, Err: err}
+		}
+		return nil
+	}
+
+	// the contents can only be read once, so
+	// trying again is only possible if they
+	// were not read
+	tracker := &readTracker{r: f.ReadCloser}
+	f.ReadCloser = ReadFakeCloser{tracker}
+	err = t.untarFile(f, to)
+	if err == nil {
+		return nil
+	}
+	skipped, err := retryFile(t.OnError, header.Name, err, func(overwrite string) error {
+		if tracker.read {
+			return errCannotReread
+		}
+		t.retryOverwrite = overwrite
+		defer func() { t.retryOverwrite = "" }()
+		return t.untarFile(f, to)
+	})
+	if skipped {
+		t.result.Failed++
+	}
+	if err != nil {
+		return &EntryError{Name: header.Name, Err: err}
+	}
+	return nil
 }
 
-func (t *Tar) untarFile(f File, to string) error {
+func (t *Tar) untarFile(f File, to string) (err error) {
+	fsys := fileSystemOrOS(t.FileSystem)
+	skipped := false
+	defer func() {
+		if err != nil {
+			return
+		}
+		if skipped {
+			t.result.Skipped++
+			return
+		}
+		err = t.restoreOwner(fsys, f, to)
+		if err != nil {
+			return
+		}
+		err = t.restoreXattrs(fsys, f, to)
+		if err != nil {
+			return
+		}
+		err = t.restoreTimes(fsys, f, to)
+		if err != nil {
+			return
+		}
+		if t.extractedTo == nil {
+			t.extractedTo = make(map[string]string)
+		}
+		t.extractedTo[cleanEntryPath(entryPath(f))] = to
+		t.result.addEntry(f)
+		t.result.addPath(entryPath(f), to)
+		if f.Mode().IsRegular() {
+			t.result.BytesOut += f.Size()
+		}
+	}()
+
+	err = t.limits().checkPath(entryPath(f))
+	if err != nil {
+		return err
+	}
+
 	// do not overwrite existing files, if configured
-	if !f.IsDir() && !t.OverwriteExisting && fileExists(to) {
-		return fmt.Errorf("file already exists: %s", to)
+	if !f.IsDir() && to != t.retryOverwrite {
+		policy := overwritePolicy(t.OverwritePolicy, t.OverwriteExisting)
+		to, err = resolveExisting(fsys, policy, f, to, func(name string) bool {
+			return fileExistsIn(fsys, name)
+		})
+		if err != nil {
+			return err
+		}
+		if to == "" {
+			skipped = true
+			return nil
+		}
 	}
 
 	hdr, ok := f.Header.(*tar.Header)
 	if !ok {
 		return fmt.Errorf("expected header to be *tar.Header but was %T", f.Header)
 	}
+	err = t.symlinks.check(fsys, to)
+	if err != nil {
+		return err
+	}
 
 	switch hdr.Typeflag {
 	case tar.TypeDir:
-		return mkdir(to)
-	case tar.TypeReg, tar.TypeRegA, tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
-		return writeNewFile(to, f, f.Mode())
+		return mkdirIn(fsys, to)
+	case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+		limits := t.limits()
+		err := limits.check(hdr.Name, hdr.Size)
+		if err != nil {
+			return err
+		}
+		r, done := t.verifier.track(hdr.Name, limits.reader(hdr.Name, f))
+		write := writeNewFileIn
+		if isSparse(hdr) {
+			write = writeNewSparseFileIn
+		}
+		err = write(fsys, to, r, extractMode(f.Mode(), t.KeepSetuid))
+		if err == nil {
+			done()
+		}
+		return err
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		mode := extractMode(f.Mode(), t.KeepSetuid)
+		reason, err := writeSpecialFileIn(fsys, t.SpecialFilePolicy, to, mode, hdr.Devmajor, hdr.Devminor)
+		if err != nil || reason == "" {
+			return err
+		}
+		skipped = true
+		return addWarning(t.Logger, &t.warnings, t.StrictMetadata, Warning{
+			Path:   hdr.Name,
+			Kind:   WarningSpecialFile,
+			Detail: reason,
+		})
 	case tar.TypeSymlink:
-		return writeNewSymbolicLink(to, hdr.Linkname)
+		target, err := t.symlinks.target(fsys, to, hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		if target == "" {
+			skipped = true
+			return addWarning(t.Logger, &t.warnings, t.StrictMetadata, Warning{
+				Path:   hdr.Name,
+				Kind:   WarningSymlink,
+				Detail: fmt.Sprintf("target %s is outside of destination", hdr.Linkname),
+			})
+		}
+		err = writeNewSymbolicLinkIn(fsys, to, target)
+		if err == errSymlinkNotPermitted {
+			skipped = true
+			return addWarning(t.Logger, &t.warnings, t.StrictMetadata, Warning{
+				Path:   hdr.Name,
+				Kind:   WarningSymlink,
+				Detail: err.Error(),
+			})
+		}
+		if err == nil {
+			t.symlinks.made(fsys, to)
+		}
+		return err
 	case tar.TypeLink:
-		return writeNewHardLink(to, filepath.Join(to, hdr.Linkname))
+		target, err := t.hardLinkTarget(fsys, hdr)
+		if err != nil {
+			return err
+		}
+		return writeNewHardLinkIn(fsys, to, target)
 	case tar.TypeXGlobalHeader:
+		skipped = true
 		return nil // ignore the pax global header from git-generated tarballs
 	default:
-		return fmt.Errorf("%s: unknown type flag: %c", hdr.Name, hdr.Typeflag)
+		return pathErrorf(ErrUnsupportedType, hdr.Name, "%s: unknown type flag: %c", hdr.Name, hdr.Typeflag)
+	}
+}
+
+// recordOwner records the owner of f in hdr: from th, the
+// header f has, if it has an owner, or else from the file
+// on disk, along with the names of its user and group if
+// they are found. Files on systems without owners, like
+// Windows, are recorded as owned by root.
+func (t *Tar) recordOwner(hdr *tar.Header, f File, th *tar.Header) {
+	if th != nil && (th.Uid != 0 || th.Gid != 0 || th.Uname != "" || th.Gname != "") {
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = th.Uid, th.Gid, th.Uname, th.Gname
+		return
+	}
+	uid, gid, ok := fileOwner(f.Sys())
+	if !ok {
+		return
+	}
+	hdr.Uid, hdr.Gid = uid, gid
+	if hdr.Uname == "" {
+		hdr.Uname = t.owners.userName(uid)
+	}
+	if hdr.Gname == "" {
+		hdr.Gname = t.owners.groupName(gid)
+	}
+}
+
+// restoreOwner restores the ownership of the file at to,
+// extracted from f, as PreserveOwnership, UserMap, GroupMap
+// and Chown say.
+func (t *Tar) restoreOwner(fsys FileSystem, f File, to string) error {
+	hdr, ok := f.Header.(*tar.Header)
+	if !ok || hdr.Typeflag == tar.TypeLink {
+		return nil
+	}
+	var reason string
+	switch {
+	case t.Chown != nil:
+		reason = restoreOwnerIn(fsys, to, t.Chown.UID, t.Chown.GID, nil, nil)
+	case t.UserMap != nil || t.GroupMap != nil:
+		reason = restoreOwnerIn(fsys, to, hdr.Uid, hdr.Gid, t.UserMap, t.GroupMap)
+	case t.PreserveOwnership:
+		uid, gid := hdr.Uid, hdr.Gid
+		if !t.NumericOwner {
+			if id, ok := t.owners.userID(hdr.Uname); ok {
+				uid = id
+			}
+			if id, ok := t.owners.groupID(hdr.Gname); ok {
+				gid = id
+			}
+		}
+		reason = restoreOwnerIn(fsys, to, uid, gid, nil, nil)
+	default:
+		return nil
+	}
+	if reason == "" {
+		// changing the owner clears the setuid and setgid
+		// bits, so they are set again, as GNU tar does
+		mode := extractMode(f.Mode(), t.KeepSetuid)
+		if hdr.Typeflag == tar.TypeSymlink || mode&(os.ModeSetuid|os.ModeSetgid) == 0 {
+			return nil
+		}
+		return fsys.Chmod(to, mode)
+	}
+	return addWarning(t.Logger, &t.warnings, t.StrictMetadata, Warning{
+		Path:   hdr.Name,
+		Kind:   WarningOwnership,
+		Detail: reason,
+	})
+}
+
+// restoreXattrs restores the extended attributes of
+// the file at to, extracted from f, if Xattrs is set.
+func (t *Tar) restoreXattrs(fsys FileSystem, f File, to string) error {
+	hdr, ok := f.Header.(*tar.Header)
+	if !t.Xattrs || !ok || hdr.Typeflag == tar.TypeLink {
+		return nil
+	}
+	reason := restoreXattrsIn(fsys, to, hdr, t.KeepSetuid)
+	if reason == "" {
+		return nil
+	}
+	return addWarning(t.Logger, &t.warnings, t.StrictMetadata, Warning{
+		Path:   hdr.Name,
+		Kind:   WarningXattrs,
+		Detail: reason,
+	})
+}
+
+// restoreTimes restores the times of the file at to,
+// extracted from f, as DiscardTimes says; the times of
+// directories are restored once their files are.
+func (t *Tar) restoreTimes(fsys FileSystem, f File, to string) error {
+	if t.DiscardTimes {
+		return nil
+	}
+	switch entryType(f) {
+	case EntrySymlink, EntryHardLink:
+		// os.Chtimes would change the times of their targets
+		return nil
+	case EntryDir:
+		t.dirTimes = append(t.dirTimes, timesOf(f, to))
+		return nil
+	}
+	return restoreTimesIn(fsys, timesOf(f, to), t.Logger, &t.warnings, t.StrictMetadata)
+}
+
+// limits returns the limits on the files
+// being extracted.
+func (t *Tar) limits() extractLimits {
+	return extractLimits{
+		maxEntry:      t.MaxEntrySize,
+		maxTotal:      t.MaxTotalSize,
+		total:         &t.extracted,
+		checkSpace:    t.CheckDiskSpace && t.spaceKnown,
+		space:         t.space,
+		maxPathDepth:  t.MaxPathDepth,
+		maxPathLength: t.MaxPathLength,
+		maxNameLength: t.MaxNameLength,
+	}
+}
+
+// hardLinkTarget returns the path of the file in fsys
+// which the hard link hdr links to. Hard links are named
+// from the root of the archive, not from the entries they
+// are in, so a link to a file which was extracted links to
+// wherever it was extracted to (such as with its name
+// sanitized); otherwise, the target is resolved against
+// the destination, and an error which is ErrIllegalPath
+// is returned if it is outside of the destination.
+func (t *Tar) hardLinkTarget(fsys FileSystem, hdr *tar.Header) (string, error) {
+	target, ok := t.extractedTo[cleanEntryPath(hdr.Linkname)]
+	if !ok {
+		name, err := sanitizeName(t.SanitizeNames, hdr.Linkname, nil, nil)
+		if err != nil {
+			return "", err
+		}
+		target, err = extractPath(t.root, name, false, t.AbsolutePathPolicy, nil)
+		if err != nil || target == t.root {
+			return "", pathErrorf(ErrIllegalPath, hdr.Name, "%s: hard link to %s is outside of destination", hdr.Name, hdr.Linkname)
+		}
+	}
+	// the target must not be reached through
+	// a symbolic link which leads outside
+	err := t.symlinks.check(fsys, target)
+	if err != nil {
+		return "", err
 	}
+	return target, nil
 }
 
 func (t *Tar) writeWalk(source, topLevelFolder, destination string) error {
 	sourceAbs, err := filepath.Abs(source)
 	if err != nil {
-		return fmt.Errorf("getting absolute path: %v", err)
+		return fmt.Errorf("getting absolute path: %w", err)
 	}
 	sourceInfo, err := os.Stat(sourceAbs)
 	if err != nil {
-		return fmt.Errorf("%s: stat: %v", source, err)
+		return fmt.Errorf("%s: stat: %w", source, err)
 	}
-	destAbs, err := filepath.Abs(destination)
-	if err != nil {
-		return fmt.Errorf("%s: getting absolute path of destination %s: %v", source, destination, err)
+	var destAbs string
+	if destination != "" {
+		destAbs, err = filepath.Abs(destination)
+		if err != nil {
+			return fmt.Errorf("%s: getting absolute path of destination %s: %w", source, destination, err)
+		}
 	}
 	baseDir := makeBaseDir(topLevelFolder, sourceInfo)
+	exclude, err := newExcludePatterns(t.ExcludePatterns)
+	if err != nil {
+		return err
+	}
+	ignores := newIgnoreFiles(t.IgnoreFileName)
 
-	return filepath.Walk(source, func(fpath string, info os.FileInfo, err error) error {
+	return walkFiles(source, t.FollowSymlinks, func(fpath string, info os.FileInfo, err error) error {
 		handleErr := func(err error) error {
 			if t.ContinueOnError {
-				log.Printf("[ERROR] Walking %s: %v", fpath, err)
+				logError(t.Logger, "Walking %s: %v", fpath, err)
+				t.result.Failed++
 				return nil
 			}
 			return err
 		}
+		if ctxErr := contextErr(t.ctx); ctxErr != nil {
+			return ctxErr
+		}
 		if err != nil {
-			return handleErr(fmt.Errorf("traversing %s: %v", fpath, err))
+			return handleErr(fmt.Errorf("traversing %s: %w", fpath, err))
 		}
 		if info == nil {
 			return handleErr(fmt.Errorf("no file info"))
@@ -269,37 +1338,202 @@ func (t *Tar) writeWalk(source, topLevelFolder, destination string) error {
 		// make sure we do not copy our output file into itself
 		fpathAbs, err := filepath.Abs(fpath)
 		if err != nil {
-			return handleErr(fmt.Errorf("%s: getting absolute path: %v", fpath, err))
+			return handleErr(fmt.Errorf("%s: getting absolute path: %w", fpath, err))
 		}
-		if within(fpathAbs, destAbs) {
+		if destAbs != "" && within(fpathAbs, destAbs) {
 			return nil
 		}
+		if t.Filter != nil && !t.Filter(fpath, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ignores != nil {
+			if ignores.match(fpath, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				err := ignores.load(fpath)
+				if err != nil {
+					return handleErr(err)
+				}
+			}
+		}
 
 		// build the name to be used within the archive
 		nameInArchive, err := makeNameInArchive(sourceInfo, source, baseDir, fpath)
 		if err != nil {
 			return handleErr(err)
 		}
+		if exclude.match(nameInArchive, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		nameInArchive, err = t.NameInArchive.mapName(fpath, nameInArchive)
+		if err != nil {
+			return handleErr(err)
+		}
+		if nameInArchive == "" {
+			return nil
+		}
 
-		file, err := os.Open(fpath)
+		f := File{
+			FileInfo: FileInfo{
+				FileInfo:   info,
+				CustomName: nameInArchive,
+			},
+		}
+		id, linked := fileIdentity(info.Sys())
+		linked = linked && info.Mode().IsRegular() && !t.DereferenceHardLinks
+		if info.Mode()&os.ModeSymlink != 0 {
+			// symbolic links have no contents, only a target
+			target, err := os.Readlink(fpath)
+			if err != nil {
+				return handleErr(fmt.Errorf("%s: reading symbolic link: %w", fpath, err))
+			}
+			f.Header = &tar.Header{Linkname: target}
+			f.ReadCloser = ReadFakeCloser{eofReader{}}
+		} else if first, ok := t.hardLinks[id]; linked && ok {
+			// the contents of files with more than one
+			// hard link are only archived once
+			f.Header = &tar.Header{Typeflag: tar.TypeLink, Linkname: first}
+			f.ReadCloser = ReadFakeCloser{eofReader{}}
+			linked = false
+		} else {
+			file, err := os.Open(fpath)
+			if err != nil {
+				return handleErr(fmt.Errorf("%s: opening: %w", fpath, err))
+			}
+			defer file.Close()
+			f.ReadCloser = file
+		}
+
+		t.writingPath = fpath
+		err = t.Write(f)
+		t.writingPath = ""
 		if err != nil {
-			return handleErr(fmt.Errorf("%s: opening: %v", fpath, err))
+			return handleErr(fmt.Errorf("%s: writing: %w", fpath, err))
 		}
-		defer file.Close()
+		t.result.addPath(nameInArchive, fpath)
+		if linked {
+			t.hardLinks[id] = nameInArchive
+		}
+
+		return nil
+	})
+}
+
+// fileID identifies a file on disk which has more
+// than one hard link, so that it can be archived once.
+type fileID struct {
+	dev, ino uint64
+}
+
+// WalkBatches calls fn with batches of batchSize items
+// visited in archive. Since a tarball can only be read
+// in order, the contents of the files in each batch are
+// read ahead of time: they are kept in memory, or spooled
+// to temporary files if they are large.
+func (t *Tar) WalkBatches(archive string, batchSize int, fn WalkBatchFunc) error {
+	t = t.session()
+	defer t.endSession()
+
+	if batchSize < 1 {
+		return fmt.Errorf("invalid batch size: %d", batchSize)
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("opening archive file: %w", err)
+	}
+	defer file.Close()
+
+	err = t.Open(file, 0)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer t.Close()
+
+	batch := make([]File, 0, batchSize)
+	flush := func() error {
+		err := walkBatch(batch, fn)
+		batch = make([]File, 0, batchSize)
+		if err != nil {
+			if err == ErrStopWalk {
+				return err
+			}
+			if t.ContinueOnError {
+				logError(t.Logger, "Walking batch: %v", err)
+				return nil
+			}
+			return fmt.Errorf("walking batch: %w", err)
+		}
+		return nil
+	}
+
+	for {
+		if err := contextErr(t.ctx); err != nil {
+			for _, f := range batch {
+				f.Close()
+			}
+			return err
+		}
+		hdr, err := t.tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if t.ContinueOnError {
+				logError(t.Logger, "Opening next file: %v", err)
+				continue
+			}
+			for _, f := range batch {
+				f.Close()
+			}
+			return fmt.Errorf("opening next file: %w", err)
+		}
+
+		contents := io.ReadCloser(ReadFakeCloser{eofReader{}})
+		if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA || hdr.Typeflag == tar.TypeGNUSparse {
+			contents, _, err = spool(t.tr)
+			if err != nil {
+				for _, f := range batch {
+					f.Close()
+				}
+				return entryErrorf(hdr.Name, "reading contents: %w", err)
+			}
+		}
+		batch = append(batch, File{
+			FileInfo:   hdr.FileInfo(),
+			Header:     hdr,
+			ReadCloser: contents,
+		})
+
+		if len(batch) == batchSize {
+			err := flush()
+			if err == ErrStopWalk {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
 
-		err = t.Write(File{
-			FileInfo: FileInfo{
-				FileInfo:   info,
-				CustomName: nameInArchive,
-			},
-			ReadCloser: file,
-		})
-		if err != nil {
-			return handleErr(fmt.Errorf("%s: writing: %s", fpath, err))
+	if len(batch) > 0 {
+		err := flush()
+		if err != nil && err != ErrStopWalk {
+			return err
 		}
+	}
 
-		return nil
-	})
+	return nil
 }
 
 // Create opens t for writing a tar archive to out.
@@ -307,18 +1541,35 @@ func (t *Tar) Create(out io.Writer) error {
 	if t.tw != nil {
 		return fmt.Errorf("tar archive is already created for writing")
 	}
+	if t.PadTo < 0 || t.PadTo%tarBlockSize != 0 {
+		return fmt.Errorf("padding must be a multiple of %d bytes, got %d", tarBlockSize, t.PadTo)
+	}
+	if t.PadTo > 0 && t.OmitTrailer {
+		return fmt.Errorf("padding cannot be used without end-of-archive marker")
+	}
+	err := t.manifest.reset(t.ManifestAlgorithm)
+	if err != nil {
+		return fmt.Errorf("making manifest: %w", err)
+	}
+	t.warnings = nil
+	t.result = OperationResult{}
+	t.timer.start(t.Clock)
+	t.progress.reset(t.Progress)
+	t.countOut = &countingWriter{w: t.signature.reset(t.SigningKey, out)}
+	t.hardLinks = make(map[fileID]string)
+	out = newContextWriter(t.ctx, t.countOut)
 
 	// wrapping writers allows us to output
 	// compressed tarballs, for example
 	if t.writerWrapFn != nil {
-		var err error
 		out, err = t.writerWrapFn(out)
 		if err != nil {
-			return fmt.Errorf("wrapping writer: %v", err)
+			return fmt.Errorf("wrapping writer: %w", err)
 		}
 	}
 
-	t.tw = tar.NewWriter(out)
+	t.twOut = &countingWriter{w: out}
+	t.tw = tar.NewWriter(t.twOut)
 	return nil
 }
 
@@ -334,50 +1585,241 @@ func (t *Tar) Write(f File) error {
 		return fmt.Errorf("missing file name")
 	}
 	if f.ReadCloser == nil {
-		return fmt.Errorf("%s: no way to read file contents", f.Name())
+		return entryErrorf(f.Name(), "no way to read file contents")
+	}
+	var link string
+	th, _ := f.Header.(*tar.Header)
+	if th != nil {
+		link = th.Linkname
 	}
-	hdr, err := tar.FileInfoHeader(f, f.Name())
+	hdr, err := tar.FileInfoHeader(f, link)
 	if err != nil {
-		return fmt.Errorf("%s: making header: %v", f.Name(), err)
+		return entryErrorf(f.Name(), "making header: %w", err)
+	}
+	if th != nil && th.Typeflag == tar.TypeLink {
+		// hard links have no contents, only
+		// the name of the file they link to
+		hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, th.Linkname, 0
+	}
+	t.recordOwner(hdr, f, th)
+	if t.Xattrs && t.writingPath != "" {
+		reason := addXattrs(hdr, t.writingPath, t.Format)
+		if reason != "" {
+			err := addWarning(t.Logger, &t.warnings, t.StrictMetadata, Warning{
+				Path:   hdr.Name,
+				Kind:   WarningXattrs,
+				Detail: reason,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if t.ModifyHeader != nil {
+		err := t.ModifyHeader(hdr, t.writingPath)
+		if err != nil {
+			return entryErrorf(hdr.Name, "modifying header: %w", err)
+		}
+	}
+	switch t.Format {
+	case tar.FormatUnknown:
+		if needsGNULongNames(hdr) {
+			hdr.Format = tar.FormatGNU
+		}
+	case tar.FormatUSTAR:
+		// USTAR has no fields for these times
+		hdr.Format = t.Format
+		hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+	default:
+		hdr.Format = t.Format
 	}
 
-	err = t.tw.WriteHeader(hdr)
-	if err != nil {
-		return fmt.Errorf("%s: writing header: %v", hdr.Name, err)
+	var sparse bool
+	var data []sparseEntry
+	file, ok := f.ReadCloser.(*os.File)
+	if t.Sparse && ok && hdr.Typeflag == tar.TypeReg && (t.Format == tar.FormatUnknown || t.Format == tar.FormatPAX) {
+		data, ok = dataRegions(file, hdr.Size)
+		sparse = ok && sparseLength(data) < hdr.Size
+	}
+	if !sparse {
+		err = t.tw.WriteHeader(hdr)
+		if err != nil {
+			return entryErrorf(hdr.Name, "writing header: %w", err)
+		}
 	}
 
+	t.result.addEntry(File{FileInfo: f.FileInfo, Header: hdr})
+	t.progress.start(hdr.Name, hdr.Size)
+	defer t.progress.finish()
+
 	if f.IsDir() {
 		return nil
 	}
 
+	if sparse {
+		return t.writeSparse(hdr, file, data)
+	}
 	if hdr.Typeflag == tar.TypeReg {
-		_, err := io.Copy(t.tw, f)
+		contents := t.progress.reader(newContextReader(t.ctx, f))
+		h := t.manifest.hash()
+		if h != nil {
+			contents = io.TeeReader(contents, h)
+		}
+		n, err := io.Copy(t.tw, contents)
+		t.result.BytesIn += n
+		if err != nil {
+			return entryErrorf(f.Name(), "copying contents: %w", err)
+		}
+		t.manifest.add(hdr.Name, h)
+	}
+
+	return nil
+}
+
+// writeSparse writes file, a sparse file whose header is
+// hdr and whose regions with data are data: its headers
+// and sparse map, then its data. Its manifest hash is of
+// all its contents, with the holes read as zeros.
+func (t *Tar) writeSparse(hdr *tar.Header, file *os.File, data []sparseEntry) error {
+	headers, sparseMap, err := sparseHeader(hdr, data)
+	if err != nil {
+		return entryErrorf(hdr.Name, "writing header: %w", err)
+	}
+	// tw cannot write sparse files, so they are written to
+	// the tar stream under it, after the entry before
+	err = t.tw.Flush()
+	if err != nil {
+		return entryErrorf(hdr.Name, "writing header: %w", err)
+	}
+	_, err = t.twOut.Write(append(headers, sparseMap...))
+	if err != nil {
+		return entryErrorf(hdr.Name, "writing header: %w", err)
+	}
+
+	sections := make([]io.Reader, len(data))
+	for i, d := range data {
+		sections[i] = io.NewSectionReader(file, d.offset, d.length)
+	}
+	contents := t.progress.reader(newContextReader(t.ctx, io.MultiReader(sections...)))
+	h := t.manifest.hash()
+	var offset int64
+	for _, d := range data {
+		r := contents
+		if h != nil {
+			io.CopyN(h, zeroReader{}, d.offset-offset)
+			r = io.TeeReader(contents, h)
+		}
+		n, err := io.CopyN(t.twOut, r, d.length)
+		t.result.BytesIn += n
 		if err != nil {
-			return fmt.Errorf("%s: copying contents: %v", f.Name(), err)
+			return entryErrorf(hdr.Name, "copying contents: %w", err)
 		}
+		offset = d.offset + d.length
 	}
+	if h != nil {
+		io.CopyN(h, zeroReader{}, hdr.Size-offset)
+	}
+	t.manifest.add(hdr.Name, h)
 
+	size := sparseLength(data)
+	_, err = t.twOut.Write(make([]byte, roundUpToBlock(size)-size))
+	if err != nil {
+		return entryErrorf(hdr.Name, "padding contents: %w", err)
+	}
 	return nil
 }
 
+// needsGNULongNames returns true if the name or link
+// target of hdr is too long for a USTAR header, and
+// nothing else about hdr needs a PAX header, so that
+// the long names can be written as GNU LongName and
+// LongLink entries.
+func needsGNULongNames(hdr *tar.Header) bool {
+	if fitsUSTARName(hdr.Name) && len(hdr.Linkname) <= tarNameSize {
+		return false
+	}
+	return len(hdr.PAXRecords) == 0 && len(hdr.Xattrs) == 0 &&
+		len(hdr.Uname) <= tarUserNameSize && len(hdr.Gname) <= tarUserNameSize
+}
+
+// fitsUSTARName returns true if name fits in the name
+// field of a USTAR header, either whole or split at a
+// slash between the prefix and name fields, the same
+// way archive/tar splits it.
+func fitsUSTARName(name string) bool {
+	if len(name) <= tarNameSize {
+		return true
+	}
+	for _, r := range name {
+		if r >= 0x80 {
+			return false // archive/tar only splits ASCII names
+		}
+	}
+	n := len(name)
+	if n > tarPrefixSize+1 {
+		n = tarPrefixSize + 1
+	} else if name[n-1] == '/' {
+		n--
+	}
+	i := strings.LastIndex(name[:n], "/")
+	suffix := len(name) - i - 1
+	return i > 0 && suffix > 0 && suffix <= tarNameSize
+}
+
+// Sizes of fields in USTAR headers.
+const (
+	tarNameSize     = 100
+	tarPrefixSize   = 155
+	tarUserNameSize = 32
+)
+
 // Open opens t for reading an archive from
 // in. The size parameter is not used.
 func (t *Tar) Open(in io.Reader, size int64) error {
 	if t.tr != nil {
 		return fmt.Errorf("tar archive is already open for reading")
 	}
+	t.warnings = nil
+	t.result = OperationResult{}
+	t.timer.start(t.Clock)
+	t.progress.reset(t.Progress)
+	t.countIn = &countingReader{r: in}
+	in = t.readAhead(newContextReader(t.ctx, t.countIn))
 	// wrapping readers allows us to open compressed tarballs
 	if t.readerWrapFn != nil {
 		var err error
 		in, err = t.readerWrapFn(in)
 		if err != nil {
-			return fmt.Errorf("wrapping file reader: %v", err)
+			return fmt.Errorf("wrapping file reader: %w", err)
 		}
+		in = t.readAhead(in)
 	}
-	t.tr = tar.NewReader(in)
+	t.trIn = in
+	t.tr = t.newTarReader(in)
 	return nil
 }
 
+// newTarReader returns a reader of the
+// tarball (or tarballs) read from in.
+func (t *Tar) newTarReader(in io.Reader) tarReader {
+	in = legacyTarReader(in)
+	if t.IgnoreZeros {
+		return &concatTarReader{Reader: tar.NewReader(in), src: in}
+	}
+	return tar.NewReader(in)
+}
+
+// readAhead returns in wrapped with an asynchronous
+// read-ahead stage if t is configured for it.
+func (t *Tar) readAhead(in io.Reader) io.Reader {
+	if t.ReadAheadSize <= 0 {
+		return in
+	}
+	ra := newReadAheadReader(in, t.ReadAheadSize)
+	t.readAheads = append(t.readAheads, ra)
+	return ra
+}
+
 // Read reads the next file from t, which must have
 // already been opened for reading. If there are no
 // more files, the error is io.EOF. The File must
@@ -395,7 +1837,7 @@ func (t *Tar) Read() (File, error) {
 	file := File{
 		FileInfo:   hdr.FileInfo(),
 		Header:     hdr,
-		ReadCloser: ReadFakeCloser{t.tr},
+		ReadCloser: trackBody(hdr.Name, ReadFakeCloser{t.tr}),
 	}
 
 	return file, nil
@@ -406,67 +1848,402 @@ func (t *Tar) Close() error {
 	var err error
 	if t.tr != nil {
 		t.tr = nil
+		t.trIn = nil
+	}
+	// stop reading ahead, from the outermost stage in,
+	// before the streams being read are cleaned up
+	for i := len(t.readAheads) - 1; i >= 0; i-- {
+		t.readAheads[i].Close()
 	}
+	t.readAheads = nil
 	if t.tw != nil {
+		err = t.manifest.embed(t, t.ManifestName, clockOrSystem(t.Clock))
 		tw := t.tw
 		t.tw = nil
-		err = tw.Close()
+		if finishErr := t.finish(tw); err == nil {
+			err = finishErr
+		}
 	}
 	// make sure cleanup of "Reader/Writer wrapper"
 	// (say that ten times fast) happens AFTER the
 	// underlying stream is closed
+	if t.closeWrapFn != nil {
+		if closeErr := t.closeWrapFn(); err == nil {
+			err = closeErr
+		}
+	}
 	if t.cleanupWrapFn != nil {
 		t.cleanupWrapFn()
 	}
+	if err == nil {
+		t.signature.sign(clockOrSystem(t.Clock).Now())
+	}
+	t.finishResult()
 	return err
 }
 
+// finishResult completes the result of the
+// operation which is being closed.
+func (t *Tar) finishResult() {
+	if t.countIn != nil {
+		t.result.BytesIn = t.countIn.n
+		t.countIn = nil
+	}
+	if t.countOut != nil {
+		t.result.BytesOut = t.countOut.n
+		t.countOut = nil
+	}
+	if d := t.timer.stop(); d > 0 {
+		t.result.Duration = d
+	}
+}
+
+// finish finishes writing the tarball written by tw,
+// ending it as configured by OmitTrailer and PadTo.
+func (t *Tar) finish(tw *tar.Writer) error {
+	if t.OmitTrailer {
+		// flushing pads the last file to a whole
+		// block without writing the marker
+		return tw.Flush()
+	}
+	err := tw.Close()
+	if err != nil || t.PadTo == 0 {
+		return err
+	}
+	if rem := t.twOut.n % int64(t.PadTo); rem > 0 {
+		_, err = t.twOut.Write(make([]byte, int64(t.PadTo)-rem))
+		if err != nil {
+			return fmt.Errorf("padding tar archive: %w", err)
+		}
+	}
+	return nil
+}
+
+// Clone returns a copy of the settings of t, which can
+// be changed without changing t, such as to configure
+// DefaultTar differently for some operations.
+func (t *Tar) Clone() *Tar {
+	sessionMu.Lock()
+	c := *t
+	sessionMu.Unlock()
+	c.tarState = tarState{}
+	c.origin, c.ctx = nil, nil
+	c.readerWrapFn, c.writerWrapFn, c.cleanupWrapFn, c.closeWrapFn = nil, nil, nil, nil
+	c.VirtualEntries = append([]VirtualEntry(nil), t.VirtualEntries...)
+	c.ExcludePatterns = append([]string(nil), t.ExcludePatterns...)
+	return &c
+}
+
+// withContext returns a session of t which checks ctx
+// while it works: between files and while reading or
+// writing archives.
+func (t *Tar) withContext(ctx context.Context) interface{} {
+	s := t.session()
+	s.ctx = ctx
+	return s
+}
+
+// session returns a copy of t with its own state, for
+// doing one operation without changing t, except that
+// endSession saves the results of the operation to t.
+func (t *Tar) session() *Tar {
+	sessionMu.Lock()
+	s := *t
+	sessionMu.Unlock()
+	// the results of the last operation are kept
+	// until the session does an operation itself
+	s.tarState = tarState{result: t.result, warnings: t.warnings, manifest: t.manifest, signature: t.signature}
+	if s.origin == nil {
+		s.origin = t
+	}
+	return &s
+}
+
+// endSession saves the results of the session t to
+// the Tar it was made from.
+func (t *Tar) endSession() {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	t.origin.warnings = t.warnings
+	t.origin.result = t.result
+	t.origin.manifest = t.manifest
+	t.origin.signature = t.signature
+}
+
+// Warnings returns the warnings of the last operation,
+// which was started by Create or Open (and so by methods
+// like Archive and Unarchive which call them). Of
+// concurrent operations, the last to finish is the
+// last operation.
+func (t *Tar) Warnings() []Warning {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	return t.warnings
+}
+
+// Result returns the result of the last operation,
+// which was started by Create or Open (and so by methods
+// like Archive and Unarchive which call them), as
+// described for Warnings.
+func (t *Tar) Result() OperationResult {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	result := t.result
+	result.Warnings = t.warnings
+	return result
+}
+
+// Manifest returns the manifest of the files written
+// since Create was last called, if ManifestAlgorithm
+// is set.
+func (t *Tar) Manifest() Manifest {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	return t.manifest.get()
+}
+
+// Signature returns the signature of the tarball written
+// since Create was last called, in the format of minisign,
+// if SigningKey is set and the tarball was written.
+func (t *Tar) Signature() []byte {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	return t.signature.get()
+}
+
 // Walk calls walkFn for each visited item in archive.
 func (t *Tar) Walk(archive string, walkFn WalkFunc) error {
+	t = t.session()
+	defer t.endSession()
+	return t.walk(archive, walkFn)
+}
+
+// walk implements Walk, and is used by other methods
+// of t to walk archives with the same session.
+func (t *Tar) walk(archive string, walkFn WalkFunc) error {
+	walkFn = skipDirs(walkFn)
+
 	file, err := os.Open(archive)
 	if err != nil {
-		return fmt.Errorf("opening archive file: %v", err)
+		return fmt.Errorf("opening archive file: %w", err)
 	}
 	defer file.Close()
 
 	err = t.Open(file, 0)
 	if err != nil {
-		return fmt.Errorf("opening archive: %v", err)
+		return fmt.Errorf("opening archive: %w", err)
 	}
 	defer t.Close()
 
 	for {
+		if err := contextErr(t.ctx); err != nil {
+			return err
+		}
 		f, err := t.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
 			if t.ContinueOnError {
-				log.Printf("[ERROR] Opening next file: %v", err)
+				logError(t.Logger, "Opening next file: %v", err)
 				continue
 			}
-			return fmt.Errorf("opening next file: %v", err)
+			return fmt.Errorf("opening next file: %w", err)
 		}
 		err = walkFn(f)
+		f.Close()
+		if err != nil {
+			if err == ErrStopWalk {
+				break
+			}
+			if t.ContinueOnError {
+				logError(t.Logger, "Walking %s: %v", f.Name(), err)
+				continue
+			}
+			return fmt.Errorf("walking %s: %w", f.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (t *Tar) List(archive string) ([]EntryInfo, error) {
+	return listWalk(t, archive)
+}
+
+// Validate checks the integrity of the tarball at archive
+// by reading all of it: the checksums of the headers are
+// verified, and the contents of every entry must be as
+// long as its header says. The stream is read to its end after the end of
+// the tarball, so that compression formats verify their
+// checksums (such as the CRC-32 at the end of a gzip
+// stream). Errors are not ignored, even if
+// ContinueOnError is set.
+func (t *Tar) Validate(archive string) error {
+	t = t.session()
+	defer t.endSession()
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("opening archive file: %w", err)
+	}
+	defer file.Close()
+
+	err = t.Open(file, 0)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer t.Close()
+
+	for {
+		if err := contextErr(t.ctx); err != nil {
+			return err
+		}
+		hdr, err := t.tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading header: %w", err)
+		}
+		err = validateContents(hdr.Name, t.tr)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = io.Copy(ioutil.Discard, t.trIn)
+	if err != nil {
+		return fmt.Errorf("reading past the end of the tarball: %w", err)
+	}
+	return nil
+}
+
+// WalkRef calls walkFn for each visited item in archive,
+// passing a File which is reused for every item. It avoids
+// the per-item allocations made by Walk where possible.
+func (t *Tar) WalkRef(archive string, walkFn WalkRefFunc) error {
+	t = t.session()
+	defer t.endSession()
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("opening archive file: %w", err)
+	}
+	defer file.Close()
+
+	err = t.Open(file, 0)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer t.Close()
+
+	// the contents are always read from the same
+	// tar reader, so it only has to be wrapped once
+	f := File{ReadCloser: ReadFakeCloser{t.tr}}
+
+	for {
+		if err := contextErr(t.ctx); err != nil {
+			return err
+		}
+		hdr, err := t.tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if t.ContinueOnError {
+				logError(t.Logger, "Opening next file: %v", err)
+				continue
+			}
+			return fmt.Errorf("opening next file: %w", err)
+		}
+		f.FileInfo = hdr.FileInfo()
+		f.Header = hdr
+		err = walkFn(&f)
 		if err != nil {
 			if err == ErrStopWalk {
 				break
 			}
 			if t.ContinueOnError {
-				log.Printf("[ERROR] Walking %s: %v", f.Name(), err)
+				logError(t.Logger, "Walking %s: %v", hdr.Name, err)
 				continue
 			}
-			return fmt.Errorf("walking %s: %v", f.Name(), err)
+			return fmt.Errorf("walking %s: %w", hdr.Name, err)
 		}
 	}
 
 	return nil
 }
 
+// Sample reads the headers of n items of archive chosen
+// uniformly at random. Since tarballs have no index, all
+// the headers are read, but the file data in between is
+// skipped; for uncompressed tarballs, it is skipped by
+// seeking instead of being read.
+func (t *Tar) Sample(archive string, n int) (ArchiveSample, error) {
+	t = t.session()
+	defer t.endSession()
+
+	var sample ArchiveSample
+	if n <= 0 {
+		return sample, fmt.Errorf("sample size must be positive")
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return sample, fmt.Errorf("opening archive file: %w", err)
+	}
+	defer file.Close()
+
+	err = t.Open(file, 0)
+	if err != nil {
+		return sample, fmt.Errorf("opening archive: %w", err)
+	}
+	defer t.Close()
+
+	// reservoir sampling keeps a uniform sample of
+	// the items seen so far, without knowing how
+	// many items there are in advance
+	for {
+		f, err := t.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// the position in the stream is unknown after
+			// a bad header, so it is not possible to go on
+			return sample, fmt.Errorf("opening next file: %w", err)
+		}
+		f.Close()
+		sample.Total++
+
+		entry := SampledEntry{
+			FileInfo: f.FileInfo,
+			Path:     entryPath(f),
+			Header:   f.Header,
+		}
+		if len(sample.Entries) < n {
+			sample.Entries = append(sample.Entries, entry)
+		} else if i := rand.Intn(sample.Total); i < n {
+			// drop the replaced item and append the new
+			// one, which keeps the entries in archive order
+			copy(sample.Entries[i:], sample.Entries[i+1:])
+			sample.Entries[n-1] = entry
+		}
+	}
+
+	return sample, nil
+}
+
 // Extract extracts a single file from the tar archive.
 // If the target is a directory, the entire folder will
 // be extracted into destination.
 func (t *Tar) Extract(source, target, destination string) error {
+	t = t.session()
+	defer t.endSession()
+
 	// target refers to a path inside the archive, which should be clean also
 	target = path.Clean(target)
 
@@ -475,7 +2252,9 @@ func (t *Tar) Extract(source, target, destination string) error {
 	// until we are no longer within that directory
 	var targetDirPath string
 
-	return t.Walk(source, func(f File) error {
+	t.symlinks = newSymlinkGuard(t.SymlinkPolicy, destination)
+	t.root = filepath.Clean(destination)
+	err := t.walk(source, func(f File) error {
 		th, ok := f.Header.(*tar.Header)
 		if !ok {
 			return fmt.Errorf("expected header to be *tar.Header but was %T", f.Header)
@@ -495,13 +2274,16 @@ func (t *Tar) Extract(source, target, destination string) error {
 			// build the filename we will extract to
 			end, err := filepath.Rel(targetDirPath, th.Name)
 			if err != nil {
-				return fmt.Errorf("relativizing paths: %v", err)
+				return fmt.Errorf("relativizing paths: %w", err)
+			}
+			joined, err := t.extractTo(destination, filepath.ToSlash(end))
+			if err != nil {
+				return &EntryError{Name: th.Name, Err: err}
 			}
-			joined := filepath.Join(destination, end)
 
 			err = t.untarFile(f, joined)
 			if err != nil {
-				return fmt.Errorf("extracting file %s: %v", th.Name, err)
+				return fmt.Errorf("extracting file %s: %w", th.Name, err)
 			}
 
 			// if our target was not a directory, stop walk
@@ -515,6 +2297,62 @@ func (t *Tar) Extract(source, target, destination string) error {
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	return t.dirTimes.restore(fileSystemOrOS(t.FileSystem), t.Logger, &t.warnings, t.StrictMetadata)
+}
+
+// extractTo returns the path in destination which the
+// entry named name is extracted to, with its name
+// sanitized and checked as when the whole archive is.
+func (t *Tar) extractTo(destination, name string) (string, error) {
+	name, err := sanitizeName(t.SanitizeNames, name, t.Logger, &t.warnings)
+	if err != nil {
+		return "", err
+	}
+	return extractPath(destination, name, t.AllowPathTraversal, t.AbsolutePathPolicy, t.Logger)
+}
+
+// ExtractGlob extracts the files and folders in the
+// archive at source whose paths match pattern to
+// destination, at the same paths under destination as
+// in the archive. An element of "**" in pattern matches
+// any number of path elements, so "**/*.proto" matches
+// all the files named "*.proto" in the archive; the other
+// elements are as in path.Match. Folders which match are
+// made, but the files in them are only extracted if they
+// match too.
+func (t *Tar) ExtractGlob(source, pattern, destination string) error {
+	t = t.session()
+	defer t.endSession()
+
+	gp, err := newGlobPattern(pattern)
+	if err != nil {
+		return fmt.Errorf("parsing pattern: %w", err)
+	}
+
+	t.symlinks = newSymlinkGuard(t.SymlinkPolicy, destination)
+	t.root = filepath.Clean(destination)
+	err = t.walk(source, func(f File) error {
+		name := entryPath(f)
+		if !gp.match(name) {
+			return nil
+		}
+		to, err := t.extractTo(destination, name)
+		if err != nil {
+			return &EntryError{Name: name, Err: err}
+		}
+		err = t.untarFile(f, to)
+		if err != nil {
+			return fmt.Errorf("extracting file %s: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return t.dirTimes.restore(fileSystemOrOS(t.FileSystem), t.Logger, &t.warnings, t.StrictMetadata)
 }
 
 // Match returns true if the format of file matches this
@@ -534,6 +2372,11 @@ func (*Tar) Match(file *os.File) (bool, error) {
 	if _, err = io.ReadFull(file, buf); err != nil {
 		return false, nil
 	}
+	// accept the checksum variants of old V7 tarballs, but
+	// not blank checksums, which would match too much
+	if isV7Header(buf) && len(bytes.Trim(buf[148:156], " \x00")) > 0 {
+		fixV7Checksum(buf)
+	}
 	return hasTarHeader(buf), nil
 }
 
@@ -577,18 +2420,97 @@ func (t *Tar) String() string { return "tar" }
 
 const tarBlockSize = 512
 
+// tarReader reads the entries of a tarball;
+// it is implemented by *tar.Reader.
+type tarReader interface {
+	Next() (*tar.Header, error)
+	Read(p []byte) (int, error)
+}
+
+// concatTarReader reads the entries of concatenated
+// tarballs as if they were a single tarball.
+type concatTarReader struct {
+	*tar.Reader
+	src io.Reader
+}
+
+// Next advances to the next entry, continuing with
+// the next tarball at the end of the current one.
+func (ctr *concatTarReader) Next() (*tar.Header, error) {
+	hdr, err := ctr.Reader.Next()
+	if err != io.EOF {
+		return hdr, err
+	}
+
+	// the end-of-archive marker is at least two blocks
+	// of zeros, but there is usually more padding
+	block := make([]byte, tarBlockSize)
+	for {
+		n, err := io.ReadFull(ctr.src, block)
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err == io.ErrUnexpectedEOF && isZeros(block[:n]) {
+			return nil, io.EOF // trailing padding was cut short
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !isZeros(block) {
+			break
+		}
+	}
+
+	ctr.src = io.MultiReader(bytes.NewReader(block), ctr.src)
+	ctr.Reader = tar.NewReader(ctr.src)
+	return ctr.Reader.Next()
+}
+
+func isZeros(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // Compile-time checks to ensure type implements desired interfaces.
 var (
 	_ = Reader(new(Tar))
 	_ = Writer(new(Tar))
 	_ = Archiver(new(Tar))
+	_ = WriterArchiver(new(Tar))
+	_ = Appender(new(Tar))
+	_ = Updater(new(Tar))
+	_ = Remover(new(Tar))
 	_ = Unarchiver(new(Tar))
+	_ = ReaderUnarchiver(new(Tar))
 	_ = Walker(new(Tar))
+	_ = Lister(new(Tar))
+	_ = Validator(new(Tar))
+	_ = ResultReporter(new(Tar))
+	_ = ManifestReporter(new(Tar))
+	_ = SignatureReporter(new(Tar))
+	_ = RefWalker(new(Tar))
+	_ = BatchWalker(new(Tar))
+	_ = Sampler(new(Tar))
 	_ = Extractor(new(Tar))
+	_ = GlobExtractor(new(Tar))
 	_ = Matcher(new(Tar))
+	_ = WarningCollector(new(Tar))
 )
 
-// DefaultTar is a convenient archiver ready to use.
+// DefaultTar is a convenient archiver ready to use. The
+// default compressed tar formats, such as DefaultTarGz,
+// each have their own clone of it.
 var DefaultTar = &Tar{
 	MkdirAll: true,
 }
+
+// NewTar returns a new Tar configured by opts.
+func NewTar(opts ...Option) *Tar {
+	t := new(Tar)
+	applyOptions(opts, t)
+	return t
+}
@@ -0,0 +1,657 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTarFormat(t *testing.T) {
+	for i, tc := range []struct {
+		format    tar.Format
+		name      string
+		expect    tar.Format // format of the header, if not format
+		shouldErr bool
+	}{
+		{format: tar.FormatUSTAR, name: "quote1.txt"},
+		{format: tar.FormatPAX, name: "quote1.txt"},
+		{format: tar.FormatGNU, name: "quote1.txt"},
+		{format: tar.FormatUSTAR, name: strings.Repeat("a", 300), shouldErr: true},
+		{format: tar.FormatGNU, name: strings.Repeat("a", 300)},
+		{format: tar.FormatPAX, name: strings.Repeat("a", 300)},
+		{format: tar.FormatUnknown, name: strings.Repeat("a", 300), expect: tar.FormatGNU},
+		{format: tar.FormatUnknown, name: strings.Repeat("a", 120) + "/quote1.txt", expect: tar.FormatUSTAR},
+	} {
+		buf := new(bytes.Buffer)
+		tw := &Tar{Format: tc.format}
+		err := tw.Create(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writeTestdataFile(tw, "testdata/quote1.txt", tc.name)
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error writing header, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: writing file: %v", i, err)
+		}
+		err = tw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hdr, err := tar.NewReader(buf).Next()
+		if err != nil {
+			t.Fatalf("Test %d: reading header: %v", i, err)
+		}
+		expect := tc.format
+		if tc.expect != tar.FormatUnknown {
+			expect = tc.expect
+		}
+		if hdr.Format&expect == 0 {
+			t.Errorf("Test %d: expected header in format %s but got %s", i, expect, hdr.Format)
+		}
+		if hdr.Name != tc.name {
+			t.Errorf("Test %d: expected name %s but got %s", i, tc.name, hdr.Name)
+		}
+	}
+}
+
+func TestTarLongLinkname(t *testing.T) {
+	target := strings.Repeat("b/", 100) + "target"
+	for i, tc := range []struct {
+		format tar.Format
+		expect tar.Format
+	}{
+		{format: tar.FormatUnknown, expect: tar.FormatGNU},
+		{format: tar.FormatGNU, expect: tar.FormatGNU},
+		{format: tar.FormatPAX, expect: tar.FormatPAX},
+	} {
+		buf := new(bytes.Buffer)
+		tw := &Tar{Format: tc.format}
+		err := tw.Create(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hdr := &tar.Header{
+			Typeflag: tar.TypeSymlink,
+			Name:     "link",
+			Linkname: target,
+			Mode:     0777,
+		}
+		err = tw.Write(File{
+			FileInfo: FileInfo{
+				FileInfo:   hdr.FileInfo(),
+				CustomName: hdr.Name,
+			},
+			Header:     hdr,
+			ReadCloser: ReadFakeCloser{eofReader{}},
+		})
+		if err != nil {
+			t.Fatalf("Test %d: writing symbolic link: %v", i, err)
+		}
+		err = tw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := tar.NewReader(buf).Next()
+		if err != nil {
+			t.Fatalf("Test %d: reading header: %v", i, err)
+		}
+		if got.Format&tc.expect == 0 {
+			t.Errorf("Test %d: expected header in format %s but got %s", i, tc.expect, got.Format)
+		}
+		if got.Linkname != target {
+			t.Errorf("Test %d: expected link target %s but got %s", i, target, got.Linkname)
+		}
+	}
+}
+
+// writeTestdataFile writes the file at fpath to w,
+// with the given name in the archive.
+func writeTestdataFile(w Writer, fpath, name string) error {
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return w.Write(File{
+		FileInfo: FileInfo{
+			FileInfo:   info,
+			CustomName: name,
+		},
+		ReadCloser: file,
+	})
+}
+
+func TestTarIgnoreZeros(t *testing.T) {
+	// two tarballs, each padded to a full record
+	// like GNU tar does, and concatenated
+	buf := new(bytes.Buffer)
+	for _, name := range []string{"quote1.txt", "quote2.txt"} {
+		tw := &Tar{PadTo: 10240}
+		err := tw.Create(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writeTestdataFile(tw, "testdata/quote1.txt", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tw.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if buf.Len() != 2*10240 {
+		t.Fatalf("expected tarballs padded to %d bytes, got %d", 2*10240, buf.Len())
+	}
+
+	for i, tc := range []struct {
+		ignoreZeros bool
+		expect      []string
+	}{
+		{ignoreZeros: false, expect: []string{"quote1.txt"}},
+		{ignoreZeros: true, expect: []string{"quote1.txt", "quote2.txt"}},
+	} {
+		tr := &Tar{IgnoreZeros: tc.ignoreZeros}
+		err := tr.Open(bytes.NewReader(buf.Bytes()), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for {
+			f, err := tr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Test %d: reading: %v", i, err)
+			}
+			names = append(names, f.Name())
+		}
+		tr.Close()
+		if strings.Join(names, ",") != strings.Join(tc.expect, ",") {
+			t.Errorf("Test %d: expected %v but got %v", i, tc.expect, names)
+		}
+	}
+}
+
+func TestTarTrailer(t *testing.T) {
+	for i, tc := range []struct {
+		tar        *Tar
+		expectSize int // size of each tarball
+		shouldErr  bool
+	}{
+		// header and one block of contents, then the marker
+		{tar: &Tar{}, expectSize: 4 * 512},
+		{tar: &Tar{PadTo: 4096}, expectSize: 4096},
+		{tar: &Tar{PadTo: 1024}, expectSize: 4 * 512},
+		{tar: &Tar{OmitTrailer: true}, expectSize: 2 * 512},
+		{tar: &Tar{PadTo: 1000}, shouldErr: true},
+		{tar: &Tar{PadTo: -512}, shouldErr: true},
+		{tar: &Tar{PadTo: 4096, OmitTrailer: true}, shouldErr: true},
+	} {
+		// concatenate two tarballs, which can be read as
+		// one without IgnoreZeros only if the first one
+		// has no end-of-archive marker
+		buf := new(bytes.Buffer)
+		var err error
+		for _, name := range []string{"quote1.txt", "quote2.txt"} {
+			start := buf.Len()
+			err = tc.tar.Create(buf)
+			if err != nil {
+				break
+			}
+			err = writeTestdataFile(tc.tar, "testdata/quote1.txt", name)
+			if err != nil {
+				t.Fatalf("Test %d: writing file: %v", i, err)
+			}
+			err = tc.tar.Close()
+			if err != nil {
+				t.Fatalf("Test %d: closing: %v", i, err)
+			}
+			if size := buf.Len() - start; size != tc.expectSize {
+				t.Errorf("Test %d: expected tarball of %d bytes, got %d", i, tc.expectSize, size)
+			}
+		}
+		if tc.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: expected error creating tarball, but got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: creating: %v", i, err)
+		}
+
+		var names []string
+		tr := tar.NewReader(buf)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Test %d: reading: %v", i, err)
+			}
+			names = append(names, hdr.Name)
+		}
+		expect := "quote1.txt"
+		if tc.tar.OmitTrailer {
+			expect = "quote1.txt,quote2.txt"
+		}
+		if strings.Join(names, ",") != expect {
+			t.Errorf("Test %d: expected %s but got %v", i, expect, names)
+		}
+	}
+}
+
+func TestTarV7(t *testing.T) {
+	// V7 headers have no magic number, and their checksums
+	// were computed in various ways by different tools
+	v7Header := func(name string, size int, checksum string) []byte {
+		block := make([]byte, 512)
+		copy(block, name)
+		copy(block[100:], "000644 \x00")
+		copy(block[108:], "000765 \x00")
+		copy(block[116:], "000024 \x00")
+		copy(block[124:], fmt.Sprintf("%011o ", size))
+		copy(block[136:], "05433075212 ")
+		var fill byte
+		switch checksum {
+		case "standard":
+			fill = ' '
+		case "zeros":
+			fill = 0
+		case "blank":
+			return block
+		}
+		var sum int
+		for i, b := range block {
+			if i >= 148 && i < 156 {
+				b = fill
+			}
+			sum += int(b)
+		}
+		copy(block[148:], fmt.Sprintf("%06o\x00 ", sum))
+		return block
+	}
+	contents := func(data string) []byte {
+		block := make([]byte, (len(data)+511)/512*512)
+		copy(block, data)
+		return block
+	}
+
+	long := strings.Repeat("more than one block ", 40)
+	files := []struct {
+		name, checksum, data string
+	}{
+		{name: "dir/", checksum: "standard"},
+		{name: "dir/standard.txt", checksum: "standard", data: "standard"},
+		{name: "dir/zeros.txt", checksum: "zeros", data: long},
+		{name: "dir/blank.txt", checksum: "blank", data: "blank"},
+	}
+	buf := new(bytes.Buffer)
+	for _, f := range files {
+		buf.Write(v7Header(f.name, len(f.data), f.checksum))
+		buf.Write(contents(f.data))
+	}
+	buf.Write(make([]byte, 1024))
+
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	archive := filepath.Join(tmp, "v7.tar")
+	err = ioutil.WriteFile(archive, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var i int
+	err = (&Tar{}).Walk(archive, func(f File) error {
+		if i >= len(files) {
+			return fmt.Errorf("unexpected file %s", f.Name())
+		}
+		hdr := f.Header.(*tar.Header)
+		if hdr.Name != files[i].name {
+			t.Errorf("expected file %d to be %s, got %s", i, files[i].name, hdr.Name)
+		}
+		if f.IsDir() != strings.HasSuffix(files[i].name, "/") {
+			t.Errorf("%s: expected directory to be %t", hdr.Name, !f.IsDir())
+		}
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		if string(data) != files[i].data {
+			t.Errorf("%s: expected contents %q, got %q", hdr.Name, files[i].data, data)
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != len(files) {
+		t.Errorf("expected %d files, got %d", len(files), i)
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	matched, err := (&Tar{}).Match(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matched {
+		t.Error("expected V7 tarball to match")
+	}
+}
+
+func TestTarAppend(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, tc := range []struct {
+		name   string
+		format *Tar
+	}{
+		{"trailer", &Tar{}},
+		{"padded", &Tar{PadTo: 10240}},
+		{"no-trailer", &Tar{OmitTrailer: true}},
+	} {
+		archive := filepath.Join(tmp, tc.name+".tar")
+		err := tc.format.Archive([]string{"testdata/quote1.txt"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tc.format.Append(archive, []string{"testdata/proverbs"})
+		if err != nil {
+			t.Fatalf("[%s] appending: %v", tc.name, err)
+		}
+
+		entries, err := (&Tar{}).List(archive)
+		if err != nil {
+			t.Fatalf("[%s] listing: %v", tc.name, err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		expected := []string{
+			"testdata/quote1.txt",
+			"proverbs",
+			"proverbs/extra",
+			"proverbs/extra/proverb3.txt",
+			"proverbs/proverb1.txt",
+			"proverbs/proverb2.txt",
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("[%s] expected entries %v, got %v", tc.name, expected, names)
+		}
+
+		info, err := os.Stat(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.format.PadTo > 0 && info.Size()%int64(tc.format.PadTo) != 0 {
+			t.Errorf("[%s] expected size padded to %d, got %d", tc.name, tc.format.PadTo, info.Size())
+		}
+	}
+
+	// compressed tarballs cannot be appended to
+	archive := filepath.Join(tmp, "test.tar.gz")
+	tgz := &TarGz{Tar: &Tar{}}
+	err = tgz.Archive([]string{"testdata/quote1.txt"}, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tgz.Append(archive, []string{"testdata/proverbs"})
+	if err == nil {
+		t.Error("expected an error appending to a compressed tarball")
+	}
+}
+
+func TestTarHardLinks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	err = os.Mkdir(src, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("contents"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Link(filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt"))
+	if err != nil {
+		t.Skipf("cannot make hard links: %v", err)
+	}
+	if _, ok := fileIdentity(mustLstat(t, filepath.Join(src, "b.txt")).Sys()); !ok {
+		t.Skip("hard links cannot be found on this system")
+	}
+
+	for _, tc := range []struct {
+		dereference bool
+		expect      map[string]string // name -> link target, or contents
+	}{
+		{
+			dereference: false,
+			expect: map[string]string{
+				"src/a.txt": "contents",
+				"src/b.txt": "link to src/a.txt",
+			},
+		},
+		{
+			dereference: true,
+			expect: map[string]string{
+				"src/a.txt": "contents",
+				"src/b.txt": "contents",
+			},
+		},
+	} {
+		archive := filepath.Join(tmp, fmt.Sprintf("test-%t.tar", tc.dereference))
+		tr := &Tar{DereferenceHardLinks: tc.dereference}
+		err := tr.Archive([]string{src}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual := make(map[string]string)
+		err = tr.Walk(archive, func(f File) error {
+			hdr := f.Header.(*tar.Header)
+			switch hdr.Typeflag {
+			case tar.TypeLink:
+				actual[hdr.Name] = "link to " + hdr.Linkname
+			case tar.TypeReg:
+				contents, err := ioutil.ReadAll(f)
+				actual[hdr.Name] = string(contents)
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, tc.expect) {
+			t.Errorf("[dereference=%t] expected entries %v, got %v", tc.dereference, tc.expect, actual)
+		}
+
+		// the link is extracted with the contents of the file
+		dest := filepath.Join(tmp, fmt.Sprintf("out-%t", tc.dereference))
+		err = tr.Unarchive(archive, dest)
+		if err != nil {
+			t.Fatalf("[dereference=%t] extracting: %v", tc.dereference, err)
+		}
+		contents, err := ioutil.ReadFile(filepath.Join(dest, "src", "b.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != "contents" {
+			t.Errorf("[dereference=%t] expected extracted link to have contents, got %q", tc.dereference, contents)
+		}
+	}
+}
+
+func TestTarHardLinkTargets(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	victim := filepath.Join(tmp, "victim.txt")
+	err = ioutil.WriteFile(victim, []byte("victim"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := &tar.Header{Name: "./dir/file.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 8}
+	for i, tc := range []struct {
+		file      *tar.Header
+		linkname  string
+		sanitize  NameSanitization
+		expectErr bool
+	}{
+		{file: file, linkname: "./dir/file.txt"},
+		{file: file, linkname: "dir/file.txt"},
+		{file: file, linkname: "/dir/file.txt"},
+		{file: &tar.Header{Name: "bell\a.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 8}, linkname: "bell\a.txt", sanitize: NameSanitization{StripControl: true}},
+		{linkname: "../victim.txt", expectErr: true},
+		{linkname: "dir/../../victim.txt", expectErr: true},
+		{linkname: ".", expectErr: true},
+	} {
+		buf := new(bytes.Buffer)
+		tw := tar.NewWriter(buf)
+		if tc.file != nil {
+			err := tw.WriteHeader(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tw.Write([]byte("contents"))
+		}
+		err := tw.WriteHeader(&tar.Header{Name: "dir/sub/link", Typeflag: tar.TypeLink, Linkname: tc.linkname})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw.Close()
+
+		dest := filepath.Join(tmp, fmt.Sprint(i))
+		tr := &Tar{MkdirAll: true, SanitizeNames: tc.sanitize}
+		err = tr.UnarchiveReader(bytes.NewReader(buf.Bytes()), dest)
+		if tc.expectErr {
+			if !errors.Is(err, ErrIllegalPath) {
+				t.Errorf("Test %d: expected illegal path error for link to %s, got %v", i, tc.linkname, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		contents, err := ioutil.ReadFile(filepath.Join(dest, "dir", "sub", "link"))
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		if string(contents) != "contents" {
+			t.Errorf("Test %d: expected extracted link to have contents of its target, got %q", i, contents)
+		}
+	}
+
+	contents, err := ioutil.ReadFile(victim)
+	if err != nil || string(contents) != "victim" {
+		t.Errorf("expected file outside of destination to be left alone, got %q (%v)", contents, err)
+	}
+}
+
+func mustLstat(t *testing.T, fpath string) os.FileInfo {
+	info, err := os.Lstat(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestTarModifyHeader(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	srcPaths := make(map[string]string)
+	tr := &Tar{
+		ModifyHeader: func(hdr *tar.Header, srcPath string) error {
+			srcPaths[hdr.Name] = srcPath
+			hdr.Uid, hdr.Gid = 1234, 5678
+			hdr.Uname, hdr.Gname = "builder", "builders"
+			if hdr.Typeflag == tar.TypeReg {
+				hdr.Mode = 0600
+			}
+			hdr.PAXRecords = map[string]string{"ARCHIVER.build": "42"}
+			return nil
+		},
+	}
+	archive := filepath.Join(tmp, "test.tar")
+	err = tr.Archive([]string{"testdata"}, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srcPaths["testdata/quote1.txt"] != filepath.Join("testdata", "quote1.txt") {
+		t.Errorf("expected source path of testdata/quote1.txt, got %q", srcPaths["testdata/quote1.txt"])
+	}
+
+	err = (&Tar{}).Walk(archive, func(f File) error {
+		hdr := f.Header.(*tar.Header)
+		if hdr.Uid != 1234 || hdr.Gid != 5678 || hdr.Uname != "builder" || hdr.Gname != "builders" {
+			t.Errorf("%s: expected owner to be changed, got %d:%d (%s:%s)", hdr.Name, hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname)
+		}
+		if hdr.Typeflag == tar.TypeReg && hdr.Mode != 0600 {
+			t.Errorf("%s: expected mode 0600, got %o", hdr.Name, hdr.Mode)
+		}
+		if hdr.PAXRecords["ARCHIVER.build"] != "42" {
+			t.Errorf("%s: expected PAX record, got %v", hdr.Name, hdr.PAXRecords)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr.ModifyHeader = func(hdr *tar.Header, srcPath string) error {
+		return fmt.Errorf("not allowed")
+	}
+	err = tr.Archive([]string{"testdata"}, filepath.Join(tmp, "failing.tar"))
+	if err == nil {
+		t.Error("expected an error from ModifyHeader")
+	}
+}
@@ -1,7 +1,7 @@
 package archiver
 
 import (
-	"fmt"
+	"context"
 	"io"
 	"strings"
 
@@ -25,37 +25,91 @@ type TarBz2 struct {
 func (tbz2 *TarBz2) Archive(sources []string, destination string) error {
 	if !strings.HasSuffix(destination, ".tar.bz2") &&
 		!strings.HasSuffix(destination, ".tbz2") {
-		return fmt.Errorf("output filename must have .tar.bz2 or .tbz2 extension")
+		return pathErrorf(ErrFormatMismatch, destination, "output filename must have .tar.bz2 or .tbz2 extension")
 	}
-	tbz2.wrapWriter()
-	return tbz2.Tar.Archive(sources, destination)
+	return tbz2.wrapWriter(tbz2.Tar.session()).Archive(sources, destination)
+}
+
+// ArchiveWriter writes a compressed tarball containing
+// the files listed in sources to w; see Tar.ArchiveWriter.
+func (tbz2 *TarBz2) ArchiveWriter(sources []string, w io.Writer) error {
+	return tbz2.wrapWriter(tbz2.Tar.session()).ArchiveWriter(sources, w)
+}
+
+// Update rewrites the compressed tarball at archive with
+// the entries named by the keys of replacements replaced
+// or added; see Tar.Update.
+func (tbz2 *TarBz2) Update(archive string, replacements map[string]string) error {
+	return tbz2.Tar.update(archive, newArchiveEdits(replacements, nil), tbz2.wrapReader, tbz2.wrapWriter)
+}
+
+// Remove rewrites the compressed tarball at archive without
+// the entries named in names; see Tar.Remove.
+func (tbz2 *TarBz2) Remove(archive string, names []string) error {
+	return tbz2.Tar.update(archive, newArchiveEdits(nil, names), tbz2.wrapReader, tbz2.wrapWriter)
 }
 
 // Unarchive unpacks the compressed tarball at
 // source to destination. Destination will be
 // treated as a folder name.
 func (tbz2 *TarBz2) Unarchive(source, destination string) error {
-	tbz2.wrapReader()
-	return tbz2.Tar.Unarchive(source, destination)
+	return tbz2.wrapReader(tbz2.Tar.session()).Unarchive(source, destination)
+}
+
+// UnarchiveReader unpacks the compressed tarball read
+// from in to destination, in a single pass; see
+// Tar.UnarchiveReader.
+func (tbz2 *TarBz2) UnarchiveReader(in io.Reader, destination string) error {
+	return tbz2.wrapReader(tbz2.Tar.session()).UnarchiveReader(in, destination)
 }
 
 // Walk calls walkFn for each visited item in archive.
 func (tbz2 *TarBz2) Walk(archive string, walkFn WalkFunc) error {
-	tbz2.wrapReader()
-	return tbz2.Tar.Walk(archive, walkFn)
+	return tbz2.wrapReader(tbz2.Tar.session()).Walk(archive, walkFn)
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (tbz2 *TarBz2) List(archive string) ([]EntryInfo, error) {
+	return listWalk(tbz2, archive)
+}
+
+// Validate checks the integrity of the compressed
+// tarball at archive, including the checksums of the
+// compression format; see Tar.Validate.
+func (tbz2 *TarBz2) Validate(archive string) error {
+	return tbz2.wrapReader(tbz2.Tar.session()).Validate(archive)
+}
+
+// WalkRef calls walkFn for each visited item in archive,
+// passing a File which is reused for every item.
+func (tbz2 *TarBz2) WalkRef(archive string, walkFn WalkRefFunc) error {
+	return tbz2.wrapReader(tbz2.Tar.session()).WalkRef(archive, walkFn)
+}
+
+// WalkBatches calls fn with batches of batchSize
+// items visited in archive.
+func (tbz2 *TarBz2) WalkBatches(archive string, batchSize int, fn WalkBatchFunc) error {
+	return tbz2.wrapReader(tbz2.Tar.session()).WalkBatches(archive, batchSize, fn)
+}
+
+// Sample reads the headers of n items of
+// archive chosen uniformly at random.
+func (tbz2 *TarBz2) Sample(archive string, n int) (ArchiveSample, error) {
+	return tbz2.wrapReader(tbz2.Tar.session()).Sample(archive, n)
 }
 
 // Create opens tbz2 for writing a compressed
 // tar archive to out.
 func (tbz2 *TarBz2) Create(out io.Writer) error {
-	tbz2.wrapWriter()
+	tbz2.wrapWriter(tbz2.Tar)
 	return tbz2.Tar.Create(out)
 }
 
 // Open opens t for reading a compressed archive from
 // in. The size parameter is not used.
 func (tbz2 *TarBz2) Open(in io.Reader, size int64) error {
-	tbz2.wrapReader()
+	tbz2.wrapReader(tbz2.Tar)
 	return tbz2.Tar.Open(in, size)
 }
 
@@ -63,34 +117,58 @@ func (tbz2 *TarBz2) Open(in io.Reader, size int64) error {
 // If the target is a directory, the entire folder will
 // be extracted into destination.
 func (tbz2 *TarBz2) Extract(source, target, destination string) error {
-	tbz2.wrapReader()
-	return tbz2.Tar.Extract(source, target, destination)
+	return tbz2.wrapReader(tbz2.Tar.session()).Extract(source, target, destination)
+}
+
+// ExtractGlob extracts the files and folders in the
+// compressed tarball at source whose paths match
+// pattern to destination; see Tar.ExtractGlob.
+func (tbz2 *TarBz2) ExtractGlob(source, pattern, destination string) error {
+	return tbz2.wrapReader(tbz2.Tar.session()).ExtractGlob(source, pattern, destination)
 }
 
-func (tbz2 *TarBz2) wrapWriter() {
+func (tbz2 *TarBz2) wrapWriter(t *Tar) *Tar {
 	var bz2w *bzip2.Writer
-	tbz2.Tar.writerWrapFn = func(w io.Writer) (io.Writer, error) {
+	t.writerWrapFn = func(w io.Writer) (io.Writer, error) {
 		var err error
 		bz2w, err = bzip2.NewWriter(w, &bzip2.WriterConfig{
 			Level: tbz2.CompressionLevel,
 		})
 		return bz2w, err
 	}
-	tbz2.Tar.cleanupWrapFn = func() {
+	t.cleanupWrapFn = func() {
 		bz2w.Close()
 	}
+	return t
 }
 
-func (tbz2 *TarBz2) wrapReader() {
+func (tbz2 *TarBz2) wrapReader(t *Tar) *Tar {
 	var bz2r *bzip2.Reader
-	tbz2.Tar.readerWrapFn = func(r io.Reader) (io.Reader, error) {
+	t.readerWrapFn = func(r io.Reader) (io.Reader, error) {
 		var err error
 		bz2r, err = bzip2.NewReader(r, nil)
 		return bz2r, err
 	}
-	tbz2.Tar.cleanupWrapFn = func() {
+	t.cleanupWrapFn = func() {
 		bz2r.Close()
 	}
+	return t
+}
+
+// Clone returns a copy of tbz2 with a clone of its Tar,
+// which can be changed without changing tbz2.
+func (tbz2 *TarBz2) Clone() *TarBz2 {
+	c := *tbz2
+	c.Tar = tbz2.Tar.Clone()
+	return &c
+}
+
+// withContext returns a copy of tbz2 whose Tar is a
+// session which checks ctx; see Tar.withContext.
+func (tbz2 *TarBz2) withContext(ctx context.Context) interface{} {
+	c := *tbz2
+	c.Tar = tbz2.Tar.withContext(ctx).(*Tar)
+	return &c
 }
 
 func (tbz2 *TarBz2) String() string { return "tar.bz2" }
@@ -100,13 +178,35 @@ var (
 	_ = Reader(new(TarBz2))
 	_ = Writer(new(TarBz2))
 	_ = Archiver(new(TarBz2))
+	_ = WriterArchiver(new(TarBz2))
+	_ = Updater(new(TarBz2))
+	_ = Remover(new(TarBz2))
 	_ = Unarchiver(new(TarBz2))
+	_ = ReaderUnarchiver(new(TarBz2))
 	_ = Walker(new(TarBz2))
+	_ = Lister(new(TarBz2))
+	_ = Validator(new(TarBz2))
+	_ = ResultReporter(new(TarBz2))
+	_ = ManifestReporter(new(TarBz2))
+	_ = SignatureReporter(new(TarBz2))
+	_ = RefWalker(new(TarBz2))
+	_ = BatchWalker(new(TarBz2))
+	_ = Sampler(new(TarBz2))
 	_ = Extractor(new(TarBz2))
+	_ = GlobExtractor(new(TarBz2))
 )
 
 // DefaultTarBz2 is a convenient archiver ready to use.
 var DefaultTarBz2 = &TarBz2{
 	CompressionLevel: bzip2.DefaultCompression,
-	Tar:              DefaultTar,
+	Tar:              DefaultTar.Clone(),
+}
+
+// NewTarBz2 returns a new TarBz2 configured by opts;
+// unless they set the level, it compresses at the
+// default level.
+func NewTarBz2(opts ...Option) *TarBz2 {
+	tbz2 := &TarBz2{CompressionLevel: bzip2.DefaultCompression, Tar: new(Tar)}
+	applyOptions(opts, tbz2.Tar, tbz2)
+	return tbz2
 }
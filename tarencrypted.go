@@ -0,0 +1,262 @@
+package archiver
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+)
+
+// TarEncrypted facilitates encryption of tarball archives
+// with any encryption which works on streams, such as age
+// (https://age-encryption.org), so that encrypted backups
+// need no external tools. For example, with the age
+// package:
+//
+//	te := &archiver.TarEncrypted{
+//		Tar:  archiver.DefaultTar.Clone(),
+//		Gzip: true,
+//		Encrypt: func(w io.Writer) (io.WriteCloser, error) {
+//			return age.Encrypt(w, recipients...)
+//		},
+//		Decrypt: func(r io.Reader) (io.Reader, error) {
+//			return age.Decrypt(r, identities...)
+//		},
+//	}
+//
+// Unlike the other tar formats, the names of the archives
+// written are not checked, since they depend on the
+// encryption; for age, ".tar.age" and ".tar.gz.age" are
+// usual.
+type TarEncrypted struct {
+	*Tar
+
+	// Returns a writer which encrypts what is written to
+	// it, and writes it to w; it is closed when the archive
+	// is, and must write what remains then. Needed to write
+	// archives.
+	Encrypt func(w io.Writer) (io.WriteCloser, error)
+
+	// Returns a reader of what is read from r, decrypted.
+	// Needed to read archives.
+	Decrypt func(r io.Reader) (io.Reader, error)
+
+	// If true, the tarball is compressed with gzip before
+	// it is encrypted, since encrypted data does not
+	// compress, and decompressed after it is decrypted.
+	Gzip bool
+}
+
+// Archive creates an encrypted tar file at destination
+// containing the files listed in sources. File paths can
+// be those of regular files or directories; directories
+// will be recursively added.
+func (te *TarEncrypted) Archive(sources []string, destination string) error {
+	return te.wrapWriter(te.Tar.session()).Archive(sources, destination)
+}
+
+// ArchiveWriter writes an encrypted tarball containing
+// the files listed in sources to w; see Tar.ArchiveWriter.
+func (te *TarEncrypted) ArchiveWriter(sources []string, w io.Writer) error {
+	return te.wrapWriter(te.Tar.session()).ArchiveWriter(sources, w)
+}
+
+// Update rewrites the encrypted tarball at archive with
+// the entries named by the keys of replacements replaced
+// or added; see Tar.Update.
+func (te *TarEncrypted) Update(archive string, replacements map[string]string) error {
+	return te.Tar.update(archive, newArchiveEdits(replacements, nil), te.wrapReader, te.wrapWriter)
+}
+
+// Remove rewrites the encrypted tarball at archive without
+// the entries named in names; see Tar.Remove.
+func (te *TarEncrypted) Remove(archive string, names []string) error {
+	return te.Tar.update(archive, newArchiveEdits(nil, names), te.wrapReader, te.wrapWriter)
+}
+
+// Unarchive unpacks the encrypted tarball at
+// source to destination. Destination will be
+// treated as a folder name.
+func (te *TarEncrypted) Unarchive(source, destination string) error {
+	return te.wrapReader(te.Tar.session()).Unarchive(source, destination)
+}
+
+// UnarchiveReader unpacks the encrypted tarball read
+// from in to destination, in a single pass; see
+// Tar.UnarchiveReader.
+func (te *TarEncrypted) UnarchiveReader(in io.Reader, destination string) error {
+	return te.wrapReader(te.Tar.session()).UnarchiveReader(in, destination)
+}
+
+// Walk calls walkFn for each visited item in archive.
+func (te *TarEncrypted) Walk(archive string, walkFn WalkFunc) error {
+	return te.wrapReader(te.Tar.session()).Walk(archive, walkFn)
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (te *TarEncrypted) List(archive string) ([]EntryInfo, error) {
+	return listWalk(te, archive)
+}
+
+// Validate checks the integrity of the encrypted tarball
+// at archive, including whatever the encryption checks
+// as it decrypts; see Tar.Validate.
+func (te *TarEncrypted) Validate(archive string) error {
+	return te.wrapReader(te.Tar.session()).Validate(archive)
+}
+
+// WalkRef calls walkFn for each visited item in archive,
+// passing a File which is reused for every item.
+func (te *TarEncrypted) WalkRef(archive string, walkFn WalkRefFunc) error {
+	return te.wrapReader(te.Tar.session()).WalkRef(archive, walkFn)
+}
+
+// WalkBatches calls fn with batches of batchSize
+// items visited in archive.
+func (te *TarEncrypted) WalkBatches(archive string, batchSize int, fn WalkBatchFunc) error {
+	return te.wrapReader(te.Tar.session()).WalkBatches(archive, batchSize, fn)
+}
+
+// Sample reads the headers of n items of
+// archive chosen uniformly at random.
+func (te *TarEncrypted) Sample(archive string, n int) (ArchiveSample, error) {
+	return te.wrapReader(te.Tar.session()).Sample(archive, n)
+}
+
+// Create opens te for writing an encrypted
+// tar archive to out.
+func (te *TarEncrypted) Create(out io.Writer) error {
+	te.wrapWriter(te.Tar)
+	return te.Tar.Create(out)
+}
+
+// Open opens te for reading an encrypted archive
+// from in. The size parameter is not used.
+func (te *TarEncrypted) Open(in io.Reader, size int64) error {
+	te.wrapReader(te.Tar)
+	return te.Tar.Open(in, size)
+}
+
+// Extract extracts a single file from the tar archive.
+// If the target is a directory, the entire folder will
+// be extracted into destination.
+func (te *TarEncrypted) Extract(source, target, destination string) error {
+	return te.wrapReader(te.Tar.session()).Extract(source, target, destination)
+}
+
+// ExtractGlob extracts the files and folders in the
+// encrypted tarball at source whose paths match
+// pattern to destination; see Tar.ExtractGlob.
+func (te *TarEncrypted) ExtractGlob(source, pattern, destination string) error {
+	return te.wrapReader(te.Tar.session()).ExtractGlob(source, pattern, destination)
+}
+
+func (te *TarEncrypted) wrapWriter(t *Tar) *Tar {
+	var ew io.WriteCloser
+	var gzw *gzip.Writer
+	t.writerWrapFn = func(w io.Writer) (io.Writer, error) {
+		if te.Encrypt == nil {
+			return nil, fmt.Errorf("no Encrypt function to write encrypted tarball")
+		}
+		var err error
+		ew, err = te.Encrypt(w)
+		if err != nil || !te.Gzip {
+			return ew, err
+		}
+		gzw, err = getGzipWriter(ew, gzip.DefaultCompression)
+		return gzw, err
+	}
+	// the encryption must be finished
+	// for the archive to be complete
+	t.closeWrapFn = func() error {
+		if gzw != nil {
+			err := gzw.Close()
+			putGzipWriter(gzw, gzip.DefaultCompression)
+			gzw = nil
+			if err != nil {
+				return err
+			}
+		}
+		if ew != nil {
+			err := ew.Close()
+			ew = nil
+			return err
+		}
+		return nil
+	}
+	return t
+}
+
+func (te *TarEncrypted) wrapReader(t *Tar) *Tar {
+	var gzr *gzip.Reader
+	t.readerWrapFn = func(r io.Reader) (io.Reader, error) {
+		if te.Decrypt == nil {
+			return nil, fmt.Errorf("no Decrypt function to read encrypted tarball")
+		}
+		dr, err := te.Decrypt(r)
+		if err != nil || !te.Gzip {
+			return dr, err
+		}
+		gzr, err = getGzipReader(dr)
+		return gzr, err
+	}
+	t.cleanupWrapFn = func() {
+		if gzr != nil {
+			putGzipReader(gzr)
+			gzr = nil
+		}
+	}
+	return t
+}
+
+// Clone returns a copy of te with a clone of its Tar,
+// which can be changed without changing te.
+func (te *TarEncrypted) Clone() *TarEncrypted {
+	c := *te
+	c.Tar = te.Tar.Clone()
+	return &c
+}
+
+// withContext returns a copy of te whose Tar is a
+// session which checks ctx; see Tar.withContext.
+func (te *TarEncrypted) withContext(ctx context.Context) interface{} {
+	c := *te
+	c.Tar = te.Tar.withContext(ctx).(*Tar)
+	return &c
+}
+
+func (te *TarEncrypted) String() string { return "encrypted tar" }
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = Reader(new(TarEncrypted))
+	_ = Writer(new(TarEncrypted))
+	_ = Archiver(new(TarEncrypted))
+	_ = WriterArchiver(new(TarEncrypted))
+	_ = Updater(new(TarEncrypted))
+	_ = Remover(new(TarEncrypted))
+	_ = Unarchiver(new(TarEncrypted))
+	_ = ReaderUnarchiver(new(TarEncrypted))
+	_ = Walker(new(TarEncrypted))
+	_ = Lister(new(TarEncrypted))
+	_ = Validator(new(TarEncrypted))
+	_ = ResultReporter(new(TarEncrypted))
+	_ = ManifestReporter(new(TarEncrypted))
+	_ = SignatureReporter(new(TarEncrypted))
+	_ = RefWalker(new(TarEncrypted))
+	_ = BatchWalker(new(TarEncrypted))
+	_ = Sampler(new(TarEncrypted))
+	_ = Extractor(new(TarEncrypted))
+	_ = GlobExtractor(new(TarEncrypted))
+)
+
+// NewTarEncrypted returns a new TarEncrypted which
+// encrypts and decrypts with encrypt and decrypt,
+// either of which may be nil if it is not needed,
+// configured by opts.
+func NewTarEncrypted(encrypt func(w io.Writer) (io.WriteCloser, error), decrypt func(r io.Reader) (io.Reader, error), opts ...Option) *TarEncrypted {
+	te := &TarEncrypted{Tar: new(Tar), Encrypt: encrypt, Decrypt: decrypt}
+	applyOptions(opts, te.Tar, te)
+	return te
+}
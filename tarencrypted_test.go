@@ -0,0 +1,95 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// xorWriter "encrypts" by flipping bits, and
+// writes a trailer when it is closed, as real
+// encryption finishes the stream then.
+type xorWriter struct{ w io.Writer }
+
+func (x xorWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	for i := range p {
+		buf[i] = p[i] ^ 0xaa
+	}
+	return x.w.Write(buf)
+}
+
+func (x xorWriter) Close() error {
+	_, err := x.w.Write([]byte("END"))
+	return err
+}
+
+func xorDecrypt(r io.Reader) (io.Reader, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasSuffix(data, []byte("END")) {
+		return nil, fmt.Errorf("stream was not finished")
+	}
+	data = data[:len(data)-3]
+	for i := range data {
+		data[i] ^= 0xaa
+	}
+	return bytes.NewReader(data), nil
+}
+
+func TestTarEncrypted(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	encrypt := func(w io.Writer) (io.WriteCloser, error) { return xorWriter{w}, nil }
+	for i, gz := range []bool{false, true} {
+		te := NewTarEncrypted(encrypt, xorDecrypt)
+		te.Gzip = gz
+		archive := filepath.Join(tmp, fmt.Sprintf("test%d.tar.age", i))
+		err := te.Archive([]string{"testdata/quote1.txt"}, archive)
+		if err != nil {
+			t.Fatalf("Test %d: archiving: %v", i, err)
+		}
+		data, err := ioutil.ReadFile(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("quote1.txt")) {
+			t.Errorf("Test %d: expected names to be encrypted", i)
+		}
+
+		dest := filepath.Join(tmp, fmt.Sprint(i))
+		err = te.Unarchive(archive, dest)
+		if err != nil {
+			t.Fatalf("Test %d: extracting: %v", i, err)
+		}
+		expected, err := ioutil.ReadFile("testdata/quote1.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := ioutil.ReadFile(filepath.Join(dest, "testdata", "quote1.txt"))
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("Test %d: expected contents to be kept, got %q (%v)", i, actual, err)
+		}
+
+		// the gzip header is not in the clear
+		_, err = (&TarGz{Tar: new(Tar)}).List(archive)
+		if err == nil {
+			t.Errorf("Test %d: expected encrypted tarball not to be readable without decryption", i)
+		}
+	}
+
+	err = NewTarEncrypted(nil, nil).Archive([]string{"testdata/quote1.txt"}, filepath.Join(tmp, "none.tar.age"))
+	if err == nil {
+		t.Error("expected error for missing Encrypt function")
+	}
+}
@@ -2,13 +2,15 @@ package archiver
 
 import (
 	"compress/gzip"
-	"fmt"
+	"context"
 	"io"
 	"strings"
 )
 
 // TarGz facilitates gzip compression
-// (RFC 1952) of tarball archives.
+// (RFC 1952) of tarball archives. When reading,
+// gzip files made of multiple members, such as
+// those written by pigz or bgzip, are supported.
 type TarGz struct {
 	*Tar
 
@@ -25,37 +27,91 @@ type TarGz struct {
 func (tgz *TarGz) Archive(sources []string, destination string) error {
 	if !strings.HasSuffix(destination, ".tar.gz") &&
 		!strings.HasSuffix(destination, ".tgz") {
-		return fmt.Errorf("output filename must have .tar.gz or .tgz extension")
+		return pathErrorf(ErrFormatMismatch, destination, "output filename must have .tar.gz or .tgz extension")
 	}
-	tgz.wrapWriter()
-	return tgz.Tar.Archive(sources, destination)
+	return tgz.wrapWriter(tgz.Tar.session()).Archive(sources, destination)
+}
+
+// ArchiveWriter writes a compressed tarball containing
+// the files listed in sources to w; see Tar.ArchiveWriter.
+func (tgz *TarGz) ArchiveWriter(sources []string, w io.Writer) error {
+	return tgz.wrapWriter(tgz.Tar.session()).ArchiveWriter(sources, w)
+}
+
+// Update rewrites the compressed tarball at archive with
+// the entries named by the keys of replacements replaced
+// or added; see Tar.Update.
+func (tgz *TarGz) Update(archive string, replacements map[string]string) error {
+	return tgz.Tar.update(archive, newArchiveEdits(replacements, nil), tgz.wrapReader, tgz.wrapWriter)
+}
+
+// Remove rewrites the compressed tarball at archive without
+// the entries named in names; see Tar.Remove.
+func (tgz *TarGz) Remove(archive string, names []string) error {
+	return tgz.Tar.update(archive, newArchiveEdits(nil, names), tgz.wrapReader, tgz.wrapWriter)
 }
 
 // Unarchive unpacks the compressed tarball at
 // source to destination. Destination will be
 // treated as a folder name.
 func (tgz *TarGz) Unarchive(source, destination string) error {
-	tgz.wrapReader()
-	return tgz.Tar.Unarchive(source, destination)
+	return tgz.wrapReader(tgz.Tar.session()).Unarchive(source, destination)
+}
+
+// UnarchiveReader unpacks the compressed tarball read
+// from in to destination, in a single pass; see
+// Tar.UnarchiveReader.
+func (tgz *TarGz) UnarchiveReader(in io.Reader, destination string) error {
+	return tgz.wrapReader(tgz.Tar.session()).UnarchiveReader(in, destination)
 }
 
 // Walk calls walkFn for each visited item in archive.
 func (tgz *TarGz) Walk(archive string, walkFn WalkFunc) error {
-	tgz.wrapReader()
-	return tgz.Tar.Walk(archive, walkFn)
+	return tgz.wrapReader(tgz.Tar.session()).Walk(archive, walkFn)
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (tgz *TarGz) List(archive string) ([]EntryInfo, error) {
+	return listWalk(tgz, archive)
+}
+
+// Validate checks the integrity of the compressed
+// tarball at archive, including the checksums of the
+// compression format; see Tar.Validate.
+func (tgz *TarGz) Validate(archive string) error {
+	return tgz.wrapReader(tgz.Tar.session()).Validate(archive)
+}
+
+// WalkRef calls walkFn for each visited item in archive,
+// passing a File which is reused for every item.
+func (tgz *TarGz) WalkRef(archive string, walkFn WalkRefFunc) error {
+	return tgz.wrapReader(tgz.Tar.session()).WalkRef(archive, walkFn)
+}
+
+// WalkBatches calls fn with batches of batchSize
+// items visited in archive.
+func (tgz *TarGz) WalkBatches(archive string, batchSize int, fn WalkBatchFunc) error {
+	return tgz.wrapReader(tgz.Tar.session()).WalkBatches(archive, batchSize, fn)
+}
+
+// Sample reads the headers of n items of
+// archive chosen uniformly at random.
+func (tgz *TarGz) Sample(archive string, n int) (ArchiveSample, error) {
+	return tgz.wrapReader(tgz.Tar.session()).Sample(archive, n)
 }
 
 // Create opens txz for writing a compressed
 // tar archive to out.
 func (tgz *TarGz) Create(out io.Writer) error {
-	tgz.wrapWriter()
+	tgz.wrapWriter(tgz.Tar)
 	return tgz.Tar.Create(out)
 }
 
 // Open opens t for reading a compressed archive from
 // in. The size parameter is not used.
 func (tgz *TarGz) Open(in io.Reader, size int64) error {
-	tgz.wrapReader()
+	tgz.wrapReader(tgz.Tar)
 	return tgz.Tar.Open(in, size)
 }
 
@@ -63,32 +119,64 @@ func (tgz *TarGz) Open(in io.Reader, size int64) error {
 // If the target is a directory, the entire folder will
 // be extracted into destination.
 func (tgz *TarGz) Extract(source, target, destination string) error {
-	tgz.wrapReader()
-	return tgz.Tar.Extract(source, target, destination)
+	return tgz.wrapReader(tgz.Tar.session()).Extract(source, target, destination)
+}
+
+// ExtractGlob extracts the files and folders in the
+// compressed tarball at source whose paths match
+// pattern to destination; see Tar.ExtractGlob.
+func (tgz *TarGz) ExtractGlob(source, pattern, destination string) error {
+	return tgz.wrapReader(tgz.Tar.session()).ExtractGlob(source, pattern, destination)
 }
 
-func (tgz *TarGz) wrapWriter() {
+func (tgz *TarGz) wrapWriter(t *Tar) *Tar {
 	var gzw *gzip.Writer
-	tgz.Tar.writerWrapFn = func(w io.Writer) (io.Writer, error) {
+	level := tgz.CompressionLevel
+	t.writerWrapFn = func(w io.Writer) (io.Writer, error) {
 		var err error
-		gzw, err = gzip.NewWriterLevel(w, tgz.CompressionLevel)
+		gzw, err = getGzipWriter(w, level)
 		return gzw, err
 	}
-	tgz.Tar.cleanupWrapFn = func() {
-		gzw.Close()
+	t.cleanupWrapFn = func() {
+		if gzw != nil {
+			gzw.Close()
+			putGzipWriter(gzw, level)
+			gzw = nil
+		}
 	}
+	return t
 }
 
-func (tgz *TarGz) wrapReader() {
+func (tgz *TarGz) wrapReader(t *Tar) *Tar {
 	var gzr *gzip.Reader
-	tgz.Tar.readerWrapFn = func(r io.Reader) (io.Reader, error) {
+	t.readerWrapFn = func(r io.Reader) (io.Reader, error) {
 		var err error
-		gzr, err = gzip.NewReader(r)
+		gzr, err = getGzipReader(r)
 		return gzr, err
 	}
-	tgz.Tar.cleanupWrapFn = func() {
-		gzr.Close()
+	t.cleanupWrapFn = func() {
+		if gzr != nil {
+			putGzipReader(gzr)
+			gzr = nil
+		}
 	}
+	return t
+}
+
+// Clone returns a copy of tgz with a clone of its Tar,
+// which can be changed without changing tgz.
+func (tgz *TarGz) Clone() *TarGz {
+	c := *tgz
+	c.Tar = tgz.Tar.Clone()
+	return &c
+}
+
+// withContext returns a copy of tgz whose Tar is a
+// session which checks ctx; see Tar.withContext.
+func (tgz *TarGz) withContext(ctx context.Context) interface{} {
+	c := *tgz
+	c.Tar = tgz.Tar.withContext(ctx).(*Tar)
+	return &c
 }
 
 func (tgz *TarGz) String() string { return "tar.gz" }
@@ -98,13 +186,35 @@ var (
 	_ = Reader(new(TarGz))
 	_ = Writer(new(TarGz))
 	_ = Archiver(new(TarGz))
+	_ = WriterArchiver(new(TarGz))
+	_ = Updater(new(TarGz))
+	_ = Remover(new(TarGz))
 	_ = Unarchiver(new(TarGz))
+	_ = ReaderUnarchiver(new(TarGz))
 	_ = Walker(new(TarGz))
+	_ = Lister(new(TarGz))
+	_ = Validator(new(TarGz))
+	_ = ResultReporter(new(TarGz))
+	_ = ManifestReporter(new(TarGz))
+	_ = SignatureReporter(new(TarGz))
+	_ = RefWalker(new(TarGz))
+	_ = BatchWalker(new(TarGz))
+	_ = Sampler(new(TarGz))
 	_ = Extractor(new(TarGz))
+	_ = GlobExtractor(new(TarGz))
 )
 
 // DefaultTarGz is a convenient archiver ready to use.
 var DefaultTarGz = &TarGz{
 	CompressionLevel: gzip.DefaultCompression,
-	Tar:              DefaultTar,
+	Tar:              DefaultTar.Clone(),
+}
+
+// NewTarGz returns a new TarGz configured by opts;
+// unless they set the level, it compresses at the
+// default level.
+func NewTarGz(opts ...Option) *TarGz {
+	tgz := &TarGz{CompressionLevel: gzip.DefaultCompression, Tar: new(Tar)}
+	applyOptions(opts, tgz.Tar, tgz)
+	return tgz
 }
@@ -0,0 +1,79 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarGzMultistream(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	tarball := filepath.Join(tmp, "plain.tar")
+	err = (&Tar{}).Archive([]string{"testdata"}, tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarBytes, err := ioutil.ReadFile(tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// compress the tarball in independent chunks, like
+	// pigz and bgzip, and end with an empty member with
+	// an extra field, like the EOF marker of bgzip
+	multi := new(bytes.Buffer)
+	for chunk := 0; chunk < len(tarBytes); chunk += 4096 {
+		end := chunk + 4096
+		if end > len(tarBytes) {
+			end = len(tarBytes)
+		}
+		gzw := gzip.NewWriter(multi)
+		gzw.Write(tarBytes[chunk:end])
+		gzw.Close()
+	}
+	gzw := gzip.NewWriter(multi)
+	gzw.Extra = []byte{'B', 'C', 2, 0, 0x1b, 0}
+	gzw.Close()
+
+	source := filepath.Join(tmp, "multi.tar.gz")
+	err = ioutil.WriteFile(source, multi.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected, actual int
+	err = (&Tar{}).Walk(tarball, func(File) error {
+		expected++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&TarGz{Tar: &Tar{}}).Walk(source, func(File) error {
+		actual++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking multistream tar.gz: %v", err)
+	}
+	if actual != expected {
+		t.Errorf("expected %d files but got %d", expected, actual)
+	}
+
+	out := new(bytes.Buffer)
+	err = (&Gz{}).Decompress(bytes.NewReader(multi.Bytes()), out)
+	if err != nil {
+		t.Fatalf("decompressing multistream gzip: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), tarBytes) {
+		t.Errorf("expected %d decompressed bytes but got %d", len(tarBytes), out.Len())
+	}
+}
@@ -1,7 +1,7 @@
 package archiver
 
 import (
-	"fmt"
+	"context"
 	"io"
 	"strings"
 
@@ -28,37 +28,91 @@ type TarLz4 struct {
 func (tlz4 *TarLz4) Archive(sources []string, destination string) error {
 	if !strings.HasSuffix(destination, ".tar.lz4") &&
 		!strings.HasSuffix(destination, ".tlz4") {
-		return fmt.Errorf("output filename must have .tar.lz4 or .tlz4 extension")
+		return pathErrorf(ErrFormatMismatch, destination, "output filename must have .tar.lz4 or .tlz4 extension")
 	}
-	tlz4.wrapWriter()
-	return tlz4.Tar.Archive(sources, destination)
+	return tlz4.wrapWriter(tlz4.Tar.session()).Archive(sources, destination)
+}
+
+// ArchiveWriter writes a compressed tarball containing
+// the files listed in sources to w; see Tar.ArchiveWriter.
+func (tlz4 *TarLz4) ArchiveWriter(sources []string, w io.Writer) error {
+	return tlz4.wrapWriter(tlz4.Tar.session()).ArchiveWriter(sources, w)
+}
+
+// Update rewrites the compressed tarball at archive with
+// the entries named by the keys of replacements replaced
+// or added; see Tar.Update.
+func (tlz4 *TarLz4) Update(archive string, replacements map[string]string) error {
+	return tlz4.Tar.update(archive, newArchiveEdits(replacements, nil), tlz4.wrapReader, tlz4.wrapWriter)
+}
+
+// Remove rewrites the compressed tarball at archive without
+// the entries named in names; see Tar.Remove.
+func (tlz4 *TarLz4) Remove(archive string, names []string) error {
+	return tlz4.Tar.update(archive, newArchiveEdits(nil, names), tlz4.wrapReader, tlz4.wrapWriter)
 }
 
 // Unarchive unpacks the compressed tarball at
 // source to destination. Destination will be
 // treated as a folder name.
 func (tlz4 *TarLz4) Unarchive(source, destination string) error {
-	tlz4.wrapReader()
-	return tlz4.Tar.Unarchive(source, destination)
+	return tlz4.wrapReader(tlz4.Tar.session()).Unarchive(source, destination)
+}
+
+// UnarchiveReader unpacks the compressed tarball read
+// from in to destination, in a single pass; see
+// Tar.UnarchiveReader.
+func (tlz4 *TarLz4) UnarchiveReader(in io.Reader, destination string) error {
+	return tlz4.wrapReader(tlz4.Tar.session()).UnarchiveReader(in, destination)
 }
 
 // Walk calls walkFn for each visited item in archive.
 func (tlz4 *TarLz4) Walk(archive string, walkFn WalkFunc) error {
-	tlz4.wrapReader()
-	return tlz4.Tar.Walk(archive, walkFn)
+	return tlz4.wrapReader(tlz4.Tar.session()).Walk(archive, walkFn)
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (tlz4 *TarLz4) List(archive string) ([]EntryInfo, error) {
+	return listWalk(tlz4, archive)
+}
+
+// Validate checks the integrity of the compressed
+// tarball at archive, including the checksums of the
+// compression format; see Tar.Validate.
+func (tlz4 *TarLz4) Validate(archive string) error {
+	return tlz4.wrapReader(tlz4.Tar.session()).Validate(archive)
+}
+
+// WalkRef calls walkFn for each visited item in archive,
+// passing a File which is reused for every item.
+func (tlz4 *TarLz4) WalkRef(archive string, walkFn WalkRefFunc) error {
+	return tlz4.wrapReader(tlz4.Tar.session()).WalkRef(archive, walkFn)
+}
+
+// WalkBatches calls fn with batches of batchSize
+// items visited in archive.
+func (tlz4 *TarLz4) WalkBatches(archive string, batchSize int, fn WalkBatchFunc) error {
+	return tlz4.wrapReader(tlz4.Tar.session()).WalkBatches(archive, batchSize, fn)
+}
+
+// Sample reads the headers of n items of
+// archive chosen uniformly at random.
+func (tlz4 *TarLz4) Sample(archive string, n int) (ArchiveSample, error) {
+	return tlz4.wrapReader(tlz4.Tar.session()).Sample(archive, n)
 }
 
 // Create opens tlz4 for writing a compressed
 // tar archive to out.
 func (tlz4 *TarLz4) Create(out io.Writer) error {
-	tlz4.wrapWriter()
+	tlz4.wrapWriter(tlz4.Tar)
 	return tlz4.Tar.Create(out)
 }
 
 // Open opens t for reading a compressed archive from
 // in. The size parameter is not used.
 func (tlz4 *TarLz4) Open(in io.Reader, size int64) error {
-	tlz4.wrapReader()
+	tlz4.wrapReader(tlz4.Tar)
 	return tlz4.Tar.Open(in, size)
 }
 
@@ -66,26 +120,50 @@ func (tlz4 *TarLz4) Open(in io.Reader, size int64) error {
 // If the target is a directory, the entire folder will
 // be extracted into destination.
 func (tlz4 *TarLz4) Extract(source, target, destination string) error {
-	tlz4.wrapReader()
-	return tlz4.Tar.Extract(source, target, destination)
+	return tlz4.wrapReader(tlz4.Tar.session()).Extract(source, target, destination)
+}
+
+// ExtractGlob extracts the files and folders in the
+// compressed tarball at source whose paths match
+// pattern to destination; see Tar.ExtractGlob.
+func (tlz4 *TarLz4) ExtractGlob(source, pattern, destination string) error {
+	return tlz4.wrapReader(tlz4.Tar.session()).ExtractGlob(source, pattern, destination)
 }
 
-func (tlz4 *TarLz4) wrapWriter() {
+func (tlz4 *TarLz4) wrapWriter(t *Tar) *Tar {
 	var lz4w *lz4.Writer
-	tlz4.Tar.writerWrapFn = func(w io.Writer) (io.Writer, error) {
+	t.writerWrapFn = func(w io.Writer) (io.Writer, error) {
 		lz4w = lz4.NewWriter(w)
 		lz4w.Header.CompressionLevel = tlz4.CompressionLevel
 		return lz4w, nil
 	}
-	tlz4.Tar.cleanupWrapFn = func() {
+	t.cleanupWrapFn = func() {
 		lz4w.Close()
 	}
+	return t
 }
 
-func (tlz4 *TarLz4) wrapReader() {
-	tlz4.Tar.readerWrapFn = func(r io.Reader) (io.Reader, error) {
+func (tlz4 *TarLz4) wrapReader(t *Tar) *Tar {
+	t.readerWrapFn = func(r io.Reader) (io.Reader, error) {
 		return lz4.NewReader(r), nil
 	}
+	return t
+}
+
+// Clone returns a copy of tlz4 with a clone of its Tar,
+// which can be changed without changing tlz4.
+func (tlz4 *TarLz4) Clone() *TarLz4 {
+	c := *tlz4
+	c.Tar = tlz4.Tar.Clone()
+	return &c
+}
+
+// withContext returns a copy of tlz4 whose Tar is a
+// session which checks ctx; see Tar.withContext.
+func (tlz4 *TarLz4) withContext(ctx context.Context) interface{} {
+	c := *tlz4
+	c.Tar = tlz4.Tar.withContext(ctx).(*Tar)
+	return &c
 }
 
 func (tlz4 *TarLz4) String() string { return "tar.lz4" }
@@ -95,13 +173,35 @@ var (
 	_ = Reader(new(TarLz4))
 	_ = Writer(new(TarLz4))
 	_ = Archiver(new(TarLz4))
+	_ = WriterArchiver(new(TarLz4))
+	_ = Updater(new(TarLz4))
+	_ = Remover(new(TarLz4))
 	_ = Unarchiver(new(TarLz4))
+	_ = ReaderUnarchiver(new(TarLz4))
 	_ = Walker(new(TarLz4))
+	_ = Lister(new(TarLz4))
+	_ = Validator(new(TarLz4))
+	_ = ResultReporter(new(TarLz4))
+	_ = ManifestReporter(new(TarLz4))
+	_ = SignatureReporter(new(TarLz4))
+	_ = RefWalker(new(TarLz4))
+	_ = BatchWalker(new(TarLz4))
+	_ = Sampler(new(TarLz4))
 	_ = Extractor(new(TarLz4))
+	_ = GlobExtractor(new(TarLz4))
 )
 
 // DefaultTarLz4 is a convenient archiver ready to use.
 var DefaultTarLz4 = &TarLz4{
 	CompressionLevel: 9, // https://github.com/lz4/lz4/blob/1b819bfd633ae285df2dfe1b0589e1ec064f2873/lib/lz4hc.h#L48
-	Tar:              DefaultTar,
+	Tar:              DefaultTar.Clone(),
+}
+
+// NewTarLz4 returns a new TarLz4 configured by opts;
+// unless they set the level, it compresses at the
+// level of DefaultTarLz4.
+func NewTarLz4(opts ...Option) *TarLz4 {
+	tlz4 := &TarLz4{CompressionLevel: DefaultTarLz4.CompressionLevel, Tar: new(Tar)}
+	applyOptions(opts, tlz4.Tar, tlz4)
+	return tlz4
 }
@@ -0,0 +1,203 @@
+package archiver
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// TarLzma facilitates LZMA compression of tarball
+// archives, in the legacy .lzma ("LZMA alone") format
+// which predates xz. New archives should use TarXz;
+// this is mainly for reading old tarballs.
+type TarLzma struct {
+	*Tar
+}
+
+// Archive creates a compressed tar file at destination
+// containing the files listed in sources. The destination
+// must end with ".tar.lzma" or ".tlz". File paths can be
+// those of regular files or directories; directories will
+// be recursively added.
+func (tlz *TarLzma) Archive(sources []string, destination string) error {
+	if !strings.HasSuffix(destination, ".tar.lzma") &&
+		!strings.HasSuffix(destination, ".tlz") {
+		return pathErrorf(ErrFormatMismatch, destination, "output filename must have .tar.lzma or .tlz extension")
+	}
+	return tlz.wrapWriter(tlz.Tar.session()).Archive(sources, destination)
+}
+
+// ArchiveWriter writes a compressed tarball containing
+// the files listed in sources to w; see Tar.ArchiveWriter.
+func (tlz *TarLzma) ArchiveWriter(sources []string, w io.Writer) error {
+	return tlz.wrapWriter(tlz.Tar.session()).ArchiveWriter(sources, w)
+}
+
+// Update rewrites the compressed tarball at archive with
+// the entries named by the keys of replacements replaced
+// or added; see Tar.Update.
+func (tlz *TarLzma) Update(archive string, replacements map[string]string) error {
+	return tlz.Tar.update(archive, newArchiveEdits(replacements, nil), tlz.wrapReader, tlz.wrapWriter)
+}
+
+// Remove rewrites the compressed tarball at archive without
+// the entries named in names; see Tar.Remove.
+func (tlz *TarLzma) Remove(archive string, names []string) error {
+	return tlz.Tar.update(archive, newArchiveEdits(nil, names), tlz.wrapReader, tlz.wrapWriter)
+}
+
+// Unarchive unpacks the compressed tarball at
+// source to destination. Destination will be
+// treated as a folder name.
+func (tlz *TarLzma) Unarchive(source, destination string) error {
+	return tlz.wrapReader(tlz.Tar.session()).Unarchive(source, destination)
+}
+
+// UnarchiveReader unpacks the compressed tarball read
+// from in to destination, in a single pass; see
+// Tar.UnarchiveReader.
+func (tlz *TarLzma) UnarchiveReader(in io.Reader, destination string) error {
+	return tlz.wrapReader(tlz.Tar.session()).UnarchiveReader(in, destination)
+}
+
+// Walk calls walkFn for each visited item in archive.
+func (tlz *TarLzma) Walk(archive string, walkFn WalkFunc) error {
+	return tlz.wrapReader(tlz.Tar.session()).Walk(archive, walkFn)
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (tlz *TarLzma) List(archive string) ([]EntryInfo, error) {
+	return listWalk(tlz, archive)
+}
+
+// Validate checks the integrity of the compressed
+// tarball at archive, including the checksums of the
+// compression format; see Tar.Validate.
+func (tlz *TarLzma) Validate(archive string) error {
+	return tlz.wrapReader(tlz.Tar.session()).Validate(archive)
+}
+
+// WalkRef calls walkFn for each visited item in archive,
+// passing a File which is reused for every item.
+func (tlz *TarLzma) WalkRef(archive string, walkFn WalkRefFunc) error {
+	return tlz.wrapReader(tlz.Tar.session()).WalkRef(archive, walkFn)
+}
+
+// WalkBatches calls fn with batches of batchSize
+// items visited in archive.
+func (tlz *TarLzma) WalkBatches(archive string, batchSize int, fn WalkBatchFunc) error {
+	return tlz.wrapReader(tlz.Tar.session()).WalkBatches(archive, batchSize, fn)
+}
+
+// Sample reads the headers of n items of
+// archive chosen uniformly at random.
+func (tlz *TarLzma) Sample(archive string, n int) (ArchiveSample, error) {
+	return tlz.wrapReader(tlz.Tar.session()).Sample(archive, n)
+}
+
+// Create opens tlz for writing a compressed
+// tar archive to out.
+func (tlz *TarLzma) Create(out io.Writer) error {
+	tlz.wrapWriter(tlz.Tar)
+	return tlz.Tar.Create(out)
+}
+
+// Open opens t for reading a compressed archive from
+// in. The size parameter is not used.
+func (tlz *TarLzma) Open(in io.Reader, size int64) error {
+	tlz.wrapReader(tlz.Tar)
+	return tlz.Tar.Open(in, size)
+}
+
+// Extract extracts a single file from the tar archive.
+// If the target is a directory, the entire folder will
+// be extracted into destination.
+func (tlz *TarLzma) Extract(source, target, destination string) error {
+	return tlz.wrapReader(tlz.Tar.session()).Extract(source, target, destination)
+}
+
+// ExtractGlob extracts the files and folders in the
+// compressed tarball at source whose paths match
+// pattern to destination; see Tar.ExtractGlob.
+func (tlz *TarLzma) ExtractGlob(source, pattern, destination string) error {
+	return tlz.wrapReader(tlz.Tar.session()).ExtractGlob(source, pattern, destination)
+}
+
+func (tlz *TarLzma) wrapWriter(t *Tar) *Tar {
+	var lw *lzma.Writer
+	t.writerWrapFn = func(w io.Writer) (io.Writer, error) {
+		var err error
+		lw, err = lzma.NewWriter(w)
+		return lw, err
+	}
+	t.cleanupWrapFn = func() {
+		if lw != nil {
+			lw.Close()
+			lw = nil
+		}
+	}
+	return t
+}
+
+func (tlz *TarLzma) wrapReader(t *Tar) *Tar {
+	t.readerWrapFn = func(r io.Reader) (io.Reader, error) {
+		return lzma.NewReader(r)
+	}
+	return t
+}
+
+// Clone returns a copy of tlz with a clone of its Tar,
+// which can be changed without changing tlz.
+func (tlz *TarLzma) Clone() *TarLzma {
+	c := *tlz
+	c.Tar = tlz.Tar.Clone()
+	return &c
+}
+
+// withContext returns a copy of tlz whose Tar is a
+// session which checks ctx; see Tar.withContext.
+func (tlz *TarLzma) withContext(ctx context.Context) interface{} {
+	c := *tlz
+	c.Tar = tlz.Tar.withContext(ctx).(*Tar)
+	return &c
+}
+
+func (tlz *TarLzma) String() string { return "tar.lzma" }
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = Reader(new(TarLzma))
+	_ = Writer(new(TarLzma))
+	_ = Archiver(new(TarLzma))
+	_ = WriterArchiver(new(TarLzma))
+	_ = Updater(new(TarLzma))
+	_ = Remover(new(TarLzma))
+	_ = Unarchiver(new(TarLzma))
+	_ = ReaderUnarchiver(new(TarLzma))
+	_ = Walker(new(TarLzma))
+	_ = Lister(new(TarLzma))
+	_ = Validator(new(TarLzma))
+	_ = ResultReporter(new(TarLzma))
+	_ = ManifestReporter(new(TarLzma))
+	_ = SignatureReporter(new(TarLzma))
+	_ = RefWalker(new(TarLzma))
+	_ = BatchWalker(new(TarLzma))
+	_ = Sampler(new(TarLzma))
+	_ = Extractor(new(TarLzma))
+	_ = GlobExtractor(new(TarLzma))
+)
+
+// DefaultTarLzma is a convenient archiver ready to use.
+var DefaultTarLzma = &TarLzma{
+	Tar: DefaultTar.Clone(),
+}
+
+// NewTarLzma returns a new TarLzma configured by opts.
+func NewTarLzma(opts ...Option) *TarLzma {
+	tlz := &TarLzma{Tar: new(Tar)}
+	applyOptions(opts, tlz.Tar, tlz)
+	return tlz
+}
@@ -1,7 +1,7 @@
 package archiver
 
 import (
-	"fmt"
+	"context"
 	"io"
 	"strings"
 
@@ -23,37 +23,91 @@ type TarSz struct {
 func (tsz *TarSz) Archive(sources []string, destination string) error {
 	if !strings.HasSuffix(destination, ".tar.sz") &&
 		!strings.HasSuffix(destination, ".tsz") {
-		return fmt.Errorf("output filename must have .tar.sz or .tsz extension")
+		return pathErrorf(ErrFormatMismatch, destination, "output filename must have .tar.sz or .tsz extension")
 	}
-	tsz.wrapWriter()
-	return tsz.Tar.Archive(sources, destination)
+	return tsz.wrapWriter(tsz.Tar.session()).Archive(sources, destination)
+}
+
+// ArchiveWriter writes a compressed tarball containing
+// the files listed in sources to w; see Tar.ArchiveWriter.
+func (tsz *TarSz) ArchiveWriter(sources []string, w io.Writer) error {
+	return tsz.wrapWriter(tsz.Tar.session()).ArchiveWriter(sources, w)
+}
+
+// Update rewrites the compressed tarball at archive with
+// the entries named by the keys of replacements replaced
+// or added; see Tar.Update.
+func (tsz *TarSz) Update(archive string, replacements map[string]string) error {
+	return tsz.Tar.update(archive, newArchiveEdits(replacements, nil), tsz.wrapReader, tsz.wrapWriter)
+}
+
+// Remove rewrites the compressed tarball at archive without
+// the entries named in names; see Tar.Remove.
+func (tsz *TarSz) Remove(archive string, names []string) error {
+	return tsz.Tar.update(archive, newArchiveEdits(nil, names), tsz.wrapReader, tsz.wrapWriter)
 }
 
 // Unarchive unpacks the compressed tarball at
 // source to destination. Destination will be
 // treated as a folder name.
 func (tsz *TarSz) Unarchive(source, destination string) error {
-	tsz.wrapReader()
-	return tsz.Tar.Unarchive(source, destination)
+	return tsz.wrapReader(tsz.Tar.session()).Unarchive(source, destination)
+}
+
+// UnarchiveReader unpacks the compressed tarball read
+// from in to destination, in a single pass; see
+// Tar.UnarchiveReader.
+func (tsz *TarSz) UnarchiveReader(in io.Reader, destination string) error {
+	return tsz.wrapReader(tsz.Tar.session()).UnarchiveReader(in, destination)
 }
 
 // Walk calls walkFn for each visited item in archive.
 func (tsz *TarSz) Walk(archive string, walkFn WalkFunc) error {
-	tsz.wrapReader()
-	return tsz.Tar.Walk(archive, walkFn)
+	return tsz.wrapReader(tsz.Tar.session()).Walk(archive, walkFn)
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (tsz *TarSz) List(archive string) ([]EntryInfo, error) {
+	return listWalk(tsz, archive)
+}
+
+// Validate checks the integrity of the compressed
+// tarball at archive, including the checksums of the
+// compression format; see Tar.Validate.
+func (tsz *TarSz) Validate(archive string) error {
+	return tsz.wrapReader(tsz.Tar.session()).Validate(archive)
+}
+
+// WalkRef calls walkFn for each visited item in archive,
+// passing a File which is reused for every item.
+func (tsz *TarSz) WalkRef(archive string, walkFn WalkRefFunc) error {
+	return tsz.wrapReader(tsz.Tar.session()).WalkRef(archive, walkFn)
+}
+
+// WalkBatches calls fn with batches of batchSize
+// items visited in archive.
+func (tsz *TarSz) WalkBatches(archive string, batchSize int, fn WalkBatchFunc) error {
+	return tsz.wrapReader(tsz.Tar.session()).WalkBatches(archive, batchSize, fn)
+}
+
+// Sample reads the headers of n items of
+// archive chosen uniformly at random.
+func (tsz *TarSz) Sample(archive string, n int) (ArchiveSample, error) {
+	return tsz.wrapReader(tsz.Tar.session()).Sample(archive, n)
 }
 
 // Create opens tsz for writing a compressed
 // tar archive to out.
 func (tsz *TarSz) Create(out io.Writer) error {
-	tsz.wrapWriter()
+	tsz.wrapWriter(tsz.Tar)
 	return tsz.Tar.Create(out)
 }
 
 // Open opens t for reading a compressed archive from
 // in. The size parameter is not used.
 func (tsz *TarSz) Open(in io.Reader, size int64) error {
-	tsz.wrapReader()
+	tsz.wrapReader(tsz.Tar)
 	return tsz.Tar.Open(in, size)
 }
 
@@ -61,25 +115,49 @@ func (tsz *TarSz) Open(in io.Reader, size int64) error {
 // If the target is a directory, the entire folder will
 // be extracted into destination.
 func (tsz *TarSz) Extract(source, target, destination string) error {
-	tsz.wrapReader()
-	return tsz.Tar.Extract(source, target, destination)
+	return tsz.wrapReader(tsz.Tar.session()).Extract(source, target, destination)
+}
+
+// ExtractGlob extracts the files and folders in the
+// compressed tarball at source whose paths match
+// pattern to destination; see Tar.ExtractGlob.
+func (tsz *TarSz) ExtractGlob(source, pattern, destination string) error {
+	return tsz.wrapReader(tsz.Tar.session()).ExtractGlob(source, pattern, destination)
 }
 
-func (tsz *TarSz) wrapWriter() {
+func (tsz *TarSz) wrapWriter(t *Tar) *Tar {
 	var sw *snappy.Writer
-	tsz.Tar.writerWrapFn = func(w io.Writer) (io.Writer, error) {
+	t.writerWrapFn = func(w io.Writer) (io.Writer, error) {
 		sw = snappy.NewWriter(w)
 		return sw, nil
 	}
-	tsz.Tar.cleanupWrapFn = func() {
+	t.cleanupWrapFn = func() {
 		sw.Close()
 	}
+	return t
 }
 
-func (tsz *TarSz) wrapReader() {
-	tsz.Tar.readerWrapFn = func(r io.Reader) (io.Reader, error) {
+func (tsz *TarSz) wrapReader(t *Tar) *Tar {
+	t.readerWrapFn = func(r io.Reader) (io.Reader, error) {
 		return snappy.NewReader(r), nil
 	}
+	return t
+}
+
+// Clone returns a copy of tsz with a clone of its Tar,
+// which can be changed without changing tsz.
+func (tsz *TarSz) Clone() *TarSz {
+	c := *tsz
+	c.Tar = tsz.Tar.Clone()
+	return &c
+}
+
+// withContext returns a copy of tsz whose Tar is a
+// session which checks ctx; see Tar.withContext.
+func (tsz *TarSz) withContext(ctx context.Context) interface{} {
+	c := *tsz
+	c.Tar = tsz.Tar.withContext(ctx).(*Tar)
+	return &c
 }
 
 func (tsz *TarSz) String() string { return "tar.sz" }
@@ -89,12 +167,32 @@ var (
 	_ = Reader(new(TarSz))
 	_ = Writer(new(TarSz))
 	_ = Archiver(new(TarSz))
+	_ = WriterArchiver(new(TarSz))
+	_ = Updater(new(TarSz))
+	_ = Remover(new(TarSz))
 	_ = Unarchiver(new(TarSz))
+	_ = ReaderUnarchiver(new(TarSz))
 	_ = Walker(new(TarSz))
+	_ = Lister(new(TarSz))
+	_ = Validator(new(TarSz))
+	_ = ResultReporter(new(TarSz))
+	_ = ManifestReporter(new(TarSz))
+	_ = SignatureReporter(new(TarSz))
+	_ = RefWalker(new(TarSz))
+	_ = BatchWalker(new(TarSz))
+	_ = Sampler(new(TarSz))
 	_ = Extractor(new(TarSz))
+	_ = GlobExtractor(new(TarSz))
 )
 
 // DefaultTarSz is a convenient archiver ready to use.
 var DefaultTarSz = &TarSz{
-	Tar: DefaultTar,
+	Tar: DefaultTar.Clone(),
+}
+
+// NewTarSz returns a new TarSz configured by opts.
+func NewTarSz(opts ...Option) *TarSz {
+	tsz := &TarSz{Tar: new(Tar)}
+	applyOptions(opts, tsz.Tar, tsz)
+	return tsz
 }
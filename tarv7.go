@@ -0,0 +1,157 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// legacyTarReader returns a reader of the tarball read
+// from in, whose V7 headers with non-standard checksums
+// are fixed, if the tarball is a V7 tarball; otherwise,
+// it returns a reader of in unchanged.
+//
+// Tarballs in the pre-POSIX format of Version 7 Unix (V7)
+// have no magic number, and the tools which made them did
+// not agree on how to compute header checksums: some
+// counted the checksum field as zeros instead of spaces,
+// and some left it blank. The archive/tar package rejects
+// such headers, so the headers of V7 tarballs are checked
+// as they are read and, if their checksum is one of these
+// variants, it is replaced with the standard checksum.
+func legacyTarReader(in io.Reader) io.Reader {
+	block := make([]byte, tarBlockSize)
+	n, err := io.ReadFull(in, block)
+	block = block[:n]
+
+	// put back what was read, seeking back if possible
+	// so that archive/tar can still skip file contents
+	// by seeking
+	var rest io.Reader = io.MultiReader(bytes.NewReader(block), in)
+	if rs, ok := in.(io.Seeker); ok && n > 0 {
+		if _, serr := rs.Seek(int64(-n), io.SeekCurrent); serr == nil {
+			rest = in
+		}
+	}
+	if err != nil || !isV7Header(block) {
+		return rest
+	}
+	return &v7HeaderFixer{r: rest}
+}
+
+// isV7Header returns true if block, which is a header
+// block, has no magic number and so is in V7 format.
+func isV7Header(block []byte) bool {
+	if isZeros(block) {
+		return false
+	}
+	magic := block[257:265]
+	return isZeros(magic) || !bytes.HasPrefix(magic, []byte("ustar"))
+}
+
+// v7HeaderFixer reads a V7 tarball, fixing the
+// checksums of its headers where necessary.
+type v7HeaderFixer struct {
+	r         io.Reader
+	block     [tarBlockSize]byte
+	pending   []byte // rest of the current header block
+	remaining int64  // bytes of contents until the next header
+	done      bool   // if a non-V7 header was seen
+}
+
+func (f *v7HeaderFixer) Read(p []byte) (int, error) {
+	if len(f.pending) > 0 {
+		n := copy(p, f.pending)
+		f.pending = f.pending[n:]
+		return n, nil
+	}
+	if f.done {
+		return f.r.Read(p)
+	}
+	if f.remaining > 0 {
+		if int64(len(p)) > f.remaining {
+			p = p[:f.remaining]
+		}
+		n, err := f.r.Read(p)
+		f.remaining -= int64(n)
+		return n, err
+	}
+
+	// at the start of a header block
+	n, err := io.ReadFull(f.r, f.block[:])
+	if err != nil {
+		f.pending = f.block[:n]
+		if n == 0 {
+			return 0, err
+		}
+		f.done = true // let archive/tar deal with the short block
+		return f.Read(p)
+	}
+	header := f.block[:]
+	if !isZeros(header) {
+		if !isV7Header(header) {
+			// the header of a format which is not V7; since
+			// its contents are not simple to find (they may
+			// be described by the preceding header, for
+			// example), stop looking at headers
+			f.done = true
+		} else {
+			fixV7Checksum(header)
+			f.remaining = v7ContentsSize(header)
+		}
+	}
+	f.pending = header
+	return f.Read(p)
+}
+
+// fixV7Checksum replaces the checksum of the V7 header
+// block with the standard checksum, if its checksum was
+// computed in one of the non-standard ways, or left
+// blank. Other checksums are left for archive/tar
+// to check.
+func fixV7Checksum(header []byte) {
+	field := header[148:156]
+	stored := strings.Trim(string(field), " \x00")
+	unsigned, signed := tarChecksums(header, ' ')
+	if stored != "" {
+		sum, err := strconv.ParseInt(stored, 8, 64)
+		if err != nil || sum == unsigned || sum == signed {
+			return // invalid, or already standard
+		}
+		zerosUnsigned, zerosSigned := tarChecksums(header, 0)
+		if sum != zerosUnsigned && sum != zerosSigned {
+			return
+		}
+	}
+	copy(field, fmt.Sprintf("%06o\x00 ", unsigned))
+}
+
+// tarChecksums returns the unsigned and signed sums
+// of the bytes of header, counting the bytes of the
+// checksum field as fill.
+func tarChecksums(header []byte, fill byte) (unsigned, signed int64) {
+	for i, b := range header {
+		if i >= 148 && i < 156 {
+			b = fill
+		}
+		unsigned += int64(b)
+		signed += int64(int8(b))
+	}
+	return unsigned, signed
+}
+
+// v7ContentsSize returns the number of bytes, including
+// padding, of the contents which follow the V7 header.
+func v7ContentsSize(header []byte) int64 {
+	switch header[156] {
+	case '1', '2', '3', '4', '5', '6':
+		return 0 // links, devices, directories and FIFOs have no contents
+	}
+	size, err := strconv.ParseInt(strings.Trim(string(header[124:136]), " \x00"), 8, 64)
+	if err != nil || size < 0 {
+		return 0 // invalid; archive/tar will reject the header
+	}
+	return (size + tarBlockSize - 1) / tarBlockSize * tarBlockSize
+}
@@ -1,7 +1,7 @@
 package archiver
 
 import (
-	"fmt"
+	"context"
 	"io"
 	"strings"
 
@@ -24,37 +24,91 @@ type TarXz struct {
 func (txz *TarXz) Archive(sources []string, destination string) error {
 	if !strings.HasSuffix(destination, ".tar.xz") &&
 		!strings.HasSuffix(destination, ".txz") {
-		return fmt.Errorf("output filename must have .tar.xz or .txz extension")
+		return pathErrorf(ErrFormatMismatch, destination, "output filename must have .tar.xz or .txz extension")
 	}
-	txz.wrapWriter()
-	return txz.Tar.Archive(sources, destination)
+	return txz.wrapWriter(txz.Tar.session()).Archive(sources, destination)
+}
+
+// ArchiveWriter writes a compressed tarball containing
+// the files listed in sources to w; see Tar.ArchiveWriter.
+func (txz *TarXz) ArchiveWriter(sources []string, w io.Writer) error {
+	return txz.wrapWriter(txz.Tar.session()).ArchiveWriter(sources, w)
+}
+
+// Update rewrites the compressed tarball at archive with
+// the entries named by the keys of replacements replaced
+// or added; see Tar.Update.
+func (txz *TarXz) Update(archive string, replacements map[string]string) error {
+	return txz.Tar.update(archive, newArchiveEdits(replacements, nil), txz.wrapReader, txz.wrapWriter)
+}
+
+// Remove rewrites the compressed tarball at archive without
+// the entries named in names; see Tar.Remove.
+func (txz *TarXz) Remove(archive string, names []string) error {
+	return txz.Tar.update(archive, newArchiveEdits(nil, names), txz.wrapReader, txz.wrapWriter)
 }
 
 // Unarchive unpacks the compressed tarball at
 // source to destination. Destination will be
 // treated as a folder name.
 func (txz *TarXz) Unarchive(source, destination string) error {
-	txz.wrapReader()
-	return txz.Tar.Unarchive(source, destination)
+	return txz.wrapReader(txz.Tar.session()).Unarchive(source, destination)
+}
+
+// UnarchiveReader unpacks the compressed tarball read
+// from in to destination, in a single pass; see
+// Tar.UnarchiveReader.
+func (txz *TarXz) UnarchiveReader(in io.Reader, destination string) error {
+	return txz.wrapReader(txz.Tar.session()).UnarchiveReader(in, destination)
 }
 
 // Walk calls walkFn for each visited item in archive.
 func (txz *TarXz) Walk(archive string, walkFn WalkFunc) error {
-	txz.wrapReader()
-	return txz.Tar.Walk(archive, walkFn)
+	return txz.wrapReader(txz.Tar.session()).Walk(archive, walkFn)
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (txz *TarXz) List(archive string) ([]EntryInfo, error) {
+	return listWalk(txz, archive)
+}
+
+// Validate checks the integrity of the compressed
+// tarball at archive, including the checksums of the
+// compression format; see Tar.Validate.
+func (txz *TarXz) Validate(archive string) error {
+	return txz.wrapReader(txz.Tar.session()).Validate(archive)
+}
+
+// WalkRef calls walkFn for each visited item in archive,
+// passing a File which is reused for every item.
+func (txz *TarXz) WalkRef(archive string, walkFn WalkRefFunc) error {
+	return txz.wrapReader(txz.Tar.session()).WalkRef(archive, walkFn)
+}
+
+// WalkBatches calls fn with batches of batchSize
+// items visited in archive.
+func (txz *TarXz) WalkBatches(archive string, batchSize int, fn WalkBatchFunc) error {
+	return txz.wrapReader(txz.Tar.session()).WalkBatches(archive, batchSize, fn)
+}
+
+// Sample reads the headers of n items of
+// archive chosen uniformly at random.
+func (txz *TarXz) Sample(archive string, n int) (ArchiveSample, error) {
+	return txz.wrapReader(txz.Tar.session()).Sample(archive, n)
 }
 
 // Create opens txz for writing a compressed
 // tar archive to out.
 func (txz *TarXz) Create(out io.Writer) error {
-	txz.wrapWriter()
+	txz.wrapWriter(txz.Tar)
 	return txz.Tar.Create(out)
 }
 
 // Open opens t for reading a compressed archive from
 // in. The size parameter is not used.
 func (txz *TarXz) Open(in io.Reader, size int64) error {
-	txz.wrapReader()
+	txz.wrapReader(txz.Tar)
 	return txz.Tar.Open(in, size)
 }
 
@@ -62,29 +116,53 @@ func (txz *TarXz) Open(in io.Reader, size int64) error {
 // If the target is a directory, the entire folder will
 // be extracted into destination.
 func (txz *TarXz) Extract(source, target, destination string) error {
-	txz.wrapReader()
-	return txz.Tar.Extract(source, target, destination)
+	return txz.wrapReader(txz.Tar.session()).Extract(source, target, destination)
+}
+
+// ExtractGlob extracts the files and folders in the
+// compressed tarball at source whose paths match
+// pattern to destination; see Tar.ExtractGlob.
+func (txz *TarXz) ExtractGlob(source, pattern, destination string) error {
+	return txz.wrapReader(txz.Tar.session()).ExtractGlob(source, pattern, destination)
 }
 
-func (txz *TarXz) wrapWriter() {
+func (txz *TarXz) wrapWriter(t *Tar) *Tar {
 	var xzw *xz.Writer
-	txz.Tar.writerWrapFn = func(w io.Writer) (io.Writer, error) {
+	t.writerWrapFn = func(w io.Writer) (io.Writer, error) {
 		var err error
 		xzw, err = xz.NewWriter(w)
 		return xzw, err
 	}
-	txz.Tar.cleanupWrapFn = func() {
+	t.cleanupWrapFn = func() {
 		xzw.Close()
 	}
+	return t
 }
 
-func (txz *TarXz) wrapReader() {
+func (txz *TarXz) wrapReader(t *Tar) *Tar {
 	var xzr *fastxz.Reader
-	txz.Tar.readerWrapFn = func(r io.Reader) (io.Reader, error) {
+	t.readerWrapFn = func(r io.Reader) (io.Reader, error) {
 		var err error
 		xzr, err = fastxz.NewReader(r, 0)
 		return xzr, err
 	}
+	return t
+}
+
+// Clone returns a copy of txz with a clone of its Tar,
+// which can be changed without changing txz.
+func (txz *TarXz) Clone() *TarXz {
+	c := *txz
+	c.Tar = txz.Tar.Clone()
+	return &c
+}
+
+// withContext returns a copy of txz whose Tar is a
+// session which checks ctx; see Tar.withContext.
+func (txz *TarXz) withContext(ctx context.Context) interface{} {
+	c := *txz
+	c.Tar = txz.Tar.withContext(ctx).(*Tar)
+	return &c
 }
 
 func (txz *TarXz) String() string { return "tar.xz" }
@@ -94,12 +172,32 @@ var (
 	_ = Reader(new(TarXz))
 	_ = Writer(new(TarXz))
 	_ = Archiver(new(TarXz))
+	_ = WriterArchiver(new(TarXz))
+	_ = Updater(new(TarXz))
+	_ = Remover(new(TarXz))
 	_ = Unarchiver(new(TarXz))
+	_ = ReaderUnarchiver(new(TarXz))
 	_ = Walker(new(TarXz))
+	_ = Lister(new(TarXz))
+	_ = Validator(new(TarXz))
+	_ = ResultReporter(new(TarXz))
+	_ = ManifestReporter(new(TarXz))
+	_ = SignatureReporter(new(TarXz))
+	_ = RefWalker(new(TarXz))
+	_ = BatchWalker(new(TarXz))
+	_ = Sampler(new(TarXz))
 	_ = Extractor(new(TarXz))
+	_ = GlobExtractor(new(TarXz))
 )
 
 // DefaultTarXz is a convenient archiver ready to use.
 var DefaultTarXz = &TarXz{
-	Tar: DefaultTar,
+	Tar: DefaultTar.Clone(),
+}
+
+// NewTarXz returns a new TarXz configured by opts.
+func NewTarXz(opts ...Option) *TarXz {
+	txz := &TarXz{Tar: new(Tar)}
+	applyOptions(opts, txz.Tar, txz)
+	return txz
 }
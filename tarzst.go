@@ -0,0 +1,258 @@
+package archiver
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// TarZst facilitates Zstandard compression
+// (RFC 8478) of tarball archives.
+type TarZst struct {
+	*Tar
+
+	// The encoder level to use when writing;
+	// if not set, zstd.SpeedDefault is used.
+	EncoderLevel zstd.EncoderLevel
+
+	// If set, the tarball is written in the zstd seekable
+	// format: it is compressed in independent frames of
+	// this many uncompressed bytes, followed by an index
+	// of the frames in a skippable frame, which allows
+	// consumers that support the format to access parts
+	// of the tarball without decompressing all of it.
+	// Regular zstd decoders read the output as usual.
+	// Smaller frames allow finer access, but compress
+	// worse; a few megabytes is typical.
+	SeekableFrameSize int
+
+	// A dictionary to compress with, and to decompress
+	// tarballs compressed with it, in the zstd dictionary
+	// format (see TrainZstdDict). Tarballs compressed
+	// with a dictionary can only be decompressed with
+	// the same dictionary.
+	Dictionary []byte
+}
+
+// Archive creates a compressed tar file at destination
+// containing the files listed in sources. The destination
+// must end with ".tar.zst" or ".tzst". File paths can be
+// those of regular files or directories; directories will
+// be recursively added.
+func (tzst *TarZst) Archive(sources []string, destination string) error {
+	if !strings.HasSuffix(destination, ".tar.zst") &&
+		!strings.HasSuffix(destination, ".tzst") {
+		return pathErrorf(ErrFormatMismatch, destination, "output filename must have .tar.zst or .tzst extension")
+	}
+	return tzst.wrapWriter(tzst.Tar.session()).Archive(sources, destination)
+}
+
+// ArchiveWriter writes a compressed tarball containing
+// the files listed in sources to w; see Tar.ArchiveWriter.
+func (tzst *TarZst) ArchiveWriter(sources []string, w io.Writer) error {
+	return tzst.wrapWriter(tzst.Tar.session()).ArchiveWriter(sources, w)
+}
+
+// Update rewrites the compressed tarball at archive with
+// the entries named by the keys of replacements replaced
+// or added; see Tar.Update.
+func (tzst *TarZst) Update(archive string, replacements map[string]string) error {
+	return tzst.Tar.update(archive, newArchiveEdits(replacements, nil), tzst.wrapReader, tzst.wrapWriter)
+}
+
+// Remove rewrites the compressed tarball at archive without
+// the entries named in names; see Tar.Remove.
+func (tzst *TarZst) Remove(archive string, names []string) error {
+	return tzst.Tar.update(archive, newArchiveEdits(nil, names), tzst.wrapReader, tzst.wrapWriter)
+}
+
+// Unarchive unpacks the compressed tarball at
+// source to destination. Destination will be
+// treated as a folder name.
+func (tzst *TarZst) Unarchive(source, destination string) error {
+	return tzst.wrapReader(tzst.Tar.session()).Unarchive(source, destination)
+}
+
+// UnarchiveReader unpacks the compressed tarball read
+// from in to destination, in a single pass; see
+// Tar.UnarchiveReader.
+func (tzst *TarZst) UnarchiveReader(in io.Reader, destination string) error {
+	return tzst.wrapReader(tzst.Tar.session()).UnarchiveReader(in, destination)
+}
+
+// Walk calls walkFn for each visited item in archive.
+func (tzst *TarZst) Walk(archive string, walkFn WalkFunc) error {
+	return tzst.wrapReader(tzst.Tar.session()).Walk(archive, walkFn)
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (tzst *TarZst) List(archive string) ([]EntryInfo, error) {
+	return listWalk(tzst, archive)
+}
+
+// Validate checks the integrity of the compressed
+// tarball at archive, including the checksums of the
+// compression format; see Tar.Validate.
+func (tzst *TarZst) Validate(archive string) error {
+	return tzst.wrapReader(tzst.Tar.session()).Validate(archive)
+}
+
+// WalkRef calls walkFn for each visited item in archive,
+// passing a File which is reused for every item.
+func (tzst *TarZst) WalkRef(archive string, walkFn WalkRefFunc) error {
+	return tzst.wrapReader(tzst.Tar.session()).WalkRef(archive, walkFn)
+}
+
+// WalkBatches calls fn with batches of batchSize
+// items visited in archive.
+func (tzst *TarZst) WalkBatches(archive string, batchSize int, fn WalkBatchFunc) error {
+	return tzst.wrapReader(tzst.Tar.session()).WalkBatches(archive, batchSize, fn)
+}
+
+// Sample reads the headers of n items of
+// archive chosen uniformly at random.
+func (tzst *TarZst) Sample(archive string, n int) (ArchiveSample, error) {
+	return tzst.wrapReader(tzst.Tar.session()).Sample(archive, n)
+}
+
+// Create opens tzst for writing a compressed
+// tar archive to out.
+func (tzst *TarZst) Create(out io.Writer) error {
+	tzst.wrapWriter(tzst.Tar)
+	return tzst.Tar.Create(out)
+}
+
+// Open opens t for reading a compressed archive from
+// in. The size parameter is not used.
+func (tzst *TarZst) Open(in io.Reader, size int64) error {
+	tzst.wrapReader(tzst.Tar)
+	return tzst.Tar.Open(in, size)
+}
+
+// Extract extracts a single file from the tar archive.
+// If the target is a directory, the entire folder will
+// be extracted into destination.
+func (tzst *TarZst) Extract(source, target, destination string) error {
+	return tzst.wrapReader(tzst.Tar.session()).Extract(source, target, destination)
+}
+
+// ExtractGlob extracts the files and folders in the
+// compressed tarball at source whose paths match
+// pattern to destination; see Tar.ExtractGlob.
+func (tzst *TarZst) ExtractGlob(source, pattern, destination string) error {
+	return tzst.wrapReader(tzst.Tar.session()).ExtractGlob(source, pattern, destination)
+}
+
+func (tzst *TarZst) wrapWriter(t *Tar) *Tar {
+	if tzst.SeekableFrameSize > 0 {
+		return tzst.wrapSeekableWriter(t)
+	}
+	var zw *zstd.Encoder
+	level, dict := tzst.EncoderLevel, tzst.Dictionary
+	t.writerWrapFn = func(w io.Writer) (io.Writer, error) {
+		var err error
+		zw, err = getZstdDictEncoder(w, level, dict)
+		return zw, err
+	}
+	t.cleanupWrapFn = func() {
+		if zw != nil {
+			zw.Close()
+			putZstdDictEncoder(zw, level, dict)
+			zw = nil
+		}
+	}
+	return t
+}
+
+func (tzst *TarZst) wrapSeekableWriter(t *Tar) *Tar {
+	var sw *seekableZstdWriter
+	level, frameSize, dict := tzst.EncoderLevel, tzst.SeekableFrameSize, tzst.Dictionary
+	t.writerWrapFn = func(w io.Writer) (io.Writer, error) {
+		var err error
+		sw, err = newSeekableZstdWriter(w, level, dict, frameSize)
+		return sw, err
+	}
+	t.cleanupWrapFn = func() {
+		if sw != nil {
+			sw.Close()
+			sw = nil
+		}
+	}
+	return t
+}
+
+func (tzst *TarZst) wrapReader(t *Tar) *Tar {
+	var zr *zstd.Decoder
+	dict := tzst.Dictionary
+	t.readerWrapFn = func(r io.Reader) (io.Reader, error) {
+		var err error
+		zr, err = getZstdDictDecoder(r, dict)
+		return zr, err
+	}
+	t.cleanupWrapFn = func() {
+		if zr != nil {
+			putZstdDictDecoder(zr, dict)
+			zr = nil
+		}
+	}
+	return t
+}
+
+// Clone returns a copy of tzst with a clone of its Tar,
+// which can be changed without changing tzst.
+func (tzst *TarZst) Clone() *TarZst {
+	c := *tzst
+	c.Tar = tzst.Tar.Clone()
+	return &c
+}
+
+// withContext returns a copy of tzst whose Tar is a
+// session which checks ctx; see Tar.withContext.
+func (tzst *TarZst) withContext(ctx context.Context) interface{} {
+	c := *tzst
+	c.Tar = tzst.Tar.withContext(ctx).(*Tar)
+	return &c
+}
+
+func (tzst *TarZst) String() string { return "tar.zst" }
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = Reader(new(TarZst))
+	_ = Writer(new(TarZst))
+	_ = Archiver(new(TarZst))
+	_ = WriterArchiver(new(TarZst))
+	_ = Updater(new(TarZst))
+	_ = Remover(new(TarZst))
+	_ = Unarchiver(new(TarZst))
+	_ = ReaderUnarchiver(new(TarZst))
+	_ = Walker(new(TarZst))
+	_ = Lister(new(TarZst))
+	_ = Validator(new(TarZst))
+	_ = ResultReporter(new(TarZst))
+	_ = ManifestReporter(new(TarZst))
+	_ = SignatureReporter(new(TarZst))
+	_ = RefWalker(new(TarZst))
+	_ = BatchWalker(new(TarZst))
+	_ = Sampler(new(TarZst))
+	_ = Extractor(new(TarZst))
+	_ = GlobExtractor(new(TarZst))
+)
+
+// DefaultTarZst is a convenient archiver ready to use.
+var DefaultTarZst = &TarZst{
+	EncoderLevel: zstd.SpeedDefault,
+	Tar:          DefaultTar.Clone(),
+}
+
+// NewTarZst returns a new TarZst configured by opts;
+// unless they set the level, it compresses at the
+// default level.
+func NewTarZst(opts ...Option) *TarZst {
+	tzst := &TarZst{EncoderLevel: zstd.SpeedDefault, Tar: new(Tar)}
+	applyOptions(opts, tzst.Tar, tzst)
+	return tzst
+}
@@ -0,0 +1,97 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestTarZstSeekable(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	const frameSize = 4096
+	source := filepath.Join(tmp, "seekable.tar.zst")
+	tzst := &TarZst{Tar: &Tar{}, SeekableFrameSize: frameSize}
+	err = tzst.Archive([]string{"testdata"}, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a regular decoder reads the frames as one
+	// stream and skips the seek table
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	tarBytes, err := dec.DecodeAll(data, nil)
+	if err != nil {
+		t.Fatalf("decoding seekable stream: %v", err)
+	}
+	var count int
+	err = (&TarZst{Tar: &Tar{}}).Walk(source, func(File) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count == 0 {
+		t.Fatal("expected files in archive")
+	}
+
+	// parse the seek table from the end of the stream
+	footer := data[len(data)-9:]
+	if magic := binary.LittleEndian.Uint32(footer[5:9]); magic != seekableZstdMagic {
+		t.Fatalf("expected seekable magic number, got %#x", magic)
+	}
+	numFrames := int(binary.LittleEndian.Uint32(footer[0:4]))
+	if expected := (len(tarBytes) + frameSize - 1) / frameSize; numFrames != expected {
+		t.Fatalf("expected %d frames, got %d", expected, numFrames)
+	}
+	tableStart := len(data) - 9 - numFrames*8 - 8
+	table := data[tableStart:]
+	if magic := binary.LittleEndian.Uint32(table[0:4]); magic != seekableZstdSkippableMagic {
+		t.Fatalf("expected skippable frame magic number, got %#x", magic)
+	}
+	if size := int(binary.LittleEndian.Uint32(table[4:8])); size != len(table)-8 {
+		t.Fatalf("expected skippable frame size %d, got %d", len(table)-8, size)
+	}
+
+	// every frame must decompress on its own
+	// to its part of the tarball
+	var cOffset, dOffset int
+	for i := 0; i < numFrames; i++ {
+		entry := table[8+i*8:]
+		cSize := int(binary.LittleEndian.Uint32(entry[0:4]))
+		dSize := int(binary.LittleEndian.Uint32(entry[4:8]))
+		frame, err := dec.DecodeAll(data[cOffset:cOffset+cSize], nil)
+		if err != nil {
+			t.Fatalf("decoding frame %d: %v", i, err)
+		}
+		if !bytes.Equal(frame, tarBytes[dOffset:dOffset+dSize]) {
+			t.Fatalf("frame %d does not match its part of the tarball", i)
+		}
+		cOffset += cSize
+		dOffset += dSize
+	}
+	if cOffset != tableStart {
+		t.Errorf("expected frames to end at seek table (%d), but they end at %d", tableStart, cOffset)
+	}
+	if dOffset != len(tarBytes) {
+		t.Errorf("expected frames to hold %d bytes, but they hold %d", len(tarBytes), dOffset)
+	}
+}
@@ -0,0 +1,79 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"time"
+)
+
+// WarningTimes is the kind of warnings for the
+// times of files which cannot be restored.
+const WarningTimes WarningKind = "times"
+
+// fileTimes are the times of a
+// file to restore once extracted.
+type fileTimes struct {
+	name  string // in the archive
+	path  string // extracted to
+	atime time.Time
+	mtime time.Time
+}
+
+// timesOf returns the times of f, extracted to to; those
+// of zip entries are taken from their NTFS or extended
+// timestamp fields if they have them. Files without an
+// access time, which most formats do not have, are given
+// their modification time as their access time.
+func timesOf(f File, to string) fileTimes {
+	ft := fileTimes{name: entryPath(f), path: to, mtime: f.ModTime()}
+	switch hdr := f.Header.(type) {
+	case *tar.Header:
+		ft.atime = hdr.AccessTime
+	case zip.FileHeader:
+		mtime, atime := zipTimes(hdr.Extra)
+		if !mtime.IsZero() {
+			ft.mtime = mtime
+		}
+		ft.atime = atime
+	}
+	if ft.atime.IsZero() {
+		ft.atime = ft.mtime
+	}
+	return ft
+}
+
+// restoreTimesIn sets the times of the file in fsys to ft,
+// adding a warning to warnings and logging it to logger if
+// they cannot be set; it is an error if strict.
+func restoreTimesIn(fsys FileSystem, ft fileTimes, logger Logger, warnings *[]Warning, strict bool) error {
+	if ft.mtime.IsZero() {
+		return nil
+	}
+	err := fsys.Chtimes(ft.path, ft.atime, ft.mtime)
+	if err == nil {
+		return nil
+	}
+	return addWarning(logger, warnings, strict, Warning{
+		Path:   ft.name,
+		Kind:   WarningTimes,
+		Detail: err.Error(),
+	})
+}
+
+// dirTimes are the times of the directories extracted,
+// which are restored once the files in them are, since
+// extracting files into a directory changes its times.
+type dirTimes []fileTimes
+
+// restore restores the times of the directories in d,
+// as restoreTimesIn does, and forgets them.
+func (d *dirTimes) restore(fsys FileSystem, logger Logger, warnings *[]Warning, strict bool) error {
+	defer func() { *d = nil }()
+	for i := len(*d) - 1; i >= 0; i-- {
+		err := restoreTimesIn(fsys, (*d)[i], logger, warnings, strict)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
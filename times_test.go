@@ -0,0 +1,60 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRestoreTimes(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dirTime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	fileTime := time.Date(2002, 3, 4, 5, 6, 8, 0, time.UTC)
+	entries := []VirtualEntry{
+		FolderEntry("dir", 0755, dirTime),
+		BytesEntry("dir/file.txt", 0644, fileTime, []byte("contents")),
+		BytesEntry("dir/sub/other.txt", 0644, fileTime, []byte("contents")),
+	}
+	for _, ext := range []string{"zip", "tar"} {
+		archive := filepath.Join(tmp, "test."+ext)
+		err := ArchiveEntries(context.Background(), entries, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, discard := range []bool{false, true} {
+			var u Unarchiver
+			switch ext {
+			case "zip":
+				u = &Zip{DiscardTimes: discard}
+			case "tar":
+				u = &Tar{DiscardTimes: discard}
+			}
+			dest := filepath.Join(tmp, fmt.Sprintf("out-%s-%t", ext, discard))
+			err := u.Unarchive(archive, dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w := u.(WarningCollector).Warnings(); len(w) > 0 {
+				t.Errorf("[%s] expected no warnings, got %v", ext, w)
+			}
+			for name, expect := range map[string]time.Time{"dir": dirTime, "dir/file.txt": fileTime} {
+				info, err := os.Stat(filepath.Join(dest, filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if restored := info.ModTime().Equal(expect); restored == discard {
+					t.Errorf("[%s] discard=%t: expected %s to have time %v restored: %t, got %v", ext, discard, name, expect, !discard, info.ModTime())
+				}
+			}
+		}
+	}
+}
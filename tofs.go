@@ -0,0 +1,71 @@
+package archiver
+
+import "io/fs"
+
+// UnarchiveToFS extracts the archive file named source
+// into memory, and returns its files as an fs.FS, for
+// tests and for processing small archives without
+// touching the disk. The format of the archive is chosen
+// by the extension of source as by ByExtension, and must
+// be zip or a (compressed) tarball. Symbolic links are
+// kept as they are, since the FS does not follow them
+// outside of itself. Since all of the contents are kept
+// in memory, it is not suited to large archives.
+func UnarchiveToFS(source string) (fs.FS, error) {
+	format, err := ByExtension(source)
+	if err != nil {
+		return nil, err
+	}
+	fsys := NewMemFileSystem(nil)
+	if !extractToMemory(format, fsys) {
+		return nil, pathErrorf(ErrUnsupportedType, source, "format %s cannot be extracted into memory", format)
+	}
+	err = format.(Unarchiver).Unarchive(source, ".")
+	if err != nil {
+		return nil, err
+	}
+	return fsys.FS(), nil
+}
+
+// extractToMemory makes format extract files to fsys,
+// keeping symbolic links as they are, and returns false
+// if format cannot extract to a FileSystem.
+func extractToMemory(format interface{}, fsys *MemFileSystem) bool {
+	if f, ok := format.(*Zip); ok {
+		f.FileSystem = fsys
+		return true
+	}
+	tr := tarOf(format)
+	if tr == nil {
+		return false
+	}
+	tr.FileSystem = fsys
+	tr.SymlinkPolicy = SymlinkAllow
+	return true
+}
+
+// tarOf returns the Tar which format, a tar
+// format, uses, or nil if it is not one.
+func tarOf(format interface{}) *Tar {
+	switch f := format.(type) {
+	case *Tar:
+		return f
+	case *TarBz2:
+		return f.Tar
+	case *TarGz:
+		return f.Tar
+	case *TarLz4:
+		return f.Tar
+	case *TarLzma:
+		return f.Tar
+	case *TarSz:
+		return f.Tar
+	case *TarXz:
+		return f.Tar
+	case *TarZst:
+		return f.Tar
+	case *TarEncrypted:
+		return f.Tar
+	}
+	return nil
+}
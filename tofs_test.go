@@ -0,0 +1,100 @@
+package archiver
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestUnarchiveToFS(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, name := range []string{"test.zip", "test.tar.gz"} {
+		archive := filepath.Join(tmp, name)
+		format, err := ByExtension(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = format.(Archiver).Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatalf("[%s] archiving: %v", name, err)
+		}
+
+		fsys, err := UnarchiveToFS(archive)
+		if err != nil {
+			t.Fatalf("[%s] unexpected error: %v", name, err)
+		}
+		err = fstest.TestFS(fsys, "testdata/quote1.txt", "testdata/proverbs/proverb1.txt")
+		if err != nil {
+			t.Errorf("[%s] %v", name, err)
+		}
+	}
+
+	_, err = UnarchiveToFS("testdata/quote1.txt.gz")
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("expected error for format which cannot be extracted into memory, got %v", err)
+	}
+}
+
+func TestUnarchiveToFSLinks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// the escaping link points out of the archived folder
+	// and its parent, which is the root of the FS
+	src := filepath.Join(tmp, "parent", "src")
+	err = os.MkdirAll(filepath.Join(src, "real"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "real", "file.txt"), []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(tmp, "outside.txt"), []byte("outside"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("real", filepath.Join(src, "dirlink"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(filepath.Join("..", "..", "outside.txt"), filepath.Join(src, "escape"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(tmp, "links.tar")
+	err = DefaultTar.Archive([]string{src}, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := UnarchiveToFS(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := fs.ReadFile(fsys, "src/dirlink/file.txt")
+	if err != nil || string(contents) != "hello" {
+		t.Errorf("expected file through link, got %q (%v)", contents, err)
+	}
+	entries, err := fs.ReadDir(fsys, "src/dirlink")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "file.txt" {
+		t.Errorf("expected folder through link, got %v (%v)", entries, err)
+	}
+	_, err = fs.Stat(fsys, "src/escape")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected link outside of FS not to exist, got %v", err)
+	}
+}
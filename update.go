@@ -0,0 +1,188 @@
+package archiver
+
+import (
+	"archive/tar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Updater can replace and add entries in an archive file.
+type Updater interface {
+	// Update rewrites archive with the entries named by the
+	// keys of replacements replaced by, or added as, the
+	// files at the paths they map to on disk. The other
+	// entries are copied as they are.
+	Update(archive string, replacements map[string]string) error
+}
+
+// Remover can remove entries from an archive file.
+type Remover interface {
+	// Remove rewrites archive without the entries named
+	// in names, and the entries under those which are
+	// directories.
+	Remove(archive string, names []string) error
+}
+
+// archiveEdits are the changes made to the entries
+// of an archive which is rewritten by Update or Remove.
+type archiveEdits struct {
+	// the paths of the files on disk which replace, or
+	// are added as, the entries at the cleaned paths
+	replacements map[string]string
+
+	// the cleaned paths of the entries to remove,
+	// with the entries under them
+	removals []string
+
+	written map[string]bool // replacements which were written
+	removed map[string]bool // removals which were found
+}
+
+// newArchiveEdits returns the edits which replace or add
+// the entries in replacements, and remove those in removals.
+func newArchiveEdits(replacements map[string]string, removals []string) *archiveEdits {
+	e := &archiveEdits{
+		replacements: make(map[string]string, len(replacements)),
+		written:      make(map[string]bool),
+		removed:      make(map[string]bool),
+	}
+	for name, fpath := range replacements {
+		e.replacements[cleanEntryPath(name)] = fpath
+	}
+	for _, name := range removals {
+		e.removals = append(e.removals, cleanEntryPath(name))
+	}
+	return e
+}
+
+// edit returns how to edit the entry named name: if skip
+// is true, the entry is not copied, and if write is also
+// true, the file at fpath is written in its place. An entry
+// which is in the archive more than once is only replaced
+// once, where it first is.
+func (e *archiveEdits) edit(name string) (fpath string, write, skip bool) {
+	name = cleanEntryPath(name)
+	for _, removal := range e.removals {
+		if name == removal || strings.HasPrefix(name, removal+"/") {
+			e.removed[removal] = true
+			return "", false, true
+		}
+	}
+	fpath, ok := e.replacements[name]
+	if !ok {
+		return "", false, false
+	}
+	if e.written[name] {
+		return "", false, true
+	}
+	e.written[name] = true
+	return fpath, true, true
+}
+
+// additions returns the names of the replacements which
+// were not written in place of entries, in order, to be
+// added at the end of the archive.
+func (e *archiveEdits) additions() []string {
+	var names []string
+	for name := range e.replacements {
+		if !e.written[name] {
+			e.written[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// check returns an error if any of
+// the removals were not found.
+func (e *archiveEdits) check() error {
+	var missing []string
+	for _, name := range e.removals {
+		if !e.removed[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("not found in archive: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// writeReplacement writes the file at fpath to w as
+// the entry named name. Directories are written
+// without their contents.
+func writeReplacement(w Writer, name, fpath string) error {
+	info, err := os.Lstat(fpath)
+	if err != nil {
+		return fmt.Errorf("%s: stat: %w", fpath, err)
+	}
+	f := File{
+		FileInfo: FileInfo{
+			FileInfo:   info,
+			CustomName: name,
+		},
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(fpath)
+		if err != nil {
+			return fmt.Errorf("%s: reading symbolic link: %w", fpath, err)
+		}
+		f.Header = &tar.Header{Linkname: target}
+		f.ReadCloser = ReadFakeCloser{eofReader{}}
+	case info.IsDir():
+		f.ReadCloser = ReadFakeCloser{eofReader{}}
+	default:
+		file, err := os.Open(fpath)
+		if err != nil {
+			return fmt.Errorf("%s: opening: %w", fpath, err)
+		}
+		defer file.Close()
+		f.ReadCloser = file
+	}
+
+	err = w.Write(f)
+	if err != nil {
+		return fmt.Errorf("%s: writing: %w", fpath, err)
+	}
+	return nil
+}
+
+// updateFile replaces the file at archive with the
+// file written by write, which is written next to it
+// first, so the archive is not changed if write fails.
+func updateFile(archive string, write func(out *os.File) error) error {
+	info, err := os.Stat(archive)
+	if err != nil {
+		return fmt.Errorf("stat archive: %w", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(archive), "."+filepath.Base(archive)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // in case of failure
+
+	err = write(tmp)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("closing temporary file: %w", err)
+	}
+	err = os.Chmod(tmp.Name(), info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("setting permissions: %w", err)
+	}
+	err = os.Rename(tmp.Name(), archive)
+	if err != nil {
+		return fmt.Errorf("replacing archive: %w", err)
+	}
+	return nil
+}
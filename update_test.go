@@ -0,0 +1,215 @@
+package archiver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	replacement := filepath.Join(tmp, "replacement.txt")
+	err = ioutil.WriteFile(replacement, []byte("replaced"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []interface {
+		Archiver
+		Unarchiver
+		Lister
+		Updater
+	}{
+		&Tar{},
+		&TarGz{Tar: &Tar{}},
+		&Zip{},
+	} {
+		archive := filepath.Join(tmp, "test."+format.(interface{ String() string }).String())
+		err := format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = format.Update(archive, map[string]string{
+			"testdata/proverbs/proverb1.txt": replacement,
+			"/testdata/added.txt":            replacement,
+		})
+		if err != nil {
+			t.Fatalf("[%s] updating: %v", archive, err)
+		}
+
+		entries, err := format.List(archive)
+		if err != nil {
+			t.Fatalf("[%s] listing: %v", archive, err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		expected := []string{
+			"testdata",
+			"testdata/already-compressed.jpg",
+			"testdata/proverbs",
+			"testdata/proverbs/extra",
+			"testdata/proverbs/extra/proverb3.txt",
+			"testdata/proverbs/proverb1.txt",
+			"testdata/proverbs/proverb2.txt",
+			"testdata/quote1.txt",
+			"testdata/added.txt",
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("[%s] expected entries %v, got %v", archive, expected, names)
+		}
+
+		dest := filepath.Join(tmp, "out")
+		err = format.Unarchive(archive, dest)
+		if err != nil {
+			t.Fatalf("[%s] extracting: %v", archive, err)
+		}
+		for _, tc := range []struct{ name, expected string }{
+			{"testdata/proverbs/proverb1.txt", "replaced"},
+			{"testdata/added.txt", "replaced"},
+		} {
+			actual, err := ioutil.ReadFile(filepath.Join(dest, tc.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(actual) != tc.expected {
+				t.Errorf("[%s] %s: expected contents %q, got %q", archive, tc.name, tc.expected, actual)
+			}
+		}
+		for _, name := range []string{"testdata/quote1.txt", "testdata/proverbs/extra/proverb3.txt"} {
+			expected, err := ioutil.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := ioutil.ReadFile(filepath.Join(dest, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(actual, expected) {
+				t.Errorf("[%s] %s: contents changed", archive, name)
+			}
+		}
+		os.RemoveAll(dest)
+
+		// the archive is not changed if updating fails
+		before, err := ioutil.ReadFile(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = format.Update(archive, map[string]string{"x": filepath.Join(tmp, "does-not-exist")})
+		if err == nil {
+			t.Errorf("[%s] expected an error for a missing replacement", archive)
+		}
+		after, err := ioutil.ReadFile(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(before, after) {
+			t.Errorf("[%s] archive changed by failed update", archive)
+		}
+	}
+}
+
+func TestTarUpdateCopiesEntries(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	archive := filepath.Join(tmp, "test.tar")
+	err = (&Tar{}).Archive([]string{"testdata"}, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := ioutil.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	end, err := tarEnd(bytes.NewReader(before))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only adding, so all the entries are copied
+	err = (&Tar{}).Update(archive, map[string]string{"added.txt": "testdata/quote1.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := ioutil.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after[:end], before[:end]) {
+		t.Error("expected the entries to be copied byte for byte")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, format := range []interface {
+		Archiver
+		Lister
+		Remover
+	}{
+		&Tar{},
+		&TarGz{Tar: &Tar{}},
+		&Zip{},
+	} {
+		archive := filepath.Join(tmp, "test."+format.(interface{ String() string }).String())
+		err := format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// directories are removed with what is under them
+		err = format.Remove(archive, []string{"testdata/proverbs", "/testdata/quote1.txt"})
+		if err != nil {
+			t.Fatalf("[%s] removing: %v", archive, err)
+		}
+		entries, err := format.List(archive)
+		if err != nil {
+			t.Fatalf("[%s] listing: %v", archive, err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		expected := []string{"testdata", "testdata/already-compressed.jpg"}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("[%s] expected entries %v, got %v", archive, expected, names)
+		}
+
+		// the archive is not changed if a name is not in it
+		before, err := ioutil.ReadFile(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = format.Remove(archive, []string{"testdata/already-compressed.jpg", "testdata/quote1.txt"})
+		if err == nil {
+			t.Errorf("[%s] expected an error removing a missing entry", archive)
+		}
+		after, err := ioutil.ReadFile(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(before, after) {
+			t.Errorf("[%s] archive changed by failed removal", archive)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package archiver
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Validator is a type that can check the integrity of
+// archives without extracting them, as `gzip -t` and
+// `zip -T` do: every entry is read to its end, so that
+// checksums are verified where the format has them, and
+// truncated or inconsistent headers are found. Validate
+// returns nil if the archive is intact.
+type Validator interface {
+	Validate(archive string) error
+}
+
+// validateWalk validates archive by walking it with w
+// and reading every entry to its end, for formats whose
+// readers verify the checksums they have as they are
+// read.
+func validateWalk(w Walker, archive string) error {
+	return w.Walk(archive, func(f File) error {
+		return validateContents(entryPath(f), f)
+	})
+}
+
+// validateContents reads the contents of the entry
+// named name from r to the end.
+func validateContents(name string, r io.Reader) error {
+	_, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return fmt.Errorf("%s: reading contents: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package archiver
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// corrupt returns a copy of archive changed by change
+	corrupt := func(archive string, change func([]byte) []byte) string {
+		data, err := ioutil.ReadFile(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corrupted := filepath.Join(tmp, "corrupt-"+filepath.Base(archive))
+		err = ioutil.WriteFile(corrupted, change(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return corrupted
+	}
+
+	for _, tc := range []struct {
+		format interface {
+			Archiver
+			Validator
+		}
+		name    string
+		corrupt func(archive string, data []byte) []byte
+	}{
+		{
+			format: &Tar{},
+			name:   "truncated.tar",
+			corrupt: func(archive string, data []byte) []byte {
+				return data[:tarBlockSize+10]
+			},
+		},
+		{
+			// only the checksum at the end of the gzip
+			// stream is wrong, after the end of the tarball
+			format: &TarGz{Tar: &Tar{}},
+			name:   "crc.tar.gz",
+			corrupt: func(archive string, data []byte) []byte {
+				data[len(data)-8] ^= 0xff
+				return data
+			},
+		},
+		{
+			format: &Zip{},
+			name:   "contents.zip",
+			corrupt: func(archive string, data []byte) []byte {
+				zr, err := zip.OpenReader(archive)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer zr.Close()
+				for _, zf := range zr.File {
+					if zf.UncompressedSize64 > 0 {
+						offset, err := zf.DataOffset()
+						if err != nil {
+							t.Fatal(err)
+						}
+						data[offset] ^= 0xff
+						break
+					}
+				}
+				return data
+			},
+		},
+	} {
+		archive := filepath.Join(tmp, tc.name)
+		err := tc.format.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tc.format.Validate(archive)
+		if err != nil {
+			t.Errorf("[%s] expected archive to be valid, got: %v", tc.name, err)
+		}
+
+		corrupted := corrupt(archive, func(data []byte) []byte {
+			return tc.corrupt(archive, data)
+		})
+		err = tc.format.Validate(corrupted)
+		if err == nil {
+			t.Errorf("[%s] expected an error validating the corrupted archive", tc.name)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+// VirtualEntry is a file which does not exist on disk
+// but is added to an archive anyway, with contents that
+// are produced on demand when the archive is written;
+// for example, the output of a database dump command.
+type VirtualEntry struct {
+	// The name of the file in the archive,
+	// which is slash-separated.
+	Name string
+
+	// The file mode; if 0, 0644 is used.
+	Mode os.FileMode
+
+	// The modification time; if zero, the
+	// time the entry is written is used.
+	ModTime time.Time
+
+	// The size of the contents, if known in advance.
+	// If negative, the size is unknown; formats which
+	// need to know the size before writing the contents
+	// (such as tar) will then spool them first, in
+	// memory and then to a temporary file if they
+	// become large.
+	Size int64
+
+	// Open is called when the entry is written, to
+	// get a reader of its contents. It is not needed
+	// for folders, which have no contents.
+	Open func() (io.ReadCloser, error)
+}
+
+// BytesEntry returns a VirtualEntry named name whose
+// contents are data, with the given mode and modification
+// time, which may be 0 and the zero time for the defaults.
+func BytesEntry(name string, mode os.FileMode, modTime time.Time, data []byte) VirtualEntry {
+	return VirtualEntry{
+		Name:    name,
+		Mode:    mode,
+		ModTime: modTime,
+		Size:    int64(len(data)),
+		Open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		},
+	}
+}
+
+// ReaderEntry returns a VirtualEntry named name, of
+// unknown size, whose contents are read from r, with the
+// given mode and modification time, which may be 0 and
+// the zero time for the defaults. If r is an io.Closer,
+// it is closed once the entry is written. Since r can
+// only be read once, the entry can only be written once.
+func ReaderEntry(name string, mode os.FileMode, modTime time.Time, r io.Reader) VirtualEntry {
+	return VirtualEntry{
+		Name:    name,
+		Mode:    mode,
+		ModTime: modTime,
+		Size:    -1,
+		Open: func() (io.ReadCloser, error) {
+			if rc, ok := r.(io.ReadCloser); ok {
+				return rc, nil
+			}
+			return ioutil.NopCloser(r), nil
+		},
+	}
+}
+
+// FolderEntry returns a VirtualEntry of an empty folder
+// named name, with the given permissions and modification
+// time, which may be 0 and the zero time for the defaults.
+func FolderEntry(name string, perm os.FileMode, modTime time.Time) VirtualEntry {
+	return VirtualEntry{
+		Name:    name,
+		Mode:    os.ModeDir | perm.Perm(),
+		ModTime: modTime,
+	}
+}
+
+// CommandEntry returns a VirtualEntry named name, of
+// unknown size, whose contents are the standard output
+// of cmd. The command is started when the entry is
+// written; if it exits with an error, writing the entry
+// fails. If cmd.Stderr is nil, the standard error of
+// the command is included in that error. Since a command
+// can only be run once, the entry can only be written
+// once.
+func CommandEntry(name string, cmd *exec.Cmd) VirtualEntry {
+	return VirtualEntry{
+		Name: name,
+		Size: -1,
+		Open: func() (io.ReadCloser, error) {
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				return nil, err
+			}
+			cr := &commandReader{cmd: cmd, stdout: stdout}
+			if cmd.Stderr == nil {
+				cr.stderr = new(bytes.Buffer)
+				cmd.Stderr = cr.stderr
+			}
+			err = cmd.Start()
+			if err != nil {
+				return nil, fmt.Errorf("starting %s: %w", cmd.Path, err)
+			}
+			return cr, nil
+		},
+	}
+}
+
+// commandReader reads the standard output of a
+// running command and waits for it to exit at EOF.
+type commandReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr *bytes.Buffer
+	done   bool
+}
+
+func (cr *commandReader) Read(p []byte) (int, error) {
+	n, err := cr.stdout.Read(p)
+	if err == io.EOF {
+		if waitErr := cr.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Close stops the command if it has not exited yet.
+func (cr *commandReader) Close() error {
+	if cr.done {
+		return nil
+	}
+	if cr.cmd.Process != nil {
+		cr.cmd.Process.Kill()
+	}
+	cr.wait()
+	return nil
+}
+
+func (cr *commandReader) wait() error {
+	if cr.done {
+		return nil
+	}
+	cr.done = true
+	err := cr.cmd.Wait()
+	if err != nil {
+		if cr.stderr != nil && cr.stderr.Len() > 0 {
+			return fmt.Errorf("%s: %w: %s", cr.cmd.Path, err, strings.TrimSpace(cr.stderr.String()))
+		}
+		return fmt.Errorf("%s: %w", cr.cmd.Path, err)
+	}
+	return nil
+}
+
+// ArchiveEntries creates an archive file at destination
+// containing entries, such as generated contents, without
+// them having to be on disk. The format of the archive is
+// chosen by the extension of destination as by
+// ByExtension, and must be one which can be written, such
+// as zip or a (compressed) tarball.
+//
+// Archiving stops as soon as possible once ctx is
+// done, in which case ctx.Err() is returned.
+func ArchiveEntries(ctx context.Context, entries []VirtualEntry, destination string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return createArchiveFile(ctx, destination, func(w Writer) error {
+		// zip archives do not need to know the
+		// sizes of files before their contents
+		_, isZip := w.(*Zip)
+		for _, e := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			err := writeVirtualEntry(w, e, SystemClock{}, !isZip)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// NewFileInfo returns a FileInfo of a file named name,
+// which is slash-separated, for writing a file which is
+// not on disk with a Writer. The name is kept as it is,
+// as the CustomName.
+func NewFileInfo(name string, size int64, mode os.FileMode, modTime time.Time) FileInfo {
+	return FileInfo{
+		FileInfo: virtualFileInfo{VirtualEntry{
+			Name:    name,
+			Mode:    mode,
+			ModTime: modTime,
+			Size:    size,
+		}},
+		CustomName: name,
+	}
+}
+
+// writeVirtualEntries writes entries to w, which must
+// already be created. If needSize is true, the contents
+// of entries of unknown size are spooled first. Entries
+// with no modification time get the time from clock.
+// If continueOnError is true, errors are logged to
+// logger, as by logError, and skipped.
+func writeVirtualEntries(w Writer, entries []VirtualEntry, clock Clock, needSize, continueOnError bool, logger Logger) error {
+	for _, e := range entries {
+		err := writeVirtualEntry(w, e, clock, needSize)
+		if err != nil {
+			if continueOnError {
+				logError(logger, "Writing %s: %v", e.Name, err)
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func writeVirtualEntry(w Writer, e VirtualEntry, clock Clock, needSize bool) error {
+	switch {
+	case e.Mode == 0:
+		e.Mode = 0644
+	case e.Mode.IsDir() && e.Mode.Perm() == 0:
+		e.Mode |= 0755
+	}
+	if e.ModTime.IsZero() {
+		e.ModTime = clock.Now()
+	}
+
+	if e.Mode.IsDir() {
+		err := w.Write(File{
+			FileInfo:   NewFileInfo(e.Name, 0, e.Mode, e.ModTime),
+			ReadCloser: ReadFakeCloser{eofReader{}},
+		})
+		if err != nil {
+			return fmt.Errorf("%s: writing: %w", e.Name, err)
+		}
+		return nil
+	}
+
+	if e.Open == nil {
+		return fmt.Errorf("%s: no way to open contents", e.Name)
+	}
+	rc, err := e.Open()
+	if err != nil {
+		return fmt.Errorf("%s: opening: %w", e.Name, err)
+	}
+	defer rc.Close()
+
+	contents := io.Reader(rc)
+	if e.Size < 0 {
+		if needSize {
+			spooled, size, err := spool(rc)
+			if err != nil {
+				return fmt.Errorf("%s: spooling contents: %w", e.Name, err)
+			}
+			defer spooled.Close()
+			contents, e.Size = spooled, size
+		} else {
+			e.Size = 0 // will be set when written
+		}
+	}
+
+	err = w.Write(File{
+		FileInfo:   NewFileInfo(e.Name, e.Size, e.Mode, e.ModTime),
+		ReadCloser: ReadFakeCloser{contents},
+	})
+	if err != nil {
+		return fmt.Errorf("%s: writing: %w", e.Name, err)
+	}
+	return nil
+}
+
+// spool reads all of r and returns a reader of what was
+// read, along with its size. Contents are kept in memory
+// until they grow beyond spoolMemoryLimit, after which
+// they are spooled to a temporary file instead, which is
+// removed when the returned reader is closed.
+func spool(r io.Reader) (io.ReadCloser, int64, error) {
+	buf := new(bytes.Buffer)
+	n, err := io.CopyN(buf, r, spoolMemoryLimit+1)
+	if err == io.EOF {
+		return ioutil.NopCloser(buf), n, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tmp, err := ioutil.TempFile("", "archiver_spool")
+	if err != nil {
+		return nil, 0, err
+	}
+	sf := &spoolFile{File: tmp, untrack: trackResource(LeakTempFile, tmp.Name())}
+	size, err := io.Copy(tmp, io.MultiReader(buf, r))
+	if err != nil {
+		sf.Close()
+		return nil, 0, err
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		sf.Close()
+		return nil, 0, err
+	}
+	return sf, size, nil
+}
+
+// spoolFile is a temporary file which
+// is removed when it is closed.
+type spoolFile struct {
+	*os.File
+	untrack func()
+}
+
+func (sf *spoolFile) Close() error {
+	err := sf.File.Close()
+	os.Remove(sf.Name())
+	sf.untrack()
+	return err
+}
+
+// spoolMemoryLimit is the most contents of
+// unknown size to buffer in memory.
+const spoolMemoryLimit = 1 << 20
+
+type virtualFileInfo struct {
+	e VirtualEntry
+}
+
+func (vfi virtualFileInfo) Name() string       { return path.Base(vfi.e.Name) }
+func (vfi virtualFileInfo) Size() int64        { return vfi.e.Size }
+func (vfi virtualFileInfo) Mode() os.FileMode  { return vfi.e.Mode }
+func (vfi virtualFileInfo) ModTime() time.Time { return vfi.e.ModTime }
+func (vfi virtualFileInfo) IsDir() bool        { return vfi.e.Mode.IsDir() }
+func (vfi virtualFileInfo) Sys() interface{}   { return nil }
+
+// Compile-time checks to ensure type implements desired interfaces.
+var _ = os.FileInfo(virtualFileInfo{})
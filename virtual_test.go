@@ -0,0 +1,166 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVirtualEntries(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// bigger than what is spooled in memory
+	big := bytes.Repeat([]byte("0123456789"), spoolMemoryLimit/5)
+
+	entries := []VirtualEntry{
+		{
+			Name: "dumps/big.bin",
+			Size: -1,
+			Open: func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(big)), nil
+			},
+		},
+		{
+			Name: "dumps/known.txt",
+			Mode: 0600,
+			Size: 5,
+			Open: func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader("hello")), nil
+			},
+		},
+	}
+
+	for _, format := range []interface {
+		Archiver
+		Walker
+	}{
+		&Tar{VirtualEntries: append(entries, dumpCommandEntry())},
+		&Zip{VirtualEntries: append(entries, dumpCommandEntry())},
+	} {
+		destination := filepath.Join(tmp, "backup."+fmt.Sprint(format))
+		err := format.Archive([]string{"testdata"}, destination)
+		if err != nil {
+			t.Fatalf("[%s] archiving: %v", format, err)
+		}
+
+		contents := make(map[string][]byte)
+		err = format.Walk(destination, func(f File) error {
+			var name string
+			switch hdr := f.Header.(type) {
+			case *tar.Header:
+				name = hdr.Name
+			case zip.FileHeader:
+				name = hdr.Name
+			}
+			if strings.HasPrefix(name, "dumps/") {
+				contents[name], err = ioutil.ReadAll(f)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("[%s] walking: %v", format, err)
+		}
+
+		if string(contents["dumps/db.sql"]) != "CREATE TABLE t (id int);\n" {
+			t.Errorf("[%s] unexpected command output: %q", format, contents["dumps/db.sql"])
+		}
+		if !bytes.Equal(contents["dumps/big.bin"], big) {
+			t.Errorf("[%s] spooled entry has %d bytes; expected %d", format, len(contents["dumps/big.bin"]), len(big))
+		}
+		if string(contents["dumps/known.txt"]) != "hello" {
+			t.Errorf("[%s] unexpected contents: %q", format, contents["dumps/known.txt"])
+		}
+	}
+}
+
+func TestArchiveEntries(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+	for _, name := range []string{"gen.zip", "gen.tar.gz"} {
+		entries := []VirtualEntry{
+			FolderEntry("gen/empty", 0, modTime),
+			BytesEntry("gen/config.json", 0600, modTime, []byte(`{"a": 1}`)),
+			ReaderEntry("gen/report.csv", 0, modTime, strings.NewReader("a,b\n1,2\n")),
+		}
+		archive := filepath.Join(tmp, name)
+		err := ArchiveEntries(context.Background(), entries, archive)
+		if err != nil {
+			t.Fatalf("[%s] archiving: %v", name, err)
+		}
+
+		fsys, err := UnarchiveToFS(archive)
+		if err != nil {
+			t.Fatalf("[%s] extracting: %v", name, err)
+		}
+		for fpath, expected := range map[string]string{
+			"gen/config.json": `{"a": 1}`,
+			"gen/report.csv":  "a,b\n1,2\n",
+		} {
+			contents, err := fs.ReadFile(fsys, fpath)
+			if err != nil || string(contents) != expected {
+				t.Errorf("[%s] expected %s to contain %q, got %q (%v)", name, fpath, expected, contents, err)
+			}
+		}
+		format, err := ByExtension(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = format.(Walker).Walk(archive, func(f File) error {
+			if f.Name() == "config.json" && (f.Mode().Perm() != 0600 || !f.ModTime().Equal(modTime)) {
+				t.Errorf("[%s] expected mode 0600 and modification time %v, got %v and %v", name, modTime, f.Mode(), f.ModTime())
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("[%s] walking: %v", name, err)
+		}
+		if info, err := fs.Stat(fsys, "gen/empty"); err != nil || !info.IsDir() {
+			t.Errorf("[%s] expected empty folder, got %v (%v)", name, info, err)
+		}
+
+		err = ArchiveEntries(context.Background(), entries[:1], archive)
+		if !errors.Is(err, ErrDestinationExists) {
+			t.Errorf("[%s] expected error for existing destination, got %v", name, err)
+		}
+	}
+}
+
+// dumpCommandEntry returns an entry with the output of
+// a command; commands cannot be reused, so a new one is
+// needed for each archive.
+func dumpCommandEntry() VirtualEntry {
+	cmd := exec.Command(os.Args[0], "-test.run=TestVirtualEntryHelperProcess")
+	cmd.Env = append(os.Environ(), "ARCHIVER_TEST_HELPER=1")
+	return CommandEntry("dumps/db.sql", cmd)
+}
+
+// TestVirtualEntryHelperProcess is not a real test; it is
+// run as a command by TestVirtualEntries.
+func TestVirtualEntryHelperProcess(t *testing.T) {
+	if os.Getenv("ARCHIVER_TEST_HELPER") != "1" {
+		return
+	}
+	fmt.Print("CREATE TABLE t (id int);\n")
+	os.Exit(0)
+}
@@ -0,0 +1,92 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWalkBatches(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, af := range []interface{}{
+		&Zip{CompressionLevel: flate.DefaultCompression},
+		&Tar{},
+		&TarZst{Tar: &Tar{}},
+	} {
+		bw := af.(BatchWalker)
+		w := af.(Walker)
+		a := af.(Archiver)
+
+		archive := filepath.Join(tmp, "walkbatches_test."+af.(interface{ String() string }).String())
+		err := a.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatalf("[%s] making archive: %v", af, err)
+		}
+
+		var expectedNames []string
+		expectedContents := make(map[string][]byte)
+		err = w.Walk(archive, func(f File) error {
+			expectedNames = append(expectedNames, f.Name())
+			if !f.IsDir() {
+				expectedContents[f.Name()], err = ioutil.ReadAll(f)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("[%s] walking: %v", af, err)
+		}
+
+		var actualNames []string
+		var batches int
+		err = bw.WalkBatches(archive, 2, func(files []File) error {
+			batches++
+			if len(files) == 0 || len(files) > 2 {
+				t.Errorf("[%s] unexpected batch size %d", af, len(files))
+			}
+			// read the contents in reverse order
+			for i := len(files) - 1; i >= 0; i-- {
+				f := files[i]
+				if f.IsDir() {
+					continue
+				}
+				contents, err := ioutil.ReadAll(f)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(contents, expectedContents[f.Name()]) {
+					t.Errorf("[%s] %s: contents do not match", af, f.Name())
+				}
+			}
+			for _, f := range files {
+				actualNames = append(actualNames, f.Name())
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("[%s] walking batches: %v", af, err)
+		}
+		if len(actualNames) != len(expectedNames) {
+			t.Fatalf("[%s] expected %d items but got %d", af, len(expectedNames), len(actualNames))
+		}
+		if expectedBatches := (len(expectedNames) + 1) / 2; batches != expectedBatches {
+			t.Errorf("[%s] expected %d batches but got %d", af, expectedBatches, batches)
+		}
+
+		batches = 0
+		err = bw.WalkBatches(archive, 1, func(files []File) error {
+			batches++
+			return ErrStopWalk
+		})
+		if err != nil || batches != 1 {
+			t.Errorf("[%s] expected walk to stop after 1 batch without error, got %d batches: %v", af, batches, err)
+		}
+	}
+}
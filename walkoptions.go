@@ -0,0 +1,51 @@
+package archiver
+
+import "time"
+
+// WalkOptions limits how much of an archive is walked by
+// WalkWithOptions, which is useful for showing a quick
+// preview of the contents of a huge or remote archive.
+type WalkOptions struct {
+	// If greater than zero, the maximum
+	// number of items to visit.
+	MaxEntries int
+
+	// If greater than zero, no more items are visited
+	// once this much time has passed since the walk
+	// began. The time is checked as each item is
+	// reached, so an item which is slow to read (or
+	// a slow walkFn) can make the walk take longer.
+	MaxDuration time.Duration
+
+	// The clock used to measure MaxDuration;
+	// if nil, the system clock is used.
+	Clock Clock
+}
+
+// WalkWithOptions walks archive with w like w.Walk, but
+// stops early if any of the limits in opts is reached.
+// It returns true if the walk was stopped early because
+// of the limits, in which case there are more items in
+// the archive than were visited.
+func WalkWithOptions(w Walker, archive string, opts WalkOptions, walkFn WalkFunc) (truncated bool, err error) {
+	clock := clockOrSystem(opts.Clock)
+	var deadline time.Time
+	if opts.MaxDuration > 0 {
+		deadline = clock.Now().Add(opts.MaxDuration)
+	}
+
+	var count int
+	err = w.Walk(archive, func(f File) error {
+		// limits are checked when the next item is
+		// reached, so that the walk is only reported
+		// as truncated if there really are more items
+		if (opts.MaxEntries > 0 && count >= opts.MaxEntries) ||
+			(!deadline.IsZero() && clock.Now().After(deadline)) {
+			truncated = true
+			return ErrStopWalk
+		}
+		count++
+		return walkFn(f)
+	})
+	return truncated, err
+}
@@ -0,0 +1,66 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWalkWithOptions(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	archive := filepath.Join(tmp, "walkoptions_test.tar")
+	err = (&Tar{}).Archive([]string{"testdata"}, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var total int
+	err = (&Tar{}).Walk(archive, func(File) error {
+		total++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total < 3 {
+		t.Fatalf("expected at least 3 items in test archive, got %d", total)
+	}
+
+	for i, test := range []struct {
+		opts      WalkOptions
+		delay     time.Duration
+		expected  int
+		truncated bool
+	}{
+		{opts: WalkOptions{}, expected: total},
+		{opts: WalkOptions{MaxEntries: 2}, expected: 2, truncated: true},
+		{opts: WalkOptions{MaxEntries: total}, expected: total},
+		{opts: WalkOptions{MaxDuration: time.Hour}, expected: total},
+		{opts: WalkOptions{MaxDuration: 10 * time.Millisecond}, delay: 20 * time.Millisecond, expected: 1, truncated: true},
+	} {
+		clock := NewFakeClock(time.Unix(1e9, 0))
+		test.opts.Clock = clock
+		var count int
+		truncated, err := WalkWithOptions(&Tar{}, archive, test.opts, func(File) error {
+			count++
+			clock.Advance(test.delay)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("test %d: walking: %v", i, err)
+		}
+		if count != test.expected {
+			t.Errorf("test %d: expected %d items, got %d", i, test.expected, count)
+		}
+		if truncated != test.truncated {
+			t.Errorf("test %d: expected truncated=%t, got %t", i, test.truncated, truncated)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestWalkRef(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// use fresh instances, since the compressed tar defaults
+	// share (and reconfigure) the same underlying *Tar
+	for _, af := range []interface{}{
+		&Zip{CompressionLevel: flate.DefaultCompression},
+		&Tar{},
+		&TarGz{Tar: &Tar{}, CompressionLevel: gzip.DefaultCompression},
+		&TarZst{Tar: &Tar{}},
+	} {
+		rw := af.(RefWalker)
+		w := af.(Walker)
+		a := af.(Archiver)
+
+		archive := filepath.Join(tmp, "walkref_test."+af.(interface{ String() string }).String())
+		err := a.Archive([]string{"testdata"}, archive)
+		if err != nil {
+			t.Fatalf("[%s] making archive: %v", af, err)
+		}
+
+		var expected []string
+		err = w.Walk(archive, func(f File) error {
+			expected = append(expected, f.Name())
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("[%s] walking: %v", af, err)
+		}
+
+		var actual []string
+		var totalSize int64
+		err = rw.WalkRef(archive, func(f *File) error {
+			actual = append(actual, f.Name())
+			switch f.Header.(type) {
+			case *tar.Header, *zip.FileHeader:
+			default:
+				t.Errorf("[%s] unexpected header type %T", af, f.Header)
+			}
+			if !f.IsDir() {
+				b, err := ioutil.ReadAll(f)
+				if err != nil {
+					return err
+				}
+				totalSize += int64(len(b))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("[%s] walking by reference: %v", af, err)
+		}
+		if len(actual) != len(expected) {
+			t.Fatalf("[%s] expected %d items but got %d", af, len(expected), len(actual))
+		}
+		for i := range expected {
+			if actual[i] != expected[i] {
+				t.Errorf("[%s] item %d: expected %s but got %s", af, i, expected[i], actual[i])
+			}
+		}
+		if totalSize == 0 {
+			t.Errorf("[%s] expected contents to be readable", af)
+		}
+	}
+}
+
+func BenchmarkZipWalk(b *testing.B) {
+	archive := makeBenchmarkZip(b)
+	defer os.Remove(archive)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DefaultZip.Walk(archive, func(f File) error { return nil })
+	}
+}
+
+func BenchmarkZipWalkRef(b *testing.B) {
+	archive := makeBenchmarkZip(b)
+	defer os.Remove(archive)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DefaultZip.WalkRef(archive, func(f *File) error { return nil })
+	}
+}
+
+func makeBenchmarkZip(b *testing.B) string {
+	tmp, err := ioutil.TempFile("", "archiver_bench*.zip")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tmp.Close()
+	zw := zip.NewWriter(tmp)
+	for i := 0; i < 1000; i++ {
+		w, err := zw.Create(filepath.Join("dir", strconv.Itoa(i)+".txt"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		w.Write([]byte("benchmark"))
+	}
+	if err := zw.Close(); err != nil {
+		b.Fatal(err)
+	}
+	return tmp.Name()
+}
@@ -0,0 +1,489 @@
+package archiver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Warc provides facilities for reading WARC (Web ARChive)
+// files, either plain or gzip-compressed (.warc.gz).
+//
+// Every record is visited by Walk; its contents are the
+// record's block, exactly as stored. Records are named
+// after their target URI (host followed by path, with
+// "index.html" appended to paths ending in a slash), or
+// after their record ID if they have no target URI.
+//
+// When extracting, only response and resource records
+// are written; for HTTP responses, the HTTP headers are
+// stripped so that only the payload is written to disk.
+// See https://iipc.github.io/warc-specifications/.
+type Warc struct {
+	// Whether to overwrite existing files; if false,
+	// an error is returned if the file exists.
+	OverwriteExisting bool
+
+	// Whether to extract entries whose paths go outside
+	// of the destination, such as "../../etc/cron.d/x";
+	// if false, an error which is ErrIllegalPath is
+	// returned for them. Only set this for trusted
+	// archives.
+	AllowPathTraversal bool
+
+	// What to do with entries whose paths are absolute,
+	// such as "/etc/passwd"; the zero value,
+	// AbsolutePathStrip, extracts them inside of the
+	// destination with a warning.
+	AbsolutePathPolicy AbsolutePathPolicy
+
+	// The most bytes of contents of any one file to
+	// extract; 0 means no limit. Since contents are
+	// counted as they are decompressed, records which
+	// decompress to much more than expected cannot fill
+	// the disk; extracting them fails with an error which
+	// is ErrLimitExceeded instead.
+	MaxEntrySize int64
+
+	// The most bytes of contents of all files to extract
+	// in one operation, counted like for MaxEntrySize;
+	// 0 means no limit.
+	MaxTotalSize int64
+
+	// Whether to make all the directories necessary
+	// to extract the archive in the desired path.
+	MkdirAll bool
+
+	// If true, errors encountered during reading
+	// a single record will be logged and the
+	// operation will continue on remaining records.
+	ContinueOnError bool
+
+	// If set, errors skipped because of ContinueOnError
+	// are logged to this logger instead of the logger of
+	// the error log policy.
+	Logger Logger
+
+	wr        *warcReader
+	cleanup   func()
+	extracted int64 // bytes of payloads extracted, for MaxTotalSize
+}
+
+// Unarchive writes the payloads of the response and
+// resource records in the WARC file at source into
+// destination, which will be treated as a folder name.
+func (w *Warc) Unarchive(source, destination string) error {
+	w = w.session()
+
+	if !fileExists(destination) && w.MkdirAll {
+		err := mkdir(destination)
+		if err != nil {
+			return fmt.Errorf("preparing destination: %w", err)
+		}
+	}
+
+	return w.Walk(source, func(f File) error {
+		to, err := extractPath(destination, f.Name(), w.AllowPathTraversal, w.AbsolutePathPolicy, w.Logger)
+		if err != nil {
+			return err
+		}
+		return w.extractRecord(f, to)
+	})
+}
+
+// extractRecord writes the payload of the record f
+// to the file to, if the record has a payload.
+func (w *Warc) extractRecord(f File, to string) error {
+	hdr, ok := f.Header.(*WarcHeader)
+	if !ok {
+		return fmt.Errorf("expected header to be *WarcHeader but was %T", f.Header)
+	}
+	if hdr.Type != "response" && hdr.Type != "resource" {
+		return nil
+	}
+
+	// do not overwrite existing files, if configured
+	if !w.OverwriteExisting && fileExists(to) {
+		return &PathError{Path: to, Err: ErrDestinationExists}
+	}
+
+	payload := io.Reader(f)
+	if hdr.Type == "response" && strings.HasPrefix(hdr.ContentType, "application/http") {
+		resp, err := http.ReadResponse(bufio.NewReader(f), nil)
+		if err != nil {
+			return fmt.Errorf("%s: reading HTTP response: %w", hdr.TargetURI, err)
+		}
+		defer resp.Body.Close()
+		payload = resp.Body
+	}
+
+	limits := w.limits()
+	return writeNewFile(to, limits.reader(hdr.TargetURI, payload), 0644)
+}
+
+// limits returns the limits on the payloads
+// being extracted.
+func (w *Warc) limits() extractLimits {
+	return extractLimits{
+		maxEntry: w.MaxEntrySize,
+		maxTotal: w.MaxTotalSize,
+		total:    &w.extracted,
+	}
+}
+
+// Open opens w for reading a WARC file from in,
+// which may be gzip-compressed. The size parameter
+// is not used.
+func (w *Warc) Open(in io.Reader, size int64) error {
+	if w.wr != nil {
+		return fmt.Errorf("warc file is already open for reading")
+	}
+
+	br := bufio.NewReader(in)
+	magic, err := br.Peek(2)
+	if err != nil {
+		return fmt.Errorf("reading warc file: %w", err)
+	}
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		// records are usually compressed one gzip member
+		// at a time, which the gzip reader reads through
+		gzr, err := getGzipReader(br)
+		if err != nil {
+			return fmt.Errorf("opening gzip stream: %w", err)
+		}
+		w.cleanup = func() { putGzipReader(gzr) }
+		br = bufio.NewReader(gzr)
+	}
+	w.wr = &warcReader{br: br}
+
+	return nil
+}
+
+// Read reads the next record from w, which must have
+// already been opened for reading. If there are no
+// more records, the error is io.EOF. The File must
+// be closed when finished reading from it.
+func (w *Warc) Read() (File, error) {
+	if w.wr == nil {
+		return File{}, fmt.Errorf("warc file is not open")
+	}
+
+	hdr, err := w.wr.Next()
+	if err != nil {
+		return File{}, err // don't wrap error; preserve io.EOF
+	}
+
+	file := File{
+		FileInfo:   warcFileInfo{hdr},
+		Header:     hdr,
+		ReadCloser: trackBody(warcRecordName(hdr), ReadFakeCloser{w.wr}),
+	}
+
+	return file, nil
+}
+
+// Close closes the WARC file opened by Open.
+func (w *Warc) Close() error {
+	if w.wr != nil {
+		w.wr = nil
+	}
+	if w.cleanup != nil {
+		w.cleanup()
+		w.cleanup = nil
+	}
+	return nil
+}
+
+// Walk calls walkFn for each record in archive.
+func (w *Warc) Walk(archive string, walkFn WalkFunc) error {
+	w = w.session()
+
+	walkFn = skipDirs(walkFn)
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("opening archive file: %w", err)
+	}
+	defer file.Close()
+
+	err = w.Open(file, 0)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer w.Close()
+
+	for {
+		f, err := w.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// a malformed record leaves the stream at an
+			// unknown position, so it is not possible to
+			// continue on to the next record
+			return fmt.Errorf("opening next record: %w", err)
+		}
+		err = walkFn(f)
+		f.Close()
+		if err != nil {
+			if err == ErrStopWalk {
+				break
+			}
+			if w.ContinueOnError {
+				logError(w.Logger, "Walking %s: %v", f.Name(), err)
+				continue
+			}
+			return fmt.Errorf("walking %s: %w", f.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (w *Warc) List(archive string) ([]EntryInfo, error) {
+	return listWalk(w, archive)
+}
+
+// Validate checks the integrity of archive by
+// reading the contents of every entry.
+func (w *Warc) Validate(archive string) error {
+	return validateWalk(w, archive)
+}
+
+// Extract extracts the payload of a single record from
+// the WARC file, or of all records under target if it
+// names a directory, into destination.
+func (w *Warc) Extract(source, target, destination string) error {
+	w = w.session()
+
+	// target refers to a path inside the archive, which should be clean also
+	target = path.Clean(target)
+
+	var found bool
+	err := w.Walk(source, func(f File) error {
+		name := f.Name()
+		if !within(target, name) {
+			return nil
+		}
+		found = true
+
+		// build the filename we will extract to
+		end, err := filepath.Rel(path.Dir(target), name)
+		if err != nil {
+			return fmt.Errorf("relativizing paths: %w", err)
+		}
+		joined, err := extractPath(destination, filepath.ToSlash(end), w.AllowPathTraversal, w.AbsolutePathPolicy, w.Logger)
+		if err != nil {
+			return err
+		}
+
+		err = w.extractRecord(f, joined)
+		if err != nil {
+			return fmt.Errorf("extracting record %s: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s: not found in archive", target)
+	}
+	return nil
+}
+
+// Match returns true if the format of file matches this
+// type's format. It should not affect reader position.
+func (*Warc) Match(file *os.File) (bool, error) {
+	currentPos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		return false, err
+	}
+	defer file.Seek(currentPos, io.SeekStart)
+
+	var r io.Reader
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false, nil
+	}
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		file.Seek(0, 0)
+		gzr, err := gzip.NewReader(file)
+		if err != nil {
+			return false, nil
+		}
+		defer gzr.Close()
+		r = gzr
+	} else {
+		r = io.MultiReader(bytes.NewReader(magic), file)
+	}
+
+	buf := make([]byte, len(warcMagic))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return false, nil
+	}
+	return string(buf) == warcMagic, nil
+}
+
+// session returns a copy of w with its own state,
+// so that operations can be done concurrently.
+func (w *Warc) session() *Warc {
+	s := *w
+	s.wr, s.cleanup, s.extracted = nil, nil, 0
+	return &s
+}
+
+func (w *Warc) String() string { return "warc" }
+
+// WarcHeader is the header of a record in a WARC file.
+type WarcHeader struct {
+	Version       string // for example, "WARC/1.0"
+	Type          string // the WARC-Type field
+	RecordID      string
+	TargetURI     string
+	Date          time.Time
+	ContentType   string
+	ContentLength int64
+
+	// Fields contains all the named fields
+	// of the record header.
+	Fields textproto.MIMEHeader
+}
+
+// warcReader reads the records of an uncompressed
+// WARC stream.
+type warcReader struct {
+	br  *bufio.Reader
+	cur io.Reader // block of the current record
+}
+
+// Next advances to the next record in the stream,
+// skipping the remainder of the current one. It
+// returns io.EOF at the end of the stream.
+func (wr *warcReader) Next() (*WarcHeader, error) {
+	if wr.cur != nil {
+		if _, err := io.Copy(ioutil.Discard, wr.cur); err != nil {
+			return nil, err
+		}
+		wr.cur = nil
+	}
+
+	// records are separated by two newlines, which
+	// are skipped together with any stray blank lines
+	tp := textproto.NewReader(wr.br)
+	var version string
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			if err == io.EOF && version == "" {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		if line != "" {
+			version = line
+			break
+		}
+	}
+	if !strings.HasPrefix(version, warcMagic) {
+		return nil, fmt.Errorf("invalid record version line: %q", version)
+	}
+
+	fields, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("reading record header: %w", err)
+	}
+
+	hdr := &WarcHeader{
+		Version:     version,
+		Type:        fields.Get("WARC-Type"),
+		RecordID:    fields.Get("WARC-Record-ID"),
+		TargetURI:   strings.Trim(fields.Get("WARC-Target-URI"), "<>"),
+		ContentType: fields.Get("Content-Type"),
+		Fields:      fields,
+	}
+	hdr.ContentLength, err = strconv.ParseInt(fields.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %w", err)
+	}
+	if date := fields.Get("WARC-Date"); date != "" {
+		hdr.Date, err = time.Parse(time.RFC3339Nano, date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WARC-Date: %w", err)
+		}
+	}
+
+	wr.cur = io.LimitReader(wr.br, hdr.ContentLength)
+
+	return hdr, nil
+}
+
+// Read reads the block of the current record.
+func (wr *warcReader) Read(p []byte) (int, error) {
+	if wr.cur == nil {
+		return 0, io.EOF
+	}
+	return wr.cur.Read(p)
+}
+
+// warcRecordName returns the path-like name of
+// the record described by hdr.
+func warcRecordName(hdr *WarcHeader) string {
+	if u, err := url.Parse(hdr.TargetURI); err == nil && u.Host != "" {
+		name := path.Join(u.Host, path.Clean("/"+u.Path))
+		if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+			name = path.Join(name, "index.html")
+		}
+		return name
+	}
+	id := strings.TrimPrefix(strings.Trim(hdr.RecordID, "<>"), "urn:uuid:")
+	return strings.NewReplacer("/", "_", ":", "_").Replace(id)
+}
+
+type warcFileInfo struct {
+	hdr *WarcHeader
+}
+
+func (wfi warcFileInfo) Name() string       { return warcRecordName(wfi.hdr) }
+func (wfi warcFileInfo) Size() int64        { return wfi.hdr.ContentLength }
+func (wfi warcFileInfo) Mode() os.FileMode  { return 0644 }
+func (wfi warcFileInfo) ModTime() time.Time { return wfi.hdr.Date }
+func (wfi warcFileInfo) IsDir() bool        { return false }
+func (wfi warcFileInfo) Sys() interface{}   { return wfi.hdr }
+
+const warcMagic = "WARC/"
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = Reader(new(Warc))
+	_ = Unarchiver(new(Warc))
+	_ = Walker(new(Warc))
+	_ = Lister(new(Warc))
+	_ = Validator(new(Warc))
+	_ = Extractor(new(Warc))
+	_ = Matcher(new(Warc))
+	_ = os.FileInfo(warcFileInfo{})
+)
+
+// DefaultWarc is a convenient archiver ready to use.
+var DefaultWarc = &Warc{
+	MkdirAll: true,
+}
@@ -0,0 +1,110 @@
+package archiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWarcWalkAndUnarchive(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	source := filepath.Join(tmp, "crawl.warc.gz")
+	err = ioutil.WriteFile(source, makeTestWarcGz(t), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	err = DefaultWarc.Walk(source, func(f File) error {
+		types = append(types, f.Header.(*WarcHeader).Type)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walking warc: %v", err)
+	}
+	if fmt.Sprint(types) != "[warcinfo request response]" {
+		t.Errorf("unexpected record types: %v", types)
+	}
+
+	dest := filepath.Join(tmp, "out")
+	err = DefaultWarc.Unarchive(source, dest)
+	if err != nil {
+		t.Fatalf("unarchiving warc: %v", err)
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(dest, "example.com", "index.html"))
+	if err != nil {
+		t.Fatalf("reading extracted payload: %v", err)
+	}
+	if string(contents) != "<h1>hi</h1>" {
+		t.Errorf("expected HTTP payload but got '%s'", contents)
+	}
+}
+
+func TestWarcLimits(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	source := filepath.Join(tmp, "crawl.warc.gz")
+	err = ioutil.WriteFile(source, makeTestWarcGz(t), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the payload of the response is 11 bytes
+	for i, tc := range []struct {
+		maxEntry, maxTotal int64
+		expectErr          bool
+	}{
+		{},
+		{maxEntry: 5, expectErr: true},
+		{maxEntry: 11},
+		{maxTotal: 10, expectErr: true},
+		{maxTotal: 11},
+	} {
+		w := &Warc{MkdirAll: true, MaxEntrySize: tc.maxEntry, MaxTotalSize: tc.maxTotal}
+		err := w.Unarchive(source, filepath.Join(tmp, fmt.Sprint(i)))
+		if tc.expectErr && !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("Test %d: expected error for exceeded limit, got %v", i, err)
+		}
+		if !tc.expectErr && err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+// makeTestWarcGz builds a small WARC file with each
+// record compressed as its own gzip member.
+func makeTestWarcGz(t *testing.T) []byte {
+	buf := new(bytes.Buffer)
+	writeRecord := func(typ, uri, contentType, block string) {
+		gzw := gzip.NewWriter(buf)
+		fmt.Fprintf(gzw, "WARC/1.0\r\nWARC-Type: %s\r\nWARC-Record-ID: <urn:uuid:%s>\r\n", typ, typ)
+		if uri != "" {
+			fmt.Fprintf(gzw, "WARC-Target-URI: %s\r\n", uri)
+		}
+		fmt.Fprintf(gzw, "WARC-Date: 2018-11-11T10:00:00Z\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s\r\n\r\n",
+			contentType, len(block), block)
+		if err := gzw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeRecord("warcinfo", "", "application/warc-fields", "software: test\r\n")
+	writeRecord("request", "http://example.com/", "application/http; msgtype=request",
+		"GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	writeRecord("response", "http://example.com/", "application/http; msgtype=response",
+		"HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 11\r\n\r\n<h1>hi</h1>")
+	return buf.Bytes()
+}
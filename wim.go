@@ -0,0 +1,321 @@
+//go:build linux || windows
+// +build linux windows
+
+package archiver
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/Microsoft/go-winio/wim"
+)
+
+// Wim provides facilities for reading Windows Imaging
+// Format (.wim) files, such as those used to deploy
+// Windows. Uncompressed and LZX-compressed images are
+// supported. Reparse points (symbolic links and
+// junctions) are visited but not extracted.
+// See https://docs.microsoft.com/en-us/windows-hardware/manufacture/desktop/wim-vs-ffu-image-file-formats.
+type Wim struct {
+	// The index of the image to read within the file,
+	// starting at 1; a WIM file may contain multiple
+	// images. If 0, the first image is read.
+	Image int
+
+	// Whether to overwrite existing files; if false,
+	// an error is returned if the file exists.
+	OverwriteExisting bool
+
+	// Whether to extract entries whose paths go outside
+	// of the destination, such as "../../etc/cron.d/x";
+	// if false, an error which is ErrIllegalPath is
+	// returned for them. Only set this for trusted
+	// archives.
+	AllowPathTraversal bool
+
+	// What to do with entries whose paths are absolute,
+	// such as "/etc/passwd"; the zero value,
+	// AbsolutePathStrip, extracts them inside of the
+	// destination with a warning.
+	AbsolutePathPolicy AbsolutePathPolicy
+
+	// The most bytes of contents of any one file to
+	// extract; 0 means no limit. Since contents are
+	// counted as they are decompressed, files which
+	// decompress to much more than they say cannot fill
+	// the disk; extracting them fails with an error which
+	// is ErrLimitExceeded instead.
+	MaxEntrySize int64
+
+	// The most bytes of contents of all files to extract
+	// in one operation, counted like for MaxEntrySize;
+	// 0 means no limit.
+	MaxTotalSize int64
+
+	// Whether to make all the directories necessary
+	// to extract the image in the desired path.
+	MkdirAll bool
+
+	// If true, errors encountered during reading
+	// a single file will be logged and the
+	// operation will continue on remaining files.
+	ContinueOnError bool
+
+	// If set, errors skipped because of ContinueOnError
+	// are logged to this logger instead of the logger of
+	// the error log policy.
+	Logger Logger
+}
+
+// Unarchive extracts the files of an image in the WIM
+// file at source to destination. Destination will be
+// treated as a folder name.
+func (w *Wim) Unarchive(source, destination string) error {
+	if !fileExists(destination) && w.MkdirAll {
+		err := mkdir(destination)
+		if err != nil {
+			return fmt.Errorf("preparing destination: %w", err)
+		}
+	}
+
+	var extracted int64 // for MaxTotalSize
+	return w.Walk(source, func(f File) error {
+		to, err := extractPath(destination, f.Header.(*WimHeader).Path, w.AllowPathTraversal, w.AbsolutePathPolicy, w.Logger)
+		if err != nil {
+			return err
+		}
+		return w.extractFile(f, to, &extracted)
+	})
+}
+
+// extractFile extracts f to the file to, adding
+// the bytes of contents extracted to extracted.
+func (w *Wim) extractFile(f File, to string, extracted *int64) error {
+	hdr, ok := f.Header.(*WimHeader)
+	if !ok {
+		return fmt.Errorf("expected header to be *WimHeader but was %T", f.Header)
+	}
+
+	switch {
+	case f.IsDir():
+		return mkdir(to)
+	case hdr.Attributes&wim.FILE_ATTRIBUTE_REPARSE_POINT != 0:
+		return nil // reparse points are Windows-specific
+	}
+
+	// do not overwrite existing files, if configured
+	if !w.OverwriteExisting && fileExists(to) {
+		return &PathError{Path: to, Err: ErrDestinationExists}
+	}
+
+	limits := w.limits(extracted)
+	err := limits.check(hdr.Path, f.Size())
+	if err != nil {
+		return err
+	}
+	return writeNewFile(to, limits.reader(hdr.Path, f), f.Mode())
+}
+
+// limits returns the limits on the files being
+// extracted, of which extracted bytes are so far.
+func (w *Wim) limits(extracted *int64) extractLimits {
+	return extractLimits{
+		maxEntry: w.MaxEntrySize,
+		maxTotal: w.MaxTotalSize,
+		total:    extracted,
+	}
+}
+
+// Walk calls walkFn for each file and directory in an
+// image of the WIM file named archive.
+func (w *Wim) Walk(archive string, walkFn WalkFunc) error {
+	walkFn = skipDirs(walkFn)
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return fmt.Errorf("opening archive file: %w", err)
+	}
+	defer file.Close()
+
+	wr, err := wim.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("opening wim reader: %w", err)
+	}
+	defer wr.Close()
+
+	index := w.Image
+	if index == 0 {
+		index = 1
+	}
+	if index < 1 || index > len(wr.Image) {
+		return fmt.Errorf("image %d not found; file has %d image(s)", index, len(wr.Image))
+	}
+
+	root, err := wr.Image[index-1].Open()
+	if err != nil {
+		return fmt.Errorf("opening image %d: %w", index, err)
+	}
+
+	err = w.walkDir(root, "", walkFn)
+	if err == ErrStopWalk {
+		return nil
+	}
+	return err
+}
+
+// walkDir calls walkFn for each entry in dir, which
+// is at dirPath in the image, recursively.
+func (w *Wim) walkDir(dir *wim.File, dirPath string, walkFn WalkFunc) error {
+	entries, err := dir.Readdir()
+	if err != nil {
+		return fmt.Errorf("reading directory %s: %w", dirPath, err)
+	}
+
+	for _, entry := range entries {
+		hdr := &WimHeader{File: entry, Path: path.Join(dirPath, entry.Name)}
+
+		err := w.visit(hdr, walkFn)
+		if err != nil {
+			if err == ErrStopWalk {
+				return err
+			}
+			if w.ContinueOnError {
+				logError(w.Logger, "Walking %s: %v", hdr.Path, err)
+				continue
+			}
+			return fmt.Errorf("walking %s: %w", hdr.Path, err)
+		}
+
+		if entry.IsDir() {
+			err := w.walkDir(entry, hdr.Path, walkFn)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *Wim) visit(hdr *WimHeader, walkFn WalkFunc) error {
+	f := File{
+		FileInfo: wimFileInfo{hdr},
+		Header:   hdr,
+	}
+	if hdr.IsDir() {
+		f.ReadCloser = ReadFakeCloser{eofReader{}}
+		return walkFn(f)
+	}
+
+	rc, err := hdr.File.Open()
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	defer rc.Close()
+	f.ReadCloser = rc
+
+	return walkFn(f)
+}
+
+// Extract extracts a single file from an image in the
+// WIM file. If the target is a directory, the entire
+// folder will be extracted into destination.
+func (w *Wim) Extract(source, target, destination string) error {
+	// target refers to a path inside the archive, which should be clean also
+	target = path.Clean(target)
+
+	// if the target ends up being a directory, then
+	// we will continue walking and extracting files
+	// until we are no longer within that directory
+	var targetDirPath string
+
+	var extracted int64 // for MaxTotalSize
+	return w.Walk(source, func(f File) error {
+		hdr, ok := f.Header.(*WimHeader)
+		if !ok {
+			return fmt.Errorf("expected header to be *WimHeader but was %T", f.Header)
+		}
+
+		if f.IsDir() && target == hdr.Path {
+			targetDirPath = path.Dir(hdr.Path)
+		}
+
+		if within(target, hdr.Path) {
+			// either this is the exact file we want, or is
+			// in the directory we want to extract
+
+			// build the filename we will extract to
+			end, err := filepath.Rel(targetDirPath, hdr.Path)
+			if err != nil {
+				return fmt.Errorf("relativizing paths: %w", err)
+			}
+			joined, err := extractPath(destination, filepath.ToSlash(end), w.AllowPathTraversal, w.AbsolutePathPolicy, w.Logger)
+			if err != nil {
+				return err
+			}
+
+			err = w.extractFile(f, joined, &extracted)
+			if err != nil {
+				return fmt.Errorf("extracting file %s: %w", hdr.Path, err)
+			}
+
+			// if our target was not a directory, stop walk
+			if targetDirPath == "" {
+				return ErrStopWalk
+			}
+		} else if targetDirPath != "" {
+			// finished walking the entire directory
+			return ErrStopWalk
+		}
+
+		return nil
+	})
+}
+
+// WimHeader describes a file or directory
+// in an image of a WIM file.
+type WimHeader struct {
+	*wim.File
+
+	// The slash-separated path of the
+	// file relative to the image root.
+	Path string
+}
+
+type wimFileInfo struct {
+	hdr *WimHeader
+}
+
+func (wfi wimFileInfo) Name() string       { return wfi.hdr.Name }
+func (wfi wimFileInfo) Size() int64        { return wfi.hdr.Size }
+func (wfi wimFileInfo) ModTime() time.Time { return wfi.hdr.LastWriteTime.Time() }
+func (wfi wimFileInfo) IsDir() bool        { return wfi.hdr.IsDir() }
+func (wfi wimFileInfo) Sys() interface{}   { return wfi.hdr }
+
+func (wfi wimFileInfo) Mode() os.FileMode {
+	var mode os.FileMode = 0644
+	if wfi.hdr.Attributes&wim.FILE_ATTRIBUTE_READONLY != 0 {
+		mode = 0444
+	}
+	switch {
+	case wfi.hdr.IsDir():
+		mode = os.ModeDir | 0755
+	case wfi.hdr.Attributes&wim.FILE_ATTRIBUTE_REPARSE_POINT != 0:
+		mode |= os.ModeSymlink
+	}
+	return mode
+}
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = Unarchiver(new(Wim))
+	_ = Walker(new(Wim))
+	_ = Lister(new(Wim))
+	_ = Validator(new(Wim))
+	_ = Extractor(new(Wim))
+	_ = Matcher(new(Wim))
+	_ = os.FileInfo(wimFileInfo{})
+)
@@ -0,0 +1,48 @@
+package archiver
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// Match returns true if the format of file matches this
+// type's format. It should not affect reader position.
+func (*Wim) Match(file *os.File) (bool, error) {
+	currentPos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+	_, err = file.Seek(0, 0)
+	if err != nil {
+		return false, err
+	}
+	defer file.Seek(currentPos, io.SeekStart)
+
+	buf := make([]byte, len(wimMagic))
+	if _, err := io.ReadFull(file, buf); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(buf, []byte(wimMagic)), nil
+}
+
+func (w *Wim) String() string { return "wim" }
+
+const wimMagic = "MSWIM\x00\x00\x00"
+
+// DefaultWim is a convenient archiver ready to use.
+var DefaultWim = &Wim{
+	MkdirAll: true,
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (w *Wim) List(archive string) ([]EntryInfo, error) {
+	return listWalk(w, archive)
+}
+
+// Validate checks the integrity of archive by
+// reading the contents of every entry.
+func (w *Wim) Validate(archive string) error {
+	return validateWalk(w, archive)
+}
@@ -0,0 +1,81 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package archiver
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Wim provides facilities for reading Windows Imaging
+// Format (.wim) files. It is only supported on Linux
+// and Windows; on other platforms, its methods return
+// an error.
+type Wim struct {
+	// The index of the image to read within the file,
+	// starting at 1; a WIM file may contain multiple
+	// images. If 0, the first image is read.
+	Image int
+
+	// Whether to overwrite existing files; if false,
+	// an error is returned if the file exists.
+	OverwriteExisting bool
+
+	// Whether to extract entries whose paths go outside
+	// of the destination, such as "../../etc/cron.d/x";
+	// if false, an error which is ErrIllegalPath is
+	// returned for them. Only set this for trusted
+	// archives.
+	AllowPathTraversal bool
+
+	// What to do with entries whose paths are absolute,
+	// such as "/etc/passwd"; the zero value,
+	// AbsolutePathStrip, extracts them inside of the
+	// destination with a warning.
+	AbsolutePathPolicy AbsolutePathPolicy
+
+	// The most bytes of contents of any one file to
+	// extract; 0 means no limit. Since contents are
+	// counted as they are decompressed, files which
+	// decompress to much more than they say cannot fill
+	// the disk; extracting them fails with an error which
+	// is ErrLimitExceeded instead.
+	MaxEntrySize int64
+
+	// The most bytes of contents of all files to extract
+	// in one operation, counted like for MaxEntrySize;
+	// 0 means no limit.
+	MaxTotalSize int64
+
+	// Whether to make all the directories necessary
+	// to extract the image in the desired path.
+	MkdirAll bool
+
+	// If true, errors encountered during reading
+	// a single file will be logged and the
+	// operation will continue on remaining files.
+	ContinueOnError bool
+
+	// If set, errors skipped because of ContinueOnError
+	// are logged to this logger instead of the logger of
+	// the error log policy.
+	Logger Logger
+}
+
+// Unarchive is not supported on this platform.
+func (w *Wim) Unarchive(source, destination string) error {
+	return errWimUnsupported
+}
+
+// Walk is not supported on this platform.
+func (w *Wim) Walk(archive string, walkFn WalkFunc) error {
+	return errWimUnsupported
+}
+
+// Extract is not supported on this platform.
+func (w *Wim) Extract(source, target, destination string) error {
+	return errWimUnsupported
+}
+
+var errWimUnsupported = fmt.Errorf("wim files are not supported on %s", runtime.GOOS)
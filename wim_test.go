@@ -0,0 +1,43 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWimMatch(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for i, tc := range []struct {
+		contents string
+		expect   bool
+	}{
+		{contents: wimMagic + "\xd0\x00\x00\x00", expect: true},
+		{contents: "MSWIM", expect: false},
+		{contents: "PK\x03\x04", expect: false},
+	} {
+		fpath := filepath.Join(tmp, "image.wim")
+		err := ioutil.WriteFile(fpath, []byte(tc.contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matched, err := DefaultWim.Match(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+		if matched != tc.expect {
+			t.Errorf("Test %d: expected match=%t but got %t", i, tc.expect, matched)
+		}
+	}
+}
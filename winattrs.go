@@ -0,0 +1,62 @@
+package archiver
+
+import "archive/zip"
+
+// The MS-DOS attributes of files, which zip archives
+// keep in the low bits of their external attributes.
+const (
+	msdosReadOnly = 0x01
+	msdosHidden   = 0x02
+	msdosSystem   = 0x04
+)
+
+// WarningAttributes is the kind of warnings for the
+// Windows attributes of files which are not restored.
+const WarningAttributes WarningKind = "file attributes"
+
+// attributeSetter is a FileSystem which can set
+// the Windows attributes of files.
+type attributeSetter interface {
+	SetFileAttributes(name string, attrs uint32) error
+}
+
+// SetFileAttributes adds attrs, the MS-DOS attributes of a
+// file as kept in zip archives (hidden and system; the
+// read-only attribute is set by the mode of the file), to
+// the attributes of the file named name. Systems other
+// than Windows do not have them, so there it does nothing.
+func (OSFileSystem) SetFileAttributes(name string, attrs uint32) error {
+	return setFileAttributes(name, attrs&(msdosHidden|msdosSystem))
+}
+
+// zipAttributes returns the hidden and system attributes
+// of the file whose info has sys, the result of
+// os.FileInfo.Sys, to keep in the external attributes of
+// its zip header; zip.FileInfoHeader sets the read-only
+// attribute from its mode.
+func zipAttributes(sys interface{}) uint32 {
+	attrs, ok := fileAttributes(sys)
+	if !ok {
+		return 0
+	}
+	return attrs & (msdosHidden | msdosSystem)
+}
+
+// restoreAttributesIn adds the hidden and system attributes
+// of hdr to the file at fpath in fsys, and returns a
+// non-empty reason if they cannot be, to be warned about.
+func restoreAttributesIn(fsys FileSystem, fpath string, hdr zip.FileHeader) string {
+	attrs := hdr.ExternalAttrs & (msdosHidden | msdosSystem)
+	if attrs == 0 {
+		return ""
+	}
+	setter, ok := fsys.(attributeSetter)
+	if !ok {
+		return "file system cannot set file attributes"
+	}
+	err := setter.SetFileAttributes(fpath, attrs)
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
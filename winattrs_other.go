@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package archiver
+
+import "time"
+
+// fileAttributes returns false, since only
+// files on Windows have these attributes.
+func fileAttributes(sys interface{}) (uint32, bool) { return 0, false }
+
+// fileCreationTimes returns zero times, since only the
+// times of files on Windows are kept in the NTFS field.
+func fileCreationTimes(sys interface{}) (atime, ctime time.Time) { return time.Time{}, time.Time{} }
+
+func setFileAttributes(fpath string, attrs uint32) error { return nil }
@@ -0,0 +1,73 @@
+package archiver
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// attributesFileSystem is a MemFileSystem which
+// records the attributes set on its files.
+type attributesFileSystem struct {
+	*MemFileSystem
+	attrs map[string]uint32
+}
+
+func (a attributesFileSystem) SetFileAttributes(name string, attrs uint32) error {
+	a.attrs[filepath.ToSlash(name)] = attrs
+	return nil
+}
+
+func TestRestoreAttributes(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	archive := filepath.Join(tmp, "test.zip")
+	out, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	for name, attrs := range map[string]uint32{"plain.txt": 0, "hidden.txt": msdosHidden, "system.txt": msdosSystem | msdosReadOnly} {
+		hdr := &zip.FileHeader{Name: name, Method: zip.Store}
+		hdr.SetMode(0644)
+		hdr.ExternalAttrs |= attrs
+		_, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	zw.Close()
+	out.Close()
+
+	fsys := attributesFileSystem{MemFileSystem: NewMemFileSystem(nil), attrs: make(map[string]uint32)}
+	z := &Zip{FileSystem: fsys, MkdirAll: true}
+	err = z.Unarchive(archive, "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]uint32{"out/hidden.txt": msdosHidden, "out/system.txt": msdosSystem}
+	if len(fsys.attrs) != len(expected) {
+		t.Errorf("expected attributes %v to be set, got %v", expected, fsys.attrs)
+	}
+	for name, attrs := range expected {
+		if fsys.attrs[name] != attrs {
+			t.Errorf("%s: expected attributes %#x, got %#x", name, attrs, fsys.attrs[name])
+		}
+	}
+
+	// file systems which cannot set them warn
+	z = &Zip{FileSystem: NewMemFileSystem(nil), MkdirAll: true}
+	err = z.Unarchive(archive, "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warnings := z.Warnings(); len(warnings) != 2 || warnings[0].Kind != WarningAttributes {
+		t.Errorf("expected warnings for the attributes which were not set, got %v", warnings)
+	}
+}
@@ -0,0 +1,50 @@
+package archiver
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileAttributes returns the attributes of the file whose
+// info has sys, the result of os.FileInfo.Sys.
+func fileAttributes(sys interface{}) (uint32, bool) {
+	data, ok := sys.(*syscall.Win32FileAttributeData)
+	if !ok {
+		return 0, false
+	}
+	return data.FileAttributes, true
+}
+
+// fileCreationTimes returns the access and creation times
+// of the file whose info has sys, the result of
+// os.FileInfo.Sys.
+func fileCreationTimes(sys interface{}) (atime, ctime time.Time) {
+	data, ok := sys.(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, time.Time{}
+	}
+	return time.Unix(0, data.LastAccessTime.Nanoseconds()), time.Unix(0, data.CreationTime.Nanoseconds())
+}
+
+// setFileAttributes adds attrs to the
+// attributes of the file at fpath.
+func setFileAttributes(fpath string, attrs uint32) error {
+	if attrs == 0 {
+		return nil
+	}
+	p, err := syscall.UTF16PtrFromString(fpath)
+	if err != nil {
+		return err
+	}
+	current, err := syscall.GetFileAttributes(p)
+	if err != nil {
+		return &os.PathError{Op: "GetFileAttributes", Path: fpath, Err: err}
+	}
+	// FILE_ATTRIBUTE_NORMAL is only valid alone
+	err = syscall.SetFileAttributes(p, current&^syscall.FILE_ATTRIBUTE_NORMAL|attrs)
+	if err != nil {
+		return &os.PathError{Op: "SetFileAttributes", Path: fpath, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package archiver
+
+import (
+	"archive/tar"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// paxXattrPrefix is the prefix of the PAX records of the
+// extended attributes of files, as written by GNU tar and
+// star, such as "SCHILY.xattr.user.comment".
+const paxXattrPrefix = "SCHILY.xattr."
+
+// WarningXattrs is the kind of warnings for extended
+// attributes which are not archived or restored.
+const WarningXattrs WarningKind = "extended attributes"
+
+// xattrSetter is a FileSystem which can set
+// the extended attributes of files.
+type xattrSetter interface {
+	Lsetxattr(name, attr string, value []byte) error
+}
+
+// errXattrsUnsupported is returned by setXattr on systems
+// where extended attributes cannot be set.
+var errXattrsUnsupported = fmt.Errorf("extended attributes cannot be set on this system")
+
+// Lsetxattr sets the extended attribute attr of the file
+// named name to value; for symbolic links, it sets the
+// attribute of the link.
+func (OSFileSystem) Lsetxattr(name, attr string, value []byte) error {
+	return setXattr(name, attr, value)
+}
+
+// addXattrs adds the extended attributes of the file at
+// fpath to hdr as PAX records, for a tarball of format,
+// and returns a non-empty reason if they cannot be, to be
+// warned about.
+func addXattrs(hdr *tar.Header, fpath string, format tar.Format) string {
+	xattrs, err := listXattrs(fpath)
+	if err != nil {
+		return err.Error()
+	}
+	if len(xattrs) == 0 {
+		return ""
+	}
+	if format == tar.FormatUSTAR || format == tar.FormatGNU {
+		return fmt.Sprintf("%s format cannot store them", format)
+	}
+	if hdr.PAXRecords == nil {
+		hdr.PAXRecords = make(map[string]string)
+	}
+	for name, value := range xattrs {
+		hdr.PAXRecords[paxXattrPrefix+name] = value
+	}
+	return ""
+}
+
+// privilegedXattr returns true if the extended attribute
+// named name grants privileges, like the setuid bit does:
+// the file capabilities of programs, and attributes in the
+// trusted namespace, which only root can set.
+func privilegedXattr(name string) bool {
+	return name == "security.capability" || strings.HasPrefix(name, "trusted.")
+}
+
+// restoreXattrsIn sets the extended attributes in the PAX
+// records of hdr on the file at fpath in fsys, and returns
+// a non-empty reason if they cannot all be set, to be
+// warned about. Privileged attributes are left out unless
+// keepPrivileged, as the setuid bit is without KeepSetuid.
+func restoreXattrsIn(fsys FileSystem, fpath string, hdr *tar.Header, keepPrivileged bool) string {
+	var names []string
+	for key := range hdr.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(key, paxXattrPrefix)
+		if privilegedXattr(name) && !keepPrivileged {
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	setter, ok := fsys.(xattrSetter)
+	if !ok {
+		return "file system cannot set extended attributes"
+	}
+	sort.Strings(names)
+	var failed []string
+	for _, name := range names {
+		err := setter.Lsetxattr(fpath, name, []byte(hdr.PAXRecords[paxXattrPrefix+name]))
+		if err == errXattrsUnsupported {
+			return err.Error()
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return "cannot set " + strings.Join(failed, ", ")
+	}
+	return ""
+}
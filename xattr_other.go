@@ -0,0 +1,8 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package archiver
+
+func listXattrs(fpath string) (map[string]string, error) { return nil, nil }
+
+func setXattr(fpath, name string, value []byte) error { return errXattrsUnsupported }
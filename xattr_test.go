@@ -0,0 +1,145 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestXattrs(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "file.txt")
+	err = ioutil.WriteFile(src, []byte("contents"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = OSFileSystem{}.Lsetxattr(src, "user.comment", []byte("hello"))
+	if err != nil {
+		t.Skipf("cannot set extended attributes: %v", err)
+	}
+
+	for _, enabled := range []bool{false, true} {
+		archive := filepath.Join(tmp, "test.tar")
+		tr := &Tar{Xattrs: enabled, OverwriteExisting: true}
+		err := tr.Archive([]string{src}, archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tr.Walk(archive, func(f File) error {
+			hdr := f.Header.(*tar.Header)
+			if value, ok := hdr.PAXRecords["SCHILY.xattr.user.comment"]; ok != enabled || (ok && value != "hello") {
+				t.Errorf("[xattrs=%t] unexpected PAX records: %v", enabled, hdr.PAXRecords)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dest := filepath.Join(tmp, "out")
+		err = tr.Unarchive(archive, dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tr.Warnings()) > 0 {
+			t.Errorf("[xattrs=%t] expected no warnings, got %v", enabled, tr.Warnings())
+		}
+		var xattrs map[string]string
+		for _, fpath := range tr.Result().Paths {
+			if filepath.Base(fpath) == "file.txt" {
+				xattrs, err = listXattrs(fpath)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if value, ok := xattrs["user.comment"]; ok != enabled || (ok && value != "hello") {
+			t.Errorf("[xattrs=%t] unexpected extended attributes restored: %v", enabled, xattrs)
+		}
+	}
+}
+
+func TestXattrsFormat(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "file.txt")
+	err = ioutil.WriteFile(src, []byte("contents"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = OSFileSystem{}.Lsetxattr(src, "user.comment", []byte("hello"))
+	if err != nil {
+		t.Skipf("cannot set extended attributes: %v", err)
+	}
+
+	tr := &Tar{Xattrs: true, Format: tar.FormatUSTAR}
+	err = tr.Archive([]string{src}, filepath.Join(tmp, "test.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings := tr.Warnings()
+	if len(warnings) != 1 || warnings[0].Kind != WarningXattrs {
+		t.Errorf("expected a warning that the format cannot store extended attributes, got %v", warnings)
+	}
+}
+
+// xattrFileSystem is a MemFileSystem which
+// records the extended attributes set.
+type xattrFileSystem struct {
+	*MemFileSystem
+	xattrs map[string]string
+}
+
+func (fsys *xattrFileSystem) Lsetxattr(name, attr string, value []byte) error {
+	fsys.xattrs[attr] = string(value)
+	return nil
+}
+
+func TestPrivilegedXattrs(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	err := tw.WriteHeader(&tar.Header{
+		Name:     "prog",
+		Typeflag: tar.TypeReg,
+		Mode:     0755,
+		Format:   tar.FormatPAX,
+		PAXRecords: map[string]string{
+			"SCHILY.xattr.user.comment":        "hello",
+			"SCHILY.xattr.security.capability": "\x01\x00\x00\x02",
+			"SCHILY.xattr.trusted.overlay":     "y",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+
+	for _, keep := range []bool{false, true} {
+		fsys := &xattrFileSystem{MemFileSystem: NewMemFileSystem(nil), xattrs: make(map[string]string)}
+		tr := &Tar{FileSystem: fsys, Xattrs: true, KeepSetuid: keep}
+		err := tr.UnarchiveReader(bytes.NewReader(buf.Bytes()), "dest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fsys.xattrs["user.comment"] != "hello" {
+			t.Errorf("[keep=%t] expected user.comment to be restored, got %v", keep, fsys.xattrs)
+		}
+		for _, name := range []string{"security.capability", "trusted.overlay"} {
+			if _, ok := fsys.xattrs[name]; ok != keep {
+				t.Errorf("[keep=%t] expected %s to be restored: %t, got %v", keep, name, keep, fsys.xattrs)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package archiver
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// listXattrs returns the extended attributes of the file
+// at fpath, or of the link if it is a symbolic link, by
+// name; files on filesystems which do not support them
+// have none.
+func listXattrs(fpath string) (map[string]string, error) {
+	size, err := unix.Llistxattr(fpath, nil)
+	if err == unix.ENOTSUP || err == unix.EOPNOTSUPP {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: fpath, Err: err}
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(fpath, buf)
+	if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: fpath, Err: err}
+	}
+
+	xattrs := make(map[string]string)
+	for _, name := range strings.Split(strings.TrimSuffix(string(buf[:size]), "\x00"), "\x00") {
+		size, err := unix.Lgetxattr(fpath, name, nil)
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr " + name, Path: fpath, Err: err}
+		}
+		value := make([]byte, size)
+		size, err = unix.Lgetxattr(fpath, name, value)
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr " + name, Path: fpath, Err: err}
+		}
+		xattrs[name] = string(value[:size])
+	}
+	return xattrs, nil
+}
+
+// setXattr sets the extended attribute name of the
+// file at fpath, or of the link if it is a symbolic
+// link, to value.
+func setXattr(fpath, name string, value []byte) error {
+	err := unix.Lsetxattr(fpath, name, value, 0)
+	if err != nil {
+		return &os.PathError{Op: "setxattr " + name, Path: fpath, Err: err}
+	}
+	return nil
+}
@@ -1,7 +1,6 @@
 package archiver
 
 import (
-	"fmt"
 	"io"
 	"path/filepath"
 
@@ -36,7 +35,7 @@ func (x *Xz) Decompress(in io.Reader, out io.Writer) error {
 // CheckExt ensures the file extension matches the format.
 func (x *Xz) CheckExt(filename string) error {
 	if filepath.Ext(filename) != ".xz" {
-		return fmt.Errorf("filename must have a .xz extension")
+		return pathErrorf(ErrFormatMismatch, filename, "filename must have a .xz extension")
 	}
 	return nil
 }
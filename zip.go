@@ -4,16 +4,25 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/flate"
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
 // Zip provides facilities for operating ZIP archives.
+// As with Tar, methods which do a whole operation can
+// be called concurrently, but Create, Open, Read, Write
+// and Close cannot.
+// Zip64 extensions are written as needed, when an archive
+// has more than 65,535 entries or when an entry or the
+// archive itself is 4 GiB or larger, and are understood
+// when reading.
 // See https://pkware.cachefly.net/webdocs/casestudies/APPNOTE.TXT.
 type Zip struct {
 	// The compression level to use, as described
@@ -24,10 +33,94 @@ type Zip struct {
 	// an error is returned if the file exists.
 	OverwriteExisting bool
 
+	// What to do when a file being extracted already
+	// exists; with the zero value, OverwriteError,
+	// OverwriteExisting decides.
+	OverwritePolicy OverwritePolicy
+
+	// Whether to extract entries whose paths go outside
+	// of the destination, such as "../../etc/cron.d/x";
+	// if false, an error which is ErrIllegalPath is
+	// returned for them. Only set this for trusted
+	// archives.
+	AllowPathTraversal bool
+
+	// What to do with entries whose paths are absolute,
+	// such as "/etc/passwd"; the zero value,
+	// AbsolutePathStrip, extracts them inside of the
+	// destination with a warning.
+	AbsolutePathPolicy AbsolutePathPolicy
+
+	// How the names of entries are sanitized when they
+	// are extracted by Unarchive, such as to remove
+	// control characters; names are not changed by
+	// default.
+	SanitizeNames NameSanitization
+
+	// The most bytes of contents of any one file to
+	// extract; 0 means no limit. Since contents are
+	// counted as they are decompressed, files which
+	// decompress to much more than they say cannot fill
+	// the disk; extracting them fails with an error which
+	// is ErrLimitExceeded instead.
+	MaxEntrySize int64
+
+	// The most bytes of contents of all files to extract
+	// in one operation, counted like for MaxEntrySize;
+	// 0 means no limit.
+	MaxTotalSize int64
+
+	// If true, Unarchive checks that there is space for
+	// the files it extracts on the filesystem of the
+	// destination (as long as its FileSystem can tell how
+	// much there is), before the disk fills up; if there
+	// is not, it fails with an error which is
+	// ErrInsufficientSpace. The sizes of all the files
+	// are checked before any is extracted, and contents
+	// are counted as they are extracted, like for
+	// MaxTotalSize.
+	CheckDiskSpace bool
+
+	// The most elements of the path of a file to extract,
+	// such as 3 for "a/b/c.txt"; 0 means no limit. Files
+	// with deeper paths are not extracted, and an error
+	// which is ErrLimitExceeded is returned for them.
+	MaxPathDepth int
+
+	// The most bytes of the path of a file to extract,
+	// like PATH_MAX, checked like MaxPathDepth; 0 means
+	// no limit.
+	MaxPathLength int
+
+	// The most bytes of each element of the path of a file
+	// to extract, like NAME_MAX, checked like MaxPathDepth;
+	// 0 means no limit.
+	MaxNameLength int
+
+	// Whether to keep the setuid, setgid and sticky bits
+	// of the modes of files extracted; by default they are
+	// cleared, so that archives from untrusted sources
+	// cannot make setuid programs.
+	KeepSetuid bool
+
+	// If true, the files extracted have the times at which
+	// they are extracted; by default, their modification
+	// times are restored from their headers, those of
+	// directories once the files in them are extracted.
+	DiscardTimes bool
+
 	// Whether to make all the directories necessary
 	// to create a zip archive in the desired path.
 	MkdirAll bool
 
+	// If set, the contents of the files written are
+	// encrypted with AES-256 with this password, as WinZip
+	// does, and it is the password to read files encrypted
+	// with AES. Names and other metadata of files are not
+	// encrypted. Reading files which are encrypted without
+	// it fails with an error which is ErrWrongPassword.
+	Password string
+
 	// If enabled, selective compression will only
 	// compress files which are not already in a
 	// compressed format; this is decided based
@@ -55,6 +148,152 @@ type Zip struct {
 	// the operation will continue on remaining files.
 	ContinueOnError bool
 
+	// If set, errors skipped because of ContinueOnError
+	// are logged to this logger instead of the logger of
+	// the error log policy, and warnings about metadata
+	// which is not preserved are logged to it as well.
+	Logger Logger
+
+	// Files which do not exist on disk, to be added
+	// by Archive after the files listed in sources.
+	VirtualEntries []VirtualEntry
+
+	// If true, information which is lost because it cannot
+	// be represented, such as the ownership of files which
+	// are not owned by the current user (zip archives do
+	// not store owners), is an error rather than a warning.
+	// See Warnings.
+	StrictMetadata bool
+
+	// If true, Unarchive extracts the files grouped by the
+	// directory they are extracted to, rather than in the
+	// order they are stored in the archive. Extracting all
+	// the files of a directory together is faster for huge
+	// archives whose files are stored in no particular
+	// order, since the directory (and the path to it) is
+	// more likely to be cached by the operating system.
+	// Files in the same directory are extracted in the
+	// order they are stored.
+	SortByDirectory bool
+
+	// If greater than zero, Unarchive first makes all the
+	// directories of the archive and checks which of its
+	// files already exist at the destination, using up to
+	// this many goroutines at once, before extracting any
+	// contents. For archives with deep trees, this takes
+	// the directory operations out of the loop which
+	// decompresses and writes files one at a time.
+	PrepassWorkers int
+
+	// The filesystem to which Unarchive extracts files;
+	// if nil, files are extracted to the disk.
+	FileSystem FileSystem
+
+	// The clock which tells the current time, such as
+	// for virtual entries with no modification time;
+	// if nil, the system clock is used.
+	Clock Clock
+
+	// If set, decides what to do when a file fails to be
+	// extracted by Unarchive, instead of ContinueOnError.
+	OnError ErrorHandler
+
+	// If set, is called to report the progress of
+	// archiving and extracting files.
+	Progress ProgressFunc
+
+	// If true, symbolic links are followed when archiving:
+	// files they link to are archived in their place, as
+	// regular files, and so are folders they link to, with
+	// their contents, so the archive has no links (which
+	// cannot always be extracted on Windows). Links which
+	// are broken are archived as links; links in loops
+	// are an error.
+	FollowSymlinks bool
+
+	// Patterns of the paths of files to leave out when
+	// archiving, and of entries not to extract, like the
+	// patterns of .gitignore files, such as "*.o", ".git/"
+	// or "src/**/testdata". Paths are matched as they are
+	// named in archives; see also Filter.
+	ExcludePatterns []string
+
+	// If set, such as to ".gitignore", files in the folders
+	// being archived are left out if they match the patterns
+	// of the files of this name in their folders, or in the
+	// folders they are in, as git ignores them; patterns in
+	// ignore files above the folders being archived are
+	// not used.
+	IgnoreFileName string
+
+	// If set, decides which files are archived by Archive
+	// and ArchiveWriter: files for which it returns false
+	// are left out, and so are the contents of folders
+	// for which it returns false.
+	Filter func(path string, info os.FileInfo) bool
+
+	// If set, changes the names of files in the archives
+	// made by Archive, and ArchiveWriter.
+	NameInArchive NameMapper
+
+	// If set, a manifest of the digests of the contents
+	// of the files archived is made with this algorithm,
+	// which Manifest returns.
+	ManifestAlgorithm HashAlgorithm
+
+	// If set along with ManifestAlgorithm, the manifest
+	// is added to the archive as its last entry, with
+	// this name (such as "SHA256SUMS").
+	ManifestName string
+
+	// If set, archives are signed with this key as they are
+	// written, and Signature returns the signature after
+	// Close; Archive, Update and Remove write it next to
+	// the archive, in a file named like it with ".minisig"
+	// appended.
+	SigningKey *SigningKey
+
+	// If set, such as to "SHA256SUMS", Unarchive verifies
+	// the files it extracts against the manifest entry of
+	// this name in the archive, such as made with
+	// ManifestName, whose digests are of ManifestAlgorithm
+	// (SHA256 if it is not set). Files whose contents do
+	// not match their digests, or which are not listed,
+	// are mismatches; once all the files are extracted,
+	// Unarchive fails with an error which is
+	// ErrManifestMismatch if there are any, or if there
+	// is no manifest.
+	VerifyManifest string
+
+	// If true, the mismatches found with VerifyManifest
+	// are reported as warnings instead of failing Unarchive.
+	ReportManifestMismatches bool
+
+	zipState
+
+	origin *Zip            // see session
+	ctx    context.Context // see withContext
+}
+
+// zipState is the state of a Zip while it reads or
+// writes an archive, and the results of doing so.
+type zipState struct {
+	warnings       []Warning
+	result         OperationResult
+	progress       progressTracker
+	timer          operationTimer
+	manifest       manifestTracker
+	signature      signatureTracker
+	countOut       *countingWriter // archive written by Create
+	prepass        *destinationPrepass
+	retryOverwrite string            // see retryFile
+	extracted      int64             // bytes of contents extracted, for MaxTotalSize
+	space          int64             // bytes available at the destination, for CheckDiskSpace
+	spaceKnown     bool              // whether space is known
+	aesMethod      uint16            // compression method of the file being encrypted
+	verifier       *manifestVerifier // of the files extracted, see VerifyManifest
+	dirTimes       dirTimes          // of the directories extracted, see DiscardTimes
+
 	zw   *zip.Writer
 	zr   *zip.Reader
 	ridx int
@@ -62,15 +301,19 @@ type Zip struct {
 
 // Archive creates a .zip file at destination containing
 // the files listed in sources. The destination must end
-// with ".zip". File paths can be those of regular files
+// with ".zip" (or the extension of a zip-based format,
+// such as ".jar" or ".docx"). File paths can be those of regular files
 // or directories. Regular files are stored at the 'root'
 // of the archive, and directories are recursively added.
 func (z *Zip) Archive(sources []string, destination string) error {
-	if !strings.HasSuffix(destination, ".zip") {
-		return fmt.Errorf("output filename must have .zip extension")
+	z = z.session()
+	defer z.endSession()
+
+	if !hasZipExt(destination) {
+		return pathErrorf(ErrFormatMismatch, destination, "output filename must have .zip extension")
 	}
 	if !z.OverwriteExisting && fileExists(destination) {
-		return fmt.Errorf("file already exists: %s", destination)
+		return &PathError{Path: destination, Err: ErrDestinationExists}
 	}
 
 	// make the folder to contain the resulting archive
@@ -79,64 +322,229 @@ func (z *Zip) Archive(sources []string, destination string) error {
 	if z.MkdirAll && !fileExists(destDir) {
 		err := mkdir(destDir)
 		if err != nil {
-			return fmt.Errorf("making folder for destination: %v", err)
+			return fmt.Errorf("making folder for destination: %w", err)
 		}
 	}
 
 	out, err := os.Create(destination)
 	if err != nil {
-		return fmt.Errorf("creating %s: %v", destination, err)
+		return fmt.Errorf("creating %s: %w", destination, err)
 	}
 	defer out.Close()
 
-	err = z.Create(out)
-	if err != nil {
-		return fmt.Errorf("creating zip: %v", err)
-	}
-	defer z.Close()
-
 	var topLevelFolder string
 	if z.ImplicitTopLevelFolder && multipleTopLevels(sources) {
 		topLevelFolder = folderNameFromFileName(destination)
 	}
 
+	err = z.archiveTo(out, sources, topLevelFolder, destination)
+	if err != nil {
+		return err
+	}
+	return z.signature.writeFile(destination)
+}
+
+// ArchiveWriter writes an archive containing the files
+// listed in sources to w, which can be a stream such as
+// the body of an HTTP response. File paths can be those
+// of regular files or directories; directories will be
+// recursively added. Since there is no archive file to
+// name it after, a top-level folder cannot be made for
+// the files: ImplicitTopLevelFolder must not be set.
+func (z *Zip) ArchiveWriter(sources []string, w io.Writer) error {
+	z = z.session()
+	defer z.endSession()
+
+	if z.ImplicitTopLevelFolder {
+		return fmt.Errorf("implicit top-level folder is not supported when archiving to a stream")
+	}
+	return z.archiveTo(w, sources, "", "")
+}
+
+// Update rewrites the zip archive at archive with the
+// entries named by the keys of replacements replaced by the
+// files at the paths they map to on disk, which are added if
+// there are no such entries. The other entries are copied
+// without being decompressed and compressed again. A replaced
+// entry is written where it was (where it first was, if it
+// was in the archive more than once); added entries are
+// written at the end, in order of their names. The archive
+// is written to a temporary file next to it, which then
+// replaces it.
+func (z *Zip) Update(archive string, replacements map[string]string) error {
+	return z.update(archive, newArchiveEdits(replacements, nil))
+}
+
+// Remove rewrites the zip archive at archive without the
+// entries named in names, and the entries under those which
+// are directories. The other entries are copied without being
+// decompressed and compressed again. If any of the names are
+// not in the archive, it is not changed, and an error is
+// returned. The archive is written to a temporary file next
+// to it, which then replaces it.
+func (z *Zip) Remove(archive string, names []string) error {
+	return z.update(archive, newArchiveEdits(nil, names))
+}
+
+// update rewrites the zip archive at archive with
+// edits, which implements Update and Remove.
+func (z *Zip) update(archive string, edits *archiveEdits) error {
+	z = z.session()
+	defer z.endSession()
+
+	err := updateFile(archive, func(out *os.File) error {
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			return fmt.Errorf("opening archive: %w", err)
+		}
+		defer zr.Close()
+
+		err = z.Create(out)
+		if err != nil {
+			return fmt.Errorf("creating zip: %w", err)
+		}
+		err = z.zw.SetComment(zr.Comment)
+		if err == nil {
+			err = z.copyEdited(zr.File, edits)
+		}
+		closeErr := z.Close()
+		if err != nil {
+			return err
+		}
+		if closeErr != nil {
+			return fmt.Errorf("closing zip: %w", closeErr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return z.signature.writeFile(archive)
+}
+
+// copyEdited writes files to z, which must have been
+// opened for writing first, with edits made to them.
+func (z *Zip) copyEdited(files []*zip.File, edits *archiveEdits) error {
+	for _, zf := range files {
+		if err := contextErr(z.ctx); err != nil {
+			return err
+		}
+		fpath, write, skip := edits.edit(zf.Name)
+		if !skip {
+			err := z.zw.Copy(zf)
+			if err != nil {
+				return fmt.Errorf("copying %s: %w", zf.Name, err)
+			}
+			continue
+		}
+		if write {
+			err := writeReplacement(z, cleanEntryPath(zf.Name), fpath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range edits.additions() {
+		err := writeReplacement(z, name, edits.replacements[name])
+		if err != nil {
+			return err
+		}
+	}
+	return edits.check()
+}
+
+// archiveTo writes an archive containing the files listed in
+// sources to out, under topLevelFolder if it is set. The
+// archive file at destination, if any, is not archived.
+func (z *Zip) archiveTo(out io.Writer, sources []string, topLevelFolder, destination string) error {
+	err := z.Create(out)
+	if err != nil {
+		return fmt.Errorf("creating zip: %w", err)
+	}
+	if z.Progress != nil {
+		z.progress.entriesTotal = countSourceEntries(sources) + len(z.VirtualEntries)
+	}
+
+	err = z.writeSources(sources, topLevelFolder, destination)
+	closeErr := z.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return fmt.Errorf("closing zip: %w", closeErr)
+	}
+	return nil
+}
+
+// writeSources writes the files listed in sources, and
+// the virtual entries, to z, which must have been
+// opened for writing first.
+func (z *Zip) writeSources(sources []string, topLevelFolder, destination string) error {
 	for _, source := range sources {
+		if err := contextErr(z.ctx); err != nil {
+			return err
+		}
 		err := z.writeWalk(source, topLevelFolder, destination)
 		if err != nil {
-			return fmt.Errorf("walking %s: %v", source, err)
+			return fmt.Errorf("walking %s: %w", source, err)
 		}
 	}
 
-	return nil
+	return writeVirtualEntries(z, z.VirtualEntries, clockOrSystem(z.Clock), false, z.ContinueOnError, z.Logger)
 }
 
 // Unarchive unpacks the .zip file at source to destination.
 // Destination will be treated as a folder name.
 func (z *Zip) Unarchive(source, destination string) error {
-	if !fileExists(destination) && z.MkdirAll {
-		err := mkdir(destination)
+	z = z.session()
+	defer z.endSession()
+
+	fsys := fileSystemOrOS(z.FileSystem)
+	if !fileExistsIn(fsys, destination) && z.MkdirAll {
+		err := mkdirIn(fsys, destination)
 		if err != nil {
-			return fmt.Errorf("preparing destination: %v", err)
+			return fmt.Errorf("preparing destination: %w", err)
 		}
 	}
 
+	exclude, err := newExcludePatterns(z.ExcludePatterns)
+	if err != nil {
+		return err
+	}
+
 	file, err := os.Open(source)
 	if err != nil {
-		return fmt.Errorf("opening source file: %v", err)
+		return fmt.Errorf("opening source file: %w", err)
 	}
 	defer file.Close()
 
 	fileInfo, err := file.Stat()
 	if err != nil {
-		return fmt.Errorf("statting source file: %v", err)
+		return fmt.Errorf("statting source file: %w", err)
 	}
 
 	err = z.Open(file, fileInfo.Size())
 	if err != nil {
-		return fmt.Errorf("opening zip archive for reading: %v", err)
+		return fmt.Errorf("opening zip archive for reading: %w", err)
 	}
 	defer z.Close()
 
+	if len(exclude) > 0 {
+		files := z.zr.File[:0]
+		for _, zf := range z.zr.File {
+			if !exclude.match(zf.Name, zf.FileInfo().IsDir()) {
+				files = append(files, zf)
+			}
+		}
+		z.zr.File = files
+		z.progress.entriesTotal = len(files)
+	}
+
+	if z.SortByDirectory {
+		sortZipFilesByDirectory(z.zr.File)
+	}
+
 	// if the files in the archive do not all share a common
 	// root, then make sure we extract to a single subfolder
 	// rather than potentially littering the destination...
@@ -150,21 +558,117 @@ func (z *Zip) Unarchive(source, destination string) error {
 		}
 	}
 
+	if z.CheckDiskSpace {
+		z.space, z.spaceKnown = spaceAvailableIn(fsys, destination)
+		if z.spaceKnown {
+			var required int64
+			for _, zf := range z.zr.File {
+				if !zf.FileInfo().IsDir() {
+					required += int64(zf.UncompressedSize64)
+				}
+			}
+			err = checkSpace(destination, required, z.space)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if z.PrepassWorkers > 0 {
+		z.prepass = z.prepareDestination(destination)
+		defer func() { z.prepass = nil }()
+	}
+	z.verifier, err = newManifestVerifier(z.VerifyManifest, z.ManifestAlgorithm, z.ReportManifestMismatches)
+	if err != nil {
+		return err
+	}
+	defer func() { z.verifier = nil }()
+
 	for {
+		if err := contextErr(z.ctx); err != nil {
+			return err
+		}
+		idx := z.ridx
+		if idx < len(z.zr.File) {
+			z.progress.start(z.zr.File[idx].Name, int64(z.zr.File[idx].UncompressedSize64))
+		}
 		err := z.extractNext(destination)
 		if err == io.EOF {
 			break
 		}
+		if err != nil && z.OnError != nil {
+			var skipped bool
+			skipped, err = retryFile(z.OnError, z.zr.File[idx].Name, err, func(overwrite string) error {
+				z.ridx, z.retryOverwrite = idx, overwrite
+				defer func() { z.retryOverwrite = "" }()
+				return z.extractNext(destination)
+			})
+			if skipped {
+				z.result.Failed++
+			}
+		}
+		z.progress.finish()
 		if err != nil {
-			if z.ContinueOnError {
-				log.Printf("[ERROR] Reading file in zip archive: %v", err)
+			if z.ContinueOnError && z.OnError == nil {
+				logError(z.Logger, "Reading file in zip archive: %v", err)
+				z.result.Failed++
 				continue
 			}
-			return fmt.Errorf("reading file in zip archive: %v", err)
+			return fmt.Errorf("reading file in zip archive: %w", err)
 		}
 	}
 
-	return nil
+	err = z.dirTimes.restore(fsys, z.Logger, &z.warnings, z.StrictMetadata)
+	if err != nil {
+		return err
+	}
+	return z.verifier.verify(z.Logger, &z.warnings)
+}
+
+// sortZipFilesByDirectory sorts files by the directory
+// they are in, keeping the order of files in the same
+// directory. Parent directories sort before their
+// subdirectories, so directories are made in order.
+func sortZipFilesByDirectory(files []*zip.File) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return zipFileDir(files[i]) < zipFileDir(files[j])
+	})
+}
+
+// zipFileDir returns the directory, as a slash-separated
+// path which ends with a slash (or is empty), that f is
+// extracted to. A directory is in its parent directory.
+func zipFileDir(f *zip.File) string {
+	name := strings.TrimSuffix(strings.Replace(f.Name, `\`, "/", -1), "/")
+	i := strings.LastIndex(name, "/")
+	return name[:i+1]
+}
+
+// prepareDestination runs the pre-pass described
+// by PrepassWorkers for extracting to destination.
+func (z *Zip) prepareDestination(destination string) *destinationPrepass {
+	limits := z.limits()
+	names := make([]string, 0, len(z.zr.File))
+	isDir := make([]bool, 0, len(z.zr.File))
+	var files []string
+	for _, zf := range z.zr.File {
+		name, err := sanitizeName(z.SanitizeNames, zf.Name, nil, nil)
+		if err == nil {
+			name, err = extractPath(destination, name, z.AllowPathTraversal, z.AbsolutePathPolicy, nil)
+		}
+		if err != nil || limits.checkPath(cleanEntryPath(zf.Name)) != nil {
+			continue // fails when it is extracted
+		}
+		names = append(names, name)
+		isDir = append(isDir, zf.FileInfo().IsDir())
+		if !zf.FileInfo().IsDir() {
+			files = append(files, name)
+		}
+	}
+	dirs := uniqueDirs(names, func(i int) bool {
+		return isDir[i]
+	})
+	return prepareDestination(fileSystemOrOS(z.FileSystem), dirs, files, z.PrepassWorkers)
 }
 
 func (z *Zip) extractNext(to string) error {
@@ -177,48 +681,180 @@ func (z *Zip) extractNext(to string) error {
 	if !ok {
 		return fmt.Errorf("expected header to be zip.FileHeader but was %T", f.Header)
 	}
-	return z.extractFile(f, filepath.Join(to, header.Name))
+	f.ReadCloser = ReadFakeCloser{z.progress.reader(f.ReadCloser)}
+	name, err := sanitizeName(z.SanitizeNames, header.Name, z.Logger, &z.warnings)
+	if err != nil {
+		return err
+	}
+	to, err = extractPath(to, name, z.AllowPathTraversal, z.AbsolutePathPolicy, z.Logger)
+	if err != nil {
+		return err
+	}
+	return z.extractFile(f, to)
 }
 
-func (z *Zip) extractFile(f File, to string) error {
+func (z *Zip) extractFile(f File, to string) (err error) {
+	fsys := fileSystemOrOS(z.FileSystem)
+	skipped := false
+	defer func() {
+		if err != nil {
+			return
+		}
+		if skipped {
+			z.result.Skipped++
+			return
+		}
+		err = z.restoreTimes(fsys, f, to)
+		if err != nil {
+			return
+		}
+		err = z.restoreAttributes(fsys, f, to)
+		if err != nil {
+			return
+		}
+		z.result.addEntry(f)
+		z.result.addPath(entryPath(f), to)
+		if f.Mode().IsRegular() {
+			z.result.BytesOut += f.Size()
+		}
+	}()
+
+	limits := z.limits()
+	name := entryPath(f)
+	err = limits.checkPath(name)
+	if err != nil {
+		return err
+	}
+
 	// if a directory, no content; simply make the directory and return
 	if f.IsDir() {
-		return mkdir(to)
+		if z.prepass.madeDir(to) {
+			return nil
+		}
+		return mkdirIn(fsys, to)
 	}
 
 	// do not overwrite existing files, if configured
-	if !z.OverwriteExisting && fileExists(to) {
-		return fmt.Errorf("file already exists: %s", to)
+	if to != z.retryOverwrite {
+		policy := overwritePolicy(z.OverwritePolicy, z.OverwriteExisting)
+		to, err = resolveExisting(fsys, policy, f, to, func(name string) bool {
+			return z.prepass.exists(fsys, name)
+		})
+		if err != nil {
+			return err
+		}
+		if to == "" {
+			skipped = true
+			return nil
+		}
+	}
+
+	err = limits.check(name, f.Size())
+	if err != nil {
+		return err
+	}
+	z.prepass.created(to)
+	r := limits.reader(name, f)
+	done := func() {}
+	if f.Mode().IsRegular() {
+		r, done = z.verifier.track(name, r)
+	}
+	err = writeNewFileIn(fsys, to, r, extractMode(f.Mode(), z.KeepSetuid))
+	if err == nil {
+		done()
+	}
+	return err
+}
+
+// restoreAttributes restores the hidden and system
+// attributes of the file at to, extracted from f,
+// on Windows.
+func (z *Zip) restoreAttributes(fsys FileSystem, f File, to string) error {
+	hdr, ok := f.Header.(zip.FileHeader)
+	if !ok {
+		return nil
+	}
+	reason := restoreAttributesIn(fsys, to, hdr)
+	if reason == "" {
+		return nil
 	}
+	return addWarning(z.Logger, &z.warnings, z.StrictMetadata, Warning{
+		Path:   hdr.Name,
+		Kind:   WarningAttributes,
+		Detail: reason,
+	})
+}
 
-	return writeNewFile(to, f, f.Mode())
+// restoreTimes restores the times of the file at to,
+// extracted from f, as DiscardTimes says; the times of
+// directories are restored once their files are.
+func (z *Zip) restoreTimes(fsys FileSystem, f File, to string) error {
+	if z.DiscardTimes {
+		return nil
+	}
+	switch entryType(f) {
+	case EntrySymlink:
+		// os.Chtimes would change the times of its target
+		return nil
+	case EntryDir:
+		z.dirTimes = append(z.dirTimes, timesOf(f, to))
+		return nil
+	}
+	return restoreTimesIn(fsys, timesOf(f, to), z.Logger, &z.warnings, z.StrictMetadata)
+}
+
+// limits returns the limits on the files
+// being extracted.
+func (z *Zip) limits() extractLimits {
+	return extractLimits{
+		maxEntry:      z.MaxEntrySize,
+		maxTotal:      z.MaxTotalSize,
+		total:         &z.extracted,
+		checkSpace:    z.CheckDiskSpace && z.spaceKnown,
+		space:         z.space,
+		maxPathDepth:  z.MaxPathDepth,
+		maxPathLength: z.MaxPathLength,
+		maxNameLength: z.MaxNameLength,
+	}
 }
 
 func (z *Zip) writeWalk(source, topLevelFolder, destination string) error {
 	sourceAbs, err := filepath.Abs(source)
 	if err != nil {
-		return fmt.Errorf("getting absolute path: %v", err)
+		return fmt.Errorf("getting absolute path: %w", err)
 	}
 	sourceInfo, err := os.Stat(sourceAbs)
 	if err != nil {
-		return fmt.Errorf("%s: stat: %v", source, err)
+		return fmt.Errorf("%s: stat: %w", source, err)
 	}
-	destAbs, err := filepath.Abs(destination)
-	if err != nil {
-		return fmt.Errorf("%s: getting absolute path of destination %s: %v", source, destination, err)
+	var destAbs string
+	if destination != "" {
+		destAbs, err = filepath.Abs(destination)
+		if err != nil {
+			return fmt.Errorf("%s: getting absolute path of destination %s: %w", source, destination, err)
+		}
 	}
 	baseDir := makeBaseDir(topLevelFolder, sourceInfo)
+	exclude, err := newExcludePatterns(z.ExcludePatterns)
+	if err != nil {
+		return err
+	}
+	ignores := newIgnoreFiles(z.IgnoreFileName)
 
-	return filepath.Walk(source, func(fpath string, info os.FileInfo, err error) error {
+	return walkFiles(source, z.FollowSymlinks, func(fpath string, info os.FileInfo, err error) error {
 		handleErr := func(err error) error {
 			if z.ContinueOnError {
-				log.Printf("[ERROR] Walking %s: %v", fpath, err)
+				logError(z.Logger, "Walking %s: %v", fpath, err)
+				z.result.Failed++
 				return nil
 			}
 			return err
 		}
+		if ctxErr := contextErr(z.ctx); ctxErr != nil {
+			return ctxErr
+		}
 		if err != nil {
-			return handleErr(fmt.Errorf("traversing %s: %v", fpath, err))
+			return handleErr(fmt.Errorf("traversing %s: %w", fpath, err))
 		}
 		if info == nil {
 			return handleErr(fmt.Errorf("%s: no file info", fpath))
@@ -228,21 +864,54 @@ func (z *Zip) writeWalk(source, topLevelFolder, destination string) error {
 		// file; that results in an infinite loop and disk exhaustion!
 		fpathAbs, err := filepath.Abs(fpath)
 		if err != nil {
-			return handleErr(fmt.Errorf("%s: getting absolute path: %v", fpath, err))
+			return handleErr(fmt.Errorf("%s: getting absolute path: %w", fpath, err))
 		}
-		if within(fpathAbs, destAbs) {
+		if destAbs != "" && within(fpathAbs, destAbs) {
+			return nil
+		}
+		if z.Filter != nil && !z.Filter(fpath, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
+		if ignores != nil {
+			if ignores.match(fpath, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				err := ignores.load(fpath)
+				if err != nil {
+					return handleErr(err)
+				}
+			}
+		}
 
 		// build the name to be used within the archive
 		nameInArchive, err := makeNameInArchive(sourceInfo, source, baseDir, fpath)
 		if err != nil {
 			return handleErr(err)
 		}
+		if exclude.match(nameInArchive, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		nameInArchive, err = z.NameInArchive.mapName(fpath, nameInArchive)
+		if err != nil {
+			return handleErr(err)
+		}
+		if nameInArchive == "" {
+			return nil
+		}
 
 		file, err := os.Open(fpath)
 		if err != nil {
-			return handleErr(fmt.Errorf("%s: opening: %v", fpath, err))
+			return handleErr(fmt.Errorf("%s: opening: %w", fpath, err))
 		}
 		defer file.Close()
 
@@ -254,8 +923,9 @@ func (z *Zip) writeWalk(source, topLevelFolder, destination string) error {
 			ReadCloser: file,
 		})
 		if err != nil {
-			return handleErr(fmt.Errorf("%s: writing: %s", fpath, err))
+			return handleErr(fmt.Errorf("%s: writing: %w", fpath, err))
 		}
+		z.result.addPath(nameInArchive, fpath)
 
 		return nil
 	})
@@ -266,12 +936,26 @@ func (z *Zip) Create(out io.Writer) error {
 	if z.zw != nil {
 		return fmt.Errorf("zip archive is already created for writing")
 	}
-	z.zw = zip.NewWriter(out)
+	err := z.manifest.reset(z.ManifestAlgorithm)
+	if err != nil {
+		return fmt.Errorf("making manifest: %w", err)
+	}
+	z.warnings = nil
+	z.result = OperationResult{}
+	z.timer.start(z.Clock)
+	z.progress.reset(z.Progress)
+	z.countOut = &countingWriter{w: z.signature.reset(z.SigningKey, out)}
+	z.zw = zip.NewWriter(newContextWriter(z.ctx, z.countOut))
 	if z.CompressionLevel != flate.DefaultCompression {
 		z.zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
 			return flate.NewWriter(out, z.CompressionLevel)
 		})
 	}
+	if z.Password != "" {
+		z.zw.RegisterCompressor(zipMethodWinZipAES, func(out io.Writer) (io.WriteCloser, error) {
+			return newZipAESWriter(out, z.Password, z.aesMethod, z.CompressionLevel)
+		})
+	}
 	return nil
 }
 
@@ -287,12 +971,21 @@ func (z *Zip) Write(f File) error {
 		return fmt.Errorf("missing file name")
 	}
 	if f.ReadCloser == nil {
-		return fmt.Errorf("%s: no way to read file contents", f.Name())
+		return entryErrorf(f.Name(), "no way to read file contents")
 	}
 
 	header, err := zip.FileInfoHeader(f)
 	if err != nil {
-		return fmt.Errorf("%s: getting header: %v", f.Name(), err)
+		return entryErrorf(f.Name(), "getting header: %w", err)
+	}
+	header.ExternalAttrs |= zipAttributes(f.Sys())
+	setZipTimes(header, f.Sys())
+
+	if w, ok := ownershipWarning(f.Name(), f); ok {
+		err := addWarning(z.Logger, &z.warnings, z.StrictMetadata, w)
+		if err != nil {
+			return err
+		}
 	}
 
 	if f.IsDir() {
@@ -306,21 +999,38 @@ func (z *Zip) Write(f File) error {
 			header.Method = zip.Deflate
 		}
 	}
+	if z.Password != "" && header.Mode().IsRegular() {
+		z.aesMethod = header.Method
+		header.Method = zipMethodWinZipAES
+		header.Flags |= 0x1 // encrypted
+		header.Extra = append(header.Extra, zipAESExtra(z.aesMethod)...)
+	}
 
 	writer, err := z.zw.CreateHeader(header)
 	if err != nil {
-		return fmt.Errorf("%s: making header: %v", f.Name(), err)
+		return entryErrorf(f.Name(), "making header: %w", err)
 	}
 
+	z.result.addEntry(f)
+	z.progress.start(header.Name, f.Size())
+	defer z.progress.finish()
+
 	if f.IsDir() {
 		return nil
 	}
 
 	if header.Mode().IsRegular() {
-		_, err := io.Copy(writer, f)
+		contents := z.progress.reader(newContextReader(z.ctx, f))
+		h := z.manifest.hash()
+		if h != nil {
+			contents = io.TeeReader(contents, h)
+		}
+		n, err := io.Copy(writer, contents)
+		z.result.BytesIn += n
 		if err != nil {
-			return fmt.Errorf("%s: copying contents: %v", f.Name(), err)
+			return entryErrorf(f.Name(), "copying contents: %w", err)
 		}
+		z.manifest.add(header.Name, h)
 	}
 
 	return nil
@@ -328,21 +1038,41 @@ func (z *Zip) Write(f File) error {
 
 // Open opens z for reading an archive from in,
 // which is expected to have the given size and
-// which must be an io.ReaderAt.
+// which must be an io.ReaderAt; see OpenReaderAt.
 func (z *Zip) Open(in io.Reader, size int64) error {
 	inRdrAt, ok := in.(io.ReaderAt)
 	if !ok {
 		return fmt.Errorf("reader must be io.ReaderAt")
 	}
+	return z.OpenReaderAt(inRdrAt, size)
+}
+
+// OpenReaderAt opens z for reading an archive of the
+// given size from ra, which can be anything that can
+// be read at any offset, such as a bytes.Reader, a
+// section of another file (io.SectionReader) or an
+// object in remote storage read with range requests.
+// Only the parts of the archive which are needed are
+// read: the central directory, then the files read
+// with Read.
+func (z *Zip) OpenReaderAt(ra io.ReaderAt, size int64) error {
 	if z.zr != nil {
 		return fmt.Errorf("zip archive is already open for reading")
 	}
+	z.result = OperationResult{}
+	z.timer.start(z.Clock)
+	z.progress.reset(z.Progress)
+	z.result.BytesIn = size // parts of the archive may be read more than once
+	if z.ctx != nil {
+		ra = contextReaderAt{ctx: z.ctx, r: ra}
+	}
 	var err error
-	z.zr, err = zip.NewReader(inRdrAt, size)
+	z.zr, err = zip.NewReader(ra, size)
 	if err != nil {
-		return fmt.Errorf("creating reader: %v", err)
+		return fmt.Errorf("creating reader: %w", err)
 	}
 	z.ridx = 0
+	z.progress.entriesTotal = len(z.zr.File)
 	return nil
 }
 
@@ -369,51 +1099,172 @@ func (z *Zip) Read() (File, error) {
 		Header:   zf.FileHeader,
 	}
 
-	rc, err := zf.Open()
+	rc, err := openZipFile(zf, z.Password)
 	if err != nil {
-		return file, fmt.Errorf("%s: open compressed file: %v", zf.Name, err)
+		return file, entryErrorf(zf.Name, "open compressed file: %w", err)
 	}
-	file.ReadCloser = rc
+	file.ReadCloser = trackBody(zf.Name, rc)
 
 	return file, nil
 }
 
 // Close closes the zip archive(s) opened by Create and Open.
 func (z *Zip) Close() error {
+	var err error
 	if z.zr != nil {
 		z.zr = nil
 	}
 	if z.zw != nil {
+		err = z.manifest.embed(z, z.ManifestName, clockOrSystem(z.Clock))
 		zw := z.zw
 		z.zw = nil
-		return zw.Close()
+		if closeErr := zw.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			z.signature.sign(clockOrSystem(z.Clock).Now())
+		}
 	}
-	return nil
+	z.finishResult()
+	return err
+}
+
+// finishResult completes the result of the
+// operation which is being closed.
+func (z *Zip) finishResult() {
+	if z.countOut != nil {
+		z.result.BytesOut = z.countOut.n
+		z.countOut = nil
+	}
+	if d := z.timer.stop(); d > 0 {
+		z.result.Duration = d
+	}
+}
+
+// Warnings returns the warnings of the last
+// archive written with Create (or Archive).
+func (z *Zip) Warnings() []Warning {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	return z.warnings
+}
+
+// Manifest returns the manifest of the files written
+// since Create was last called, if ManifestAlgorithm
+// is set.
+func (z *Zip) Manifest() Manifest {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	return z.manifest.get()
+}
+
+// Signature returns the signature of the archive written
+// since Create was last called, in the format of minisign,
+// if SigningKey is set and the archive was written.
+func (z *Zip) Signature() []byte {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	return z.signature.get()
+}
+
+// Result returns the result of the last operation,
+// which was started by Create or Open (and so by methods
+// like Archive and Unarchive which call them); of
+// concurrent operations, the last to finish is the
+// last operation.
+func (z *Zip) Result() OperationResult {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	result := z.result
+	result.Warnings = z.warnings
+	return result
+}
+
+// Clone returns a copy of the settings of z, which can
+// be changed without changing z, such as to configure
+// DefaultZip differently for some operations.
+func (z *Zip) Clone() *Zip {
+	sessionMu.Lock()
+	c := *z
+	sessionMu.Unlock()
+	c.zipState = zipState{}
+	c.origin, c.ctx = nil, nil
+	c.VirtualEntries = append([]VirtualEntry(nil), z.VirtualEntries...)
+	c.ExcludePatterns = append([]string(nil), z.ExcludePatterns...)
+	return &c
+}
+
+// withContext returns a session of z which checks ctx
+// while it works: between files and while reading or
+// writing archives.
+func (z *Zip) withContext(ctx context.Context) interface{} {
+	s := z.session()
+	s.ctx = ctx
+	return s
+}
+
+// session returns a copy of z with its own state, for
+// doing one operation without changing z, except that
+// endSession saves the results of the operation to z.
+func (z *Zip) session() *Zip {
+	sessionMu.Lock()
+	s := *z
+	sessionMu.Unlock()
+	// the results of the last operation are kept
+	// until the session does an operation itself
+	s.zipState = zipState{result: z.result, warnings: z.warnings, manifest: z.manifest, signature: z.signature}
+	if s.origin == nil {
+		s.origin = z
+	}
+	return &s
+}
+
+// endSession saves the results of the session z to
+// the Zip it was made from.
+func (z *Zip) endSession() {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	z.origin.warnings = z.warnings
+	z.origin.result = z.result
+	z.origin.manifest = z.manifest
+	z.origin.signature = z.signature
 }
 
 // Walk calls walkFn for each visited item in archive.
 func (z *Zip) Walk(archive string, walkFn WalkFunc) error {
+	z = z.session()
+	defer z.endSession()
+	return z.walk(archive, walkFn)
+}
+
+// walk implements Walk, and is used by other methods
+// of z to walk archives with the same session.
+func (z *Zip) walk(archive string, walkFn WalkFunc) error {
+	walkFn = skipDirs(walkFn)
+
 	zr, err := zip.OpenReader(archive)
 	if err != nil {
-		return fmt.Errorf("opening zip reader: %v", err)
+		return fmt.Errorf("opening zip reader: %w", err)
 	}
 	defer zr.Close()
 
 	for _, zf := range zr.File {
-		zfrc, err := zf.Open()
+		if err := contextErr(z.ctx); err != nil {
+			return err
+		}
+		zfrc, err := openZipFile(zf, z.Password)
 		if err != nil {
-			zfrc.Close()
 			if z.ContinueOnError {
-				log.Printf("[ERROR] Opening %s: %v", zf.Name, err)
+				logError(z.Logger, "Opening %s: %v", zf.Name, err)
 				continue
 			}
-			return fmt.Errorf("opening %s: %v", zf.Name, err)
+			return fmt.Errorf("opening %s: %w", zf.Name, err)
 		}
 
 		err = walkFn(File{
 			FileInfo:   zf.FileInfo(),
 			Header:     zf.FileHeader,
-			ReadCloser: zfrc,
+			ReadCloser: newContextReadCloser(z.ctx, zfrc),
 		})
 		zfrc.Close()
 		if err != nil {
@@ -421,20 +1272,219 @@ func (z *Zip) Walk(archive string, walkFn WalkFunc) error {
 				break
 			}
 			if z.ContinueOnError {
-				log.Printf("[ERROR] Walking %s: %v", zf.Name, err)
+				logError(z.Logger, "Walking %s: %v", zf.Name, err)
+				continue
+			}
+			return fmt.Errorf("walking %s: %w", zf.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// List lists the entries of archive, in the
+// order they are in the archive.
+func (z *Zip) List(archive string) ([]EntryInfo, error) {
+	return listWalk(z, archive)
+}
+
+// Validate checks the integrity of the zip archive at
+// archive, as `zip -T` does: the central directory must
+// be readable, and the contents of every file must be as
+// long as its header says, and match its CRC-32. Errors
+// are not ignored, even if ContinueOnError is set.
+func (z *Zip) Validate(archive string) error {
+	z = z.session()
+	defer z.endSession()
+
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("opening zip reader: %w", err)
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		if err := contextErr(z.ctx); err != nil {
+			return err
+		}
+		zfrc, err := openZipFile(zf, z.Password)
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", zf.Name, err)
+		}
+		err = validateContents(zf.Name, zfrc)
+		zfrc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkRef calls walkFn for each visited item in archive,
+// passing a File which is reused for every item. Unlike
+// Walk, the Header is a *zip.FileHeader pointing into the
+// archive's central directory (rather than a copy of it),
+// and the contents of each item are only opened (and the
+// decompressor set up) when they are first read.
+func (z *Zip) WalkRef(archive string, walkFn WalkRefFunc) error {
+	z = z.session()
+	defer z.endSession()
+
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("opening zip reader: %w", err)
+	}
+	defer zr.Close()
+
+	body := new(lazyZipFile)
+	f := File{ReadCloser: body}
+
+	for _, zf := range zr.File {
+		if err := contextErr(z.ctx); err != nil {
+			return err
+		}
+		body.zf = zf
+		f.FileInfo = zf.FileInfo()
+		f.Header = &zf.FileHeader
+		err := walkFn(&f)
+		body.Close()
+		if err != nil {
+			if err == ErrStopWalk {
+				break
+			}
+			if z.ContinueOnError {
+				logError(z.Logger, "Walking %s: %v", zf.Name, err)
+				continue
+			}
+			return fmt.Errorf("walking %s: %w", zf.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// WalkBatches calls fn with batches of batchSize items
+// visited in archive. The contents of each file are only
+// decompressed if they are read.
+func (z *Zip) WalkBatches(archive string, batchSize int, fn WalkBatchFunc) error {
+	z = z.session()
+	defer z.endSession()
+
+	if batchSize < 1 {
+		return fmt.Errorf("invalid batch size: %d", batchSize)
+	}
+
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("opening zip reader: %w", err)
+	}
+	defer zr.Close()
+
+	for start := 0; start < len(zr.File); start += batchSize {
+		end := start + batchSize
+		if end > len(zr.File) {
+			end = len(zr.File)
+		}
+		batch := make([]File, 0, end-start)
+		for _, zf := range zr.File[start:end] {
+			batch = append(batch, File{
+				FileInfo:   zf.FileInfo(),
+				Header:     zf.FileHeader,
+				ReadCloser: &lazyZipFile{zf: zf, password: z.Password},
+			})
+		}
+
+		err := walkBatch(batch, fn)
+		if err != nil {
+			if err == ErrStopWalk {
+				break
+			}
+			if z.ContinueOnError {
+				logError(z.Logger, "Walking batch: %v", err)
 				continue
 			}
-			return fmt.Errorf("walking %s: %v", zf.Name, err)
+			return fmt.Errorf("walking batch: %w", err)
 		}
 	}
 
 	return nil
 }
 
+// lazyZipFile is an io.ReadCloser which opens
+// the contents of zf upon the first read.
+type lazyZipFile struct {
+	zf       *zip.File
+	password string
+	rc       io.ReadCloser
+}
+
+func (lzf *lazyZipFile) Read(p []byte) (int, error) {
+	if lzf.rc == nil {
+		rc, err := openZipFile(lzf.zf, lzf.password)
+		if err != nil {
+			return 0, fmt.Errorf("opening %s: %w", lzf.zf.Name, err)
+		}
+		lzf.rc = rc
+	}
+	return lzf.rc.Read(p)
+}
+
+func (lzf *lazyZipFile) Close() error {
+	if lzf.rc == nil {
+		return nil
+	}
+	err := lzf.rc.Close()
+	lzf.rc = nil
+	return err
+}
+
+// Sample reads the headers of n items of archive chosen
+// at random. Since the central directory of a zip archive
+// lists all its items, the sample is stratified: the items
+// are divided into n consecutive groups of (nearly) equal
+// size and one item is chosen from each, which spreads the
+// sample across the whole archive. The file data of the
+// archive is not read at all.
+func (z *Zip) Sample(archive string, n int) (ArchiveSample, error) {
+	z = z.session()
+	defer z.endSession()
+
+	var sample ArchiveSample
+	if n <= 0 {
+		return sample, fmt.Errorf("sample size must be positive")
+	}
+
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return sample, fmt.Errorf("opening zip reader: %w", err)
+	}
+	defer zr.Close()
+
+	sample.Total = len(zr.File)
+	if n > sample.Total {
+		n = sample.Total
+	}
+	for i := 0; i < n; i++ {
+		start, end := i*sample.Total/n, (i+1)*sample.Total/n
+		zf := zr.File[start+rand.Intn(end-start)]
+		f := File{FileInfo: zf.FileInfo(), Header: zf.FileHeader}
+		sample.Entries = append(sample.Entries, SampledEntry{
+			FileInfo: f.FileInfo,
+			Path:     entryPath(f),
+			Header:   f.Header,
+		})
+	}
+
+	return sample, nil
+}
+
 // Extract extracts a single file from the zip archive.
 // If the target is a directory, the entire folder will
 // be extracted into destination.
 func (z *Zip) Extract(source, target, destination string) error {
+	z = z.session()
+	defer z.endSession()
+
 	// target refers to a path inside the archive, which should be clean also
 	target = path.Clean(target)
 
@@ -443,7 +1493,7 @@ func (z *Zip) Extract(source, target, destination string) error {
 	// until we are no longer within that directory
 	var targetDirPath string
 
-	return z.Walk(source, func(f File) error {
+	err := z.walk(source, func(f File) error {
 		zfh, ok := f.Header.(zip.FileHeader)
 		if !ok {
 			return fmt.Errorf("expected header to be zip.FileHeader but was %T", f.Header)
@@ -463,13 +1513,16 @@ func (z *Zip) Extract(source, target, destination string) error {
 			// build the filename we will extract to
 			end, err := filepath.Rel(targetDirPath, zfh.Name)
 			if err != nil {
-				return fmt.Errorf("relativizing paths: %v", err)
+				return fmt.Errorf("relativizing paths: %w", err)
+			}
+			joined, err := z.extractTo(destination, filepath.ToSlash(end))
+			if err != nil {
+				return &EntryError{Name: zfh.Name, Err: err}
 			}
-			joined := filepath.Join(destination, end)
 
 			err = z.extractFile(f, joined)
 			if err != nil {
-				return fmt.Errorf("extracting file %s: %v", zfh.Name, err)
+				return fmt.Errorf("extracting file %s: %w", zfh.Name, err)
 			}
 
 			// if our target was not a directory, stop walk
@@ -483,6 +1536,60 @@ func (z *Zip) Extract(source, target, destination string) error {
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	return z.dirTimes.restore(fileSystemOrOS(z.FileSystem), z.Logger, &z.warnings, z.StrictMetadata)
+}
+
+// extractTo returns the path in destination which the
+// entry named name is extracted to, with its name
+// sanitized and checked as when the whole archive is.
+func (z *Zip) extractTo(destination, name string) (string, error) {
+	name, err := sanitizeName(z.SanitizeNames, name, z.Logger, &z.warnings)
+	if err != nil {
+		return "", err
+	}
+	return extractPath(destination, name, z.AllowPathTraversal, z.AbsolutePathPolicy, z.Logger)
+}
+
+// ExtractGlob extracts the files and folders in the
+// archive at source whose paths match pattern to
+// destination, at the same paths under destination as
+// in the archive. An element of "**" in pattern matches
+// any number of path elements, so "**/*.proto" matches
+// all the files named "*.proto" in the archive; the other
+// elements are as in path.Match. Folders which match are
+// made, but the files in them are only extracted if they
+// match too.
+func (z *Zip) ExtractGlob(source, pattern, destination string) error {
+	z = z.session()
+	defer z.endSession()
+
+	gp, err := newGlobPattern(pattern)
+	if err != nil {
+		return fmt.Errorf("parsing pattern: %w", err)
+	}
+
+	err = z.walk(source, func(f File) error {
+		name := entryPath(f)
+		if !gp.match(name) {
+			return nil
+		}
+		to, err := z.extractTo(destination, name)
+		if err != nil {
+			return &EntryError{Name: name, Err: err}
+		}
+		err = z.extractFile(f, to)
+		if err != nil {
+			return fmt.Errorf("extracting file %s: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return z.dirTimes.restore(fileSystemOrOS(z.FileSystem), z.Logger, &z.warnings, z.StrictMetadata)
 }
 
 // Match returns true if the format of file matches this
@@ -510,14 +1617,53 @@ func (z *Zip) String() string { return "zip" }
 // Compile-time checks to ensure type implements desired interfaces.
 var (
 	_ = Reader(new(Zip))
+	_ = ReaderAtOpener(new(Zip))
 	_ = Writer(new(Zip))
 	_ = Archiver(new(Zip))
+	_ = WriterArchiver(new(Zip))
+	_ = Updater(new(Zip))
+	_ = Remover(new(Zip))
 	_ = Unarchiver(new(Zip))
 	_ = Walker(new(Zip))
+	_ = Lister(new(Zip))
+	_ = Validator(new(Zip))
+	_ = ResultReporter(new(Zip))
+	_ = ManifestReporter(new(Zip))
+	_ = SignatureReporter(new(Zip))
+	_ = RefWalker(new(Zip))
+	_ = BatchWalker(new(Zip))
+	_ = Sampler(new(Zip))
 	_ = Extractor(new(Zip))
+	_ = GlobExtractor(new(Zip))
 	_ = Matcher(new(Zip))
+	_ = WarningCollector(new(Zip))
 )
 
+// hasZipExt returns true if filename has the .zip
+// extension or the extension of a format which is
+// a zip archive by another name.
+func hasZipExt(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == ".zip" {
+		return true
+	}
+	_, ok := zipAliases[ext]
+	return ok
+}
+
+// zipAliases is the set of lowercased file extensions
+// of formats which are zip archives under the hood.
+var zipAliases = map[string]struct{}{
+	".apk":  {},
+	".docx": {},
+	".epub": {},
+	".jar":  {},
+	".odt":  {},
+	".pptx": {},
+	".war":  {},
+	".xlsx": {},
+}
+
 // compressedFormats is a (non-exhaustive) set of lowercased
 // file extensions for formats that are typically already
 // compressed. Compressing files that are already compressed
@@ -549,12 +1695,15 @@ var compressedFormats = map[string]struct{}{
 	".sz":   {},
 	".tbz2": {},
 	".tgz":  {},
+	".tlz":  {},
 	".tsz":  {},
 	".txz":  {},
+	".tzst": {},
 	".xlsx": {},
 	".xz":   {},
 	".zip":  {},
 	".zipx": {},
+	".zst":  {},
 }
 
 // DefaultZip is a convenient archiver ready to use.
@@ -563,3 +1712,12 @@ var DefaultZip = &Zip{
 	MkdirAll:             true,
 	SelectiveCompression: true,
 }
+
+// NewZip returns a new Zip configured by opts;
+// unless they set the level, it compresses at the
+// default level (selectively, as DefaultZip does).
+func NewZip(opts ...Option) *Zip {
+	z := &Zip{CompressionLevel: flate.DefaultCompression, SelectiveCompression: true}
+	applyOptions(opts, z)
+	return z
+}
@@ -0,0 +1,487 @@
+package archiver
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZip64ManyEntries(t *testing.T) {
+	for _, count := range []int{65535, 65536} {
+		// entries are stored (not compressed) since
+		// setting up compressors for each is slow
+		buf := new(bytes.Buffer)
+		z := &Zip{SelectiveCompression: true}
+		err := z.Create(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < count; i++ {
+			err := z.Write(zip64TestFile(fmt.Sprintf("%06d.gz", i), 0, bytes.NewReader(nil)))
+			if err != nil {
+				t.Fatalf("[%d entries] writing file %d: %v", count, i, err)
+			}
+		}
+		err = z.Close()
+		if err != nil {
+			t.Fatalf("[%d entries] closing: %v", count, err)
+		}
+
+		err = z.Open(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("[%d entries] opening: %v", count, err)
+		}
+		var read int
+		for {
+			f, err := z.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("[%d entries] reading: %v", count, err)
+			}
+			f.Close()
+			read++
+		}
+		z.Close()
+		if read != count {
+			t.Errorf("expected %d entries but read %d", count, read)
+		}
+	}
+}
+
+func TestZip64LargeEntry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping writing more than 4 GiB in short mode")
+	}
+
+	const uint32max = 1<<32 - 1
+	for _, size := range []int64{uint32max - 1, uint32max} {
+		// store (do not compress) the contents, which are
+		// kept run-length encoded so as to use little memory
+		buf := new(rleBuffer)
+		z := &Zip{SelectiveCompression: true}
+		err := z.Create(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = z.Write(zip64TestFile("big.gz", size, io.LimitReader(zeroReader{}, size)))
+		if err != nil {
+			t.Fatalf("[%d bytes] writing: %v", size, err)
+		}
+		err = z.Write(zip64TestFile("after.txt", 5, bytes.NewReader([]byte("after"))))
+		if err != nil {
+			t.Fatalf("[%d bytes] writing: %v", size, err)
+		}
+		err = z.Close()
+		if err != nil {
+			t.Fatalf("[%d bytes] closing: %v", size, err)
+		}
+
+		err = z.Open(io.NewSectionReader(buf, 0, buf.Size()), buf.Size())
+		if err != nil {
+			t.Fatalf("[%d bytes] opening: %v", size, err)
+		}
+		f, err := z.Read()
+		if err != nil {
+			t.Fatalf("[%d bytes] reading: %v", size, err)
+		}
+		if f.Size() != size {
+			t.Errorf("expected size %d but got %d", size, f.Size())
+		}
+		n, err := io.Copy(ioutil.Discard, f) // also verifies CRC
+		f.Close()
+		if err != nil || n != size {
+			t.Errorf("[%d bytes] read %d bytes: %v", size, n, err)
+		}
+		f, err = z.Read()
+		if err != nil {
+			t.Fatalf("[%d bytes] reading entry after large entry: %v", size, err)
+		}
+		after, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil || string(after) != "after" {
+			t.Errorf("[%d bytes] expected 'after' but got '%s' (%v)", size, after, err)
+		}
+		z.Close()
+	}
+}
+
+func TestZipOpenReaderAt(t *testing.T) {
+	buf := new(bytes.Buffer)
+	z := &Zip{}
+	err := z.Create(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := []byte("contents of the file")
+	err = z.Write(zip64TestFile("file.txt", int64(len(contents)), bytes.NewReader(contents)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = z.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the archive is within other data, as it would
+	// be in a bundle or a self-extracting archive
+	data := append(append([]byte("data before the archive"), buf.Bytes()...), "data after"...)
+	offset := int64(len("data before the archive"))
+	ra := io.NewSectionReader(bytes.NewReader(data), offset, int64(buf.Len()))
+
+	var r ReaderAtOpener = &Zip{}
+	err = r.OpenReaderAt(ra, ra.Size())
+	if err != nil {
+		t.Fatalf("opening: %v", err)
+	}
+	defer r.Close()
+	f, err := r.Read()
+	if err != nil {
+		t.Fatalf("reading: %v", err)
+	}
+	defer f.Close()
+	if f.Name() != "file.txt" {
+		t.Errorf("expected file.txt, got %s", f.Name())
+	}
+	actual, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, contents) {
+		t.Errorf("expected contents %q, got %q", contents, actual)
+	}
+	_, err = r.Read()
+	if err != io.EOF {
+		t.Errorf("expected io.EOF after the only file, got %v", err)
+	}
+}
+
+func zip64TestFile(name string, size int64, r io.Reader) File {
+	return File{
+		FileInfo: FileInfo{
+			FileInfo:   zip64TestFileInfo{name: name, size: size},
+			CustomName: name,
+		},
+		ReadCloser: ReadFakeCloser{r},
+	}
+}
+
+type zip64TestFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi zip64TestFileInfo) Name() string       { return fi.name }
+func (fi zip64TestFileInfo) Size() int64        { return fi.size }
+func (fi zip64TestFileInfo) Mode() os.FileMode  { return 0644 }
+func (fi zip64TestFileInfo) ModTime() time.Time { return time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC) }
+func (fi zip64TestFileInfo) IsDir() bool        { return false }
+func (fi zip64TestFileInfo) Sys() interface{}   { return nil }
+
+// rleBuffer is an in-memory file which stores its
+// contents as runs of repeated bytes, so that large
+// files of zeros take up little space.
+type rleBuffer struct {
+	runs []rleRun
+}
+
+type rleRun struct {
+	off, n int64
+	b      byte
+}
+
+func (r *rleBuffer) Size() int64 {
+	if len(r.runs) == 0 {
+		return 0
+	}
+	last := r.runs[len(r.runs)-1]
+	return last.off + last.n
+}
+
+func (r *rleBuffer) Write(p []byte) (int, error) {
+	for i := 0; i < len(p); {
+		b := p[i]
+		n := 1
+		for i+n < len(p) && p[i+n] == b {
+			n++
+		}
+		if last := len(r.runs) - 1; last >= 0 && r.runs[last].b == b {
+			r.runs[last].n += int64(n)
+		} else {
+			r.runs = append(r.runs, rleRun{off: r.Size(), n: int64(n), b: b})
+		}
+		i += n
+	}
+	return len(p), nil
+}
+
+func (r *rleBuffer) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.Size() {
+		return 0, io.EOF
+	}
+	i := sort.Search(len(r.runs), func(i int) bool {
+		return r.runs[i].off+r.runs[i].n > off
+	})
+	var n int
+	for ; n < len(p) && i < len(r.runs); i++ {
+		run := r.runs[i]
+		start := off + int64(n) - run.off
+		fill := p[n:]
+		if remaining := run.n - start; int64(len(fill)) > remaining {
+			fill = fill[:remaining]
+		}
+		for j := range fill {
+			fill[j] = run.b
+		}
+		n += len(fill)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestZipSortByDirectory(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// files of directories stored interleaved
+	names := []string{"b/1", "a/1", "b/2", "a/sub/", "a/sub/1", "top", "a/2"}
+	archive := filepath.Join(tmp, "unsorted.zip")
+	writeNamesZip(t, archive, names)
+
+	file, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sortZipFilesByDirectory(zr.File)
+	var sorted []string
+	for _, f := range zr.File {
+		sorted = append(sorted, f.Name)
+	}
+	expected := []string{"top", "a/1", "a/sub/", "a/2", "a/sub/1", "b/1", "b/2"}
+	if strings.Join(sorted, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected order %v, got %v", expected, sorted)
+	}
+
+	fsys := NewMemFileSystem(nil)
+	z := &Zip{SortByDirectory: true, FileSystem: fsys}
+	err = z.Unarchive(archive, "dest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		contents, err := fsys.ReadFile(filepath.Join("dest", filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("reading %s: %v", name, err)
+			continue
+		}
+		if string(contents) != name {
+			t.Errorf("expected %s to contain %q, got %q", name, name, contents)
+		}
+	}
+}
+
+func TestZipPrepass(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var names []string
+	for i := 0; i < 20; i++ {
+		deep := strings.Repeat(fmt.Sprintf("d%d/", i%4), i%7+1)
+		names = append(names, deep, deep+fmt.Sprintf("file%d", i))
+	}
+	archive := filepath.Join(tmp, "deep.zip")
+	writeNamesZip(t, archive, names)
+
+	fsys := NewMemFileSystem(nil)
+	err = (&Zip{PrepassWorkers: 4, FileSystem: fsys}).Unarchive(archive, "dest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		info, err := fsys.Stat(filepath.Join("dest", filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if info.IsDir() != strings.HasSuffix(name, "/") {
+			t.Errorf("%s: unexpected mode %v", name, info.Mode())
+		}
+	}
+
+	// existing files are found by the pre-pass, as are
+	// later files in the archive with the same name
+	for _, test := range []struct {
+		names   []string
+		existed string
+	}{
+		{names: []string{"a/1", "a/2"}, existed: "a/2"},
+		{names: []string{"a/1", "a/2", "a/1"}},
+	} {
+		archive := filepath.Join(tmp, "existing.zip")
+		writeNamesZip(t, archive, test.names)
+		fsys := NewMemFileSystem(nil)
+		if test.existed != "" {
+			err := writeNewFileIn(fsys, filepath.Join("dest", filepath.FromSlash(test.existed)), strings.NewReader(""), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := (&Zip{PrepassWorkers: 4, FileSystem: fsys}).Unarchive(archive, "dest")
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("%v: expected error for existing file, got %v", test.names, err)
+		}
+	}
+}
+
+// writeNamesZip writes a zip archive to the file at
+// archive with files of the given names, which are
+// directories if they end with a slash; each file
+// contains its name.
+func writeNamesZip(t *testing.T, archive string, names []string) {
+	out, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	zw := zip.NewWriter(out)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(name, "/") {
+			fmt.Fprint(w, name)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZipAES(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// the jpg is stored, and the others compressed
+	archive := filepath.Join(tmp, "encrypted.zip")
+	z := &Zip{Password: "secret", SelectiveCompression: true}
+	err = z.Archive([]string{"testdata"}, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range []struct {
+		password  string
+		expectErr error
+	}{
+		{password: "secret"},
+		{password: "wrong", expectErr: ErrWrongPassword},
+		{expectErr: ErrWrongPassword},
+	} {
+		dest := filepath.Join(tmp, fmt.Sprint(i))
+		err := (&Zip{Password: tc.password}).Unarchive(archive, dest)
+		if tc.expectErr != nil {
+			if !errors.Is(err, tc.expectErr) {
+				t.Errorf("Test %d: expected error %v, got %v", i, tc.expectErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test %d: unexpected error: %v", i, err)
+		}
+		for _, name := range []string{"quote1.txt", "already-compressed.jpg"} {
+			expected, err := ioutil.ReadFile(filepath.Join("testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := ioutil.ReadFile(filepath.Join(dest, "testdata", name))
+			if !bytes.Equal(actual, expected) {
+				t.Errorf("Test %d: expected contents of %s to be kept, got %d bytes (%v)", i, name, len(actual), err)
+			}
+		}
+	}
+
+	// contents which are changed fail to authenticate
+	data, err := ioutil.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, zf := range zr.File {
+		if zf.Method != zipMethodWinZipAES {
+			continue
+		}
+		offset, err := zf.DataOffset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[offset+20] ^= 0xff // after the salt and verifier
+		break
+	}
+	tampered := filepath.Join(tmp, "tampered.zip")
+	err = ioutil.WriteFile(tampered, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&Zip{Password: "secret"}).Unarchive(tampered, filepath.Join(tmp, "tampered"))
+	if !errors.Is(err, zip.ErrChecksum) {
+		t.Errorf("expected error for tampered contents, got %v", err)
+	}
+}
+
+func TestPBKDF2SHA1(t *testing.T) {
+	// from RFC 6070
+	for i, tc := range []struct {
+		iter     int
+		keyLen   int
+		expected string
+	}{
+		{iter: 1, keyLen: 20, expected: "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{iter: 2, keyLen: 20, expected: "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{iter: 4096, keyLen: 20, expected: "4b007901b765489abead49d926f721d065a429c1"},
+	} {
+		key := pbkdf2SHA1([]byte("password"), []byte("salt"), tc.iter, tc.keyLen)
+		if actual := fmt.Sprintf("%x", key); actual != tc.expected {
+			t.Errorf("Test %d: expected %s, got %s", i, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package archiver
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+// The method and extra field of zip entries encrypted
+// with AES, as WinZip does; the method the contents are
+// compressed with is in the extra field. See
+// https://www.winzip.com/en/support/aes-encryption/.
+const (
+	zipMethodWinZipAES uint16 = 99
+	zipExtraWinZipAES  uint16 = 0x9901
+)
+
+const (
+	zipAESStrength256  = 3 // key strength of AES-256
+	zipAESIterations   = 1000
+	zipAESVerifierSize = 2
+	zipAESAuthSize     = 10 // truncated HMAC-SHA1
+)
+
+// zipAESExtra returns the extra field of an entry
+// encrypted with AES-256 whose contents are compressed
+// with method. The version is AE-1, whose entries have
+// the CRC-32 of their contents.
+func zipAESExtra(method uint16) []byte {
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra[0:], zipExtraWinZipAES)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], 1) // AE-1
+	copy(extra[6:], "AE")
+	extra[8] = zipAESStrength256
+	binary.LittleEndian.PutUint16(extra[9:], method)
+	return extra
+}
+
+// zipAESParams returns the version, key strength and
+// compression method of the entry encrypted with AES
+// whose extra field is extra.
+func zipAESParams(extra []byte) (version uint16, strength byte, method uint16, err error) {
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if tag == zipExtraWinZipAES && size >= 7 {
+			return binary.LittleEndian.Uint16(extra), extra[4], binary.LittleEndian.Uint16(extra[5:]), nil
+		}
+		extra = extra[size:]
+	}
+	return 0, 0, 0, fmt.Errorf("missing AES extra field: %w", zip.ErrFormat)
+}
+
+// zipAESKeys derives the keys for encryption and
+// authentication, and the password verifier, from
+// password and salt, whose size is half that of the key.
+func zipAESKeys(password string, salt []byte) (encKey, authKey, verifier []byte) {
+	keySize := 2 * len(salt)
+	key := pbkdf2SHA1([]byte(password), salt, zipAESIterations, 2*keySize+zipAESVerifierSize)
+	return key[:keySize], key[keySize : 2*keySize], key[2*keySize:]
+}
+
+// pbkdf2SHA1 derives a key of keyLen bytes from password
+// and salt with PBKDF2 (RFC 8018) and HMAC-SHA1.
+func pbkdf2SHA1(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha1.New, password)
+	var key []byte
+	var u []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u = prf.Sum(u[:0])
+		t := append([]byte(nil), u...)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// zipAESStream is AES in counter mode as WinZip uses it:
+// the counter is little-endian and starts at 1, unlike
+// that of cipher.NewCTR.
+type zipAESStream struct {
+	block     cipher.Block
+	counter   [aes.BlockSize]byte
+	keyStream [aes.BlockSize]byte
+	pos       int
+}
+
+func newZipAESStream(key []byte) (*zipAESStream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &zipAESStream{block: block, pos: aes.BlockSize}, nil
+}
+
+func (s *zipAESStream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if s.pos == aes.BlockSize {
+			for j := range s.counter {
+				s.counter[j]++
+				if s.counter[j] != 0 {
+					break
+				}
+			}
+			s.block.Encrypt(s.keyStream[:], s.counter[:])
+			s.pos = 0
+		}
+		dst[i] = src[i] ^ s.keyStream[s.pos]
+		s.pos++
+	}
+}
+
+// zipAESWriter encrypts the contents of an entry
+// and writes them to w, after the salt and password
+// verifier, and before the authentication code.
+type zipAESWriter struct {
+	w      io.Writer
+	header []byte // written with the first contents, see writeHeader
+	stream cipher.Stream
+	mac    hash.Hash
+	buf    []byte
+}
+
+// newZipAESWriter returns a writer of the contents of an
+// entry encrypted with AES-256 with password to w, which
+// compresses them with method first, at level for Deflate.
+func newZipAESWriter(w io.Writer, password string, method uint16, level int) (io.WriteCloser, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, fmt.Errorf("making salt: %w", err)
+	}
+	encKey, authKey, verifier := zipAESKeys(password, salt)
+	stream, err := newZipAESStream(encKey)
+	if err != nil {
+		return nil, err
+	}
+	aw := &zipAESWriter{
+		w:      w,
+		header: append(salt, verifier...),
+		stream: stream,
+		mac:    hmac.New(sha1.New, authKey),
+	}
+	switch method {
+	case zip.Store:
+		return aw, nil
+	case zip.Deflate:
+		fw, err := flate.NewWriter(aw, level)
+		if err != nil {
+			return nil, err
+		}
+		return &zipAESDeflateWriter{Writer: fw, aw: aw}, nil
+	default:
+		return nil, zip.ErrAlgorithm
+	}
+}
+
+// writeHeader writes the salt and password verifier,
+// if they were not written yet. They cannot be written
+// when aw is made, since zip.Writer makes compressors
+// before it writes the local header of their entry.
+func (aw *zipAESWriter) writeHeader() error {
+	if aw.header == nil {
+		return nil
+	}
+	_, err := aw.w.Write(aw.header)
+	aw.header = nil
+	return err
+}
+
+func (aw *zipAESWriter) Write(p []byte) (int, error) {
+	if err := aw.writeHeader(); err != nil {
+		return 0, err
+	}
+	if cap(aw.buf) < len(p) {
+		aw.buf = make([]byte, len(p))
+	}
+	buf := aw.buf[:len(p)]
+	aw.stream.XORKeyStream(buf, p)
+	aw.mac.Write(buf)
+	return aw.w.Write(buf)
+}
+
+// Close writes the authentication code.
+func (aw *zipAESWriter) Close() error {
+	if err := aw.writeHeader(); err != nil {
+		return err
+	}
+	_, err := aw.w.Write(aw.mac.Sum(nil)[:zipAESAuthSize])
+	return err
+}
+
+// zipAESDeflateWriter compresses contents
+// before they are encrypted by aw.
+type zipAESDeflateWriter struct {
+	*flate.Writer
+	aw *zipAESWriter
+}
+
+func (w *zipAESDeflateWriter) Close() error {
+	err := w.Writer.Close()
+	if err != nil {
+		return err
+	}
+	return w.aw.Close()
+}
+
+// openZipFile opens the contents of zf for reading,
+// decrypting them with password if they are encrypted
+// with AES.
+func openZipFile(zf *zip.File, password string) (io.ReadCloser, error) {
+	if zf.Method != zipMethodWinZipAES {
+		return zf.Open()
+	}
+	version, strength, method, err := zipAESParams(zf.Extra)
+	if err != nil {
+		return nil, err
+	}
+	if strength < 1 || strength > 3 {
+		return nil, fmt.Errorf("AES key strength %d: %w", strength, zip.ErrAlgorithm)
+	}
+	if password == "" {
+		return nil, fmt.Errorf("entry is encrypted: %w", ErrWrongPassword)
+	}
+	saltSize := 4 + 4*int64(strength) // half the key size
+	size := int64(zf.CompressedSize64) - saltSize - zipAESVerifierSize - zipAESAuthSize
+	if size < 0 {
+		return nil, zip.ErrFormat
+	}
+
+	raw, err := zf.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, saltSize+zipAESVerifierSize)
+	_, err = io.ReadFull(raw, header)
+	if err != nil {
+		return nil, err
+	}
+	encKey, authKey, verifier := zipAESKeys(password, header[:saltSize])
+	if !hmac.Equal(verifier, header[saltSize:]) {
+		return nil, ErrWrongPassword
+	}
+	stream, err := newZipAESStream(encKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := &zipAESReader{
+		raw:       raw,
+		encrypted: io.LimitReader(raw, size),
+		mac:       hmac.New(sha1.New, authKey),
+		crc:       crc32.NewIEEE(),
+		checkCRC:  version == 1,
+		wantCRC:   zf.CRC32,
+	}
+	ar.r = cipher.StreamReader{S: stream, R: io.TeeReader(ar.encrypted, ar.mac)}
+	switch method {
+	case zip.Store:
+	case zip.Deflate:
+		ar.decompressor = flate.NewReader(ar.r)
+		ar.r = ar.decompressor
+	default:
+		return nil, zip.ErrAlgorithm
+	}
+	return ar, nil
+}
+
+// zipAESReader reads the contents of an entry encrypted
+// with AES, and checks the authentication code, and the
+// CRC-32 for version AE-1, at the end.
+type zipAESReader struct {
+	r            io.Reader // decrypted and decompressed
+	raw          io.Reader
+	encrypted    io.Reader
+	decompressor io.ReadCloser
+	mac          hash.Hash
+	crc          hash.Hash32
+	checkCRC     bool
+	wantCRC      uint32
+	err          error
+}
+
+func (ar *zipAESReader) Read(p []byte) (int, error) {
+	if ar.err != nil {
+		return 0, ar.err
+	}
+	n, err := ar.r.Read(p)
+	ar.crc.Write(p[:n])
+	if err == io.EOF {
+		err = ar.verify()
+		if err == nil {
+			err = io.EOF
+		}
+	}
+	ar.err = err
+	return n, err
+}
+
+// verify checks the contents which were read,
+// once they have all been read.
+func (ar *zipAESReader) verify() error {
+	// compressed contents may end before the data
+	_, err := io.Copy(ioutil.Discard, io.TeeReader(ar.encrypted, ar.mac))
+	if err != nil {
+		return err
+	}
+	code := make([]byte, zipAESAuthSize)
+	_, err = io.ReadFull(ar.raw, code)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(code, ar.mac.Sum(nil)[:zipAESAuthSize]) {
+		return fmt.Errorf("authentication code does not match: %w", zip.ErrChecksum)
+	}
+	if ar.checkCRC && ar.crc.Sum32() != ar.wantCRC {
+		return zip.ErrChecksum
+	}
+	return nil
+}
+
+func (ar *zipAESReader) Close() error {
+	if ar.decompressor != nil {
+		return ar.decompressor.Close()
+	}
+	return nil
+}
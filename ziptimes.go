@@ -0,0 +1,153 @@
+package archiver
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"time"
+)
+
+// The extra fields of zip entries which have their times in
+// UTC: the extended timestamp field of Info-ZIP, in seconds,
+// and the NTFS field, in 100-nanosecond intervals. See
+// https://libzip.org/specifications/extrafld.txt.
+const (
+	zipExtraNTFS      uint16 = 0x000a
+	zipExtraTimestamp uint16 = 0x5455
+)
+
+// ntfsEpoch is the time from which the
+// times in the NTFS extra field count.
+var ntfsEpoch = time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// setZipTimes adds the extended timestamp and NTFS extra
+// fields to header, with its modification time and the
+// access and creation times of the file whose info has
+// sys, the result of os.FileInfo.Sys, if they are known.
+// The legacy MS-DOS time is set in the local time of the
+// modification time, as zip.Writer does; but since it
+// also adds an extended timestamp field of its own when
+// header.Modified is set, that is cleared.
+func setZipTimes(header *zip.FileHeader, sys interface{}) {
+	mtime := header.Modified
+	if mtime.IsZero() {
+		return
+	}
+	atime, ctime := fileCreationTimes(sys)
+	header.ModifiedDate, header.ModifiedTime = msdosTime(mtime)
+	header.Modified = time.Time{}
+	header.Extra = append(header.Extra, zipTimesExtra(mtime, atime, ctime)...)
+}
+
+// zipTimesExtra returns the extended timestamp extra field,
+// with mtime only, since the field in the central directory
+// can only have that, followed by the NTFS extra field with
+// mtime, atime and ctime (the creation time), of which the
+// times unknown are zero.
+func zipTimesExtra(mtime, atime, ctime time.Time) []byte {
+	extra := make([]byte, 9+36)
+	binary.LittleEndian.PutUint16(extra[0:], zipExtraTimestamp)
+	binary.LittleEndian.PutUint16(extra[2:], 5)
+	extra[4] = 1 // has modification time
+	binary.LittleEndian.PutUint32(extra[5:], uint32(mtime.Unix()))
+
+	ntfs := extra[9:]
+	binary.LittleEndian.PutUint16(ntfs[0:], zipExtraNTFS)
+	binary.LittleEndian.PutUint16(ntfs[2:], 32)
+	// 4 reserved bytes
+	binary.LittleEndian.PutUint16(ntfs[8:], 1) // attribute of the times
+	binary.LittleEndian.PutUint16(ntfs[10:], 24)
+	for i, t := range []time.Time{mtime, atime, ctime} {
+		binary.LittleEndian.PutUint64(ntfs[12+8*i:], ntfsTime(t))
+	}
+	return extra
+}
+
+// zipTimes returns the modification and access times in
+// extra, the extra fields of a zip entry, preferring the
+// NTFS field to the extended timestamp field since its
+// times are more precise; the times it does not have
+// are zero.
+func zipTimes(extra []byte) (mtime, atime time.Time) {
+	var ntfsMtime, ntfsAtime time.Time
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		field := extra[:size]
+		extra = extra[size:]
+
+		switch tag {
+		case zipExtraTimestamp:
+			if len(field) < 1 {
+				continue
+			}
+			flags := field[0]
+			field = field[1:]
+			if flags&1 != 0 && len(field) >= 4 {
+				mtime = time.Unix(int64(binary.LittleEndian.Uint32(field)), 0)
+				field = field[4:]
+			}
+			// only the field in the local header has the access time
+			if flags&2 != 0 && len(field) >= 4 {
+				atime = time.Unix(int64(binary.LittleEndian.Uint32(field)), 0)
+			}
+		case zipExtraNTFS:
+			if len(field) < 4 {
+				continue
+			}
+			field = field[4:] // reserved
+			for len(field) >= 4 {
+				attrTag := binary.LittleEndian.Uint16(field)
+				attrSize := int(binary.LittleEndian.Uint16(field[2:]))
+				field = field[4:]
+				if attrSize > len(field) {
+					break
+				}
+				if attrTag == 1 && attrSize >= 16 {
+					ntfsMtime = fromNTFSTime(binary.LittleEndian.Uint64(field))
+					ntfsAtime = fromNTFSTime(binary.LittleEndian.Uint64(field[8:]))
+				}
+				field = field[attrSize:]
+			}
+		}
+	}
+	if !ntfsMtime.IsZero() {
+		mtime = ntfsMtime
+	}
+	if !ntfsAtime.IsZero() {
+		atime = ntfsAtime
+	}
+	return mtime, atime
+}
+
+// ntfsTime returns t as a Windows file time, or 0,
+// which means unknown, if t is zero or before 1601.
+func ntfsTime(t time.Time) uint64 {
+	if t.Before(ntfsEpoch) {
+		return 0
+	}
+	// t.Sub(ntfsEpoch) would overflow a Duration
+	return uint64(t.Unix()-ntfsEpoch.Unix())*1e7 + uint64(t.Nanosecond()/100)
+}
+
+// fromNTFSTime returns the Windows file time ft
+// as a time, or the zero time if ft is 0.
+func fromNTFSTime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+	const ticksPerSecond = 1e7
+	return time.Unix(ntfsEpoch.Unix()+int64(ft/ticksPerSecond), int64(ft%ticksPerSecond)*100)
+}
+
+// msdosTime returns t as the legacy MS-DOS date and time
+// of zip headers, which are in local time and to within
+// two seconds.
+func msdosTime(t time.Time) (date, tm uint16) {
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	tm = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, tm
+}
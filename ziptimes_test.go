@@ -0,0 +1,81 @@
+package archiver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestZipTimes(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// a time which the legacy MS-DOS time cannot keep
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 123456700, time.UTC)
+	src := filepath.Join(tmp, "file.txt")
+	err = ioutil.WriteFile(src, []byte("contents"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(src, mtime, mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(tmp, "test.zip")
+	z := NewZip()
+	err = z.Archive([]string{src}, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = z.Walk(archive, func(f File) error {
+		if !f.ModTime().Equal(mtime) {
+			t.Errorf("expected modification time %v in archive, got %v", mtime, f.ModTime())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(tmp, "out")
+	err = z.Unarchive(archive, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var extracted bool
+	for _, fpath := range z.Result().Paths {
+		if filepath.Base(fpath) != "file.txt" {
+			continue
+		}
+		extracted = true
+		info, err := os.Stat(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("expected modification time %v once extracted, got %v", mtime, info.ModTime())
+		}
+	}
+	if !extracted {
+		t.Errorf("expected file.txt to be extracted, got %v", z.Result().Paths)
+	}
+
+	for i, tc := range []struct {
+		mtime, atime time.Time
+	}{
+		{mtime: mtime, atime: mtime.Add(time.Hour)},
+		{mtime: mtime},
+		{mtime: time.Date(1970, 1, 1, 0, 0, 1, 0, time.UTC), atime: time.Date(1601, 1, 1, 0, 0, 0, 100, time.UTC)},
+	} {
+		gotMtime, gotAtime := zipTimes(zipTimesExtra(tc.mtime, tc.atime, time.Time{}))
+		if !gotMtime.Equal(tc.mtime) || !gotAtime.Equal(tc.atime) {
+			t.Errorf("Test %d: expected times %v and %v, got %v and %v", i, tc.mtime, tc.atime, gotMtime, gotAtime)
+		}
+	}
+}
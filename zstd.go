@@ -0,0 +1,66 @@
+package archiver
+
+import (
+	"io"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Zstd facilitates Zstandard compression.
+type Zstd struct {
+	// The encoder level to use when compressing;
+	// if not set, zstd.SpeedDefault is used.
+	EncoderLevel zstd.EncoderLevel
+
+	// A dictionary to compress with, and to decompress
+	// data compressed with it, in the zstd dictionary
+	// format (see TrainZstdDict). Dictionaries improve
+	// the compression of small inputs which are similar
+	// to the samples the dictionary was trained on. Data
+	// compressed with a dictionary can only be decompressed
+	// with the same dictionary.
+	Dictionary []byte
+}
+
+// Compress reads in, compresses it, and writes it to out.
+func (zs *Zstd) Compress(in io.Reader, out io.Writer) error {
+	w, err := getZstdDictEncoder(out, zs.EncoderLevel, zs.Dictionary)
+	if err != nil {
+		return err
+	}
+	defer putZstdDictEncoder(w, zs.EncoderLevel, zs.Dictionary)
+	_, err = io.Copy(w, in)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// Decompress reads in, decompresses it, and writes it to out.
+func (zs *Zstd) Decompress(in io.Reader, out io.Writer) error {
+	r, err := getZstdDictDecoder(in, zs.Dictionary)
+	if err != nil {
+		return err
+	}
+	defer putZstdDictDecoder(r, zs.Dictionary)
+	_, err = io.Copy(out, r)
+	return err
+}
+
+// CheckExt ensures the file extension matches the format.
+func (zs *Zstd) CheckExt(filename string) error {
+	if filepath.Ext(filename) != ".zst" {
+		return pathErrorf(ErrFormatMismatch, filename, "filename must have a .zst extension")
+	}
+	return nil
+}
+
+func (zs *Zstd) String() string { return "zst" }
+
+// Compile-time checks to ensure type implements desired interfaces.
+var (
+	_ = Compressor(new(Zstd))
+	_ = Decompressor(new(Zstd))
+)
@@ -0,0 +1,97 @@
+package archiver
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZstdDictionary(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archiver_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// many small, similar files, such as records
+	// of the same kind, benefit from dictionaries
+	samplesDir := filepath.Join(tmp, "samples")
+	err = os.Mkdir(samplesDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		record := fmt.Sprintf(`{"id": %d, "type": "user_account", "status": "active", `+
+			`"created_at": "2019-06-%02dT12:%02d:00Z", "preferences": {"theme": "dark", `+
+			`"notifications": true, "language": "en-US"}, "email": "user%d@example.com"}`,
+			i, i%28+1, i%60, i)
+		err := ioutil.WriteFile(filepath.Join(samplesDir, fmt.Sprintf("%03d.json", i)), []byte(record), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dict, err := DefaultZstdDictTrainer.Train([]string{samplesDir})
+	if err != nil {
+		t.Fatalf("training dictionary: %v", err)
+	}
+
+	input, err := ioutil.ReadFile(filepath.Join(samplesDir, "123.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withDict, without := new(bytes.Buffer), new(bytes.Buffer)
+	err = (&Zstd{Dictionary: dict}).Compress(bytes.NewReader(input), withDict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&Zstd{}).Compress(bytes.NewReader(input), without)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withDict.Len() >= without.Len() {
+		t.Errorf("expected dictionary to improve compression, got %d bytes with and %d without",
+			withDict.Len(), without.Len())
+	}
+
+	output := new(bytes.Buffer)
+	err = (&Zstd{Dictionary: dict}).Decompress(bytes.NewReader(withDict.Bytes()), output)
+	if err != nil {
+		t.Fatalf("decompressing with dictionary: %v", err)
+	}
+	if !bytes.Equal(output.Bytes(), input) {
+		t.Error("decompressed data does not match input")
+	}
+	err = (&Zstd{}).Decompress(bytes.NewReader(withDict.Bytes()), ioutil.Discard)
+	if err == nil {
+		t.Error("expected error decompressing without dictionary")
+	}
+
+	// tarballs round-trip with a dictionary too,
+	// including in the seekable format
+	for _, frameSize := range []int{0, 4096} {
+		archive := filepath.Join(tmp, fmt.Sprintf("dict-%d.tar.zst", frameSize))
+		tzst := &TarZst{Tar: &Tar{}, Dictionary: dict, SeekableFrameSize: frameSize}
+		err = tzst.Archive([]string{samplesDir}, archive)
+		if err != nil {
+			t.Fatalf("archiving with dictionary: %v", err)
+		}
+		var count int
+		err = (&TarZst{Tar: &Tar{}, Dictionary: dict}).Walk(archive, func(f File) error {
+			if f.Mode().IsRegular() {
+				count++
+			}
+			_, err := ioutil.ReadAll(f)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("walking with dictionary: %v", err)
+		}
+		if count != 500 {
+			t.Errorf("expected 500 files, got %d", count)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package archiver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZstdDictTrainer trains zstd dictionaries, for use with
+// the Dictionary fields of Zstd and TarZst, from sample
+// files. A good dictionary is trained on many (hundreds
+// or more) small files which are representative of those
+// that will be compressed with it.
+type ZstdDictTrainer struct {
+	// The maximum size of the dictionary, in bytes;
+	// if 0, the default of the zstd tool (110 KiB)
+	// is used.
+	MaxSize int
+
+	// The encoder level the dictionary is tailored
+	// for; if not set, zstd.SpeedBestCompression
+	// is used.
+	EncoderLevel zstd.EncoderLevel
+}
+
+// Train trains a dictionary from the sample files listed
+// in sources. Directories are walked recursively, and
+// every regular file in them is used as a sample.
+func (zt *ZstdDictTrainer) Train(sources []string) ([]byte, error) {
+	var samples [][]byte
+	for _, source := range sources {
+		err := filepath.Walk(source, func(fpath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fmt.Errorf("traversing %s: %w", fpath, err)
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			data, err := ioutil.ReadFile(fpath)
+			if err != nil {
+				return fmt.Errorf("%s: reading: %w", fpath, err)
+			}
+			samples = append(samples, data)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return zt.TrainSamples(samples)
+}
+
+// TrainSamples trains a dictionary from samples,
+// each of which is the contents of one sample file.
+func (zt *ZstdDictTrainer) TrainSamples(samples [][]byte) ([]byte, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no samples to train on")
+	}
+	maxSize := zt.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultZstdDictSize
+	}
+	d, err := dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: maxSize,
+		HashBytes:   6,
+		ZstdLevel:   zt.EncoderLevel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("building dictionary: %w", err)
+	}
+	return d, nil
+}
+
+const defaultZstdDictSize = 110 << 10
+
+// DefaultZstdDictTrainer is a convenient trainer ready to use.
+var DefaultZstdDictTrainer = &ZstdDictTrainer{}
@@ -0,0 +1,135 @@
+package archiver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// seekableZstdWriter writes the zstd seekable format: the
+// data is compressed in independent frames of at most
+// frameSize uncompressed bytes, and a seek table listing
+// the size of every frame is appended in a skippable
+// frame, so readers which understand the format can
+// decompress any part of the stream without starting at
+// the beginning. Other readers skip the seek table.
+// See https://github.com/facebook/zstd/blob/dev/contrib/seekable_format/zstd_seekable_compression_format.md.
+type seekableZstdWriter struct {
+	w         io.Writer
+	enc       *zstd.Encoder
+	level     zstd.EncoderLevel
+	dict      []byte
+	frameSize int
+	buf       []byte // uncompressed data of the current frame
+	dst       []byte // reused for compressed frames
+	frames    []seekableZstdFrame
+}
+
+type seekableZstdFrame struct {
+	compressedSize, decompressedSize uint32
+}
+
+func newSeekableZstdWriter(w io.Writer, level zstd.EncoderLevel, dict []byte, frameSize int) (*seekableZstdWriter, error) {
+	if frameSize <= 0 || frameSize > maxSeekableZstdFrameSize {
+		return nil, fmt.Errorf("seekable frame size must be between 1 and %d bytes, got %d",
+			maxSeekableZstdFrameSize, frameSize)
+	}
+	enc, err := getZstdDictEncoder(nil, level, dict)
+	if err != nil {
+		return nil, err
+	}
+	return &seekableZstdWriter{
+		w:         w,
+		enc:       enc,
+		level:     level,
+		dict:      dict,
+		frameSize: frameSize,
+	}, nil
+}
+
+// Write buffers p, writing out a frame every
+// time frameSize bytes have accumulated.
+func (sw *seekableZstdWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		room := sw.frameSize - len(sw.buf)
+		if room > len(p) {
+			room = len(p)
+		}
+		sw.buf = append(sw.buf, p[:room]...)
+		p = p[room:]
+		n += room
+		if len(sw.buf) == sw.frameSize {
+			if err := sw.writeFrame(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// writeFrame compresses the buffered data as
+// a single frame and records it in the seek table.
+func (sw *seekableZstdWriter) writeFrame() error {
+	sw.dst = sw.enc.EncodeAll(sw.buf, sw.dst[:0])
+	if _, err := sw.w.Write(sw.dst); err != nil {
+		return err
+	}
+	sw.frames = append(sw.frames, seekableZstdFrame{
+		compressedSize:   uint32(len(sw.dst)),
+		decompressedSize: uint32(len(sw.buf)),
+	})
+	sw.buf = sw.buf[:0]
+	return nil
+}
+
+// Close writes out the last frame and the seek table,
+// and returns the encoder to its pool. It does not
+// close the underlying writer.
+func (sw *seekableZstdWriter) Close() error {
+	if sw.enc == nil {
+		return nil
+	}
+	defer func() {
+		putZstdDictEncoder(sw.enc, sw.level, sw.dict)
+		sw.enc = nil
+	}()
+
+	// an empty stream still gets one (empty) frame,
+	// since a stream of only a skippable frame is
+	// rejected by some decoders
+	if len(sw.buf) > 0 || len(sw.frames) == 0 {
+		if err := sw.writeFrame(); err != nil {
+			return err
+		}
+	}
+
+	const entrySize, footerSize = 8, 9
+	tableSize := len(sw.frames)*entrySize + footerSize
+	table := make([]byte, 8+tableSize)
+	binary.LittleEndian.PutUint32(table[0:4], seekableZstdSkippableMagic)
+	binary.LittleEndian.PutUint32(table[4:8], uint32(tableSize))
+	entries := table[8:]
+	for _, f := range sw.frames {
+		binary.LittleEndian.PutUint32(entries[0:4], f.compressedSize)
+		binary.LittleEndian.PutUint32(entries[4:8], f.decompressedSize)
+		entries = entries[entrySize:]
+	}
+	binary.LittleEndian.PutUint32(entries[0:4], uint32(len(sw.frames)))
+	entries[4] = 0 // descriptor: no checksums
+	binary.LittleEndian.PutUint32(entries[5:9], seekableZstdMagic)
+
+	_, err := sw.w.Write(table)
+	return err
+}
+
+const (
+	seekableZstdSkippableMagic = 0x184D2A5E
+	seekableZstdMagic          = 0x8F92EAB1
+
+	// sizes in the seek table are 32 bits, which must
+	// also hold the compressed size of a frame
+	maxSeekableZstdFrameSize = 1 << 30
+)